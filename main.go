@@ -6,7 +6,10 @@ import (
 	"gonotes/models"
 	"gonotes/web"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/rohanthewiz/logger"
 	"github.com/rohanthewiz/rutil/fileops"
@@ -14,9 +17,13 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
+// syncShutdownTimeout bounds how long shutdown waits for an in-flight
+// sync cycle to finish before closing the database anyway.
+const syncShutdownTimeout = 30 * time.Second
+
 func main() {
-	// Initialize logger
-	logger.SetLogLevel("info")
+	// Initialize logger from GONOTES_LOG_LEVEL / GONOTES_LOG_FORMAT
+	models.ConfigureLogging()
 
 	// Resolve default directory: ~/.gonotes
 	home, err := os.UserHomeDir()
@@ -108,14 +115,100 @@ func serve(dir, port string) error {
 		return fmt.Errorf("failed to initialize JWT: %w", err)
 	}
 
+	// A read replica serves reads and refuses writes
+	if models.ReadOnlyEnabled() {
+		models.SetReadOnly(true)
+		logger.Info("Read-only mode enabled; writes will be refused")
+	}
+
 	// Initialize sync client if configured via environment variables.
 	initSyncClient()
 
-	// Start server
-	srv := web.NewServer(port)
-	logger.Info("Starting GoNotes Web", "port", port)
+	// Purge long-deleted notes daily if a retention period is configured.
+	// Deferred after CloseDB so it stops first.
+	stopAutoPurge := startAutoPurge()
+	defer stopAutoPurge()
 
-	return web.Run(srv)
+	// Start server. GONOTES_LISTEN_ADDR, if set, overrides --port.
+	addr, err := web.ListenAddress(port)
+	if err != nil {
+		return err
+	}
+	srv := web.NewServer(addr)
+	logger.Info("Starting GoNotes Web", "address", addr)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- web.Run(srv)
+	}()
+
+	// Block until the server fails or we're asked to shut down. On a signal,
+	// let any running sync cycle finish before the deferred CloseDB runs.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	select {
+	case err := <-serverErr:
+		stopSyncClient()
+		return err
+	case sig := <-sigCh:
+		logger.Info("Shutting down", "signal", sig.String())
+		stopSyncClient()
+		return nil
+	}
+}
+
+// stopSyncClient stops the sync client, if one is running, waiting up to
+// syncShutdownTimeout for an in-flight cycle to complete.
+func stopSyncClient() {
+	client := models.GetSyncClient()
+	if client == nil {
+		return
+	}
+	if err := client.StopAndWait(syncShutdownTimeout); err != nil {
+		logger.LogErr(err, "Sync cycle did not finish before shutdown")
+	}
+}
+
+// autoPurgeInterval is how often deleted notes past their retention period
+// are purged.
+const autoPurgeInterval = 24 * time.Hour
+
+// startAutoPurge runs models.AutoPurgeDeletedNotes once now and then on every
+// autoPurgeInterval tick. It does nothing when no retention period is set
+// or the instance is read-only.
+// The returned function stops the ticker and waits for a running purge.
+func startAutoPurge() func() {
+	retention := models.DeletedNoteRetention()
+	if retention == 0 || models.IsReadOnly() {
+		return func() {}
+	}
+	logger.Info("Auto-purge of deleted notes enabled", "retention", retention.String())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(autoPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := models.AutoPurgeDeletedNotes(); err != nil {
+				logger.LogErr(err, "Auto-purge of deleted notes failed")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
 }
 
 // initSyncClient loads sync configuration from environment variables and
@@ -141,13 +234,13 @@ func initSyncClient() {
 	}
 
 	// Use a background context — the sync client manages its own lifecycle
-	// via Stop(). In a future iteration this could use a signal-aware
-	// context for graceful OS signal handling.
+	// via StopAndWait(), which serve() calls on SIGINT/SIGTERM.
 	ctx := context.Background()
 	client.Start(ctx)
 
 	logger.Info("Sync client initialized and running",
 		"hub_url", syncConfig.HubURL,
 		"interval", syncConfig.Interval.String(),
+		"batch_size", syncConfig.BatchSize,
 	)
 }
\ No newline at end of file
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Recent Activity
+//
+// A single feed of the user's recent note and category changes, newest
+// first, built from the change logs. Changes applied from peers
+// (OperationSync) are left out so the feed shows what the user did here, like
+// CountUserAuthoredChanges. Titles and names are the entity's current ones,
+// so a renamed note shows its new title on older entries. Purged notes and
+// deleted categories (which are removed outright) drop out of the feed.
+// ============================================================================
+
+// DefaultActivityLimit and MaxActivityLimit bound GetRecentActivity.
+const (
+	DefaultActivityLimit = 50
+	MaxActivityLimit     = 500
+)
+
+// ActivityItem is one entry in the recent activity feed.
+type ActivityItem struct {
+	EntityType string    `json:"entity_type"` // "note" or "category"
+	EntityGUID string    `json:"entity_guid"`
+	Operation  int32     `json:"operation"` // OperationCreate, OperationUpdate, or OperationDelete
+	Title      string    `json:"title"`     // Note title or category name
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// GetRecentActivity returns the user's most recent note and category changes,
+// interleaved newest first. limit <= 0 means DefaultActivityLimit; it is
+// capped at MaxActivityLimit.
+func GetRecentActivity(userGUID string, limit int) ([]ActivityItem, error) {
+	if limit <= 0 {
+		limit = DefaultActivityLimit
+	}
+	if limit > MaxActivityLimit {
+		limit = MaxActivityLimit
+	}
+
+	rows, err := db.Query(`
+		SELECT 'note' AS entity_type, nc.note_guid, nc.operation, n.title, nc.created_at
+		FROM note_changes nc
+		INNER JOIN notes n ON n.guid = nc.note_guid AND n.created_by = ?
+		WHERE nc.operation != ?
+		UNION ALL
+		SELECT 'category', cc.category_guid, cc.operation, c.name, cc.created_at
+		FROM category_changes cc
+		INNER JOIN categories c ON c.guid = cc.category_guid AND c.created_by = ?
+		WHERE cc.operation != ?
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, userGUID, OperationSync, userGUID, OperationSync, limit)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to query recent activity")
+	}
+	defer rows.Close()
+
+	items := []ActivityItem{}
+	for rows.Next() {
+		var item ActivityItem
+		if err := rows.Scan(&item.EntityType, &item.EntityGUID, &item.Operation, &item.Title, &item.CreatedAt); err != nil {
+			return nil, serr.Wrap(err, "failed to scan activity item")
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
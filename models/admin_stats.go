@@ -0,0 +1,118 @@
+package models
+
+import (
+	"os"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Admin Stats
+//
+// A single overview of what the database holds, for the admin dashboard:
+// note counts (active and soft-deleted), categories, note-category links,
+// recorded changes, how many of those changes each registered peer has yet
+// to pull, and the size of the database files. Counts come from the disk
+// database, the source of truth, so a lazy cache doesn't skew them. Notes
+// have no archived state, so there is no archived count.
+// ============================================================================
+
+// PeerPendingChanges is how many changes a registered peer hasn't pulled.
+// It counts what GetUnifiedChangesForPeer would deliver to the peer: changes
+// to its user's notes and categories that it hasn't acknowledged and didn't
+// originate.
+type PeerPendingChanges struct {
+	PeerID          string `json:"peer_id"`
+	NoteChanges     int    `json:"note_changes"`
+	CategoryChanges int    `json:"category_changes"`
+	Total           int    `json:"total"`
+}
+
+// AdminStats holds database-wide entity counts and file sizes.
+type AdminStats struct {
+	ActiveNotes       int                  `json:"active_notes"`
+	DeletedNotes      int                  `json:"deleted_notes"` // Soft-deleted, in the trash
+	Categories        int                  `json:"categories"`
+	NoteCategoryLinks int                  `json:"note_category_links"`
+	NoteChanges       int                  `json:"note_changes"`
+	CategoryChanges   int                  `json:"category_changes"`
+	TotalChanges      int                  `json:"total_changes"`
+	PendingByPeer     []PeerPendingChanges `json:"pending_by_peer"` // By peer_id; empty on a spoke
+	DBFileBytes       int64                `json:"db_file_bytes"`
+	WALFileBytes      int64                `json:"wal_file_bytes"`
+}
+
+// GetAdminStats counts notes, categories, links, and changes across all
+// users, the changes pending for each registered peer, and the sizes of the
+// database file and its write-ahead log.
+func GetAdminStats() (*AdminStats, error) {
+	stats := &AdminStats{PendingByPeer: []PeerPendingChanges{}}
+
+	err := db.QueryRow(`SELECT
+			(SELECT COUNT(*) FROM notes WHERE deleted_at IS NULL),
+			(SELECT COUNT(*) FROM notes WHERE deleted_at IS NOT NULL),
+			(SELECT COUNT(*) FROM categories),
+			(SELECT COUNT(*) FROM note_categories),
+			(SELECT COUNT(*) FROM note_changes),
+			(SELECT COUNT(*) FROM category_changes)`).Scan(
+		&stats.ActiveNotes, &stats.DeletedNotes, &stats.Categories,
+		&stats.NoteCategoryLinks, &stats.NoteChanges, &stats.CategoryChanges)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to count entities")
+	}
+	stats.TotalChanges = stats.NoteChanges + stats.CategoryChanges
+
+	// Mirrors the unsent-change queries in getUnsentChangesForPeer and
+	// getUnsentCategoryChangesForPeer, scoped to the user each peer syncs as
+	rows, err := db.Query(`
+		SELECT rp.peer_id,
+			(SELECT COUNT(*) FROM note_changes nc
+				INNER JOIN notes n ON nc.note_guid = n.guid AND n.created_by = rp.user_guid
+				WHERE NOT EXISTS (SELECT 1 FROM note_change_sync_peers sp
+					WHERE sp.note_change_id = nc.id AND sp.peer_id = rp.peer_id)
+				AND (nc.origin_peer IS NULL OR nc.origin_peer <> rp.peer_id)),
+			(SELECT COUNT(*) FROM category_changes cc
+				INNER JOIN categories c ON cc.category_guid = c.guid AND c.created_by = rp.user_guid
+				WHERE NOT EXISTS (SELECT 1 FROM category_change_sync_peers sp
+					WHERE sp.category_change_id = cc.id AND sp.peer_id = rp.peer_id)
+				AND (cc.origin_peer IS NULL OR cc.origin_peer <> rp.peer_id))
+		FROM registered_peers rp
+		ORDER BY rp.peer_id`)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to count pending changes per peer")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p PeerPendingChanges
+		if err := rows.Scan(&p.PeerID, &p.NoteChanges, &p.CategoryChanges); err != nil {
+			return nil, serr.Wrap(err, "failed to scan pending changes")
+		}
+		p.Total = p.NoteChanges + p.CategoryChanges
+		stats.PendingByPeer = append(stats.PendingByPeer, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, serr.Wrap(err, "failed to read pending changes")
+	}
+
+	if stats.DBFileBytes, err = fileSize(dbPath); err != nil {
+		return nil, serr.Wrap(err, "failed to stat database file")
+	}
+	if stats.WALFileBytes, err = fileSize(dbPath + ".wal"); err != nil {
+		return nil, serr.Wrap(err, "failed to stat write-ahead log")
+	}
+
+	return stats, nil
+}
+
+// fileSize returns the size of the file at path, or 0 if it doesn't exist
+// (DuckDB removes the WAL after a checkpoint).
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// API Key Authentication
+//
+// API keys are a long-lived alternative to JWTs for scripting against an
+// instance. A key is shown to the user exactly once at creation; only its
+// SHA-256 hash is stored. SHA-256 (rather than bcrypt) is used because keys
+// are high-entropy random values that must be looked up by hash on every
+// request — there is no low-entropy secret to protect against brute force.
+//
+// Clients authenticate with the header: Authorization: ApiKey <key>
+// Revoked keys are kept (revoked_at set) for auditing and always rejected.
+// ============================================================================
+
+// apiKeyPrefix is prepended to generated keys so they are recognizable
+// in config files and secret scanners.
+const apiKeyPrefix = "gnk_"
+
+// DDL for api_keys table — stores hashed API keys per user
+const DDLCreateAPIKeysSequence = `CREATE SEQUENCE IF NOT EXISTS api_keys_id_seq START 1;`
+
+const DDLCreateAPIKeysTable = `
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           BIGINT PRIMARY KEY DEFAULT nextval('api_keys_id_seq'),
+    user_guid    VARCHAR NOT NULL,
+    label        VARCHAR,
+    key_hash     VARCHAR NOT NULL UNIQUE,
+    key_prefix   VARCHAR NOT NULL,
+    created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at   TIMESTAMP
+);
+`
+
+const DDLCreateAPIKeysIndexUserGUID = `CREATE INDEX IF NOT EXISTS idx_api_keys_user_guid ON api_keys(user_guid);`
+
+// APIKeyOutput is the API-safe representation of an API key.
+// It never includes the key itself or its hash — only the short prefix
+// so users can tell their keys apart.
+type APIKeyOutput struct {
+	ID         int64      `json:"id"`
+	Label      string     `json:"label"`
+	KeyPrefix  string     `json:"key_prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	IsRevoked  bool       `json:"is_revoked"`
+}
+
+// hashSecretToken returns the hex-encoded SHA-256 of a high-entropy secret
+// (API key or refresh token) for storage and lookup.
+func hashSecretToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey generates a new API key for the user and stores its hash.
+// The returned plaintext key is not recoverable afterwards — the caller
+// must present it to the user immediately.
+func CreateAPIKey(userGUID, label string) (plaintextKey string, err error) {
+	if userGUID == "" {
+		return "", serr.New("user GUID is required")
+	}
+
+	// 32 bytes of cryptographic randomness → 64 hex chars
+	keyBytes := make([]byte, 32)
+	if _, err = rand.Read(keyBytes); err != nil {
+		return "", serr.Wrap(err, "failed to generate random API key")
+	}
+	plaintextKey = apiKeyPrefix + hex.EncodeToString(keyBytes)
+
+	// Keep a short non-secret prefix for display in key listings
+	displayPrefix := plaintextKey[:len(apiKeyPrefix)+8]
+
+	_, err = db.Exec(`
+		INSERT INTO api_keys (user_guid, label, key_hash, key_prefix)
+		VALUES (?, ?, ?, ?)
+	`, userGUID, strings.TrimSpace(label), hashSecretToken(plaintextKey), displayPrefix)
+	if err != nil {
+		return "", serr.Wrap(err, "failed to create API key")
+	}
+
+	return plaintextKey, nil
+}
+
+// ListAPIKeys returns all API keys (including revoked ones) for a user,
+// most recent first. Secrets are never returned.
+func ListAPIKeys(userGUID string) ([]APIKeyOutput, error) {
+	rows, err := db.Query(`
+		SELECT id, label, key_prefix, created_at, last_used_at, revoked_at
+		FROM api_keys
+		WHERE user_guid = ?
+		ORDER BY created_at DESC, id DESC
+	`, userGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to list API keys")
+	}
+	defer rows.Close()
+
+	keys := []APIKeyOutput{}
+	for rows.Next() {
+		var out APIKeyOutput
+		var label sql.NullString
+		var lastUsedAt, revokedAt sql.NullTime
+		if err := rows.Scan(&out.ID, &label, &out.KeyPrefix, &out.CreatedAt, &lastUsedAt, &revokedAt); err != nil {
+			return nil, serr.Wrap(err, "failed to scan API key")
+		}
+		out.Label = label.String
+		if lastUsedAt.Valid {
+			out.LastUsedAt = &lastUsedAt.Time
+		}
+		if revokedAt.Valid {
+			out.RevokedAt = &revokedAt.Time
+			out.IsRevoked = true
+		}
+		keys = append(keys, out)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, serr.Wrap(err, "error iterating API keys")
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey marks a key as revoked. Only the owning user may revoke a key.
+// Returns false if the key doesn't exist, belongs to another user, or is
+// already revoked.
+func RevokeAPIKey(id int64, userGUID string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE api_keys
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_guid = ? AND revoked_at IS NULL
+	`, id, userGUID)
+	if err != nil {
+		return false, serr.Wrap(err, "failed to revoke API key")
+	}
+
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// AuthenticateAPIKey resolves a plaintext API key to its active owner.
+// Returns nil, nil if the key is unknown, revoked, or the user is disabled,
+// mirroring AuthenticateUser so callers can treat all of these as 401.
+func AuthenticateAPIKey(plaintextKey string) (*User, error) {
+	if !strings.HasPrefix(plaintextKey, apiKeyPrefix) {
+		return nil, nil
+	}
+
+	var keyID int64
+	var userGUID string
+	err := db.QueryRow(`
+		SELECT id, user_guid FROM api_keys
+		WHERE key_hash = ? AND revoked_at IS NULL
+	`, hashSecretToken(plaintextKey)).Scan(&keyID, &userGUID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to look up API key")
+	}
+
+	user, err := GetUserByGUID(userGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to get API key owner")
+	}
+	if user == nil || !user.IsActive {
+		return nil, nil
+	}
+
+	// Best-effort usage tracking — a failure here shouldn't block the request
+	_, _ = db.Exec(`UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?`, keyID)
+
+	return user, nil
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Note Attachments
+//
+// Files (typically images pasted into the editor) stored alongside a note.
+// Attachment bytes live in a BLOB column on the disk database only — they are
+// not mirrored into the in-memory cache, since that would hold every upload in
+// RAM for no read benefit. Attachments are not synced between peers yet.
+// ============================================================================
+
+// DefaultMaxAttachmentSize is the upload limit when GONOTES_MAX_ATTACHMENT_SIZE is unset.
+const DefaultMaxAttachmentSize int64 = 10 << 20 // 10 MiB
+
+// MaxAttachmentSizeEnvVar overrides the per-file upload limit, in bytes.
+const MaxAttachmentSizeEnvVar = "GONOTES_MAX_ATTACHMENT_SIZE"
+
+// ErrAttachmentTooLarge is returned by AddAttachment when the upload exceeds
+// MaxAttachmentSize. Handlers map it to 413 Request Entity Too Large.
+var ErrAttachmentTooLarge = errors.New("attachment exceeds maximum size")
+
+// DDL for attachments table — file contents are stored inline as a BLOB
+const DDLCreateAttachmentsSequence = `CREATE SEQUENCE IF NOT EXISTS attachments_id_seq START 1;`
+
+const DDLCreateAttachmentsTable = `
+CREATE TABLE IF NOT EXISTS attachments (
+    id           BIGINT PRIMARY KEY DEFAULT nextval('attachments_id_seq'),
+    note_id      BIGINT NOT NULL,
+    filename     VARCHAR NOT NULL,
+    content_type VARCHAR NOT NULL,
+    size         BIGINT NOT NULL,
+    data         BLOB NOT NULL,
+    created_by   VARCHAR,
+    created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+const DDLCreateAttachmentsIndexNoteID = `CREATE INDEX IF NOT EXISTS idx_attachments_note_id ON attachments(note_id);`
+
+// AttachmentMeta describes an upload. UserGUID must own the target note.
+type AttachmentMeta struct {
+	Filename    string
+	ContentType string
+	UserGUID    string
+}
+
+// Attachment is the metadata of a stored file. The bytes are fetched
+// separately via GetAttachment so listings stay small.
+type Attachment struct {
+	ID          int64     `json:"id"`
+	NoteID      int64     `json:"note_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// MaxAttachmentSize returns the configured per-file upload limit in bytes.
+// Invalid or non-positive values fall back to DefaultMaxAttachmentSize.
+func MaxAttachmentSize() int64 {
+	if sizeStr := os.Getenv(MaxAttachmentSizeEnvVar); sizeStr != "" {
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err == nil && size > 0 {
+			return size
+		}
+		logger.Warn("Ignoring invalid "+MaxAttachmentSizeEnvVar, "value", sizeStr)
+	}
+	return DefaultMaxAttachmentSize
+}
+
+// AddAttachment stores the contents of r as an attachment on the note.
+// Returns nil, nil if the note doesn't exist or isn't owned by meta.UserGUID,
+// and ErrAttachmentTooLarge if r yields more than MaxAttachmentSize bytes.
+func AddAttachment(noteID int64, meta AttachmentMeta, r io.Reader) (*Attachment, error) {
+	if meta.Filename == "" {
+		return nil, serr.New("attachment filename is required")
+	}
+	if meta.ContentType == "" {
+		meta.ContentType = "application/octet-stream"
+	}
+
+	// Verify the note exists and belongs to the uploader
+	var exists int
+	err := db.QueryRow(`SELECT 1 FROM notes WHERE id = ? AND created_by = ? AND deleted_at IS NULL`,
+		noteID, meta.UserGUID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to verify note for attachment")
+	}
+
+	// Read one byte past the limit so an oversized upload is detectable
+	// without buffering the whole thing
+	maxSize := MaxAttachmentSize()
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to read attachment data")
+	}
+	if int64(len(data)) > maxSize {
+		return nil, ErrAttachmentTooLarge
+	}
+
+	att := &Attachment{}
+	err = db.QueryRow(`
+		INSERT INTO attachments (note_id, filename, content_type, size, data, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id, note_id, filename, content_type, size, created_at
+	`, noteID, meta.Filename, meta.ContentType, len(data), data, meta.UserGUID).Scan(
+		&att.ID, &att.NoteID, &att.Filename, &att.ContentType, &att.Size, &att.CreatedAt,
+	)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to store attachment")
+	}
+
+	return att, nil
+}
+
+// ListAttachments returns metadata for a note's attachments, oldest first.
+// Only attachments uploaded by userGUID are returned.
+func ListAttachments(noteID int64, userGUID string) ([]Attachment, error) {
+	rows, err := db.Query(`
+		SELECT id, note_id, filename, content_type, size, created_at
+		FROM attachments
+		WHERE note_id = ? AND created_by = ?
+		ORDER BY created_at ASC, id ASC
+	`, noteID, userGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to list attachments")
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var att Attachment
+		if err := rows.Scan(&att.ID, &att.NoteID, &att.Filename, &att.ContentType, &att.Size, &att.CreatedAt); err != nil {
+			return nil, serr.Wrap(err, "failed to scan attachment")
+		}
+		attachments = append(attachments, att)
+	}
+
+	return attachments, rows.Err()
+}
+
+// GetAttachment returns an attachment's metadata and contents.
+// Returns nil, nil, nil if it doesn't exist or isn't owned by userGUID.
+func GetAttachment(id int64, userGUID string) (*Attachment, []byte, error) {
+	att := &Attachment{}
+	var data []byte
+	err := db.QueryRow(`
+		SELECT id, note_id, filename, content_type, size, created_at, data
+		FROM attachments
+		WHERE id = ? AND created_by = ?
+	`, id, userGUID).Scan(&att.ID, &att.NoteID, &att.Filename, &att.ContentType, &att.Size, &att.CreatedAt, &data)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, serr.Wrap(err, "failed to get attachment")
+	}
+
+	return att, data, nil
+}
+
+// DeleteAttachment permanently removes an attachment owned by userGUID.
+// Returns false if no such attachment exists.
+func DeleteAttachment(id int64, userGUID string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM attachments WHERE id = ? AND created_by = ?`, id, userGUID)
+	if err != nil {
+		return false, serr.Wrap(err, "failed to delete attachment")
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
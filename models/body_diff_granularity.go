@@ -0,0 +1,136 @@
+package models
+
+import (
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ============================================================================
+// Body Diff Granularity
+//
+// Update fragments store note bodies as diff-match-patch patches. Diffing
+// line by line (the default) keeps patches readable and fast, but a one-word
+// edit in a long paragraph still rewrites the whole line. Word granularity
+// diffs runs of letters and digits separately from the whitespace and
+// punctuation between them; char granularity diffs individual characters.
+// Whatever the granularity, the patch hunks are character-offset based, so
+// the stored text is the standard patch format that applyBodyDiff (and any
+// peer) applies without knowing how it was computed.
+// ============================================================================
+
+// BodyDiffGranularityEnvVar selects the unit bodies are diffed in: "line",
+// "word", or "char". Unset or invalid means BodyDiffGranularityLine.
+const BodyDiffGranularityEnvVar = "GONOTES_BODY_DIFF_GRANULARITY"
+
+// Body diff granularities.
+const (
+	BodyDiffGranularityLine = "line"
+	BodyDiffGranularityWord = "word"
+	BodyDiffGranularityChar = "char"
+)
+
+// BodyDiffGranularity returns the configured body diff granularity.
+func BodyDiffGranularity() string {
+	granularity := os.Getenv(BodyDiffGranularityEnvVar)
+	switch strings.ToLower(granularity) {
+	case "", BodyDiffGranularityLine:
+		return BodyDiffGranularityLine
+	case BodyDiffGranularityWord:
+		return BodyDiffGranularityWord
+	case BodyDiffGranularityChar:
+		return BodyDiffGranularityChar
+	}
+	logger.Warn("Ignoring invalid "+BodyDiffGranularityEnvVar, "value", granularity)
+	return BodyDiffGranularityLine
+}
+
+// diffBodies computes the diffs from oldBody to newBody at the given
+// granularity.
+func diffBodies(dmp *diffmatchpatch.DiffMatchPatch, oldBody, newBody, granularity string) []diffmatchpatch.Diff {
+	switch granularity {
+	case BodyDiffGranularityChar:
+		return dmp.DiffMain(oldBody, newBody, false)
+	case BodyDiffGranularityWord:
+		if diffs, ok := diffWords(dmp, oldBody, newBody); ok {
+			return diffs
+		}
+	}
+	charsA, charsB, lineArray := dmp.DiffLinesToChars(oldBody, newBody)
+	diffs := dmp.DiffMain(charsA, charsB, false)
+	return dmp.DiffCharsToLines(diffs, lineArray)
+}
+
+// diffWords diffs two bodies word by word, the way DiffLinesToChars does for
+// lines: each distinct token is mapped to one rune, the rune strings are
+// diffed, and the diffs are expanded back to text. It reports false if the
+// bodies have more distinct tokens than there are runes to map them to.
+func diffWords(dmp *diffmatchpatch.DiffMatchPatch, oldBody, newBody string) ([]diffmatchpatch.Diff, bool) {
+	var tokens []string
+	tokenRunes := make(map[string]rune)
+
+	encode := func(text string) (string, bool) {
+		var sb strings.Builder
+		for _, token := range splitWordTokens(text) {
+			r, ok := tokenRunes[token]
+			if !ok {
+				r = rune(len(tokens) + 1)
+				if r >= 0xD800 {
+					r += 0x800 // Skip the surrogate range, which isn't valid UTF-8
+				}
+				if r > utf8.MaxRune {
+					return "", false
+				}
+				tokenRunes[token] = r
+				tokens = append(tokens, token)
+			}
+			sb.WriteRune(r)
+		}
+		return sb.String(), true
+	}
+
+	charsA, okA := encode(oldBody)
+	charsB, okB := encode(newBody)
+	if !okA || !okB {
+		return nil, false
+	}
+
+	diffs := dmp.DiffMain(charsA, charsB, false)
+	for i := range diffs {
+		var sb strings.Builder
+		for _, r := range diffs[i].Text {
+			index := int(r)
+			if r >= 0xE000 {
+				index -= 0x800
+			}
+			sb.WriteString(tokens[index-1])
+		}
+		diffs[i].Text = sb.String()
+	}
+	return diffs, true
+}
+
+// splitWordTokens splits text into alternating runs of word characters
+// (letters and digits) and everything else, so that joining the tokens
+// reproduces text exactly.
+func splitWordTokens(text string) []string {
+	var tokens []string
+	start := 0
+	inWord := false
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if i > start && isWord != inWord {
+			tokens = append(tokens, text[start:i])
+			start = i
+		}
+		inWord = isWord
+	}
+	if start < len(text) {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// TestCreateDeltaFragmentStoresVerifiedDiff checks that a normal edit is
+// stored as a diff that reconstructs the new body.
+func TestCreateDeltaFragmentStoresVerifiedDiff(t *testing.T) {
+	oldBody := strings.Repeat("an unchanged line of note content\n", 20) + "line two\n"
+	newBody := strings.Repeat("an unchanged line of note content\n", 20) + "line two changed\n"
+
+	existing := &Note{GUID: "diff-guid-1", Body: sql.NullString{String: oldBody, Valid: true}}
+	input := NoteInput{GUID: "diff-guid-1", Title: "t", Body: &newBody}
+
+	fragment := createDeltaFragment(existing, input, FragmentBody)
+	if !fragment.BodyIsDiff {
+		t.Fatal("Expected body to be stored as a diff")
+	}
+
+	result, err := applyBodyDiff(oldBody, fragment.Body.String)
+	if err != nil {
+		t.Fatalf("Stored diff failed to apply: %v", err)
+	}
+	if result != newBody {
+		t.Errorf("Reconstructed body mismatch: got %q, want %q", result, newBody)
+	}
+}
+
+// TestCreateDeltaFragmentFallsBackOnBrokenDiff substitutes a diff generator
+// whose patch does not reproduce the new body and verifies the fragment
+// falls back to a full-body snapshot instead of storing the broken diff.
+func TestCreateDeltaFragmentFallsBackOnBrokenDiff(t *testing.T) {
+	oldBody := "alpha\nbeta\ngamma\n"
+	newBody := "alpha\nBETA\ngamma\n"
+
+	origDiffFunc := bodyDiffFunc
+	defer func() { bodyDiffFunc = origDiffFunc }()
+
+	// Produce a patch for a different target body so it applies cleanly
+	// but reconstructs the wrong text
+	bodyDiffFunc = func(oldBody, _ string) (string, bool) {
+		patch, _ := computeBodyDiff(oldBody, "alpha\nbeta!\ngamma\n")
+		return patch, true
+	}
+
+	existing := &Note{GUID: "diff-guid-2", Body: sql.NullString{String: oldBody, Valid: true}}
+	input := NoteInput{GUID: "diff-guid-2", Title: "t", Body: &newBody}
+
+	fragment := createDeltaFragment(existing, input, FragmentBody)
+	if fragment.BodyIsDiff {
+		t.Fatal("Expected broken diff to be rejected in favour of a full snapshot")
+	}
+	if !fragment.Body.Valid || fragment.Body.String != newBody {
+		t.Errorf("Expected full body snapshot %q, got %q", newBody, fragment.Body.String)
+	}
+
+	// A patch that cannot be parsed at all must also be rejected
+	bodyDiffFunc = func(_, _ string) (string, bool) {
+		return "@@ not a patch", true
+	}
+	fragment = createDeltaFragment(existing, input, FragmentBody)
+	if fragment.BodyIsDiff {
+		t.Error("Expected unparseable diff to be rejected in favour of a full snapshot")
+	}
+}
+
+// TestBodyDiffGranularity checks that word granularity stores a one-word edit
+// in a long paragraph as a smaller patch than line granularity, and that every
+// granularity reconstructs the new body exactly.
+func TestBodyDiffGranularity(t *testing.T) {
+	paragraph := strings.Repeat("The quick brown fox jumps over the lazy dog, again — and again. ", 30)
+	oldBody := "# Heading\n\n" + paragraph + "\n\nA closing line.\n"
+	newBody := strings.Replace(oldBody, "lazy dog, again — and again. The quick", "lazy dog, again — and again. The speedy", 1)
+	if newBody == oldBody {
+		t.Fatal("Test edit did not change the body")
+	}
+
+	patchSizes := make(map[string]int)
+	for _, granularity := range []string{BodyDiffGranularityLine, BodyDiffGranularityWord, BodyDiffGranularityChar} {
+		t.Run(granularity, func(t *testing.T) {
+			t.Setenv(BodyDiffGranularityEnvVar, granularity)
+
+			patch, _ := computeBodyDiff(oldBody, newBody)
+			if !bodyDiffRoundTrips(oldBody, newBody, patch) {
+				t.Fatalf("Patch does not reconstruct the new body:\n%s", patch)
+			}
+			patchSizes[granularity] = len(patch)
+		})
+	}
+
+	// The line patch rewrites the whole paragraph, so it isn't even smaller
+	// than the body; the word patch carries little more than the one word
+	if patchSizes[BodyDiffGranularityWord] >= len(newBody) {
+		t.Errorf("Expected word patch (%d bytes) to be smaller than the body (%d bytes)",
+			patchSizes[BodyDiffGranularityWord], len(newBody))
+	}
+	if patchSizes[BodyDiffGranularityWord] >= patchSizes[BodyDiffGranularityLine] {
+		t.Errorf("Expected word patch (%d bytes) to be smaller than line patch (%d bytes)",
+			patchSizes[BodyDiffGranularityWord], patchSizes[BodyDiffGranularityLine])
+	}
+}
+
+// TestSplitWordTokens checks that tokens alternate between words and
+// separators and rejoin to the original text.
+func TestSplitWordTokens(t *testing.T) {
+	text := "héllo, wörld 42!\n\tnext"
+	tokens := splitWordTokens(text)
+	want := []string{"héllo", ", ", "wörld", " ", "42", "!\n\t", "next"}
+	if strings.Join(tokens, "|") != strings.Join(want, "|") {
+		t.Errorf("Got tokens %q, want %q", tokens, want)
+	}
+	if strings.Join(tokens, "") != text {
+		t.Error("Tokens do not rejoin to the original text")
+	}
+}
@@ -0,0 +1,258 @@
+package models
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Disk / Cache Consistency
+//
+// Every write goes to disk first and then to the cache, so a failed cache
+// write (or a bug) can leave the cache disagreeing with the source of truth
+// until the next restart. CompareDiskAndCache finds the notes and categories
+// that disagree: rows only on disk, rows only in the cache, and rows whose id
+// or updated_at differ. RepairCacheDivergences re-copies just those rows
+// from disk, a cheaper fix than RebuildCache. With a lazy cache, rows not
+// loaded yet are expected and aren't reported as missing.
+// ============================================================================
+
+// Divergence kinds
+const (
+	DivergenceMissingInCache = "missing_in_cache" // On disk, not in the cache
+	DivergenceMissingOnDisk  = "missing_on_disk"  // In the cache, not on disk
+	DivergenceMismatch       = "mismatch"         // In both, with a different id or updated_at
+)
+
+// Divergence is a note or category on which disk and cache disagree.
+type Divergence struct {
+	EntityType     string     `json:"entity_type"` // "note" or "category"
+	GUID           string     `json:"guid"`
+	Kind           string     `json:"kind"`
+	DiskUpdatedAt  *time.Time `json:"disk_updated_at,omitempty"`
+	CacheUpdatedAt *time.Time `json:"cache_updated_at,omitempty"`
+}
+
+// ConsistencyCounts compares the row counts of the disk and cache tables.
+type ConsistencyCounts struct {
+	DiskNotes       int `json:"disk_notes"`
+	CacheNotes      int `json:"cache_notes"`
+	DiskCategories  int `json:"disk_categories"`
+	CacheCategories int `json:"cache_categories"`
+}
+
+// entityVersion is the identity and version of one row.
+type entityVersion struct {
+	id        int64
+	updatedAt time.Time
+}
+
+// GetConsistencyCounts returns the note and category row counts on disk and
+// in the cache. Soft-deleted notes are counted, as both databases hold them.
+func GetConsistencyCounts() (*ConsistencyCounts, error) {
+	counts := &ConsistencyCounts{}
+	for _, c := range []struct {
+		conn  *sql.DB
+		table string
+		dest  *int
+	}{
+		{db, "notes", &counts.DiskNotes},
+		{cacheDB, "notes", &counts.CacheNotes},
+		{db, "categories", &counts.DiskCategories},
+		{cacheDB, "categories", &counts.CacheCategories},
+	} {
+		if err := c.conn.QueryRow(`SELECT COUNT(*) FROM ` + c.table).Scan(c.dest); err != nil {
+			return nil, serr.Wrap(err, "failed to count rows", "table", c.table)
+		}
+	}
+	return counts, nil
+}
+
+// CompareDiskAndCache returns the notes and categories on which the cache
+// disagrees with disk, categories first, each ordered by GUID.
+func CompareDiskAndCache() ([]Divergence, error) {
+	divergences := []Divergence{}
+	for _, entity := range []struct{ entityType, table string }{
+		{"category", "categories"},
+		{"note", "notes"},
+	} {
+		diskRows, err := loadEntityVersions(db, entity.table)
+		if err != nil {
+			return nil, err
+		}
+		cacheRows, err := loadEntityVersions(cacheDB, entity.table)
+		if err != nil {
+			return nil, err
+		}
+		divergences = append(divergences, diffEntityVersions(entity.entityType, diskRows, cacheRows)...)
+	}
+	return divergences, nil
+}
+
+// loadEntityVersions returns the id and updated_at of every row of table,
+// keyed by GUID.
+func loadEntityVersions(conn *sql.DB, table string) (map[string]entityVersion, error) {
+	rows, err := conn.Query(`SELECT guid, id, updated_at FROM ` + table + ` WHERE guid IS NOT NULL`)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to query rows for consistency check", "table", table)
+	}
+	defer rows.Close()
+
+	versions := make(map[string]entityVersion)
+	for rows.Next() {
+		var guid string
+		var v entityVersion
+		if err := rows.Scan(&guid, &v.id, &v.updatedAt); err != nil {
+			return nil, serr.Wrap(err, "failed to scan row for consistency check", "table", table)
+		}
+		versions[guid] = v
+	}
+	return versions, rows.Err()
+}
+
+// diffEntityVersions compares the disk and cache versions of one entity type.
+func diffEntityVersions(entityType string, diskRows, cacheRows map[string]entityVersion) []Divergence {
+	var divergences []Divergence
+	for guid, disk := range diskRows {
+		diskUpdatedAt := disk.updatedAt
+		cached, ok := cacheRows[guid]
+		switch {
+		case !ok:
+			if lazyCache.Load() {
+				continue // Not loaded yet
+			}
+			divergences = append(divergences, Divergence{EntityType: entityType, GUID: guid,
+				Kind: DivergenceMissingInCache, DiskUpdatedAt: &diskUpdatedAt})
+		case cached.id != disk.id || !cached.updatedAt.Equal(disk.updatedAt):
+			cacheUpdatedAt := cached.updatedAt
+			divergences = append(divergences, Divergence{EntityType: entityType, GUID: guid,
+				Kind: DivergenceMismatch, DiskUpdatedAt: &diskUpdatedAt, CacheUpdatedAt: &cacheUpdatedAt})
+		}
+	}
+	for guid, cached := range cacheRows {
+		if _, ok := diskRows[guid]; !ok {
+			cacheUpdatedAt := cached.updatedAt
+			divergences = append(divergences, Divergence{EntityType: entityType, GUID: guid,
+				Kind: DivergenceMissingOnDisk, CacheUpdatedAt: &cacheUpdatedAt})
+		}
+	}
+	sort.Slice(divergences, func(i, j int) bool { return divergences[i].GUID < divergences[j].GUID })
+	return divergences
+}
+
+// RepairCacheDivergences makes the cache match disk for each divergence
+// (as returned by CompareDiskAndCache): the cached row, if any, is dropped
+// along with its category links, and the disk row, if any, is copied back
+// in with its links. Categories should come before notes, so that notes
+// linked to a repaired category get their links back. Returns the number of
+// divergences repaired.
+func RepairCacheDivergences(divergences []Divergence) (int, error) {
+	repaired := 0
+	for _, d := range divergences {
+		var err error
+		switch d.EntityType {
+		case "category":
+			err = repairCachedCategory(d.GUID)
+		case "note":
+			err = repairCachedNote(d.GUID)
+		default:
+			err = serr.New("unknown entity type in divergence: " + d.EntityType)
+		}
+		if err != nil {
+			return repaired, serr.Wrap(err, "failed to repair cache row", "entity_type", d.EntityType, "guid", d.GUID)
+		}
+		repaired++
+	}
+	if repaired > 0 {
+		logger.Info("Repaired cache divergences", "count", repaired)
+	}
+	return repaired, nil
+}
+
+// repairCachedNote replaces the cached copy of a note with the disk row.
+func repairCachedNote(guid string) error {
+	if _, err := cacheDB.Exec(`DELETE FROM note_categories
+		WHERE note_id IN (SELECT id FROM notes WHERE guid = ?)`, guid); err != nil {
+		return serr.Wrap(err, "failed to drop cached note categories")
+	}
+	if _, err := cacheDB.Exec(`DELETE FROM notes WHERE guid = ?`, guid); err != nil {
+		return serr.Wrap(err, "failed to drop cached note")
+	}
+	updateSyncChecksum("note", guid)
+
+	if _, err := loadNotesIntoCache("WHERE guid = ?", guid); err != nil {
+		return err
+	}
+	// A link can only be cached once its category is
+	if _, err := loadCategoriesIntoCache(`WHERE id IN (SELECT nc.category_id FROM note_categories nc
+		INNER JOIN notes n ON n.id = nc.note_id WHERE n.guid = ?)`, guid); err != nil {
+		return err
+	}
+	_, err := loadNoteCategoriesIntoCache(`WHERE note_id IN (SELECT id FROM notes WHERE guid = ?)`, guid)
+	return err
+}
+
+// repairCachedCategory replaces the cached copy of a category with the disk
+// row and its links to cached notes.
+func repairCachedCategory(guid string) error {
+	if _, err := cacheDB.Exec(`DELETE FROM note_categories
+		WHERE category_id IN (SELECT id FROM categories WHERE guid = ?)`, guid); err != nil {
+		return serr.Wrap(err, "failed to drop cached category links")
+	}
+	if _, err := cacheDB.Exec(`DELETE FROM categories WHERE guid = ?`, guid); err != nil {
+		return serr.Wrap(err, "failed to drop cached category")
+	}
+	updateSyncChecksum("category", guid)
+
+	if _, err := loadCategoriesIntoCache("WHERE guid = ?", guid); err != nil {
+		return err
+	}
+
+	var categoryID int64
+	err := db.QueryRow(`SELECT id FROM categories WHERE guid = ?`, guid).Scan(&categoryID)
+	if err == sql.ErrNoRows {
+		return nil // Gone from disk too
+	}
+	if err != nil {
+		return serr.Wrap(err, "failed to get category id")
+	}
+	return loadCachedNoteCategoryLinks(categoryID)
+}
+
+// loadCachedNoteCategoryLinks copies the disk links of categoryID to notes
+// that are in the cache: all of them, unless the cache is lazy.
+func loadCachedNoteCategoryLinks(categoryID int64) error {
+	if !lazyCache.Load() {
+		_, err := loadNoteCategoriesIntoCache("WHERE category_id = ?", categoryID)
+		return err
+	}
+
+	rows, err := cacheDB.Query(`SELECT id FROM notes`)
+	if err != nil {
+		return serr.Wrap(err, "failed to list cached notes")
+	}
+	var noteIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return serr.Wrap(err, "failed to scan cached note id")
+		}
+		noteIDs = append(noteIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return serr.Wrap(err, "failed to read cached note ids")
+	}
+
+	for _, noteID := range noteIDs {
+		if _, err := loadNoteCategoriesIntoCache("WHERE category_id = ? AND note_id = ?", categoryID, noteID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package models
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rohanthewiz/logger"
+)
+
+// ============================================================================
+// Lazy Cache Population and Cache Stats
+//
+// Normally every note, category, and relationship is copied from disk into
+// the in-memory cache at startup, which is slow for very large databases.
+// With a lazy cache the cache starts empty instead: GetNoteByID,
+// GetNoteByGUID, GetCategory, and GetCategoryByGUID fall back to disk on a
+// cache miss and copy the row into the cache, so the next read of it is a
+// hit. A lazily loaded note brings its
+// category links (and their categories) along. Queries that aren't point
+// lookups — listings, search, counts, and exports — first copy in all of
+// the user's rows (see ensureUserCached), once per user, so they return the
+// same results as with a full cache; RebuildCache leaves a lazy cache empty
+// again. Lazy mode suits large instances where most users are idle: only
+// the users who are active pay to load their notes.
+//
+// The warm-up (its size and duration) and the cache hits and misses of the
+// point lookups are recorded for GetCacheStats in either mode.
+// ============================================================================
+
+// LazyCacheEnvVar turns on lazy cache population when set to a true value.
+const LazyCacheEnvVar = "GONOTES_LAZY_CACHE"
+
+// DBOptions configures InitDBWithOptions.
+type DBOptions struct {
+	Path      string // Disk database file; "" means DBPath
+	LazyCache bool   // Start with an empty cache and fill it on demand
+}
+
+// CacheStats reports how the cache was warmed and how point lookups fared.
+type CacheStats struct {
+	LazyCache           bool  `json:"lazy_cache"`
+	WarmupNotes         int   `json:"warmup_notes"`
+	WarmupCategories    int   `json:"warmup_categories"`
+	WarmupRelationships int   `json:"warmup_relationships"`
+	WarmupDurationMs    int64 `json:"warmup_duration_ms"`
+	Hits                int64 `json:"hits"`       // Lookups answered by the cache
+	Misses              int64 `json:"misses"`     // Lookups the cache couldn't answer
+	LazyLoads           int64 `json:"lazy_loads"` // Misses filled from disk
+}
+
+// lazyCache is set by InitDBWithOptions and read on every cache miss.
+var lazyCache atomic.Bool
+
+var cacheStats = struct {
+	sync.Mutex
+	warmup                  CacheStats
+	hits, misses, lazyLoads atomic.Int64
+}{}
+
+// cachedUsers records the users whose rows ensureUserCached has copied into
+// a lazy cache. all is set once every user's rows have been copied.
+var cachedUsers = struct {
+	sync.Mutex
+	users map[string]bool
+	all   bool
+}{users: map[string]bool{}}
+
+// LazyCacheEnabled reports whether GONOTES_LAZY_CACHE asks for a lazy cache.
+func LazyCacheEnabled() bool {
+	enabledStr := os.Getenv(LazyCacheEnvVar)
+	if enabledStr == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(enabledStr)
+	if err != nil {
+		logger.Warn("Ignoring invalid "+LazyCacheEnvVar, "value", enabledStr)
+		return false
+	}
+	return enabled
+}
+
+// setLazyCache sets the cache mode and resets the cache stats, for a freshly
+// opened cache.
+func setLazyCache(lazy bool) {
+	lazyCache.Store(lazy)
+	cacheStats.Lock()
+	cacheStats.warmup = CacheStats{}
+	cacheStats.Unlock()
+	cacheStats.hits.Store(0)
+	cacheStats.misses.Store(0)
+	cacheStats.lazyLoads.Store(0)
+}
+
+// resetCachedUsers forgets which users' rows are cached, for an emptied
+// lazy cache.
+func resetCachedUsers() {
+	cachedUsers.Lock()
+	cachedUsers.users = map[string]bool{}
+	cachedUsers.all = false
+	cachedUsers.Unlock()
+}
+
+// recordCacheWarmup records the result of loading the cache from disk.
+func recordCacheWarmup(notes, categories, relationships int, duration time.Duration) {
+	cacheStats.Lock()
+	defer cacheStats.Unlock()
+	cacheStats.warmup = CacheStats{
+		WarmupNotes:         notes,
+		WarmupCategories:    categories,
+		WarmupRelationships: relationships,
+		WarmupDurationMs:    duration.Milliseconds(),
+	}
+}
+
+// GetCacheStats returns the cache warm-up figures and lookup counters.
+func GetCacheStats() CacheStats {
+	cacheStats.Lock()
+	stats := cacheStats.warmup
+	cacheStats.Unlock()
+
+	stats.LazyCache = lazyCache.Load()
+	stats.Hits = cacheStats.hits.Load()
+	stats.Misses = cacheStats.misses.Load()
+	stats.LazyLoads = cacheStats.lazyLoads.Load()
+	return stats
+}
+
+// getWithCacheFallback runs read, a lookup against the cache that returns
+// nil when nothing matches. On a miss with a lazy cache, load copies the
+// entity's disk row into the cache and reports whether it found one; read
+// then runs again, so the result carries the same filters as a cache hit.
+func getWithCacheFallback[T any](read func() (*T, error), load func() (bool, error)) (*T, error) {
+	v, err := read()
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		cacheStats.hits.Add(1)
+		return v, nil
+	}
+	cacheStats.misses.Add(1)
+	if !lazyCache.Load() {
+		return nil, nil
+	}
+
+	loaded, err := load()
+	if err != nil || !loaded {
+		return nil, err
+	}
+	cacheStats.lazyLoads.Add(1)
+	return read()
+}
+
+// lazyLoadNote copies note id, its category links, and the categories they
+// reference from disk into the cache. Reports whether the note was copied
+// (false if it isn't on disk or was already cached).
+func lazyLoadNote(id int64) (bool, error) {
+	count, err := loadNotesIntoCache("WHERE id = ?", id)
+	if err != nil || count == 0 {
+		return false, err
+	}
+	if _, err := loadCategoriesIntoCache(
+		"WHERE id IN (SELECT category_id FROM note_categories WHERE note_id = ?)", id); err != nil {
+		return true, err
+	}
+	if _, err := loadNoteCategoriesIntoCache("WHERE note_id = ?", id); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// lazyLoadNoteByGUID is lazyLoadNote for a note identified by its GUID.
+func lazyLoadNoteByGUID(guid string) (bool, error) {
+	count, err := loadNotesIntoCache("WHERE guid = ?", guid)
+	if err != nil || count == 0 {
+		return false, err
+	}
+	if _, err := loadCategoriesIntoCache(`WHERE id IN (SELECT nc.category_id FROM note_categories nc
+		INNER JOIN notes n ON nc.note_id = n.id WHERE n.guid = ?)`, guid); err != nil {
+		return true, err
+	}
+	if _, err := loadNoteCategoriesIntoCache(
+		"WHERE note_id IN (SELECT id FROM notes WHERE guid = ?)", guid); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// lazyLoadCategory copies category id from disk into the cache. Reports
+// whether it was copied (false if it isn't on disk or was already cached).
+func lazyLoadCategory(id int64) (bool, error) {
+	count, err := loadCategoriesIntoCache("WHERE id = ?", id)
+	return count > 0, err
+}
+
+// lazyLoadCategoryByGUID is lazyLoadCategory for a category identified by
+// its GUID.
+func lazyLoadCategoryByGUID(guid string) (bool, error) {
+	count, err := loadCategoriesIntoCache("WHERE guid = ?", guid)
+	return count > 0, err
+}
+
+// ensureUserCached copies all of userGUID's notes (deleted ones included),
+// their category links, the categories those links reference, and the
+// categories the user owns from disk into a lazy cache, so a query over the
+// user's rows sees them all. An empty userGUID, an unfiltered query, copies
+// every user's rows. Only the first call per user loads anything; later
+// writes keep the cache current. Does nothing with a full cache.
+func ensureUserCached(userGUID string) error {
+	if !lazyCache.Load() {
+		return nil
+	}
+
+	cachedUsers.Lock()
+	defer cachedUsers.Unlock()
+	if cachedUsers.all || cachedUsers.users[userGUID] {
+		return nil
+	}
+
+	if userGUID == "" {
+		if _, err := loadNotesIntoCache(""); err != nil {
+			return err
+		}
+		if _, err := loadCategoriesIntoCache(""); err != nil {
+			return err
+		}
+		if _, err := loadNoteCategoriesIntoCache(""); err != nil {
+			return err
+		}
+		cachedUsers.all = true
+		return nil
+	}
+
+	if _, err := loadNotesIntoCache("WHERE created_by = ?", userGUID); err != nil {
+		return err
+	}
+	if _, err := loadCategoriesIntoCache(`WHERE created_by = ? OR id IN (SELECT nc.category_id
+		FROM note_categories nc INNER JOIN notes n ON nc.note_id = n.id WHERE n.created_by = ?)`,
+		userGUID, userGUID); err != nil {
+		return err
+	}
+	if _, err := loadNoteCategoriesIntoCache(
+		"WHERE note_id IN (SELECT id FROM notes WHERE created_by = ?)", userGUID); err != nil {
+		return err
+	}
+	cachedUsers.users[userGUID] = true
+	return nil
+}
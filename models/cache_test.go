@@ -2,8 +2,10 @@ package models_test
 
 import (
 	"database/sql"
+	"encoding/csv"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -195,6 +197,160 @@ func TestCacheHardDelete(t *testing.T) {
 	}
 }
 
+// TestCacheTrashRestorePurge verifies the trash lifecycle: a soft-deleted note
+// is listed in the trash, restore returns it to the active list, and purge
+// removes the note and its category mappings from both databases.
+func TestCacheTrashRestorePurge(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	note, err := models.CreateNote(models.NoteInput{GUID: "trash-test", Title: "Trash Me"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	cat, err := models.CreateCategory(models.CategoryInput{Name: "trash-cat"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+	if err := models.AddCategoryToNote(note.ID, cat.ID, testUserGUID); err != nil {
+		t.Fatalf("failed to add category to note: %v", err)
+	}
+
+	if _, err := models.DeleteNote(note.ID, testUserGUID); err != nil {
+		t.Fatalf("failed to delete note: %v", err)
+	}
+
+	trash, err := models.ListDeletedNotes(testUserGUID, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to list trash: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != note.ID {
+		t.Fatalf("expected deleted note in trash, got %d notes", len(trash))
+	}
+
+	restored, err := models.RestoreNote(note.ID, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to restore note: %v", err)
+	}
+	if restored == nil || restored.DeletedAt.Valid {
+		t.Fatal("expected restored note with deleted_at cleared")
+	}
+
+	active, err := models.ListNotes(testUserGUID, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to list notes: %v", err)
+	}
+	if len(active) != 1 {
+		t.Errorf("expected restored note in active list, got %d notes", len(active))
+	}
+
+	// Restoring an active note is a no-op
+	again, err := models.RestoreNote(note.ID, testUserGUID)
+	if err != nil {
+		t.Fatalf("unexpected error restoring active note: %v", err)
+	}
+	if again != nil {
+		t.Error("expected nil when restoring a note that is not in the trash")
+	}
+
+	purged, err := models.PurgeNote(note.ID, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to purge note: %v", err)
+	}
+	if !purged {
+		t.Fatal("expected note to be purged")
+	}
+
+	for name, database := range map[string]*sql.DB{"disk": models.DB(), "cache": models.CacheDB()} {
+		var notes, mappings int
+		if err := database.QueryRow("SELECT COUNT(*) FROM notes WHERE id = ?", note.ID).Scan(&notes); err != nil {
+			t.Fatalf("failed to count notes in %s: %v", name, err)
+		}
+		if err := database.QueryRow("SELECT COUNT(*) FROM note_categories WHERE note_id = ?", note.ID).Scan(&mappings); err != nil {
+			t.Fatalf("failed to count mappings in %s: %v", name, err)
+		}
+		if notes != 0 || mappings != 0 {
+			t.Errorf("expected note and mappings gone from %s, got %d notes, %d mappings", name, notes, mappings)
+		}
+	}
+}
+
+// TestAutoPurgeDeletedNotes verifies that a note deleted longer ago than the
+// retention period is purged, along with its change history when requested,
+// while a recently deleted note stays in the trash.
+func TestAutoPurgeDeletedNotes(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	old, err := models.CreateNote(models.NoteInput{GUID: "purge-old", Title: "Old"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	recent, err := models.CreateNote(models.NoteInput{GUID: "purge-recent", Title: "Recent"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	for _, id := range []int64{old.ID, recent.ID} {
+		if _, err := models.DeleteNote(id, testUserGUID); err != nil {
+			t.Fatalf("failed to delete note: %v", err)
+		}
+	}
+
+	// Backdate the old note's deletion past the retention period
+	deletedAt := time.Now().Add(-40 * 24 * time.Hour)
+	for name, database := range map[string]*sql.DB{"disk": models.DB(), "cache": models.CacheDB()} {
+		if _, err := database.Exec("UPDATE notes SET deleted_at = ? WHERE id = ?", deletedAt, old.ID); err != nil {
+			t.Fatalf("failed to backdate deletion in %s: %v", name, err)
+		}
+	}
+
+	// Zero retention means never
+	purged, err := models.AutoPurgeDeletedNotesWithOptions(models.AutoPurgeOptions{})
+	if err != nil {
+		t.Fatalf("auto-purge failed: %v", err)
+	}
+	if purged != 0 {
+		t.Errorf("expected nothing purged with zero retention, got %d", purged)
+	}
+
+	purged, err = models.AutoPurgeDeletedNotesWithOptions(models.AutoPurgeOptions{
+		Retention:    30 * 24 * time.Hour,
+		PurgeHistory: true,
+	})
+	if err != nil {
+		t.Fatalf("auto-purge failed: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("expected 1 note purged, got %d", purged)
+	}
+
+	for name, database := range map[string]*sql.DB{"disk": models.DB(), "cache": models.CacheDB()} {
+		var count int
+		if err := database.QueryRow("SELECT COUNT(*) FROM notes WHERE id = ?", old.ID).Scan(&count); err != nil {
+			t.Fatalf("failed to count notes in %s: %v", name, err)
+		}
+		if count != 0 {
+			t.Errorf("expected expired note gone from %s", name)
+		}
+	}
+
+	var changes int
+	if err := models.DB().QueryRow("SELECT COUNT(*) FROM note_changes WHERE note_guid = ?", old.GUID).Scan(&changes); err != nil {
+		t.Fatalf("failed to count note changes: %v", err)
+	}
+	if changes != 0 {
+		t.Errorf("expected expired note's change history purged, got %d changes", changes)
+	}
+
+	trash, err := models.ListDeletedNotes(testUserGUID, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to list trash: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != recent.ID {
+		t.Errorf("expected only the recently deleted note in trash, got %d notes", len(trash))
+	}
+}
+
 // TestCacheList verifies that list operations work from cache
 func TestCacheList(t *testing.T) {
 	cleanup := setupTestDB(t)
@@ -515,3 +671,696 @@ func readAuthoredAtFromDisk(t *testing.T, id int64) time.Time {
 
 	return authoredAtNull.Time
 }
+
+// TestNoteOutputWordAndCharCounts verifies the computed count fields on
+// NoteOutput and their aggregation by GetUserNoteStats.
+func TestNoteOutputWordAndCharCounts(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	body := "# Café notes\n\nDon't forget the e-mail — it's due **today**.\n\n- 3 items\n- naïve 日本語"
+	note, err := models.CreateNote(models.NoteInput{GUID: "count-note-001", Title: "Counts", Body: &body}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	out := note.ToOutput()
+	// Café, notes, Don't, forget, the, e-mail, it's, due, today, 3, items, naïve, 日, 本, 語
+	if out.WordCount != 15 {
+		t.Errorf("expected 15 words, got %d", out.WordCount)
+	}
+	if want := len([]rune(body)); out.CharCount != want {
+		t.Errorf("expected %d chars, got %d", want, out.CharCount)
+	}
+
+	empty, err := models.CreateNote(models.NoteInput{GUID: "count-note-002", Title: "No Body"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if out := empty.ToOutput(); out.WordCount != 0 || out.CharCount != 0 {
+		t.Errorf("expected zero counts for a note without a body, got %d words, %d chars", out.WordCount, out.CharCount)
+	}
+
+	// A deleted note and another user's note are excluded from stats
+	deleted, err := models.CreateNote(models.NoteInput{GUID: "count-note-003", Title: "Deleted", Body: &body}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if _, err := models.DeleteNote(deleted.ID, testUserGUID); err != nil {
+		t.Fatalf("failed to delete note: %v", err)
+	}
+	if _, err := models.CreateNote(models.NoteInput{GUID: "count-note-004", Title: "Other", Body: &body}, "other-user-guid"); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	stats, err := models.GetUserNoteStats(testUserGUID)
+	if err != nil {
+		t.Fatalf("GetUserNoteStats failed: %v", err)
+	}
+	if stats.TotalNotes != 2 {
+		t.Errorf("expected 2 notes, got %d", stats.TotalNotes)
+	}
+	if stats.TotalWords != 15 {
+		t.Errorf("expected 15 total words, got %d", stats.TotalWords)
+	}
+	if stats.AverageWords != 7.5 {
+		t.Errorf("expected 7.5 average words, got %v", stats.AverageWords)
+	}
+}
+
+// TestSearchNotesByTitleRanked verifies exact > prefix > contains ordering
+// and that other users' notes are excluded.
+func TestSearchNotesByTitleRanked(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Created in reverse rank order so updated_at alone would sort them wrong
+	for i, title := range []string{"my kube notes", "Kubernetes", "kube"} {
+		input := models.NoteInput{GUID: fmt.Sprintf("ranked-note-%d", i), Title: title}
+		if _, err := models.CreateNote(input, testUserGUID); err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+	if _, err := models.CreateNote(models.NoteInput{GUID: "ranked-other", Title: "kube"}, "other-user-guid"); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	notes, err := models.SearchNotesByTitleRanked("kube", testUserGUID, 20)
+	if err != nil {
+		t.Fatalf("SearchNotesByTitleRanked failed: %v", err)
+	}
+
+	want := []string{"kube", "Kubernetes", "my kube notes"}
+	if len(notes) != len(want) {
+		t.Fatalf("expected %d results, got %d", len(want), len(notes))
+	}
+	for i, note := range notes {
+		if note.Title != want[i] {
+			t.Errorf("result %d: expected %q, got %q", i, want[i], note.Title)
+		}
+	}
+}
+
+// TestSearchNotesWithSnippets verifies full-text matching across fields, the
+// marked excerpt around the first match, and that other users' and deleted
+// notes are excluded.
+func TestSearchNotesWithSnippets(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	longBody := strings.Repeat("lorem ipsum ", 20) + "the <Deploy> step runs\n\nnightly " + strings.Repeat("dolor sit ", 20)
+	desc := "how we deploy"
+	tags := "deploy,ops"
+	for _, input := range []models.NoteInput{
+		{GUID: "snippet-body", Title: "Runbook", Body: &longBody},
+		{GUID: "snippet-desc", Title: "Overview", Description: &desc},
+		{GUID: "snippet-title", Title: "Deploy checklist"},
+		{GUID: "snippet-tags", Title: "Ops", Tags: &tags},
+		{GUID: "snippet-none", Title: "Unrelated"},
+	} {
+		if _, err := models.CreateNote(input, testUserGUID); err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+	if _, err := models.CreateNote(models.NoteInput{GUID: "snippet-other", Title: "deploy"}, "other-user-guid"); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	deleted, err := models.CreateNote(models.NoteInput{GUID: "snippet-deleted", Title: "deploy old"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if _, err := models.DeleteNote(deleted.ID, testUserGUID); err != nil {
+		t.Fatalf("failed to delete note: %v", err)
+	}
+
+	results, err := models.SearchNotesWithSnippets("DEPLOY", testUserGUID, 20)
+	if err != nil {
+		t.Fatalf("SearchNotesWithSnippets failed: %v", err)
+	}
+
+	byGUID := map[string]models.NoteSearchResult{}
+	for _, r := range results {
+		byGUID[r.Note.GUID] = r
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d: %v", len(results), byGUID)
+	}
+
+	body := byGUID["snippet-body"]
+	if body.MatchField != "body" {
+		t.Errorf("expected body match, got %q", body.MatchField)
+	}
+	wantBody := "…ipsum lorem ipsum lorem ipsum lorem ipsum lorem ipsum the &lt;<mark>Deploy</mark>&gt; step runs nightly dolor sit dolor sit dolor sit dolor…"
+	if body.Snippet != wantBody {
+		t.Errorf("unexpected body snippet:\n got %q\nwant %q", body.Snippet, wantBody)
+	}
+
+	for guid, want := range map[string]struct{ field, snippet string }{
+		"snippet-desc":  {"description", "how we <mark>deploy</mark>"},
+		"snippet-title": {"title", "<mark>Deploy</mark> checklist"},
+		"snippet-tags":  {"tags", "<mark>deploy</mark>,ops"},
+	} {
+		got := byGUID[guid]
+		if got.MatchField != want.field || got.Snippet != want.snippet {
+			t.Errorf("%s: expected %s match %q, got %s match %q", guid, want.field, want.snippet, got.MatchField, got.Snippet)
+		}
+	}
+}
+
+// TestRebuildCache verifies that a cache that has drifted from disk is
+// restored to match it
+func TestRebuildCache(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	note, err := models.CreateNote(models.NoteInput{GUID: "rebuild-001", Title: "Rebuild Me"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	cat, err := models.CreateCategory(models.CategoryInput{Name: "rebuild-cat"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+	if err := models.AddCategoryToNote(note.ID, cat.ID, testUserGUID); err != nil {
+		t.Fatalf("failed to add category to note: %v", err)
+	}
+
+	// Simulate drift by wiping the cache behind the models' back
+	for _, table := range []string{"note_categories", "categories", "notes"} {
+		if _, err := models.CacheDB().Exec("DELETE FROM " + table); err != nil {
+			t.Fatalf("failed to clear cache %s: %v", table, err)
+		}
+	}
+	if got, _ := models.GetNoteByID(note.ID, testUserGUID); got != nil {
+		t.Fatal("expected note to be missing from wiped cache")
+	}
+
+	if err := models.RebuildCache(); err != nil {
+		t.Fatalf("RebuildCache failed: %v", err)
+	}
+
+	got, err := models.GetNoteByID(note.ID, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to get note after rebuild: %v", err)
+	}
+	if got == nil || got.Title != "Rebuild Me" {
+		t.Fatalf("expected rebuilt note, got %+v", got)
+	}
+
+	cats, err := models.GetNoteCategories(note.ID, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to get note categories after rebuild: %v", err)
+	}
+	if len(cats) != 1 || cats[0].ID != cat.ID {
+		t.Fatalf("expected category %d after rebuild, got %+v", cat.ID, cats)
+	}
+
+	// Rebuilding an in-sync cache must not duplicate rows
+	if err := models.RebuildCache(); err != nil {
+		t.Fatalf("second RebuildCache failed: %v", err)
+	}
+	var count int
+	if err := models.CacheDB().QueryRow("SELECT COUNT(*) FROM notes").Scan(&count); err != nil {
+		t.Fatalf("failed to count cached notes: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 cached note after second rebuild, got %d", count)
+	}
+}
+
+// TestBodyCompression verifies that a body over the compression threshold is
+// stored compressed and smaller on disk, while reads (from the cache, and from
+// disk after a cache rebuild) return it byte-identical.
+func TestBodyCompression(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	t.Setenv(models.BodyCompressionThresholdEnvVar, "1024")
+
+	large := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 500) + "héllo, 世界\n"
+	small := "short body"
+
+	bigNote, err := models.CreateNote(models.NoteInput{GUID: "compress-big", Title: "Big", Body: &large}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	smallNote, err := models.CreateNote(models.NoteInput{GUID: "compress-small", Title: "Small", Body: &small}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if bigNote.Body.String != large {
+		t.Error("CreateNote should return the plaintext body")
+	}
+
+	checkDisk := func(id int64, wantCompressed bool) {
+		t.Helper()
+		var compressed bool
+		var diskLen int
+		err := models.DB().QueryRow("SELECT body_compressed, length(body) FROM notes WHERE id = ?", id).
+			Scan(&compressed, &diskLen)
+		if err != nil {
+			t.Fatalf("failed to read note %d from disk: %v", id, err)
+		}
+		if compressed != wantCompressed {
+			t.Errorf("note %d: body_compressed = %v, want %v", id, compressed, wantCompressed)
+		}
+		if wantCompressed && diskLen >= len(large) {
+			t.Errorf("note %d: compressed body is %d bytes on disk, want fewer than %d", id, diskLen, len(large))
+		}
+	}
+	checkDisk(bigNote.ID, true)
+	checkDisk(smallNote.ID, false)
+
+	// Updating with a large body stays compressed; a small one is stored plainly
+	updated := large + "one more line\n"
+	if _, err := models.UpdateNote(bigNote.ID, models.NoteInput{GUID: bigNote.GUID, Title: "Big", Body: &updated}, testUserGUID); err != nil {
+		t.Fatalf("failed to update note: %v", err)
+	}
+	checkDisk(bigNote.ID, true)
+	if _, err := models.UpdateNote(smallNote.ID, models.NoteInput{GUID: smallNote.GUID, Title: "Small", Body: &small}, testUserGUID); err != nil {
+		t.Fatalf("failed to update note: %v", err)
+	}
+	checkDisk(smallNote.ID, false)
+
+	// Reads come from the cache, and after a rebuild from the decompressed disk copy
+	for _, phase := range []string{"cache", "rebuilt cache"} {
+		if phase == "rebuilt cache" {
+			if err := models.RebuildCache(); err != nil {
+				t.Fatalf("RebuildCache failed: %v", err)
+			}
+		}
+		got, err := models.GetNoteByID(bigNote.ID, testUserGUID)
+		if err != nil || got == nil {
+			t.Fatalf("%s: failed to get note: %v", phase, err)
+		}
+		if got.Body.String != updated {
+			t.Errorf("%s: body is not byte-identical after compression round trip", phase)
+		}
+	}
+}
+
+// TestExportNotesCSV verifies the metadata export: one row per non-deleted
+// note, fields with commas and quotes escaped, and category names listed.
+func TestExportNotesCSV(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	tags := `"urgent",work`
+	body := "three little words"
+	tricky, err := models.CreateNote(models.NoteInput{
+		GUID: "export-tricky", Title: `Plans, "draft" 2`, Body: &body, Tags: &tags,
+	}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	plain, err := models.CreateNote(models.NoteInput{GUID: "export-plain", Title: "Plain"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	deleted, err := models.CreateNote(models.NoteInput{GUID: "export-deleted", Title: "Deleted"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if _, err := models.DeleteNote(deleted.ID, testUserGUID); err != nil {
+		t.Fatalf("failed to delete note: %v", err)
+	}
+	if _, err := models.CreateNote(models.NoteInput{GUID: "export-other", Title: "Other user's"}, "someone-else"); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	for _, name := range []string{"Zeta", "Alpha"} {
+		cat, err := models.CreateCategory(models.CategoryInput{Name: name}, testUserGUID)
+		if err != nil {
+			t.Fatalf("failed to create category: %v", err)
+		}
+		if err := models.AddCategoryToNote(tricky.ID, cat.ID, testUserGUID); err != nil {
+			t.Fatalf("failed to add category: %v", err)
+		}
+	}
+
+	var buf strings.Builder
+	if err := models.ExportNotesCSV(testUserGUID, &buf); err != nil {
+		t.Fatalf("ExportNotesCSV failed: %v", err)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("export is not valid CSV: %v\n%s", err, buf.String())
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected header + 2 rows, got %d records:\n%s", len(records), buf.String())
+	}
+	if strings.Join(records[0], ",") != strings.Join(models.NotesCSVHeader, ",") {
+		t.Errorf("unexpected header: %v", records[0])
+	}
+
+	row := records[1]
+	if row[0] != fmt.Sprint(tricky.ID) || row[1] != "export-tricky" {
+		t.Errorf("first row should be the tricky note, got id=%s guid=%s", row[0], row[1])
+	}
+	if row[2] != tricky.Title {
+		t.Errorf("title = %q, want %q", row[2], tricky.Title)
+	}
+	if row[3] != tags {
+		t.Errorf("tags = %q, want %q", row[3], tags)
+	}
+	if row[4] != "Alpha; Zeta" {
+		t.Errorf("categories = %q, want %q", row[4], "Alpha; Zeta")
+	}
+	if _, err := time.Parse(time.RFC3339, row[5]); err != nil {
+		t.Errorf("created_at %q is not RFC 3339: %v", row[5], err)
+	}
+	if row[7] != "3" {
+		t.Errorf("word_count = %s, want 3", row[7])
+	}
+
+	if records[2][1] != plain.GUID || records[2][4] != "" || records[2][7] != "0" {
+		t.Errorf("unexpected row for uncategorized note without a body: %v", records[2])
+	}
+	if strings.Contains(buf.String(), body) {
+		t.Error("export should not include note bodies")
+	}
+}
+
+// TestExtractNoteLinks verifies the [[note:<guid>|<title>]] parser.
+func TestExtractNoteLinks(t *testing.T) {
+	body := "See [[note:6F9619FF-8B86-D011-B42D-00C04FC964FF|Plans]] and " +
+		"[[note:6f9619ff-8b86-d011-b42d-00c04fc964ff|the plans again]], " +
+		"[[note:a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11|Other]], " +
+		"but not [[note:not-a-guid|Broken]] or [[a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a12]]."
+
+	got := models.ExtractNoteLinks(body)
+	want := []string{"6f9619ff-8b86-d011-b42d-00c04fc964ff", "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ExtractNoteLinks() = %v, want %v", got, want)
+	}
+	if links := models.ExtractNoteLinks("no links here"); len(links) != 0 {
+		t.Errorf("expected no links, got %v", links)
+	}
+}
+
+// TestGetBacklinks verifies that links are tracked as bodies are saved and
+// that backlinks are limited to the target owner's live notes.
+func TestGetBacklinks(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	const targetGUID = "11111111-2222-4333-8444-555555555555"
+	if _, err := models.CreateNote(models.NoteInput{GUID: targetGUID, Title: "Target"}, testUserGUID); err != nil {
+		t.Fatalf("failed to create target note: %v", err)
+	}
+
+	linkBody := "Related: [[note:" + targetGUID + "|Target]]"
+	source, err := models.CreateNote(models.NoteInput{GUID: "backlink-source", Title: "Source", Body: &linkBody}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create source note: %v", err)
+	}
+	if _, err := models.CreateNote(models.NoteInput{GUID: "backlink-other-user", Title: "Other", Body: &linkBody}, "someone-else"); err != nil {
+		t.Fatalf("failed to create other user's note: %v", err)
+	}
+	plainBody := "no links"
+	if _, err := models.CreateNote(models.NoteInput{GUID: "backlink-unrelated", Title: "Unrelated", Body: &plainBody}, testUserGUID); err != nil {
+		t.Fatalf("failed to create unrelated note: %v", err)
+	}
+
+	backlinks, err := models.GetBacklinks(targetGUID)
+	if err != nil {
+		t.Fatalf("GetBacklinks failed: %v", err)
+	}
+	if len(backlinks) != 1 || backlinks[0].GUID != "backlink-source" {
+		t.Fatalf("expected only backlink-source, got %+v", backlinks)
+	}
+
+	// Editing the link out of the body removes the backlink
+	if _, err := models.UpdateNote(source.ID, models.NoteInput{GUID: source.GUID, Title: "Source", Body: &plainBody}, testUserGUID); err != nil {
+		t.Fatalf("failed to update source note: %v", err)
+	}
+	backlinks, err = models.GetBacklinks(targetGUID)
+	if err != nil {
+		t.Fatalf("GetBacklinks failed: %v", err)
+	}
+	if len(backlinks) != 0 {
+		t.Errorf("expected no backlinks after the link was removed, got %+v", backlinks)
+	}
+
+	if backlinks, err := models.GetBacklinks("99999999-2222-4333-8444-555555555555"); err != nil || len(backlinks) != 0 {
+		t.Errorf("expected no backlinks for an unknown note, got %+v (err %v)", backlinks, err)
+	}
+}
+
+// TestNoteViewCounts verifies that views are counted without touching
+// updated_at or the change log, survive a cache rebuild, and order
+// ListNotesByViews.
+func TestNoteViewCounts(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	popular, err := models.CreateNote(models.NoteInput{GUID: "views-popular", Title: "Popular"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if _, err := models.CreateNote(models.NoteInput{GUID: "views-unseen", Title: "Unseen"}, testUserGUID); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	once, err := models.CreateNote(models.NoteInput{GUID: "views-once", Title: "Once"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	changesBefore, err := models.CountUserAuthoredChanges(testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to count changes: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		count, found, err := models.RecordNoteView(popular.ID, testUserGUID)
+		if err != nil || !found || count != int64(i) {
+			t.Fatalf("view %d: got count=%d found=%v err=%v", i, count, found, err)
+		}
+	}
+	if _, _, err := models.RecordNoteView(once.ID, testUserGUID); err != nil {
+		t.Fatalf("failed to record view: %v", err)
+	}
+	if _, found, _ := models.RecordNoteView(popular.ID, "someone-else"); found {
+		t.Error("expected another user's view to find no note")
+	}
+
+	changesAfter, err := models.CountUserAuthoredChanges(testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to count changes: %v", err)
+	}
+	if changesAfter != changesBefore {
+		t.Errorf("expected views to record no changes, went from %d to %d", changesBefore, changesAfter)
+	}
+	reread, err := models.GetNoteByID(popular.ID, testUserGUID)
+	if err != nil || reread == nil {
+		t.Fatalf("failed to get note: %v", err)
+	}
+	if !reread.UpdatedAt.Equal(popular.UpdatedAt) {
+		t.Errorf("expected updated_at unchanged, was %v now %v", popular.UpdatedAt, reread.UpdatedAt)
+	}
+
+	// Counts are on disk, so they survive a cache rebuild
+	if err := models.RebuildCache(); err != nil {
+		t.Fatalf("failed to rebuild cache: %v", err)
+	}
+	notes, err := models.ListNotesByViews(testUserGUID, 0, 0)
+	if err != nil {
+		t.Fatalf("ListNotesByViews failed: %v", err)
+	}
+	var order []string
+	for _, n := range notes {
+		order = append(order, n.GUID)
+	}
+	if strings.Join(order, ",") != "views-popular,views-once,views-unseen" {
+		t.Errorf("unexpected popularity order: %v", order)
+	}
+}
+
+// TestLazyCache verifies that with a lazy cache the first read of a note
+// misses the cache and loads it from disk, bringing its categories along,
+// and the second read is a cache hit.
+func TestLazyCache(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	note, err := models.CreateNote(models.NoteInput{GUID: "lazy-cache-note", Title: "Lazy"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	category, err := models.CreateCategory(models.CategoryInput{Name: "lazy-cat"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+	if err := models.AddCategoryToNote(note.ID, category.ID, testUserGUID); err != nil {
+		t.Fatalf("failed to link category: %v", err)
+	}
+	// Never read by id, so only a listing loads it
+	listed, err := models.CreateNote(models.NoteInput{GUID: "lazy-cache-listed", Title: "Listed"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	listedCategory, err := models.CreateCategory(models.CategoryInput{Name: "lazy-listed-cat"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+	if err := models.AddCategoryToNote(listed.ID, listedCategory.ID, testUserGUID); err != nil {
+		t.Fatalf("failed to link category: %v", err)
+	}
+
+	// Reopen the same disk database with a lazy cache
+	models.CloseDB()
+	if err := models.InitDBWithOptions(models.DBOptions{Path: "./test_cache.ddb", LazyCache: true}); err != nil {
+		t.Fatalf("failed to reopen database with a lazy cache: %v", err)
+	}
+
+	stats := models.GetCacheStats()
+	if !stats.LazyCache || stats.WarmupNotes != 0 {
+		t.Fatalf("expected an empty lazy cache after startup, got %+v", stats)
+	}
+
+	got, err := models.GetNoteByID(note.ID, testUserGUID)
+	if err != nil || got == nil || got.GUID != note.GUID {
+		t.Fatalf("expected first read to load the note from disk, got %v, err=%v", got, err)
+	}
+	if stats := models.GetCacheStats(); stats.Misses != 1 || stats.LazyLoads != 1 || stats.Hits != 0 {
+		t.Errorf("expected 1 miss filled from disk, got %+v", stats)
+	}
+
+	if _, err := models.GetNoteByID(note.ID, testUserGUID); err != nil {
+		t.Fatalf("second read failed: %v", err)
+	}
+	if stats := models.GetCacheStats(); stats.Hits != 1 || stats.LazyLoads != 1 {
+		t.Errorf("expected the second read to hit the cache, got %+v", stats)
+	}
+
+	// The note's category link and category came along
+	categories, err := models.GetNoteCategories(note.ID, testUserGUID)
+	if err != nil || len(categories) != 1 || categories[0].ID != category.ID {
+		t.Errorf("expected the lazily loaded note's category, got %v, err=%v", categories, err)
+	}
+
+	// Someone else's note is neither returned nor cached
+	if other, err := models.GetNoteByID(note.ID, "someone-else"); err != nil || other != nil {
+		t.Errorf("expected no note for another user, got %v, err=%v", other, err)
+	}
+	if _, err := models.GetNoteByID(99999, testUserGUID); err != nil {
+		t.Errorf("expected a missing note to return nil without error, got %v", err)
+	}
+	if stats := models.GetCacheStats(); stats.LazyLoads != 1 {
+		t.Errorf("expected misses for absent notes not to load anything, got %+v", stats)
+	}
+
+	// Listings, counts, and search see the user's notes that were never read
+	if notes, err := models.ListNotes(testUserGUID, 0, 0); err != nil || len(notes) != 2 {
+		t.Errorf("expected both notes listed, got %d, err=%v", len(notes), err)
+	}
+	if count, err := models.CountNotes(testUserGUID, models.NoteListFilter{}); err != nil || count != 2 {
+		t.Errorf("expected a count of 2, got %d, err=%v", count, err)
+	}
+	if found, err := models.SearchNotesByTitle("Listed", testUserGUID, 0); err != nil ||
+		len(found) != 1 || found[0].ID != listed.ID {
+		t.Errorf("expected the unread note found by title, got %v, err=%v", found, err)
+	}
+	if cats, err := models.ListCategories(0, 0, testUserGUID); err != nil || len(cats) != 2 {
+		t.Errorf("expected both categories listed, got %d, err=%v", len(cats), err)
+	}
+	byCategory, err := models.GetNotesByCategoryName("lazy-listed-cat", testUserGUID, 0, 0)
+	if err != nil || len(byCategory) != 1 || byCategory[0].ID != listed.ID {
+		t.Errorf("expected the unread note's category link, got %v, err=%v", byCategory, err)
+	}
+
+	// Rebuilding empties the lazy cache; the next listing loads the user again
+	if err := models.RebuildCache(); err != nil {
+		t.Fatalf("failed to rebuild cache: %v", err)
+	}
+	if notes, err := models.ListNotes(testUserGUID, 0, 0); err != nil || len(notes) != 2 {
+		t.Errorf("expected both notes listed after a rebuild, got %d, err=%v", len(notes), err)
+	}
+}
+
+// TestCompareAndRepairDiskAndCache verifies that cache rows that drifted from
+// disk are reported and then re-copied from disk.
+func TestCompareAndRepairDiskAndCache(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	note, err := models.CreateNote(models.NoteInput{GUID: "consistency-note", Title: "Original"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	category, err := models.CreateCategory(models.CategoryInput{Name: "consistency-cat"}, testUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+	if err := models.AddCategoryToNote(note.ID, category.ID, testUserGUID); err != nil {
+		t.Fatalf("failed to link note: %v", err)
+	}
+
+	divergences, err := models.CompareDiskAndCache()
+	if err != nil {
+		t.Fatalf("CompareDiskAndCache failed: %v", err)
+	}
+	if len(divergences) != 0 {
+		t.Fatalf("expected a consistent cache, got %+v", divergences)
+	}
+
+	// Corrupt the cache: a stale note and category, a category only in the cache
+	cache := models.CacheDB()
+	if _, err := cache.Exec(`UPDATE categories SET updated_at = updated_at - INTERVAL 1 HOUR WHERE id = ?`,
+		category.ID); err != nil {
+		t.Fatalf("failed to corrupt cached category: %v", err)
+	}
+	if _, err := cache.Exec(`UPDATE notes SET title = 'Corrupted', updated_at = updated_at - INTERVAL 1 HOUR
+		WHERE guid = ?`, "consistency-note"); err != nil {
+		t.Fatalf("failed to corrupt cached note: %v", err)
+	}
+	if _, err := cache.Exec(`INSERT INTO categories (id, guid, name, created_by) VALUES (99999, 'cache-only-cat', 'ghost', ?)`,
+		testUserGUID); err != nil {
+		t.Fatalf("failed to insert cache-only category: %v", err)
+	}
+
+	divergences, err = models.CompareDiskAndCache()
+	if err != nil {
+		t.Fatalf("CompareDiskAndCache failed: %v", err)
+	}
+	kinds := make(map[string]string)
+	for _, d := range divergences {
+		kinds[d.EntityType+":"+d.GUID] = d.Kind
+	}
+	want := map[string]string{
+		"category:cache-only-cat":   models.DivergenceMissingOnDisk,
+		"category:" + category.GUID: models.DivergenceMismatch,
+		"note:consistency-note":     models.DivergenceMismatch,
+	}
+	if len(divergences) != 3 || fmt.Sprint(kinds) != fmt.Sprint(want) {
+		t.Fatalf("expected the cache-only category, the stale category, and the stale note, got %+v", divergences)
+	}
+	if divergences[2].EntityType != "note" {
+		t.Errorf("expected categories before notes, got %+v", divergences)
+	}
+
+	repaired, err := models.RepairCacheDivergences(divergences)
+	if err != nil || repaired != 3 {
+		t.Fatalf("expected 3 repairs, got %d (err %v)", repaired, err)
+	}
+	if divergences, _ = models.CompareDiskAndCache(); len(divergences) != 0 {
+		t.Errorf("expected a consistent cache after repair, got %+v", divergences)
+	}
+
+	got, err := models.GetNoteByID(note.ID, testUserGUID)
+	if err != nil || got == nil || got.Title != "Original" {
+		t.Fatalf("expected the repaired note from disk, got %+v (err %v)", got, err)
+	}
+	cats, err := models.GetNoteCategories(note.ID, testUserGUID)
+	if err != nil || len(cats) != 1 {
+		t.Errorf("expected the repaired note to keep its category, got %v (err %v)", cats, err)
+	}
+
+	counts, err := models.GetConsistencyCounts()
+	if err != nil {
+		t.Fatalf("GetConsistencyCounts failed: %v", err)
+	}
+	if counts.DiskNotes != counts.CacheNotes || counts.DiskCategories != counts.CacheCategories {
+		t.Errorf("expected matching counts after repair, got %+v", counts)
+	}
+}
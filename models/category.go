@@ -4,9 +4,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/rohanthewiz/logger"
 	"github.com/rohanthewiz/serr"
 )
 
@@ -80,6 +84,13 @@ type CategoryOutput struct {
 	UpdatedAt     time.Time `json:"updated_at"`
 }
 
+// CategoryWithCountOutput is a CategoryOutput with the number of the owner's
+// non-deleted notes in the category.
+type CategoryWithCountOutput struct {
+	CategoryOutput
+	NoteCount int `json:"note_count"`
+}
+
 // ToOutput converts a Category to CategoryOutput for API responses
 func (c *Category) ToOutput() CategoryOutput {
 	output := CategoryOutput{
@@ -121,6 +132,9 @@ type NoteCategoryDetailOutput struct {
 // CreateCategory creates a new category in both disk and cache databases.
 // The userGUID parameter sets the created_by field for multi-user data isolation.
 func CreateCategory(input CategoryInput, userGUID string) (*Category, error) {
+	if IsReadOnly() {
+		return nil, ErrReadOnly
+	}
 	if input.Name == "" {
 		return nil, serr.New("category name is required")
 	}
@@ -191,13 +205,31 @@ func CreateCategory(input CategoryInput, userGUID string) (*Category, error) {
 		// Disk write succeeded, cache failed - return data with error
 		return &category, serr.Wrap(cacheErr, "category created on disk but cache update failed")
 	}
+	updateSyncChecksum("category", category.GUID)
 
 	return &category, nil
 }
 
 // GetCategory retrieves a category by ID from cache.
 // When userGUID is non-empty, enforces ownership via created_by filter.
+// With a lazy cache, a category not yet cached is loaded from disk.
 func GetCategory(id int64, userGUID string) (*Category, error) {
+	category, err := getWithCacheFallback(
+		func() (*Category, error) { return getCategoryFromCache(id, userGUID) },
+		func() (bool, error) { return lazyLoadCategory(id) },
+	)
+	if err != nil {
+		return nil, err
+	}
+	if category == nil {
+		return nil, serr.New("category not found")
+	}
+	return category, nil
+}
+
+// getCategoryFromCache is the cache lookup behind GetCategory. Returns nil,
+// nil if no category matches.
+func getCategoryFromCache(id int64, userGUID string) (*Category, error) {
 	query := `SELECT id, guid, name, description, subcategories, created_by, created_at, updated_at
 		FROM categories WHERE id = ?`
 	args := []any{id}
@@ -219,7 +251,7 @@ func GetCategory(id int64, userGUID string) (*Category, error) {
 		&category.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
-		return nil, serr.New("category not found")
+		return nil, nil
 	}
 	if err != nil {
 		return nil, serr.Wrap(err, "failed to get category")
@@ -231,6 +263,25 @@ func GetCategory(id int64, userGUID string) (*Category, error) {
 // ListCategories retrieves categories from cache.
 // When userGUID is non-empty, only returns categories owned by that user.
 func ListCategories(limit, offset int, userGUID string) ([]Category, error) {
+	return listCategories(limit, offset, userGUID, nil)
+}
+
+// ListCategoriesFavoritesFirst is ListCategories with userGUID's favorite
+// categories ahead of the rest, each group newest first.
+func ListCategoriesFavoritesFirst(limit, offset int, userGUID string) ([]Category, error) {
+	favoriteIDs, err := ListFavoriteCategoryIDs(userGUID)
+	if err != nil {
+		return nil, err
+	}
+	return listCategories(limit, offset, userGUID, favoriteIDs)
+}
+
+// listCategories lists categories, sorting those in favoriteIDs first.
+func listCategories(limit, offset int, userGUID string, favoriteIDs []int64) ([]Category, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
 	query := `SELECT id, guid, name, description, subcategories, created_by, created_at, updated_at
 		FROM categories`
 
@@ -240,13 +291,17 @@ func ListCategories(limit, offset int, userGUID string) ([]Category, error) {
 		args = append(args, userGUID)
 	}
 
-	query += ` ORDER BY created_at DESC`
+	favoritesOrder, favoritesArgs := favoritesFirstOrder("id", favoriteIDs)
+	query += ` ORDER BY ` + favoritesOrder + `created_at DESC`
+	args = append(args, favoritesArgs...)
 
 	if limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", limit)
+		query += " LIMIT ?"
+		args = append(args, limit)
 	}
 	if offset > 0 {
-		query += fmt.Sprintf(" OFFSET %d", offset)
+		query += " OFFSET ?"
+		args = append(args, offset)
 	}
 
 	rows, err := cacheDB.Query(query, args...)
@@ -281,10 +336,106 @@ func ListCategories(limit, offset int, userGUID string) ([]Category, error) {
 	return categories, nil
 }
 
+// ListCategoriesWithCounts is ListCategories with each category's note count,
+// computed in the same query. Only the user's non-deleted notes are counted,
+// so categories with no such notes report zero.
+func ListCategoriesWithCounts(userGUID string, limit, offset int) ([]CategoryWithCountOutput, error) {
+	return listCategoriesWithCounts(userGUID, limit, offset, nil)
+}
+
+// ListCategoriesWithCountsFavoritesFirst is ListCategoriesWithCounts with
+// userGUID's favorite categories ahead of the rest.
+func ListCategoriesWithCountsFavoritesFirst(userGUID string, limit, offset int) ([]CategoryWithCountOutput, error) {
+	favoriteIDs, err := ListFavoriteCategoryIDs(userGUID)
+	if err != nil {
+		return nil, err
+	}
+	return listCategoriesWithCounts(userGUID, limit, offset, favoriteIDs)
+}
+
+// listCategoriesWithCounts lists categories with note counts, sorting those
+// in favoriteIDs first.
+func listCategoriesWithCounts(userGUID string, limit, offset int, favoriteIDs []int64) ([]CategoryWithCountOutput, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT c.id, c.guid, c.name, c.description, c.subcategories, c.created_by,
+		c.created_at, c.updated_at, COUNT(n.id)
+		FROM categories c
+		LEFT JOIN note_categories nc ON nc.category_id = c.id
+		LEFT JOIN notes n ON n.id = nc.note_id AND n.deleted_at IS NULL`
+
+	var args []any
+	if userGUID != "" {
+		query += ` AND n.created_by = ? WHERE c.created_by = ?`
+		args = append(args, userGUID, userGUID)
+	}
+
+	favoritesOrder, favoritesArgs := favoritesFirstOrder("c.id", favoriteIDs)
+	query += ` GROUP BY c.id, c.guid, c.name, c.description, c.subcategories, c.created_by,
+		c.created_at, c.updated_at
+		ORDER BY ` + favoritesOrder + `c.created_at DESC`
+	args = append(args, favoritesArgs...)
+
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	if offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, offset)
+	}
+
+	rows, err := cacheDB.Query(query, args...)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to list categories with counts")
+	}
+	defer rows.Close()
+
+	outputs := []CategoryWithCountOutput{}
+	for rows.Next() {
+		var category Category
+		var count int
+		err := rows.Scan(
+			&category.ID,
+			&category.GUID,
+			&category.Name,
+			&category.Description,
+			&category.Subcategories,
+			&category.CreatedBy,
+			&category.CreatedAt,
+			&category.UpdatedAt,
+			&count,
+		)
+		if err != nil {
+			return nil, serr.Wrap(err, "failed to scan category with count")
+		}
+		outputs = append(outputs, CategoryWithCountOutput{CategoryOutput: category.ToOutput(), NoteCount: count})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, serr.Wrap(err, "error iterating categories with counts")
+	}
+
+	return outputs, nil
+}
+
 // UpdateCategory updates a category in both disk and cache databases.
 // Records a category change with a delta fragment for sync.
 // When userGUID is non-empty, verifies ownership before allowing the update.
 func UpdateCategory(id int64, input CategoryInput, userGUID string) (*Category, error) {
+	if IsReadOnly() {
+		return nil, ErrReadOnly
+	}
+	unlock := lockCategory(id)
+	defer unlock()
+	return updateCategoryLocked(id, input, userGUID)
+}
+
+// updateCategoryLocked is UpdateCategory for a caller already holding the
+// category's lock.
+func updateCategoryLocked(id int64, input CategoryInput, userGUID string) (*Category, error) {
 	if input.Name == "" {
 		return nil, serr.New("category name is required")
 	}
@@ -357,6 +508,7 @@ func UpdateCategory(id int64, input CategoryInput, userGUID string) (*Category,
 	if cacheErr != nil {
 		return &category, serr.Wrap(cacheErr, "category updated on disk but cache update failed")
 	}
+	updateSyncChecksum("category", category.GUID)
 
 	// Record change for sync (non-blocking)
 	recordCategoryUpdateChange(*existing, category, input)
@@ -364,10 +516,27 @@ func UpdateCategory(id int64, input CategoryInput, userGUID string) (*Category,
 	return &category, nil
 }
 
+// CategoryInUseError is returned when deleting a category that notes are
+// still linked to, unless the delete is forced.
+type CategoryInUseError struct {
+	Category  string
+	NoteCount int
+}
+
+func (e *CategoryInUseError) Error() string {
+	return fmt.Sprintf("category %q is linked to %d notes; unlink them or force the delete", e.Category, e.NoteCount)
+}
+
 // DeleteCategory deletes a category from both disk and cache databases.
 // Records a category delete change for sync.
 // When userGUID is non-empty, verifies ownership before allowing the delete.
-func DeleteCategory(id int64, userGUID string) error {
+// A category with linked notes is refused with a *CategoryInUseError unless
+// force is set, in which case the links are removed along with the category
+// and each affected note records its new category set.
+func DeleteCategory(id int64, userGUID string, force bool) error {
+	if IsReadOnly() {
+		return ErrReadOnly
+	}
 	// Fetch category for GUID (needed for change tracking).
 	// The userGUID filter ensures the caller owns this category.
 	existing, err := GetCategory(id, userGUID)
@@ -375,20 +544,66 @@ func DeleteCategory(id int64, userGUID string) error {
 		return err
 	}
 
-	// Delete from disk database first
-	query := `DELETE FROM categories WHERE id = ?`
-	_, err = db.Exec(query, id)
+	var links []NoteCategory
+	rows, err := db.Query(`SELECT note_id, category_id, subcategories, created_at
+		FROM note_categories WHERE category_id = ? ORDER BY note_id`, id)
 	if err != nil {
+		return serr.Wrap(err, "failed to query notes linked to category")
+	}
+	for rows.Next() {
+		var link NoteCategory
+		if err := rows.Scan(&link.NoteID, &link.CategoryID, &link.Subcategories, &link.CreatedAt); err != nil {
+			rows.Close()
+			return serr.Wrap(err, "failed to scan linked note")
+		}
+		links = append(links, link)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return serr.Wrap(err, "failed to read notes linked to category")
+	}
+
+	if len(links) > 0 && !force {
+		return &CategoryInUseError{Category: existing.Name, NoteCount: len(links)}
+	}
+
+	// Delete from disk database first. DuckDB checks foreign keys against
+	// rows deleted earlier in the same transaction, so the links and the
+	// category can't go in one; instead the links are restored if the
+	// category delete fails.
+	if err := deleteCategoryFavorites(id); err != nil {
+		return err
+	}
+	if err := deleteCategoryRules(id); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM note_categories WHERE category_id = ?`, id); err != nil {
+		return serr.Wrap(err, "failed to unlink notes from category in disk database")
+	}
+	if _, err := db.Exec(`DELETE FROM categories WHERE id = ?`, id); err != nil {
+		for _, link := range links {
+			if _, restoreErr := db.Exec(`INSERT INTO note_categories (note_id, category_id, subcategories, created_at)
+				VALUES (?, ?, ?, ?)`, link.NoteID, link.CategoryID, link.Subcategories, link.CreatedAt); restoreErr != nil {
+				logger.LogErr(restoreErr, "failed to restore note link after category delete failed",
+					"note_id", link.NoteID, "category_id", id)
+			}
+		}
 		return serr.Wrap(err, "failed to delete category from disk database")
 	}
 
 	// Delete from cache database
-	_, cacheErr := cacheDB.Exec(query, id)
-	if cacheErr != nil {
+	if _, cacheErr := cacheDB.Exec(`DELETE FROM note_categories WHERE category_id = ?`, id); cacheErr != nil {
+		return serr.Wrap(cacheErr, "category deleted from disk but cache unlink failed")
+	}
+	if _, cacheErr := cacheDB.Exec(`DELETE FROM categories WHERE id = ?`, id); cacheErr != nil {
 		return serr.Wrap(cacheErr, "category deleted from disk but cache delete failed")
 	}
+	updateSyncChecksum("category", existing.GUID)
 
-	// Record change for sync (non-blocking)
+	// Record changes for sync (non-blocking)
+	for _, link := range links {
+		recordNoteCategoryMappingChange(link.NoteID)
+	}
 	recordCategoryDeleteChange(existing.GUID)
 
 	return nil
@@ -433,13 +648,60 @@ func (nc *NoteCategory) ToOutput() NoteCategoryOutput {
 // AddCategoryToNote adds a category to a note without subcategories.
 // For adding with subcategories, use AddCategoryToNoteWithSubcategories.
 func AddCategoryToNote(noteID, categoryID int64, userGUID string) error {
-	return AddCategoryToNoteWithSubcategories(noteID, categoryID, nil, userGUID)
+	return AddCategoryToNoteWithSubcategories(noteID, categoryID, nil, userGUID, true)
+}
+
+// UnknownSubcategoriesError is returned when a note-category mapping names
+// subcategories that aren't defined on the category.
+type UnknownSubcategoriesError struct {
+	Category string
+	Unknown  []string
+}
+
+func (e *UnknownSubcategoriesError) Error() string {
+	return fmt.Sprintf("unknown subcategories for category %q: %s", e.Category, strings.Join(e.Unknown, ", "))
+}
+
+// validateSubcategories checks each supplied subcategory against the
+// category's defined Subcategories list. Returns an *UnknownSubcategoriesError
+// naming any that aren't defined.
+func validateSubcategories(category *Category, subcategories []string) error {
+	if len(subcategories) == 0 {
+		return nil
+	}
+
+	defined := make(map[string]bool)
+	if category.Subcategories.Valid && category.Subcategories.String != "" {
+		var names []string
+		if err := json.Unmarshal([]byte(category.Subcategories.String), &names); err != nil {
+			return serr.Wrap(err, "failed to parse category subcategories")
+		}
+		for _, name := range names {
+			defined[name] = true
+		}
+	}
+
+	var unknown []string
+	for _, subcat := range subcategories {
+		if !defined[subcat] {
+			unknown = append(unknown, subcat)
+		}
+	}
+	if len(unknown) > 0 {
+		return &UnknownSubcategoriesError{Category: category.Name, Unknown: unknown}
+	}
+	return nil
 }
 
 // AddCategoryToNoteWithSubcategories adds a category to a note with optional subcategories.
 // The subcategories slice can be nil or empty for no subcategories.
 // When userGUID is non-empty, verifies both note and category ownership.
-func AddCategoryToNoteWithSubcategories(noteID, categoryID int64, subcategories []string, userGUID string) error {
+// When strict is true, every subcategory must be defined on the category;
+// sync-applied mappings pass false since the originating peer is authoritative.
+func AddCategoryToNoteWithSubcategories(noteID, categoryID int64, subcategories []string, userGUID string, strict bool) error {
+	if IsReadOnly() {
+		return ErrReadOnly
+	}
 	// Verify note exists and belongs to the user
 	noteQuery := `SELECT 1 FROM notes WHERE id = ? AND deleted_at IS NULL`
 	noteArgs := []any{noteID}
@@ -454,10 +716,15 @@ func AddCategoryToNoteWithSubcategories(noteID, categoryID int64, subcategories
 	}
 
 	// Verify category exists and belongs to the user
-	_, err = GetCategory(categoryID, userGUID)
+	category, err := GetCategory(categoryID, userGUID)
 	if err != nil {
 		return err
 	}
+	if strict {
+		if err := validateSubcategories(category, subcategories); err != nil {
+			return err
+		}
+	}
 
 	// Check if relationship already exists
 	var count int
@@ -500,8 +767,29 @@ func AddCategoryToNoteWithSubcategories(noteID, categoryID int64, subcategories
 	return nil
 }
 
+// GetNoteCategory returns the relationship between a note and a category,
+// or nil if the category isn't on the note.
+func GetNoteCategory(noteID, categoryID int64) (*NoteCategory, error) {
+	var nc NoteCategory
+	err := cacheDB.QueryRow(`SELECT note_id, category_id, subcategories, created_at
+		FROM note_categories WHERE note_id = ? AND category_id = ?`, noteID, categoryID).Scan(
+		&nc.NoteID, &nc.CategoryID, &nc.Subcategories, &nc.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to get note category")
+	}
+	return &nc, nil
+}
+
 // UpdateNoteCategorySubcategories updates the subcategories for an existing note-category relationship.
-func UpdateNoteCategorySubcategories(noteID, categoryID int64, subcategories []string) error {
+// When strict is true, every subcategory must be defined on the category.
+func UpdateNoteCategorySubcategories(noteID, categoryID int64, subcategories []string, strict bool) error {
+	if IsReadOnly() {
+		return ErrReadOnly
+	}
 	// Check if relationship exists
 	var count int
 	checkQuery := `SELECT COUNT(*) FROM note_categories WHERE note_id = ? AND category_id = ?`
@@ -513,6 +801,16 @@ func UpdateNoteCategorySubcategories(noteID, categoryID int64, subcategories []s
 		return serr.New("relationship not found")
 	}
 
+	if strict {
+		category, err := GetCategory(categoryID, "")
+		if err != nil {
+			return err
+		}
+		if err := validateSubcategories(category, subcategories); err != nil {
+			return err
+		}
+	}
+
 	// Convert subcategories to JSON string
 	var subcatsJSON sql.NullString
 	if len(subcategories) > 0 {
@@ -542,8 +840,184 @@ func UpdateNoteCategorySubcategories(noteID, categoryID int64, subcategories []s
 	return nil
 }
 
+// RenameSubcategory renames a subcategory on a category and rewrites every
+// note_categories row that has it selected, so existing notes keep filtering
+// under the new name. Records a category change and a mapping change for
+// each affected note. Callers are responsible for ownership checks.
+func RenameSubcategory(categoryID int64, oldName, newName string) error {
+	if IsReadOnly() {
+		return ErrReadOnly
+	}
+	if newName == "" {
+		return serr.New("new subcategory name is required")
+	}
+	if oldName == newName {
+		return nil
+	}
+
+	unlock := lockCategory(categoryID)
+	defer unlock()
+
+	category, err := GetCategory(categoryID, "")
+	if err != nil {
+		return err
+	}
+
+	var subcats []string
+	if category.Subcategories.Valid && category.Subcategories.String != "" {
+		if err := json.Unmarshal([]byte(category.Subcategories.String), &subcats); err != nil {
+			return serr.Wrap(err, "failed to parse category subcategories")
+		}
+	}
+
+	found := false
+	for i, subcat := range subcats {
+		if subcat == newName {
+			return serr.New("subcategory already exists")
+		}
+		if subcat == oldName {
+			subcats[i] = newName
+			found = true
+		}
+	}
+	if !found {
+		return serr.New("subcategory not found")
+	}
+
+	// Update the definition first; UpdateCategory records the category change
+	input := CategoryInput{Name: category.Name, Subcategories: subcats}
+	if category.Description.Valid {
+		input.Description = &category.Description.String
+	}
+	if _, err := updateCategoryLocked(categoryID, input, ""); err != nil {
+		return serr.Wrap(err, "failed to update category subcategories")
+	}
+
+	// Collect mappings that select the old name (from disk, the source of truth)
+	rows, err := db.Query(`SELECT note_id, subcategories FROM note_categories
+		WHERE category_id = ? AND subcategories IS NOT NULL`, categoryID)
+	if err != nil {
+		return serr.Wrap(err, "failed to query note subcategories")
+	}
+
+	renamed := make(map[int64]string)
+	for rows.Next() {
+		var noteID int64
+		var subcatsJSON string
+		if err := rows.Scan(&noteID, &subcatsJSON); err != nil {
+			rows.Close()
+			return serr.Wrap(err, "failed to scan note subcategories")
+		}
+
+		var selected []string
+		if err := json.Unmarshal([]byte(subcatsJSON), &selected); err != nil {
+			logger.LogErr(err, "skipping unparseable note subcategories", "note_id", noteID)
+			continue
+		}
+
+		changed := false
+		for i, subcat := range selected {
+			if subcat == oldName {
+				selected[i] = newName
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		jsonBytes, err := json.Marshal(selected)
+		if err != nil {
+			rows.Close()
+			return serr.Wrap(err, "failed to marshal note subcategories")
+		}
+		renamed[noteID] = string(jsonBytes)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return serr.Wrap(err, "error iterating note subcategories")
+	}
+
+	query := `UPDATE note_categories SET subcategories = ? WHERE note_id = ? AND category_id = ?`
+	for noteID, subcatsJSON := range renamed {
+		if _, err := db.Exec(query, subcatsJSON, noteID, categoryID); err != nil {
+			return serr.Wrap(err, "failed to rename subcategory on note in disk database")
+		}
+		if _, err := cacheDB.Exec(query, subcatsJSON, noteID, categoryID); err != nil {
+			return serr.Wrap(err, "subcategory renamed on disk but cache update failed")
+		}
+
+		// Record note-category mapping change for sync (non-blocking)
+		recordNoteCategoryMappingChange(noteID)
+	}
+
+	return nil
+}
+
+// GetSubcategoryUsage counts, for each subcategory of a category, how many
+// of its linked notes select it. Every defined subcategory is present, with
+// zero if no note selects it; a subcategory notes still select but the
+// category no longer defines is included with its count. Only non-deleted
+// notes owned by the category's owner are counted. Callers are responsible
+// for ownership checks.
+func GetSubcategoryUsage(categoryID int64) (map[string]int, error) {
+	category, err := GetCategory(categoryID, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureUserCached(category.CreatedBy.String); err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]int)
+	if category.Subcategories.Valid && category.Subcategories.String != "" {
+		var defined []string
+		if err := json.Unmarshal([]byte(category.Subcategories.String), &defined); err != nil {
+			return nil, serr.Wrap(err, "failed to parse category subcategories")
+		}
+		for _, subcat := range defined {
+			usage[subcat] = 0
+		}
+	}
+
+	// Each mapping's JSON array is unnested to one row per selected
+	// subcategory; DISTINCT guards against a name listed twice in one array
+	rows, err := cacheDB.Query(`
+		SELECT s.subcat, COUNT(DISTINCT s.note_id)
+		FROM (
+			SELECT note_id, unnest(json_extract_string(subcategories, '$[*]')::VARCHAR[]) AS subcat
+			FROM note_categories
+			WHERE category_id = ? AND subcategories IS NOT NULL
+		) s
+		INNER JOIN notes n ON n.id = s.note_id AND n.deleted_at IS NULL
+		INNER JOIN categories c ON c.id = ? AND c.created_by IS NOT DISTINCT FROM n.created_by
+		GROUP BY s.subcat
+	`, categoryID, categoryID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to count subcategory usage")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var subcat string
+		var count int
+		if err := rows.Scan(&subcat, &count); err != nil {
+			return nil, serr.Wrap(err, "failed to scan subcategory usage")
+		}
+		usage[subcat] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, serr.Wrap(err, "error iterating subcategory usage")
+	}
+
+	return usage, nil
+}
+
 // RemoveCategoryFromNote removes a category from a note
 func RemoveCategoryFromNote(noteID, categoryID int64) error {
+	if IsReadOnly() {
+		return ErrReadOnly
+	}
 	// Delete from disk database first
 	query := `DELETE FROM note_categories WHERE note_id = ? AND category_id = ?`
 	result, err := db.Exec(query, noteID, categoryID)
@@ -695,8 +1169,12 @@ func GetNoteCategoryDetails(noteID int64, userGUID string) ([]NoteCategoryDetail
 // GetCategoryNotes retrieves all notes for a category.
 // When userGUID is non-empty, only returns notes owned by that user.
 func GetCategoryNotes(categoryID int64, userGUID string) ([]Note, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
 	query := `SELECT n.id, n.guid, n.title, n.description, n.body, n.tags,
-		n.is_private, n.is_flagged, n.encryption_iv, n.created_by, n.updated_by,
+		n.is_private, n.is_flagged, n.starred, n.encryption_iv, n.created_by, n.updated_by,
 		n.created_at, n.updated_at, n.synced_at, n.deleted_at
 		FROM notes n
 		INNER JOIN note_categories nc ON n.id = nc.note_id
@@ -728,6 +1206,7 @@ func GetCategoryNotes(categoryID int64, userGUID string) ([]Note, error) {
 			&note.Tags,
 			&note.IsPrivate,
 			&note.IsFlagged,
+			&note.Starred,
 			&note.EncryptionIV,
 			&note.CreatedBy,
 			&note.UpdatedBy,
@@ -753,6 +1232,10 @@ func GetCategoryNotes(categoryID int64, userGUID string) ([]Note, error) {
 // When userGUID is non-empty, scopes by ownership.
 // Returns nil, nil if the category doesn't exist.
 func GetCategoryByName(name string, userGUID string) (*Category, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
 	query := `SELECT id, guid, name, description, subcategories, created_by, created_at, updated_at
 		FROM categories WHERE name = ?`
 	args := []any{name}
@@ -783,20 +1266,33 @@ func GetCategoryByName(name string, userGUID string) (*Category, error) {
 	return &category, nil
 }
 
-// GetNotesByCategoryName retrieves all notes that belong to the specified category name.
-// The userGUID parameter filters to notes owned by that user.
+// GetNotesByCategoryName retrieves the notes that belong to the specified category name.
+// The userGUID parameter filters to notes and categories owned by that user, so
+// another user's category with the same name is never matched.
+// limit=0 returns all notes, offset skips the first N results.
 // Returns empty slice if the category doesn't exist or has no notes.
-func GetNotesByCategoryName(categoryName string, userGUID string) ([]Note, error) {
+func GetNotesByCategoryName(categoryName string, userGUID string, limit, offset int) ([]Note, error) {
+	return GetNotesByCategoryNameInRange(categoryName, userGUID, CreatedRange{}, limit, offset)
+}
+
+// GetNotesByCategoryNameInRange is GetNotesByCategoryName limited to notes
+// created within created.
+func GetNotesByCategoryNameInRange(categoryName string, userGUID string, created CreatedRange, limit, offset int) ([]Note, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
 	query := `SELECT n.id, n.guid, n.title, n.description, n.body, n.tags,
-		n.is_private, n.is_flagged, n.encryption_iv, n.created_by, n.updated_by,
+		n.is_private, n.is_flagged, n.starred, n.encryption_iv, n.created_by, n.updated_by,
 		n.created_at, n.updated_at, n.synced_at, n.deleted_at
 		FROM notes n
 		INNER JOIN note_categories nc ON n.id = nc.note_id
 		INNER JOIN categories c ON nc.category_id = c.id
-		WHERE c.name = ? AND n.created_by = ? AND n.deleted_at IS NULL
-		ORDER BY n.created_at DESC`
+		WHERE c.name = ? AND n.created_by = ? AND c.created_by = n.created_by AND n.deleted_at IS NULL`
+	args := []interface{}{categoryName, userGUID}
+	query, args = appendNotePageClauses(query, args, created, limit, offset)
 
-	rows, err := cacheDB.Query(query, categoryName, userGUID)
+	rows, err := cacheDB.Query(query, args...)
 	if err != nil {
 		return nil, serr.Wrap(err, "failed to get notes by category name")
 	}
@@ -814,6 +1310,7 @@ func GetNotesByCategoryName(categoryName string, userGUID string) ([]Note, error
 			&note.Tags,
 			&note.IsPrivate,
 			&note.IsFlagged,
+			&note.Starred,
 			&note.EncryptionIV,
 			&note.CreatedBy,
 			&note.UpdatedBy,
@@ -850,6 +1347,10 @@ type NoteCategoryMapping struct {
 // This powers the search-bar category filter — the client caches the result in a
 // lookup map keyed by note ID so filtering is instant without per-note API calls.
 func GetAllNoteCategoryMappings(userGUID string) ([]NoteCategoryMapping, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
 	query := `SELECT nc.note_id, nc.category_id, c.name, nc.subcategories
 		FROM note_categories nc
 		INNER JOIN categories c ON nc.category_id = c.id
@@ -863,7 +1364,7 @@ func GetAllNoteCategoryMappings(userGUID string) ([]NoteCategoryMapping, error)
 	}
 	defer rows.Close()
 
-	var mappings []NoteCategoryMapping
+	mappings := []NoteCategoryMapping{}
 	for rows.Next() {
 		var (
 			m            NoteCategoryMapping
@@ -889,34 +1390,66 @@ func GetAllNoteCategoryMappings(userGUID string) ([]NoteCategoryMapping, error)
 	return mappings, nil
 }
 
+// DefaultMaxSubcategoryFilters caps the subcategories a note listing can filter
+// by when GONOTES_MAX_SUBCATEGORY_FILTERS is unset. Each one adds a clause to
+// the query, so the cap keeps a request from building an arbitrarily large one.
+const DefaultMaxSubcategoryFilters = 20
+
+// MaxSubcategoryFiltersEnvVar overrides DefaultMaxSubcategoryFilters.
+const MaxSubcategoryFiltersEnvVar = "GONOTES_MAX_SUBCATEGORY_FILTERS"
+
+// MaxSubcategoryFilters returns the configured cap on subcategory filters.
+// Invalid or non-positive values fall back to DefaultMaxSubcategoryFilters.
+func MaxSubcategoryFilters() int {
+	if maxStr := os.Getenv(MaxSubcategoryFiltersEnvVar); maxStr != "" {
+		max, err := strconv.Atoi(maxStr)
+		if err == nil && max > 0 {
+			return max
+		}
+		logger.Warn("Ignoring invalid "+MaxSubcategoryFiltersEnvVar, "value", maxStr)
+	}
+	return DefaultMaxSubcategoryFilters
+}
+
 // GetNotesByCategoryAndSubcategories retrieves notes that belong to the specified category
 // and have ALL the specified subcategories. This uses DuckDB's JSON functions to query
 // the subcategories array stored in the note_categories table.
 // The userGUID parameter filters to notes owned by that user.
+// limit=0 returns all notes, offset skips the first N results.
 // Returns empty slice if no matching notes are found.
-func GetNotesByCategoryAndSubcategories(categoryName string, subcategories []string, userGUID string) ([]Note, error) {
+func GetNotesByCategoryAndSubcategories(categoryName string, subcategories []string, userGUID string, limit, offset int) ([]Note, error) {
+	return GetNotesByCategoryAndSubcategoriesInRange(categoryName, subcategories, userGUID, CreatedRange{}, limit, offset)
+}
+
+// GetNotesByCategoryAndSubcategoriesInRange is
+// GetNotesByCategoryAndSubcategories limited to notes created within created.
+func GetNotesByCategoryAndSubcategoriesInRange(categoryName string, subcategories []string, userGUID string,
+	created CreatedRange, limit, offset int) ([]Note, error) {
 	if len(subcategories) == 0 {
-		return GetNotesByCategoryName(categoryName, userGUID)
+		return GetNotesByCategoryNameInRange(categoryName, userGUID, created, limit, offset)
+	}
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
 	}
 
-	// Build the query with JSON array contains checks for each subcategory.
-	// DuckDB supports list_contains for checking if an array contains a value.
-	// Since subcategories is stored as JSON string, we need to parse it first.
-	query := `SELECT n.id, n.guid, n.title, n.description, n.body, n.tags,
-		n.is_private, n.is_flagged, n.encryption_iv, n.created_by, n.updated_by,
+	// The subcategories JSON is parsed once per row in the CTE, then a single
+	// list_has_all checks that every requested subcategory is present.
+	// The requested list is built from placeholders so values stay bound.
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(subcategories)), ", ")
+	query := `WITH nc AS (
+			SELECT note_id, category_id,
+				json_extract_string(subcategories, '$[*]')::VARCHAR[] AS subcats
+			FROM note_categories
+			WHERE subcategories IS NOT NULL
+		)
+		SELECT n.id, n.guid, n.title, n.description, n.body, n.tags,
+		n.is_private, n.is_flagged, n.starred, n.encryption_iv, n.created_by, n.updated_by,
 		n.created_at, n.updated_at, n.synced_at, n.deleted_at
 		FROM notes n
-		INNER JOIN note_categories nc ON n.id = nc.note_id
+		INNER JOIN nc ON n.id = nc.note_id
 		INNER JOIN categories c ON nc.category_id = c.id
-		WHERE c.name = ? AND n.created_by = ? AND n.deleted_at IS NULL AND nc.subcategories IS NOT NULL`
-
-	// Add a condition for each subcategory to ensure ALL are present.
-	// Using DuckDB's json_extract_string with list_contains.
-	for range subcategories {
-		query += ` AND list_contains(json_extract_string(nc.subcategories, '$[*]')::VARCHAR[], ?)`
-	}
-
-	query += ` ORDER BY n.created_at DESC`
+		WHERE c.name = ? AND n.created_by = ? AND c.created_by = n.created_by AND n.deleted_at IS NULL
+		AND list_has_all(nc.subcats, [` + placeholders + `]::VARCHAR[])`
 
 	// Build args: category name first, userGUID second, then each subcategory
 	args := make([]interface{}, 0, len(subcategories)+2)
@@ -925,6 +1458,7 @@ func GetNotesByCategoryAndSubcategories(categoryName string, subcategories []str
 	for _, subcat := range subcategories {
 		args = append(args, subcat)
 	}
+	query, args = appendNotePageClauses(query, args, created, limit, offset)
 
 	rows, err := cacheDB.Query(query, args...)
 	if err != nil {
@@ -944,6 +1478,7 @@ func GetNotesByCategoryAndSubcategories(categoryName string, subcategories []str
 			&note.Tags,
 			&note.IsPrivate,
 			&note.IsFlagged,
+			&note.Starred,
 			&note.EncryptionIV,
 			&note.CreatedBy,
 			&note.UpdatedBy,
@@ -1,8 +1,13 @@
 package models_test
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"gonotes/models"
 )
@@ -11,7 +16,7 @@ import (
 const catTestUserGUID = "cat-test-user-guid-001"
 
 // setupCategoryTestDB initializes a clean test database for category tests
-func setupCategoryTestDB(t *testing.T) func() {
+func setupCategoryTestDB(t testing.TB) func() {
 	t.Helper()
 
 	// Remove existing test database
@@ -168,7 +173,7 @@ func TestCategoryDelete(t *testing.T) {
 		}
 
 		// Delete the category
-		err = models.DeleteCategory(category.ID, catTestUserGUID)
+		err = models.DeleteCategory(category.ID, catTestUserGUID, false)
 		if err != nil {
 			t.Fatalf("failed to delete category: %v", err)
 		}
@@ -182,6 +187,50 @@ func TestCategoryDelete(t *testing.T) {
 			t.Error("expected category to be nil after deletion")
 		}
 	})
+
+	t.Run("delete category linked to notes", func(t *testing.T) {
+		category, err := models.CreateCategory(models.CategoryInput{Name: "Linked Category"}, catTestUserGUID)
+		if err != nil {
+			t.Fatalf("failed to create category: %v", err)
+		}
+		note, err := models.CreateNote(models.NoteInput{GUID: "linked-note-001", Title: "Linked"}, catTestUserGUID)
+		if err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+		if err := models.AddCategoryToNote(note.ID, category.ID, catTestUserGUID); err != nil {
+			t.Fatalf("failed to add category to note: %v", err)
+		}
+
+		// Refused by default, leaving the category and link in place
+		err = models.DeleteCategory(category.ID, catTestUserGUID, false)
+		var inUseErr *models.CategoryInUseError
+		if !errors.As(err, &inUseErr) || inUseErr.NoteCount != 1 {
+			t.Fatalf("expected CategoryInUseError for 1 note, got %v", err)
+		}
+		if _, err := models.GetCategory(category.ID, catTestUserGUID); err != nil {
+			t.Fatalf("expected category to survive refused delete: %v", err)
+		}
+
+		// Forced, the link goes with the category
+		if err := models.DeleteCategory(category.ID, catTestUserGUID, true); err != nil {
+			t.Fatalf("failed to force delete category: %v", err)
+		}
+		if _, err := models.GetCategory(category.ID, catTestUserGUID); err == nil {
+			t.Error("expected category to be deleted")
+		}
+
+		// Reload the cache from disk to check both databases dropped the link
+		if err := models.RebuildCache(); err != nil {
+			t.Fatalf("failed to rebuild cache: %v", err)
+		}
+		categories, err := models.GetNoteCategories(note.ID, catTestUserGUID)
+		if err != nil {
+			t.Fatalf("failed to get note categories: %v", err)
+		}
+		if len(categories) != 0 {
+			t.Errorf("expected note to have no categories, got %d", len(categories))
+		}
+	})
 }
 
 // TestNoteCategoryRelationshipSync verifies note-category relationships are synced
@@ -371,7 +420,7 @@ func TestCategoryEdgeCases(t *testing.T) {
 	})
 
 	t.Run("delete non-existent category", func(t *testing.T) {
-		err := models.DeleteCategory(99999, catTestUserGUID)
+		err := models.DeleteCategory(99999, catTestUserGUID, false)
 		if err == nil {
 			t.Error("expected error when deleting non-existent category")
 		}
@@ -562,24 +611,24 @@ func TestCategorySubcategoryQueries(t *testing.T) {
 		}
 
 		// Add categories to notes with subcategories
-		err = models.AddCategoryToNoteWithSubcategories(note1.ID, k8sCategory.ID, []string{"pod"}, catTestUserGUID)
+		err = models.AddCategoryToNoteWithSubcategories(note1.ID, k8sCategory.ID, []string{"pod"}, catTestUserGUID, true)
 		if err != nil {
 			t.Fatalf("failed to add k8s/pod to note1: %v", err)
 		}
 
-		err = models.AddCategoryToNoteWithSubcategories(note2.ID, k8sCategory.ID, []string{"deployment", "replicaset"}, catTestUserGUID)
+		err = models.AddCategoryToNoteWithSubcategories(note2.ID, k8sCategory.ID, []string{"deployment", "replicaset"}, catTestUserGUID, true)
 		if err != nil {
 			t.Fatalf("failed to add k8s/deployment,replicaset to note2: %v", err)
 		}
 
-		err = models.AddCategoryToNoteWithSubcategories(note3.ID, awsCategory.ID, []string{"ec2"}, catTestUserGUID)
+		err = models.AddCategoryToNoteWithSubcategories(note3.ID, awsCategory.ID, []string{"ec2"}, catTestUserGUID, true)
 		if err != nil {
 			t.Fatalf("failed to add aws/ec2 to note3: %v", err)
 		}
 	})
 
 	t.Run("query notes by category name only", func(t *testing.T) {
-		notes, err := models.GetNotesByCategoryName("k8s", catTestUserGUID)
+		notes, err := models.GetNotesByCategoryName("k8s", catTestUserGUID, 0, 0)
 		if err != nil {
 			t.Fatalf("failed to get notes by category name: %v", err)
 		}
@@ -599,7 +648,7 @@ func TestCategorySubcategoryQueries(t *testing.T) {
 	})
 
 	t.Run("query notes by category name - aws", func(t *testing.T) {
-		notes, err := models.GetNotesByCategoryName("aws", catTestUserGUID)
+		notes, err := models.GetNotesByCategoryName("aws", catTestUserGUID, 0, 0)
 		if err != nil {
 			t.Fatalf("failed to get notes by category name: %v", err)
 		}
@@ -614,7 +663,7 @@ func TestCategorySubcategoryQueries(t *testing.T) {
 	})
 
 	t.Run("query notes by non-existent category", func(t *testing.T) {
-		notes, err := models.GetNotesByCategoryName("nonexistent", catTestUserGUID)
+		notes, err := models.GetNotesByCategoryName("nonexistent", catTestUserGUID, 0, 0)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -624,8 +673,33 @@ func TestCategorySubcategoryQueries(t *testing.T) {
 		}
 	})
 
+	t.Run("query notes by category name - paginated", func(t *testing.T) {
+		first, err := models.GetNotesByCategoryName("k8s", catTestUserGUID, 1, 0)
+		if err != nil {
+			t.Fatalf("failed to get notes by category name: %v", err)
+		}
+		second, err := models.GetNotesByCategoryName("k8s", catTestUserGUID, 1, 1)
+		if err != nil {
+			t.Fatalf("failed to get notes by category name: %v", err)
+		}
+		if len(first) != 1 || len(second) != 1 {
+			t.Fatalf("expected one note per page, got %d and %d", len(first), len(second))
+		}
+		if first[0].ID == second[0].ID {
+			t.Error("expected the two pages to hold different notes")
+		}
+
+		past, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{"pod"}, catTestUserGUID, 1, 1)
+		if err != nil {
+			t.Fatalf("failed to get notes by category and subcategory: %v", err)
+		}
+		if len(past) != 0 {
+			t.Errorf("expected no notes past the only k8s/pod note, got %d", len(past))
+		}
+	})
+
 	t.Run("query notes by category and single subcategory", func(t *testing.T) {
-		notes, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{"pod"}, catTestUserGUID)
+		notes, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{"pod"}, catTestUserGUID, 0, 0)
 		if err != nil {
 			t.Fatalf("failed to get notes by category and subcategory: %v", err)
 		}
@@ -640,7 +714,7 @@ func TestCategorySubcategoryQueries(t *testing.T) {
 	})
 
 	t.Run("query notes by category and multiple subcategories", func(t *testing.T) {
-		notes, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{"deployment", "replicaset"}, catTestUserGUID)
+		notes, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{"deployment", "replicaset"}, catTestUserGUID, 0, 0)
 		if err != nil {
 			t.Fatalf("failed to get notes by category and subcategories: %v", err)
 		}
@@ -656,7 +730,7 @@ func TestCategorySubcategoryQueries(t *testing.T) {
 
 	t.Run("query notes by category and partial subcategory match", func(t *testing.T) {
 		// note2 has deployment and replicaset, query for deployment only
-		notes, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{"deployment"}, catTestUserGUID)
+		notes, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{"deployment"}, catTestUserGUID, 0, 0)
 		if err != nil {
 			t.Fatalf("failed to get notes by category and subcategory: %v", err)
 		}
@@ -671,7 +745,7 @@ func TestCategorySubcategoryQueries(t *testing.T) {
 	})
 
 	t.Run("query notes by category and non-matching subcategory", func(t *testing.T) {
-		notes, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{"service"}, catTestUserGUID)
+		notes, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{"service"}, catTestUserGUID, 0, 0)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -682,7 +756,7 @@ func TestCategorySubcategoryQueries(t *testing.T) {
 	})
 
 	t.Run("query with empty subcategories returns all category notes", func(t *testing.T) {
-		notes, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{}, catTestUserGUID)
+		notes, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{}, catTestUserGUID, 0, 0)
 		if err != nil {
 			t.Fatalf("failed to get notes: %v", err)
 		}
@@ -694,13 +768,13 @@ func TestCategorySubcategoryQueries(t *testing.T) {
 
 	t.Run("update note subcategories", func(t *testing.T) {
 		// Update note1's subcategories from ["pod"] to ["pod", "service"]
-		err := models.UpdateNoteCategorySubcategories(note1.ID, k8sCategory.ID, []string{"pod", "service"})
+		err := models.UpdateNoteCategorySubcategories(note1.ID, k8sCategory.ID, []string{"pod", "service"}, true)
 		if err != nil {
 			t.Fatalf("failed to update subcategories: %v", err)
 		}
 
 		// Now query for service should return note1
-		notes, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{"service"}, catTestUserGUID)
+		notes, err := models.GetNotesByCategoryAndSubcategories("k8s", []string{"service"}, catTestUserGUID, 0, 0)
 		if err != nil {
 			t.Fatalf("failed to get notes: %v", err)
 		}
@@ -740,3 +814,299 @@ func TestCategorySubcategoryQueries(t *testing.T) {
 		}
 	})
 }
+
+// TestCountNotes verifies that CountNotes matches the list queries for each
+// filter, ignoring pagination
+func TestCountNotes(t *testing.T) {
+	cleanup := setupCategoryTestDB(t)
+	defer cleanup()
+
+	k8s, err := models.CreateCategory(models.CategoryInput{
+		Name:          "k8s",
+		Subcategories: []string{"pod", "service"},
+	}, catTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+
+	var noteIDs []int64
+	for i := 0; i < 4; i++ {
+		note, err := models.CreateNote(models.NoteInput{
+			GUID:  fmt.Sprintf("count-note-%d", i),
+			Title: fmt.Sprintf("Count note %d", i),
+		}, catTestUserGUID)
+		if err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+		noteIDs = append(noteIDs, note.ID)
+	}
+	// Notes 0 and 1 are in k8s, only note 0 with both subcategories
+	if err := models.AddCategoryToNoteWithSubcategories(noteIDs[0], k8s.ID, []string{"pod", "service"}, catTestUserGUID, false); err != nil {
+		t.Fatalf("failed to link note: %v", err)
+	}
+	if err := models.AddCategoryToNoteWithSubcategories(noteIDs[1], k8s.ID, []string{"pod"}, catTestUserGUID, false); err != nil {
+		t.Fatalf("failed to link note: %v", err)
+	}
+	// A deleted note and another user's note are never counted
+	if _, err := models.DeleteNote(noteIDs[3], catTestUserGUID); err != nil {
+		t.Fatalf("failed to delete note: %v", err)
+	}
+	if _, err := models.CreateNote(models.NoteInput{GUID: "count-note-other", Title: "Other"}, "other-user-guid"); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter models.NoteListFilter
+		want   int
+	}{
+		{"no filter", models.NoteListFilter{}, 3},
+		{"category", models.NoteListFilter{Category: "k8s"}, 2},
+		{"subcategory", models.NoteListFilter{Category: "k8s", Subcategories: []string{"pod"}}, 2},
+		{"all subcategories", models.NoteListFilter{Category: "k8s", Subcategories: []string{"pod", "service"}}, 1},
+		{"unknown category", models.NoteListFilter{Category: "aws"}, 0},
+		{"modified since", models.NoteListFilter{ModifiedSince: time.Now().Add(time.Hour)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := models.CountNotes(catTestUserGUID, tt.filter)
+			if err != nil {
+				t.Fatalf("CountNotes failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %d notes, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestGetSubcategoryUsage verifies per-subcategory note counts, including
+// zero for defined subcategories no note selects.
+func TestGetSubcategoryUsage(t *testing.T) {
+	cleanup := setupCategoryTestDB(t)
+	defer cleanup()
+
+	k8s, err := models.CreateCategory(models.CategoryInput{
+		Name:          "k8s",
+		Subcategories: []string{"pod", "service", "ingress"},
+	}, catTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+
+	subcatsByNote := [][]string{{"pod", "service"}, {"pod"}, {"pod"}}
+	var noteIDs []int64
+	for i, subcats := range subcatsByNote {
+		note, err := models.CreateNote(models.NoteInput{
+			GUID:  fmt.Sprintf("usage-note-%d", i),
+			Title: fmt.Sprintf("Usage note %d", i),
+		}, catTestUserGUID)
+		if err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+		if err := models.AddCategoryToNoteWithSubcategories(note.ID, k8s.ID, subcats, catTestUserGUID, true); err != nil {
+			t.Fatalf("failed to link note: %v", err)
+		}
+		noteIDs = append(noteIDs, note.ID)
+	}
+	// A deleted note's selections aren't counted
+	if _, err := models.DeleteNote(noteIDs[2], catTestUserGUID); err != nil {
+		t.Fatalf("failed to delete note: %v", err)
+	}
+
+	usage, err := models.GetSubcategoryUsage(k8s.ID)
+	if err != nil {
+		t.Fatalf("GetSubcategoryUsage failed: %v", err)
+	}
+	want := map[string]int{"pod": 2, "service": 1, "ingress": 0}
+	if fmt.Sprint(usage) != fmt.Sprint(want) {
+		t.Errorf("expected usage %v, got %v", want, usage)
+	}
+
+	if _, err := models.GetSubcategoryUsage(99999); err == nil {
+		t.Error("expected error for unknown category")
+	}
+}
+
+// TestCategoryFavorites verifies that a user's favorite categories list first
+// for that user only, and that deleting a category drops it from favorites.
+func TestCategoryFavorites(t *testing.T) {
+	cleanup := setupCategoryTestDB(t)
+	defer cleanup()
+
+	const otherUserGUID = "fav-other-user-guid"
+	var ids []int64
+	for _, name := range []string{"oldest", "middle", "newest"} {
+		cat, err := models.CreateCategory(models.CategoryInput{Name: name}, catTestUserGUID)
+		if err != nil {
+			t.Fatalf("failed to create category: %v", err)
+		}
+		ids = append(ids, cat.ID)
+		time.Sleep(2 * time.Millisecond) // distinct created_at for ordering
+	}
+	otherCat, err := models.CreateCategory(models.CategoryInput{Name: "other"}, otherUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+
+	names := func(cats []models.Category) string {
+		var out []string
+		for _, c := range cats {
+			out = append(out, c.Name)
+		}
+		return fmt.Sprint(out)
+	}
+
+	if err := models.FavoriteCategory(catTestUserGUID, ids[0]); err != nil {
+		t.Fatalf("FavoriteCategory failed: %v", err)
+	}
+	if err := models.FavoriteCategory(catTestUserGUID, ids[0]); err != nil {
+		t.Fatalf("favoriting a favorite should be a no-op: %v", err)
+	}
+
+	cats, err := models.ListCategoriesFavoritesFirst(0, 0, catTestUserGUID)
+	if err != nil {
+		t.Fatalf("ListCategoriesFavoritesFirst failed: %v", err)
+	}
+	if got := names(cats); got != "[oldest newest middle]" {
+		t.Errorf("expected the favorite first, got %s", got)
+	}
+	counted, err := models.ListCategoriesWithCountsFavoritesFirst(catTestUserGUID, 0, 0)
+	if err != nil {
+		t.Fatalf("ListCategoriesWithCountsFavoritesFirst failed: %v", err)
+	}
+	if len(counted) != 3 || counted[0].Name != "oldest" {
+		t.Errorf("expected the favorite first with counts, got %v", counted)
+	}
+
+	// Another user's list is unaffected, and so is the default order
+	otherCats, err := models.ListCategoriesFavoritesFirst(0, 0, otherUserGUID)
+	if err != nil || len(otherCats) != 1 || otherCats[0].ID != otherCat.ID {
+		t.Errorf("expected only the other user's category, got %v (err %v)", otherCats, err)
+	}
+	cats, _ = models.ListCategories(0, 0, catTestUserGUID)
+	if got := names(cats); got != "[newest middle oldest]" {
+		t.Errorf("expected newest first without favorites_first, got %s", got)
+	}
+
+	if err := models.UnfavoriteCategory(catTestUserGUID, ids[0]); err != nil {
+		t.Fatalf("UnfavoriteCategory failed: %v", err)
+	}
+	cats, _ = models.ListCategoriesFavoritesFirst(0, 0, catTestUserGUID)
+	if got := names(cats); got != "[newest middle oldest]" {
+		t.Errorf("expected newest first after unfavoriting, got %s", got)
+	}
+
+	if err := models.FavoriteCategory(catTestUserGUID, ids[1]); err != nil {
+		t.Fatalf("FavoriteCategory failed: %v", err)
+	}
+	if err := models.DeleteCategory(ids[1], catTestUserGUID, false); err != nil {
+		t.Fatalf("DeleteCategory failed: %v", err)
+	}
+	if favorites, _ := models.ListFavoriteCategoryIDs(catTestUserGUID); len(favorites) != 0 {
+		t.Errorf("expected deleting a category to drop it from favorites, got %v", favorites)
+	}
+}
+
+// BenchmarkGetNotesByCategoryAndSubcategories measures filtering on several
+// subcategories at once, where each row's subcategories JSON should be parsed
+// only once regardless of how many filters are given.
+func BenchmarkGetNotesByCategoryAndSubcategories(b *testing.B) {
+	cleanup := setupCategoryTestDB(b)
+	defer cleanup()
+
+	subcats := []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta"}
+	cat, err := models.CreateCategory(models.CategoryInput{Name: "bench", Subcategories: subcats}, catTestUserGUID)
+	if err != nil {
+		b.Fatalf("failed to create category: %v", err)
+	}
+
+	for i := 0; i < 200; i++ {
+		note, err := models.CreateNote(models.NoteInput{GUID: fmt.Sprintf("bench-note-%d", i), Title: "Bench"}, catTestUserGUID)
+		if err != nil {
+			b.Fatalf("failed to create note: %v", err)
+		}
+		// Every other note has all the subcategories so half the rows match
+		noteSubcats := subcats[:3]
+		if i%2 == 0 {
+			noteSubcats = subcats
+		}
+		if err := models.AddCategoryToNoteWithSubcategories(note.ID, cat.ID, noteSubcats, catTestUserGUID, true); err != nil {
+			b.Fatalf("failed to add category to note: %v", err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		notes, err := models.GetNotesByCategoryAndSubcategories("bench", subcats, catTestUserGUID, 0, 0)
+		if err != nil {
+			b.Fatalf("query failed: %v", err)
+		}
+		if len(notes) != 100 {
+			b.Fatalf("expected 100 matching notes, got %d", len(notes))
+		}
+	}
+}
+
+// TestAddRemoveSubcategoryConcurrently verifies that concurrent single
+// subcategory additions all persist, on disk and in the cache, and that
+// removal and the duplicate/missing errors behave.
+func TestAddRemoveSubcategoryConcurrently(t *testing.T) {
+	cleanup := setupCategoryTestDB(t)
+	defer cleanup()
+
+	cat, err := models.CreateCategory(models.CategoryInput{Name: "Concurrent", Subcategories: []string{"base"}}, catTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(names))
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			errs <- models.AddSubcategory(cat.ID, name)
+		}(name)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("AddSubcategory failed: %v", err)
+		}
+	}
+
+	got, err := models.GetCategory(cat.ID, catTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to get category: %v", err)
+	}
+	subcats := got.ToOutput().Subcategories
+	if len(subcats) != len(names)+1 {
+		t.Fatalf("expected %d subcategories, got %v", len(names)+1, subcats)
+	}
+	var onDisk string
+	if err := models.DB().QueryRow(`SELECT subcategories FROM categories WHERE id = ?`, cat.ID).Scan(&onDisk); err != nil {
+		t.Fatalf("failed to read disk subcategories: %v", err)
+	}
+	for _, name := range names {
+		if !strings.Contains(onDisk, fmt.Sprintf("%q", name)) {
+			t.Errorf("expected %q on disk, got %s", name, onDisk)
+		}
+	}
+
+	if err := models.AddSubcategory(cat.ID, "a"); err == nil || err.Error() != "subcategory already exists" {
+		t.Errorf("expected a duplicate add to fail, got %v", err)
+	}
+	if err := models.RemoveSubcategory(cat.ID, "base"); err != nil {
+		t.Fatalf("RemoveSubcategory failed: %v", err)
+	}
+	if err := models.RemoveSubcategory(cat.ID, "base"); err == nil || err.Error() != "subcategory not found" {
+		t.Errorf("expected removing a missing subcategory to fail, got %v", err)
+	}
+	got, _ = models.GetCategory(cat.ID, catTestUserGUID)
+	if subcats := got.ToOutput().Subcategories; len(subcats) != len(names) || subcats[0] == "base" {
+		t.Errorf("expected base removed, got %v", subcats)
+	}
+}
@@ -208,17 +208,24 @@ func insertCategoryFragment(fragment CategoryFragment) (int64, error) {
 
 // insertCategoryChange records a category change to the database.
 func insertCategoryChange(changeGUID, categoryGUID string, operation int32, fragmentID sql.NullInt64, user string) error {
+	return insertCategoryChangeFromPeer(changeGUID, categoryGUID, operation, fragmentID, user, "")
+}
+
+// insertCategoryChangeFromPeer records a category change applied from another
+// peer, storing originPeer so the change is not echoed back to it.
+func insertCategoryChangeFromPeer(changeGUID, categoryGUID string, operation int32, fragmentID sql.NullInt64, user, originPeer string) error {
 	query := `
-		INSERT INTO category_changes (guid, category_guid, operation, category_fragment_id, user)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO category_changes (guid, category_guid, operation, category_fragment_id, user, origin_peer)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`
 
 	userVal := sql.NullString{}
 	if user != "" {
 		userVal = sql.NullString{String: user, Valid: true}
 	}
+	originVal := sql.NullString{String: originPeer, Valid: originPeer != ""}
 
-	_, err := db.Exec(query, changeGUID, categoryGUID, operation, fragmentID, userVal)
+	_, err := db.Exec(query, changeGUID, categoryGUID, operation, fragmentID, userVal, originVal)
 	if err != nil {
 		return serr.Wrap(err, "failed to insert category change")
 	}
@@ -305,13 +312,28 @@ func GetCategoryChangeWithFragment(changeID int64) (*CategoryChangeOutput, error
 }
 
 // GetUnsentCategoryChangesForPeer retrieves category changes not yet sent to a peer.
-// Returns up to 'limit' changes ordered by creation time (oldest first).
+// Returns up to 'limit' changes ordered by creation time (oldest first), excluding
+// changes that originated from the peer itself.
 // When userGUID is non-empty, only changes for categories owned by that user are
 // returned (multi-user hub isolation). When empty, all changes are returned (spoke).
 func GetUnsentCategoryChangesForPeer(peerID string, userGUID string, limit int) ([]CategoryChange, error) {
+	return getUnsentCategoryChangesForPeer(peerID, userGUID, "", limit)
+}
+
+// getUnsentCategoryChangesForPeer implements GetUnsentCategoryChangesForPeer.
+// A non-empty categoryGUID restricts the result to that category's own changes.
+func getUnsentCategoryChangesForPeer(peerID, userGUID, categoryGUID string, limit int) ([]CategoryChange, error) {
 	var query string
 	var args []any
 
+	categoryFilter := ""
+	var categoryArgs []any
+	if categoryGUID != "" {
+		categoryFilter = `
+			AND cc.category_guid = ?`
+		categoryArgs = []any{categoryGUID}
+	}
+
 	if userGUID != "" {
 		// Multi-user hub: filter to only the authenticated user's categories
 		query = `
@@ -323,10 +345,11 @@ func GetUnsentCategoryChangesForPeer(peerID string, userGUID string, limit int)
 				FROM category_change_sync_peers
 				WHERE peer_id = ?
 			)
+			AND (cc.origin_peer IS NULL OR cc.origin_peer <> ?)` + categoryFilter + `
 			ORDER BY cc.created_at ASC
 			LIMIT ?
 		`
-		args = []any{userGUID, peerID, limit}
+		args = append(append([]any{userGUID, peerID, peerID}, categoryArgs...), limit)
 	} else {
 		// Single-user spoke: no user filter needed
 		query = `
@@ -337,10 +360,11 @@ func GetUnsentCategoryChangesForPeer(peerID string, userGUID string, limit int)
 				FROM category_change_sync_peers
 				WHERE peer_id = ?
 			)
+			AND (cc.origin_peer IS NULL OR cc.origin_peer <> ?)` + categoryFilter + `
 			ORDER BY cc.created_at ASC
 			LIMIT ?
 		`
-		args = []any{peerID, limit}
+		args = append(append([]any{peerID, peerID}, categoryArgs...), limit)
 	}
 
 	rows, err := db.Query(query, args...)
@@ -376,10 +400,12 @@ func GetUnsentCategoryChangesForPeer(peerID string, userGUID string, limit int)
 }
 
 // MarkCategoryChangeSyncedToPeer records that a category change has been synced to a peer.
+// Marking a change that is already marked is a no-op.
 func MarkCategoryChangeSyncedToPeer(categoryChangeID int64, peerID string) error {
 	query := `
 		INSERT INTO category_change_sync_peers (category_change_id, peer_id)
 		VALUES (?, ?)
+		ON CONFLICT DO NOTHING
 	`
 
 	_, err := db.Exec(query, categoryChangeID, peerID)
@@ -390,6 +416,16 @@ func MarkCategoryChangeSyncedToPeer(categoryChangeID int64, peerID string) error
 	return nil
 }
 
+// MarkCategoryChangesSyncedToPeerBatch is MarkCategoryChangeSyncedToPeer for
+// many changes at once, in a single multi-row INSERT. Changes already marked
+// are skipped.
+func MarkCategoryChangesSyncedToPeerBatch(categoryChangeIDs []int64, peerID string) error {
+	if err := insertSyncedToPeerRows(db, "category_change_sync_peers", "category_change_id", categoryChangeIDs, peerID); err != nil {
+		return serr.Wrap(err, "failed to mark category changes as synced to peer")
+	}
+	return nil
+}
+
 // recordCategoryCreateChange records a full-fragment change when a category is created.
 // Non-blocking: logs errors rather than failing the create operation.
 func recordCategoryCreateChange(category Category, input CategoryInput) {
@@ -461,7 +497,34 @@ func recordNoteCategoryMappingChange(noteID int64) {
 		return
 	}
 
-	// Query all category mappings for this note, using category GUIDs
+	mappingsJSON, err := noteCategoryMappingsJSON(noteID)
+	if err != nil {
+		logger.LogErr(err, "failed to build category mapping snapshot", "note_id", noteID)
+		return
+	}
+
+	// Create a note fragment with only the Categories bitmask set
+	fragment := NoteFragment{
+		Bitmask:    FragmentCategories,
+		Categories: sql.NullString{String: mappingsJSON, Valid: true},
+	}
+
+	fragmentID, err := insertNoteFragment(fragment)
+	if err != nil {
+		logger.LogErr(err, "failed to insert category mapping fragment", "note_guid", noteGUID)
+		return
+	}
+
+	if err := insertNoteChange(GenerateChangeGUID(), noteGUID, OperationUpdate,
+		sql.NullInt64{Int64: fragmentID, Valid: true}, ""); err != nil {
+		logger.LogErr(err, "failed to record category mapping change", "note_guid", noteGUID)
+	}
+}
+
+// noteCategoryMappingsJSON serializes a note's complete set of category
+// mappings (by category GUID, with selected subcategories) as the JSON array
+// carried in NoteFragment.Categories.
+func noteCategoryMappingsJSON(noteID int64) (string, error) {
 	query := `SELECT c.guid, nc.subcategories
 		FROM note_categories nc
 		INNER JOIN categories c ON nc.category_id = c.id
@@ -470,12 +533,11 @@ func recordNoteCategoryMappingChange(noteID int64) {
 
 	rows, err := cacheDB.Query(query, noteID)
 	if err != nil {
-		logger.LogErr(err, "failed to query note categories for mapping change", "note_id", noteID)
-		return
+		return "", serr.Wrap(err, "failed to query note categories for mapping snapshot")
 	}
 	defer rows.Close()
 
-	var mappings []NoteCategoryMappingSnapshot
+	mappings := []NoteCategoryMappingSnapshot{}
 	for rows.Next() {
 		var (
 			catGUID     string
@@ -495,37 +557,32 @@ func recordNoteCategoryMappingChange(noteID int64) {
 		}
 		mappings = append(mappings, mapping)
 	}
-
-	// Serialize the full mapping set as JSON
-	mappingsJSON, err := json.Marshal(mappings)
-	if err != nil {
-		logger.LogErr(err, "failed to marshal category mappings", "note_id", noteID)
-		return
-	}
-
-	// Create a note fragment with only the Categories bitmask set
-	fragment := NoteFragment{
-		Bitmask:    FragmentCategories,
-		Categories: sql.NullString{String: string(mappingsJSON), Valid: true},
+	if err := rows.Err(); err != nil {
+		return "", serr.Wrap(err, "failed to iterate note category mappings")
 	}
 
-	fragmentID, err := insertNoteFragment(fragment)
+	mappingsJSON, err := json.Marshal(mappings)
 	if err != nil {
-		logger.LogErr(err, "failed to insert category mapping fragment", "note_guid", noteGUID)
-		return
+		return "", serr.Wrap(err, "failed to marshal category mappings")
 	}
 
-	if err := insertNoteChange(GenerateChangeGUID(), noteGUID, OperationUpdate,
-		sql.NullInt64{Int64: fragmentID, Valid: true}, ""); err != nil {
-		logger.LogErr(err, "failed to record category mapping change", "note_guid", noteGUID)
-	}
+	return string(mappingsJSON), nil
 }
 
 // GetCategoryByGUID retrieves a category by its GUID from cache.
 // Used for sync operations where cross-machine identity is needed.
 // Intentionally does NOT filter by user — sync internals need to look up
 // any category by GUID regardless of ownership.
+// With a lazy cache, a category not yet cached is loaded from disk.
 func GetCategoryByGUID(guid string) (*Category, error) {
+	return getWithCacheFallback(
+		func() (*Category, error) { return getCategoryByGUIDFromCache(guid) },
+		func() (bool, error) { return lazyLoadCategoryByGUID(guid) },
+	)
+}
+
+// getCategoryByGUIDFromCache is the cache lookup behind GetCategoryByGUID.
+func getCategoryByGUIDFromCache(guid string) (*Category, error) {
 	query := `SELECT id, guid, name, description, subcategories, created_by, created_at, updated_at
 		FROM categories WHERE guid = ?`
 
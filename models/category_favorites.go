@@ -0,0 +1,110 @@
+package models
+
+import (
+	"strconv"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Favorite Categories
+//
+// Each user can mark categories as favorites, which ListCategories can sort
+// ahead of the rest (favorites_first) so they lead the sidebar. Favorites are
+// a per-user display preference: they live on disk only, aren't cached, and
+// aren't synced. Removing a category removes it from every favorites list;
+// when sync merges a duplicate category into its peer's copy, favorites of
+// the duplicate move to the copy.
+// ============================================================================
+
+const DDLCreateCategoryFavoritesTable = `
+CREATE TABLE IF NOT EXISTS category_favorites (
+    user_guid   VARCHAR NOT NULL,
+    category_id BIGINT NOT NULL,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_guid, category_id)
+);
+`
+
+// FavoriteCategory adds categoryID to userGUID's favorites. Favoriting a
+// favorite is a no-op. Callers are responsible for ownership checks.
+func FavoriteCategory(userGUID string, categoryID int64) error {
+	_, err := db.Exec(`
+		INSERT INTO category_favorites (user_guid, category_id) VALUES (?, ?)
+		ON CONFLICT DO NOTHING
+	`, userGUID, categoryID)
+	if err != nil {
+		return serr.Wrap(err, "failed to favorite category", "category_id", strconv.FormatInt(categoryID, 10))
+	}
+	return nil
+}
+
+// UnfavoriteCategory removes categoryID from userGUID's favorites, if it is
+// one.
+func UnfavoriteCategory(userGUID string, categoryID int64) error {
+	_, err := db.Exec(`DELETE FROM category_favorites WHERE user_guid = ? AND category_id = ?`,
+		userGUID, categoryID)
+	if err != nil {
+		return serr.Wrap(err, "failed to unfavorite category", "category_id", strconv.FormatInt(categoryID, 10))
+	}
+	return nil
+}
+
+// ListFavoriteCategoryIDs returns the ids of userGUID's favorite categories,
+// most recently favorited first.
+func ListFavoriteCategoryIDs(userGUID string) ([]int64, error) {
+	rows, err := db.Query(`SELECT category_id FROM category_favorites WHERE user_guid = ?
+		ORDER BY created_at DESC, category_id`, userGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to list favorite categories")
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, serr.Wrap(err, "failed to scan favorite category")
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// favoritesFirstOrder returns an ORDER BY prefix that sorts the categories in
+// favoriteIDs ahead of the rest, for the category id column idColumn, with
+// its arguments. It returns "" when there are no favorites.
+func favoritesFirstOrder(idColumn string, favoriteIDs []int64) (string, []any) {
+	if len(favoriteIDs) == 0 {
+		return "", nil
+	}
+	placeholders := "?"
+	args := []any{favoriteIDs[0]}
+	for _, id := range favoriteIDs[1:] {
+		placeholders += ", ?"
+		args = append(args, id)
+	}
+	return `CASE WHEN ` + idColumn + ` IN (` + placeholders + `) THEN 0 ELSE 1 END, `, args
+}
+
+// deleteCategoryFavorites removes a deleted category from every user's
+// favorites.
+func deleteCategoryFavorites(categoryID int64) error {
+	if _, err := db.Exec(`DELETE FROM category_favorites WHERE category_id = ?`, categoryID); err != nil {
+		return serr.Wrap(err, "failed to remove category from favorites", "category_id", strconv.FormatInt(categoryID, 10))
+	}
+	return nil
+}
+
+// moveCategoryFavorites makes favorites of category fromID favorites of toID
+// instead, for a category merged into another.
+func moveCategoryFavorites(fromID, toID int64) error {
+	if _, err := db.Exec(`
+		INSERT INTO category_favorites (user_guid, category_id, created_at)
+		SELECT user_guid, ?, created_at FROM category_favorites WHERE category_id = ?
+		ON CONFLICT DO NOTHING
+	`, toID, fromID); err != nil {
+		return serr.Wrap(err, "failed to move category favorites", "category_id", strconv.FormatInt(fromID, 10))
+	}
+	return deleteCategoryFavorites(fromID)
+}
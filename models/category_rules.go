@@ -0,0 +1,253 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Tag-Based Category Rules
+//
+// A category rule links a user's notes to one of their categories by tag:
+// whenever a note is created or updated, each rule whose tag pattern matches
+// one of the note's tags adds that category to the note, if it isn't there
+// already. Patterns are matched case-insensitively against each tag (tags
+// are split on commas and whitespace) and may use path.Match wildcards, so
+// "aws" matches only the tag "aws" while "aws-*" matches "aws-lambda".
+// Rules only ever add categories; removing a tag leaves the link in place.
+// The links they add are ordinary mappings and sync as usual. The rules
+// themselves are a per-user preference: disk only, not cached, not synced.
+// Deleting a category deletes its rules.
+// ============================================================================
+
+const DDLCreateCategoryRulesSequence = `CREATE SEQUENCE IF NOT EXISTS category_rules_id_seq START 1;`
+
+const DDLCreateCategoryRulesTable = `
+CREATE TABLE IF NOT EXISTS category_rules (
+    id          BIGINT PRIMARY KEY DEFAULT nextval('category_rules_id_seq'),
+    user_guid   VARCHAR NOT NULL,
+    tag_pattern VARCHAR NOT NULL,
+    category_id BIGINT NOT NULL,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_guid, tag_pattern, category_id)
+);
+`
+
+// ErrInvalidTagPattern is returned by CreateCategoryRule for an empty or
+// malformed tag pattern. Handlers map it to 400.
+var ErrInvalidTagPattern = errors.New("invalid tag pattern")
+
+// CategoryRule maps notes tagged with TagPattern to CategoryID.
+type CategoryRule struct {
+	ID         int64     `json:"id"`
+	TagPattern string    `json:"tag_pattern"`
+	CategoryID int64     `json:"category_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreateCategoryRule adds a rule linking userGUID's notes tagged with
+// tagPattern to categoryID, which must be one of the user's categories.
+// The pattern is stored lowercased. Adding a rule that already exists
+// returns the existing one. Existing notes aren't touched until
+// ApplyCategoryRulesToAllNotes runs.
+func CreateCategoryRule(userGUID, tagPattern string, categoryID int64) (*CategoryRule, error) {
+	if IsReadOnly() {
+		return nil, ErrReadOnly
+	}
+	tagPattern = strings.ToLower(strings.TrimSpace(tagPattern))
+	if tagPattern == "" || strings.ContainsFunc(tagPattern, isTagSeparator) {
+		return nil, ErrInvalidTagPattern
+	}
+	if _, err := path.Match(tagPattern, ""); err != nil {
+		return nil, ErrInvalidTagPattern
+	}
+
+	if _, err := GetCategory(categoryID, userGUID); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(`
+		INSERT INTO category_rules (user_guid, tag_pattern, category_id) VALUES (?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`, userGUID, tagPattern, categoryID); err != nil {
+		return nil, serr.Wrap(err, "failed to create category rule", "tag_pattern", tagPattern)
+	}
+
+	rule := &CategoryRule{TagPattern: tagPattern, CategoryID: categoryID}
+	if err := db.QueryRow(`SELECT id, created_at FROM category_rules
+		WHERE user_guid = ? AND tag_pattern = ? AND category_id = ?`,
+		userGUID, tagPattern, categoryID).Scan(&rule.ID, &rule.CreatedAt); err != nil {
+		return nil, serr.Wrap(err, "failed to read created category rule", "tag_pattern", tagPattern)
+	}
+	return rule, nil
+}
+
+// ListCategoryRules returns userGUID's category rules, oldest first.
+func ListCategoryRules(userGUID string) ([]CategoryRule, error) {
+	rows, err := db.Query(`SELECT id, tag_pattern, category_id, created_at FROM category_rules
+		WHERE user_guid = ? ORDER BY created_at, id`, userGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to list category rules")
+	}
+	defer rows.Close()
+
+	rules := []CategoryRule{}
+	for rows.Next() {
+		var rule CategoryRule
+		if err := rows.Scan(&rule.ID, &rule.TagPattern, &rule.CategoryID, &rule.CreatedAt); err != nil {
+			return nil, serr.Wrap(err, "failed to scan category rule")
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// ApplyCategoryRules links the note to every category whose rule matches
+// one of its tags, returning how many categories were added. Rules belong
+// to the note's owner; a deleted or missing note gets none.
+func ApplyCategoryRules(noteID int64) (int, error) {
+	var owner, tags sql.NullString
+	err := db.QueryRow(`SELECT created_by, tags FROM notes WHERE id = ? AND deleted_at IS NULL`,
+		noteID).Scan(&owner, &tags)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, serr.Wrap(err, "failed to read note tags", "note_id", strconv.FormatInt(noteID, 10))
+	}
+	if !owner.Valid || !tags.Valid {
+		return 0, nil
+	}
+
+	noteTags := splitTags(tags.String)
+	if len(noteTags) == 0 {
+		return 0, nil
+	}
+	rules, err := ListCategoryRules(owner.String)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, categoryID := range matchingRuleCategories(rules, noteTags) {
+		var linked int
+		if err := cacheDB.QueryRow(`SELECT COUNT(*) FROM note_categories WHERE note_id = ? AND category_id = ?`,
+			noteID, categoryID).Scan(&linked); err != nil {
+			return added, serr.Wrap(err, "failed to check existing relationship")
+		}
+		if linked > 0 {
+			continue
+		}
+		if err := AddCategoryToNote(noteID, categoryID, owner.String); err != nil {
+			return added, serr.Wrap(err, "failed to apply category rule",
+				"note_id", strconv.FormatInt(noteID, 10), "category_id", strconv.FormatInt(categoryID, 10))
+		}
+		added++
+	}
+	return added, nil
+}
+
+// ApplyCategoryRulesToAllNotes runs ApplyCategoryRules over every tagged,
+// non-deleted note owned by userGUID, for rules added after the notes were
+// saved. Returns the number of notes examined and categories added.
+func ApplyCategoryRulesToAllNotes(userGUID string) (notes int, added int, err error) {
+	rows, err := db.Query(`SELECT id FROM notes
+		WHERE created_by = ? AND deleted_at IS NULL AND COALESCE(tags, '') != ''
+		ORDER BY id`, userGUID)
+	if err != nil {
+		return 0, 0, serr.Wrap(err, "failed to list tagged notes")
+	}
+	var noteIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, 0, serr.Wrap(err, "failed to scan tagged note")
+		}
+		noteIDs = append(noteIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, serr.Wrap(err, "failed to read tagged notes")
+	}
+
+	for _, id := range noteIDs {
+		n, err := ApplyCategoryRules(id)
+		added += n
+		if err != nil {
+			return len(noteIDs), added, err
+		}
+	}
+	return len(noteIDs), added, nil
+}
+
+// applyCategoryRulesAfterSave runs ApplyCategoryRules for a note that was
+// just saved with tags. Failures are logged rather than returned: the note
+// itself is saved either way.
+func applyCategoryRulesAfterSave(noteID int64, tags *string) {
+	if tags == nil || strings.TrimSpace(*tags) == "" {
+		return
+	}
+	if _, err := ApplyCategoryRules(noteID); err != nil {
+		logger.LogErr(err, "failed to apply category rules", "note_id", noteID)
+	}
+}
+
+// matchingRuleCategories returns the distinct category ids of the rules
+// matching any of tags, in rule order.
+func matchingRuleCategories(rules []CategoryRule, tags []string) []int64 {
+	var ids []int64
+	seen := map[int64]bool{}
+	for _, rule := range rules {
+		if seen[rule.CategoryID] {
+			continue
+		}
+		for _, tag := range tags {
+			if ok, _ := path.Match(rule.TagPattern, tag); ok {
+				ids = append(ids, rule.CategoryID)
+				seen[rule.CategoryID] = true
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// splitTags splits a note's tags on commas and whitespace, lowercased.
+func splitTags(tags string) []string {
+	return strings.FieldsFunc(strings.ToLower(tags), isTagSeparator)
+}
+
+// isTagSeparator reports whether r separates tags.
+func isTagSeparator(r rune) bool {
+	return r == ',' || unicode.IsSpace(r)
+}
+
+// deleteCategoryRules removes the rules of a deleted category.
+func deleteCategoryRules(categoryID int64) error {
+	if _, err := db.Exec(`DELETE FROM category_rules WHERE category_id = ?`, categoryID); err != nil {
+		return serr.Wrap(err, "failed to remove category rules", "category_id", strconv.FormatInt(categoryID, 10))
+	}
+	return nil
+}
+
+// moveCategoryRules points the rules of category fromID at toID instead, for
+// a category merged into another.
+func moveCategoryRules(fromID, toID int64) error {
+	if _, err := db.Exec(`
+		INSERT INTO category_rules (user_guid, tag_pattern, category_id, created_at)
+		SELECT user_guid, tag_pattern, ?, created_at FROM category_rules WHERE category_id = ?
+		ON CONFLICT DO NOTHING
+	`, toID, fromID); err != nil {
+		return serr.Wrap(err, "failed to move category rules", "category_id", strconv.FormatInt(fromID, 10))
+	}
+	return deleteCategoryRules(fromID)
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Single-Subcategory Edits
+//
+// UpdateCategory replaces a category's whole subcategory list, so a client
+// adding one subcategory has to read the list, append, and write it back —
+// and two clients doing that at once would each write a list missing the
+// other's addition. AddSubcategory and RemoveSubcategory change one entry
+// instead, reading and writing the list under a per-category lock (the same
+// scheme as the per-note update locks), which UpdateCategory and
+// RenameSubcategory also hold. Each edit is saved through UpdateCategory's
+// path, so it records a category change for sync like any other update.
+// Removing a subcategory leaves notes that select it as they are, as
+// dropping it via UpdateCategory does.
+// ============================================================================
+
+// categoryLocks maps category id to its *sync.Mutex. Entries are never
+// removed.
+var categoryLocks sync.Map
+
+// lockCategory acquires the update lock for category id and returns its
+// unlock.
+func lockCategory(id int64) func() {
+	mu, _ := categoryLocks.LoadOrStore(id, &sync.Mutex{})
+	m := mu.(*sync.Mutex)
+	m.Lock()
+	return m.Unlock
+}
+
+// AddSubcategory appends name to the category's subcategories. Returns an
+// error "subcategory already exists" if it's already defined. Callers are
+// responsible for ownership checks.
+func AddSubcategory(categoryID int64, name string) error {
+	if IsReadOnly() {
+		return ErrReadOnly
+	}
+	if name == "" {
+		return serr.New("subcategory name is required")
+	}
+	return editSubcategories(categoryID, func(subcats []string) ([]string, error) {
+		if slices.Contains(subcats, name) {
+			return nil, serr.New("subcategory already exists")
+		}
+		return append(subcats, name), nil
+	})
+}
+
+// RemoveSubcategory removes name from the category's subcategories. Returns
+// an error "subcategory not found" if it isn't defined. Callers are
+// responsible for ownership checks.
+func RemoveSubcategory(categoryID int64, name string) error {
+	if IsReadOnly() {
+		return ErrReadOnly
+	}
+	return editSubcategories(categoryID, func(subcats []string) ([]string, error) {
+		i := slices.Index(subcats, name)
+		if i < 0 {
+			return nil, serr.New("subcategory not found")
+		}
+		return slices.Delete(subcats, i, i+1), nil
+	})
+}
+
+// editSubcategories rewrites the category's subcategory list with edit,
+// holding the category's lock from the read through the write.
+func editSubcategories(categoryID int64, edit func([]string) ([]string, error)) error {
+	unlock := lockCategory(categoryID)
+	defer unlock()
+
+	category, err := GetCategory(categoryID, "")
+	if err != nil {
+		return err
+	}
+
+	var subcats []string
+	if category.Subcategories.Valid && category.Subcategories.String != "" {
+		if err := json.Unmarshal([]byte(category.Subcategories.String), &subcats); err != nil {
+			return serr.Wrap(err, "failed to parse category subcategories")
+		}
+	}
+
+	subcats, err = edit(subcats)
+	if err != nil {
+		return err
+	}
+
+	input := CategoryInput{Name: category.Name, Subcategories: subcats}
+	if category.Description.Valid {
+		input.Description = &category.Description.String
+	}
+	if _, err := updateCategoryLocked(categoryID, input, ""); err != nil {
+		return serr.Wrap(err, "failed to update category subcategories")
+	}
+	return nil
+}
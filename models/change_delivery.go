@@ -0,0 +1,98 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Change Delivery Status
+//
+// For debugging a stuck sync: which peers have acknowledged a given note or
+// category change (its note_change_sync_peers / category_change_sync_peers
+// rows), and which registered peers are still waiting for it. The origin
+// peer of a change received via sync counts as having it, since that is what
+// keeps the change from being sent back. Spokes register no peers, so on a
+// spoke the pending list is always empty.
+// ============================================================================
+
+// PeerDelivery is a peer that has acknowledged a change.
+type PeerDelivery struct {
+	PeerID   string    `json:"peer_id"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// ChangeDeliveryStatus reports where a change has been delivered.
+type ChangeDeliveryStatus struct {
+	ChangeGUID string         `json:"change_guid"`
+	EntityType string         `json:"entity_type"` // "note" or "category"
+	EntityGUID string         `json:"entity_guid"`
+	Operation  int32          `json:"operation"`
+	CreatedAt  time.Time      `json:"created_at"`
+	Delivered  []PeerDelivery `json:"delivered"` // Oldest acknowledgment first
+	Pending    []string       `json:"pending"`   // Registered peers without it, by peer_id
+}
+
+// GetChangeDeliveryStatus returns the peers that have and haven't received
+// the note or category change with the given GUID. Returns nil, nil if there
+// is no such change.
+func GetChangeDeliveryStatus(changeGUID string) (*ChangeDeliveryStatus, error) {
+	status := &ChangeDeliveryStatus{ChangeGUID: changeGUID, Delivered: []PeerDelivery{}, Pending: []string{}}
+
+	var changeID int64
+	err := db.QueryRow(`SELECT id, note_guid, operation, created_at FROM note_changes WHERE guid = ?`,
+		changeGUID).Scan(&changeID, &status.EntityGUID, &status.Operation, &status.CreatedAt)
+	peersTable, idColumn := "note_change_sync_peers", "note_change_id"
+	status.EntityType = "note"
+	if err == sql.ErrNoRows {
+		err = db.QueryRow(`SELECT id, category_guid, operation, created_at FROM category_changes WHERE guid = ?`,
+			changeGUID).Scan(&changeID, &status.EntityGUID, &status.Operation, &status.CreatedAt)
+		peersTable, idColumn = "category_change_sync_peers", "category_change_id"
+		status.EntityType = "category"
+	}
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to look up change", "change_guid", changeGUID)
+	}
+
+	rows, err := db.Query(`SELECT peer_id, synced_at FROM `+peersTable+` WHERE `+idColumn+` = ?
+		ORDER BY synced_at, peer_id`, changeID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to query change deliveries")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d PeerDelivery
+		if err := rows.Scan(&d.PeerID, &d.SyncedAt); err != nil {
+			return nil, serr.Wrap(err, "failed to scan change delivery")
+		}
+		status.Delivered = append(status.Delivered, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, serr.Wrap(err, "failed to read change deliveries")
+	}
+
+	pendingRows, err := db.Query(`SELECT peer_id FROM registered_peers
+		WHERE peer_id NOT IN (SELECT peer_id FROM `+peersTable+` WHERE `+idColumn+` = ?)
+		ORDER BY peer_id`, changeID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to query peers pending a change")
+	}
+	defer pendingRows.Close()
+	for pendingRows.Next() {
+		var peerID string
+		if err := pendingRows.Scan(&peerID); err != nil {
+			return nil, serr.Wrap(err, "failed to scan pending peer")
+		}
+		status.Pending = append(status.Pending, peerID)
+	}
+	if err := pendingRows.Err(); err != nil {
+		return nil, serr.Wrap(err, "failed to read pending peers")
+	}
+
+	return status, nil
+}
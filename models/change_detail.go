@@ -0,0 +1,154 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Change Details
+//
+// For debugging sync: exactly what a single note or category change carries.
+// The fragment is returned in its wire form (as a pull would send it), with
+// the bitmask spelled out as field names so nobody has to decode 0xA4 by
+// hand. body_is_diff says whether a note fragment's body is a patch against
+// the previous body rather than the full text.
+// ============================================================================
+
+// ChangeDetail is a change with its fragment decoded.
+type ChangeDetail struct {
+	EntityType    string    `json:"entity_type"` // "note" or "category"
+	GUID          string    `json:"guid"`
+	EntityGUID    string    `json:"entity_guid"`
+	Operation     int32     `json:"operation"`
+	OperationName string    `json:"operation_name"` // create, update, delete, or sync
+	ChangedFields []string  `json:"changed_fields"` // The fragment bitmask as field names
+	BodyIsDiff    bool      `json:"body_is_diff"`
+	Fragment      any       `json:"fragment,omitempty"` // *NoteFragmentOutput or *CategoryFragmentOutput
+	User          string    `json:"user,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// noteFragmentFields and categoryFragmentFields name each bitmask bit, in
+// bit order from high to low.
+var (
+	noteFragmentFields = []struct {
+		bit  int16
+		name string
+	}{
+		{FragmentTitle, "title"},
+		{FragmentDescription, "description"},
+		{FragmentBody, "body"},
+		{FragmentTags, "tags"},
+		{FragmentIsPrivate, "is_private"},
+		{FragmentCategories, "categories"},
+		{FragmentStarred, "starred"},
+	}
+	categoryFragmentFields = []struct {
+		bit  int16
+		name string
+	}{
+		{CatFragmentName, "name"},
+		{CatFragmentDescription, "description"},
+		{CatFragmentSubcategories, "subcategories"},
+	}
+)
+
+// NoteFragmentFieldNames returns the names of the note fields set in bitmask.
+func NoteFragmentFieldNames(bitmask int16) []string {
+	names := []string{}
+	for _, f := range noteFragmentFields {
+		if bitmask&f.bit != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// CategoryFragmentFieldNames returns the names of the category fields set in
+// bitmask.
+func CategoryFragmentFieldNames(bitmask int16) []string {
+	names := []string{}
+	for _, f := range categoryFragmentFields {
+		if bitmask&f.bit != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// OperationName returns the name of a change operation code.
+func OperationName(operation int32) string {
+	switch operation {
+	case OperationCreate:
+		return "create"
+	case OperationUpdate:
+		return "update"
+	case OperationDelete:
+		return "delete"
+	case OperationSync:
+		return "sync"
+	}
+	return "unknown"
+}
+
+// GetChangeDetail returns the note or category change with the given GUID,
+// fragment decoded. Returns nil, nil if there is no such change.
+func GetChangeDetail(changeGUID string) (*ChangeDetail, error) {
+	var changeID int64
+	err := db.QueryRow(`SELECT id FROM note_changes WHERE guid = ?`, changeGUID).Scan(&changeID)
+	if err == nil {
+		change, err := GetNoteChangeWithFragment(changeID)
+		if err != nil || change == nil {
+			return nil, err
+		}
+		detail := &ChangeDetail{
+			EntityType:    "note",
+			GUID:          change.GUID,
+			EntityGUID:    change.NoteGUID,
+			Operation:     change.Operation,
+			OperationName: OperationName(change.Operation),
+			ChangedFields: []string{},
+			User:          change.User.String,
+			CreatedAt:     change.CreatedAt,
+		}
+		if change.Fragment != nil {
+			detail.ChangedFields = NoteFragmentFieldNames(change.Fragment.Bitmask)
+			detail.BodyIsDiff = change.Fragment.BodyIsDiff
+			detail.Fragment = noteFragmentToOutput(change.Fragment)
+		}
+		return detail, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, serr.Wrap(err, "failed to look up note change", "change_guid", changeGUID)
+	}
+
+	err = db.QueryRow(`SELECT id FROM category_changes WHERE guid = ?`, changeGUID).Scan(&changeID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to look up category change", "change_guid", changeGUID)
+	}
+	change, err := GetCategoryChangeWithFragment(changeID)
+	if err != nil || change == nil {
+		return nil, err
+	}
+	detail := &ChangeDetail{
+		EntityType:    "category",
+		GUID:          change.GUID,
+		EntityGUID:    change.CategoryGUID,
+		Operation:     change.Operation,
+		OperationName: OperationName(change.Operation),
+		ChangedFields: []string{},
+		User:          change.User.String,
+		CreatedAt:     change.CreatedAt,
+	}
+	if change.Fragment != nil {
+		detail.ChangedFields = CategoryFragmentFieldNames(change.Fragment.Bitmask)
+		detail.Fragment = categoryFragmentToOutput(change.Fragment)
+	}
+	return detail, nil
+}
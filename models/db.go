@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"os"
 	"path/filepath"
+	"sync/atomic"
+	"time"
 
 	_ "github.com/marcboeker/go-duckdb" // DuckDB driver registration
 	"github.com/rohanthewiz/logger"
@@ -21,6 +23,14 @@ var db *sql.DB
 // update both the disk DB and this cache to keep them synchronized.
 var cacheDB *sql.DB
 
+// dbPath is the file the disk database was opened from, for reporting its size.
+var dbPath string
+
+// dbReady is set once InitDB (or InitTestDB) has fully completed, and cleared
+// while the databases are closed or the cache is being rebuilt. Background
+// work such as the sync loop checks it via IsDBReady before touching the DB.
+var dbReady atomic.Bool
+
 // DBPath defines the location of the DuckDB database file.
 // Stored in ./data/ to keep data separate from application code.
 const DBPath = "./data/notes.ddb"
@@ -28,23 +38,36 @@ const DBPath = "./data/notes.ddb"
 // InitDB establishes a connection to the DuckDB database and creates
 // the required tables if they don't exist. This should be called once
 // at application startup before any database operations.
-// Also initializes the in-memory cache and synchronizes it with disk data.
+// Also initializes the in-memory cache and synchronizes it with disk data,
+// or leaves it to fill on demand when GONOTES_LAZY_CACHE is set.
 func InitDB() error {
+	return InitDBWithOptions(DBOptions{LazyCache: LazyCacheEnabled()})
+}
+
+// InitDBWithOptions is InitDB with explicit options (see DBOptions).
+func InitDBWithOptions(opts DBOptions) error {
 	var err error
+	dbReady.Store(false)
+
+	path := opts.Path
+	if path == "" {
+		path = DBPath
+	}
 
 	// Ensure the parent directory exists before opening the database.
 	// DuckDB creates the file but not the parent directory, so on a fresh
 	// machine the open would fail without this.
-	if err = os.MkdirAll(filepath.Dir(DBPath), 0o755); err != nil {
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return serr.Wrap(err, "failed to create database directory")
 	}
 
 	// Open connection to disk DuckDB. The driver will create the file if it
 	// doesn't exist, which is the expected behavior for first-run setup.
-	db, err = sql.Open("duckdb", DBPath)
+	db, err = sql.Open("duckdb", path)
 	if err != nil {
 		return serr.Wrap(err, "failed to open DuckDB connection")
 	}
+	dbPath = path
 
 	// Verify connection is working before proceeding with schema setup
 	if err = db.Ping(); err != nil {
@@ -52,27 +75,45 @@ func InitDB() error {
 	}
 
 	// Create tables - using IF NOT EXISTS makes this idempotent,
-	// safe to run on every startup without migration complexity
+	// safe to run on every startup
 	if err = createTables(); err != nil {
 		return serr.Wrap(err, "failed to create tables")
 	}
 
-	logger.Info("Disk database initialized successfully", "path", DBPath)
+	// Apply schema changes the existing tables don't have yet
+	if err = RunMigrations(); err != nil {
+		return serr.Wrap(err, "failed to run schema migrations")
+	}
+
+	logger.Info("Disk database initialized successfully", "path", path)
 
 	// Initialize in-memory cache database
 	if err = initCacheDB(); err != nil {
 		return serr.Wrap(err, "failed to initialize cache database")
 	}
+	setLazyCache(opts.LazyCache)
 
 	// Synchronize cache with disk data
 	if err = syncCacheFromDisk(); err != nil {
 		return serr.Wrap(err, "failed to sync cache from disk")
 	}
 
+	// Index links in existing notes the first time link tracking runs
+	if err = backfillNoteLinks(); err != nil {
+		return serr.Wrap(err, "failed to backfill note links")
+	}
+
 	logger.Info("In-memory cache initialized and synchronized")
+	dbReady.Store(true)
 	return nil
 }
 
+// IsDBReady reports whether the disk and cache databases are fully
+// initialized and not being rebuilt.
+func IsDBReady() bool {
+	return dbReady.Load()
+}
+
 // createTables executes DDL statements to set up the database schema.
 // Each table creation is idempotent via IF NOT EXISTS clauses.
 // Also runs migrations for schema changes (e.g., adding new columns).
@@ -88,6 +129,12 @@ func createTables() error {
 		return serr.Wrap(err, "failed to add is_flagged column")
 	}
 
+	// Migration: add view_count column for note view tracking
+	_, err = db.Exec(`ALTER TABLE notes ADD COLUMN IF NOT EXISTS view_count BIGINT DEFAULT 0`)
+	if err != nil {
+		return serr.Wrap(err, "failed to add view_count column")
+	}
+
 	// Migration: add authored_at column for existing databases
 	// This column tracks when a person last created/updated a note (for peer-to-peer sync)
 	_, err = db.Exec(`ALTER TABLE notes ADD COLUMN IF NOT EXISTS authored_at TIMESTAMP`)
@@ -95,6 +142,12 @@ func createTables() error {
 		return serr.Wrap(err, "failed to add authored_at column")
 	}
 
+	// Migration: add body_compressed column for compressed note bodies (disk only)
+	_, err = db.Exec(`ALTER TABLE notes ADD COLUMN IF NOT EXISTS body_compressed BOOLEAN DEFAULT false`)
+	if err != nil {
+		return serr.Wrap(err, "failed to add body_compressed column")
+	}
+
 	// Initialize authored_at for existing notes that don't have it
 	// Using updated_at as the best approximation of last human modification
 	_, err = db.Exec(`UPDATE notes SET authored_at = updated_at WHERE authored_at IS NULL`)
@@ -207,6 +260,13 @@ func createTables() error {
 		return serr.Wrap(err, "failed to create note_changes created_at index")
 	}
 
+	// Migration: origin_peer records which peer a synced change arrived from,
+	// so it is never sent back to that peer
+	_, err = db.Exec(`ALTER TABLE note_changes ADD COLUMN IF NOT EXISTS origin_peer VARCHAR`)
+	if err != nil {
+		return serr.Wrap(err, "failed to add origin_peer column to note_changes")
+	}
+
 	// Create note_change_sync_peers table (references note_changes)
 	_, err = db.Exec(DDLCreateNoteChangeSyncPeersTable)
 	if err != nil {
@@ -250,6 +310,12 @@ func createTables() error {
 		return serr.Wrap(err, "failed to create category_changes created_at index")
 	}
 
+	// Migration: origin_peer for category changes, mirroring note_changes
+	_, err = db.Exec(`ALTER TABLE category_changes ADD COLUMN IF NOT EXISTS origin_peer VARCHAR`)
+	if err != nil {
+		return serr.Wrap(err, "failed to add origin_peer column to category_changes")
+	}
+
 	_, err = db.Exec(DDLCreateCategoryChangeSyncPeersTable)
 	if err != nil {
 		return serr.Wrap(err, "failed to create category_change_sync_peers table")
@@ -276,6 +342,33 @@ func createTables() error {
 		return serr.Wrap(err, "failed to create sync_conflicts entity_guid index")
 	}
 
+	// Create sync_dead_letters table for pushed changes the hub won't accept
+	_, err = db.Exec(DDLCreateSyncDeadLettersSequence)
+	if err != nil {
+		return serr.Wrap(err, "failed to create sync_dead_letters sequence")
+	}
+
+	_, err = db.Exec(DDLCreateSyncDeadLettersTable)
+	if err != nil {
+		return serr.Wrap(err, "failed to create sync_dead_letters table")
+	}
+
+	// Create sync_metrics table for per-cycle sync history
+	_, err = db.Exec(DDLCreateSyncMetricsSequence)
+	if err != nil {
+		return serr.Wrap(err, "failed to create sync_metrics sequence")
+	}
+
+	_, err = db.Exec(DDLCreateSyncMetricsTable)
+	if err != nil {
+		return serr.Wrap(err, "failed to create sync_metrics table")
+	}
+
+	_, err = db.Exec(DDLCreateSyncMetricsIndexPeerID)
+	if err != nil {
+		return serr.Wrap(err, "failed to create sync_metrics peer_id index")
+	}
+
 	// Create sync_state table for persisting sync client state (Phase 4).
 	// Stores peer identity, auth tokens, and timestamps per hub URL
 	// so sync can resume across restarts without re-authenticating.
@@ -284,6 +377,13 @@ func createTables() error {
 		return serr.Wrap(err, "failed to create sync_state table")
 	}
 
+	// Migration: add refresh_token column so the sync client can renew its
+	// access token across restarts without the password
+	_, err = db.Exec(`ALTER TABLE sync_state ADD COLUMN IF NOT EXISTS refresh_token VARCHAR`)
+	if err != nil {
+		return serr.Wrap(err, "failed to add refresh_token column to sync_state")
+	}
+
 	// Create invite_tokens table for admin-managed user onboarding.
 	// Each token is single-use and time-limited.
 	_, err = db.Exec(DDLCreateInviteTokensSequence)
@@ -301,6 +401,112 @@ func createTables() error {
 		return serr.Wrap(err, "failed to create invite_tokens index")
 	}
 
+	// Create api_keys table for script-friendly authentication.
+	// Only key hashes are stored; plaintext keys are shown once at creation.
+	_, err = db.Exec(DDLCreateAPIKeysSequence)
+	if err != nil {
+		return serr.Wrap(err, "failed to create api_keys sequence")
+	}
+
+	_, err = db.Exec(DDLCreateAPIKeysTable)
+	if err != nil {
+		return serr.Wrap(err, "failed to create api_keys table")
+	}
+
+	_, err = db.Exec(DDLCreateAPIKeysIndexUserGUID)
+	if err != nil {
+		return serr.Wrap(err, "failed to create api_keys user_guid index")
+	}
+
+	// Create refresh_tokens table so long-lived clients can renew short-lived
+	// access tokens without re-sending credentials
+	_, err = db.Exec(DDLCreateRefreshTokensSequence)
+	if err != nil {
+		return serr.Wrap(err, "failed to create refresh_tokens sequence")
+	}
+
+	_, err = db.Exec(DDLCreateRefreshTokensTable)
+	if err != nil {
+		return serr.Wrap(err, "failed to create refresh_tokens table")
+	}
+
+	_, err = db.Exec(DDLCreateRefreshTokensIndexUserGUID)
+	if err != nil {
+		return serr.Wrap(err, "failed to create refresh_tokens user_guid index")
+	}
+
+	// Create attachments table for files uploaded to notes (disk only, not cached)
+	_, err = db.Exec(DDLCreateAttachmentsSequence)
+	if err != nil {
+		return serr.Wrap(err, "failed to create attachments sequence")
+	}
+
+	_, err = db.Exec(DDLCreateAttachmentsTable)
+	if err != nil {
+		return serr.Wrap(err, "failed to create attachments table")
+	}
+
+	_, err = db.Exec(DDLCreateAttachmentsIndexNoteID)
+	if err != nil {
+		return serr.Wrap(err, "failed to create attachments note_id index")
+	}
+
+	// Create share_tokens table for public read-only note links
+	_, err = db.Exec(DDLCreateShareTokensSequence)
+	if err != nil {
+		return serr.Wrap(err, "failed to create share_tokens sequence")
+	}
+
+	_, err = db.Exec(DDLCreateShareTokensTable)
+	if err != nil {
+		return serr.Wrap(err, "failed to create share_tokens table")
+	}
+
+	_, err = db.Exec(DDLCreateShareTokensIndexNoteID)
+	if err != nil {
+		return serr.Wrap(err, "failed to create share_tokens note_id index")
+	}
+
+	// Create idempotency_keys table so retried note creates aren't duplicated
+	_, err = db.Exec(DDLCreateIdempotencyKeysTable)
+	if err != nil {
+		return serr.Wrap(err, "failed to create idempotency_keys table")
+	}
+
+	// Create registered_peers table for the hub's peer allowlist
+	_, err = db.Exec(DDLCreateRegisteredPeersTable)
+	if err != nil {
+		return serr.Wrap(err, "failed to create registered_peers table")
+	}
+
+	// Create note_links table for backlinks (disk only, derived from bodies)
+	_, err = db.Exec(DDLCreateNoteLinksTable)
+	if err != nil {
+		return serr.Wrap(err, "failed to create note_links table")
+	}
+
+	_, err = db.Exec(DDLCreateNoteLinksIndexTarget)
+	if err != nil {
+		return serr.Wrap(err, "failed to create note_links target index")
+	}
+
+	// Create category_favorites table for per-user favorite categories (disk only)
+	_, err = db.Exec(DDLCreateCategoryFavoritesTable)
+	if err != nil {
+		return serr.Wrap(err, "failed to create category_favorites table")
+	}
+
+	// Create category_rules table for tag-based auto-categorization (disk only)
+	_, err = db.Exec(DDLCreateCategoryRulesSequence)
+	if err != nil {
+		return serr.Wrap(err, "failed to create category_rules sequence")
+	}
+
+	_, err = db.Exec(DDLCreateCategoryRulesTable)
+	if err != nil {
+		return serr.Wrap(err, "failed to create category_rules table")
+	}
+
 	return nil
 }
 
@@ -308,6 +514,7 @@ func createTables() error {
 // during application shutdown, typically via defer after InitDB.
 func CloseDB() error {
 	var errs []error
+	dbReady.Store(false)
 
 	if cacheDB != nil {
 		if err := cacheDB.Close(); err != nil {
@@ -385,6 +592,12 @@ func initCacheDB() error {
 		return serr.Wrap(err, "failed to add is_flagged column to cache notes")
 	}
 
+	// Add view_count column to cache notes table (matches disk migration)
+	_, err = cacheDB.Exec(`ALTER TABLE notes ADD COLUMN IF NOT EXISTS view_count BIGINT DEFAULT 0`)
+	if err != nil {
+		return serr.Wrap(err, "failed to add view_count column to cache notes")
+	}
+
 	// Add created_by column to cache categories table (matches disk migration)
 	_, err = cacheDB.Exec(`ALTER TABLE categories ADD COLUMN IF NOT EXISTS created_by VARCHAR`)
 	if err != nil {
@@ -396,114 +609,182 @@ func initCacheDB() error {
 		return serr.Wrap(err, "failed to create note_categories table in cache")
 	}
 
+	for _, ddl := range []string{DDLCreateSyncChecksumDigestsTable, DDLCreateSyncChecksumsTable} {
+		if _, err = cacheDB.Exec(ddl); err != nil {
+			return serr.Wrap(err, "failed to create sync checksum table in cache")
+		}
+	}
+	markSyncChecksumStale() // Built on first use
+
 	logger.Info("Cache database initialized")
 	return nil
 }
 
+// RebuildCache discards everything in the in-memory cache and reloads it from
+// the disk database. The cache never touches disk, so it is rebuilt this way on
+// every startup; calling it at runtime recovers from a cache that has drifted
+// from the source of truth. A lazy cache is just emptied, to refill on demand.
+func RebuildCache() error {
+	// Not ready while the cache is half-empty; restored once it's reloaded
+	if dbReady.Swap(false) {
+		defer dbReady.Store(true)
+	}
+
+	// Children before parents so no foreign key is left dangling
+	for _, table := range []string{"note_categories", "categories", "notes"} {
+		if _, err := cacheDB.Exec("DELETE FROM " + table); err != nil {
+			return serr.Wrap(err, "failed to clear cache table", "table", table)
+		}
+	}
+
+	markSyncChecksumStale()
+
+	if err := syncCacheFromDisk(); err != nil {
+		return serr.Wrap(err, "failed to reload cache from disk")
+	}
+	return nil
+}
+
 // syncCacheFromDisk loads all data from the disk database into the cache.
 // This ensures the cache is up-to-date with the source of truth.
 // Critical: We must preserve the exact IDs from disk to maintain consistency.
+// With a lazy cache nothing is loaded up front; rows are copied in as they
+// are read (see getWithCacheFallback). Either way the warm-up is recorded in
+// the cache stats.
 //
 // Encryption handling:
 // - Private notes are stored encrypted on disk (body + encryption_iv)
 // - When syncing to cache, we decrypt the body so cache has plaintext
 // - This enables fast reads from cache without decryption overhead
+// - Compressed bodies (body_compressed) are likewise decompressed for the cache
 func syncCacheFromDisk() error {
+	startedAt := time.Now()
+	if lazyCache.Load() {
+		resetCachedUsers()
+		recordCacheWarmup(0, 0, 0, time.Since(startedAt))
+		logger.Info("Lazy cache enabled; cache will be populated on demand")
+		return nil
+	}
+
 	// Query all notes from disk (including soft-deleted ones for complete sync)
-	// Note: authored_at is read from disk but NOT inserted into cache (cache schema lacks it)
+	count, err := loadNotesIntoCache("")
+	if err != nil {
+		return err
+	}
+
+	// Note: Sequence syncing is not needed for the cache since all inserts
+	// use explicit IDs from the disk database (source of truth)
+
+	logger.Info("Cache synchronized from disk", "notes_count", count)
+
+	// Sync categories
+	categoriesCount, err := syncCategoriesFromDisk()
+	if err != nil {
+		return serr.Wrap(err, "failed to sync categories from disk")
+	}
+	logger.Info("Categories synchronized from disk", "categories_count", categoriesCount)
+
+	// Sync note_categories relationships
+	noteCategoriesCount, err := syncNoteCategoriesFromDisk()
+	if err != nil {
+		return serr.Wrap(err, "failed to sync note_categories from disk")
+	}
+	logger.Info("Note-category relationships synchronized from disk", "relationships_count", noteCategoriesCount)
+
+	duration := time.Since(startedAt)
+	recordCacheWarmup(count, categoriesCount, noteCategoriesCount, duration)
+	logger.Info("Cache warm-up complete", "duration_ms", duration.Milliseconds())
+
+	return nil
+}
+
+// loadNotesIntoCache copies the disk notes selected by where (a WHERE clause
+// over notes, or "" for all) into the cache, preserving their IDs. Notes
+// already cached are left as they are. Returns the number copied.
+// Note: authored_at is read from disk but NOT inserted into cache (cache schema lacks it)
+func loadNotesIntoCache(where string, args ...any) (int, error) {
 	query := `
-		SELECT id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
-		       created_by, updated_by, created_at, updated_at, authored_at, synced_at, deleted_at
+		SELECT id, guid, title, description, body, body_compressed, tags, is_private, is_flagged, starred, encryption_iv,
+		       created_by, updated_by, created_at, updated_at, authored_at, synced_at, deleted_at,
+		       COALESCE(view_count, 0)
 		FROM notes
-	`
+	` + where
 
-	rows, err := db.Query(query)
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return serr.Wrap(err, "failed to query notes from disk")
+		return 0, serr.Wrap(err, "failed to query notes from disk")
 	}
 	defer rows.Close()
 
 	// Insert each note into cache preserving the ID
 	// Note: cache schema does not include authored_at column
 	insertQuery := `
-		INSERT INTO notes (id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
-		                   created_by, updated_by, created_at, updated_at, synced_at, deleted_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO notes (id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
+		                   created_by, updated_by, created_at, updated_at, synced_at, deleted_at, view_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
 	`
 
 	count := 0
 	for rows.Next() {
 		var note Note
+		var bodyCompressed bool
+		var viewCount int64
 
 		err := rows.Scan(
-			&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
-			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.EncryptionIV, &note.CreatedBy,
+			&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body, &bodyCompressed,
+			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
 			&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.AuthoredAt, &note.SyncedAt, &note.DeletedAt,
+			&viewCount,
 		)
 		if err != nil {
-			return serr.Wrap(err, "failed to scan note from disk")
+			return 0, serr.Wrap(err, "failed to scan note from disk")
 		}
 
-		// For private notes with encryption enabled, decrypt the body before caching
+		// Decrypt private notes and decompress large bodies before caching
 		// This keeps the cache in plaintext for fast reads
-		cacheBody := note.Body
-		if note.IsPrivate && IsEncryptionEnabled() && note.Body.Valid && note.EncryptionIV.Valid {
-			decryptedBody, err := DecryptNoteBody(note.Body.String, note.EncryptionIV.String)
-			if err != nil {
-				// Log error but continue - corrupted notes shouldn't block entire sync
-				// The note will have encrypted body in cache (readable but garbled)
-				logger.LogErr(err, "failed to decrypt private note body during cache sync",
-					"note_id", note.ID, "guid", note.GUID)
-			} else {
-				cacheBody = sql.NullString{String: decryptedBody, Valid: true}
-			}
+		if err := decodeDiskBody(&note, bodyCompressed); err != nil {
+			// Log error but continue - corrupted notes shouldn't block entire sync
+			// The note will have its stored body in cache (readable but garbled)
+			logger.LogErr(err, "failed to decode note body during cache sync",
+				"note_id", note.ID, "guid", note.GUID)
 		}
 
-		_, err = cacheDB.Exec(insertQuery,
-			note.ID, note.GUID, note.Title, note.Description, cacheBody,
-			note.Tags, note.IsPrivate, note.IsFlagged, note.EncryptionIV, note.CreatedBy,
-			note.UpdatedBy, note.CreatedAt, note.UpdatedAt, note.SyncedAt, note.DeletedAt,
+		result, err := cacheDB.Exec(insertQuery,
+			note.ID, note.GUID, note.Title, note.Description, note.Body,
+			note.Tags, note.IsPrivate, note.IsFlagged, note.Starred, note.EncryptionIV, note.CreatedBy,
+			note.UpdatedBy, note.CreatedAt, note.UpdatedAt, note.SyncedAt, note.DeletedAt, viewCount,
 		)
 		if err != nil {
-			return serr.Wrap(err, "failed to insert note into cache")
+			return 0, serr.Wrap(err, "failed to insert note into cache")
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			count++
 		}
-		count++
 	}
 
 	if err = rows.Err(); err != nil {
-		return serr.Wrap(err, "error iterating notes from disk")
-	}
-
-	// Note: Sequence syncing is not needed for the cache since all inserts
-	// use explicit IDs from the disk database (source of truth)
-
-	logger.Info("Cache synchronized from disk", "notes_count", count)
-
-	// Sync categories
-	categoriesCount, err := syncCategoriesFromDisk()
-	if err != nil {
-		return serr.Wrap(err, "failed to sync categories from disk")
+		return 0, serr.Wrap(err, "error iterating notes from disk")
 	}
-	logger.Info("Categories synchronized from disk", "categories_count", categoriesCount)
 
-	// Sync note_categories relationships
-	noteCategoriesCount, err := syncNoteCategoriesFromDisk()
-	if err != nil {
-		return serr.Wrap(err, "failed to sync note_categories from disk")
-	}
-	logger.Info("Note-category relationships synchronized from disk", "relationships_count", noteCategoriesCount)
-
-	return nil
+	return count, nil
 }
 
 // syncCategoriesFromDisk loads all categories from the disk database into the cache.
 func syncCategoriesFromDisk() (int, error) {
+	return loadCategoriesIntoCache("")
+}
+
+// loadCategoriesIntoCache copies the disk categories selected by where (a
+// WHERE clause over categories, or "" for all) into the cache. Categories
+// already cached are left as they are. Returns the number copied.
+func loadCategoriesIntoCache(where string, args ...any) (int, error) {
 	query := `
 		SELECT id, guid, name, description, subcategories, created_by, created_at, updated_at
 		FROM categories
-	`
+	` + where
 
-	rows, err := db.Query(query)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return 0, serr.Wrap(err, "failed to query categories from disk")
 	}
@@ -512,6 +793,7 @@ func syncCategoriesFromDisk() (int, error) {
 	insertQuery := `
 		INSERT INTO categories (id, guid, name, description, subcategories, created_by, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
 	`
 
 	count := 0
@@ -526,14 +808,16 @@ func syncCategoriesFromDisk() (int, error) {
 			return 0, serr.Wrap(err, "failed to scan category from disk")
 		}
 
-		_, err = cacheDB.Exec(insertQuery,
+		result, err := cacheDB.Exec(insertQuery,
 			category.ID, category.GUID, category.Name, category.Description,
 			category.Subcategories, category.CreatedBy, category.CreatedAt, category.UpdatedAt,
 		)
 		if err != nil {
 			return 0, serr.Wrap(err, "failed to insert category into cache")
 		}
-		count++
+		if n, _ := result.RowsAffected(); n > 0 {
+			count++
+		}
 	}
 
 	if err = rows.Err(); err != nil {
@@ -546,12 +830,20 @@ func syncCategoriesFromDisk() (int, error) {
 // syncNoteCategoriesFromDisk loads all note-category relationships from the disk database into the cache.
 // Includes the subcategories JSON array column for category/subcategory filtering.
 func syncNoteCategoriesFromDisk() (int, error) {
+	return loadNoteCategoriesIntoCache("")
+}
+
+// loadNoteCategoriesIntoCache copies the disk note-category relationships
+// selected by where (a WHERE clause over note_categories, or "" for all) into
+// the cache. Both the note and the category must already be cached.
+// Relationships already cached are left as they are. Returns the number copied.
+func loadNoteCategoriesIntoCache(where string, args ...any) (int, error) {
 	query := `
 		SELECT note_id, category_id, subcategories, created_at
 		FROM note_categories
-	`
+	` + where
 
-	rows, err := db.Query(query)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return 0, serr.Wrap(err, "failed to query note_categories from disk")
 	}
@@ -560,6 +852,7 @@ func syncNoteCategoriesFromDisk() (int, error) {
 	insertQuery := `
 		INSERT INTO note_categories (note_id, category_id, subcategories, created_at)
 		VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
 	`
 
 	count := 0
@@ -573,13 +866,15 @@ func syncNoteCategoriesFromDisk() (int, error) {
 			return 0, serr.Wrap(err, "failed to scan note_category from disk")
 		}
 
-		_, err = cacheDB.Exec(insertQuery,
+		result, err := cacheDB.Exec(insertQuery,
 			noteCategory.NoteID, noteCategory.CategoryID, noteCategory.Subcategories, noteCategory.CreatedAt,
 		)
 		if err != nil {
 			return 0, serr.Wrap(err, "failed to insert note_category into cache")
 		}
-		count++
+		if n, _ := result.RowsAffected(); n > 0 {
+			count++
+		}
 	}
 
 	if err = rows.Err(); err != nil {
@@ -595,11 +890,13 @@ func syncNoteCategoriesFromDisk() (int, error) {
 // Also initializes the in-memory cache for testing.
 func InitTestDB(path string) error {
 	var err error
+	dbReady.Store(false)
 
 	db, err = sql.Open("duckdb", path)
 	if err != nil {
 		return serr.Wrap(err, "failed to open test DuckDB connection")
 	}
+	dbPath = path
 
 	if err = db.Ping(); err != nil {
 		return serr.Wrap(err, "failed to ping test DuckDB")
@@ -609,15 +906,21 @@ func InitTestDB(path string) error {
 		return serr.Wrap(err, "failed to create test tables")
 	}
 
+	if err = RunMigrations(); err != nil {
+		return serr.Wrap(err, "failed to run test schema migrations")
+	}
+
 	// Initialize cache for tests
 	if err = initCacheDB(); err != nil {
 		return serr.Wrap(err, "failed to initialize test cache database")
 	}
+	setLazyCache(false)
 
 	// Sync cache with disk (which should be empty for new tests)
 	if err = syncCacheFromDisk(); err != nil {
 		return serr.Wrap(err, "failed to sync test cache from disk")
 	}
 
+	dbReady.Store(true)
 	return nil
 }
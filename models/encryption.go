@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"os"
+	"sync"
 
 	"github.com/rohanthewiz/serr"
 )
@@ -13,7 +14,12 @@ import (
 // encryptionKey holds the AES-256 key loaded from the environment.
 // Must be exactly 32 bytes for AES-256. Using a package-level variable
 // allows one-time initialization at startup and efficient reuse.
-var encryptionKey []byte
+// encryptionKeyMu guards it, since RotateEncryptionKey replaces the key while
+// the server runs.
+var (
+	encryptionKey   []byte
+	encryptionKeyMu sync.RWMutex
+)
 
 // EncryptionKeyEnvVar is the environment variable name for the encryption key.
 // The key should be a 32-character string (256 bits) for AES-256 encryption.
@@ -38,20 +44,31 @@ func InitEncryption() error {
 		return serr.New("encryption key must be exactly 32 characters for AES-256, got " + string(rune(len(keyStr))))
 	}
 
+	encryptionKeyMu.Lock()
 	encryptionKey = []byte(keyStr)
+	encryptionKeyMu.Unlock()
 	return nil
 }
 
 // IsEncryptionEnabled returns true if the encryption key has been initialized.
 // This allows graceful handling when encryption is not configured.
 func IsEncryptionEnabled() bool {
-	return len(encryptionKey) == 32
+	return len(currentEncryptionKey()) == 32
+}
+
+// currentEncryptionKey returns the active encryption key, or nil if none.
+func currentEncryptionKey() []byte {
+	encryptionKeyMu.RLock()
+	defer encryptionKeyMu.RUnlock()
+	return encryptionKey
 }
 
 // ResetEncryption clears the encryption key. This is intended for testing only
 // to ensure proper test isolation between encryption tests.
 func ResetEncryption() {
+	encryptionKeyMu.Lock()
 	encryptionKey = nil
+	encryptionKeyMu.Unlock()
 }
 
 // Encrypt encrypts plaintext using AES-256-GCM and returns the ciphertext
@@ -65,11 +82,16 @@ func ResetEncryption() {
 // A fresh random IV (nonce) is generated for each encryption operation,
 // which is critical for GCM security - never reuse an IV with the same key.
 func Encrypt(plaintext string) (ciphertext string, iv string, err error) {
-	if !IsEncryptionEnabled() {
+	key := currentEncryptionKey()
+	if len(key) != 32 {
 		return "", "", serr.New("encryption not initialized: call InitEncryption first")
 	}
+	return encryptWithKey(key, plaintext)
+}
 
-	block, err := aes.NewCipher(encryptionKey)
+// encryptWithKey is Encrypt with an explicit key.
+func encryptWithKey(key []byte, plaintext string) (ciphertext string, iv string, err error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", "", serr.Wrap(err, "failed to create AES cipher")
 	}
@@ -107,10 +129,15 @@ func Encrypt(plaintext string) (ciphertext string, iv string, err error) {
 // - The ciphertext was tampered with (GCM authentication fails)
 // - The IV doesn't match the one used for encryption
 func Decrypt(ciphertext string, iv string) (plaintext string, err error) {
-	if !IsEncryptionEnabled() {
+	key := currentEncryptionKey()
+	if len(key) != 32 {
 		return "", serr.New("encryption not initialized: call InitEncryption first")
 	}
+	return decryptWithKey(key, ciphertext, iv)
+}
 
+// decryptWithKey is Decrypt with an explicit key.
+func decryptWithKey(key []byte, ciphertext string, iv string) (plaintext string, err error) {
 	// Decode base64-encoded inputs
 	ciphertextBytes, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
@@ -122,7 +149,7 @@ func Decrypt(ciphertext string, iv string) (plaintext string, err error) {
 		return "", serr.Wrap(err, "failed to decode IV from base64")
 	}
 
-	block, err := aes.NewCipher(encryptionKey)
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", serr.Wrap(err, "failed to create AES cipher")
 	}
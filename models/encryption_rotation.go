@@ -0,0 +1,143 @@
+package models
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Encryption Key Rotation
+//
+// RotateEncryptionKey re-encrypts every encrypted private note body on disk
+// under a new key, each with a fresh IV, then makes the new key the active
+// one — no restart or downtime needed. Only the disk copy is rewritten: the
+// cache holds plaintext bodies and just takes the new IVs. The rewrite is
+// one disk transaction (read in batches by id), so a failure part way —
+// a body that won't decrypt with the old key, say — leaves every note and
+// the active key as they were.
+//
+// The key lock is held throughout, so notes saved during a rotation wait and
+// are then encrypted with the new key. GONOTES_ENCRYPTION_KEY must be
+// changed to the new key before the next restart.
+// ============================================================================
+
+// keyRotationBatchSize is how many notes are read per query while rotating.
+const keyRotationBatchSize = 100
+
+var (
+	// ErrInvalidEncryptionKey is returned for a rotation key that isn't 32
+	// bytes, or a new key equal to the old.
+	ErrInvalidEncryptionKey = errors.New("encryption key must be exactly 32 characters for AES-256")
+	// ErrEncryptionKeyMismatch is returned when the old key given for a
+	// rotation isn't the active key.
+	ErrEncryptionKeyMismatch = errors.New("old encryption key does not match the active key")
+)
+
+// rotatedNote is one note body re-encrypted under the new key.
+type rotatedNote struct {
+	id   int64
+	body string
+	iv   string
+}
+
+// RotateEncryptionKey re-encrypts all encrypted note bodies from oldKey,
+// which must be the active key, to newKey, and makes newKey active. Returns
+// the number of notes re-encrypted.
+func RotateEncryptionKey(oldKey, newKey []byte) (int, error) {
+	if len(oldKey) != 32 || len(newKey) != 32 || subtle.ConstantTimeCompare(oldKey, newKey) == 1 {
+		return 0, ErrInvalidEncryptionKey
+	}
+
+	encryptionKeyMu.Lock()
+	defer encryptionKeyMu.Unlock()
+
+	if len(encryptionKey) != 32 {
+		return 0, serr.New("encryption not initialized: call InitEncryption first")
+	}
+	if subtle.ConstantTimeCompare(oldKey, encryptionKey) != 1 {
+		return 0, ErrEncryptionKeyMismatch
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, serr.Wrap(err, "failed to begin key rotation")
+	}
+	defer tx.Rollback()
+
+	var rotated []rotatedNote
+	var lastID int64
+	for {
+		batch, err := reencryptNoteBatch(tx, lastID, oldKey, newKey)
+		if err != nil {
+			return 0, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, n := range batch {
+			if _, err := tx.Exec(`UPDATE notes SET body = ?, encryption_iv = ? WHERE id = ?`,
+				n.body, n.iv, n.id); err != nil {
+				return 0, serr.Wrap(err, "failed to save re-encrypted note", "note_id", strconv.FormatInt(n.id, 10))
+			}
+		}
+		rotated = append(rotated, batch...)
+		lastID = batch[len(batch)-1].id
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, serr.Wrap(err, "failed to commit key rotation")
+	}
+	encryptionKey = append([]byte(nil), newKey...)
+
+	// The cache's bodies are plaintext; only its copy of the IV changes
+	for _, n := range rotated {
+		if _, err := cacheDB.Exec(`UPDATE notes SET encryption_iv = ? WHERE id = ?`, n.iv, n.id); err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to update cached encryption IV"),
+				"note_id", strconv.FormatInt(n.id, 10))
+		}
+	}
+
+	logger.Info("Encryption key rotated", "notes", len(rotated))
+	return len(rotated), nil
+}
+
+// reencryptNoteBatch reads up to keyRotationBatchSize encrypted notes with
+// ids above afterID and re-encrypts their bodies from oldKey to newKey.
+// Bodies are re-encrypted as stored, so compressed bodies stay compressed.
+func reencryptNoteBatch(tx *sql.Tx, afterID int64, oldKey, newKey []byte) ([]rotatedNote, error) {
+	rows, err := tx.Query(`
+		SELECT id, body, encryption_iv FROM notes
+		WHERE is_private AND encryption_iv IS NOT NULL AND encryption_iv <> ''
+		  AND body IS NOT NULL AND body <> '' AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`, afterID, keyRotationBatchSize)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to query encrypted notes")
+	}
+	defer rows.Close()
+
+	var batch []rotatedNote
+	for rows.Next() {
+		var n rotatedNote
+		var oldBody, oldIV string
+		if err := rows.Scan(&n.id, &oldBody, &oldIV); err != nil {
+			return nil, serr.Wrap(err, "failed to scan encrypted note")
+		}
+
+		plaintext, err := decryptWithKey(oldKey, oldBody, oldIV)
+		if err != nil {
+			return nil, serr.Wrap(err, "failed to decrypt note with the old key", "note_id", strconv.FormatInt(n.id, 10))
+		}
+		if n.body, n.iv, err = encryptWithKey(newKey, plaintext); err != nil {
+			return nil, serr.Wrap(err, "failed to encrypt note with the new key", "note_id", strconv.FormatInt(n.id, 10))
+		}
+		batch = append(batch, n)
+	}
+	return batch, rows.Err()
+}
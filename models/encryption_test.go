@@ -2,7 +2,9 @@ package models_test
 
 import (
 	"database/sql"
+	"errors"
 	"os"
+	"strings"
 	"testing"
 
 	"gonotes/models"
@@ -451,6 +453,129 @@ func TestCacheSyncDecryptsOnRestart(t *testing.T) {
 	}
 }
 
+// TestCompressedPrivateNote verifies that a large private body is compressed
+// before being encrypted, and decodes back to the original after a restart.
+func TestCompressedPrivateNote(t *testing.T) {
+	cleanup := setupEncryptionTestDB(t)
+	defer cleanup()
+	t.Setenv(models.BodyCompressionThresholdEnvVar, "256")
+
+	body := strings.Repeat("Secret, repetitive, and compressible. ", 200)
+	note, err := models.CreateNote(models.NoteInput{
+		GUID: "enc-compress-001", Title: "Compressed Secret", Body: &body, IsPrivate: true,
+	}, encTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	diskBody, iv := readNoteDirectFromDisk(t, note.ID)
+	if iv == "" {
+		t.Error("private note should have an IV on disk")
+	}
+	if len(diskBody) >= len(body) {
+		t.Errorf("encrypted compressed body is %d bytes on disk, want fewer than %d", len(diskBody), len(body))
+	}
+
+	if err := models.RebuildCache(); err != nil {
+		t.Fatalf("RebuildCache failed: %v", err)
+	}
+	got, err := models.GetNoteByID(note.ID, encTestUserGUID)
+	if err != nil || got == nil {
+		t.Fatalf("failed to get note: %v", err)
+	}
+	if got.Body.String != body {
+		t.Error("private body is not byte-identical after compression and encryption round trip")
+	}
+}
+
+// TestRotateEncryptionKey verifies that rotating the key re-encrypts private
+// bodies (compressed or not) so only the new key opens them, leaves public
+// notes alone, and keeps the plaintext intact through a cache rebuild.
+func TestRotateEncryptionKey(t *testing.T) {
+	cleanup := setupEncryptionTestDB(t)
+	defer cleanup()
+	t.Setenv(models.BodyCompressionThresholdEnvVar, "256")
+
+	const oldKey = "12345678901234567890123456789012"
+	const newKey = "abcdefghijklmnopqrstuvwxyz012345"
+
+	bodies := map[string]string{
+		"enc-rotate-small": "A small secret",
+		"enc-rotate-large": strings.Repeat("A large, compressible secret. ", 100),
+	}
+	ids := map[string]int64{}
+	for guid, body := range bodies {
+		note, err := models.CreateNote(models.NoteInput{GUID: guid, Title: guid, Body: &body, IsPrivate: true}, encTestUserGUID)
+		if err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+		ids[guid] = note.ID
+	}
+	publicBody := "Not a secret"
+	public, err := models.CreateNote(models.NoteInput{GUID: "enc-rotate-public", Title: "Public", Body: &publicBody}, encTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	_, smallIV := readNoteDirectFromDisk(t, ids["enc-rotate-small"])
+
+	if _, err := models.RotateEncryptionKey([]byte(newKey), []byte(newKey)); !errors.Is(err, models.ErrInvalidEncryptionKey) {
+		t.Errorf("expected ErrInvalidEncryptionKey for identical keys, got %v", err)
+	}
+	if _, err := models.RotateEncryptionKey([]byte(newKey), []byte(oldKey)); !errors.Is(err, models.ErrEncryptionKeyMismatch) {
+		t.Errorf("expected ErrEncryptionKeyMismatch for a wrong old key, got %v", err)
+	}
+
+	count, err := models.RotateEncryptionKey([]byte(oldKey), []byte(newKey))
+	if err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 notes re-encrypted, got %d", count)
+	}
+
+	// The active key is now the new one, and each body has a fresh IV
+	for guid, id := range ids {
+		diskBody, iv := readNoteDirectFromDisk(t, id)
+		if _, err := models.Decrypt(diskBody, iv); err != nil {
+			t.Errorf("%s: disk body doesn't decrypt with the new key: %v", guid, err)
+		}
+	}
+	if _, iv := readNoteDirectFromDisk(t, ids["enc-rotate-small"]); iv == smallIV {
+		t.Error("expected a fresh IV after rotation")
+	}
+	if diskBody, _ := readNoteDirectFromDisk(t, public.ID); diskBody != publicBody {
+		t.Errorf("public note body changed on disk: %q", diskBody)
+	}
+
+	// The old key no longer opens them
+	os.Setenv("GONOTES_ENCRYPTION_KEY", oldKey)
+	if err := models.InitEncryption(); err != nil {
+		t.Fatalf("failed to initialize encryption: %v", err)
+	}
+	diskBody, iv := readNoteDirectFromDisk(t, ids["enc-rotate-small"])
+	if _, err := models.Decrypt(diskBody, iv); err == nil {
+		t.Error("expected the old key to fail after rotation")
+	}
+
+	// A restart with the new key reads back the original plaintext
+	os.Setenv("GONOTES_ENCRYPTION_KEY", newKey)
+	if err := models.InitEncryption(); err != nil {
+		t.Fatalf("failed to initialize encryption: %v", err)
+	}
+	if err := models.RebuildCache(); err != nil {
+		t.Fatalf("RebuildCache failed: %v", err)
+	}
+	for guid, body := range bodies {
+		got, err := models.GetNoteByID(ids[guid], encTestUserGUID)
+		if err != nil || got == nil {
+			t.Fatalf("failed to get note: %v", err)
+		}
+		if got.Body.String != body {
+			t.Errorf("%s: body not intact after rotation", guid)
+		}
+	}
+}
+
 // TestEncryptionNotInitialized verifies proper error handling when encryption
 // is not initialized
 func TestEncryptionNotInitialized(t *testing.T) {
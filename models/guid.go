@@ -0,0 +1,52 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// GUID Format
+//
+// Note GUIDs are chosen by the client, so they are checked when a note is
+// created: after NormalizeGUID, a GUID must be 1-64 characters of lowercase
+// ASCII letters, digits, '-', '_' or '.', starting with a letter or digit.
+// Canonical UUIDs (what the web UI generates) always qualify, and a create
+// that leaves the GUID empty gets one from NewNoteGUID. GUIDs pass
+// through sync and URLs verbatim, so this keeps out whitespace, case
+// variants of the same ID, and characters that need escaping. Only creation
+// is checked — notes already stored with other GUIDs, and notes arriving
+// via sync from older peers, remain readable and addressable as-is.
+// ============================================================================
+
+// MaxGUIDLength is the longest GUID ValidateGUID accepts.
+const MaxGUIDLength = 64
+
+// ErrInvalidGUID is returned by ValidateGUID for a malformed GUID.
+var ErrInvalidGUID = errors.New("guid must be 1-64 lowercase letters, digits, '-', '_' or '.', starting with a letter or digit (e.g. a UUID)")
+
+var guidPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// NormalizeGUID trims surrounding whitespace and lowercases s, so that
+// "  3F2A...  " and "3f2a..." name the same note.
+func NormalizeGUID(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// ValidateGUID reports whether s is a GUID in the accepted format. It does
+// not normalize; callers normalize first.
+func ValidateGUID(s string) error {
+	if len(s) > MaxGUIDLength || !guidPattern.MatchString(s) {
+		return ErrInvalidGUID
+	}
+	return nil
+}
+
+// NewNoteGUID returns a GUID for a note created without one: a random UUID,
+// like those the web UI generates.
+func NewNoteGUID() string {
+	return uuid.New().String()
+}
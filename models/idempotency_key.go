@@ -0,0 +1,84 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Idempotency Keys
+//
+// A client that times out on POST /api/v1/notes can't tell whether the note
+// was created. Sending an Idempotency-Key header lets it retry safely: the
+// first request records the key against the note it created along with the
+// response it was sent, and a repeat of the key within IdempotencyKeyTTL is
+// answered with that same response instead of creating another note. Keys
+// are scoped per user so one user's key can't reveal another's note. Disk
+// only — the table is small and read once per keyed request.
+// ============================================================================
+
+// IdempotencyKeyHeader is the request header carrying the client's key.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyKeyTTL is how long a processed key is remembered.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// DDL for idempotency_keys table — maps a user's key to the note it created
+const DDLCreateIdempotencyKeysTable = `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idem_key   VARCHAR NOT NULL,
+    user_guid  VARCHAR NOT NULL,
+    note_id    BIGINT NOT NULL,
+    response   VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (idem_key, user_guid)
+);
+`
+
+// IdempotentResponse is what a processed key resolves to.
+type IdempotentResponse struct {
+	NoteID   int64
+	Response []byte // JSON response data sent for the original request
+}
+
+// LookupIdempotencyKey returns the recorded response for the user's key.
+// Returns nil if the key is unknown or has expired.
+func LookupIdempotencyKey(key, userGUID string) (*IdempotentResponse, error) {
+	var resp IdempotentResponse
+	var body string
+	err := db.QueryRow(`
+		SELECT note_id, response FROM idempotency_keys
+		WHERE idem_key = ? AND user_guid = ? AND created_at > ?
+	`, key, userGUID, time.Now().Add(-IdempotencyKeyTTL)).Scan(&resp.NoteID, &body)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to look up idempotency key")
+	}
+	resp.Response = []byte(body)
+	return &resp, nil
+}
+
+// SaveIdempotencyKey records that the user's key produced noteID and the given
+// response. Expired keys are swept on each save so the table doesn't grow
+// without bound.
+func SaveIdempotencyKey(key, userGUID string, noteID int64, response []byte) error {
+	now := time.Now()
+	if _, err := db.Exec(`DELETE FROM idempotency_keys WHERE created_at <= ?`, now.Add(-IdempotencyKeyTTL)); err != nil {
+		return serr.Wrap(err, "failed to purge expired idempotency keys")
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO idempotency_keys (idem_key, user_guid, note_id, response, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (idem_key, user_guid) DO UPDATE
+		SET note_id = excluded.note_id, response = excluded.response, created_at = excluded.created_at
+	`, key, userGUID, noteID, string(response), now)
+	if err != nil {
+		return serr.Wrap(err, "failed to save idempotency key")
+	}
+	return nil
+}
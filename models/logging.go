@@ -0,0 +1,68 @@
+package models
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rohanthewiz/logger"
+)
+
+// ============================================================================
+// Logging Configuration
+//
+// The log level and output format are read from the environment once at
+// startup by ConfigureLogging. Debug logging that runs on every request (and
+// builds its fields eagerly) checks DebugLoggingEnabled first, so at the
+// default info level it costs nothing.
+// ============================================================================
+
+// LogLevelEnvVar sets the minimum level logged: debug, info, warn, or error.
+const LogLevelEnvVar = "GONOTES_LOG_LEVEL"
+
+// LogFormatEnvVar sets the log output format: text or json.
+const LogFormatEnvVar = "GONOTES_LOG_FORMAT"
+
+// Defaults used when the variables are unset or invalid
+const (
+	DefaultLogLevel  = "info"
+	DefaultLogFormat = "text"
+)
+
+// debugLogging records whether the configured level is debug.
+var debugLogging atomic.Bool
+
+// ConfigureLogging applies GONOTES_LOG_LEVEL and GONOTES_LOG_FORMAT to the
+// logger. Invalid values are logged and replaced by the defaults.
+func ConfigureLogging() {
+	level := strings.ToLower(os.Getenv(LogLevelEnvVar))
+	switch level {
+	case "":
+		level = DefaultLogLevel
+	case "warning":
+		level = "warn"
+	case "debug", "info", "warn", "error":
+	default:
+		logger.Warn("Ignoring invalid "+LogLevelEnvVar, "value", level)
+		level = DefaultLogLevel
+	}
+
+	format := strings.ToLower(os.Getenv(LogFormatEnvVar))
+	switch format {
+	case "":
+		format = DefaultLogFormat
+	case "text", "json":
+	default:
+		logger.Warn("Ignoring invalid "+LogFormatEnvVar, "value", format)
+		format = DefaultLogFormat
+	}
+
+	logger.SetLogFormat(format)
+	logger.SetLogLevel(level)
+	debugLogging.Store(level == "debug")
+}
+
+// DebugLoggingEnabled reports whether debug-level messages are being logged.
+func DebugLoggingEnabled() bool {
+	return debugLogging.Load()
+}
@@ -0,0 +1,27 @@
+package models
+
+import "testing"
+
+// TestConfigureLogging verifies that GONOTES_LOG_LEVEL decides whether debug
+// logging is enabled, with invalid values falling back to info.
+func TestConfigureLogging(t *testing.T) {
+	t.Cleanup(ConfigureLogging) // Runs after the env is restored, for other tests
+
+	for _, tc := range []struct {
+		level, format string
+		debug         bool
+	}{
+		{"", "", false},
+		{"info", "json", false},
+		{"DEBUG", "text", true},
+		{"warning", "", false},
+		{"verbose", "yaml", false},
+	} {
+		t.Setenv(LogLevelEnvVar, tc.level)
+		t.Setenv(LogFormatEnvVar, tc.format)
+		ConfigureLogging()
+		if got := DebugLoggingEnabled(); got != tc.debug {
+			t.Errorf("level %q: expected debug logging %v, got %v", tc.level, tc.debug, got)
+		}
+	}
+}
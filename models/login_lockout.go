@@ -0,0 +1,207 @@
+package models
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rohanthewiz/logger"
+)
+
+// ============================================================================
+// Login Lockout
+//
+// Guards password login against guessing. Failed attempts are counted per
+// username; after LoginLockoutThreshold consecutive failures the username is
+// locked out, and every login for it is refused (even with the right
+// password) until the lockout expires. Each further lockout without a
+// successful login in between lasts twice as long as the one before, up to
+// maxLoginLockout. A successful login clears the record.
+//
+// Each attempt is counted as a failure when it starts (ReserveLoginAttempt),
+// under the same lock as the lockout check, and rolled back if the password
+// turns out to be right. Counting only after the slow password check would
+// let any number of concurrent guesses pass the check at once.
+//
+// State is in memory: it doesn't survive a restart and isn't shared across
+// instances, which is enough to make online guessing impractical. Unknown
+// usernames are tracked like real ones so a lockout doesn't reveal which
+// accounts exist.
+// ============================================================================
+
+// LoginLockoutThresholdEnvVar sets how many consecutive failed logins lock a
+// username out. Unset or invalid means DefaultLoginLockoutThreshold; zero
+// disables lockout.
+const LoginLockoutThresholdEnvVar = "GONOTES_LOGIN_LOCKOUT_THRESHOLD"
+
+// LoginLockoutDurationEnvVar sets the first lockout's duration, as a Go
+// duration such as "1m". Unset or invalid means DefaultLoginLockoutDuration.
+const LoginLockoutDurationEnvVar = "GONOTES_LOGIN_LOCKOUT_DURATION"
+
+// Lockout defaults, used when the environment doesn't override them.
+const (
+	DefaultLoginLockoutThreshold = 5
+	DefaultLoginLockoutDuration  = time.Minute
+)
+
+// maxLoginLockout caps the doubling lockout duration. Records idle for this
+// long are also dropped, so the table doesn't grow with every name tried.
+const maxLoginLockout = 24 * time.Hour
+
+// loginAttempts is the lockout record for one username.
+type loginAttempts struct {
+	failures    int       // Consecutive failures since the last lockout or success
+	lockouts    int       // Consecutive lockouts since the last success
+	lockedUntil time.Time // Zero when not locked out
+	lastFailure time.Time
+}
+
+var loginLockouts = struct {
+	sync.Mutex
+	byUsername map[string]*loginAttempts
+}{byUsername: make(map[string]*loginAttempts)}
+
+// LoginLockoutThreshold returns the configured number of failures that
+// triggers a lockout, or zero if lockout is disabled.
+func LoginLockoutThreshold() int {
+	thresholdStr := os.Getenv(LoginLockoutThresholdEnvVar)
+	if thresholdStr == "" {
+		return DefaultLoginLockoutThreshold
+	}
+	threshold, err := strconv.Atoi(thresholdStr)
+	if err != nil || threshold < 0 {
+		logger.Warn("Ignoring invalid "+LoginLockoutThresholdEnvVar, "value", thresholdStr)
+		return DefaultLoginLockoutThreshold
+	}
+	return threshold
+}
+
+// LoginLockoutDuration returns the configured duration of a first lockout.
+func LoginLockoutDuration() time.Duration {
+	durationStr := os.Getenv(LoginLockoutDurationEnvVar)
+	if durationStr == "" {
+		return DefaultLoginLockoutDuration
+	}
+	d, err := time.ParseDuration(durationStr)
+	if err != nil || d <= 0 {
+		logger.Warn("Ignoring invalid "+LoginLockoutDurationEnvVar, "value", durationStr)
+		return DefaultLoginLockoutDuration
+	}
+	return d
+}
+
+// LoginReservation is a login attempt already counted as a failure against
+// its username (see ReserveLoginAttempt). Report its outcome with Failed,
+// Succeeded, or Cancel.
+type LoginReservation struct {
+	username string
+	record   *loginAttempts // nil when lockout is disabled
+	lockouts int            // record.lockouts once this attempt was counted
+	lockout  time.Duration  // Lockout this attempt triggered, or zero
+}
+
+// ReserveLoginAttempt starts a login attempt for username. If the username
+// is locked out it returns nil and how much longer the lockout lasts.
+// Otherwise it counts the attempt as a failure before the password is
+// checked, locking the username out if that reaches the threshold (this
+// attempt still gets its password checked), and returns the reservation.
+func ReserveLoginAttempt(username string) (*LoginReservation, time.Duration) {
+	threshold := LoginLockoutThreshold()
+
+	loginLockouts.Lock()
+	defer loginLockouts.Unlock()
+
+	now := time.Now()
+	if a, ok := loginLockouts.byUsername[username]; ok {
+		if remaining := a.lockedUntil.Sub(now); remaining > 0 {
+			return nil, remaining
+		}
+	}
+	if threshold == 0 {
+		return &LoginReservation{username: username}, 0
+	}
+
+	for name, a := range loginLockouts.byUsername {
+		if now.Sub(a.lastFailure) > maxLoginLockout && now.After(a.lockedUntil) {
+			delete(loginLockouts.byUsername, name)
+		}
+	}
+
+	a, ok := loginLockouts.byUsername[username]
+	if !ok {
+		a = &loginAttempts{}
+		loginLockouts.byUsername[username] = a
+	}
+	r := &LoginReservation{username: username, record: a}
+	a.lastFailure = now
+	a.failures++
+	if a.failures >= threshold {
+		// Lock out, doubling the duration for each consecutive lockout
+		lockout := LoginLockoutDuration()
+		for i := 0; i < a.lockouts && lockout < maxLoginLockout; i++ {
+			lockout *= 2
+		}
+		if lockout > maxLoginLockout {
+			lockout = maxLoginLockout
+		}
+		a.failures = 0
+		a.lockouts++
+		a.lockedUntil = now.Add(lockout)
+		r.lockout = lockout
+	}
+	r.lockouts = a.lockouts
+	return r, 0
+}
+
+// Failed records that the attempt's password was wrong. The attempt was
+// already counted; if counting it triggered a lockout, Failed logs it and
+// returns its duration, otherwise zero.
+func (r *LoginReservation) Failed() time.Duration {
+	if r.lockout > 0 {
+		logger.Warn("Login locked out after repeated failures",
+			"username", r.username, "lockout", r.lockout.String(), "consecutive_lockouts", r.lockouts)
+	}
+	return r.lockout
+}
+
+// Succeeded records a successful login, clearing the username's record.
+// A lockout another attempt triggered while this one ran is left in place.
+func (r *LoginReservation) Succeeded() {
+	if r.record == nil {
+		return
+	}
+	loginLockouts.Lock()
+	defer loginLockouts.Unlock()
+	if r.isCurrent() {
+		delete(loginLockouts.byUsername, r.username)
+	}
+}
+
+// Cancel withdraws an attempt that ended without a password check (e.g. a
+// database error), so it doesn't count as a failure. A lockout it triggered
+// stays.
+func (r *LoginReservation) Cancel() {
+	if r.record == nil || r.lockout > 0 {
+		return
+	}
+	loginLockouts.Lock()
+	defer loginLockouts.Unlock()
+	if r.isCurrent() && r.record.failures > 0 {
+		r.record.failures--
+	}
+}
+
+// isCurrent reports whether r's record is still the username's and no other
+// attempt has locked it out since r was counted. Callers hold loginLockouts.
+func (r *LoginReservation) isCurrent() bool {
+	return loginLockouts.byUsername[r.username] == r.record && r.record.lockouts == r.lockouts
+}
+
+// ResetLoginLockouts clears all lockout state. This is intended for testing
+// only, so that one test's failed logins can't lock out another's user.
+func ResetLoginLockouts() {
+	loginLockouts.Lock()
+	defer loginLockouts.Unlock()
+	loginLockouts.byUsername = make(map[string]*loginAttempts)
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Schema Migrations
+//
+// Tables are created with CREATE TABLE IF NOT EXISTS at startup, which can't
+// change a table that already exists. Schema changes go in migrations
+// instead: ordered, numbered steps that RunMigrations applies once each and
+// records in schema_migrations, so a database opened by a newer build is
+// brought up to date and later startups skip what it already has. Each
+// migration runs in a transaction with its record, so a failed step leaves
+// neither behind and is retried on the next startup.
+//
+// Migrations run after createTables, so they may assume every table exists.
+// They should still be idempotent (ADD COLUMN IF NOT EXISTS and the like),
+// since a database may already have the change from before it was tracked.
+// Only the disk schema is migrated: a column the cache mirrors must also be
+// added in initCacheDB, which builds the cache fresh on every start.
+// ============================================================================
+
+const DDLCreateSchemaMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INTEGER PRIMARY KEY,
+    name       VARCHAR NOT NULL,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// Migration is one schema change. Versions start at 1 and must increase
+// through the list; a released migration is never renumbered or edited.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+}
+
+// migrations is the ordered list RunMigrations applies. Append new
+// migrations at the end with the next version number.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "add notes.starred and note_fragments.starred",
+		Up: func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`ALTER TABLE notes ADD COLUMN IF NOT EXISTS starred BOOLEAN DEFAULT false`); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`ALTER TABLE note_fragments ADD COLUMN IF NOT EXISTS starred BOOLEAN`)
+			return err
+		},
+	},
+}
+
+// RunMigrations applies, in order, every migration the database hasn't
+// recorded yet.
+func RunMigrations() error {
+	return runMigrations(migrations)
+}
+
+// runMigrations applies the migrations in list that schema_migrations
+// doesn't have yet, recording each as it goes.
+func runMigrations(list []Migration) error {
+	if _, err := db.Exec(DDLCreateSchemaMigrationsTable); err != nil {
+		return serr.Wrap(err, "failed to create schema_migrations table")
+	}
+
+	applied, err := appliedMigrationVersions()
+	if err != nil {
+		return err
+	}
+
+	lastVersion := 0
+	for _, m := range list {
+		if m.Version <= lastVersion {
+			return serr.New("schema migrations are out of order", "version", strconv.Itoa(m.Version))
+		}
+		lastVersion = m.Version
+
+		if applied[m.Version] {
+			continue
+		}
+		if err := applyMigration(m); err != nil {
+			return err
+		}
+		logger.Info("Applied schema migration", "version", m.Version, "name", m.Name)
+	}
+	return nil
+}
+
+// applyMigration runs m and records it in one transaction.
+func applyMigration(m Migration) error {
+	version := strconv.Itoa(m.Version)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return serr.Wrap(err, "failed to begin schema migration", "version", version)
+	}
+	defer tx.Rollback()
+
+	if err := m.Up(tx); err != nil {
+		return serr.Wrap(err, "schema migration failed", "version", version, "name", m.Name)
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`,
+		m.Version, m.Name); err != nil {
+		return serr.Wrap(err, "failed to record schema migration", "version", version)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return serr.Wrap(err, "failed to commit schema migration", "version", version)
+	}
+	return nil
+}
+
+// appliedMigrationVersions returns the versions recorded in schema_migrations.
+func appliedMigrationVersions() (map[int]bool, error) {
+	rows, err := db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to query schema migrations")
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, serr.Wrap(err, "failed to scan schema migration")
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// SchemaVersion returns the highest migration version applied to the
+// database, or 0 if none has been.
+func SchemaVersion() (int, error) {
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, serr.Wrap(err, "failed to get schema version")
+	}
+	return int(version.Int64), nil
+}
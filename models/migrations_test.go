@@ -0,0 +1,83 @@
+package models
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+// TestRunMigrations verifies that a migration altering a table runs once, is
+// recorded, and is skipped when the database is opened again.
+func TestRunMigrations(t *testing.T) {
+	const path = "./test_migrations.ddb"
+	os.Remove(path)
+	os.Remove(path + ".wal")
+	defer func() {
+		CloseDB()
+		os.Remove(path)
+		os.Remove(path + ".wal")
+	}()
+
+	if err := InitTestDB(path); err != nil {
+		t.Fatalf("failed to initialize test database: %v", err)
+	}
+
+	// Number the test migration after the real ones InitTestDB applied
+	base, err := SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+
+	runs := 0
+	list := []Migration{{
+		Version: base + 1,
+		Name:    "add notes.test_color",
+		Up: func(tx *sql.Tx) error {
+			runs++
+			_, err := tx.Exec(`ALTER TABLE notes ADD COLUMN IF NOT EXISTS test_color VARCHAR`)
+			return err
+		},
+	}}
+
+	if err := runMigrations(list); err != nil {
+		t.Fatalf("runMigrations failed: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE notes SET test_color = 'red'`); err != nil {
+		t.Errorf("expected the migration to add test_color: %v", err)
+	}
+	if version, err := SchemaVersion(); err != nil || version != base+1 {
+		t.Errorf("expected schema version %d, got %d (err %v)", base+1, version, err)
+	}
+
+	// Reopen the database: the recorded migration is skipped
+	CloseDB()
+	if err := InitTestDB(path); err != nil {
+		t.Fatalf("failed to reopen test database: %v", err)
+	}
+	if err := runMigrations(list); err != nil {
+		t.Fatalf("runMigrations failed on reopen: %v", err)
+	}
+	if runs != 1 {
+		t.Errorf("expected the migration to run once, ran %d times", runs)
+	}
+
+	t.Run("out of order", func(t *testing.T) {
+		outOfOrder := []Migration{list[0], {Version: base + 1, Name: "duplicate", Up: list[0].Up}}
+		if err := runMigrations(outOfOrder); err == nil {
+			t.Error("expected an error for out-of-order migrations")
+		}
+	})
+
+	t.Run("failed migration is not recorded", func(t *testing.T) {
+		failing := append(list, Migration{Version: base + 2, Name: "bad", Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`ALTER TABLE no_such_table ADD COLUMN x VARCHAR`)
+			return err
+		}})
+		if err := runMigrations(failing); err == nil {
+			t.Fatal("expected the failing migration to return an error")
+		}
+		if version, _ := SchemaVersion(); version != base+1 {
+			t.Errorf("expected schema version to stay %d, got %d", base+1, version)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/base64"
+	"time"
 
 	"github.com/rohanthewiz/serr"
 	"github.com/vmihailenco/msgpack/v5"
@@ -30,22 +31,24 @@ type MsgPackBodyRequest struct {
 // MsgPackBodyResponse represents the JSON response format when msgpack encoding is used.
 // The body_encoded field contains Base64-encoded msgpack bytes instead of plain body.
 type MsgPackBodyResponse struct {
-	ID           int64   `json:"id"`
-	GUID         string  `json:"guid"`
-	Title        string  `json:"title"`
-	Description  *string `json:"description,omitempty"`
-	BodyEncoded  string  `json:"body_encoded"` // Base64-encoded msgpack bytes
-	Tags         *string `json:"tags,omitempty"`
-	IsPrivate    bool    `json:"is_private"`
-	IsFlagged    bool    `json:"is_flagged"`
-	EncryptionIV *string `json:"encryption_iv,omitempty"`
-	CreatedBy    *string `json:"created_by,omitempty"`
-	UpdatedBy    *string `json:"updated_by,omitempty"`
-	CreatedAt    string  `json:"created_at"`
-	UpdatedAt    string  `json:"updated_at"`
-	AuthoredAt   *string `json:"authored_at,omitempty"`
-	SyncedAt     *string `json:"synced_at,omitempty"`
-	DeletedAt    *string `json:"deleted_at,omitempty"`
+	ID            int64   `json:"id"`
+	GUID          string  `json:"guid"`
+	Title         string  `json:"title"`
+	Description   *string `json:"description,omitempty"`
+	BodyEncoded   string  `json:"body_encoded"` // Base64-encoded msgpack bytes
+	Tags          *string `json:"tags,omitempty"`
+	IsPrivate     bool    `json:"is_private"`
+	IsFlagged     bool    `json:"is_flagged"`
+	Starred       bool    `json:"starred"`
+	EncryptionIV  *string `json:"encryption_iv,omitempty"`
+	CreatedBy     *string `json:"created_by,omitempty"`
+	UpdatedBy     *string `json:"updated_by,omitempty"`
+	UpdatedByName *string `json:"updated_by_username,omitempty"`
+	CreatedAt     string  `json:"created_at"`
+	UpdatedAt     string  `json:"updated_at"`
+	AuthoredAt    *string `json:"authored_at,omitempty"`
+	SyncedAt      *string `json:"synced_at,omitempty"`
+	DeletedAt     *string `json:"deleted_at,omitempty"`
 }
 
 // EncodeMsgPackBody encodes a string body to Base64-encoded msgpack bytes.
@@ -105,22 +108,24 @@ func (n *NoteOutput) ToMsgPackResponse() (*MsgPackBodyResponse, error) {
 	}
 
 	return &MsgPackBodyResponse{
-		ID:           n.ID,
-		GUID:         n.GUID,
-		Title:        n.Title,
-		Description:  n.Description,
-		BodyEncoded:  encodedBody,
-		Tags:         n.Tags,
-		IsPrivate:    n.IsPrivate,
-		IsFlagged:    n.IsFlagged,
-		EncryptionIV: n.EncryptionIV,
-		CreatedBy:    n.CreatedBy,
-		UpdatedBy:    n.UpdatedBy,
-		CreatedAt:    n.CreatedAt,
-		UpdatedAt:    n.UpdatedAt,
-		AuthoredAt:   n.AuthoredAt,
-		SyncedAt:     n.SyncedAt,
-		DeletedAt:    n.DeletedAt,
+		ID:            n.ID,
+		GUID:          n.GUID,
+		Title:         n.Title,
+		Description:   n.Description,
+		BodyEncoded:   encodedBody,
+		Tags:          n.Tags,
+		IsPrivate:     n.IsPrivate,
+		IsFlagged:     n.IsFlagged,
+		Starred:       n.Starred,
+		EncryptionIV:  n.EncryptionIV,
+		CreatedBy:     n.CreatedBy,
+		UpdatedBy:     n.UpdatedBy,
+		UpdatedByName: n.UpdatedByName,
+		CreatedAt:     n.CreatedAt,
+		UpdatedAt:     n.UpdatedAt,
+		AuthoredAt:    n.AuthoredAt,
+		SyncedAt:      n.SyncedAt,
+		DeletedAt:     n.DeletedAt,
 	}, nil
 }
 
@@ -143,3 +148,60 @@ func (r *MsgPackBodyRequest) ToNoteInput() (*NoteInput, error) {
 		EncryptionIV: r.EncryptionIV,
 	}, nil
 }
+
+// MsgPackCategoryRequest is the category counterpart of MsgPackBodyRequest:
+// with X-Body-Encoding: msgpack, the description (the only field that can be
+// long) is sent as Base64 msgpack and everything else as plain JSON.
+type MsgPackCategoryRequest struct {
+	Name               string   `json:"name"`
+	DescriptionEncoded string   `json:"description_encoded"` // Base64-encoded msgpack bytes
+	Subcategories      []string `json:"subcategories,omitempty"`
+}
+
+// MsgPackCategoryResponse is the category counterpart of MsgPackBodyResponse.
+// The description_encoded field contains Base64-encoded msgpack bytes
+// instead of a plain description.
+type MsgPackCategoryResponse struct {
+	ID                 int64     `json:"id"`
+	GUID               string    `json:"guid"`
+	Name               string    `json:"name"`
+	DescriptionEncoded string    `json:"description_encoded"` // Base64-encoded msgpack bytes
+	Subcategories      []string  `json:"subcategories,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// ToMsgPackResponse converts a CategoryOutput to MsgPackCategoryResponse,
+// encoding the description the same way note bodies are encoded.
+func (c *CategoryOutput) ToMsgPackResponse() (*MsgPackCategoryResponse, error) {
+	encodedDesc, err := EncodeMsgPackBody(c.Description)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MsgPackCategoryResponse{
+		ID:                 c.ID,
+		GUID:               c.GUID,
+		Name:               c.Name,
+		DescriptionEncoded: encodedDesc,
+		Subcategories:      c.Subcategories,
+		CreatedAt:          c.CreatedAt,
+		UpdatedAt:          c.UpdatedAt,
+	}, nil
+}
+
+// ToCategoryInput converts a MsgPackCategoryRequest to CategoryInput.
+// The description_encoded field is decoded from Base64 msgpack format;
+// an empty value means no description.
+func (r *MsgPackCategoryRequest) ToCategoryInput() (*CategoryInput, error) {
+	description, err := DecodeMsgPackBody(r.DescriptionEncoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CategoryInput{
+		Name:          r.Name,
+		Description:   description,
+		Subcategories: r.Subcategories,
+	}, nil
+}
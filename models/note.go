@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql"
 	"time"
+	"unicode/utf8"
 
 	"github.com/rohanthewiz/logger"
 	"github.com/rohanthewiz/serr"
@@ -22,6 +23,7 @@ type Note struct {
 	Tags         sql.NullString `json:"tags"`          // Comma-separated tags for categorization
 	IsPrivate    bool           `json:"is_private"`    // Visibility flag, defaults to false
 	IsFlagged    bool           `json:"is_flagged"`    // Flag for follow-up, defaults to false
+	Starred      bool           `json:"starred"`       // Bookmarked as important; syncs, unlike is_flagged
 	EncryptionIV sql.NullString `json:"encryption_iv"` // Initialization vector if note is encrypted
 	CreatedBy    sql.NullString `json:"created_by"`    // User who created the note
 	UpdatedBy    sql.NullString `json:"updated_by"`    // User who last updated the note
@@ -51,6 +53,7 @@ CREATE TABLE IF NOT EXISTS notes (
     tags          VARCHAR,
     is_private    BOOLEAN DEFAULT false,
     is_flagged    BOOLEAN DEFAULT false,
+    starred       BOOLEAN DEFAULT false,
     encryption_iv VARCHAR,
     created_by    VARCHAR,
     updated_by    VARCHAR,
@@ -77,6 +80,7 @@ CREATE TABLE IF NOT EXISTS notes (
     tags          VARCHAR,
     is_private    BOOLEAN DEFAULT false,
     is_flagged    BOOLEAN DEFAULT false,
+    starred       BOOLEAN DEFAULT false,
     encryption_iv VARCHAR,
     created_by    VARCHAR,
     updated_by    VARCHAR,
@@ -110,26 +114,42 @@ type NoteInput struct {
 	UpdatedBy    *string `json:"updated_by,omitempty"`
 }
 
+// NotePatch is a partial note update for PatchNote. Only non-nil fields are
+// changed; a nil field leaves the note's current value in place. To clear a
+// text field, set it to "".
+type NotePatch struct {
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Body        *string `json:"body,omitempty"`
+	Tags        *string `json:"tags,omitempty"`
+	IsPrivate   *bool   `json:"is_private,omitempty"`
+	IsFlagged   *bool   `json:"is_flagged,omitempty"`
+}
+
 // NoteOutput provides a JSON-friendly representation of a Note.
 // sql.Null* types don't serialize well to JSON, so we convert
 // them to pointer types which marshal as null or the value.
 type NoteOutput struct {
-	ID           int64   `json:"id"`
-	GUID         string  `json:"guid"`
-	Title        string  `json:"title"`
-	Description  *string `json:"description,omitempty"`
-	Body         *string `json:"body,omitempty"`
-	Tags         *string `json:"tags,omitempty"`
-	IsPrivate    bool    `json:"is_private"`
-	IsFlagged    bool    `json:"is_flagged"`
-	EncryptionIV *string `json:"encryption_iv,omitempty"`
-	CreatedBy    *string `json:"created_by,omitempty"`
-	UpdatedBy    *string `json:"updated_by,omitempty"`
-	CreatedAt    string  `json:"created_at"`
-	UpdatedAt    string  `json:"updated_at"`
-	AuthoredAt   *string `json:"authored_at,omitempty"` // Last human authoring timestamp (disk only)
-	SyncedAt     *string `json:"synced_at,omitempty"`
-	DeletedAt    *string `json:"deleted_at,omitempty"`
+	ID            int64   `json:"id"`
+	GUID          string  `json:"guid"`
+	Title         string  `json:"title"`
+	Description   *string `json:"description,omitempty"`
+	Body          *string `json:"body,omitempty"`
+	Tags          *string `json:"tags,omitempty"`
+	IsPrivate     bool    `json:"is_private"`
+	IsFlagged     bool    `json:"is_flagged"`
+	Starred       bool    `json:"starred"`
+	EncryptionIV  *string `json:"encryption_iv,omitempty"`
+	CreatedBy     *string `json:"created_by,omitempty"`
+	UpdatedBy     *string `json:"updated_by,omitempty"`
+	UpdatedByName *string `json:"updated_by_username,omitempty"` // Username of UpdatedBy, when it is a local user
+	CreatedAt     string  `json:"created_at"`
+	UpdatedAt     string  `json:"updated_at"`
+	AuthoredAt    *string `json:"authored_at,omitempty"` // Last human authoring timestamp (disk only)
+	SyncedAt      *string `json:"synced_at,omitempty"`
+	DeletedAt     *string `json:"deleted_at,omitempty"`
+	WordCount     int     `json:"word_count"` // Computed from Body (see CountWords)
+	CharCount     int     `json:"char_count"` // Computed from Body, in Unicode characters
 }
 
 // ToOutput converts a Note to NoteOutput for JSON serialization.
@@ -141,6 +161,7 @@ func (n *Note) ToOutput() NoteOutput {
 		Title:     n.Title,
 		IsPrivate: n.IsPrivate,
 		IsFlagged: n.IsFlagged,
+		Starred:   n.Starred,
 		CreatedAt: n.CreatedAt.Format(time.RFC3339),
 		UpdatedAt: n.UpdatedAt.Format(time.RFC3339),
 	}
@@ -151,6 +172,8 @@ func (n *Note) ToOutput() NoteOutput {
 	}
 	if n.Body.Valid {
 		out.Body = &n.Body.String
+		out.WordCount = CountWords(n.Body.String)
+		out.CharCount = utf8.RuneCountInString(n.Body.String)
 	}
 	if n.Tags.Valid {
 		out.Tags = &n.Tags.String
@@ -163,6 +186,9 @@ func (n *Note) ToOutput() NoteOutput {
 	}
 	if n.UpdatedBy.Valid {
 		out.UpdatedBy = &n.UpdatedBy.String
+		if name := usernameForGUID(n.UpdatedBy.String); name != "" {
+			out.UpdatedByName = &name
+		}
 	}
 
 	// Convert sql.NullTime fields to *string
@@ -193,16 +219,38 @@ func (n *Note) ToOutput() NoteOutput {
 //   - This means disk contains encrypted data (secure at rest) while memory has
 //     plaintext for performance.
 //
+// Bodies at or above BodyCompressionThreshold are likewise compressed on disk
+// only (before encryption, for private notes).
+//
 // CreateNote creates a new note in both disk and cache databases.
 // The userGUID parameter is required to set note ownership (created_by).
+// The GUID is normalized and must pass ValidateGUID; an empty GUID is
+// replaced with a generated one (see NewNoteGUID). Tags are normalized (see
+// NormalizeTags).
 func CreateNote(input NoteInput, userGUID string) (*Note, error) {
+	if IsReadOnly() {
+		return nil, ErrReadOnly
+	}
+	normalizeInputTags(&input)
+	input.GUID = NormalizeGUID(input.GUID)
+	if input.GUID == "" {
+		input.GUID = NewNoteGUID()
+	}
+	if err := ValidateGUID(input.GUID); err != nil {
+		return nil, err
+	}
+
 	// Prepare body and IV for disk storage
-	// For private notes, we encrypt the body; for public notes, we store plainly
-	diskBody := toNullString(input.Body)
+	// Large bodies are compressed first; then for private notes, we encrypt the
+	// body; for public notes, we store plainly
+	diskBody, bodyCompressed, err := compressBodyForDisk(input.Body)
+	if err != nil {
+		return nil, err
+	}
 	diskEncryptionIV := toNullString(input.EncryptionIV)
 
 	if input.IsPrivate && IsEncryptionEnabled() && input.Body != nil && *input.Body != "" {
-		encryptedBody, iv, err := EncryptNoteBody(input.Body)
+		encryptedBody, iv, err := EncryptNoteBody(&diskBody.String)
 		if err != nil {
 			return nil, serr.Wrap(err, "failed to encrypt private note body")
 		}
@@ -216,19 +264,21 @@ func CreateNote(input NoteInput, userGUID string) (*Note, error) {
 
 	// authored_at uses DEFAULT CURRENT_TIMESTAMP, so no need to include in INSERT VALUES
 	query := `
-		INSERT INTO notes (guid, title, description, body, tags, is_private, is_flagged, encryption_iv, created_by, updated_by)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		RETURNING id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		INSERT INTO notes (guid, title, description, body, body_compressed, tags, is_private, is_flagged, encryption_iv,
+		                   created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
 		          created_by, updated_by, created_at, updated_at, authored_at, synced_at, deleted_at
 	`
 
 	note := &Note{}
 	// Insert into disk DB first (source of truth) - body is encrypted for private notes
-	err := db.QueryRow(query,
+	err = db.QueryRow(query,
 		input.GUID,
 		input.Title,
 		toNullString(input.Description),
 		diskBody,
+		bodyCompressed,
 		toNullString(input.Tags),
 		input.IsPrivate,
 		input.IsFlagged,
@@ -237,7 +287,7 @@ func CreateNote(input NoteInput, userGUID string) (*Note, error) {
 		updatedBy,
 	).Scan(
 		&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
-		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.EncryptionIV, &note.CreatedBy,
+		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
 		&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.AuthoredAt, &note.SyncedAt, &note.DeletedAt,
 	)
 
@@ -256,11 +306,11 @@ func CreateNote(input NoteInput, userGUID string) (*Note, error) {
 		}
 	}
 
-	// For private notes, the note.Body from disk is encrypted.
-	// We need to store the UNENCRYPTED body in cache for fast reads.
+	// For private notes, the note.Body from disk is encrypted, and large bodies
+	// are compressed. We need to store the plaintext body in cache for fast reads.
 	cacheBody := note.Body
-	if input.IsPrivate && IsEncryptionEnabled() && input.Body != nil {
-		// Use the original unencrypted body for cache
+	if (input.IsPrivate && IsEncryptionEnabled() || bodyCompressed) && input.Body != nil {
+		// Use the original plaintext body for cache
 		cacheBody = toNullString(input.Body)
 	}
 
@@ -268,9 +318,9 @@ func CreateNote(input NoteInput, userGUID string) (*Note, error) {
 	// Note: Cache stores unencrypted body for performance; encryption_iv is still stored
 	// for reference but the body is plaintext in cache
 	cacheInsertQuery := `
-		INSERT INTO notes (id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		INSERT INTO notes (id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
 		                   created_by, updated_by, created_at, updated_at, synced_at, deleted_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	logger.Debug("CreateNote: inserting into cache",
@@ -283,7 +333,7 @@ func CreateNote(input NoteInput, userGUID string) (*Note, error) {
 
 	_, err = cacheDB.Exec(cacheInsertQuery,
 		note.ID, note.GUID, note.Title, note.Description, cacheBody,
-		note.Tags, note.IsPrivate, note.IsFlagged, note.EncryptionIV, note.CreatedBy,
+		note.Tags, note.IsPrivate, note.IsFlagged, note.Starred, note.EncryptionIV, note.CreatedBy,
 		note.UpdatedBy, note.CreatedAt, note.UpdatedAt, note.SyncedAt, note.DeletedAt,
 	)
 	if err != nil {
@@ -297,6 +347,10 @@ func CreateNote(input NoteInput, userGUID string) (*Note, error) {
 	}
 
 	logger.Debug("CreateNote: cache insert successful", "note_id", note.ID)
+	updateSyncChecksum("note", note.GUID)
+
+	recordNoteLinks(note.GUID, cacheBody)
+	applyCategoryRulesAfterSave(note.ID, input.Tags)
 
 	// Return note with unencrypted body for the caller
 	note.Body = cacheBody
@@ -312,23 +366,30 @@ func CreateNote(input NoteInput, userGUID string) (*Note, error) {
 // caller needs to import private notes).
 func CreateNoteWithTimestamps(input NoteInput, userGUID string,
 	createdAt, updatedAt, authoredAt time.Time) (*Note, error) {
+	normalizeInputTags(&input)
 	createdBy := sql.NullString{String: userGUID, Valid: userGUID != ""}
 	updatedBy := sql.NullString{String: userGUID, Valid: userGUID != ""}
 
+	diskBody, bodyCompressed, err := compressBodyForDisk(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		INSERT INTO notes (guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		INSERT INTO notes (guid, title, description, body, body_compressed, tags, is_private, is_flagged, encryption_iv,
 		                   created_by, updated_by, created_at, updated_at, authored_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		RETURNING id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
 		          created_by, updated_by, created_at, updated_at, authored_at, synced_at, deleted_at
 	`
 
 	note := &Note{}
-	err := db.QueryRow(query,
+	err = db.QueryRow(query,
 		input.GUID,
 		input.Title,
 		toNullString(input.Description),
-		toNullString(input.Body),
+		diskBody,
+		bodyCompressed,
 		toNullString(input.Tags),
 		input.IsPrivate,
 		input.IsFlagged,
@@ -340,27 +401,31 @@ func CreateNoteWithTimestamps(input NoteInput, userGUID string,
 		authoredAt,
 	).Scan(
 		&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
-		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.EncryptionIV, &note.CreatedBy,
+		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
 		&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.AuthoredAt, &note.SyncedAt, &note.DeletedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
+	// The cache holds the plaintext body
+	note.Body = toNullString(input.Body)
+	recordNoteLinks(note.GUID, note.Body)
 
 	cacheInsertQuery := `
-		INSERT INTO notes (id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		INSERT INTO notes (id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
 		                   created_by, updated_by, created_at, updated_at, synced_at, deleted_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err = cacheDB.Exec(cacheInsertQuery,
 		note.ID, note.GUID, note.Title, note.Description, note.Body,
-		note.Tags, note.IsPrivate, note.IsFlagged, note.EncryptionIV, note.CreatedBy,
+		note.Tags, note.IsPrivate, note.IsFlagged, note.Starred, note.EncryptionIV, note.CreatedBy,
 		note.UpdatedBy, note.CreatedAt, note.UpdatedAt, note.SyncedAt, note.DeletedAt,
 	)
 	if err != nil {
 		return note, serr.Wrap(err, "note inserted to disk but cache insert failed")
 	}
+	updateSyncChecksum("note", note.GUID)
 
 	return note, nil
 }
@@ -368,9 +433,18 @@ func CreateNoteWithTimestamps(input NoteInput, userGUID string,
 // GetNoteByID retrieves a single note by its primary key from the cache.
 // The userGUID parameter filters to notes owned by that user.
 // Returns nil, nil if the note doesn't exist or isn't owned by the user.
+// With a lazy cache, a note not yet cached is loaded from disk.
 func GetNoteByID(id int64, userGUID string) (*Note, error) {
+	return getWithCacheFallback(
+		func() (*Note, error) { return getNoteByIDFromCache(id, userGUID) },
+		func() (bool, error) { return lazyLoadNote(id) },
+	)
+}
+
+// getNoteByIDFromCache is the cache lookup behind GetNoteByID.
+func getNoteByIDFromCache(id int64, userGUID string) (*Note, error) {
 	query := `
-		SELECT id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		SELECT id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
 		       created_by, updated_by, created_at, updated_at, synced_at, deleted_at
 		FROM notes
 		WHERE id = ? AND created_by = ? AND deleted_at IS NULL
@@ -380,7 +454,7 @@ func GetNoteByID(id int64, userGUID string) (*Note, error) {
 	// Read from cache for better performance
 	err := cacheDB.QueryRow(query, id, userGUID).Scan(
 		&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
-		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.EncryptionIV, &note.CreatedBy,
+		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
 		&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.SyncedAt, &note.DeletedAt,
 	)
 
@@ -394,20 +468,21 @@ func GetNoteByID(id int64, userGUID string) (*Note, error) {
 }
 
 // getNoteByIDFromDisk retrieves a single note by its primary key from the disk database.
-// Used as a fallback when cache operations fail. Note that for encrypted private notes,
-// the body will be encrypted in the returned note (unlike cache reads).
+// Used as a fallback when cache operations fail. The body is decrypted and
+// decompressed as needed, so it reads the same as from the cache.
 func getNoteByIDFromDisk(id int64, userGUID string) (*Note, error) {
 	query := `
-		SELECT id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		SELECT id, guid, title, description, body, body_compressed, tags, is_private, is_flagged, starred, encryption_iv,
 		       created_by, updated_by, created_at, updated_at, authored_at, synced_at, deleted_at
 		FROM notes
 		WHERE id = ? AND created_by = ? AND deleted_at IS NULL
 	`
 
 	note := &Note{}
+	var bodyCompressed bool
 	err := db.QueryRow(query, id, userGUID).Scan(
-		&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
-		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.EncryptionIV, &note.CreatedBy,
+		&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body, &bodyCompressed,
+		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
 		&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.AuthoredAt, &note.SyncedAt, &note.DeletedAt,
 	)
 
@@ -418,15 +493,10 @@ func getNoteByIDFromDisk(id int64, userGUID string) (*Note, error) {
 		return nil, err
 	}
 
-	// For private encrypted notes, decrypt the body before returning
-	if note.IsPrivate && IsEncryptionEnabled() && note.Body.Valid && note.EncryptionIV.Valid {
-		decryptedBody, err := DecryptNoteBody(note.Body.String, note.EncryptionIV.String)
-		if err != nil {
-			// Log error but return note with encrypted body rather than failing
-			logger.LogErr(err, "failed to decrypt note body from disk", "note_id", id)
-		} else {
-			note.Body = sql.NullString{String: decryptedBody, Valid: true}
-		}
+	// For private encrypted notes and compressed bodies, decode the body before returning
+	if err := decodeDiskBody(note, bodyCompressed); err != nil {
+		// Log error but return note with the stored body rather than failing
+		logger.LogErr(err, "failed to decode note body from disk", "note_id", id)
 	}
 
 	return note, nil
@@ -434,9 +504,18 @@ func getNoteByIDFromDisk(id int64, userGUID string) (*Note, error) {
 
 // GetNoteByGUID retrieves a single note by its GUID from the cache.
 // Useful for external references and sync operations.
+// With a lazy cache, a note not yet cached is loaded from disk.
 func GetNoteByGUID(guid string) (*Note, error) {
+	return getWithCacheFallback(
+		func() (*Note, error) { return getNoteByGUIDFromCache(guid) },
+		func() (bool, error) { return lazyLoadNoteByGUID(guid) },
+	)
+}
+
+// getNoteByGUIDFromCache is the cache lookup behind GetNoteByGUID.
+func getNoteByGUIDFromCache(guid string) (*Note, error) {
 	query := `
-		SELECT id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		SELECT id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
 		       created_by, updated_by, created_at, updated_at, synced_at, deleted_at
 		FROM notes
 		WHERE guid = ? AND deleted_at IS NULL
@@ -446,7 +525,7 @@ func GetNoteByGUID(guid string) (*Note, error) {
 	// Read from cache for better performance
 	err := cacheDB.QueryRow(query, guid).Scan(
 		&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
-		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.EncryptionIV, &note.CreatedBy,
+		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
 		&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.SyncedAt, &note.DeletedAt,
 	)
 
@@ -464,29 +543,36 @@ func GetNoteByGUID(guid string) (*Note, error) {
 // Ordered by created_at descending (newest first).
 // limit=0 returns all notes, offset skips the first N results.
 func ListNotes(userGUID string, limit, offset int) ([]Note, error) {
+	return ListNotesInRange(userGUID, CreatedRange{}, limit, offset)
+}
+
+// ListNotesInRange is ListNotes limited to notes created within created.
+func ListNotesInRange(userGUID string, created CreatedRange, limit, offset int) ([]Note, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		SELECT id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
 		       created_by, updated_by, created_at, updated_at, synced_at, deleted_at
 		FROM notes
 		WHERE created_by = ? AND deleted_at IS NULL
-		ORDER BY created_at DESC
 	`
+	args := []any{userGUID}
+	if cond, condArgs := created.sqlCondition("created_at"); cond != "" {
+		query += " AND " + cond
+		args = append(args, condArgs...)
+	}
+	query += " ORDER BY created_at DESC"
 
 	// Add pagination if limit is specified
 	if limit > 0 {
 		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
 	}
 
-	var rows *sql.Rows
-	var err error
-
 	// Read from cache for better performance
-	if limit > 0 {
-		rows, err = cacheDB.Query(query, userGUID, limit, offset)
-	} else {
-		rows, err = cacheDB.Query(query, userGUID)
-	}
-
+	rows, err := cacheDB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -497,7 +583,7 @@ func ListNotes(userGUID string, limit, offset int) ([]Note, error) {
 		var note Note
 		err := rows.Scan(
 			&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
-			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.EncryptionIV, &note.CreatedBy,
+			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
 			&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.SyncedAt, &note.DeletedAt,
 		)
 		if err != nil {
@@ -509,8 +595,48 @@ func ListNotes(userGUID string, limit, offset int) ([]Note, error) {
 	return notes, rows.Err()
 }
 
+// ListNotesModifiedSince returns the user's non-deleted notes whose updated_at
+// is after since, oldest change first, for clients refreshing a local copy
+// incrementally. Restoring a note from the trash updates updated_at, so
+// restored notes are included. This is current note state, not the change
+// log: a note edited twice appears once, and deletions don't appear at all.
+func ListNotesModifiedSince(userGUID string, since time.Time) ([]Note, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
+	rows, err := cacheDB.Query(`
+		SELECT id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
+		       created_by, updated_by, created_at, updated_at, synced_at, deleted_at
+		FROM notes
+		WHERE created_by = ? AND deleted_at IS NULL AND updated_at > ?
+		ORDER BY updated_at ASC, id ASC
+	`, userGUID, since)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to query notes modified since")
+	}
+	defer rows.Close()
+
+	notes := []Note{}
+	for rows.Next() {
+		var note Note
+		err := rows.Scan(
+			&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
+			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
+			&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.SyncedAt, &note.DeletedAt,
+		)
+		if err != nil {
+			return nil, serr.Wrap(err, "failed to scan note modified since")
+		}
+		notes = append(notes, note)
+	}
+
+	return notes, rows.Err()
+}
+
 // UpdateNote modifies an existing note identified by ID in both databases.
 // Only non-nil fields in the input are updated; updated_at is auto-set.
+// Tags are normalized (see NormalizeTags).
 // Returns the updated note or nil if not found.
 // Note: DuckDB's RETURNING clause on UPDATE has limitations, so we
 // perform the update and then fetch the updated record separately.
@@ -522,7 +648,22 @@ func ListNotes(userGUID string, limit, offset int) ([]Note, error) {
 //   - If a note changes from private to public, the body is stored unencrypted.
 //
 // The userGUID parameter is used to verify ownership and set updated_by.
+//
+// Concurrent updates of the same note are serialized (see lockNote), so each
+// recorded change is computed against the state the previous one left.
 func UpdateNote(id int64, input NoteInput, userGUID string) (*Note, error) {
+	unlock := lockNote(id)
+	defer unlock()
+	return updateNoteLocked(id, input, userGUID)
+}
+
+// updateNoteLocked is UpdateNote for a caller already holding the note's lock.
+func updateNoteLocked(id int64, input NoteInput, userGUID string) (*Note, error) {
+	if IsReadOnly() {
+		return nil, ErrReadOnly
+	}
+	normalizeInputTags(&input)
+
 	// First verify the note exists, isn't deleted, and is owned by this user
 	existing, err := GetNoteByID(id, userGUID)
 	if err != nil {
@@ -536,12 +677,16 @@ func UpdateNote(id int64, input NoteInput, userGUID string) (*Note, error) {
 	updatedBy := sql.NullString{String: userGUID, Valid: userGUID != ""}
 
 	// Prepare body and IV for disk storage
-	// For private notes, we encrypt the body; for public notes, we store plainly
-	diskBody := toNullString(input.Body)
+	// Large bodies are compressed first; then for private notes, we encrypt the
+	// body; for public notes, we store plainly
+	diskBody, bodyCompressed, err := compressBodyForDisk(input.Body)
+	if err != nil {
+		return nil, err
+	}
 	diskEncryptionIV := toNullString(input.EncryptionIV)
 
 	if input.IsPrivate && IsEncryptionEnabled() && input.Body != nil && *input.Body != "" {
-		encryptedBody, iv, err := EncryptNoteBody(input.Body)
+		encryptedBody, iv, err := EncryptNoteBody(&diskBody.String)
 		if err != nil {
 			return nil, serr.Wrap(err, "failed to encrypt private note body")
 		}
@@ -554,7 +699,7 @@ func UpdateNote(id int64, input NoteInput, userGUID string) (*Note, error) {
 	// Also filter by created_by to enforce ownership
 	diskUpdateQuery := `
 		UPDATE notes
-		SET title = ?, description = ?, body = ?, tags = ?, is_private = ?, is_flagged = ?,
+		SET title = ?, description = ?, body = ?, body_compressed = ?, tags = ?, is_private = ?, is_flagged = ?,
 		    encryption_iv = ?, updated_by = ?, updated_at = CURRENT_TIMESTAMP,
 		    authored_at = CURRENT_TIMESTAMP
 		WHERE id = ? AND created_by = ? AND deleted_at IS NULL
@@ -564,6 +709,7 @@ func UpdateNote(id int64, input NoteInput, userGUID string) (*Note, error) {
 		input.Title,
 		toNullString(input.Description),
 		diskBody,
+		bodyCompressed,
 		toNullString(input.Tags),
 		input.IsPrivate,
 		input.IsFlagged,
@@ -584,6 +730,8 @@ func UpdateNote(id int64, input NoteInput, userGUID string) (*Note, error) {
 		return nil, nil
 	}
 
+	recordNoteLinks(existing.GUID, toNullString(input.Body))
+
 	// Record change for sync (non-blocking)
 	// Only track fields that actually changed. Pass existing note so that
 	// body diffs can be computed against the previous body content.
@@ -620,7 +768,7 @@ func UpdateNote(id int64, input NoteInput, userGUID string) (*Note, error) {
 		input.IsPrivate,
 		input.IsFlagged,
 		diskEncryptionIV, // Store the IV in cache too for reference
-		toNullString(input.UpdatedBy),
+		updatedBy,
 		id,
 	)
 	if err != nil {
@@ -638,25 +786,95 @@ func UpdateNote(id int64, input NoteInput, userGUID string) (*Note, error) {
 	}
 
 	logger.Debug("UpdateNote: cache update successful", "note_id", id)
+	updateSyncChecksum("note", existing.GUID)
+	applyCategoryRulesAfterSave(id, input.Tags)
 
 	// Fetch the updated note from cache (will have unencrypted body)
 	return GetNoteByID(id, userGUID)
 }
 
+// PatchNote updates only the fields set in patch, leaving the rest of the note
+// as it is. The patch is applied over the note's current state and saved via
+// UpdateNote, so the recorded change's bitmask covers just the patched fields
+// whose values actually changed. An empty patch returns the note unmodified.
+// Returns nil if the note is not found or not owned by userGUID.
+func PatchNote(id int64, patch NotePatch, userGUID string) (*Note, error) {
+	// Hold the lock from reading the note to saving it, so a concurrent
+	// update's fields aren't written back over by this patch
+	unlock := lockNote(id)
+	defer unlock()
+
+	existing, err := GetNoteByID(id, userGUID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, nil // Not found or not owned by user
+	}
+
+	if patch == (NotePatch{}) {
+		return existing, nil
+	}
+
+	// Start from the current note so unpatched fields are written back
+	// unchanged. The encryption IV is left out: UpdateNote generates a fresh
+	// one whenever it encrypts the body.
+	input := NoteInput{
+		GUID:        existing.GUID,
+		Title:       existing.Title,
+		Description: nullStringToPtr(existing.Description),
+		Body:        nullStringToPtr(existing.Body),
+		Tags:        nullStringToPtr(existing.Tags),
+		IsPrivate:   existing.IsPrivate,
+		IsFlagged:   existing.IsFlagged,
+	}
+	if patch.Title != nil {
+		input.Title = *patch.Title
+	}
+	if patch.Description != nil {
+		input.Description = patch.Description
+	}
+	if patch.Body != nil {
+		input.Body = patch.Body
+	}
+	if patch.Tags != nil {
+		input.Tags = patch.Tags
+	}
+	if patch.IsPrivate != nil {
+		input.IsPrivate = *patch.IsPrivate
+	}
+	if patch.IsFlagged != nil {
+		input.IsFlagged = *patch.IsFlagged
+	}
+
+	return updateNoteLocked(id, input, userGUID)
+}
+
 // DeleteNote performs a soft delete by setting deleted_at timestamp in both databases.
 // The note remains in the database but is excluded from normal queries.
 // The userGUID parameter verifies ownership before deletion.
-// Returns true if a note was deleted, false if not found or not owned by user.
+// Returns true if the note is now deleted, false if not found or not owned by user.
+// Deleting a note that is already in the trash succeeds without changing it
+// (deleted_at and the change log are left alone), so a retried delete whose
+// first response was lost doesn't report "not found".
 func DeleteNote(id int64, userGUID string) (bool, error) {
+	if IsReadOnly() {
+		return false, ErrReadOnly
+	}
 	// First get the note GUID for change tracking, also verify ownership
 	var noteGUID string
-	err := db.QueryRow(`SELECT guid FROM notes WHERE id = ? AND created_by = ? AND deleted_at IS NULL`, id, userGUID).Scan(&noteGUID)
+	var deletedAt sql.NullTime
+	err := db.QueryRow(`SELECT guid, deleted_at FROM notes WHERE id = ? AND created_by = ?`, id, userGUID).
+		Scan(&noteGUID, &deletedAt)
 	if err == sql.ErrNoRows {
 		return false, nil
 	}
 	if err != nil {
 		return false, serr.Wrap(err, "failed to get note GUID for delete tracking")
 	}
+	if deletedAt.Valid {
+		return true, nil
+	}
 
 	query := `
 		UPDATE notes
@@ -691,6 +909,7 @@ func DeleteNote(id int64, userGUID string) (bool, error) {
 		// Cache delete failed - disk is updated but cache is out of sync
 		return true, serr.Wrap(err, "note deleted in disk DB but failed to update cache")
 	}
+	updateSyncChecksum("note", noteGUID)
 
 	return true, nil
 }
@@ -717,26 +936,220 @@ func HardDeleteNote(id int64) (bool, error) {
 	}
 
 	// Also delete from cache
+	var noteGUID string
+	_ = cacheDB.QueryRow(`SELECT guid FROM notes WHERE id = ?`, id).Scan(&noteGUID)
 	_, err = cacheDB.Exec(query, id)
 	if err != nil {
 		// Cache delete failed - disk is updated but cache is out of sync
 		return true, serr.Wrap(err, "note hard deleted in disk DB but failed to update cache")
 	}
+	if noteGUID != "" {
+		updateSyncChecksum("note", noteGUID)
+	}
 
 	return true, nil
 }
 
+// ListDeletedNotes retrieves soft-deleted notes owned by a user (the trash),
+// most recently deleted first. limit=0 returns all, offset skips the first N.
+func ListDeletedNotes(userGUID string, limit, offset int) ([]Note, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
+		       created_by, updated_by, created_at, updated_at, synced_at, deleted_at
+		FROM notes
+		WHERE created_by = ? AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
+	`
+
+	args := []interface{}{userGUID}
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	}
+
+	// Soft-deleted rows stay in the cache, so the trash is served from it too
+	rows, err := cacheDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []Note
+	for rows.Next() {
+		var note Note
+		err := rows.Scan(
+			&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
+			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
+			&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.SyncedAt, &note.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+
+	return notes, rows.Err()
+}
+
+// RestoreNote moves a soft-deleted note out of the trash by clearing deleted_at.
+// Returns the restored note, or nil if no deleted note with that ID is owned by the user.
+//
+// The restore is recorded as an update carrying a full snapshot of the note so
+// that peers which already applied the delete can bring the note back with its
+// current content.
+func RestoreNote(id int64, userGUID string) (*Note, error) {
+	if IsReadOnly() {
+		return nil, ErrReadOnly
+	}
+	updatedBy := sql.NullString{String: userGUID, Valid: userGUID != ""}
+
+	// Restore on disk first (source of truth)
+	result, err := db.Exec(`
+		UPDATE notes
+		SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP, authored_at = CURRENT_TIMESTAMP, updated_by = ?
+		WHERE id = ? AND created_by = ? AND deleted_at IS NOT NULL
+	`, updatedBy, id, userGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to restore note on disk")
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, nil
+	}
+
+	// Re-read from disk so the sync snapshot has the decrypted body
+	diskNote, err := getNoteByIDFromDisk(id, userGUID)
+	if err != nil || diskNote == nil {
+		return nil, serr.Wrap(err, "failed to read restored note from disk")
+	}
+
+	// Record change for sync (non-blocking)
+	input := NoteInput{
+		GUID:        diskNote.GUID,
+		Title:       diskNote.Title,
+		Description: nullStringToPtr(diskNote.Description),
+		Body:        nullStringToPtr(diskNote.Body),
+		Tags:        nullStringToPtr(diskNote.Tags),
+		IsPrivate:   diskNote.IsPrivate,
+	}
+	fragment := createFragmentFromInput(input, FragmentTitle|FragmentDescription|FragmentBody|FragmentTags|FragmentIsPrivate|FragmentStarred)
+	fragment.Starred = sql.NullBool{Bool: diskNote.Starred, Valid: true}
+	if fragmentID, err := insertNoteFragment(fragment); err != nil {
+		logger.LogErr(err, "failed to record restore fragment", "note_id", id)
+	} else {
+		if err := insertNoteChange(GenerateChangeGUID(), diskNote.GUID, OperationUpdate, sql.NullInt64{Int64: fragmentID, Valid: true}, userGUID); err != nil {
+			logger.LogErr(err, "failed to record restore change", "note_id", id)
+		}
+	}
+
+	_, err = cacheDB.Exec(`
+		UPDATE notes SET deleted_at = NULL, updated_at = ?, updated_by = ?
+		WHERE id = ?
+	`, diskNote.UpdatedAt, updatedBy, id)
+	if err != nil {
+		return nil, serr.Wrap(err, "note restored in disk DB but failed to update cache")
+	}
+	updateSyncChecksum("note", diskNote.GUID)
+
+	return GetNoteByID(id, userGUID)
+}
+
+// PurgeNote permanently removes a note owned by the user, along with its
+// category mappings and attachments. The note may be active or already in the trash.
+// Returns false if no such note exists.
+//
+// Purging a note that was still active records a delete change so peers drop
+// it too; purging from the trash needs no change since the delete already synced.
+func PurgeNote(id int64, userGUID string) (bool, error) {
+	if IsReadOnly() {
+		return false, ErrReadOnly
+	}
+	var noteGUID string
+	var deletedAt sql.NullTime
+	err := db.QueryRow(`SELECT guid, deleted_at FROM notes WHERE id = ? AND created_by = ?`, id, userGUID).
+		Scan(&noteGUID, &deletedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, serr.Wrap(err, "failed to get note for purge")
+	}
+
+	if err := purgeNoteFromDisk(id); err != nil {
+		return false, err
+	}
+
+	if !deletedAt.Valid {
+		if err := insertNoteChange(GenerateChangeGUID(), noteGUID, OperationDelete, sql.NullInt64{}, userGUID); err != nil {
+			logger.LogErr(err, "failed to record purge change", "note_id", id)
+		}
+	}
+
+	if err := purgeNoteRows(cacheDB, id); err != nil {
+		return true, serr.Wrap(err, "note purged from disk DB but failed to update cache")
+	}
+	updateSyncChecksum("note", noteGUID)
+
+	return true, nil
+}
+
+// purgeNoteFromDisk deletes a note and everything that hangs off it from the
+// disk database. Attachments and share links are stored on disk only.
+func purgeNoteFromDisk(id int64) error {
+	if _, err := db.Exec(`DELETE FROM attachments WHERE note_id = ?`, id); err != nil {
+		return serr.Wrap(err, "failed to purge note attachments")
+	}
+	if _, err := db.Exec(`DELETE FROM share_tokens WHERE note_id = ?`, id); err != nil {
+		return serr.Wrap(err, "failed to purge note share links")
+	}
+	if _, err := db.Exec(`DELETE FROM note_links
+		WHERE source_note_guid = (SELECT guid FROM notes WHERE id = ?)`, id); err != nil {
+		return serr.Wrap(err, "failed to purge note links")
+	}
+
+	if err := purgeNoteRows(db, id); err != nil {
+		return serr.Wrap(err, "failed to purge note from disk")
+	}
+	return nil
+}
+
+// purgeNoteRows deletes a note and its note_categories rows from one database.
+// This can't be a single transaction: DuckDB checks foreign keys against rows
+// deleted earlier in the same transaction as if they still existed. Mappings
+// go first; if the note delete then fails, a retried purge finishes the job.
+func purgeNoteRows(database *sql.DB, id int64) error {
+	if _, err := database.Exec(`DELETE FROM note_categories WHERE note_id = ?`, id); err != nil {
+		return serr.Wrap(err, "failed to delete note category mappings")
+	}
+	if _, err := database.Exec(`DELETE FROM notes WHERE id = ?`, id); err != nil {
+		return serr.Wrap(err, "failed to delete note")
+	}
+	return nil
+}
+
 // SearchNotesByTitle searches for non-deleted notes owned by a user whose title
 // contains the given query string (case-insensitive). Returns up to `limit` results
 // with only the fields needed for autocomplete (id, guid, title).
 // Used by the note-linking popup to let users search for notes to link to.
 func SearchNotesByTitle(query string, userGUID string, limit int) ([]Note, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
 	if limit <= 0 {
 		limit = 20
 	}
 
 	sqlQuery := `
-		SELECT id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		SELECT id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
 		       created_by, updated_by, created_at, updated_at, synced_at, deleted_at
 		FROM notes
 		WHERE created_by = ? AND deleted_at IS NULL
@@ -756,7 +1169,7 @@ func SearchNotesByTitle(query string, userGUID string, limit int) ([]Note, error
 		var note Note
 		err := rows.Scan(
 			&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
-			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.EncryptionIV, &note.CreatedBy,
+			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
 			&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.SyncedAt, &note.DeletedAt,
 		)
 		if err != nil {
@@ -768,9 +1181,64 @@ func SearchNotesByTitle(query string, userGUID string, limit int) ([]Note, error
 	return notes, rows.Err()
 }
 
+// SearchNotesByTitleRanked is SearchNotesByTitle with relevance ordering for
+// autocomplete: an exact title match (case-insensitive) comes first, then
+// titles starting with the query, then titles containing it elsewhere.
+// Ties within a rank are broken by most recently updated.
+func SearchNotesByTitleRanked(query string, userGUID string, limit int) ([]Note, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = 20
+	}
+
+	sqlQuery := `
+		SELECT id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
+		       created_by, updated_by, created_at, updated_at, synced_at, deleted_at
+		FROM notes
+		WHERE created_by = ? AND deleted_at IS NULL
+		  AND LOWER(title) LIKE '%' || LOWER(?) || '%'
+		ORDER BY
+			CASE
+				WHEN LOWER(title) = LOWER(?) THEN 0
+				WHEN LOWER(title) LIKE LOWER(?) || '%' THEN 1
+				ELSE 2
+			END,
+			updated_at DESC
+		LIMIT ?
+	`
+
+	rows, err := cacheDB.Query(sqlQuery, userGUID, query, query, query, limit)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to search notes by title")
+	}
+	defer rows.Close()
+
+	var notes []Note
+	for rows.Next() {
+		var note Note
+		err := rows.Scan(
+			&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
+			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
+			&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.SyncedAt, &note.DeletedAt,
+		)
+		if err != nil {
+			return nil, serr.Wrap(err, "failed to scan note search result")
+		}
+		notes = append(notes, note)
+	}
+
+	return notes, rows.Err()
+}
+
 // ToggleNoteFlag toggles the is_flagged field on a note.
 // Returns the updated note or nil if not found.
 func ToggleNoteFlag(id int64, userGUID string) (*Note, error) {
+	if IsReadOnly() {
+		return nil, ErrReadOnly
+	}
 	// Toggle in disk DB (source of truth)
 	result, err := db.Exec(`
 		UPDATE notes SET is_flagged = NOT is_flagged
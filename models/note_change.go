@@ -45,6 +45,7 @@ type NoteFragment struct {
 	Tags        sql.NullString // New tags (if changed)
 	IsPrivate   sql.NullBool   // New privacy value (if changed)
 	Categories  sql.NullString // JSON array of category changes
+	Starred     sql.NullBool   // New starred value (if changed)
 	BodyIsDiff  bool           // True if Body contains a diff patch rather than full snapshot
 }
 
@@ -57,6 +58,7 @@ const (
 	FragmentTags        = 0x10 // 16  - bit 4
 	FragmentIsPrivate   = 0x08 // 8   - bit 3
 	FragmentCategories  = 0x04 // 4   - bit 2
+	FragmentStarred     = 0x02 // 2   - bit 1
 )
 
 // NoteChangeSyncPeer tracks which peers have received each change
@@ -83,7 +85,8 @@ CREATE TABLE IF NOT EXISTS note_fragments (
     tags        VARCHAR,
     is_private  BOOLEAN,
     categories  VARCHAR,
-    body_is_diff BOOLEAN DEFAULT false
+    body_is_diff BOOLEAN DEFAULT false,
+    starred     BOOLEAN
 );
 `
 
@@ -180,16 +183,14 @@ func sqlNullStringEqualsPointer(ns sql.NullString, sp *string) bool {
 }
 
 // computeBodyDiff generates a unified diff patch from oldBody to newBody.
-// Uses diff-match-patch for efficient text diffing. Returns the patch text
-// and a boolean indicating whether the diff is smaller than the full new body.
-// If the diff is larger, the caller should fall back to a full snapshot to
-// avoid bloating the change log for complete rewrites.
+// Uses diff-match-patch for efficient text diffing, at the granularity set by
+// BodyDiffGranularity. Returns the patch text and a boolean indicating whether
+// the diff is smaller than the full new body. If the diff is larger, the
+// caller should fall back to a full snapshot to avoid bloating the change log
+// for complete rewrites.
 func computeBodyDiff(oldBody, newBody string) (diffText string, isDiffSmaller bool) {
 	dmp := diffmatchpatch.New()
-	// Compute line-level diff for better readability and efficiency
-	charsA, charsB, lineArray := dmp.DiffLinesToChars(oldBody, newBody)
-	diffs := dmp.DiffMain(charsA, charsB, false)
-	diffs = dmp.DiffCharsToLines(diffs, lineArray)
+	diffs := diffBodies(dmp, oldBody, newBody, BodyDiffGranularity())
 	patches := dmp.PatchMake(oldBody, diffs)
 	patchText := dmp.PatchToText(patches)
 
@@ -221,6 +222,23 @@ func applyBodyDiff(currentBody, patchText string) (string, error) {
 	return result, nil
 }
 
+// bodyDiffFunc is the diff generator used by createDeltaFragment.
+// It is a variable so tests can substitute a generator that produces
+// patches which do not reconstruct the new body.
+var bodyDiffFunc = computeBodyDiff
+
+// bodyDiffRoundTrips reports whether applying patchText to oldBody reproduces
+// newBody exactly. A patch that fails this check would silently corrupt history
+// when a peer reconstructs the body during sync, so callers must fall back to a
+// full snapshot.
+func bodyDiffRoundTrips(oldBody, newBody, patchText string) bool {
+	result, err := applyBodyDiff(oldBody, patchText)
+	if err != nil {
+		return false
+	}
+	return result == newBody
+}
+
 // createFragmentFromInput creates a NoteFragment with all fields from input.
 // Used for create operations where everything is "changed".
 // Body is always stored as full snapshot for creates (no diff against nothing).
@@ -255,6 +273,8 @@ func createFragmentFromInput(input NoteInput, bitmask int16) NoteFragment {
 // Used for update operations where only modified fields are stored.
 // When the body changed, it computes a diff against the existing body and stores
 // the diff if it's smaller than the full new body (otherwise falls back to snapshot).
+// The diff is only kept if it round-trips: applying it to the existing body must
+// reproduce the new body exactly, otherwise the full snapshot is stored instead.
 func createDeltaFragment(existing *Note, input NoteInput, bitmask int16) NoteFragment {
 	fragment := createFragmentFromInput(input, bitmask)
 
@@ -265,10 +285,15 @@ func createDeltaFragment(existing *Note, input NoteInput, bitmask int16) NoteFra
 			existingBody = existing.Body.String
 		}
 
-		diffText, isDiffSmaller := computeBodyDiff(existingBody, *input.Body)
+		diffText, isDiffSmaller := bodyDiffFunc(existingBody, *input.Body)
 		if isDiffSmaller {
-			fragment.Body = sql.NullString{String: diffText, Valid: true}
-			fragment.BodyIsDiff = true
+			if bodyDiffRoundTrips(existingBody, *input.Body, diffText) {
+				fragment.Body = sql.NullString{String: diffText, Valid: true}
+				fragment.BodyIsDiff = true
+			} else {
+				logger.Warn("Body diff failed round-trip verification, storing full snapshot",
+					"note_guid", existing.GUID)
+			}
 		}
 		// else: keep full snapshot (default from createFragmentFromInput)
 	}
@@ -282,8 +307,8 @@ func createDeltaFragment(existing *Note, input NoteInput, bitmask int16) NoteFra
 // (true) or a full body snapshot (false).
 func insertNoteFragment(fragment NoteFragment) (int64, error) {
 	query := `
-		INSERT INTO note_fragments (bitmask, title, description, body, tags, is_private, categories, body_is_diff)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO note_fragments (bitmask, title, description, body, tags, is_private, categories, body_is_diff, starred)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 		RETURNING id
 	`
 
@@ -298,6 +323,7 @@ func insertNoteFragment(fragment NoteFragment) (int64, error) {
 		fragment.IsPrivate,
 		fragment.Categories,
 		fragment.BodyIsDiff,
+		fragment.Starred,
 	).Scan(&fragmentID)
 
 	if err != nil {
@@ -310,17 +336,25 @@ func insertNoteFragment(fragment NoteFragment) (int64, error) {
 // insertNoteChange records a note change to the database
 // This is the core tracking function called by CRUD operations
 func insertNoteChange(changeGUID, noteGUID string, operation int32, fragmentID sql.NullInt64, user string) error {
+	return insertNoteChangeFromPeer(changeGUID, noteGUID, operation, fragmentID, user, "")
+}
+
+// insertNoteChangeFromPeer records a note change that was applied from another
+// peer. originPeer is stored so the change is never sent back to that peer;
+// an empty originPeer marks a local change.
+func insertNoteChangeFromPeer(changeGUID, noteGUID string, operation int32, fragmentID sql.NullInt64, user, originPeer string) error {
 	query := `
-		INSERT INTO note_changes (guid, note_guid, operation, note_fragment_id, user)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO note_changes (guid, note_guid, operation, note_fragment_id, user, origin_peer)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`
 
 	userVal := sql.NullString{}
 	if user != "" {
 		userVal = sql.NullString{String: user, Valid: true}
 	}
+	originVal := sql.NullString{String: originPeer, Valid: originPeer != ""}
 
-	_, err := db.Exec(query, changeGUID, noteGUID, operation, fragmentID, userVal)
+	_, err := db.Exec(query, changeGUID, noteGUID, operation, fragmentID, userVal, originVal)
 	if err != nil {
 		return serr.Wrap(err, "failed to insert note change")
 	}
@@ -333,7 +367,7 @@ func insertNoteChange(changeGUID, noteGUID string, operation int32, fragmentID s
 // whether the body is a diff patch or full snapshot.
 func GetNoteFragment(id int64) (*NoteFragment, error) {
 	query := `
-		SELECT id, bitmask, title, description, body, tags, is_private, categories, body_is_diff
+		SELECT id, bitmask, title, description, body, tags, is_private, categories, body_is_diff, starred
 		FROM note_fragments
 		WHERE id = ?
 	`
@@ -349,6 +383,7 @@ func GetNoteFragment(id int64) (*NoteFragment, error) {
 		&fragment.IsPrivate,
 		&fragment.Categories,
 		&fragment.BodyIsDiff,
+		&fragment.Starred,
 	)
 
 	if err == sql.ErrNoRows {
@@ -364,11 +399,13 @@ func GetNoteFragment(id int64) (*NoteFragment, error) {
 // Sync Functions for Peer-to-Peer
 
 // MarkChangeSyncedToPeer records that a change has been synced to a specific peer
-// This prevents the change from being sent to that peer again
+// This prevents the change from being sent to that peer again. Marking a change
+// that is already marked (e.g. when SyncNow overlaps a timer cycle) is a no-op.
 func MarkChangeSyncedToPeer(noteChangeID int64, peerID string) error {
 	query := `
 		INSERT INTO note_change_sync_peers (note_change_id, peer_id)
 		VALUES (?, ?)
+		ON CONFLICT DO NOTHING
 	`
 
 	_, err := db.Exec(query, noteChangeID, peerID)
@@ -379,14 +416,56 @@ func MarkChangeSyncedToPeer(noteChangeID int64, peerID string) error {
 	return nil
 }
 
+// MarkChangesSyncedToPeerBatch is MarkChangeSyncedToPeer for many changes
+// at once, in a single multi-row INSERT. Changes already marked are skipped.
+func MarkChangesSyncedToPeerBatch(noteChangeIDs []int64, peerID string) error {
+	if err := insertSyncedToPeerRows(db, "note_change_sync_peers", "note_change_id", noteChangeIDs, peerID); err != nil {
+		return serr.Wrap(err, "failed to mark changes as synced to peer")
+	}
+	return nil
+}
+
 // GetUnsentChangesForPeer retrieves changes that haven't been sent to a specific peer.
 // Returns up to 'limit' changes, ordered by creation time (oldest first).
+// Changes that originated from the peer itself are excluded to prevent sync loops.
 // When userGUID is non-empty, only changes for notes owned by that user are returned
 // (multi-user hub isolation). When empty, all changes are returned (single-user spoke).
 func GetUnsentChangesForPeer(peerID string, userGUID string, limit int) ([]NoteChange, error) {
+	return getUnsentChangesForPeer(peerID, userGUID, "", limit)
+}
+
+// noteInCategoryFilter restricts a note_changes query (aliased nc) to notes
+// that are in a category, or were at some point: any of the note's recorded
+// category mappings names it. The second condition keeps a note that leaves
+// the category in the feed, so a category-scoped peer still receives the
+// mapping change that removes it. Binds the category GUID twice.
+const noteInCategoryFilter = `
+			AND (nc.note_guid IN (
+				SELECT n2.guid FROM notes n2
+				INNER JOIN note_categories ncat ON ncat.note_id = n2.id
+				INNER JOIN categories c2 ON c2.id = ncat.category_id
+				WHERE c2.guid = ?
+			) OR nc.note_guid IN (
+				SELECT nc2.note_guid FROM note_changes nc2
+				INNER JOIN note_fragments f2 ON f2.id = nc2.note_fragment_id
+				WHERE f2.categories IS NOT NULL
+				AND list_contains(json_extract_string(f2.categories, '$[*].category_guid'), ?)
+			))`
+
+// getUnsentChangesForPeer implements GetUnsentChangesForPeer. A non-empty
+// categoryGUID restricts the result to changes of notes in that category
+// (see noteInCategoryFilter).
+func getUnsentChangesForPeer(peerID, userGUID, categoryGUID string, limit int) ([]NoteChange, error) {
 	var query string
 	var args []any
 
+	categoryFilter := ""
+	var categoryArgs []any
+	if categoryGUID != "" {
+		categoryFilter = noteInCategoryFilter
+		categoryArgs = []any{categoryGUID, categoryGUID}
+	}
+
 	if userGUID != "" {
 		// Multi-user hub: filter to only the authenticated user's notes
 		query = `
@@ -398,10 +477,11 @@ func GetUnsentChangesForPeer(peerID string, userGUID string, limit int) ([]NoteC
 				FROM note_change_sync_peers
 				WHERE peer_id = ?
 			)
+			AND (nc.origin_peer IS NULL OR nc.origin_peer <> ?)` + categoryFilter + `
 			ORDER BY nc.created_at ASC
 			LIMIT ?
 		`
-		args = []any{userGUID, peerID, limit}
+		args = append(append([]any{userGUID, peerID, peerID}, categoryArgs...), limit)
 	} else {
 		// Single-user spoke: no user filter needed
 		query = `
@@ -412,10 +492,11 @@ func GetUnsentChangesForPeer(peerID string, userGUID string, limit int) ([]NoteC
 				FROM note_change_sync_peers
 				WHERE peer_id = ?
 			)
+			AND (nc.origin_peer IS NULL OR nc.origin_peer <> ?)` + categoryFilter + `
 			ORDER BY nc.created_at ASC
 			LIMIT ?
 		`
-		args = []any{peerID, limit}
+		args = append(append([]any{peerID, peerID}, categoryArgs...), limit)
 	}
 
 	rows, err := db.Query(query, args...)
@@ -567,3 +648,24 @@ func GetUserChangesSince(userGUID string, since time.Time, limit int) ([]NoteCha
 
 	return changes, nil
 }
+
+// CountUserAuthoredChanges returns how many note and category changes were
+// made on this instance by the user, for reporting activity. Changes applied
+// from peers are excluded: they are kept for sync bookkeeping but weren't
+// authored here. Most are recorded as OperationSync, but synced deletes keep
+// OperationDelete, so changes with an origin_peer are excluded too. An empty
+// userGUID counts every user's changes.
+func CountUserAuthoredChanges(userGUID string) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM note_changes
+			 WHERE operation != ? AND origin_peer IS NULL AND (? = '' OR user = ?)) +
+			(SELECT COUNT(*) FROM category_changes
+			 WHERE operation != ? AND origin_peer IS NULL AND (? = '' OR user = ?))
+	`, OperationSync, userGUID, userGUID, OperationSync, userGUID, userGUID).Scan(&count)
+	if err != nil {
+		return 0, serr.Wrap(err, "failed to count user-authored changes")
+	}
+	return count, nil
+}
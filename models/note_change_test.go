@@ -1,8 +1,15 @@
 package models_test
 
 import (
+	"database/sql"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
 
 	"gonotes/models"
 )
@@ -39,7 +46,7 @@ func TestNoteChangeOnCreate(t *testing.T) {
 	// Create a note
 	descr := "Test description"
 	body := "Test body"
-	tags := "test,note"
+	tags := "note,test"
 	input := models.NoteInput{
 		GUID:        "note-change-create-test",
 		Title:       "Test Note",
@@ -209,6 +216,75 @@ func TestNoteChangeOnUpdate(t *testing.T) {
 	}
 }
 
+// TestNoteChangeOnPatch verifies that patching only the body leaves the
+// other fields as they were and records a change with only the body bit set.
+func TestNoteChangeOnPatch(t *testing.T) {
+	cleanup := setupNoteChangeTestDB(t)
+	defer cleanup()
+
+	descr := "Kept description"
+	body := "Original body"
+	tags := "keep,these"
+	note, err := models.CreateNote(models.NoteInput{
+		GUID:        "note-change-patch-test",
+		Title:       "Kept Title",
+		Description: &descr,
+		Body:        &body,
+		Tags:        &tags,
+		IsPrivate:   true,
+	}, ncTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	createChanges, _ := models.GetUnsentChangesForPeer("peer1", "", 10)
+	if len(createChanges) > 0 {
+		models.MarkChangeSyncedToPeer(createChanges[0].ID, "peer1")
+	}
+
+	newBody := "Patched body"
+	patched, err := models.PatchNote(note.ID, models.NotePatch{Body: &newBody}, ncTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to patch note: %v", err)
+	}
+	if patched == nil {
+		t.Fatal("expected patched note")
+	}
+
+	if patched.Body.String != newBody {
+		t.Errorf("expected body %q, got %q", newBody, patched.Body.String)
+	}
+	if patched.Title != "Kept Title" || patched.Description.String != descr ||
+		patched.Tags.String != tags || !patched.IsPrivate {
+		t.Errorf("expected unpatched fields unchanged, got title=%q description=%q tags=%q is_private=%v",
+			patched.Title, patched.Description.String, patched.Tags.String, patched.IsPrivate)
+	}
+
+	changes, err := models.GetUnsentChangesForPeer("peer1", "", 10)
+	if err != nil {
+		t.Fatalf("failed to get unsent changes: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(changes))
+	}
+
+	fragment, err := models.GetNoteFragment(changes[0].NoteFragmentID.Int64)
+	if err != nil {
+		t.Fatalf("failed to get note fragment: %v", err)
+	}
+	if fragment.Bitmask != models.FragmentBody {
+		t.Errorf("expected bitmask %d (Body only), got %d", models.FragmentBody, fragment.Bitmask)
+	}
+
+	// An empty patch changes nothing and records no change
+	if _, err := models.PatchNote(note.ID, models.NotePatch{}, ncTestUserGUID); err != nil {
+		t.Fatalf("failed to apply empty patch: %v", err)
+	}
+	if changes, _ := models.GetUnsentChangesForPeer("peer1", "", 10); len(changes) != 1 {
+		t.Errorf("expected empty patch to record no change, got %d changes", len(changes))
+	}
+}
+
 // TestNoteChangeOnDelete verifies that delete changes are recorded without a fragment
 func TestNoteChangeOnDelete(t *testing.T) {
 	cleanup := setupNoteChangeTestDB(t)
@@ -356,6 +432,19 @@ func TestMarkChangeSyncedToPeer(t *testing.T) {
 		t.Fatalf("failed to mark change as synced: %v", err)
 	}
 
+	// Marking it again, as an overlapping sync cycle would, is a no-op
+	if err := models.MarkChangeSyncedToPeer(changeID, "peer1"); err != nil {
+		t.Fatalf("expected re-marking a synced change to succeed, got %v", err)
+	}
+	var rows int
+	if err := models.DB().QueryRow(`SELECT COUNT(*) FROM note_change_sync_peers
+		WHERE note_change_id = ? AND peer_id = 'peer1'`, changeID).Scan(&rows); err != nil {
+		t.Fatalf("failed to count sync rows: %v", err)
+	}
+	if rows != 1 {
+		t.Errorf("expected 1 sync row after marking twice, got %d", rows)
+	}
+
 	// Should now be empty for peer1
 	changesAfter, err := models.GetUnsentChangesForPeer("peer1", "", 10)
 	if err != nil {
@@ -529,3 +618,213 @@ func TestGetNoteChangeWithFragment(t *testing.T) {
 		t.Errorf("expected fragment title 'Output Test', got %s", changeOutput.Fragment.Title.String)
 	}
 }
+
+// TestDiffNoteRevisions verifies that a diff between two revisions, applied to
+// the "from" body, yields the "to" body — including when revisions were stored
+// as body diffs rather than full snapshots.
+func TestDiffNoteRevisions(t *testing.T) {
+	cleanup := setupNoteChangeTestDB(t)
+	defer cleanup()
+
+	// Long enough that small edits are stored as diffs
+	base := strings.Repeat("A line of note content that stays the same.\n", 30)
+	bodies := []string{
+		base + "first ending\n",
+		base + "second ending\n",
+		"new opening\n" + base + "second ending\n",
+	}
+
+	note, err := models.CreateNote(models.NoteInput{GUID: "revision-diff-test", Title: "Revisions", Body: &bodies[0]}, ncTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	for _, body := range bodies[1:] {
+		b := body
+		if _, err := models.UpdateNote(note.ID, models.NoteInput{Title: "Revisions", Body: &b}, ncTestUserGUID); err != nil {
+			t.Fatalf("failed to update note: %v", err)
+		}
+	}
+
+	changes, err := models.GetUserChangesSince(ncTestUserGUID, time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("failed to get changes: %v", err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %d", len(changes))
+	}
+
+	for i, ch := range changes {
+		got, err := models.ReconstructNoteBody(note.GUID, ch.ID)
+		if err != nil {
+			t.Fatalf("failed to reconstruct revision %d: %v", i, err)
+		}
+		if got != bodies[i] {
+			t.Errorf("revision %d: reconstructed body mismatch", i)
+		}
+	}
+
+	dmp := diffmatchpatch.New()
+	check := func(name string, from, to int64, fromBody, toBody string) {
+		t.Helper()
+		patch, err := models.DiffNoteRevisions(note.GUID, from, to)
+		if err != nil {
+			t.Fatalf("%s: DiffNoteRevisions failed: %v", name, err)
+		}
+		patches, err := dmp.PatchFromText(patch)
+		if err != nil {
+			t.Fatalf("%s: invalid patch: %v", name, err)
+		}
+		result, _ := dmp.PatchApply(patches, fromBody)
+		if result != toBody {
+			t.Errorf("%s: applying patch to from-body did not yield to-body", name)
+		}
+	}
+
+	check("consecutive", changes[1].ID, changes[2].ID, bodies[1], bodies[2])
+	check("from creation", 0, changes[2].ID, bodies[0], bodies[2])
+
+	if _, err := models.DiffNoteRevisions(note.GUID, 0, 999999); err != models.ErrRevisionNotFound {
+		t.Errorf("expected ErrRevisionNotFound for unknown change, got %v", err)
+	}
+}
+
+// TestConcurrentNoteUpdates verifies that concurrent updates of one note are
+// recorded as sequential changes, each computed against the state the
+// previous update left, so replaying the change log yields the final body.
+func TestConcurrentNoteUpdates(t *testing.T) {
+	cleanup := setupNoteChangeTestDB(t)
+	defer cleanup()
+
+	// Long enough that each edit is stored as a diff
+	lines := make([]string, 40)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("Line %d of a note edited from several places at once.", i)
+	}
+	base := strings.Join(lines, "\n")
+
+	note, err := models.CreateNote(models.NoteInput{GUID: "concurrent-update-test", Title: "Concurrent", Body: &base}, ncTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	// Each writer replaces one distinct line of the original body
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		edited := make([]string, len(lines))
+		copy(edited, lines)
+		edited[w*5] = fmt.Sprintf("Line %d rewritten by writer %d.", w*5, w)
+		body := strings.Join(edited, "\n")
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := models.UpdateNote(note.ID, models.NoteInput{Title: "Concurrent", Body: &body}, ncTestUserGUID); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("failed to update note: %v", err)
+	}
+
+	changes, err := models.GetUserChangesSince(ncTestUserGUID, time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("failed to get changes: %v", err)
+	}
+	if len(changes) != writers+1 {
+		t.Fatalf("expected %d changes, got %d", writers+1, len(changes))
+	}
+
+	final, err := models.GetNoteByID(note.ID, ncTestUserGUID)
+	if err != nil || final == nil {
+		t.Fatalf("failed to get note: %v", err)
+	}
+	replayed, err := models.ReconstructNoteBody(note.GUID, changes[len(changes)-1].ID)
+	if err != nil {
+		t.Fatalf("failed to reconstruct body: %v", err)
+	}
+	if replayed != final.Body.String {
+		t.Errorf("replayed change log doesn't match the note body:\ngot  %q\nwant %q", replayed, final.Body.String)
+	}
+}
+
+// TestConcurrentSyncAndLocalUpdates verifies that sync updates applied while
+// local updates of the same note run are serialized with them, so replaying
+// the change log still yields the final body.
+func TestConcurrentSyncAndLocalUpdates(t *testing.T) {
+	cleanup := setupNoteChangeTestDB(t)
+	defer cleanup()
+
+	lines := make([]string, 40)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("Line %d of a note edited here and on a peer at once.", i)
+	}
+	base := strings.Join(lines, "\n")
+
+	note, err := models.CreateNote(models.NoteInput{GUID: "concurrent-sync-test", Title: "Concurrent", Body: &base}, ncTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	// Local writers each replace a line of the original; peers each send a
+	// diff against the original that replaces a different line
+	const writers = 8
+	dmp := diffmatchpatch.New()
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*writers)
+	for w := 0; w < writers; w++ {
+		local := make([]string, len(lines))
+		copy(local, lines)
+		local[w*5] = fmt.Sprintf("Line %d rewritten locally by writer %d.", w*5, w)
+		localBody := strings.Join(local, "\n")
+
+		remote := make([]string, len(lines))
+		copy(remote, lines)
+		remote[w*5+2] = fmt.Sprintf("Line %d rewritten on peer %d.", w*5+2, w)
+		diff := dmp.PatchToText(dmp.PatchMake(base, strings.Join(remote, "\n")))
+		fragment := models.NoteFragment{
+			Bitmask:    models.FragmentBody,
+			Body:       sql.NullString{String: diff, Valid: true},
+			BodyIsDiff: true,
+		}
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := models.UpdateNote(note.ID, models.NoteInput{Title: "Concurrent", Body: &localBody}, ncTestUserGUID); err != nil {
+				errs <- err
+			}
+		}()
+		go func(peer string) {
+			defer wg.Done()
+			if err := models.ApplySyncNoteUpdate(note.GUID, fragment, time.Now(), ncTestUserGUID, peer); err != nil {
+				errs <- err
+			}
+		}(fmt.Sprintf("peer-%d", w))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("failed to update note: %v", err)
+	}
+
+	final, err := models.GetNoteByID(note.ID, ncTestUserGUID)
+	if err != nil || final == nil {
+		t.Fatalf("failed to get note: %v", err)
+	}
+	var lastChangeID int64
+	if err := models.DB().QueryRow(`SELECT MAX(id) FROM note_changes WHERE note_guid = ?`, note.GUID).Scan(&lastChangeID); err != nil {
+		t.Fatalf("failed to get last change: %v", err)
+	}
+	replayed, err := models.ReconstructNoteBody(note.GUID, lastChangeID)
+	if err != nil {
+		t.Fatalf("failed to reconstruct body: %v", err)
+	}
+	if replayed != final.Body.String {
+		t.Errorf("replayed change log doesn't match the note body:\ngot  %q\nwant %q", replayed, final.Body.String)
+	}
+}
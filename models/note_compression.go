@@ -0,0 +1,117 @@
+package models
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/base64"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Note Body Compression
+//
+// With a threshold configured, note bodies at least that many bytes long are
+// gzip-compressed on disk and flagged with notes.body_compressed. The body
+// column is VARCHAR, so the compressed bytes are stored base64-encoded. Only
+// the disk database is compressed: the cache keeps plaintext bodies, as it
+// already does for private notes, so reads and search never pay for
+// decompression. Compression happens before encryption (ciphertext doesn't
+// compress), so reading a body from disk decrypts first, then decompresses.
+// Sync is unaffected: change fragments and snapshots carry plaintext, and a
+// receiving peer compresses according to its own threshold.
+// ============================================================================
+
+// BodyCompressionThresholdEnvVar sets the body size, in bytes, at which note
+// bodies are compressed on disk. Unset, zero, or invalid disables compression.
+const BodyCompressionThresholdEnvVar = "GONOTES_BODY_COMPRESSION_THRESHOLD"
+
+// BodyCompressionThreshold returns the configured compression threshold in
+// bytes, or zero if compression is disabled.
+func BodyCompressionThreshold() int {
+	thresholdStr := os.Getenv(BodyCompressionThresholdEnvVar)
+	if thresholdStr == "" {
+		return 0
+	}
+	threshold, err := strconv.Atoi(thresholdStr)
+	if err != nil || threshold < 0 {
+		logger.Warn("Ignoring invalid "+BodyCompressionThresholdEnvVar, "value", thresholdStr)
+		return 0
+	}
+	return threshold
+}
+
+// compressBodyForDisk returns the body as it should be written to the disk
+// database, and whether it was compressed. Bodies below the threshold, and
+// all bodies when compression is disabled, are returned unchanged.
+func compressBodyForDisk(body *string) (sql.NullString, bool, error) {
+	threshold := BodyCompressionThreshold()
+	if body == nil || threshold <= 0 || len(*body) < threshold {
+		return toNullString(body), false, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(*body)); err != nil {
+		return sql.NullString{}, false, serr.Wrap(err, "failed to compress note body")
+	}
+	if err := zw.Close(); err != nil {
+		return sql.NullString{}, false, serr.Wrap(err, "failed to compress note body")
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+	return sql.NullString{String: encoded, Valid: true}, true, nil
+}
+
+// decompressBody reverses compressBodyForDisk for a stored body.
+func decompressBody(stored string) (string, error) {
+	compressed, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return "", serr.Wrap(err, "failed to decode compressed note body")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", serr.Wrap(err, "failed to open compressed note body")
+	}
+	defer zr.Close()
+
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		return "", serr.Wrap(err, "failed to decompress note body")
+	}
+	return string(plain), nil
+}
+
+// decodeDiskBody replaces a note body read from the disk database with its
+// plaintext: it decrypts private notes, then decompresses compressed bodies.
+// On error the body is left as stored.
+func decodeDiskBody(note *Note, compressed bool) error {
+	if !note.Body.Valid {
+		return nil
+	}
+	body := note.Body.String
+
+	if note.IsPrivate && IsEncryptionEnabled() && note.EncryptionIV.Valid {
+		decrypted, err := DecryptNoteBody(body, note.EncryptionIV.String)
+		if err != nil {
+			return err
+		}
+		body = decrypted
+	}
+
+	if compressed {
+		decompressed, err := decompressBody(body)
+		if err != nil {
+			return err
+		}
+		body = decompressed
+	}
+
+	note.Body = sql.NullString{String: body, Valid: true}
+	return nil
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Note Counts
+//
+// Listings are paginated, so a client can't tell from a page how many notes
+// match in total. CountNotes answers that with a COUNT over the cache using
+// the same conditions as the corresponding list query, so GET
+// /api/v1/notes?with_total=true can report a total without fetching rows.
+// ============================================================================
+
+// NoteListFilter holds the filters GET /api/v1/notes applies, so a count can
+// match a filtered listing. Zero values mean no filter.
+type NoteListFilter struct {
+	Category      string       // Category name (cat)
+	Subcategories []string     // Subcategories the note must all have within Category (subcats[])
+	ModifiedSince time.Time    // Only notes updated after this time (modified_since)
+	Created       CreatedRange // Only notes created within this range (created_after, created_before)
+	Starred       bool         // Only starred notes (starred=true)
+}
+
+// CountNotes counts the user's non-deleted notes matching filter, for
+// pagination totals. It applies the same conditions as ListNotes,
+// ListNotesModifiedSince, GetNotesByCategoryName, and
+// GetNotesByCategoryAndSubcategories. As in the handler, ModifiedSince takes
+// precedence over the category filters; Created and Starred combine with any
+// of them.
+func CountNotes(userGUID string, filter NoteListFilter) (int, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return 0, err
+	}
+
+	query := `SELECT COUNT(DISTINCT n.id) FROM notes n`
+	where := []string{"n.created_by = ?", "n.deleted_at IS NULL"}
+	args := []any{userGUID}
+
+	switch {
+	case !filter.ModifiedSince.IsZero():
+		where = append(where, "n.updated_at > ?")
+		args = append(args, filter.ModifiedSince)
+
+	case filter.Category != "" && len(filter.Subcategories) > 0:
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.Subcategories)), ", ")
+		query = `WITH nc AS (
+				SELECT note_id, category_id,
+					json_extract_string(subcategories, '$[*]')::VARCHAR[] AS subcats
+				FROM note_categories
+				WHERE subcategories IS NOT NULL
+			)
+			SELECT COUNT(DISTINCT n.id) FROM notes n
+			INNER JOIN nc ON n.id = nc.note_id
+			INNER JOIN categories c ON nc.category_id = c.id`
+		where = append(where, "c.name = ?", "c.created_by = n.created_by",
+			"list_has_all(nc.subcats, ["+placeholders+"]::VARCHAR[])")
+		args = append(args, filter.Category)
+		for _, subcat := range filter.Subcategories {
+			args = append(args, subcat)
+		}
+
+	case filter.Category != "":
+		query += `
+			INNER JOIN note_categories nc ON n.id = nc.note_id
+			INNER JOIN categories c ON nc.category_id = c.id`
+		where = append(where, "c.name = ?", "c.created_by = n.created_by")
+		args = append(args, filter.Category)
+	}
+
+	if cond, condArgs := filter.Created.sqlCondition("n.created_at"); cond != "" {
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+	if filter.Starred {
+		where = append(where, "n.starred")
+	}
+
+	query += " WHERE " + strings.Join(where, " AND ")
+
+	var count int
+	if err := cacheDB.QueryRow(query, args...).Scan(&count); err != nil {
+		return 0, serr.Wrap(err, "failed to count notes")
+	}
+	return count, nil
+}
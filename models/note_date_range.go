@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+// ============================================================================
+// Created-Date Ranges
+//
+// GET /api/v1/notes?created_after=&created_before= lists the notes created
+// within a period. Listings paginated in SQL add the range to their WHERE
+// clause; the modified_since listing, which fetches every match and
+// paginates afterwards, filters with Filter first.
+// ============================================================================
+
+// CreatedRange bounds a listing by note created_at, inclusive at both ends.
+// A zero After or Before leaves that end open.
+type CreatedRange struct {
+	After  time.Time
+	Before time.Time
+}
+
+// IsZero reports whether the range is unbounded.
+func (r CreatedRange) IsZero() bool {
+	return r.After.IsZero() && r.Before.IsZero()
+}
+
+// Contains reports whether t falls within the range.
+func (r CreatedRange) Contains(t time.Time) bool {
+	return (r.After.IsZero() || !t.Before(r.After)) && (r.Before.IsZero() || !t.After(r.Before))
+}
+
+// Filter returns the notes created within the range.
+func (r CreatedRange) Filter(notes []Note) []Note {
+	if r.IsZero() {
+		return notes
+	}
+	var filtered []Note
+	for _, note := range notes {
+		if r.Contains(note.CreatedAt) {
+			filtered = append(filtered, note)
+		}
+	}
+	return filtered
+}
+
+// sqlCondition returns the WHERE condition bounding column to the range,
+// and its arguments, or "" for an unbounded range.
+func (r CreatedRange) sqlCondition(column string) (string, []any) {
+	switch {
+	case !r.After.IsZero() && !r.Before.IsZero():
+		return column + " BETWEEN ? AND ?", []any{r.After, r.Before}
+	case !r.After.IsZero():
+		return column + " >= ?", []any{r.After}
+	case !r.Before.IsZero():
+		return column + " <= ?", []any{r.Before}
+	}
+	return "", nil
+}
+
+// appendNotePageClauses adds the created range condition, newest-first
+// ordering, and LIMIT/OFFSET (when limit > 0) to a notes query whose WHERE
+// clause ends the query so far. Notes are aliased n. Ties on created_at are
+// broken by id so pages don't overlap.
+func appendNotePageClauses(query string, args []interface{}, created CreatedRange, limit, offset int) (string, []interface{}) {
+	if cond, condArgs := created.sqlCondition("n.created_at"); cond != "" {
+		query += " AND " + cond
+		args = append(args, condArgs...)
+	}
+	query += " ORDER BY n.created_at DESC, n.id DESC"
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	}
+	return query, args
+}
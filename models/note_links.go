@@ -0,0 +1,202 @@
+package models
+
+import (
+	"database/sql"
+	"regexp"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Note Links and Backlinks
+//
+// A note links to another by embedding [[note:<guid>|<title>]] in its body,
+// the syntax the editor's link dialog inserts. note_links records one row per
+// distinct (source, target) pair and is rewritten from the body whenever a
+// note's body is saved, locally or from sync, so a target's backlinks are a
+// single indexed lookup. The table is derived data on disk only: it isn't
+// cached or synced, since each peer rebuilds it from the bodies it holds.
+// Links may name notes that don't exist (yet); they surface once the target
+// does. Backlinks only include sources owned by the target's owner and not
+// in the trash.
+// ============================================================================
+
+const DDLCreateNoteLinksTable = `
+CREATE TABLE IF NOT EXISTS note_links (
+    source_note_guid VARCHAR NOT NULL,
+    target_note_guid VARCHAR NOT NULL,
+    PRIMARY KEY (source_note_guid, target_note_guid)
+);
+`
+
+const DDLCreateNoteLinksIndexTarget = `CREATE INDEX IF NOT EXISTS idx_note_links_target ON note_links(target_note_guid);`
+
+// noteLinkPattern matches [[note:<guid>|<display text>]], capturing the GUID.
+// It mirrors the pattern the frontend renders links from.
+var noteLinkPattern = regexp.MustCompile(
+	`(?i)\[\[note:([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})\|[^\]]+\]\]`)
+
+// ExtractNoteLinks returns the normalized GUIDs of the notes body links to,
+// in order of first appearance and without duplicates.
+func ExtractNoteLinks(body string) []string {
+	var guids []string
+	seen := make(map[string]bool)
+	for _, match := range noteLinkPattern.FindAllStringSubmatch(body, -1) {
+		guid := NormalizeGUID(match[1])
+		if !seen[guid] {
+			seen[guid] = true
+			guids = append(guids, guid)
+		}
+	}
+	return guids
+}
+
+// setNoteLinks replaces the links recorded for sourceGUID with those found
+// in its body. A note linking to itself isn't recorded.
+func setNoteLinks(sourceGUID string, body sql.NullString) error {
+	if _, err := db.Exec(`DELETE FROM note_links WHERE source_note_guid = ?`, sourceGUID); err != nil {
+		return serr.Wrap(err, "failed to clear note links", "note_guid", sourceGUID)
+	}
+	if !body.Valid {
+		return nil
+	}
+
+	for _, targetGUID := range ExtractNoteLinks(body.String) {
+		if targetGUID == sourceGUID {
+			continue
+		}
+		if _, err := db.Exec(`INSERT INTO note_links (source_note_guid, target_note_guid) VALUES (?, ?)`,
+			sourceGUID, targetGUID); err != nil {
+			return serr.Wrap(err, "failed to record note link", "note_guid", sourceGUID, "target_guid", targetGUID)
+		}
+	}
+	return nil
+}
+
+// recordNoteLinks updates note_links for a saved body. Like change
+// recording, a failure is logged rather than failing the save.
+func recordNoteLinks(sourceGUID string, body sql.NullString) {
+	if err := setNoteLinks(sourceGUID, body); err != nil {
+		logger.LogErr(err, "failed to update note links", "note_guid", sourceGUID)
+	}
+}
+
+// backfillNoteLinks fills an empty note_links table from the cached (plaintext)
+// bodies, so databases created before links were tracked get their existing
+// links. It runs at startup after the cache is loaded.
+func backfillNoteLinks() error {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM note_links`).Scan(&count); err != nil {
+		return serr.Wrap(err, "failed to count note links")
+	}
+	if count > 0 {
+		return nil
+	}
+
+	rows, err := cacheDB.Query(`SELECT guid, body FROM notes WHERE body LIKE '%[[note:%'`)
+	if err != nil {
+		return serr.Wrap(err, "failed to query note bodies for links")
+	}
+	type noteBody struct {
+		guid string
+		body sql.NullString
+	}
+	var bodies []noteBody
+	for rows.Next() {
+		var nb noteBody
+		if err := rows.Scan(&nb.guid, &nb.body); err != nil {
+			rows.Close()
+			return serr.Wrap(err, "failed to scan note body for links")
+		}
+		bodies = append(bodies, nb)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return serr.Wrap(err, "failed to read note bodies for links")
+	}
+
+	for _, nb := range bodies {
+		if err := setNoteLinks(nb.guid, nb.body); err != nil {
+			return err
+		}
+	}
+	if len(bodies) > 0 {
+		logger.Info("Backfilled note links", "notes", len(bodies))
+	}
+	return nil
+}
+
+// GetBacklinks returns the notes that link to the note with noteGUID, most
+// recently updated first. Only non-deleted notes owned by the same user as
+// the target are returned; an unknown target has no backlinks.
+func GetBacklinks(noteGUID string) ([]Note, error) {
+	noteGUID = NormalizeGUID(noteGUID)
+
+	// The owner comes from disk so a lazy cache that hasn't loaded the
+	// target yet still finds it
+	var ownerGUID sql.NullString
+	err := db.QueryRow(`SELECT created_by FROM notes WHERE guid = ?`, noteGUID).Scan(&ownerGUID)
+	if err == sql.ErrNoRows {
+		return []Note{}, nil
+	}
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to get backlink target", "note_guid", noteGUID)
+	}
+	if err := ensureUserCached(ownerGUID.String); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT source_note_guid FROM note_links WHERE target_note_guid = ?`, noteGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to query backlinks", "note_guid", noteGUID)
+	}
+	var sourceGUIDs []any
+	for rows.Next() {
+		var guid string
+		if err := rows.Scan(&guid); err != nil {
+			rows.Close()
+			return nil, serr.Wrap(err, "failed to scan backlink")
+		}
+		sourceGUIDs = append(sourceGUIDs, guid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, serr.Wrap(err, "failed to read backlinks")
+	}
+
+	notes := []Note{}
+	if len(sourceGUIDs) == 0 {
+		return notes, nil
+	}
+
+	placeholders := "?"
+	for i := 1; i < len(sourceGUIDs); i++ {
+		placeholders += ", ?"
+	}
+	args := append(sourceGUIDs, ownerGUID)
+
+	noteRows, err := cacheDB.Query(`
+		SELECT id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
+		       created_by, updated_by, created_at, updated_at, synced_at, deleted_at
+		FROM notes
+		WHERE guid IN (`+placeholders+`) AND created_by IS NOT DISTINCT FROM ? AND deleted_at IS NULL
+		ORDER BY updated_at DESC`, args...)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to get backlink notes", "note_guid", noteGUID)
+	}
+	defer noteRows.Close()
+
+	for noteRows.Next() {
+		var note Note
+		if err := noteRows.Scan(
+			&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
+			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
+			&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.SyncedAt, &note.DeletedAt,
+		); err != nil {
+			return nil, serr.Wrap(err, "failed to scan backlink note")
+		}
+		notes = append(notes, note)
+	}
+	return notes, noteRows.Err()
+}
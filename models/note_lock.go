@@ -0,0 +1,30 @@
+package models
+
+import (
+	"sync"
+)
+
+// ============================================================================
+// Per-Note Update Locks
+//
+// An update reads the note, computes the change bitmask and delta against
+// what it read, then writes. Two concurrent updates of the same note could
+// both read the original, so one delta would be computed against a state
+// that no longer exists and the change log would no longer replay to the
+// note's content. Updates therefore hold an in-process lock for the note
+// across the read and the write. DuckDB has no SELECT ... FOR UPDATE, and the
+// server is the database's only writer, so a mutex per note id suffices.
+// Locks for different notes don't contend.
+// ============================================================================
+
+// noteLocks maps note id to its *sync.Mutex. Entries are never removed; one
+// small mutex per updated note is cheap next to the note itself.
+var noteLocks sync.Map
+
+// lockNote acquires the update lock for note id and returns its unlock.
+func lockNote(id int64) func() {
+	mu, _ := noteLocks.LoadOrStore(id, &sync.Mutex{})
+	m := mu.(*sync.Mutex)
+	m.Lock()
+	return m.Unlock
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Deleted Note Retention
+//
+// Soft-deleted notes sit in the trash so they can be restored. With a
+// retention period configured, notes that have been in the trash longer than
+// that are purged for good by AutoPurgeDeletedNotes. Their delete change has
+// long since synced by then, so peers need nothing further. Purging change
+// history as well is optional: it reclaims the most space, but a peer that
+// has been offline for the whole retention period then never learns of the
+// delete.
+// ============================================================================
+
+// DeletedNoteRetentionEnvVar sets how many days a deleted note is kept.
+// Unset, zero, or invalid means deleted notes are kept forever.
+const DeletedNoteRetentionEnvVar = "GONOTES_DELETED_NOTE_RETENTION_DAYS"
+
+// PurgeChangeHistoryEnvVar, when "true", makes auto-purge also remove the
+// purged notes' change history.
+const PurgeChangeHistoryEnvVar = "GONOTES_PURGE_CHANGE_HISTORY"
+
+// AutoPurgeOptions controls AutoPurgeDeletedNotesWithOptions.
+type AutoPurgeOptions struct {
+	Retention    time.Duration // Notes deleted longer ago than this are purged; zero disables purging
+	PurgeHistory bool          // Also remove the notes' change history
+}
+
+// DeletedNoteRetention returns the configured retention period, or zero if
+// deleted notes should be kept forever.
+func DeletedNoteRetention() time.Duration {
+	daysStr := os.Getenv(DeletedNoteRetentionEnvVar)
+	if daysStr == "" {
+		return 0
+	}
+	days, err := strconv.Atoi(daysStr)
+	if err != nil || days < 0 {
+		logger.Warn("Ignoring invalid "+DeletedNoteRetentionEnvVar, "value", daysStr)
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// AutoPurgeDeletedNotes purges notes that have been deleted for longer than
+// the configured retention period. Returns the number of notes purged.
+func AutoPurgeDeletedNotes() (int, error) {
+	return AutoPurgeDeletedNotesWithOptions(AutoPurgeOptions{
+		Retention:    DeletedNoteRetention(),
+		PurgeHistory: os.Getenv(PurgeChangeHistoryEnvVar) == "true",
+	})
+}
+
+// AutoPurgeDeletedNotesWithOptions purges notes whose deleted_at is older than
+// opts.Retention, for all users. A note that fails to purge is logged and
+// skipped so one bad row doesn't stall the rest.
+func AutoPurgeDeletedNotesWithOptions(opts AutoPurgeOptions) (int, error) {
+	if opts.Retention <= 0 {
+		return 0, nil
+	}
+
+	cutoff := time.Now().Add(-opts.Retention)
+	rows, err := db.Query(`SELECT id, guid FROM notes WHERE deleted_at IS NOT NULL AND deleted_at < ?`, cutoff)
+	if err != nil {
+		return 0, serr.Wrap(err, "failed to find expired deleted notes")
+	}
+
+	type expiredNote struct {
+		id   int64
+		guid string
+	}
+	var expired []expiredNote
+	for rows.Next() {
+		var n expiredNote
+		if err := rows.Scan(&n.id, &n.guid); err != nil {
+			rows.Close()
+			return 0, serr.Wrap(err, "failed to scan expired deleted note")
+		}
+		expired = append(expired, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, serr.Wrap(err, "error iterating expired deleted notes")
+	}
+
+	purged := 0
+	for _, n := range expired {
+		if err := purgeNoteFromDisk(n.id); err != nil {
+			logger.LogErr(err, "failed to auto-purge deleted note", "note_id", n.id)
+			continue
+		}
+		if err := purgeNoteRows(cacheDB, n.id); err != nil {
+			logger.LogErr(err, "note auto-purged from disk but not from cache", "note_id", n.id)
+		}
+		if opts.PurgeHistory {
+			if err := purgeNoteHistory(n.guid); err != nil {
+				logger.LogErr(err, "failed to purge change history of deleted note", "note_guid", n.guid)
+			}
+		}
+		purged++
+	}
+
+	if purged > 0 {
+		logger.Info("Auto-purged deleted notes", "count", purged, "retention", opts.Retention.String())
+	}
+	return purged, nil
+}
+
+// purgeNoteHistory deletes a note's change log: its changes, their per-peer
+// delivery records, and their fragments. Children go first, one statement at
+// a time, for the same foreign-key reason as purgeNoteRows.
+func purgeNoteHistory(noteGUID string) error {
+	_, err := db.Exec(`DELETE FROM note_change_sync_peers WHERE note_change_id IN (
+		SELECT id FROM note_changes WHERE note_guid = ?)`, noteGUID)
+	if err != nil {
+		return serr.Wrap(err, "failed to delete note change delivery records")
+	}
+
+	// Collect fragment IDs before their changes go, then delete the fragments
+	rows, err := db.Query(`SELECT note_fragment_id FROM note_changes
+		WHERE note_guid = ? AND note_fragment_id IS NOT NULL`, noteGUID)
+	if err != nil {
+		return serr.Wrap(err, "failed to find note change fragments")
+	}
+	var fragmentIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return serr.Wrap(err, "failed to scan note change fragment")
+		}
+		fragmentIDs = append(fragmentIDs, id)
+	}
+	rows.Close()
+
+	if _, err := db.Exec(`DELETE FROM note_changes WHERE note_guid = ?`, noteGUID); err != nil {
+		return serr.Wrap(err, "failed to delete note changes")
+	}
+	for _, id := range fragmentIDs {
+		if _, err := db.Exec(`DELETE FROM note_fragments WHERE id = ?`, id); err != nil {
+			return serr.Wrap(err, "failed to delete note fragment")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Full-Text Search with Snippets
+//
+// SearchNotesWithSnippets matches the query against a note's title,
+// description, tags, and body (case-insensitive, read from the cache, where
+// private bodies are decrypted). Each result carries a short excerpt around
+// the first match, with the match wrapped in SnippetMarkStart/SnippetMarkEnd.
+// The excerpt is HTML-escaped apart from the markers, so a UI can insert it
+// as HTML directly. The title-only autocomplete (SearchNotesByTitleRanked) is
+// separate and returns no snippets.
+// ============================================================================
+
+// Markers around the matched text in a snippet
+const (
+	SnippetMarkStart = "<mark>"
+	SnippetMarkEnd   = "</mark>"
+)
+
+// snippetContext is roughly how many bytes of text a snippet keeps on each
+// side of the match.
+const snippetContext = 60
+
+// NoteSearchResult is a note that matched a full-text search.
+type NoteSearchResult struct {
+	Note       Note
+	MatchField string // "body", "description", "title", or "tags"
+	Snippet    string // Excerpt around the first match, HTML-escaped, match marked
+}
+
+// SearchNotesWithSnippets returns up to limit (default 20) non-deleted notes
+// owned by userGUID whose title, description, tags, or body contain query,
+// most recently updated first, each with a snippet around its first match.
+// The snippet comes from the body when it matches, else the description,
+// title, or tags.
+func SearchNotesWithSnippets(query string, userGUID string, limit int) ([]NoteSearchResult, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = 20
+	}
+	results := []NoteSearchResult{}
+	if query == "" {
+		return results, nil
+	}
+
+	rows, err := cacheDB.Query(`
+		SELECT id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
+		       created_by, updated_by, created_at, updated_at, synced_at, deleted_at
+		FROM notes
+		WHERE created_by = ? AND deleted_at IS NULL
+		  AND (contains(LOWER(title), LOWER(?))
+		    OR contains(LOWER(COALESCE(description, '')), LOWER(?))
+		    OR contains(LOWER(COALESCE(tags, '')), LOWER(?))
+		    OR contains(LOWER(COALESCE(body, '')), LOWER(?)))
+		ORDER BY updated_at DESC
+		LIMIT ?
+	`, userGUID, query, query, query, query, limit)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to search notes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var note Note
+		if err := rows.Scan(
+			&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
+			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
+			&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.SyncedAt, &note.DeletedAt,
+		); err != nil {
+			return nil, serr.Wrap(err, "failed to scan note search result")
+		}
+
+		result := NoteSearchResult{Note: note}
+		for _, field := range []struct{ name, text string }{
+			{"body", note.Body.String},
+			{"description", note.Description.String},
+			{"title", note.Title},
+			{"tags", note.Tags.String},
+		} {
+			if snippet, ok := buildSnippet(field.text, query); ok {
+				result.MatchField, result.Snippet = field.name, snippet
+				break
+			}
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// buildSnippet returns an excerpt of text around the first case-insensitive
+// match of query, with the match marked. Whitespace runs are collapsed, the
+// excerpt is cut at word boundaries where possible, and an ellipsis shows
+// where text was cut. Reports false if text doesn't contain query.
+func buildSnippet(text, query string) (string, bool) {
+	start, end := indexFold(text, query)
+	if start < 0 {
+		return "", false
+	}
+
+	from := 0
+	if start > snippetContext {
+		from = start - snippetContext
+		for from < start && !utf8.RuneStart(text[from]) {
+			from++
+		}
+		if space := strings.IndexAny(text[from:start], " \t\n"); space >= 0 {
+			from += space + 1 // Don't start mid-word
+		}
+	}
+	to := len(text)
+	if end+snippetContext < len(text) {
+		to = end + snippetContext
+		for to > end && !utf8.RuneStart(text[to]) {
+			to--
+		}
+		if space := strings.LastIndexAny(text[end:to], " \t\n"); space >= 0 {
+			to = end + space // Don't end mid-word
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	b.WriteString(html.EscapeString(collapseWhitespace(text[from:start])))
+	b.WriteString(SnippetMarkStart)
+	b.WriteString(html.EscapeString(text[start:end]))
+	b.WriteString(SnippetMarkEnd)
+	b.WriteString(html.EscapeString(collapseWhitespace(text[end:to])))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// indexFold returns the byte range of the first case-insensitive match of
+// substr in s, or -1, -1.
+func indexFold(s, substr string) (int, int) {
+	if substr == "" {
+		return -1, -1
+	}
+	for i := range s {
+		if n, ok := hasPrefixFold(s[i:], substr); ok {
+			return i, i + n
+		}
+	}
+	return -1, -1
+}
+
+// hasPrefixFold reports whether s starts with prefix, ignoring case, and how
+// many bytes of s the match covers.
+func hasPrefixFold(s, prefix string) (int, bool) {
+	n := 0
+	for _, pr := range prefix {
+		if n >= len(s) {
+			return 0, false
+		}
+		sr, size := utf8.DecodeRuneInString(s[n:])
+		if unicode.ToLower(sr) != unicode.ToLower(pr) {
+			return 0, false
+		}
+		n += size
+	}
+	return n, true
+}
+
+// collapseWhitespace replaces each run of whitespace in s with one space.
+func collapseWhitespace(s string) string {
+	var b strings.Builder
+	inSpace := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			if !inSpace {
+				b.WriteByte(' ')
+			}
+			inSpace = true
+			continue
+		}
+		inSpace = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
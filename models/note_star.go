@@ -0,0 +1,123 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/rohanthewiz/logger"
+)
+
+// ============================================================================
+// Starred Notes
+//
+// notes.starred bookmarks a note as important so the user can list just
+// those notes. Unlike is_flagged, which is a local follow-up marker, starring
+// is part of the note: SetNoteStarred records an update change whose fragment
+// carries only the FragmentStarred bit, so the state reaches every peer and
+// is covered by the sync checksum.
+// ============================================================================
+
+// SetNoteStarred stars or unstars a non-deleted note owned by userGUID and
+// returns the updated note. Setting the state the note already has changes
+// nothing and records no change. Returns nil if the note is not found or not
+// owned by userGUID.
+func SetNoteStarred(id int64, userGUID string, starred bool) (*Note, error) {
+	if IsReadOnly() {
+		return nil, ErrReadOnly
+	}
+	unlock := lockNote(id)
+	defer unlock()
+
+	existing, err := GetNoteByID(id, userGUID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, nil
+	}
+	if existing.Starred == starred {
+		return existing, nil
+	}
+
+	// Starring is an edit that syncs, so updated_at and authored_at move too
+	updatedBy := sql.NullString{String: userGUID, Valid: userGUID != ""}
+	result, err := db.Exec(`
+		UPDATE notes SET starred = ?, updated_by = ?, updated_at = CURRENT_TIMESTAMP,
+		    authored_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND created_by = ? AND deleted_at IS NULL
+	`, starred, updatedBy, id, userGUID)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, nil
+	}
+
+	// Record change for sync (non-blocking)
+	fragment := NoteFragment{
+		Bitmask: FragmentStarred,
+		Starred: sql.NullBool{Bool: starred, Valid: true},
+	}
+	if fragmentID, err := insertNoteFragment(fragment); err != nil {
+		logger.LogErr(err, "failed to record star fragment", "note_id", id)
+	} else {
+		if err := insertNoteChange(GenerateChangeGUID(), existing.GUID, OperationUpdate, sql.NullInt64{Int64: fragmentID, Valid: true}, userGUID); err != nil {
+			logger.LogErr(err, "failed to record star change", "note_id", id)
+		}
+	}
+
+	_, err = cacheDB.Exec(`
+		UPDATE notes SET starred = ?, updated_by = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND deleted_at IS NULL
+	`, starred, updatedBy, id)
+	if err != nil {
+		logger.LogErr(err, "SetNoteStarred: cache update failed", "note_id", id)
+	}
+	updateSyncChecksum("note", existing.GUID)
+
+	return GetNoteByID(id, userGUID)
+}
+
+// ListStarredNotesInRange lists the user's starred, non-deleted notes created
+// within created, newest first. limit=0 returns all.
+func ListStarredNotesInRange(userGUID string, created CreatedRange, limit, offset int) ([]Note, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
+		       created_by, updated_by, created_at, updated_at, synced_at, deleted_at
+		FROM notes
+		WHERE created_by = ? AND deleted_at IS NULL AND starred
+	`
+	args := []any{userGUID}
+	if cond, condArgs := created.sqlCondition("created_at"); cond != "" {
+		query += " AND " + cond
+		args = append(args, condArgs...)
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	}
+
+	rows, err := cacheDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []Note
+	for rows.Next() {
+		var note Note
+		if err := rows.Scan(
+			&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
+			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
+			&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.SyncedAt, &note.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
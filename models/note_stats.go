@@ -0,0 +1,107 @@
+package models
+
+import (
+	"database/sql"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Note Statistics
+//
+// Word and character counts are derived from note bodies on the fly — they are
+// cheap to compute and storing them would mean another column to keep in step
+// with every body change and sync.
+// ============================================================================
+
+// NoteStats aggregates body statistics across a user's active notes.
+type NoteStats struct {
+	TotalNotes   int     `json:"total_notes"`
+	TotalWords   int     `json:"total_words"`
+	TotalChars   int     `json:"total_chars"`
+	AverageWords float64 `json:"average_words"` // Mean words per note
+	AverageChars float64 `json:"average_chars"` // Mean characters per note
+}
+
+// CountWords counts the words in s. A word is a run of letters, digits, or
+// combining marks, so markdown punctuation ("#", "-", "**") isn't counted and
+// "don't" or "e-mail" count once. Ideographic scripts (Chinese, Japanese) don't
+// separate words with spaces, so each of their characters counts as a word.
+func CountWords(s string) int {
+	count := 0
+	inWord := false
+
+	for i, r := range s {
+		switch {
+		case isIdeograph(r):
+			count++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			if !inWord {
+				count++
+				inWord = true
+			}
+		case inWord && isWordJoiner(r):
+			// Only joins if another word character follows
+			next, _ := utf8.DecodeRuneInString(s[i+utf8.RuneLen(r):])
+			if !unicode.IsLetter(next) && !unicode.IsDigit(next) {
+				inWord = false
+			}
+		default:
+			inWord = false
+		}
+	}
+
+	return count
+}
+
+// isWordJoiner reports whether r can appear inside a word (don't, e-mail).
+func isWordJoiner(r rune) bool {
+	return r == '\'' || r == '’' || r == '-'
+}
+
+// isIdeograph reports whether r belongs to a script written without spaces.
+func isIdeograph(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r)
+}
+
+// GetUserNoteStats returns word and character totals across the user's
+// non-deleted notes. Reads from the cache, where private note bodies are
+// held decrypted. Notes without a body count as zero words.
+func GetUserNoteStats(userGUID string) (*NoteStats, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
+	rows, err := cacheDB.Query(`
+		SELECT body FROM notes
+		WHERE created_by = ? AND deleted_at IS NULL
+	`, userGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to query note bodies for stats")
+	}
+	defer rows.Close()
+
+	stats := &NoteStats{}
+	for rows.Next() {
+		var body sql.NullString
+		if err := rows.Scan(&body); err != nil {
+			return nil, serr.Wrap(err, "failed to scan note body for stats")
+		}
+		stats.TotalNotes++
+		stats.TotalWords += CountWords(body.String)
+		stats.TotalChars += utf8.RuneCountInString(body.String)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, serr.Wrap(err, "error iterating note bodies for stats")
+	}
+
+	if stats.TotalNotes > 0 {
+		stats.AverageWords = float64(stats.TotalWords) / float64(stats.TotalNotes)
+		stats.AverageChars = float64(stats.TotalChars) / float64(stats.TotalNotes)
+	}
+
+	return stats, nil
+}
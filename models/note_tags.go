@@ -0,0 +1,29 @@
+package models
+
+import (
+	"slices"
+	"strings"
+)
+
+// NormalizeTags canonicalizes a note's comma-separated tags: each tag is
+// trimmed and lowercased, empty and duplicate tags are dropped, and the rest
+// are sorted and rejoined with commas. "go, Go, api, go" becomes "api,go".
+func NormalizeTags(tags string) string {
+	var normalized []string
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return strings.Join(normalized, ",")
+}
+
+// normalizeInputTags applies NormalizeTags to input.Tags when it is set.
+func normalizeInputTags(input *NoteInput) {
+	if input.Tags != nil {
+		tags := NormalizeTags(*input.Tags)
+		input.Tags = &tags
+	}
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"strconv"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Note View Counts
+//
+// notes.view_count counts how often a note has been opened, so frequently
+// referenced notes can be listed first. A view is not an edit: recording one
+// touches only view_count, leaving updated_at, authored_at, and the change log
+// alone, so views never produce sync changes. Counts are therefore local to
+// each machine. Like is_flagged, the column lives in both databases so the
+// cache can sort by it.
+// ============================================================================
+
+// RecordNoteView increments the view count of a non-deleted note owned by
+// userGUID and returns the new count. found is false if there is no such note.
+func RecordNoteView(id int64, userGUID string) (viewCount int64, found bool, err error) {
+	if IsReadOnly() {
+		return 0, false, ErrReadOnly
+	}
+	result, err := db.Exec(`
+		UPDATE notes SET view_count = COALESCE(view_count, 0) + 1
+		WHERE id = ? AND created_by = ? AND deleted_at IS NULL
+	`, id, userGUID)
+	if err != nil {
+		return 0, false, serr.Wrap(err, "failed to record note view", "note_id", strconv.FormatInt(id, 10))
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return 0, false, nil
+	}
+	if err := db.QueryRow(`SELECT view_count FROM notes WHERE id = ?`, id).Scan(&viewCount); err != nil {
+		return 0, false, serr.Wrap(err, "failed to read note view count", "note_id", strconv.FormatInt(id, 10))
+	}
+
+	// The count is only a ranking hint, so a stale cache isn't worth failing for
+	if _, cacheErr := cacheDB.Exec(`UPDATE notes SET view_count = ? WHERE id = ?`, viewCount, id); cacheErr != nil {
+		logger.LogErr(cacheErr, "RecordNoteView: cache update failed", "note_id", id)
+	}
+
+	return viewCount, true, nil
+}
+
+// ListNotesByViews lists the user's non-deleted notes most viewed first,
+// breaking ties by most recently updated. limit=0 returns all.
+func ListNotesByViews(userGUID string, limit, offset int) ([]Note, error) {
+	return ListNotesByViewsInRange(userGUID, CreatedRange{}, limit, offset)
+}
+
+// ListNotesByViewsInRange is ListNotesByViews limited to notes created
+// within created.
+func ListNotesByViewsInRange(userGUID string, created CreatedRange, limit, offset int) ([]Note, error) {
+	if err := ensureUserCached(userGUID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
+		       created_by, updated_by, created_at, updated_at, synced_at, deleted_at
+		FROM notes
+		WHERE created_by = ? AND deleted_at IS NULL
+	`
+	args := []any{userGUID}
+	if cond, condArgs := created.sqlCondition("created_at"); cond != "" {
+		query += " AND " + cond
+		args = append(args, condArgs...)
+	}
+	query += " ORDER BY COALESCE(view_count, 0) DESC, updated_at DESC, id DESC"
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	}
+
+	rows, err := cacheDB.Query(query, args...)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to list notes by views")
+	}
+	defer rows.Close()
+
+	var notes []Note
+	for rows.Next() {
+		var note Note
+		if err := rows.Scan(
+			&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
+			&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
+			&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.SyncedAt, &note.DeletedAt,
+		); err != nil {
+			return nil, serr.Wrap(err, "failed to scan note")
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/rohanthewiz/logger"
+)
+
+// ============================================================================
+// Read-Only Mode
+//
+// A hub can run extra instances that serve reads (pull, status, snapshot,
+// listing, search) but refuse writes, to scale reads. In read-only mode the
+// note and category mutators, subcategory and category rule edits, view
+// counting, and pushed sync changes return ErrReadOnly, and the web layer
+// answers every write request with 503 before it reaches them.
+// Changes pulled by the instance's own sync client are still applied, so a
+// replica can keep itself current from the hub.
+// ============================================================================
+
+// ReadOnlyEnvVar starts the instance in read-only mode when set to a true value.
+const ReadOnlyEnvVar = "GONOTES_READ_ONLY"
+
+// ErrReadOnly is returned by mutating operations while read-only mode is on.
+var ErrReadOnly = errors.New("read-only mode")
+
+var readOnly atomic.Bool
+
+// SetReadOnly turns read-only mode on or off.
+func SetReadOnly(on bool) {
+	readOnly.Store(on)
+}
+
+// IsReadOnly reports whether read-only mode is on.
+func IsReadOnly() bool {
+	return readOnly.Load()
+}
+
+// ReadOnlyEnabled reports whether GONOTES_READ_ONLY asks for read-only mode.
+func ReadOnlyEnabled() bool {
+	enabledStr := os.Getenv(ReadOnlyEnvVar)
+	if enabledStr == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(enabledStr)
+	if err != nil {
+		logger.Warn("Ignoring invalid "+ReadOnlyEnvVar, "value", enabledStr)
+		return false
+	}
+	return enabled
+}
@@ -0,0 +1,76 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gonotes/models"
+)
+
+// TestReadOnlyMutators verifies that in read-only mode the writes outside the
+// note and category mutators — subcategory edits, category rules, view
+// counting, and pushed sync changes — return ErrReadOnly and change nothing.
+func TestReadOnlyMutators(t *testing.T) {
+	cleanup := setupSyncProtocolTestDB(t)
+	defer cleanup()
+
+	note := createTestNote(t, "read-only-note-guid", "Read Only")
+	cat := createTestCategory(t, "read-only-cat")
+	if err := models.AddSubcategory(cat.ID, "existing"); err != nil {
+		t.Fatalf("failed to add subcategory: %v", err)
+	}
+
+	models.SetReadOnly(true)
+	defer models.SetReadOnly(false)
+
+	title := "Pushed"
+	writes := map[string]func() error{
+		"AddSubcategory":    func() error { return models.AddSubcategory(cat.ID, "added") },
+		"RemoveSubcategory": func() error { return models.RemoveSubcategory(cat.ID, "existing") },
+		"RenameSubcategory": func() error { return models.RenameSubcategory(cat.ID, "existing", "renamed") },
+		"CreateCategoryRule": func() error {
+			_, err := models.CreateCategoryRule(spTestUserGUID, "work", cat.ID)
+			return err
+		},
+		"RecordNoteView": func() error {
+			_, _, err := models.RecordNoteView(note.ID, spTestUserGUID)
+			return err
+		},
+		"ApplyIncomingSyncChangeFromPeer": func() error {
+			return models.ApplyIncomingSyncChangeFromPeer(models.SyncChange{
+				GUID:       "read-only-push-001",
+				EntityType: "note",
+				EntityGUID: note.GUID,
+				Operation:  models.OperationUpdate,
+				Fragment:   &models.NoteFragmentOutput{Bitmask: models.FragmentTitle, Title: &title},
+				AuthoredAt: time.Now(),
+			}, "read-only-spoke")
+		},
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, models.ErrReadOnly) {
+			t.Errorf("%s: expected ErrReadOnly, got %v", name, err)
+		}
+	}
+
+	models.SetReadOnly(false)
+
+	got, err := models.GetNoteByID(note.ID, spTestUserGUID)
+	if err != nil || got == nil {
+		t.Fatalf("failed to get note: %v", err)
+	}
+	if got.Title != "Read Only" {
+		t.Errorf("expected the pushed update to be refused, got title %q", got.Title)
+	}
+	gotCat, err := models.GetCategory(cat.ID, spTestUserGUID)
+	if err != nil || gotCat == nil {
+		t.Fatalf("failed to get category: %v", err)
+	}
+	if gotCat.Subcategories.String != `["existing"]` {
+		t.Errorf("expected subcategories unchanged, got %s", gotCat.Subcategories.String)
+	}
+	if rules, err := models.ListCategoryRules(spTestUserGUID); err != nil || len(rules) != 0 {
+		t.Errorf("expected no category rules, got %v, err=%v", rules, err)
+	}
+}
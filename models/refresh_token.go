@@ -0,0 +1,119 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Refresh Tokens
+//
+// Long-lived clients (notably the spoke sync client) log in once and receive
+// a short-lived access token plus a long-lived refresh token. When the access
+// token expires they exchange the refresh token at POST /api/v1/auth/refresh
+// instead of re-sending the password.
+//
+// Only the SHA-256 hash of each refresh token is stored. Tokens are rotated
+// on every exchange: the presented token is revoked and a new one issued, so
+// a leaked token stops working as soon as the legitimate client uses it.
+// ============================================================================
+
+// RefreshTokenExpiration is how long a refresh token remains valid.
+// A client that syncs at least once a month never has to log in again.
+const RefreshTokenExpiration = 30 * 24 * time.Hour
+
+// DDL for refresh_tokens table — stores hashed refresh tokens per user
+const DDLCreateRefreshTokensSequence = `CREATE SEQUENCE IF NOT EXISTS refresh_tokens_id_seq START 1;`
+
+const DDLCreateRefreshTokensTable = `
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id         BIGINT PRIMARY KEY DEFAULT nextval('refresh_tokens_id_seq'),
+    user_guid  VARCHAR NOT NULL,
+    token_hash VARCHAR NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+const DDLCreateRefreshTokensIndexUserGUID = `CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_guid ON refresh_tokens(user_guid);`
+
+// CreateRefreshToken issues a new refresh token for the user and stores its hash.
+// The plaintext token is returned once and cannot be recovered afterwards.
+func CreateRefreshToken(userGUID string) (string, error) {
+	if userGUID == "" {
+		return "", serr.New("user GUID is required")
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", serr.Wrap(err, "failed to generate random refresh token")
+	}
+	plaintext := hex.EncodeToString(tokenBytes)
+
+	_, err := db.Exec(`
+		INSERT INTO refresh_tokens (user_guid, token_hash, expires_at)
+		VALUES (?, ?, ?)
+	`, userGUID, hashSecretToken(plaintext), time.Now().Add(RefreshTokenExpiration))
+	if err != nil {
+		return "", serr.Wrap(err, "failed to create refresh token")
+	}
+
+	return plaintext, nil
+}
+
+// ExchangeRefreshToken validates a refresh token, revokes it, and issues a
+// replacement. Returns the owning user and the new refresh token.
+// Returns a nil user (and no error) if the token is unknown, revoked, expired,
+// or belongs to a disabled account — callers should respond with 401.
+func ExchangeRefreshToken(plaintext string) (*User, string, error) {
+	var tokenID int64
+	var userGUID string
+	var expiresAt time.Time
+	err := db.QueryRow(`
+		SELECT id, user_guid, expires_at FROM refresh_tokens
+		WHERE token_hash = ? AND revoked_at IS NULL
+	`, hashSecretToken(plaintext)).Scan(&tokenID, &userGUID, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", serr.Wrap(err, "failed to look up refresh token")
+	}
+
+	if time.Now().After(expiresAt) {
+		return nil, "", nil
+	}
+
+	user, err := GetUserByGUID(userGUID)
+	if err != nil {
+		return nil, "", serr.Wrap(err, "failed to get refresh token owner")
+	}
+	if user == nil || !user.IsActive {
+		return nil, "", nil
+	}
+
+	// Revoke before issuing the replacement. The revoked_at guard makes this
+	// single-use even if two requests race with the same token.
+	result, err := db.Exec(`
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND revoked_at IS NULL
+	`, tokenID)
+	if err != nil {
+		return nil, "", serr.Wrap(err, "failed to revoke used refresh token")
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, "", nil
+	}
+
+	newToken, err := CreateRefreshToken(user.GUID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return user, newToken, nil
+}
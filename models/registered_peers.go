@@ -0,0 +1,182 @@
+package models
+
+import (
+	"database/sql"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Registered Peers (Hub Allowlist)
+//
+// Every peer_id that pulls from or pushes to the hub is registered on first
+// contact in registered_peers, with the user it authenticated as and when it
+// was last seen. Registration starts out pending. With the allowlist enforced
+// (GONOTES_PEER_ALLOWLIST), the sync endpoints refuse pending peers until an
+// admin approves them; without it every peer may sync, and the table is just
+// a record of who has. Authentication still applies either way: approval
+// admits a device, not a user.
+// ============================================================================
+
+// PeerAllowlistEnvVar turns on enforcement of the peer allowlist when set to
+// a true value. Unset or invalid leaves it off.
+const PeerAllowlistEnvVar = "GONOTES_PEER_ALLOWLIST"
+
+// Registered peer statuses
+const (
+	PeerStatusPending  = "pending"
+	PeerStatusApproved = "approved"
+)
+
+const DDLCreateRegisteredPeersTable = `
+CREATE TABLE IF NOT EXISTS registered_peers (
+    peer_id       VARCHAR PRIMARY KEY,
+    user_guid     VARCHAR NOT NULL,
+    status        VARCHAR NOT NULL DEFAULT 'pending',
+    first_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    approved_by   VARCHAR,
+    approved_at   TIMESTAMP
+);
+`
+
+// RegisteredPeer is a peer_id the hub has seen.
+type RegisteredPeer struct {
+	PeerID      string     `json:"peer_id"`
+	UserGUID    string     `json:"user_guid"` // User the peer first authenticated as
+	Status      string     `json:"status"`    // PeerStatusPending or PeerStatusApproved
+	FirstSeenAt time.Time  `json:"first_seen_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ApprovedBy  string     `json:"approved_by,omitempty"`
+	ApprovedAt  *time.Time `json:"approved_at,omitempty"`
+}
+
+// PeerAllowlistEnabled reports whether unapproved peers are refused.
+func PeerAllowlistEnabled() bool {
+	enabledStr := os.Getenv(PeerAllowlistEnvVar)
+	if enabledStr == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(enabledStr)
+	if err != nil {
+		logger.Warn("Ignoring invalid "+PeerAllowlistEnvVar, "value", enabledStr)
+		return false
+	}
+	return enabled
+}
+
+// RegisterPeer records that peerID is syncing as userGUID, adding it as
+// pending on first contact and updating last_seen_at after that. Returns the
+// peer's registration.
+func RegisterPeer(peerID, userGUID string) (*RegisteredPeer, error) {
+	if peerID == "" {
+		return nil, serr.New("peer_id is required")
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO registered_peers (peer_id, user_guid, status)
+		VALUES (?, ?, ?)
+		ON CONFLICT (peer_id) DO UPDATE SET last_seen_at = now()
+	`, peerID, userGUID, PeerStatusPending)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to register peer", "peer_id", peerID)
+	}
+
+	return GetRegisteredPeer(peerID)
+}
+
+// GetRegisteredPeer returns the registration for peerID, or nil if the hub
+// has never seen it.
+func GetRegisteredPeer(peerID string) (*RegisteredPeer, error) {
+	row := db.QueryRow(`
+		SELECT peer_id, user_guid, status, first_seen_at, last_seen_at, approved_by, approved_at
+		FROM registered_peers WHERE peer_id = ?
+	`, peerID)
+	peer, err := scanRegisteredPeer(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to get registered peer", "peer_id", peerID)
+	}
+	return peer, nil
+}
+
+// CheckPeerAllowed registers peerID and reports whether it may sync: always
+// true with the allowlist off, otherwise only once the peer is approved.
+func CheckPeerAllowed(peerID, userGUID string) (bool, error) {
+	peer, err := RegisterPeer(peerID, userGUID)
+	if err != nil {
+		return false, err
+	}
+	if !PeerAllowlistEnabled() {
+		return true, nil
+	}
+	return peer.Status == PeerStatusApproved, nil
+}
+
+// ApprovePeer marks peerID as approved by approvedBy. A peer can be approved
+// before it first connects, in which case it is registered to approvedBy
+// until then. Approving an approved peer is a no-op.
+func ApprovePeer(peerID, approvedBy string) (*RegisteredPeer, error) {
+	if peerID == "" {
+		return nil, serr.New("peer_id is required")
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO registered_peers (peer_id, user_guid, status, approved_by, approved_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (peer_id) DO UPDATE SET status = EXCLUDED.status,
+		    approved_by = COALESCE(registered_peers.approved_by, EXCLUDED.approved_by),
+		    approved_at = COALESCE(registered_peers.approved_at, EXCLUDED.approved_at)
+	`, peerID, approvedBy, PeerStatusApproved, approvedBy)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to approve peer", "peer_id", peerID)
+	}
+
+	return GetRegisteredPeer(peerID)
+}
+
+// ListRegisteredPeers returns every peer the hub knows of, most recently
+// seen first.
+func ListRegisteredPeers() ([]RegisteredPeer, error) {
+	rows, err := db.Query(`
+		SELECT peer_id, user_guid, status, first_seen_at, last_seen_at, approved_by, approved_at
+		FROM registered_peers
+		ORDER BY last_seen_at DESC, peer_id
+	`)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to list registered peers")
+	}
+	defer rows.Close()
+
+	peers := []RegisteredPeer{}
+	for rows.Next() {
+		peer, err := scanRegisteredPeer(rows)
+		if err != nil {
+			return nil, serr.Wrap(err, "failed to scan registered peer")
+		}
+		peers = append(peers, *peer)
+	}
+	return peers, rows.Err()
+}
+
+// scanRegisteredPeer scans one registered_peers row.
+func scanRegisteredPeer(row interface{ Scan(...any) error }) (*RegisteredPeer, error) {
+	var peer RegisteredPeer
+	var approvedBy sql.NullString
+	var approvedAt sql.NullTime
+	if err := row.Scan(&peer.PeerID, &peer.UserGUID, &peer.Status, &peer.FirstSeenAt,
+		&peer.LastSeenAt, &approvedBy, &approvedAt); err != nil {
+		return nil, err
+	}
+	peer.ApprovedBy = approvedBy.String
+	if approvedAt.Valid {
+		peer.ApprovedAt = &approvedAt.Time
+	}
+	return &peer, nil
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Share Links
+//
+// A share link grants unauthenticated, read-only access to a single note via
+// a random token. The token is unrelated to the note's GUID, so holding a link
+// reveals nothing that could be used against the owner's account or other
+// notes. As with API keys and refresh tokens, only the token's SHA-256 hash is
+// stored. Private notes are only shareable when the link explicitly allows it.
+// ============================================================================
+
+// ErrShareLinkExpired is returned by GetSharedNote for a link past its expiry.
+// Handlers map it to 410 Gone.
+var ErrShareLinkExpired = errors.New("share link has expired")
+
+// ErrPrivateNoteNotShareable is returned when sharing a private note without
+// ShareLinkOptions.AllowPrivate.
+var ErrPrivateNoteNotShareable = errors.New("private notes can only be shared with allow_private")
+
+// DDL for share_tokens table — stores hashed share tokens per note
+const DDLCreateShareTokensSequence = `CREATE SEQUENCE IF NOT EXISTS share_tokens_id_seq START 1;`
+
+const DDLCreateShareTokensTable = `
+CREATE TABLE IF NOT EXISTS share_tokens (
+    id            BIGINT PRIMARY KEY DEFAULT nextval('share_tokens_id_seq'),
+    note_id       BIGINT NOT NULL,
+    token_hash    VARCHAR NOT NULL UNIQUE,
+    created_by    VARCHAR NOT NULL,
+    allow_private BOOLEAN DEFAULT false,
+    expires_at    TIMESTAMP,
+    revoked_at    TIMESTAMP,
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+const DDLCreateShareTokensIndexNoteID = `CREATE INDEX IF NOT EXISTS idx_share_tokens_note_id ON share_tokens(note_id);`
+
+// ShareLinkOptions controls what a share link allows.
+type ShareLinkOptions struct {
+	ExpiresAt    *time.Time // nil means the link never expires
+	AllowPrivate bool       // Must be set to share a private note
+}
+
+// CreateShareLink creates a share link for the user's note that expires at
+// expiresAt (nil for never). Private notes are not shareable this way; use
+// CreateShareLinkWithOptions with AllowPrivate.
+func CreateShareLink(noteID int64, userGUID string, expiresAt *time.Time) (string, error) {
+	return CreateShareLinkWithOptions(noteID, userGUID, ShareLinkOptions{ExpiresAt: expiresAt})
+}
+
+// CreateShareLinkWithOptions creates a share link for the user's note and
+// returns its token. The plaintext token is returned once and cannot be
+// recovered afterwards. Returns an empty token (and no error) if the note
+// doesn't exist or isn't owned by userGUID.
+func CreateShareLinkWithOptions(noteID int64, userGUID string, opts ShareLinkOptions) (string, error) {
+	note, err := GetNoteByID(noteID, userGUID)
+	if err != nil {
+		return "", serr.Wrap(err, "failed to get note to share")
+	}
+	if note == nil {
+		return "", nil
+	}
+	if note.IsPrivate && !opts.AllowPrivate {
+		return "", ErrPrivateNoteNotShareable
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", serr.Wrap(err, "failed to generate random share token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	var expiresAt sql.NullTime
+	if opts.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: *opts.ExpiresAt, Valid: true}
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO share_tokens (note_id, token_hash, created_by, allow_private, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, noteID, hashSecretToken(token), userGUID, opts.AllowPrivate, expiresAt)
+	if err != nil {
+		return "", serr.Wrap(err, "failed to create share link")
+	}
+
+	return token, nil
+}
+
+// GetSharedNote returns the note a share token grants access to.
+// Returns nil (and no error) if the token is unknown or revoked, or the note
+// has been deleted or made private since the link was created without
+// AllowPrivate. Returns ErrShareLinkExpired for an expired link.
+func GetSharedNote(token string) (*Note, error) {
+	var noteID int64
+	var owner string
+	var allowPrivate bool
+	var expiresAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT note_id, created_by, allow_private, expires_at FROM share_tokens
+		WHERE token_hash = ? AND revoked_at IS NULL
+	`, hashSecretToken(token)).Scan(&noteID, &owner, &allowPrivate, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to look up share link")
+	}
+
+	if expiresAt.Valid && time.Now().After(expiresAt.Time) {
+		return nil, ErrShareLinkExpired
+	}
+
+	note, err := GetNoteByID(noteID, owner)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to get shared note")
+	}
+	if note == nil || (note.IsPrivate && !allowPrivate) {
+		return nil, nil
+	}
+
+	return note, nil
+}
+
+// RevokeShareLink revokes a share token owned by userGUID.
+// Returns false if no such active link exists.
+func RevokeShareLink(token, userGUID string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE share_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE token_hash = ? AND created_by = ? AND revoked_at IS NULL
+	`, hashSecretToken(token), userGUID)
+	if err != nil {
+		return false, serr.Wrap(err, "failed to revoke share link")
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ToSharedOutput converts a note for public display: the same as ToOutput
+// but without fields that identify the owner's account.
+func (n *Note) ToSharedOutput() NoteOutput {
+	out := n.ToOutput()
+	out.CreatedBy = nil
+	out.UpdatedBy = nil
+	out.UpdatedByName = nil
+	out.EncryptionIV = nil
+	return out
+}
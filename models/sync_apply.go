@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/rohanthewiz/logger"
@@ -13,8 +14,12 @@ import (
 // Unlike CreateNote (which auto-generates authored_at via DEFAULT CURRENT_TIMESTAMP),
 // this preserves the original authoring timestamp from the source machine so that
 // the synced note reflects when it was truly authored, not when it was received.
-// Records a change with OperationSync so downstream peers don't re-propagate it.
-func ApplySyncNoteCreate(noteGUID, title string, fragment NoteFragment, authoredAt time.Time, userGUID string) (*Note, error) {
+// Records a change with OperationSync tagged with originPeer (the peer the change
+// came from, or "" if unknown) so it is never sent back to that peer.
+// The id is assigned by this machine's disk sequence and reused for the cache
+// row; numeric ids are local and never synced (peers identify notes by GUID),
+// so notes created on different machines with the same id can't collide.
+func ApplySyncNoteCreate(noteGUID, title string, fragment NoteFragment, authoredAt time.Time, userGUID, originPeer string) (*Note, error) {
 	// Extract field values from fragment, falling back to defaults for unset fields
 	description := fragment.Description
 	body := fragment.Body
@@ -23,6 +28,7 @@ func ApplySyncNoteCreate(noteGUID, title string, fragment NoteFragment, authored
 	if fragment.IsPrivate.Valid {
 		isPrivate = fragment.IsPrivate.Bool
 	}
+	starred := fragment.Bitmask&FragmentStarred != 0 && fragment.Starred.Valid && fragment.Starred.Bool
 
 	// If the fragment body is a diff, this is an error for creates — creates need full body.
 	// A create should never have a diff (no base to apply it against).
@@ -32,26 +38,34 @@ func ApplySyncNoteCreate(noteGUID, title string, fragment NoteFragment, authored
 
 	createdBy := sql.NullString{String: userGUID, Valid: userGUID != ""}
 
+	// Sync carries plaintext bodies; compress according to our own threshold
+	diskBody, bodyCompressed, err := compressBodyForDisk(nullStringToPtr(body))
+	if err != nil {
+		return nil, err
+	}
+
 	// Insert into disk DB with explicit authored_at (NOT DEFAULT CURRENT_TIMESTAMP)
 	query := `
-		INSERT INTO notes (guid, title, description, body, tags, is_private, created_by, updated_by,
+		INSERT INTO notes (guid, title, description, body, body_compressed, tags, is_private, starred, created_by, updated_by,
 		                   authored_at, synced_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
-		RETURNING id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		RETURNING id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
 		          created_by, updated_by, created_at, updated_at, authored_at, synced_at, deleted_at
 	`
 
 	note := &Note{}
-	err := db.QueryRow(query,
-		noteGUID, title, description, body, tags, isPrivate, createdBy, createdBy, authoredAt,
+	err = db.QueryRow(query,
+		noteGUID, title, description, diskBody, bodyCompressed, tags, isPrivate, starred, createdBy, createdBy, authoredAt,
 	).Scan(
 		&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
-		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.EncryptionIV, &note.CreatedBy,
+		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
 		&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.AuthoredAt, &note.SyncedAt, &note.DeletedAt,
 	)
 	if err != nil {
 		return nil, serr.Wrap(err, "failed to insert synced note into disk")
 	}
+	note.Body = body // The cache and caller get the plaintext body
+	recordNoteLinks(noteGUID, body)
 
 	// Record change with OperationSync so it won't be pushed back to the originator
 	syncFragment := createFragmentFromInput(NoteInput{
@@ -61,44 +75,103 @@ func ApplySyncNoteCreate(noteGUID, title string, fragment NoteFragment, authored
 		Tags:        nullStringToPtr(tags),
 		IsPrivate:   isPrivate,
 	}, FragmentTitle|FragmentDescription|FragmentBody|FragmentTags|FragmentIsPrivate)
+	if starred {
+		syncFragment.Bitmask |= FragmentStarred
+		syncFragment.Starred = sql.NullBool{Bool: true, Valid: true}
+	}
 	if fragmentID, err := insertNoteFragment(syncFragment); err != nil {
 		logger.LogErr(err, "failed to record sync note create fragment", "note_guid", noteGUID)
 	} else {
-		if err := insertNoteChange(GenerateChangeGUID(), noteGUID, OperationSync,
-			sql.NullInt64{Int64: fragmentID, Valid: true}, userGUID); err != nil {
+		if err := insertNoteChangeFromPeer(GenerateChangeGUID(), noteGUID, OperationSync,
+			sql.NullInt64{Int64: fragmentID, Valid: true}, userGUID, originPeer); err != nil {
 			logger.LogErr(err, "failed to record sync note create change", "note_guid", noteGUID)
 		}
 	}
 
 	// Insert into cache (no authored_at in cache schema)
 	cacheQuery := `
-		INSERT INTO notes (id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		INSERT INTO notes (id, guid, title, description, body, tags, is_private, is_flagged, starred, encryption_iv,
 		                   created_by, updated_by, created_at, updated_at, synced_at, deleted_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	_, err = cacheDB.Exec(cacheQuery,
 		note.ID, note.GUID, note.Title, note.Description, note.Body,
-		note.Tags, note.IsPrivate, note.IsFlagged, note.EncryptionIV, note.CreatedBy,
+		note.Tags, note.IsPrivate, note.IsFlagged, note.Starred, note.EncryptionIV, note.CreatedBy,
 		note.UpdatedBy, note.CreatedAt, note.UpdatedAt, note.SyncedAt, note.DeletedAt,
 	)
 	if err != nil {
 		return note, serr.Wrap(err, "synced note created on disk but cache insert failed")
 	}
+	updateSyncChecksum("note", note.GUID)
 
 	return note, nil
 }
 
+// ErrNoteNeedsSnapshot is returned (wrapped) by ApplySyncNoteUpdate when the
+// note doesn't exist locally and the update alone can't create it, because its
+// body is a diff or it carries no body. The caller should fetch the note's
+// snapshot (GET /api/v1/sync/snapshot) and apply that instead.
+var ErrNoteNeedsSnapshot = errors.New("note not found for sync update, need full snapshot")
+
 // ApplySyncNoteUpdate updates a note from sync data, preserving the source authored_at.
 // Builds a dynamic SET clause from the fragment bitmask so only changed fields are
 // updated. If the fragment body is a diff, it applies the diff against the current body.
-func ApplySyncNoteUpdate(noteGUID string, fragment NoteFragment, authoredAt time.Time) error {
+// userGUID is the user who authored the change upstream and becomes updated_by.
+//
+// An update can arrive before the create of its note when changes are synced
+// out of order. If the fragment has a full body the note is created from it
+// (fields the update doesn't carry start out empty); otherwise
+// ErrNoteNeedsSnapshot is returned.
+//
+// Serialized with local updates of the same note (see lockNote).
+func ApplySyncNoteUpdate(noteGUID string, fragment NoteFragment, authoredAt time.Time, userGUID, originPeer string) error {
 	// Get the current note to apply diffs against
 	existing, err := GetNoteByGUID(noteGUID)
 	if err != nil {
 		return serr.Wrap(err, "failed to get existing note for sync update")
 	}
 	if existing == nil {
-		return serr.New("note not found for sync update: " + noteGUID)
+		// An update for a note we soft-deleted means the source restored it
+		revived, err := undeleteSyncedNote(noteGUID)
+		if err != nil {
+			return err
+		}
+		if revived {
+			existing, err = GetNoteByGUID(noteGUID)
+			if err != nil {
+				return serr.Wrap(err, "failed to get restored note for sync update")
+			}
+		}
+	}
+	if existing == nil {
+		// A diff has no base to apply to here, and without a body there's
+		// no note content to create from
+		if fragment.Bitmask&FragmentBody == 0 || fragment.BodyIsDiff {
+			return serr.Wrap(ErrNoteNeedsSnapshot, "note_guid", noteGUID)
+		}
+		title := ""
+		if fragment.Title.Valid {
+			title = fragment.Title.String
+		}
+		if _, err := ApplySyncNoteCreate(noteGUID, title, fragment, authoredAt, userGUID, originPeer); err != nil {
+			return serr.Wrap(err, "failed to create note from sync update", "note_guid", noteGUID)
+		}
+		logger.Info("Created note from sync update that arrived before its create", "note_guid", noteGUID)
+		return nil
+	}
+
+	// Hold the note's lock from reading it to writing it, as UpdateNote does,
+	// so a body diff applies to the current body and a concurrent local
+	// update can't compute its delta against a state this overwrites. The
+	// note is re-read under the lock in case an update finished meanwhile.
+	unlock := lockNote(existing.ID)
+	defer unlock()
+	existing, err = GetNoteByGUID(noteGUID)
+	if err != nil {
+		return serr.Wrap(err, "failed to get existing note for sync update")
+	}
+	if existing == nil {
+		return serr.New("note deleted during sync update: " + noteGUID)
 	}
 
 	// Build the fields to update dynamically based on the bitmask
@@ -129,8 +202,13 @@ func ApplySyncNoteUpdate(noteGUID string, fragment NoteFragment, authoredAt time
 		} else {
 			resolvedBody = fragment.Body
 		}
-		setClauses = append(setClauses, "body = ?")
-		args = append(args, resolvedBody)
+		diskBody, bodyCompressed, err := compressBodyForDisk(nullStringToPtr(resolvedBody))
+		if err != nil {
+			return err
+		}
+		// The synced body is written unencrypted, so any previous IV no longer applies
+		setClauses = append(setClauses, "body = ?", "body_compressed = ?", "encryption_iv = NULL")
+		args = append(args, diskBody, bodyCompressed)
 	}
 	if fragment.Bitmask&FragmentTags != 0 {
 		setClauses = append(setClauses, "tags = ?")
@@ -140,6 +218,10 @@ func ApplySyncNoteUpdate(noteGUID string, fragment NoteFragment, authoredAt time
 		setClauses = append(setClauses, "is_private = ?")
 		args = append(args, fragment.IsPrivate.Bool)
 	}
+	if fragment.Bitmask&FragmentStarred != 0 && fragment.Starred.Valid {
+		setClauses = append(setClauses, "starred = ?")
+		args = append(args, fragment.Starred.Bool)
+	}
 
 	if len(setClauses) == 0 {
 		return nil // Nothing to update
@@ -149,6 +231,12 @@ func ApplySyncNoteUpdate(noteGUID string, fragment NoteFragment, authoredAt time
 	setClauses = append(setClauses, "authored_at = ?", "synced_at = CURRENT_TIMESTAMP", "updated_at = CURRENT_TIMESTAMP")
 	args = append(args, authoredAt)
 
+	// Attribute the edit to the remote author when the change names one
+	if userGUID != "" {
+		setClauses = append(setClauses, "updated_by = ?")
+		args = append(args, userGUID)
+	}
+
 	// Build and execute the disk update query
 	query := "UPDATE notes SET " + joinStrings(setClauses, ", ") + " WHERE guid = ? AND deleted_at IS NULL"
 	args = append(args, noteGUID)
@@ -166,8 +254,8 @@ func ApplySyncNoteUpdate(noteGUID string, fragment NoteFragment, authoredAt time
 	if fragmentID, err := insertNoteFragment(fragment); err != nil {
 		logger.LogErr(err, "failed to record sync update fragment", "note_guid", noteGUID)
 	} else {
-		if err := insertNoteChange(GenerateChangeGUID(), noteGUID, OperationSync,
-			sql.NullInt64{Int64: fragmentID, Valid: true}, ""); err != nil {
+		if err := insertNoteChangeFromPeer(GenerateChangeGUID(), noteGUID, OperationSync,
+			sql.NullInt64{Int64: fragmentID, Valid: true}, userGUID, originPeer); err != nil {
 			logger.LogErr(err, "failed to record sync update change", "note_guid", noteGUID)
 		}
 	}
@@ -178,26 +266,51 @@ func ApplySyncNoteUpdate(noteGUID string, fragment NoteFragment, authoredAt time
 	if err != nil || diskNote == nil {
 		return serr.Wrap(err, "failed to read updated note from disk for cache sync")
 	}
+	if fragment.Bitmask&FragmentBody != 0 {
+		recordNoteLinks(noteGUID, diskNote.Body)
+	}
 
 	cacheQuery := `
-		UPDATE notes SET title = ?, description = ?, body = ?, tags = ?, is_private = ?,
-		    updated_at = ?, synced_at = ?
+		UPDATE notes SET title = ?, description = ?, body = ?, tags = ?, is_private = ?, starred = ?,
+		    updated_by = ?, updated_at = ?, synced_at = ?
 		WHERE guid = ? AND deleted_at IS NULL
 	`
 	_, err = cacheDB.Exec(cacheQuery,
 		diskNote.Title, diskNote.Description, diskNote.Body, diskNote.Tags,
-		diskNote.IsPrivate, diskNote.UpdatedAt, diskNote.SyncedAt, noteGUID,
+		diskNote.IsPrivate, diskNote.Starred, diskNote.UpdatedBy, diskNote.UpdatedAt, diskNote.SyncedAt, noteGUID,
 	)
 	if err != nil {
 		return serr.Wrap(err, "sync note updated on disk but cache update failed")
 	}
+	updateSyncChecksum("note", noteGUID)
 
 	return nil
 }
 
+// undeleteSyncedNote clears deleted_at on a soft-deleted note in both databases.
+// Returns false if the note is not in the trash (missing or already active).
+func undeleteSyncedNote(noteGUID string) (bool, error) {
+	result, err := db.Exec(`UPDATE notes SET deleted_at = NULL WHERE guid = ? AND deleted_at IS NOT NULL`, noteGUID)
+	if err != nil {
+		return false, serr.Wrap(err, "failed to restore synced note on disk")
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	_, err = cacheDB.Exec(`UPDATE notes SET deleted_at = NULL WHERE guid = ? AND deleted_at IS NOT NULL`, noteGUID)
+	if err != nil {
+		return true, serr.Wrap(err, "synced note restored on disk but cache update failed")
+	}
+	updateSyncChecksum("note", noteGUID)
+
+	return true, nil
+}
+
 // ApplySyncNoteDelete soft-deletes a note received via sync.
 // Sets deleted_at on both disk and cache databases.
-func ApplySyncNoteDelete(noteGUID string) error {
+func ApplySyncNoteDelete(noteGUID, originPeer string) error {
 	// Delete from disk
 	result, err := db.Exec(
 		`UPDATE notes SET deleted_at = CURRENT_TIMESTAMP, synced_at = CURRENT_TIMESTAMP WHERE guid = ? AND deleted_at IS NULL`,
@@ -213,8 +326,8 @@ func ApplySyncNoteDelete(noteGUID string) error {
 	}
 
 	// Record change with OperationSync
-	if err := insertNoteChange(GenerateChangeGUID(), noteGUID, OperationDelete,
-		sql.NullInt64{}, ""); err != nil {
+	if err := insertNoteChangeFromPeer(GenerateChangeGUID(), noteGUID, OperationDelete,
+		sql.NullInt64{}, "", originPeer); err != nil {
 		logger.LogErr(err, "failed to record sync delete change", "note_guid", noteGUID)
 	}
 
@@ -226,13 +339,15 @@ func ApplySyncNoteDelete(noteGUID string) error {
 	if err != nil {
 		return serr.Wrap(err, "synced note deleted from disk but cache delete failed")
 	}
+	updateSyncChecksum("note", noteGUID)
 
 	return nil
 }
 
 // ApplySyncCategoryCreate creates a category from sync data.
 // The userGUID parameter sets created_by for multi-user data isolation on the hub.
-func ApplySyncCategoryCreate(categoryGUID, name string, fragment CategoryFragment, userGUID string) (*Category, error) {
+// As with notes, the id is assigned locally; only the GUID comes from the peer.
+func ApplySyncCategoryCreate(categoryGUID, name string, fragment CategoryFragment, userGUID, originPeer string) (*Category, error) {
 	// Extract field values from fragment
 	description := fragment.Description
 	subcategories := fragment.Subcategories
@@ -261,8 +376,8 @@ func ApplySyncCategoryCreate(categoryGUID, name string, fragment CategoryFragmen
 	if fragmentID, err := insertCategoryFragment(fragment); err != nil {
 		logger.LogErr(err, "failed to record sync category create fragment", "category_guid", categoryGUID)
 	} else {
-		if err := insertCategoryChange(GenerateChangeGUID(), categoryGUID, OperationSync,
-			sql.NullInt64{Int64: fragmentID, Valid: true}, ""); err != nil {
+		if err := insertCategoryChangeFromPeer(GenerateChangeGUID(), categoryGUID, OperationSync,
+			sql.NullInt64{Int64: fragmentID, Valid: true}, "", originPeer); err != nil {
 			logger.LogErr(err, "failed to record sync category create change", "category_guid", categoryGUID)
 		}
 	}
@@ -277,12 +392,13 @@ func ApplySyncCategoryCreate(categoryGUID, name string, fragment CategoryFragmen
 	if err != nil {
 		return &category, serr.Wrap(err, "synced category created on disk but cache insert failed")
 	}
+	updateSyncChecksum("category", category.GUID)
 
 	return &category, nil
 }
 
 // ApplySyncCategoryUpdate updates a category from sync data.
-func ApplySyncCategoryUpdate(categoryGUID string, fragment CategoryFragment) error {
+func ApplySyncCategoryUpdate(categoryGUID string, fragment CategoryFragment, originPeer string) error {
 	// Build dynamic SET clause from bitmask
 	setClauses := []string{}
 	args := []interface{}{}
@@ -318,8 +434,8 @@ func ApplySyncCategoryUpdate(categoryGUID string, fragment CategoryFragment) err
 	if fragmentID, err := insertCategoryFragment(fragment); err != nil {
 		logger.LogErr(err, "failed to record sync category update fragment", "category_guid", categoryGUID)
 	} else {
-		if err := insertCategoryChange(GenerateChangeGUID(), categoryGUID, OperationSync,
-			sql.NullInt64{Int64: fragmentID, Valid: true}, ""); err != nil {
+		if err := insertCategoryChangeFromPeer(GenerateChangeGUID(), categoryGUID, OperationSync,
+			sql.NullInt64{Int64: fragmentID, Valid: true}, "", originPeer); err != nil {
 			logger.LogErr(err, "failed to record sync category update change", "category_guid", categoryGUID)
 		}
 	}
@@ -342,12 +458,18 @@ func ApplySyncCategoryUpdate(categoryGUID string, fragment CategoryFragment) err
 	if err != nil {
 		return serr.Wrap(err, "synced category updated on disk but cache update failed")
 	}
+	updateSyncChecksum("category", categoryGUID)
 
 	return nil
 }
 
 // ApplySyncCategoryDelete deletes a category from sync.
-func ApplySyncCategoryDelete(categoryGUID string) error {
+func ApplySyncCategoryDelete(categoryGUID, originPeer string) error {
+	if _, err := db.Exec(`DELETE FROM category_favorites
+		WHERE category_id IN (SELECT id FROM categories WHERE guid = ?)`, categoryGUID); err != nil {
+		return serr.Wrap(err, "failed to remove synced category from favorites")
+	}
+
 	// Delete from disk
 	_, err := db.Exec(`DELETE FROM categories WHERE guid = ?`, categoryGUID)
 	if err != nil {
@@ -355,8 +477,8 @@ func ApplySyncCategoryDelete(categoryGUID string) error {
 	}
 
 	// Record change with OperationSync
-	if err := insertCategoryChange(GenerateChangeGUID(), categoryGUID, OperationDelete,
-		sql.NullInt64{}, ""); err != nil {
+	if err := insertCategoryChangeFromPeer(GenerateChangeGUID(), categoryGUID, OperationDelete,
+		sql.NullInt64{}, "", originPeer); err != nil {
 		logger.LogErr(err, "failed to record sync category delete change", "category_guid", categoryGUID)
 	}
 
@@ -365,6 +487,7 @@ func ApplySyncCategoryDelete(categoryGUID string) error {
 	if err != nil {
 		return serr.Wrap(err, "synced category deleted from disk but cache delete failed")
 	}
+	updateSyncChecksum("category", categoryGUID)
 
 	return nil
 }
@@ -460,18 +583,20 @@ func joinStrings(parts []string, sep string) string {
 
 // getNoteByGUIDFromDisk retrieves a note by GUID directly from the disk database.
 // Used by sync operations that need the canonical state after a disk write.
+// The body is returned as plaintext (decrypted and decompressed), as sync sends it.
 func getNoteByGUIDFromDisk(guid string) (*Note, error) {
 	query := `
-		SELECT id, guid, title, description, body, tags, is_private, is_flagged, encryption_iv,
+		SELECT id, guid, title, description, body, body_compressed, tags, is_private, is_flagged, starred, encryption_iv,
 		       created_by, updated_by, created_at, updated_at, authored_at, synced_at, deleted_at
 		FROM notes
 		WHERE guid = ? AND deleted_at IS NULL
 	`
 
 	note := &Note{}
+	var bodyCompressed bool
 	err := db.QueryRow(query, guid).Scan(
-		&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body,
-		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.EncryptionIV, &note.CreatedBy,
+		&note.ID, &note.GUID, &note.Title, &note.Description, &note.Body, &bodyCompressed,
+		&note.Tags, &note.IsPrivate, &note.IsFlagged, &note.Starred, &note.EncryptionIV, &note.CreatedBy,
 		&note.UpdatedBy, &note.CreatedAt, &note.UpdatedAt, &note.AuthoredAt, &note.SyncedAt, &note.DeletedAt,
 	)
 
@@ -482,5 +607,9 @@ func getNoteByGUIDFromDisk(guid string) (*Note, error) {
 		return nil, serr.Wrap(err, "failed to get note by GUID from disk")
 	}
 
+	if err := decodeDiskBody(note, bodyCompressed); err != nil {
+		return nil, serr.Wrap(err, "failed to decode note body from disk", "note_guid", guid)
+	}
+
 	return note, nil
 }
@@ -0,0 +1,395 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Incremental Sync Checksum
+//
+// The sync checksum (see GetSyncStatus) is the XOR of one digest per note and
+// category, each a hash of the entity's GUID and synced content. XOR makes it
+// order-free and reversible: an entity can be removed from the checksum by
+// XORing its digest out again. Rather than hashing every row on each status
+// call, the cache keeps each entity's current digest and the running XOR per
+// scope (all entities, and each owner's) in two small tables. Every write
+// that changes a note or category calls updateSyncChecksum, which swaps the
+// entity's old digest for its new one, so reading the checksum is a single
+// lookup. Digests are hashed from the disk database, the source of truth, so
+// a lazy cache holding only some rows doesn't change the checksum.
+//
+// The state starts stale with each fresh cache (and after RebuildCache) and
+// goes stale again if an update fails; GetSyncStatus rebuilds stale state
+// with a full scan. RecomputeSyncChecksums forces that rebuild.
+// ============================================================================
+
+const DDLCreateSyncChecksumDigestsTable = `
+CREATE TABLE IF NOT EXISTS sync_checksum_digests (
+    entity_type VARCHAR NOT NULL,
+    guid        VARCHAR NOT NULL,
+    owner       VARCHAR NOT NULL,
+    digest      VARCHAR NOT NULL,
+    PRIMARY KEY (entity_type, guid)
+);
+`
+
+const DDLCreateSyncChecksumsTable = `
+CREATE TABLE IF NOT EXISTS sync_checksums (
+    scope    VARCHAR PRIMARY KEY,
+    checksum VARCHAR NOT NULL
+);
+`
+
+// syncChecksumAllScope is the scope covering every entity; other scopes are
+// owner GUIDs.
+const syncChecksumAllScope = "*"
+
+// Queries selecting the GUID, owner, and synced content of entities on disk,
+// extended with AND clauses. Timestamps are left out: applying a synced
+// change stamps updated_at with the receiving machine's clock, so converged
+// machines would never agree. is_flagged is local-only (it doesn't sync) and
+// is excluded. The note query ends with the columns needed to decode the
+// stored body (see decodeChecksumBody), which aren't hashed themselves.
+const (
+	noteChecksumQuery = `SELECT guid, COALESCE(created_by, ''), title, COALESCE(description, ''),
+		COALESCE(body, ''), COALESCE(tags, ''), CAST(COALESCE(is_private, false) AS VARCHAR),
+		CAST(COALESCE(starred, false) AS VARCHAR),
+		CAST(COALESCE(body_compressed, false) AS VARCHAR), COALESCE(encryption_iv, '')
+		FROM notes WHERE guid IS NOT NULL AND deleted_at IS NULL`
+	categoryChecksumQuery = `SELECT guid, COALESCE(created_by, ''), name, COALESCE(description, ''),
+		COALESCE(subcategories, '')
+		FROM categories WHERE guid IS NOT NULL`
+)
+
+// noteChecksumDecodeColumns is the number of trailing noteChecksumQuery
+// columns used only to decode the body.
+const noteChecksumDecodeColumns = 2
+
+// syncChecksumMu serializes changes to the checksum tables, which are
+// read-modify-write.
+var syncChecksumMu sync.Mutex
+
+// syncChecksumStale is set while the checksum tables don't reflect the cache.
+var syncChecksumStale atomic.Bool
+
+// entityDigest is one entity's contribution to the checksum.
+type entityDigest [sha256.Size]byte
+
+// xor folds d into the running checksum.
+func (c *entityDigest) xor(d entityDigest) {
+	for i := range c {
+		c[i] ^= d[i]
+	}
+}
+
+// markSyncChecksumStale makes the next GetSyncStatus rebuild the checksum.
+func markSyncChecksumStale() {
+	syncChecksumStale.Store(true)
+}
+
+// scanEntityDigests runs a checksum query (see noteChecksumQuery) against the
+// disk database and calls fn with each entity's GUID, owner, and digest. Note
+// bodies are hashed as plaintext, as the cache holds them. Each field is
+// length-prefixed in the digest so that moving text between fields changes
+// it.
+func scanEntityDigests(entityType, query string, args []any, fn func(guid, owner string, d entityDigest) error) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]string, len(cols))
+	dest := make([]any, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		fields := values[2:]
+		if entityType == "note" {
+			decodeChecksumBody(values)
+			fields = values[2 : len(values)-noteChecksumDecodeColumns]
+		}
+		h := sha256.New()
+		fmt.Fprintf(h, "%s:%s", entityType, values[0])
+		for _, v := range fields {
+			fmt.Fprintf(h, "%d:%s", len(v), v)
+		}
+		var d entityDigest
+		copy(d[:], h.Sum(nil))
+		if err := fn(values[0], values[1], d); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// decodeChecksumBody replaces the stored body in a noteChecksumQuery row with
+// its plaintext, decrypting and decompressing it as loadNotesIntoCache does.
+// A body that can't be decoded is logged and hashed as stored, matching what
+// the cache then holds.
+func decodeChecksumBody(values []string) {
+	if values[4] == "" {
+		return
+	}
+	iv := values[len(values)-1]
+	note := Note{
+		GUID:         values[0],
+		Body:         sql.NullString{String: values[4], Valid: true},
+		IsPrivate:    values[6] == "true",
+		EncryptionIV: sql.NullString{String: iv, Valid: iv != ""},
+	}
+	if err := decodeDiskBody(&note, values[len(values)-2] == "true"); err != nil {
+		logger.LogErr(err, "failed to decode note body for sync checksum", "guid", note.GUID)
+		return
+	}
+	values[4] = note.Body.String
+}
+
+// computeSyncChecksum hashes every note and category from scratch,
+// limited to those owned by userGUID unless it is "". It returns what the
+// maintained checksum should be.
+func computeSyncChecksum(userGUID string) (string, error) {
+	var sum entityDigest
+	for _, entity := range []struct{ entityType, query string }{
+		{"note", noteChecksumQuery},
+		{"category", categoryChecksumQuery},
+	} {
+		query := entity.query
+		var args []any
+		if userGUID != "" {
+			query += ` AND created_by = ?`
+			args = []any{userGUID}
+		}
+		if err := scanEntityDigests(entity.entityType, query, args, func(_, _ string, d entityDigest) error {
+			sum.xor(d)
+			return nil
+		}); err != nil {
+			return "", serr.Wrap(err, "failed to hash entities for checksum", "entity_type", entity.entityType)
+		}
+	}
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// RecomputeSyncChecksums rebuilds the maintained checksums with a full scan
+// of the disk database.
+func RecomputeSyncChecksums() error {
+	syncChecksumMu.Lock()
+	defer syncChecksumMu.Unlock()
+	return recomputeSyncChecksums()
+}
+
+// recomputeSyncChecksums rebuilds the checksum tables. Callers hold
+// syncChecksumMu, which is what keeps readers from seeing a half-built state:
+// it can't be one transaction, as DuckDB rejects reinserting a key deleted
+// earlier in the same transaction. The state stays stale until it succeeds.
+func recomputeSyncChecksums() error {
+	markSyncChecksumStale()
+
+	for _, table := range []string{"sync_checksum_digests", "sync_checksums"} {
+		if _, err := cacheDB.Exec("DELETE FROM " + table); err != nil {
+			return serr.Wrap(err, "failed to clear checksum table", "table", table)
+		}
+	}
+
+	sums := map[string]*entityDigest{syncChecksumAllScope: {}}
+	for _, entity := range []struct{ entityType, query string }{
+		{"note", noteChecksumQuery},
+		{"category", categoryChecksumQuery},
+	} {
+		err := scanEntityDigests(entity.entityType, entity.query, nil, func(guid, owner string, d entityDigest) error {
+			if _, err := cacheDB.Exec(`INSERT INTO sync_checksum_digests (entity_type, guid, owner, digest)
+				VALUES (?, ?, ?, ?)`, entity.entityType, guid, owner, hex.EncodeToString(d[:])); err != nil {
+				return err
+			}
+			sums[syncChecksumAllScope].xor(d)
+			if owner != "" {
+				if sums[owner] == nil {
+					sums[owner] = &entityDigest{}
+				}
+				sums[owner].xor(d)
+			}
+			return nil
+		})
+		if err != nil {
+			return serr.Wrap(err, "failed to hash entities for checksum", "entity_type", entity.entityType)
+		}
+	}
+
+	for scope, sum := range sums {
+		if _, err := cacheDB.Exec(`INSERT INTO sync_checksums (scope, checksum) VALUES (?, ?)`,
+			scope, hex.EncodeToString(sum[:])); err != nil {
+			return serr.Wrap(err, "failed to store checksum", "scope", scope)
+		}
+	}
+
+	syncChecksumStale.Store(false)
+	return nil
+}
+
+// currentSyncChecksum returns the maintained checksum of userGUID's notes
+// and categories, or of all of them if userGUID is "", rebuilding stale
+// state first.
+func currentSyncChecksum(userGUID string) (string, error) {
+	syncChecksumMu.Lock()
+	defer syncChecksumMu.Unlock()
+
+	if syncChecksumStale.Load() {
+		if err := recomputeSyncChecksums(); err != nil {
+			return "", err
+		}
+	}
+
+	scope := userGUID
+	if scope == "" {
+		scope = syncChecksumAllScope
+	}
+	var checksum string
+	err := cacheDB.QueryRow(`SELECT checksum FROM sync_checksums WHERE scope = ?`, scope).Scan(&checksum)
+	if err == sql.ErrNoRows {
+		var empty entityDigest
+		return hex.EncodeToString(empty[:]), nil // Owns nothing
+	}
+	if err != nil {
+		return "", serr.Wrap(err, "failed to read sync checksum")
+	}
+	return checksum, nil
+}
+
+// updateSyncChecksum brings the checksums up to date after a note or category
+// was written, removed, or soft-deleted on disk. Non-blocking: on failure
+// it logs and leaves the state stale, for the next status call to rebuild.
+func updateSyncChecksum(entityType, guid string) {
+	syncChecksumMu.Lock()
+	defer syncChecksumMu.Unlock()
+	if syncChecksumStale.Load() {
+		return // The next read rebuilds everything anyway
+	}
+
+	if err := applySyncChecksumUpdate(entityType, guid); err != nil {
+		logger.LogErr(err, "failed to update sync checksum; it will be recomputed",
+			"entity_type", entityType, "guid", guid)
+		markSyncChecksumStale()
+	}
+}
+
+// applySyncChecksumUpdate swaps an entity's stored digest for its current one.
+func applySyncChecksumUpdate(entityType, guid string) error {
+	var query string
+	switch entityType {
+	case "note":
+		query = noteChecksumQuery
+	case "category":
+		query = categoryChecksumQuery
+	default:
+		return serr.New("unknown entity type for sync checksum: " + entityType)
+	}
+
+	var oldOwner, oldDigestHex string
+	err := cacheDB.QueryRow(`SELECT owner, digest FROM sync_checksum_digests WHERE entity_type = ? AND guid = ?`,
+		entityType, guid).Scan(&oldOwner, &oldDigestHex)
+	hadOld := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return serr.Wrap(err, "failed to read stored entity digest")
+	}
+
+	var newOwner string
+	var newDigest entityDigest
+	hasNew := false
+	if err := scanEntityDigests(entityType, query+` AND guid = ?`, []any{guid}, func(_, owner string, d entityDigest) error {
+		newOwner, newDigest, hasNew = owner, d, true
+		return nil
+	}); err != nil {
+		return serr.Wrap(err, "failed to hash entity for checksum")
+	}
+	newDigestHex := hex.EncodeToString(newDigest[:])
+
+	if hadOld == hasNew && oldOwner == newOwner && oldDigestHex == newDigestHex {
+		return nil // Content unchanged
+	}
+
+	changes := map[string]*entityDigest{}
+	fold := func(owner string, d entityDigest) {
+		for _, scope := range []string{syncChecksumAllScope, owner} {
+			if scope == "" {
+				continue
+			}
+			if changes[scope] == nil {
+				changes[scope] = &entityDigest{}
+			}
+			changes[scope].xor(d)
+		}
+	}
+	if hadOld {
+		oldBytes, err := hex.DecodeString(oldDigestHex)
+		if err != nil || len(oldBytes) != sha256.Size {
+			return serr.New("invalid stored entity digest")
+		}
+		var oldDigest entityDigest
+		copy(oldDigest[:], oldBytes)
+		fold(oldOwner, oldDigest)
+	}
+	if hasNew {
+		fold(newOwner, newDigest)
+	}
+
+	tx, err := cacheDB.Begin()
+	if err != nil {
+		return serr.Wrap(err, "failed to begin checksum update")
+	}
+	defer tx.Rollback()
+
+	if hasNew {
+		_, err = tx.Exec(`INSERT INTO sync_checksum_digests (entity_type, guid, owner, digest) VALUES (?, ?, ?, ?)
+			ON CONFLICT (entity_type, guid) DO UPDATE SET owner = excluded.owner, digest = excluded.digest`,
+			entityType, guid, newOwner, newDigestHex)
+	} else {
+		_, err = tx.Exec(`DELETE FROM sync_checksum_digests WHERE entity_type = ? AND guid = ?`, entityType, guid)
+	}
+	if err != nil {
+		return serr.Wrap(err, "failed to store entity digest")
+	}
+
+	for scope, change := range changes {
+		var sum entityDigest
+		var sumHex string
+		err := tx.QueryRow(`SELECT checksum FROM sync_checksums WHERE scope = ?`, scope).Scan(&sumHex)
+		if err != nil && err != sql.ErrNoRows {
+			return serr.Wrap(err, "failed to read sync checksum", "scope", scope)
+		}
+		if err == nil {
+			sumBytes, err := hex.DecodeString(sumHex)
+			if err != nil || len(sumBytes) != sha256.Size {
+				return serr.New("invalid stored sync checksum", "scope", scope)
+			}
+			copy(sum[:], sumBytes)
+		}
+		sum.xor(*change)
+		if _, err := tx.Exec(`INSERT INTO sync_checksums (scope, checksum) VALUES (?, ?)
+			ON CONFLICT (scope) DO UPDATE SET checksum = excluded.checksum`,
+			scope, hex.EncodeToString(sum[:])); err != nil {
+			return serr.Wrap(err, "failed to store sync checksum", "scope", scope)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return serr.Wrap(err, "failed to commit checksum update")
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSyncChecksumMaintainedIncrementally edits notes and categories through
+// the usual write paths and verifies after each that GetSyncStatus reports
+// the checksum of a full recompute, per user and overall, without the
+// maintained state going stale.
+func TestSyncChecksumMaintainedIncrementally(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	const otherUserGUID = "sc-checksum-other-user"
+	body := "first body"
+
+	// The first status call builds the maintained state
+	note, err := CreateNote(NoteInput{GUID: "sc-checksum-note", Title: "Checksum", Body: &body}, scTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if _, err := CreateNote(NoteInput{GUID: "sc-checksum-other", Title: "Other"}, otherUserGUID); err != nil {
+		t.Fatalf("failed to create other user's note: %v", err)
+	}
+
+	check := func(step string) {
+		t.Helper()
+		for _, userGUID := range []string{"", scTestUserGUID, otherUserGUID} {
+			status, err := GetSyncStatus(userGUID)
+			if err != nil {
+				t.Fatalf("%s: GetSyncStatus failed: %v", step, err)
+			}
+			want, err := computeSyncChecksum(userGUID)
+			if err != nil {
+				t.Fatalf("%s: computeSyncChecksum failed: %v", step, err)
+			}
+			if status.Checksum != want {
+				t.Errorf("%s: user %q checksum %s, full recompute %s", step, userGUID, status.Checksum, want)
+			}
+		}
+	}
+	check("initial")
+
+	edits := []struct {
+		step string
+		edit func() error
+	}{
+		{"update note", func() error {
+			body := "second body"
+			_, err := UpdateNote(note.ID, NoteInput{GUID: note.GUID, Title: "Checksum", Body: &body}, scTestUserGUID)
+			return err
+		}},
+		{"create category", func() error {
+			_, err := CreateCategory(CategoryInput{Name: "Checksum Cat"}, scTestUserGUID)
+			return err
+		}},
+		{"update category", func() error {
+			cat, err := GetCategoryByGUID(mustCategoryGUID(t, "Checksum Cat"))
+			if err != nil {
+				return err
+			}
+			_, err = UpdateCategory(cat.ID, CategoryInput{Name: "Checksum Cat", Subcategories: []string{"a"}}, scTestUserGUID)
+			return err
+		}},
+		{"delete note", func() error {
+			_, err := DeleteNote(note.ID, scTestUserGUID)
+			return err
+		}},
+		{"restore note", func() error {
+			_, err := RestoreNote(note.ID, scTestUserGUID)
+			return err
+		}},
+		{"apply synced update", func() error {
+			title := "Synced Title"
+			return ApplySyncNoteUpdate(note.GUID, NoteFragment{Bitmask: FragmentTitle,
+				Title: sql.NullString{String: title, Valid: true}}, time.Now(), scTestUserGUID, "sc-test-peer")
+		}},
+		{"delete category", func() error {
+			cat, err := GetCategoryByGUID(mustCategoryGUID(t, "Checksum Cat"))
+			if err != nil {
+				return err
+			}
+			return DeleteCategory(cat.ID, scTestUserGUID, true)
+		}},
+	}
+	for _, e := range edits {
+		if err := e.edit(); err != nil {
+			t.Fatalf("%s failed: %v", e.step, err)
+		}
+		if syncChecksumStale.Load() {
+			t.Fatalf("%s: expected the checksum to be updated incrementally, not marked stale", e.step)
+		}
+		check(e.step)
+	}
+
+	// A corrupted checksum is repaired by a full recompute
+	if _, err := cacheDB.Exec(`UPDATE sync_checksums SET checksum = 'bad'`); err != nil {
+		t.Fatalf("failed to corrupt checksum: %v", err)
+	}
+	if err := RecomputeSyncChecksums(); err != nil {
+		t.Fatalf("RecomputeSyncChecksums failed: %v", err)
+	}
+	check("recompute")
+}
+
+// mustCategoryGUID returns the GUID of the cached category with the given name.
+func mustCategoryGUID(t *testing.T, name string) string {
+	t.Helper()
+	var guid string
+	if err := cacheDB.QueryRow(`SELECT guid FROM categories WHERE name = ?`, name).Scan(&guid); err != nil {
+		t.Fatalf("failed to find category %q: %v", name, err)
+	}
+	return guid
+}
+
+// TestSyncChecksumLazyCache verifies that with a lazy cache the checksum
+// covers every entity on disk, not just those loaded so far, and doesn't
+// change when a note is lazily loaded.
+func TestSyncChecksumLazyCache(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+	t.Setenv(BodyCompressionThresholdEnvVar, "64") // Store the long body compressed
+
+	longBody := strings.Repeat("a body long enough to be compressed on disk. ", 10)
+	note, err := CreateNote(NoteInput{GUID: "sc-lazy-note", Title: "Lazy", Body: &longBody}, scTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if _, err := CreateNote(NoteInput{GUID: "sc-lazy-other", Title: "Other"}, scTestUserGUID); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if _, err := CreateCategory(CategoryInput{Name: "Lazy Cat"}, scTestUserGUID); err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+
+	checksums := func() map[string]string {
+		t.Helper()
+		sums := map[string]string{}
+		for _, userGUID := range []string{"", scTestUserGUID} {
+			status, err := GetSyncStatus(userGUID)
+			if err != nil {
+				t.Fatalf("GetSyncStatus failed: %v", err)
+			}
+			sums[userGUID] = status.Checksum
+		}
+		return sums
+	}
+	eager := checksums()
+
+	// Reopen the same disk database with an empty, lazily filled cache
+	if err := CloseDB(); err != nil {
+		t.Fatalf("failed to close database: %v", err)
+	}
+	if err := InitDBWithOptions(DBOptions{Path: "./test_sync_client.ddb", LazyCache: true}); err != nil {
+		t.Fatalf("failed to reopen database with a lazy cache: %v", err)
+	}
+
+	check := func(step string) {
+		t.Helper()
+		for userGUID, got := range checksums() {
+			want, err := computeSyncChecksum(userGUID)
+			if err != nil {
+				t.Fatalf("%s: computeSyncChecksum failed: %v", step, err)
+			}
+			if got != want || got != eager[userGUID] {
+				t.Errorf("%s: user %q checksum %s, full recompute %s, eager cache %s",
+					step, userGUID, got, want, eager[userGUID])
+			}
+		}
+	}
+	check("empty lazy cache")
+
+	if loaded, err := GetNoteByID(note.ID, scTestUserGUID); err != nil || loaded == nil {
+		t.Fatalf("failed to lazily load note: %v", err)
+	}
+	check("after lazy load")
+}
@@ -5,9 +5,13 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -31,6 +35,8 @@ import (
 //     reset on success. Prevents hammering a downed hub.
 //   - Auth token is cached in memory and persisted to sync_state so the
 //     client survives restarts without re-authenticating every time.
+//   - Login requests a refresh token. Expired access tokens are renewed with
+//     it, and the password is dropped from memory once a refresh token is held.
 //   - Package-level singleton follows the existing var db / var cacheDB pattern.
 // ============================================================================
 
@@ -40,22 +46,43 @@ var syncClientInstance *SyncClient
 
 // SyncClient manages the background sync loop between a spoke and hub.
 type SyncClient struct {
-	config     *SyncConfig
-	peerID     string
-	authToken  string
-	httpClient *http.Client
-	syncMu     sync.Mutex  // Prevents concurrent sync cycles
-	enabled    atomic.Bool // Runtime toggle for the "enable sync" checkbox
-	cancelFunc context.CancelFunc
-	lastSync   time.Time
-	lastError  error
-	inProgress atomic.Bool // True while a sync cycle is running
+	config       *SyncConfig
+	peerID       string
+	authToken    string
+	refreshToken string // Exchanged for a new authToken on 401 (see refreshAccessToken)
+	httpClient   *http.Client
+	syncMu       sync.Mutex  // Prevents concurrent sync cycles
+	enabled      atomic.Bool // Runtime toggle for the "enable sync" checkbox
+	cancelFunc   context.CancelFunc
+	inProgress   atomic.Bool // True while a sync cycle is running
+
+	// stateMu guards lastSync, lastError, and consecutiveFailures, which the
+	// sync cycle writes while GetStatus reads them from HTTP handlers.
+	stateMu   sync.Mutex
+	lastSync  time.Time
+	lastError error
+
+	// pushRejections counts consecutive hub rejections per change GUID so a
+	// change can be dead-lettered after MaxPushRejections. Only touched
+	// within runSyncCycle (under syncMu); counts reset on restart.
+	pushRejections map[string]int
+
+	// cycle counts the current sync cycle's work for its sync_metrics row.
+	// Reset at the start of each cycle; only touched within runSyncCycle.
+	cycle syncCycleCounts
 
 	// Exponential backoff state — consecutive failures increase wait time.
 	// Cap at maxBackoff to avoid indefinitely long pauses.
 	consecutiveFailures int
 }
 
+// syncCycleCounts tallies one sync cycle for its SyncMetric.
+type syncCycleCounts struct {
+	pulled    int
+	pushed    int
+	conflicts int
+}
+
 // maxBackoff caps the exponential backoff to prevent excessively long waits
 // between retries when the hub is down for an extended period.
 const maxBackoff = 5 * time.Minute
@@ -114,6 +141,9 @@ func NewSyncClient(config *SyncConfig) (*SyncClient, error) {
 	if state.AuthToken.Valid && state.AuthToken.String != "" {
 		client.authToken = state.AuthToken.String
 	}
+	if state.RefreshToken.Valid && state.RefreshToken.String != "" {
+		client.refreshToken = state.RefreshToken.String
+	}
 
 	syncClientInstance = client
 	return client, nil
@@ -128,10 +158,15 @@ func GetSyncClient() *SyncClient {
 // Start launches the background sync goroutine.
 // The first cycle runs immediately (passive sync on startup),
 // then subsequent cycles run on the configured interval.
+// If the databases aren't ready yet, the first cycle waits until they are.
 func (sc *SyncClient) Start(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
 	sc.cancelFunc = cancel
 
+	if !databasesReachable() {
+		logger.Info("Sync client waiting for database readiness before first cycle")
+	}
+
 	go sc.syncLoop(ctx)
 	logger.Info("Sync client started",
 		"hub_url", sc.config.HubURL,
@@ -140,6 +175,40 @@ func (sc *SyncClient) Start(ctx context.Context) {
 	)
 }
 
+// dbReadyPollInterval is how often the sync loop checks for database
+// readiness before its first cycle.
+const dbReadyPollInterval = 250 * time.Millisecond
+
+// databasesReachable reports whether the disk and cache databases are
+// initialized (IsDBReady) and answer a ping. Cycles run before then would
+// fail on their queries and push the client into backoff for nothing.
+func databasesReachable() bool {
+	if !IsDBReady() || db == nil || cacheDB == nil {
+		return false
+	}
+	return db.Ping() == nil && cacheDB.Ping() == nil
+}
+
+// waitForDatabases blocks until databasesReachable or ctx is done,
+// reporting whether the databases became reachable.
+func waitForDatabases(ctx context.Context) bool {
+	if databasesReachable() {
+		return true
+	}
+	ticker := time.NewTicker(dbReadyPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			if databasesReachable() {
+				return true
+			}
+		}
+	}
+}
+
 // Stop gracefully shuts down the sync client.
 func (sc *SyncClient) Stop() {
 	if sc.cancelFunc != nil {
@@ -148,6 +217,35 @@ func (sc *SyncClient) Stop() {
 	logger.Info("Sync client stopped")
 }
 
+// StopAndWait stops the sync client, first letting any in-flight sync cycle
+// run to completion so a pulled batch is never left half-applied. Stop
+// cancels the loop's context, which would abort the cycle's hub requests, so
+// it is only called once the cycle is done or the timeout has elapsed.
+// Returns an error if the cycle was still running when the timeout expired.
+func (sc *SyncClient) StopAndWait(timeout time.Duration) error {
+	// Taking syncMu waits out the current cycle and keeps new ones from
+	// starting (runSyncCycle uses TryLock). The lock is never released —
+	// the client is done for good once stopped.
+	idle := make(chan struct{})
+	go func() {
+		sc.syncMu.Lock()
+		close(idle)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-idle:
+		sc.Stop()
+		return nil
+	case <-timer.C:
+		sc.Stop()
+		return serr.New("timed out waiting for in-progress sync cycle",
+			"timeout", timeout.String())
+	}
+}
+
 // SyncNow triggers an immediate sync cycle (for the "Sync Now" button).
 // Returns an error if a sync is already in progress.
 func (sc *SyncClient) SyncNow() error {
@@ -157,6 +255,9 @@ func (sc *SyncClient) SyncNow() error {
 	if sc.inProgress.Load() {
 		return serr.New("sync already in progress")
 	}
+	if !databasesReachable() {
+		return serr.New("database not ready")
+	}
 
 	// Run synchronously so the caller knows when it completes
 	return sc.runSyncCycle(context.Background())
@@ -175,6 +276,9 @@ func (sc *SyncClient) IsEnabled() bool {
 
 // GetStatus returns the current sync state for UI display.
 func (sc *SyncClient) GetStatus() *SyncClientStatus {
+	sc.stateMu.Lock()
+	defer sc.stateMu.Unlock()
+
 	status := &SyncClientStatus{
 		Enabled:    sc.enabled.Load(),
 		Connected:  sc.consecutiveFailures == 0 && !sc.lastSync.IsZero(),
@@ -182,7 +286,8 @@ func (sc *SyncClient) GetStatus() *SyncClientStatus {
 		PeerID:     sc.peerID,
 	}
 	if !sc.lastSync.IsZero() {
-		status.LastSync = &sc.lastSync
+		lastSync := sc.lastSync // Copy so callers don't alias guarded state
+		status.LastSync = &lastSync
 	}
 	if sc.lastError != nil {
 		status.LastError = sc.lastError.Error()
@@ -190,10 +295,23 @@ func (sc *SyncClient) GetStatus() *SyncClientStatus {
 	return status
 }
 
+// ClearLastError acknowledges the most recent sync error so it no longer
+// shows in GetStatus. Backoff state is left alone — the next cycle's outcome
+// decides whether the client is considered connected.
+func (sc *SyncClient) ClearLastError() {
+	sc.stateMu.Lock()
+	defer sc.stateMu.Unlock()
+	sc.lastError = nil
+}
+
 // syncLoop is the background goroutine that runs sync cycles on a timer.
 // It runs immediately on startup, then waits for the configured interval
 // (or exponential backoff on failure) before each subsequent cycle.
 func (sc *SyncClient) syncLoop(ctx context.Context) {
+	if !waitForDatabases(ctx) {
+		return
+	}
+
 	// Run first cycle immediately (startup sync)
 	if sc.enabled.Load() {
 		if err := sc.runSyncCycle(ctx); err != nil {
@@ -216,17 +334,19 @@ func (sc *SyncClient) syncLoop(ctx context.Context) {
 			// Apply exponential backoff if we've had consecutive failures.
 			// The ticker still fires at the normal interval, but we skip
 			// cycles until the backoff period has elapsed.
-			if sc.consecutiveFailures > 0 {
-				backoff := sc.calculateBackoff()
-				timeSinceLastSync := time.Since(sc.lastSync)
-				if timeSinceLastSync < backoff {
-					continue // Still in backoff period
-				}
+			if sc.inBackoff() {
+				continue // Still in backoff period
+			}
+
+			// Skip cycles while the cache is being rebuilt (or the DB closed)
+			// rather than counting their failed queries against backoff
+			if !databasesReachable() {
+				continue
 			}
 
 			if err := sc.runSyncCycle(ctx); err != nil {
 				logger.LogErr(err, "sync cycle failed",
-					"consecutive_failures", sc.consecutiveFailures,
+					"consecutive_failures", sc.failureCount(),
 				)
 			}
 		}
@@ -235,7 +355,7 @@ func (sc *SyncClient) syncLoop(ctx context.Context) {
 
 // runSyncCycle executes one full sync cycle: health → auth → pull → push → verify.
 // Protected by syncMu to prevent the timer and SyncNow from racing.
-func (sc *SyncClient) runSyncCycle(ctx context.Context) error {
+func (sc *SyncClient) runSyncCycle(ctx context.Context) (err error) {
 	if !sc.syncMu.TryLock() {
 		return nil // Another cycle is running; skip this one
 	}
@@ -244,6 +364,11 @@ func (sc *SyncClient) runSyncCycle(ctx context.Context) error {
 	sc.inProgress.Store(true)
 	defer sc.inProgress.Store(false)
 
+	// Record the cycle in sync_metrics however it ends
+	startedAt := time.Now()
+	sc.cycle = syncCycleCounts{}
+	defer func() { sc.recordCycleMetric(startedAt, err) }()
+
 	// Step 1: Health check — verify hub is reachable before doing real work
 	if err := sc.healthCheck(ctx); err != nil {
 		sc.recordFailure(err)
@@ -274,9 +399,7 @@ func (sc *SyncClient) runSyncCycle(ctx context.Context) error {
 	}
 
 	// Success — reset backoff and record timestamps
-	sc.consecutiveFailures = 0
-	sc.lastError = nil
-	sc.lastSync = time.Now()
+	sc.recordSuccess()
 	if err := UpdateSyncTimestamps(sc.config.HubURL); err != nil {
 		logger.LogErr(err, "failed to persist sync timestamps")
 	}
@@ -285,8 +408,38 @@ func (sc *SyncClient) runSyncCycle(ctx context.Context) error {
 	return nil
 }
 
-// healthCheck pings the hub's health endpoint to verify connectivity.
+// recordCycleMetric writes the finished cycle's sync_metrics row. A failure
+// to record is logged; it never fails the cycle.
+func (sc *SyncClient) recordCycleMetric(startedAt time.Time, cycleErr error) {
+	metric := SyncMetric{
+		PeerID:        sc.peerID,
+		StartedAt:     startedAt,
+		DurationMs:    time.Since(startedAt).Milliseconds(),
+		ChangesPulled: sc.cycle.pulled,
+		ChangesPushed: sc.cycle.pushed,
+		Conflicts:     sc.cycle.conflicts,
+		Outcome:       SyncOutcomeSuccess,
+	}
+	if cycleErr != nil {
+		metric.Outcome = SyncOutcomeFailure
+		metric.Error = cycleErr.Error()
+	}
+	if err := InsertSyncMetric(metric); err != nil {
+		logger.LogErr(err, "failed to record sync cycle metric")
+	}
+}
+
+// healthCheck pings the hub's health endpoint to verify connectivity, then
+// checks the hub's version is compatible with ours.
 func (sc *SyncClient) healthCheck(ctx context.Context) error {
+	if err := sc.pingHub(ctx); err != nil {
+		return err
+	}
+	return sc.checkHubVersion(ctx)
+}
+
+// pingHub calls the hub's health endpoint.
+func (sc *SyncClient) pingHub(ctx context.Context) error {
 	url := sc.config.HubURL + "/api/v1/health"
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
@@ -305,6 +458,63 @@ func (sc *SyncClient) healthCheck(ctx context.Context) error {
 	return nil
 }
 
+// checkHubVersion compares the hub's major version to this build's. A
+// mismatch is logged, and with StrictVersion set it fails the cycle, since
+// the hub may speak fragment formats we'd misapply. Versions that can't be
+// compared — a "dev" build on either side, or a hub too old to have the
+// version endpoint — are let through.
+func (sc *SyncClient) checkHubVersion(ctx context.Context) error {
+	hubVersion, err := sc.fetchHubVersion(ctx)
+	if err != nil {
+		logger.LogErr(err, "could not fetch hub version; skipping version check")
+		return nil
+	}
+
+	ourMajor, hubMajor := MajorVersion(Version), MajorVersion(hubVersion)
+	if ourMajor == "" || hubMajor == "" || ourMajor == hubMajor {
+		return nil
+	}
+
+	if sc.config.StrictVersion {
+		return serr.New(fmt.Sprintf("hub major version %s does not match ours (%s); refusing to sync",
+			hubVersion, Version), "hub_version", hubVersion, "local_version", Version)
+	}
+	logger.Warn("Hub major version differs from ours; sync may misbehave",
+		"hub_version", hubVersion, "local_version", Version)
+	return nil
+}
+
+// fetchHubVersion returns the version reported by the hub's version endpoint,
+// or "" if the hub doesn't have one.
+func (sc *SyncClient) fetchHubVersion(ctx context.Context) (string, error) {
+	url := sc.config.HubURL + "/api/v1/version"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", serr.Wrap(err, "failed to create version request")
+	}
+
+	resp, err := sc.httpClient.Do(req)
+	if err != nil {
+		return "", serr.Wrap(err, "version request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", serr.New(fmt.Sprintf("version request returned status %d", resp.StatusCode))
+	}
+
+	var apiResp struct {
+		Data BuildInfo `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return "", serr.Wrap(err, "failed to decode version response")
+	}
+	return apiResp.Data.Version, nil
+}
+
 // authenticate obtains a JWT from the hub. Reuses the cached token if it's
 // still valid (determined by trying authenticated requests first and falling
 // back to login on 401).
@@ -314,12 +524,23 @@ func (sc *SyncClient) healthCheck(ctx context.Context) error {
 // spoke onboarding: set env vars and start — the first sync cycle handles
 // registration automatically.
 func (sc *SyncClient) authenticate(ctx context.Context) error {
-	// If we have a cached token, try it first — tokens last 7 days,
-	// so most of the time this saves a round trip
+	// If we have a cached token, try it first — most of the time this saves
+	// a round trip
 	if sc.authToken != "" {
 		return nil // Will re-auth on 401 during pull/push
 	}
 
+	// A refresh token renews the session without sending credentials
+	if sc.refreshToken != "" {
+		if err := sc.refreshAccessToken(ctx); err == nil {
+			return nil
+		}
+	}
+
+	if sc.config.Password == "" {
+		return serr.New("no valid session and no password available — restart with sync credentials")
+	}
+
 	err := sc.login(ctx)
 	if err == nil {
 		return nil
@@ -342,9 +563,10 @@ func (sc *SyncClient) authenticate(ctx context.Context) error {
 func (sc *SyncClient) login(ctx context.Context) error {
 	url := sc.config.HubURL + "/api/v1/auth/login"
 
-	body, err := json.Marshal(map[string]string{
+	body, err := json.Marshal(map[string]any{
 		"username": sc.config.Username,
 		"password": sc.config.Password,
+		"refresh":  true, // Ask for a refresh token so we don't need the password again
 	})
 	if err != nil {
 		return serr.Wrap(err, "failed to marshal login request")
@@ -370,7 +592,8 @@ func (sc *SyncClient) login(ctx context.Context) error {
 	var apiResp struct {
 		Success bool `json:"success"`
 		Data    struct {
-			Token string `json:"token"`
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
 		} `json:"data"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
@@ -380,14 +603,89 @@ func (sc *SyncClient) login(ctx context.Context) error {
 		return serr.New("login response missing token")
 	}
 
-	sc.authToken = apiResp.Data.Token
+	sc.storeTokens(apiResp.Data.Token, apiResp.Data.RefreshToken)
+	return nil
+}
+
+// refreshAccessToken exchanges the refresh token for a new access token
+// (and a rotated refresh token) without sending credentials.
+func (sc *SyncClient) refreshAccessToken(ctx context.Context) error {
+	url := sc.config.HubURL + "/api/v1/auth/refresh"
+
+	body, err := json.Marshal(map[string]string{"refresh_token": sc.refreshToken})
+	if err != nil {
+		return serr.Wrap(err, "failed to marshal refresh request")
+	}
 
-	// Persist token for reuse across restarts
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return serr.Wrap(err, "failed to create refresh request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sc.httpClient.Do(req)
+	if err != nil {
+		return serr.Wrap(err, "refresh request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized {
+			// The refresh token is dead (expired or revoked) — forget it
+			sc.refreshToken = ""
+		}
+		return serr.New(fmt.Sprintf("token refresh failed with status %d", resp.StatusCode))
+	}
+
+	var apiResp struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return serr.Wrap(err, "failed to decode refresh response")
+	}
+	if !apiResp.Success || apiResp.Data.Token == "" {
+		return serr.New("refresh response missing token")
+	}
+
+	sc.storeTokens(apiResp.Data.Token, apiResp.Data.RefreshToken)
+	return nil
+}
+
+// storeTokens caches a new access token (and refresh token, if issued) in
+// memory and persists them for reuse across restarts. Once a refresh token
+// is held, the password is no longer needed and is dropped from memory.
+func (sc *SyncClient) storeTokens(accessToken, refreshToken string) {
+	sc.authToken = accessToken
 	if err := UpdateSyncAuthToken(sc.config.HubURL, sc.authToken); err != nil {
 		logger.LogErr(err, "failed to persist auth token")
 	}
 
-	return nil
+	if refreshToken != "" {
+		sc.refreshToken = refreshToken
+		sc.config.Password = ""
+		if err := UpdateSyncRefreshToken(sc.config.HubURL, sc.refreshToken); err != nil {
+			logger.LogErr(err, "failed to persist refresh token")
+		}
+	}
+}
+
+// reauthenticate obtains a fresh access token after a 401, preferring the
+// refresh token and falling back to a password login only if one is still held.
+func (sc *SyncClient) reauthenticate(ctx context.Context) error {
+	if sc.refreshToken != "" {
+		err := sc.refreshAccessToken(ctx)
+		if err == nil {
+			return nil
+		}
+		if sc.config.Password == "" {
+			return serr.Wrap(err, "refresh token rejected and no password available")
+		}
+	}
+	return sc.login(ctx)
 }
 
 // registerWithInviteToken sends a registration request to the hub using the
@@ -429,7 +727,16 @@ func (sc *SyncClient) registerWithInviteToken(ctx context.Context) error {
 // On 401, it re-authenticates once and retries. This handles token expiry
 // transparently so callers don't need retry logic.
 func (sc *SyncClient) doAuthenticatedRequest(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	// Buffer the body so the retry after a 401 can resend it
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		if bodyBytes, err = io.ReadAll(body); err != nil {
+			return nil, serr.Wrap(err, "failed to read request body")
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(bodyBytes))
 	if err != nil {
 		return nil, serr.Wrap(err, "failed to create request")
 	}
@@ -445,12 +752,12 @@ func (sc *SyncClient) doAuthenticatedRequest(ctx context.Context, method, url st
 	if resp.StatusCode == http.StatusUnauthorized {
 		resp.Body.Close()
 
-		if err := sc.login(ctx); err != nil {
+		if err := sc.reauthenticate(ctx); err != nil {
 			return nil, serr.Wrap(err, "re-authentication failed after 401")
 		}
 
-		// Rebuild request with new token (body may have been consumed)
-		req, err = http.NewRequestWithContext(ctx, method, url, body)
+		// Rebuild request with new token (the original body was consumed)
+		req, err = http.NewRequestWithContext(ctx, method, url, bytes.NewReader(bodyBytes))
 		if err != nil {
 			return nil, serr.Wrap(err, "failed to create retry request")
 		}
@@ -466,14 +773,25 @@ func (sc *SyncClient) doAuthenticatedRequest(ctx context.Context, method, url st
 	return resp, nil
 }
 
+// pullCategoryParam returns the pull query parameter for the configured
+// category scope, or "" when the spoke pulls everything.
+func (sc *SyncClient) pullCategoryParam() string {
+	if sc.config.CategoryGUID == "" {
+		return ""
+	}
+	return "&category=" + url.QueryEscape(sc.config.CategoryGUID)
+}
+
 // pullChanges fetches unsynced changes from the hub and applies them locally.
-// Pulls in batches (has_more pagination) until all changes are consumed.
+// Pulls in batches of config.BatchSize (has_more pagination) until all
+// changes are consumed.
 // Each change is checked for conflicts before application.
 func (sc *SyncClient) pullChanges(ctx context.Context) error {
 	hasMore := true
 
 	for hasMore {
-		url := fmt.Sprintf("%s/api/v1/sync/pull?peer_id=%s&limit=100", sc.config.HubURL, sc.peerID)
+		url := fmt.Sprintf("%s/api/v1/sync/pull?peer_id=%s&limit=%d", sc.config.HubURL, sc.peerID, sc.config.BatchSize) +
+			sc.pullCategoryParam()
 		resp, err := sc.doAuthenticatedRequest(ctx, http.MethodGet, url, nil)
 		if err != nil {
 			return serr.Wrap(err, "pull request failed")
@@ -493,9 +811,20 @@ func (sc *SyncClient) pullChanges(ctx context.Context) error {
 			return serr.New("pull request returned success=false")
 		}
 
+		changes := apiResp.Data.Changes
+		if sc.config.ReorderPull {
+			changes = orderPulledChanges(changes)
+		}
+
 		// Apply each change with conflict detection
-		for _, change := range apiResp.Data.Changes {
-			if err := sc.applyChangeWithConflictDetection(change); err != nil {
+		for _, change := range changes {
+			err := sc.applyChangeWithConflictDetection(change)
+			if errors.Is(err, ErrNoteNeedsSnapshot) {
+				// An update for a note we don't have yet, that can't be
+				// applied on its own; take the hub's current copy instead
+				err = sc.applyNoteSnapshot(ctx, change.EntityGUID)
+			}
+			if err != nil {
 				// Log and continue — one bad change shouldn't block the whole pull
 				logger.LogErr(err, "failed to apply pulled change",
 					"change_guid", change.GUID,
@@ -505,6 +834,7 @@ func (sc *SyncClient) pullChanges(ctx context.Context) error {
 			}
 		}
 
+		sc.cycle.pulled += len(changes)
 		hasMore = apiResp.Data.HasMore
 
 		if len(apiResp.Data.Changes) > 0 {
@@ -518,10 +848,69 @@ func (sc *SyncClient) pullChanges(ctx context.Context) error {
 	return nil
 }
 
+// applyNoteSnapshot fetches the hub's full snapshot of a note and applies it
+// (as a create), for a pulled update whose note isn't here yet.
+func (sc *SyncClient) applyNoteSnapshot(ctx context.Context, noteGUID string) error {
+	snapshotURL := fmt.Sprintf("%s/api/v1/sync/snapshot?entity_type=note&entity_guid=%s",
+		sc.config.HubURL, url.QueryEscape(noteGUID))
+	resp, err := sc.doAuthenticatedRequest(ctx, http.MethodGet, snapshotURL, nil)
+	if err != nil {
+		return serr.Wrap(err, "snapshot request failed", "note_guid", noteGUID)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return serr.New("snapshot request returned an error", "note_guid", noteGUID,
+			"status", strconv.Itoa(resp.StatusCode))
+	}
+
+	var apiResp struct {
+		Success bool       `json:"success"`
+		Data    SyncChange `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return serr.Wrap(err, "failed to decode snapshot response", "note_guid", noteGUID)
+	}
+
+	if err := applySyncChangeFromPeer(apiResp.Data, sc.peerID); err != nil {
+		return serr.Wrap(err, "failed to apply note snapshot", "note_guid", noteGUID)
+	}
+	logger.Info("Applied note snapshot for out-of-order update", "note_guid", noteGUID)
+	return nil
+}
+
+// orderPulledChanges returns the batch with all category creates moved ahead
+// of everything else, preserving relative order within each group. The hub
+// already sorts categories first at equal timestamps, but a category created
+// after a note was mapped to it (or a hub running older code) can still put a
+// note's category mapping ahead of the category it references — and a mapping
+// to an unknown category is dropped on apply.
+func orderPulledChanges(changes []SyncChange) []SyncChange {
+	ordered := make([]SyncChange, 0, len(changes))
+	for _, ch := range changes {
+		if ch.EntityType == "category" && ch.Operation == OperationCreate {
+			ordered = append(ordered, ch)
+		}
+	}
+	for _, ch := range changes {
+		if ch.EntityType != "category" || ch.Operation != OperationCreate {
+			ordered = append(ordered, ch)
+		}
+	}
+	return ordered
+}
+
 // applyChangeWithConflictDetection wraps ApplyIncomingSyncChange with
 // Phase 3 conflict detection. If a conflict exists, it resolves it
-// automatically and logs the result.
+// automatically and logs the result. Mapping-only changes are merged
+// instead unless the mapping conflict strategy is "lww".
 func (sc *SyncClient) applyChangeWithConflictDetection(change SyncChange) error {
+	if sc.config.MappingConflict != MappingConflictLWW {
+		if handled, err := sc.applyMappingChangeWithMerge(change); handled || err != nil {
+			return err
+		}
+	}
+
 	var hasConflict bool
 	var localAsSyncChange SyncChange
 
@@ -576,6 +965,7 @@ func (sc *SyncClient) applyChangeWithConflictDetection(change SyncChange) error
 		}
 
 		// Log the conflict for audit trail
+		sc.cycle.conflicts++
 		InsertSyncConflict(change.EntityType, change.EntityGUID, localAsSyncChange, change, resolution)
 
 		logger.Info("Sync conflict resolved",
@@ -591,16 +981,19 @@ func (sc *SyncClient) applyChangeWithConflictDetection(change SyncChange) error
 		// Otherwise fall through to apply the remote change
 	}
 
-	// Apply the change (idempotent — duplicate GUIDs are no-ops)
-	return ApplyIncomingSyncChange(change)
+	// Apply the change (idempotent — duplicate GUIDs are no-ops). Our own peer ID
+	// is what the hub is tracked under locally, so tagging with it keeps the
+	// change from being pushed straight back to the hub.
+	return applySyncChangeFromPeer(change, sc.peerID)
 }
 
-// pushChanges builds a batch of local unsent changes and sends them to the hub.
+// pushChanges builds a batch of up to config.BatchSize local unsent changes
+// and sends them to the hub.
 func (sc *SyncClient) pushChanges(ctx context.Context) error {
 	// Use the same unified change stream that the hub uses for pulls,
 	// but from our local perspective: changes not yet sent to the hub.
 	// Empty userGUID: spoke is single-user, no per-user filtering needed locally
-	response, err := GetUnifiedChangesForPeer(sc.peerID, "", 100)
+	response, err := GetUnifiedChangesForPeer(sc.peerID, "", sc.config.BatchSize)
 	if err != nil {
 		return serr.Wrap(err, "failed to get local changes for push")
 	}
@@ -626,6 +1019,12 @@ func (sc *SyncClient) pushChanges(ctx context.Context) error {
 	}
 	defer resp.Body.Close()
 
+	// 207 means some changes were rejected; the body says which, so it is
+	// handled the same as 200 below
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusMultiStatus {
+		return serr.New(fmt.Sprintf("push returned status %d", resp.StatusCode))
+	}
+
 	var apiResp struct {
 		Success bool             `json:"success"`
 		Data    SyncPushResponse `json:"data"`
@@ -638,13 +1037,18 @@ func (sc *SyncClient) pushChanges(ctx context.Context) error {
 		return serr.New("push request returned success=false")
 	}
 
-	// Mark accepted changes as synced so they won't be pushed again
-	MarkSyncChangesForPeer(response.Changes, sc.peerID)
+	// Only mark changes the hub accepted (or that were dead-lettered) as synced.
+	// Other rejected changes stay unmarked so the next cycle retries them.
+	toMark, retrying, deadLettered := sc.partitionPushResults(response.Changes, apiResp.Data)
+	MarkSyncChangesForPeer(toMark, sc.peerID)
+	sc.cycle.pushed += len(apiResp.Data.Accepted)
 
 	if len(apiResp.Data.Rejected) > 0 {
 		logger.Info("Some changes rejected by hub",
 			"accepted", len(apiResp.Data.Accepted),
 			"rejected", len(apiResp.Data.Rejected),
+			"retrying", retrying,
+			"dead_lettered", deadLettered,
 		)
 	} else {
 		logger.Info("Pushed changes to hub", "count", len(apiResp.Data.Accepted))
@@ -653,6 +1057,89 @@ func (sc *SyncClient) pushChanges(ctx context.Context) error {
 	return nil
 }
 
+// permanentRejectionReasons are substrings of hub rejection reasons that no
+// amount of retrying will fix — the change itself is malformed. Anything else
+// (e.g. "note not found for sync update" while a create is still in flight)
+// is assumed to be transient.
+var permanentRejectionReasons = []string{
+	"unknown entity type",
+	"unknown note operation",
+	"unknown category operation",
+	"failed to deserialize",
+	"cannot apply body diff for note creation",
+}
+
+// isPermanentRejection reports whether a hub rejection reason indicates the
+// change can never be accepted.
+func isPermanentRejection(reason string) bool {
+	for _, r := range permanentRejectionReasons {
+		if strings.Contains(reason, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// partitionPushResults decides which pushed changes should be marked as synced
+// to the hub. Accepted changes are marked. Rejected changes are left unmarked
+// for retry until the rejection is permanent or the change has been rejected
+// MaxPushRejections times; then it is recorded in sync_dead_letters and marked
+// so it stops blocking the push queue. Changes the hub didn't mention at all
+// are left unmarked to be safe.
+func (sc *SyncClient) partitionPushResults(pushed []SyncChange, result SyncPushResponse) (toMark []SyncChange, retrying, deadLettered int) {
+	accepted := make(map[string]bool, len(result.Accepted))
+	for _, guid := range result.Accepted {
+		accepted[guid] = true
+	}
+	rejected := make(map[string]string, len(result.Rejected))
+	for _, rej := range result.Rejected {
+		rejected[rej.GUID] = rej.Reason
+	}
+	if sc.pushRejections == nil {
+		sc.pushRejections = make(map[string]int)
+	}
+
+	for _, ch := range pushed {
+		if accepted[ch.GUID] {
+			delete(sc.pushRejections, ch.GUID)
+			toMark = append(toMark, ch)
+			continue
+		}
+
+		reason, wasRejected := rejected[ch.GUID]
+		if !wasRejected {
+			retrying++
+			continue
+		}
+
+		sc.pushRejections[ch.GUID]++
+		attempts := sc.pushRejections[ch.GUID]
+		if !isPermanentRejection(reason) && attempts < MaxPushRejections {
+			retrying++
+			continue
+		}
+
+		if err := InsertSyncDeadLetter(ch, sc.peerID, reason, attempts); err != nil {
+			// Keep it pending rather than lose it without a record
+			logger.LogErr(err, "failed to dead-letter rejected change")
+			retrying++
+			continue
+		}
+		logger.LogErr(serr.New("change dead-lettered after hub rejection"),
+			"change_guid", ch.GUID,
+			"entity_type", ch.EntityType,
+			"entity_guid", ch.EntityGUID,
+			"attempts", attempts,
+			"reason", reason,
+		)
+		delete(sc.pushRejections, ch.GUID)
+		toMark = append(toMark, ch)
+		deadLettered++
+	}
+
+	return toMark, retrying, deadLettered
+}
+
 // verifyConsistency compares local and remote checksums to detect data divergence.
 // This is advisory — a mismatch is logged as a warning but doesn't fail the cycle.
 // Over time, continued syncing will converge the data sets.
@@ -694,12 +1181,42 @@ func (sc *SyncClient) verifyConsistency(ctx context.Context) error {
 
 // recordFailure updates backoff state after a failed sync cycle.
 func (sc *SyncClient) recordFailure(err error) {
+	sc.stateMu.Lock()
+	defer sc.stateMu.Unlock()
 	sc.consecutiveFailures++
 	sc.lastError = err
 }
 
+// recordSuccess resets backoff and stamps the time of the successful sync.
+func (sc *SyncClient) recordSuccess() {
+	sc.stateMu.Lock()
+	defer sc.stateMu.Unlock()
+	sc.consecutiveFailures = 0
+	sc.lastError = nil
+	sc.lastSync = time.Now()
+}
+
+// failureCount returns the number of consecutive failed cycles.
+func (sc *SyncClient) failureCount() int {
+	sc.stateMu.Lock()
+	defer sc.stateMu.Unlock()
+	return sc.consecutiveFailures
+}
+
+// inBackoff reports whether the client should skip this tick because the
+// backoff period since the last sync hasn't elapsed yet.
+func (sc *SyncClient) inBackoff() bool {
+	sc.stateMu.Lock()
+	defer sc.stateMu.Unlock()
+	if sc.consecutiveFailures == 0 {
+		return false
+	}
+	return time.Since(sc.lastSync) < sc.calculateBackoff()
+}
+
 // calculateBackoff returns the wait duration based on consecutive failures.
 // Uses exponential backoff: 1s, 2s, 4s, 8s, ... capped at maxBackoff.
+// Caller must hold stateMu.
 func (sc *SyncClient) calculateBackoff() time.Duration {
 	backoff := time.Second
 	for i := 0; i < sc.consecutiveFailures; i++ {
@@ -721,14 +1238,15 @@ func (sc *SyncClient) calculateBackoff() time.Duration {
 
 // SyncState represents a row in the sync_state table.
 type SyncState struct {
-	HubURL     string
-	PeerID     string
-	LastPushAt sql.NullTime
-	LastPullAt sql.NullTime
-	LastSyncAt sql.NullTime
-	AuthToken  sql.NullString
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	HubURL       string
+	PeerID       string
+	LastPushAt   sql.NullTime
+	LastPullAt   sql.NullTime
+	LastSyncAt   sql.NullTime
+	AuthToken    sql.NullString
+	RefreshToken sql.NullString
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
 }
 
 // GetOrCreateSyncState loads the sync state for a hub URL, creating a new
@@ -737,10 +1255,10 @@ type SyncState struct {
 func GetOrCreateSyncState(hubURL string) (*SyncState, error) {
 	state := &SyncState{}
 	err := db.QueryRow(
-		`SELECT hub_url, peer_id, last_push_at, last_pull_at, last_sync_at, auth_token, created_at, updated_at
+		`SELECT hub_url, peer_id, last_push_at, last_pull_at, last_sync_at, auth_token, refresh_token, created_at, updated_at
 		 FROM sync_state WHERE hub_url = ?`, hubURL,
 	).Scan(&state.HubURL, &state.PeerID, &state.LastPushAt, &state.LastPullAt,
-		&state.LastSyncAt, &state.AuthToken, &state.CreatedAt, &state.UpdatedAt)
+		&state.LastSyncAt, &state.AuthToken, &state.RefreshToken, &state.CreatedAt, &state.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		// First time syncing with this hub — generate a new peer ID
@@ -793,3 +1311,16 @@ func UpdateSyncAuthToken(hubURL, token string) error {
 	}
 	return nil
 }
+
+// UpdateSyncRefreshToken persists the refresh token so the client can renew
+// its session after a restart without the password.
+func UpdateSyncRefreshToken(hubURL, token string) error {
+	_, err := db.Exec(
+		`UPDATE sync_state SET refresh_token = ?, updated_at = ? WHERE hub_url = ?`,
+		token, time.Now(), hubURL,
+	)
+	if err != nil {
+		return serr.Wrap(err, "failed to update sync refresh token")
+	}
+	return nil
+}
@@ -0,0 +1,1223 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// scTestUserGUID is a constant user GUID for sync client tests.
+const scTestUserGUID = "sc-test-user-guid-001"
+
+// setupSyncClientTestDB initializes a clean test database for sync client tests.
+func setupSyncClientTestDB(t *testing.T) func() {
+	t.Helper()
+
+	os.Remove("./test_sync_client.ddb")
+	os.Remove("./test_sync_client.ddb.wal")
+
+	if err := InitTestDB("./test_sync_client.ddb"); err != nil {
+		t.Fatalf("failed to initialize test database: %v", err)
+	}
+
+	return func() {
+		CloseDB()
+		os.Remove("./test_sync_client.ddb")
+		os.Remove("./test_sync_client.ddb.wal")
+	}
+}
+
+// newTestSyncClient builds a SyncClient pointed at a fake hub. It bypasses
+// NewSyncClient so no sync_state row or login is required.
+func newTestSyncClient(hubURL string) *SyncClient {
+	return &SyncClient{
+		config:     &SyncConfig{Enabled: true, HubURL: hubURL, Username: "u", Password: "p", ReorderPull: true, BatchSize: defaultSyncBatchSize},
+		peerID:     "sc-test-peer",
+		authToken:  "test-token",
+		httpClient: http.DefaultClient,
+	}
+}
+
+// newFakePushHub starts a hub that answers POST /api/v1/sync/push by
+// rejecting the given change GUIDs with the given reason and accepting the rest.
+// Like the real hub, it answers 207 Multi-Status when anything was rejected.
+func newFakePushHub(t *testing.T, rejectReasons map[string]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/sync/push" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var req SyncPushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := SyncPushResponse{Accepted: []string{}, Rejected: []SyncPushRejection{}}
+		for _, ch := range req.Changes {
+			if reason, ok := rejectReasons[ch.EntityGUID]; ok {
+				resp.Rejected = append(resp.Rejected, SyncPushRejection{GUID: ch.GUID, Reason: reason})
+				continue
+			}
+			resp.Accepted = append(resp.Accepted, ch.GUID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(resp.Rejected) > 0 {
+			w.WriteHeader(http.StatusMultiStatus)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": resp})
+	}))
+}
+
+// TestPushChangesKeepsRejectedPending verifies that a change rejected by the
+// hub for a transient reason is left unmarked so the next cycle retries it,
+// while accepted changes are marked as synced.
+func TestPushChangesKeepsRejectedPending(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	if _, err := CreateNote(NoteInput{GUID: "sc-note-accepted", Title: "Accepted"}, scTestUserGUID); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if _, err := CreateNote(NoteInput{GUID: "sc-note-rejected", Title: "Rejected"}, scTestUserGUID); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	hub := newFakePushHub(t, map[string]string{
+		"sc-note-rejected": "failed to apply sync note create: database is locked",
+	})
+	defer hub.Close()
+
+	client := newTestSyncClient(hub.URL)
+	if err := client.pushChanges(t.Context()); err != nil {
+		t.Fatalf("pushChanges failed: %v", err)
+	}
+
+	pending, err := GetUnifiedChangesForPeer(client.peerID, "", 100)
+	if err != nil {
+		t.Fatalf("failed to get pending changes: %v", err)
+	}
+	if len(pending.Changes) != 1 {
+		t.Fatalf("expected 1 pending change after partial push, got %d", len(pending.Changes))
+	}
+	if pending.Changes[0].EntityGUID != "sc-note-rejected" {
+		t.Errorf("expected rejected note to remain pending, got %s", pending.Changes[0].EntityGUID)
+	}
+
+	// A second cycle re-pushes the rejected change; once the hub accepts it,
+	// nothing should remain pending
+	hub.Close()
+	hub = newFakePushHub(t, nil)
+	client.config.HubURL = hub.URL
+
+	if err := client.pushChanges(t.Context()); err != nil {
+		t.Fatalf("retry pushChanges failed: %v", err)
+	}
+
+	pending, err = GetUnifiedChangesForPeer(client.peerID, "", 100)
+	if err != nil {
+		t.Fatalf("failed to get pending changes: %v", err)
+	}
+	if len(pending.Changes) != 0 {
+		t.Errorf("expected no pending changes after retry, got %d", len(pending.Changes))
+	}
+}
+
+// TestPushChangesDeadLettersPermanentRejection verifies that a change the
+// hub can never accept is marked as synced rather than retried forever.
+func TestPushChangesDeadLettersPermanentRejection(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	if _, err := CreateNote(NoteInput{GUID: "sc-note-bad", Title: "Bad"}, scTestUserGUID); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	hub := newFakePushHub(t, map[string]string{
+		"sc-note-bad": "unknown note operation: 42",
+	})
+	defer hub.Close()
+
+	client := newTestSyncClient(hub.URL)
+	if err := client.pushChanges(t.Context()); err != nil {
+		t.Fatalf("pushChanges failed: %v", err)
+	}
+
+	pending, err := GetUnifiedChangesForPeer(client.peerID, "", 100)
+	if err != nil {
+		t.Fatalf("failed to get pending changes: %v", err)
+	}
+	if len(pending.Changes) != 0 {
+		t.Errorf("expected permanently rejected change to be dead-lettered, got %d pending", len(pending.Changes))
+	}
+
+	letters, err := GetDeadLetters()
+	if err != nil {
+		t.Fatalf("GetDeadLetters failed: %v", err)
+	}
+	if len(letters) != 1 || letters[0].EntityGUID != "sc-note-bad" {
+		t.Fatalf("expected 1 dead letter for sc-note-bad, got %+v", letters)
+	}
+	if letters[0].Attempts != 1 {
+		t.Errorf("expected permanent rejection to dead-letter on first attempt, got %d", letters[0].Attempts)
+	}
+}
+
+// TestPushChangesDeadLettersAfterRetryCap verifies that a transiently
+// rejected change is retried each cycle until MaxPushRejections, then
+// dead-lettered.
+func TestPushChangesDeadLettersAfterRetryCap(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	if _, err := CreateNote(NoteInput{GUID: "sc-note-stuck", Title: "Stuck"}, scTestUserGUID); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	hub := newFakePushHub(t, map[string]string{
+		"sc-note-stuck": "failed to apply sync note create: database is locked",
+	})
+	defer hub.Close()
+
+	client := newTestSyncClient(hub.URL)
+	for attempt := 1; attempt <= MaxPushRejections; attempt++ {
+		if err := client.pushChanges(t.Context()); err != nil {
+			t.Fatalf("pushChanges attempt %d failed: %v", attempt, err)
+		}
+
+		pending, err := GetUnifiedChangesForPeer(client.peerID, "", 100)
+		if err != nil {
+			t.Fatalf("failed to get pending changes: %v", err)
+		}
+		letters, err := GetDeadLetters()
+		if err != nil {
+			t.Fatalf("GetDeadLetters failed: %v", err)
+		}
+
+		if attempt < MaxPushRejections {
+			if len(pending.Changes) != 1 {
+				t.Fatalf("attempt %d: expected rejected change to stay pending, got %d", attempt, len(pending.Changes))
+			}
+			if len(letters) != 0 {
+				t.Fatalf("attempt %d: expected no dead letters before the cap, got %d", attempt, len(letters))
+			}
+			continue
+		}
+
+		if len(pending.Changes) != 0 {
+			t.Errorf("expected change to leave the push queue at the cap, got %d pending", len(pending.Changes))
+		}
+		if len(letters) != 1 {
+			t.Fatalf("expected 1 dead letter at the cap, got %d", len(letters))
+		}
+		if letters[0].Attempts != MaxPushRejections {
+			t.Errorf("expected %d attempts recorded, got %d", MaxPushRejections, letters[0].Attempts)
+		}
+		if letters[0].Reason == "" || letters[0].Change == "" {
+			t.Errorf("expected reason and change to be recorded, got %+v", letters[0])
+		}
+	}
+}
+
+// TestSyncBatchSize verifies that the client pulls and pushes in batches of
+// config.BatchSize, and that Validate rejects a non-positive batch size.
+func TestSyncBatchSize(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	for _, guid := range []string{"sc-batch-1", "sc-batch-2", "sc-batch-3"} {
+		if _, err := CreateNote(NoteInput{GUID: guid, Title: guid}, scTestUserGUID); err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	var pullLimit string
+	var pushed int
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := map[string]any{"success": true}
+		switch r.URL.Path {
+		case "/api/v1/sync/pull":
+			pullLimit = r.URL.Query().Get("limit")
+			resp["data"] = SyncPullResponse{Changes: []SyncChange{}}
+		case "/api/v1/sync/push":
+			var req SyncPushRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			pushed = len(req.Changes)
+			accepted := []string{}
+			for _, ch := range req.Changes {
+				accepted = append(accepted, ch.GUID)
+			}
+			resp["data"] = SyncPushResponse{Accepted: accepted, Rejected: []SyncPushRejection{}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer hub.Close()
+
+	client := newTestSyncClient(hub.URL)
+	client.config.BatchSize = 2
+
+	if err := client.pullChanges(t.Context()); err != nil {
+		t.Fatalf("pullChanges failed: %v", err)
+	}
+	if pullLimit != "2" {
+		t.Errorf("expected pull limit 2, got %q", pullLimit)
+	}
+
+	if err := client.pushChanges(t.Context()); err != nil {
+		t.Fatalf("pushChanges failed: %v", err)
+	}
+	if pushed != 2 {
+		t.Errorf("expected a push of 2 changes, got %d", pushed)
+	}
+
+	cfg := *client.config
+	cfg.Interval = time.Minute
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected batch size 2 to be valid, got %v", err)
+	}
+	cfg.BatchSize = 0
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected Validate to reject a batch size of 0")
+	}
+}
+
+// newFakePullHub starts a hub that answers GET /api/v1/sync/pull with the
+// given batch exactly once, then with an empty batch.
+func newFakePullHub(t *testing.T, batch []SyncChange) *httptest.Server {
+	t.Helper()
+	served := false
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/sync/pull" {
+			http.NotFound(w, r)
+			return
+		}
+
+		resp := SyncPullResponse{Changes: []SyncChange{}}
+		if !served {
+			resp.Changes = batch
+			served = true
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": resp})
+	}))
+}
+
+// TestPullChangesAppliesCategoriesBeforeMappings delivers a batch where a note
+// (carrying a category mapping) arrives before the category it references,
+// and verifies the mapping survives because categories are applied first.
+func TestPullChangesAppliesCategoriesBeforeMappings(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	const catGUID = "sc-pull-cat-guid"
+	const noteGUID = "sc-pull-note-guid"
+
+	title := "Mapped Note"
+	body := "note body"
+	categoriesJSON := `[{"category_guid":"` + catGUID + `","selected_subcategories":[]}]`
+	catName := "Pulled Category"
+	now := time.Now()
+
+	batch := []SyncChange{
+		{
+			GUID:       "sc-pull-change-note",
+			EntityType: "note",
+			EntityGUID: noteGUID,
+			Operation:  OperationCreate,
+			Fragment: &NoteFragmentOutput{
+				Bitmask:    FragmentTitle | FragmentBody | FragmentCategories,
+				Title:      &title,
+				Body:       &body,
+				Categories: &categoriesJSON,
+			},
+			AuthoredAt: now,
+			User:       scTestUserGUID,
+			CreatedAt:  now,
+		},
+		{
+			GUID:       "sc-pull-change-cat",
+			EntityType: "category",
+			EntityGUID: catGUID,
+			Operation:  OperationCreate,
+			Fragment: &CategoryFragmentOutput{
+				Bitmask: CatFragmentName,
+				Name:    &catName,
+			},
+			AuthoredAt: now,
+			User:       scTestUserGUID,
+			CreatedAt:  now.Add(time.Second),
+		},
+	}
+
+	hub := newFakePullHub(t, batch)
+	defer hub.Close()
+
+	client := newTestSyncClient(hub.URL)
+	if err := client.pullChanges(t.Context()); err != nil {
+		t.Fatalf("pullChanges failed: %v", err)
+	}
+
+	note, err := GetNoteByGUID(noteGUID)
+	if err != nil || note == nil {
+		t.Fatalf("expected pulled note to exist, err=%v", err)
+	}
+
+	categories, err := GetNoteCategories(note.ID, scTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to get note categories: %v", err)
+	}
+	if len(categories) != 1 || categories[0].GUID != catGUID {
+		t.Fatalf("expected note to be mapped to %s, got %+v", catGUID, categories)
+	}
+}
+
+// TestPullChangesFetchesSnapshotForEarlyDiff pulls a diff update for a note
+// the spoke doesn't have and verifies the spoke fetches and applies the hub's
+// snapshot of the note instead.
+func TestPullChangesFetchesSnapshotForEarlyDiff(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	const noteGUID = "sc-early-diff-note-guid"
+	diff := "@@ -1,4 +1,4 @@\n-base\n+edit\n"
+	title := "Snapshot Title"
+	body := "snapshot body"
+	now := time.Now()
+
+	update := SyncChange{
+		GUID:       "sc-early-diff-change",
+		EntityType: "note",
+		EntityGUID: noteGUID,
+		Operation:  OperationUpdate,
+		Fragment:   &NoteFragmentOutput{Bitmask: FragmentBody, Body: &diff, BodyIsDiff: true},
+		AuthoredAt: now,
+		User:       scTestUserGUID,
+		CreatedAt:  now,
+	}
+	snapshot := SyncChange{
+		GUID:       "sc-early-diff-snapshot",
+		EntityType: "note",
+		EntityGUID: noteGUID,
+		Operation:  OperationCreate,
+		Fragment: &NoteFragmentOutput{
+			Bitmask: FragmentTitle | FragmentBody,
+			Title:   &title,
+			Body:    &body,
+		},
+		AuthoredAt: now,
+		User:       scTestUserGUID,
+		CreatedAt:  now,
+	}
+
+	served := false
+	snapshotRequests := 0
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data any
+		switch r.URL.Path {
+		case "/api/v1/sync/pull":
+			resp := SyncPullResponse{Changes: []SyncChange{}}
+			if !served {
+				resp.Changes = []SyncChange{update}
+				served = true
+			}
+			data = resp
+		case "/api/v1/sync/snapshot":
+			snapshotRequests++
+			if r.URL.Query().Get("entity_guid") != noteGUID {
+				http.NotFound(w, r)
+				return
+			}
+			data = snapshot
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": data})
+	}))
+	defer hub.Close()
+
+	client := newTestSyncClient(hub.URL)
+	if err := client.pullChanges(t.Context()); err != nil {
+		t.Fatalf("pullChanges failed: %v", err)
+	}
+
+	if snapshotRequests != 1 {
+		t.Errorf("expected 1 snapshot request, got %d", snapshotRequests)
+	}
+	note, err := GetNoteByGUID(noteGUID)
+	if err != nil || note == nil {
+		t.Fatalf("expected note from snapshot to exist, err=%v", err)
+	}
+	if note.Title != title || note.Body.String != body {
+		t.Errorf("expected snapshot content %q/%q, got %q/%q", title, body, note.Title, note.Body.String)
+	}
+}
+
+// TestSyncCycleRecordsMetrics runs several sync cycles against a fake hub and
+// verifies each one leaves a sync_metrics row with its pulled, pushed, and
+// conflict counts and its outcome.
+func TestSyncCycleRecordsMetrics(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	local, err := CreateNote(NoteInput{GUID: "sc-metrics-local", Title: "Local"}, scTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	if _, err := CreateNote(NoteInput{GUID: "sc-metrics-local-2", Title: "Local 2"}, scTestUserGUID); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	// The first pull creates one note and edits the unpushed local note,
+	// which conflicts with its pending create
+	remoteTitle := "Remote"
+	now := time.Now()
+	batch := []SyncChange{
+		{
+			GUID: "sc-metrics-change-create", EntityType: "note", EntityGUID: "sc-metrics-remote",
+			Operation:  OperationCreate,
+			Fragment:   &NoteFragmentOutput{Bitmask: FragmentTitle, Title: &remoteTitle},
+			AuthoredAt: now, User: scTestUserGUID, CreatedAt: now,
+		},
+		{
+			GUID: "sc-metrics-change-update", EntityType: "note", EntityGUID: local.GUID,
+			Operation:  OperationUpdate,
+			Fragment:   &NoteFragmentOutput{Bitmask: FragmentTitle, Title: &remoteTitle},
+			AuthoredAt: now.Add(time.Hour), User: scTestUserGUID, CreatedAt: now,
+		},
+	}
+
+	pulls := 0
+	accepted := 0
+	healthy := true
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/health":
+			if !healthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/api/v1/sync/pull":
+			resp := SyncPullResponse{Changes: []SyncChange{}}
+			if pulls == 0 {
+				resp.Changes = batch
+			}
+			pulls++
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": resp})
+		case "/api/v1/sync/push":
+			var req SyncPushRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			resp := SyncPushResponse{Accepted: []string{}, Rejected: []SyncPushRejection{}}
+			for _, ch := range req.Changes {
+				resp.Accepted = append(resp.Accepted, ch.GUID)
+			}
+			accepted += len(resp.Accepted)
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": resp})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer hub.Close()
+
+	client := newTestSyncClient(hub.URL)
+	client.peerID = "sc-metrics-peer"
+
+	if err := client.runSyncCycle(t.Context()); err != nil {
+		t.Fatalf("first sync cycle failed: %v", err)
+	}
+	firstPushed := accepted
+	if err := client.runSyncCycle(t.Context()); err != nil {
+		t.Fatalf("second sync cycle failed: %v", err)
+	}
+	healthy = false
+	if err := client.runSyncCycle(t.Context()); err == nil {
+		t.Fatal("expected third sync cycle to fail")
+	}
+
+	metrics, err := ListSyncMetrics("sc-metrics-peer", 0)
+	if err != nil {
+		t.Fatalf("failed to list sync metrics: %v", err)
+	}
+	if len(metrics) != 3 {
+		t.Fatalf("expected 3 metric rows, got %d", len(metrics))
+	}
+
+	// Most recent first
+	failed, second, first := metrics[0], metrics[1], metrics[2]
+	if first.Outcome != SyncOutcomeSuccess || first.ChangesPulled != 2 || first.Conflicts != 1 {
+		t.Errorf("unexpected first cycle metric: %+v", first)
+	}
+	if firstPushed == 0 || first.ChangesPushed != firstPushed {
+		t.Errorf("expected first cycle to record %d pushed changes, got %d", firstPushed, first.ChangesPushed)
+	}
+	if second.Outcome != SyncOutcomeSuccess || second.ChangesPulled != 0 ||
+		second.ChangesPushed != accepted-firstPushed || second.Conflicts != 0 {
+		t.Errorf("unexpected second cycle metric: %+v", second)
+	}
+	if failed.Outcome != SyncOutcomeFailure || failed.Error == "" || failed.ChangesPulled != 0 {
+		t.Errorf("unexpected failed cycle metric: %+v", failed)
+	}
+
+	if others, _ := ListSyncMetrics("some-other-peer", 0); len(others) != 0 {
+		t.Errorf("expected no metrics for another peer, got %d", len(others))
+	}
+}
+
+// TestDryRunClassifiesWithoutApplying verifies that a dry run peeks at the
+// hub's pending changes, buckets them correctly, and writes nothing locally.
+func TestDryRunClassifiesWithoutApplying(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	// A locally edited note — a pulled update to it would conflict
+	if _, err := CreateNote(NoteInput{GUID: "dr-local", Title: "Local"}, scTestUserGUID); err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	title := "Remote"
+	now := time.Now()
+	noteChange := func(guid, entityGUID string, op int32) SyncChange {
+		return SyncChange{
+			GUID:       guid,
+			EntityType: "note",
+			EntityGUID: entityGUID,
+			Operation:  op,
+			Fragment:   &NoteFragmentOutput{Bitmask: FragmentTitle, Title: &title},
+			AuthoredAt: now,
+			User:       scTestUserGUID,
+			CreatedAt:  now,
+		}
+	}
+	batch := []SyncChange{
+		noteChange("dr-change-create", "dr-new", OperationCreate),
+		noteChange("dr-change-relayed", "dr-relayed", OperationSync),
+		noteChange("dr-change-update", "dr-local", OperationUpdate),
+		noteChange("dr-change-delete", "dr-gone", OperationDelete),
+	}
+
+	var peeked bool
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peeked = r.URL.Query().Get("peek") == "true"
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"success": true,
+			"data":    SyncPullResponse{Changes: batch, HasMore: true},
+		})
+	}))
+	defer hub.Close()
+
+	var notesBefore int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM notes`).Scan(&notesBefore); err != nil {
+		t.Fatalf("failed to count notes: %v", err)
+	}
+
+	client := newTestSyncClient(hub.URL)
+	report, err := client.DryRun(t.Context())
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+
+	if !peeked {
+		t.Error("expected dry run to pull with peek=true")
+	}
+	check := func(name string, got []string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+			return
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: expected %v, got %v", name, want, got)
+				return
+			}
+		}
+	}
+	check("would_create", report.WouldCreate, "dr-new", "dr-relayed")
+	check("would_update", report.WouldUpdate)
+	check("would_delete", report.WouldDelete, "dr-gone")
+	check("would_conflict", report.WouldConflict, "dr-local")
+	if !report.Truncated {
+		t.Error("expected truncated when the hub reports more changes")
+	}
+
+	// Nothing applied, nothing recorded
+	var notesAfter, conflicts int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM notes`).Scan(&notesAfter); err != nil {
+		t.Fatalf("failed to count notes: %v", err)
+	}
+	if notesAfter != notesBefore {
+		t.Errorf("expected %d notes after dry run, got %d", notesBefore, notesAfter)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sync_conflicts`).Scan(&conflicts); err != nil {
+		t.Fatalf("failed to count conflicts: %v", err)
+	}
+	if conflicts != 0 {
+		t.Errorf("expected no conflicts recorded by dry run, got %d", conflicts)
+	}
+	if note, _ := GetNoteByGUID("dr-local"); note == nil || note.Title != "Local" {
+		t.Errorf("expected local note untouched, got %+v", note)
+	}
+}
+
+// TestOrderPulledChanges verifies category creates move to the front while
+// the relative order of everything else is preserved.
+func TestOrderPulledChanges(t *testing.T) {
+	in := []SyncChange{
+		{GUID: "n1", EntityType: "note", Operation: OperationCreate},
+		{GUID: "c-upd", EntityType: "category", Operation: OperationUpdate},
+		{GUID: "c1", EntityType: "category", Operation: OperationCreate},
+		{GUID: "n2", EntityType: "note", Operation: OperationUpdate},
+		{GUID: "c2", EntityType: "category", Operation: OperationCreate},
+	}
+
+	got := orderPulledChanges(in)
+	want := []string{"c1", "c2", "n1", "c-upd", "n2"}
+	for i, ch := range got {
+		if ch.GUID != want[i] {
+			t.Fatalf("position %d: expected %s, got %s", i, want[i], ch.GUID)
+		}
+	}
+}
+
+// TestExpiredAccessTokenRenewedViaRefresh verifies that a 401 on a sync
+// request is answered by exchanging the refresh token — never by logging in
+// again with credentials — and that the request is retried with the new token.
+func TestExpiredAccessTokenRenewedViaRefresh(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	var loginCalls, refreshCalls int
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/auth/login":
+			loginCalls++
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/api/v1/auth/refresh":
+			refreshCalls++
+			var req map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req["refresh_token"] != "refresh-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": map[string]string{
+				"token": "renewed-token", "refresh_token": "refresh-2",
+			}})
+		case "/api/v1/sync/pull":
+			if r.Header.Get("Authorization") != "Bearer renewed-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": SyncPullResponse{Changes: []SyncChange{}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer hub.Close()
+
+	client := newTestSyncClient(hub.URL)
+	client.authToken = "expired-token"
+	client.refreshToken = "refresh-1"
+	client.config.Password = "" // No credentials held — refresh is the only way back in
+
+	if err := client.pullChanges(t.Context()); err != nil {
+		t.Fatalf("pullChanges failed: %v", err)
+	}
+
+	if loginCalls != 0 {
+		t.Errorf("expected no password logins, got %d", loginCalls)
+	}
+	if refreshCalls != 1 {
+		t.Errorf("expected 1 refresh call, got %d", refreshCalls)
+	}
+	if client.authToken != "renewed-token" {
+		t.Errorf("expected renewed access token, got %q", client.authToken)
+	}
+	if client.refreshToken != "refresh-2" {
+		t.Errorf("expected rotated refresh token, got %q", client.refreshToken)
+	}
+}
+
+// TestGetStatusConcurrentWithSyncCycles polls GetStatus while sync cycles
+// update the client's state. Run with -race to catch unguarded access.
+func TestGetStatusConcurrentWithSyncCycles(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t) // Cycles record sync metrics
+	defer cleanup()
+
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable) // Each cycle fails at the health check
+	}))
+	defer hub.Close()
+
+	client := newTestSyncClient(hub.URL)
+	client.enabled.Store(true)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			_ = client.runSyncCycle(t.Context())
+			client.recordSuccess()
+			client.ClearLastError()
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			if status := client.GetStatus(); !status.Connected || status.LastSync == nil {
+				t.Errorf("expected connected status with a last sync time, got %+v", status)
+			}
+			return
+		default:
+			status := client.GetStatus()
+			if status.Connected && status.LastError != "" {
+				t.Errorf("inconsistent snapshot: connected with last error %q", status.LastError)
+			}
+		}
+	}
+}
+
+// TestClearLastError verifies that acknowledging an error removes it from
+// the status snapshot, including when sync has since been disabled.
+func TestClearLastError(t *testing.T) {
+	client := newTestSyncClient("http://hub.invalid")
+	client.recordFailure(serr.New("hub unreachable"))
+	client.SetEnabled(false)
+
+	if status := client.GetStatus(); status.LastError == "" {
+		t.Fatal("expected last error to be reported before clearing")
+	}
+
+	client.ClearLastError()
+
+	if status := client.GetStatus(); status.LastError != "" {
+		t.Errorf("expected last error to be cleared, got %q", status.LastError)
+	}
+}
+
+// newBlockingHealthHub starts a hub whose health check blocks until release
+// is closed, holding a sync cycle in progress. started is signalled once the
+// cycle has reached the hub.
+func newBlockingHealthHub(t *testing.T, started chan<- struct{}, release <-chan struct{}) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/health" {
+			http.NotFound(w, r)
+			return
+		}
+		started <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusServiceUnavailable) // End the cycle without touching the DB
+	}))
+}
+
+// TestStopAndWaitLetsCycleFinish verifies that StopAndWait doesn't cancel a
+// running sync cycle, and returns once the cycle completes.
+func TestStopAndWaitLetsCycleFinish(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t) // Cycles record sync metrics
+	defer cleanup()
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	hub := newBlockingHealthHub(t, started, release)
+	defer hub.Close()
+
+	client := newTestSyncClient(hub.URL)
+	client.config.Interval = time.Hour
+	client.enabled.Store(true)
+	client.Start(t.Context())
+	<-started
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+	}()
+
+	begin := time.Now()
+	if err := client.StopAndWait(5 * time.Second); err != nil {
+		t.Fatalf("StopAndWait failed: %v", err)
+	}
+	if time.Since(begin) < 100*time.Millisecond {
+		t.Error("expected StopAndWait to wait for the in-flight cycle")
+	}
+	if client.inProgress.Load() {
+		t.Error("expected no cycle in progress after StopAndWait")
+	}
+	if failures := client.failureCount(); failures != 1 {
+		t.Errorf("expected the cycle to run to completion, got %d recorded failures", failures)
+	}
+
+	// No further cycles may start once stopped
+	if err := client.SyncNow(); err != nil {
+		t.Fatalf("SyncNow failed: %v", err)
+	}
+	select {
+	case <-started:
+		t.Error("expected no sync cycle after StopAndWait")
+	default:
+	}
+}
+
+// TestStopAndWaitTimeout verifies that StopAndWait gives up on a cycle that
+// outlasts the timeout and reports it.
+func TestStopAndWaitTimeout(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t) // Cycles record sync metrics
+	defer cleanup()
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	hub := newBlockingHealthHub(t, started, release)
+	defer hub.Close()
+
+	client := newTestSyncClient(hub.URL)
+	client.config.Interval = time.Hour
+	client.enabled.Store(true)
+	client.Start(t.Context())
+	<-started
+
+	if err := client.StopAndWait(50 * time.Millisecond); err == nil {
+		t.Error("expected a timeout error while the cycle is still running")
+	}
+}
+
+// TestPullMergesConcurrentMappingEdits recategorizes a note locally and pulls
+// a concurrent mapping snapshot for it, verifying the spoke applies the union,
+// logs the merge, and records the merged snapshot to push. Once the local edit
+// has been pushed, a pulled snapshot replaces the mappings as before.
+func TestPullMergesConcurrentMappingEdits(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	note, err := CreateNote(NoteInput{GUID: "sc-merge-note-guid", Title: "Merged"}, scTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	catA, err := CreateCategory(CategoryInput{Name: "Local Cat", Subcategories: []string{"x"}}, scTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+	catB, err := CreateCategory(CategoryInput{Name: "Remote Cat", Subcategories: []string{"y"}}, scTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+	if err := AddCategoryToNote(note.ID, catA.ID, scTestUserGUID); err != nil {
+		t.Fatalf("failed to map note locally: %v", err)
+	}
+
+	pullMapping := func(changeGUID string, mappings string) {
+		t.Helper()
+		now := time.Now()
+		hub := newFakePullHub(t, []SyncChange{{
+			GUID:       changeGUID,
+			EntityType: "note",
+			EntityGUID: note.GUID,
+			Operation:  OperationUpdate,
+			Fragment:   &NoteFragmentOutput{Bitmask: FragmentCategories, Categories: &mappings},
+			AuthoredAt: now,
+			User:       scTestUserGUID,
+			CreatedAt:  now,
+		}})
+		defer hub.Close()
+		if err := newTestSyncClient(hub.URL).pullChanges(t.Context()); err != nil {
+			t.Fatalf("pullChanges failed: %v", err)
+		}
+	}
+	mappedGUIDs := func() []string {
+		t.Helper()
+		categories, err := GetNoteCategories(note.ID, scTestUserGUID)
+		if err != nil {
+			t.Fatalf("failed to get note categories: %v", err)
+		}
+		guids := []string{}
+		for _, c := range categories {
+			guids = append(guids, c.GUID)
+		}
+		sort.Strings(guids)
+		return guids
+	}
+
+	pullMapping("sc-merge-change-1", `[{"category_guid":"`+catB.GUID+`","selected_subcategories":["y"]}]`)
+
+	want := []string{catA.GUID, catB.GUID}
+	sort.Strings(want)
+	if got := mappedGUIDs(); !slices.Equal(got, want) {
+		t.Fatalf("expected the union of both snapshots %v, got %v", want, got)
+	}
+
+	var resolution string
+	if err := db.QueryRow(`SELECT resolution FROM sync_conflicts WHERE entity_guid = ?`, note.GUID).
+		Scan(&resolution); err != nil || resolution != ResolutionMergeCategories {
+		t.Errorf("expected a %s conflict record, got %q (err %v)", ResolutionMergeCategories, resolution, err)
+	}
+
+	// The merged snapshot is queued to push after the local one
+	latest, err := getUnpushedMappingChange(note.GUID, "sc-test-peer")
+	if err != nil || latest == nil {
+		t.Fatalf("expected an unpushed mapping change, err=%v", err)
+	}
+	var categoriesJSON string
+	if err := db.QueryRow(`SELECT categories FROM note_fragments WHERE id = ?`, latest.NoteFragmentID.Int64).
+		Scan(&categoriesJSON); err != nil {
+		t.Fatalf("failed to read merged snapshot: %v", err)
+	}
+	var snapshot []NoteCategoryMappingSnapshot
+	if err := json.Unmarshal([]byte(categoriesJSON), &snapshot); err != nil || len(snapshot) != 2 {
+		t.Errorf("expected the queued snapshot to hold both categories, got %s", categoriesJSON)
+	}
+
+	// Once everything local has been pushed, a pulled snapshot just replaces
+	pending, err := GetPendingNoteChanges(note.GUID)
+	if err != nil {
+		t.Fatalf("failed to get pending changes: %v", err)
+	}
+	for _, ch := range pending {
+		if err := MarkChangeSyncedToPeer(ch.ID, "sc-test-peer"); err != nil {
+			t.Fatalf("failed to mark change pushed: %v", err)
+		}
+	}
+	pullMapping("sc-merge-change-2", `[{"category_guid":"`+catB.GUID+`"}]`)
+	if got := mappedGUIDs(); !slices.Equal(got, []string{catB.GUID}) {
+		t.Errorf("expected the pulled snapshot to replace the mappings, got %v", got)
+	}
+}
+
+// TestMergeCategoryMappings verifies the union is ordered by category GUID,
+// merges subcategories, and reports whether the remote side added anything.
+func TestMergeCategoryMappings(t *testing.T) {
+	local := `[{"category_guid":"b","selected_subcategories":["x"]}]`
+
+	merged, extends, err := mergeCategoryMappings(local,
+		`[{"category_guid":"b","selected_subcategories":["y","x"]},{"category_guid":"a"}]`)
+	if err != nil {
+		t.Fatalf("mergeCategoryMappings failed: %v", err)
+	}
+	if want := `[{"category_guid":"a"},{"category_guid":"b","selected_subcategories":["x","y"]}]`; merged != want || !extends {
+		t.Errorf("expected %s (extends local), got %s (extends %v)", want, merged, extends)
+	}
+
+	if _, extends, _ := mergeCategoryMappings(local, `[{"category_guid":"b"}]`); extends {
+		t.Error("expected a remote subset not to extend the local snapshot")
+	}
+}
+
+// TestSyncLoopWaitsForDBReadiness starts the sync client while the database
+// isn't marked ready and verifies no cycle runs (and no failure is recorded)
+// until it is.
+func TestSyncLoopWaitsForDBReadiness(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	var requests atomic.Int32
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer hub.Close()
+
+	client := newTestSyncClient(hub.URL)
+	client.config.Interval = 20 * time.Millisecond
+	client.enabled.Store(true)
+
+	dbReady.Store(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.Start(ctx)
+
+	time.Sleep(300 * time.Millisecond)
+	if n := requests.Load(); n != 0 {
+		t.Fatalf("expected no hub requests before the DB is ready, got %d", n)
+	}
+	if failures := client.failureCount(); failures != 0 {
+		t.Fatalf("expected no recorded failures before the DB is ready, got %d", failures)
+	}
+
+	dbReady.Store(true)
+	deadline := time.Now().Add(3 * time.Second)
+	for requests.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the first sync cycle once the DB became ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := client.StopAndWait(time.Second); err != nil {
+		t.Fatalf("StopAndWait failed: %v", err)
+	}
+}
+
+// TestStrictVersionRefusesMajorMismatch runs cycles against a hub reporting a
+// different major version: they go ahead with only a warning by default, and
+// fail with the mismatch reported once StrictVersion is set.
+func TestStrictVersionRefusesMajorMismatch(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	origVersion := Version
+	Version = "1.4.0"
+	t.Cleanup(func() { Version = origVersion })
+
+	pulls := 0
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/health":
+		case "/api/v1/version":
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": true,
+				"data": BuildInfo{Version: "v2.0.0", GitCommit: "abc1234", BuildTime: "dev"}})
+		case "/api/v1/sync/pull":
+			pulls++
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": true,
+				"data": SyncPullResponse{Changes: []SyncChange{}}})
+		case "/api/v1/sync/push":
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": true,
+				"data": SyncPushResponse{Accepted: []string{}, Rejected: []SyncPushRejection{}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer hub.Close()
+
+	sc := newTestSyncClient(hub.URL)
+	if err := sc.runSyncCycle(context.Background()); err != nil {
+		t.Fatalf("expected a non-strict cycle to succeed, got %v", err)
+	}
+	if pulls != 1 {
+		t.Fatalf("expected the non-strict cycle to pull, got %d pulls", pulls)
+	}
+
+	sc.config.StrictVersion = true
+	err := sc.runSyncCycle(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "hub major version v2.0.0 does not match ours (1.4.0)") {
+		t.Fatalf("expected a version mismatch error, got %v", err)
+	}
+	if pulls != 1 {
+		t.Errorf("expected the strict cycle to stop before pulling, got %d pulls", pulls)
+	}
+
+	// The same major version syncs in strict mode
+	Version = "2.1.0"
+	if err := sc.runSyncCycle(context.Background()); err != nil {
+		t.Errorf("expected matching major versions to sync, got %v", err)
+	}
+}
+
+func TestMajorVersion(t *testing.T) {
+	cases := map[string]string{"1.4.0": "1", "v2.0.1-rc1": "2", "10": "10", "dev": "", "": "", "vx.1": ""}
+	for in, want := range cases {
+		if got := MajorVersion(in); got != want {
+			t.Errorf("MajorVersion(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// countingExecer counts the statements executed through it.
+type countingExecer struct {
+	execer
+	statements int
+}
+
+func (c *countingExecer) Exec(query string, args ...any) (sql.Result, error) {
+	c.statements++
+	return c.execer.Exec(query, args...)
+}
+
+// TestMarkSyncChangesBatch verifies that a batch of changes is marked synced
+// with one statement per entity type, and that marking again is a no-op.
+func TestMarkSyncChangesBatch(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	const peerID = "sc-batch-mark-peer"
+	for i := range 98 {
+		guid := fmt.Sprintf("sc-batch-mark-note-%d", i)
+		if _, err := CreateNote(NoteInput{GUID: guid, Title: guid}, scTestUserGUID); err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+	for _, name := range []string{"Batch A", "Batch B"} {
+		if _, err := CreateCategory(CategoryInput{Name: name}, scTestUserGUID); err != nil {
+			t.Fatalf("failed to create category: %v", err)
+		}
+	}
+
+	response, err := GetUnifiedChangesForPeer(peerID, "", 200)
+	if err != nil {
+		t.Fatalf("GetUnifiedChangesForPeer failed: %v", err)
+	}
+	if len(response.Changes) != 100 {
+		t.Fatalf("expected 100 changes, got %d", len(response.Changes))
+	}
+
+	counter := &countingExecer{execer: db}
+	if err := markSyncChanges(counter, response.Changes, peerID); err != nil {
+		t.Fatalf("markSyncChanges failed: %v", err)
+	}
+	if counter.statements != 2 {
+		t.Errorf("expected one statement per entity type, got %d", counter.statements)
+	}
+
+	pending, err := GetUnifiedChangesForPeer(peerID, "", 200)
+	if err != nil {
+		t.Fatalf("GetUnifiedChangesForPeer failed: %v", err)
+	}
+	if len(pending.Changes) != 0 {
+		t.Errorf("expected no unsent changes after marking, got %d", len(pending.Changes))
+	}
+
+	// Marking the same changes again succeeds and adds no rows
+	MarkSyncChangesForPeer(response.Changes, peerID)
+	var noteIDs, categoryIDs []int64
+	for _, ch := range response.Changes {
+		if ch.EntityType == "note" {
+			noteIDs = append(noteIDs, ch.ID)
+		} else {
+			categoryIDs = append(categoryIDs, ch.ID)
+		}
+	}
+	if err := MarkChangesSyncedToPeerBatch(noteIDs, peerID); err != nil {
+		t.Errorf("re-marking note changes failed: %v", err)
+	}
+	if err := MarkCategoryChangesSyncedToPeerBatch(categoryIDs, peerID); err != nil {
+		t.Errorf("re-marking category changes failed: %v", err)
+	}
+
+	var rows int
+	if err := db.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM note_change_sync_peers WHERE peer_id = ?) +
+		(SELECT COUNT(*) FROM category_change_sync_peers WHERE peer_id = ?)`, peerID, peerID).Scan(&rows); err != nil {
+		t.Fatalf("failed to count synced rows: %v", err)
+	}
+	if rows != 100 {
+		t.Errorf("expected 100 synced rows, got %d", rows)
+	}
+}
@@ -27,6 +27,31 @@ type SyncConfig struct {
 	Password    string        // Authentication password (decoded from GONOTES_SYNC_PASSWORD_B64)
 	Interval    time.Duration // Polling interval between sync cycles (GONOTES_SYNC_INTERVAL)
 	InviteToken string        // One-time token for auto-registration on hub (GONOTES_SYNC_INVITE_TOKEN)
+
+	// ReorderPull applies category creates in each pulled batch before any
+	// note changes, regardless of hub ordering (GONOTES_SYNC_REORDER_PULL).
+	// Defaults to true so note-category mappings never reference a category
+	// that hasn't been created yet.
+	ReorderPull bool
+
+	// CategoryGUID, when set, pulls only that category and the notes in it
+	// (GONOTES_SYNC_CATEGORY). Pushes are unaffected.
+	CategoryGUID string
+
+	// MappingConflict is how concurrent edits to a note's categories are
+	// resolved (GONOTES_SYNC_MAPPING_CONFLICT): "merge" (the default) applies
+	// the union of both snapshots, "lww" keeps the last writer's.
+	MappingConflict string
+
+	// StrictVersion refuses to sync with a hub whose major version differs
+	// from this build's (GONOTES_SYNC_STRICT_VERSION). Off by default: a
+	// mismatch is only logged.
+	StrictVersion bool
+
+	// BatchSize is the most changes pulled or pushed per request
+	// (GONOTES_SYNC_BATCH_SIZE). Larger batches mean fewer round trips on a
+	// fast network; smaller ones keep memory down on constrained devices.
+	BatchSize int
 }
 
 // defaultSyncInterval is used when GONOTES_SYNC_INTERVAL is not set.
@@ -34,12 +59,19 @@ type SyncConfig struct {
 // single-user sync setup.
 const defaultSyncInterval = 5 * time.Minute
 
+// defaultSyncBatchSize is used when GONOTES_SYNC_BATCH_SIZE is not set.
+// It matches the hub's default pull limit.
+const defaultSyncBatchSize = 100
+
 // LoadSyncConfig reads sync configuration from environment variables.
 // Returns a config even when sync is disabled so callers can inspect
 // the state without nil checks.
 func LoadSyncConfig() (*SyncConfig, error) {
 	cfg := &SyncConfig{
-		Interval: defaultSyncInterval,
+		Interval:        defaultSyncInterval,
+		ReorderPull:     true,
+		MappingConflict: MappingConflictMerge,
+		BatchSize:       defaultSyncBatchSize,
 	}
 
 	// Parse enabled flag — defaults to false (opt-in design)
@@ -51,9 +83,33 @@ func LoadSyncConfig() (*SyncConfig, error) {
 		cfg.Enabled = enabled
 	}
 
+	if reorderStr := os.Getenv("GONOTES_SYNC_REORDER_PULL"); reorderStr != "" {
+		reorder, err := strconv.ParseBool(reorderStr)
+		if err != nil {
+			return nil, serr.Wrap(err, "invalid GONOTES_SYNC_REORDER_PULL value, expected true/false")
+		}
+		cfg.ReorderPull = reorder
+	}
+
+	if strictStr := os.Getenv("GONOTES_SYNC_STRICT_VERSION"); strictStr != "" {
+		strict, err := strconv.ParseBool(strictStr)
+		if err != nil {
+			return nil, serr.Wrap(err, "invalid GONOTES_SYNC_STRICT_VERSION value, expected true/false")
+		}
+		cfg.StrictVersion = strict
+	}
+
+	if strategy := os.Getenv("GONOTES_SYNC_MAPPING_CONFLICT"); strategy != "" {
+		if strategy != MappingConflictMerge && strategy != MappingConflictLWW {
+			return nil, serr.New("invalid GONOTES_SYNC_MAPPING_CONFLICT value, expected merge/lww")
+		}
+		cfg.MappingConflict = strategy
+	}
+
 	cfg.HubURL = os.Getenv("GONOTES_SYNC_HUB_URL")
 	cfg.Username = os.Getenv("GONOTES_SYNC_USERNAME")
 	cfg.InviteToken = os.Getenv("GONOTES_SYNC_INVITE_TOKEN")
+	cfg.CategoryGUID = os.Getenv("GONOTES_SYNC_CATEGORY")
 
 	// Password is base64-encoded in the env var to prevent casual exposure
 	// (e.g. shoulder-surfing, screenshots). Fall back to the legacy plaintext
@@ -78,6 +134,14 @@ func LoadSyncConfig() (*SyncConfig, error) {
 		cfg.Interval = interval
 	}
 
+	if batchStr := os.Getenv("GONOTES_SYNC_BATCH_SIZE"); batchStr != "" {
+		batchSize, err := strconv.Atoi(batchStr)
+		if err != nil {
+			return nil, serr.Wrap(err, "invalid GONOTES_SYNC_BATCH_SIZE value, expected an integer")
+		}
+		cfg.BatchSize = batchSize
+	}
+
 	return cfg, nil
 }
 
@@ -101,6 +165,9 @@ func (c *SyncConfig) Validate() error {
 	if c.Interval < 10*time.Second {
 		return serr.New("GONOTES_SYNC_INTERVAL must be at least 10s to avoid overwhelming the hub")
 	}
+	if c.BatchSize <= 0 {
+		return serr.New("GONOTES_SYNC_BATCH_SIZE must be greater than 0")
+	}
 
 	return nil
 }
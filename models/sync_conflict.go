@@ -189,6 +189,13 @@ func DeduplicateCategoryByName(localGUID, remoteGUID string) error {
 		return serr.Wrap(err, "error iterating note_categories for dedup")
 	}
 
+	if err := moveCategoryFavorites(localID, remoteID); err != nil {
+		return err
+	}
+	if err := moveCategoryRules(localID, remoteID); err != nil {
+		return err
+	}
+
 	// Delete the local category's mappings and the category itself
 	_, err = db.Exec(`DELETE FROM note_categories WHERE category_id = ?`, localID)
 	if err != nil {
@@ -203,6 +210,7 @@ func DeduplicateCategoryByName(localGUID, remoteGUID string) error {
 	if cacheDB != nil {
 		_, _ = cacheDB.Exec(`DELETE FROM note_categories WHERE category_id = ?`, localID)
 		_, _ = cacheDB.Exec(`DELETE FROM categories WHERE id = ?`, localID)
+		updateSyncChecksum("category", localGUID)
 	}
 
 	logger.Info("Deduplicated category by name",
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Sync Dead Letters
+//
+// A pushed change the hub keeps rejecting would otherwise be retried on every
+// cycle forever. Once a change is rejected permanently (see
+// isPermanentRejection) or MaxPushRejections times in a row, the sync client
+// records it here and marks it as synced so it stops blocking the push queue.
+// The full change is kept so it can be inspected or replayed by hand.
+// ============================================================================
+
+// MaxPushRejections is how many times the hub may reject a change before the
+// sync client gives up on it and dead-letters it.
+const MaxPushRejections = 5
+
+// SyncDeadLetter is a pushed change the hub would not accept.
+type SyncDeadLetter struct {
+	ID         int64     `json:"id"`
+	ChangeGUID string    `json:"change_guid"`
+	EntityType string    `json:"entity_type"`
+	EntityGUID string    `json:"entity_guid"`
+	PeerID     string    `json:"peer_id"`  // Peer ID the change was pushed under
+	Reason     string    `json:"reason"`   // Last rejection reason from the hub
+	Attempts   int       `json:"attempts"` // Number of rejections before giving up
+	Change     string    `json:"change"`   // JSON-serialized SyncChange
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DDL for the sync_dead_letters table and its auto-increment sequence.
+
+const DDLCreateSyncDeadLettersSequence = `
+CREATE SEQUENCE IF NOT EXISTS sync_dead_letters_id_seq START 1;
+`
+
+const DDLCreateSyncDeadLettersTable = `
+CREATE TABLE IF NOT EXISTS sync_dead_letters (
+    id           BIGINT PRIMARY KEY DEFAULT nextval('sync_dead_letters_id_seq'),
+    change_guid  VARCHAR NOT NULL,
+    entity_type  VARCHAR NOT NULL,
+    entity_guid  VARCHAR NOT NULL,
+    peer_id      VARCHAR NOT NULL,
+    reason       VARCHAR,
+    attempts     INTEGER NOT NULL,
+    change       VARCHAR,
+    created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// InsertSyncDeadLetter records a change the hub rejected for the last time.
+func InsertSyncDeadLetter(change SyncChange, peerID, reason string, attempts int) error {
+	changeJSON, err := json.Marshal(change)
+	if err != nil {
+		return serr.Wrap(err, "failed to marshal dead-lettered change")
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO sync_dead_letters (change_guid, entity_type, entity_guid, peer_id, reason, attempts, change)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		change.GUID, change.EntityType, change.EntityGUID, peerID, reason, attempts, string(changeJSON),
+	)
+	if err != nil {
+		return serr.Wrap(err, "failed to insert sync dead letter", "change_guid", change.GUID)
+	}
+	return nil
+}
+
+// GetDeadLetters returns all dead-lettered changes, most recent first.
+func GetDeadLetters() ([]SyncDeadLetter, error) {
+	rows, err := db.Query(`
+		SELECT id, change_guid, entity_type, entity_guid, peer_id, COALESCE(reason, ''),
+		       attempts, COALESCE(change, ''), created_at
+		FROM sync_dead_letters
+		ORDER BY id DESC
+	`)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to query sync dead letters")
+	}
+	defer rows.Close()
+
+	letters := []SyncDeadLetter{}
+	for rows.Next() {
+		var dl SyncDeadLetter
+		if err := rows.Scan(&dl.ID, &dl.ChangeGUID, &dl.EntityType, &dl.EntityGUID, &dl.PeerID,
+			&dl.Reason, &dl.Attempts, &dl.Change, &dl.CreatedAt); err != nil {
+			return nil, serr.Wrap(err, "failed to scan sync dead letter")
+		}
+		letters = append(letters, dl)
+	}
+
+	return letters, rows.Err()
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Sync Dry Run
+//
+// A dry run previews what the next pull would do to the local database so an
+// operator can confirm a risky sync (typically the first one against a hub
+// with a lot of history) before anything is applied. It pulls with peek=true,
+// which the hub answers without marking the changes as delivered, so the real
+// sync afterwards still receives every change. Nothing is written locally.
+// ============================================================================
+
+// DryRunPullLimit is the most changes a dry run previews. The hub can't page
+// through a peek (paging relies on marking delivered changes), so anything
+// beyond this is reported via DryRunReport.Truncated.
+const DryRunPullLimit = 1000
+
+// DryRunReport classifies pending hub changes by what applying them would do.
+// Each bucket lists entity GUIDs in pull order.
+type DryRunReport struct {
+	WouldCreate   []string `json:"would_create"`
+	WouldUpdate   []string `json:"would_update"`
+	WouldDelete   []string `json:"would_delete"`
+	WouldConflict []string `json:"would_conflict"` // Local edits pending for the same entity
+	Truncated     bool     `json:"truncated"`      // More than DryRunPullLimit changes are pending
+}
+
+// DryRun pulls the hub's pending changes without consuming them and reports
+// what applying them would do, without applying anything.
+func (sc *SyncClient) DryRun(ctx context.Context) (DryRunReport, error) {
+	report := DryRunReport{
+		WouldCreate:   []string{},
+		WouldUpdate:   []string{},
+		WouldDelete:   []string{},
+		WouldConflict: []string{},
+	}
+
+	pullURL := fmt.Sprintf("%s/api/v1/sync/pull?peer_id=%s&limit=%d&peek=true",
+		sc.config.HubURL, url.QueryEscape(sc.peerID), DryRunPullLimit) + sc.pullCategoryParam()
+	resp, err := sc.doAuthenticatedRequest(ctx, http.MethodGet, pullURL, nil)
+	if err != nil {
+		return report, serr.Wrap(err, "dry run pull request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return report, serr.New(fmt.Sprintf("dry run pull returned status %d", resp.StatusCode))
+	}
+
+	var apiResp struct {
+		Success bool             `json:"success"`
+		Data    SyncPullResponse `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return report, serr.Wrap(err, "failed to decode dry run pull response")
+	}
+	if !apiResp.Success {
+		return report, serr.New("dry run pull returned success=false")
+	}
+
+	for _, change := range apiResp.Data.Changes {
+		bucket, err := classifyPulledChange(change)
+		if err != nil {
+			return report, serr.Wrap(err, "failed to classify pulled change", "change_guid", change.GUID)
+		}
+		switch bucket {
+		case dryRunCreate:
+			report.WouldCreate = append(report.WouldCreate, change.EntityGUID)
+		case dryRunUpdate:
+			report.WouldUpdate = append(report.WouldUpdate, change.EntityGUID)
+		case dryRunDelete:
+			report.WouldDelete = append(report.WouldDelete, change.EntityGUID)
+		case dryRunConflict:
+			report.WouldConflict = append(report.WouldConflict, change.EntityGUID)
+		}
+	}
+	report.Truncated = apiResp.Data.HasMore
+
+	return report, nil
+}
+
+// Dry run buckets, as returned by classifyPulledChange.
+const (
+	dryRunCreate = iota
+	dryRunUpdate
+	dryRunDelete
+	dryRunConflict
+)
+
+// classifyPulledChange returns the dry run bucket for a pulled change.
+// Conflicts take precedence over the change's own operation. A relayed change
+// (OperationSync) creates the entity if it doesn't exist locally and updates
+// it otherwise.
+func classifyPulledChange(change SyncChange) (int, error) {
+	var hasConflict, exists bool
+
+	switch change.EntityType {
+	case "note":
+		local, err := DetectNoteConflict(change)
+		if err != nil {
+			return 0, err
+		}
+		hasConflict = local != nil
+
+		note, err := GetNoteByGUID(change.EntityGUID)
+		if err != nil {
+			return 0, err
+		}
+		exists = note != nil
+
+	case "category":
+		local, err := DetectCategoryConflict(change)
+		if err != nil {
+			return 0, err
+		}
+		hasConflict = local != nil
+
+		cat, err := GetCategoryByGUID(change.EntityGUID)
+		if err != nil {
+			return 0, err
+		}
+		exists = cat != nil
+
+	default:
+		return 0, serr.New("unknown entity type: " + change.EntityType)
+	}
+
+	switch {
+	case hasConflict:
+		return dryRunConflict, nil
+	case change.Operation == OperationCreate:
+		return dryRunCreate, nil
+	case change.Operation == OperationUpdate:
+		return dryRunUpdate, nil
+	case change.Operation == OperationDelete:
+		return dryRunDelete, nil
+	case change.Operation == OperationSync && exists:
+		return dryRunUpdate, nil
+	case change.Operation == OperationSync:
+		return dryRunCreate, nil
+	}
+	return 0, serr.New(fmt.Sprintf("unknown operation %d", change.Operation))
+}
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"sort"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Note-Category Mapping Conflicts
+//
+// A note's category mappings sync as a full snapshot (a note update whose
+// fragment carries only FragmentCategories), so when two peers recategorize
+// the same note between syncs, whichever snapshot lands last would silently
+// replace the other. With the default "merge" strategy the spoke instead
+// compares the pulled snapshot against its own when it still has a mapping
+// edit the hub hasn't seen, and applies the union: every category from
+// either side, with the subcategories selected on either side. The merge is
+// logged to sync_conflicts as "merge_categories" and recorded as a new local
+// mapping change, so the hub (and every other peer after it) converges on
+// the merged set once it's pushed. The "lww" strategy sends mapping changes
+// through the same last-writer-wins resolution as any other note change.
+// ============================================================================
+
+// Mapping conflict strategies (GONOTES_SYNC_MAPPING_CONFLICT)
+const (
+	MappingConflictMerge = "merge" // Union both snapshots (default)
+	MappingConflictLWW   = "lww"   // Last writer wins, like other note fields
+)
+
+// ResolutionMergeCategories is the sync_conflicts resolution of a merged
+// mapping conflict.
+const ResolutionMergeCategories = "merge_categories"
+
+// applyMappingChangeWithMerge applies a pulled mapping-only note update under
+// the merge strategy. It reports false for any other change, which the
+// caller then applies with the usual conflict detection.
+func (sc *SyncClient) applyMappingChangeWithMerge(change SyncChange) (bool, error) {
+	if change.EntityType != "note" || change.Operation != OperationUpdate {
+		return false, nil
+	}
+	fragment, err := deserializeNoteFragment(change.Fragment)
+	if err != nil || fragment.Bitmask != FragmentCategories || !fragment.Categories.Valid {
+		return false, nil // Not a mapping change; malformed ones are reported by the usual path
+	}
+	if changeGUIDExists(change.GUID) {
+		return true, nil // Already applied
+	}
+
+	note, err := GetNoteByGUID(change.EntityGUID)
+	if err != nil || note == nil {
+		return false, nil // The usual path reports the missing note
+	}
+
+	localChange, err := getUnpushedMappingChange(change.EntityGUID, sc.peerID)
+	if err != nil {
+		return true, err
+	}
+	if localChange == nil {
+		// A local edit to other fields doesn't conflict with a mapping change
+		return true, applySyncChangeFromPeer(change, sc.peerID)
+	}
+
+	localMappings, err := noteCategoryMappingsJSON(note.ID)
+	if err != nil {
+		return true, err
+	}
+	merged, extendsLocal, err := mergeCategoryMappings(localMappings, fragment.Categories.String)
+	if err != nil {
+		return true, err
+	}
+
+	mergedChange := change
+	mergedChange.Fragment = &NoteFragmentOutput{Bitmask: FragmentCategories, Categories: &merged}
+	if err := applySyncChangeFromPeer(mergedChange, sc.peerID); err != nil {
+		return true, err
+	}
+
+	sc.cycle.conflicts++
+	InsertSyncConflict("note", change.EntityGUID, SyncChange{
+		GUID:       localChange.GUID,
+		EntityType: "note",
+		EntityGUID: localChange.NoteGUID,
+		Operation:  localChange.Operation,
+		Fragment:   &NoteFragmentOutput{Bitmask: FragmentCategories, Categories: &localMappings},
+		CreatedAt:  localChange.CreatedAt,
+	}, change, ResolutionMergeCategories)
+
+	logger.Info("Sync conflict resolved",
+		"entity_type", change.EntityType,
+		"entity_guid", change.EntityGUID,
+		"resolution", ResolutionMergeCategories,
+		"mappings", merged,
+	)
+
+	// The unpushed local snapshot will reach the hub after the remote one, so
+	// unless it already covers the merge, follow it with the merged snapshot.
+	if extendsLocal {
+		recordNoteCategoryMappingChange(note.ID)
+	}
+	return true, nil
+}
+
+// getUnpushedMappingChange returns the latest local mapping change for a
+// note that hasn't been pushed to peerID, or nil if there is none.
+func getUnpushedMappingChange(noteGUID, peerID string) (*NoteChange, error) {
+	var c NoteChange
+	err := db.QueryRow(`
+		SELECT nc.id, nc.guid, nc.note_guid, nc.operation, nc.note_fragment_id, nc."user", nc.created_at
+		FROM note_changes nc
+		INNER JOIN note_fragments nf ON nf.id = nc.note_fragment_id
+		WHERE nc.note_guid = ? AND nc.operation = ? AND (nf.bitmask & ?) != 0
+			AND NOT EXISTS (SELECT 1 FROM note_change_sync_peers p
+				WHERE p.note_change_id = nc.id AND p.peer_id = ?)
+		ORDER BY nc.created_at DESC, nc.id DESC
+		LIMIT 1
+	`, noteGUID, OperationUpdate, FragmentCategories, peerID).Scan(
+		&c.ID, &c.GUID, &c.NoteGUID, &c.Operation, &c.NoteFragmentID, &c.User, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to query unpushed mapping changes", "note_guid", noteGUID)
+	}
+	return &c, nil
+}
+
+// mergeCategoryMappings returns the union of two mapping snapshots, ordered
+// by category GUID. A category on both sides keeps the local subcategories
+// followed by any the remote side adds. extendsLocal reports whether the
+// remote snapshot contributed anything local lacks.
+func mergeCategoryMappings(localJSON, remoteJSON string) (merged string, extendsLocal bool, err error) {
+	var local, remote []NoteCategoryMappingSnapshot
+	if err := json.Unmarshal([]byte(localJSON), &local); err != nil {
+		return "", false, serr.Wrap(err, "failed to parse local category mapping snapshot")
+	}
+	if err := json.Unmarshal([]byte(remoteJSON), &remote); err != nil {
+		return "", false, serr.Wrap(err, "failed to parse remote category mapping snapshot")
+	}
+
+	byGUID := make(map[string]*NoteCategoryMappingSnapshot, len(local)+len(remote))
+	for i := range local {
+		byGUID[local[i].CategoryGUID] = &local[i]
+	}
+	for _, r := range remote {
+		l, ok := byGUID[r.CategoryGUID]
+		if !ok {
+			copied := r
+			byGUID[r.CategoryGUID] = &copied
+			extendsLocal = true
+			continue
+		}
+		for _, sub := range r.SelectedSubcategories {
+			if !slices.Contains(l.SelectedSubcategories, sub) {
+				l.SelectedSubcategories = append(l.SelectedSubcategories, sub)
+				extendsLocal = true
+			}
+		}
+	}
+
+	mappings := make([]NoteCategoryMappingSnapshot, 0, len(byGUID))
+	for _, m := range byGUID {
+		mappings = append(mappings, *m)
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].CategoryGUID < mappings[j].CategoryGUID })
+
+	jsonBytes, err := json.Marshal(mappings)
+	if err != nil {
+		return "", false, serr.Wrap(err, "failed to marshal merged category mappings")
+	}
+	return string(jsonBytes), extendsLocal, nil
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"time"
+
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Sync Metrics
+//
+// The sync client records one row per sync cycle: how many changes it pulled
+// and pushed, how many conflicts it resolved, how long the cycle took, and
+// whether it succeeded. Status only shows the latest cycle; this history makes
+// trends visible, such as a peer that conflicts on every cycle or one whose
+// cycles keep getting slower.
+// ============================================================================
+
+// Sync cycle outcomes, as stored in sync_metrics.outcome.
+const (
+	SyncOutcomeSuccess = "success"
+	SyncOutcomeFailure = "failure"
+)
+
+// DefaultSyncMetricsLimit and MaxSyncMetricsLimit bound ListSyncMetrics.
+const (
+	DefaultSyncMetricsLimit = 50
+	MaxSyncMetricsLimit     = 1000
+)
+
+// SyncMetric describes one completed sync cycle.
+type SyncMetric struct {
+	ID            int64     `json:"id"`
+	PeerID        string    `json:"peer_id"`
+	StartedAt     time.Time `json:"started_at"`
+	DurationMs    int64     `json:"duration_ms"`
+	ChangesPulled int       `json:"changes_pulled"` // Changes received from the hub
+	ChangesPushed int       `json:"changes_pushed"` // Changes the hub accepted
+	Conflicts     int       `json:"conflicts"`      // Conflicts resolved while applying pulled changes
+	Outcome       string    `json:"outcome"`        // SyncOutcomeSuccess or SyncOutcomeFailure
+	Error         string    `json:"error,omitempty"`
+}
+
+// DDL for the sync_metrics table and its auto-increment sequence.
+
+const DDLCreateSyncMetricsSequence = `
+CREATE SEQUENCE IF NOT EXISTS sync_metrics_id_seq START 1;
+`
+
+const DDLCreateSyncMetricsTable = `
+CREATE TABLE IF NOT EXISTS sync_metrics (
+    id             BIGINT PRIMARY KEY DEFAULT nextval('sync_metrics_id_seq'),
+    peer_id        VARCHAR NOT NULL,
+    started_at     TIMESTAMP NOT NULL,
+    duration_ms    BIGINT NOT NULL,
+    changes_pulled INTEGER NOT NULL,
+    changes_pushed INTEGER NOT NULL,
+    conflicts      INTEGER NOT NULL,
+    outcome        VARCHAR NOT NULL,
+    error          VARCHAR
+);
+`
+
+const DDLCreateSyncMetricsIndexPeerID = `CREATE INDEX IF NOT EXISTS idx_sync_metrics_peer_id ON sync_metrics(peer_id);`
+
+// InsertSyncMetric records a completed sync cycle.
+func InsertSyncMetric(m SyncMetric) error {
+	_, err := db.Exec(
+		`INSERT INTO sync_metrics (peer_id, started_at, duration_ms, changes_pulled, changes_pushed,
+		                           conflicts, outcome, error)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.PeerID, m.StartedAt, m.DurationMs, m.ChangesPulled, m.ChangesPushed,
+		m.Conflicts, m.Outcome, toNullString(&m.Error),
+	)
+	if err != nil {
+		return serr.Wrap(err, "failed to insert sync metric", "peer_id", m.PeerID)
+	}
+	return nil
+}
+
+// ListSyncMetrics returns recorded sync cycles, most recent first. An empty
+// peerID returns every peer's cycles. limit <= 0 means DefaultSyncMetricsLimit;
+// it is capped at MaxSyncMetricsLimit.
+func ListSyncMetrics(peerID string, limit int) ([]SyncMetric, error) {
+	if limit <= 0 {
+		limit = DefaultSyncMetricsLimit
+	}
+	if limit > MaxSyncMetricsLimit {
+		limit = MaxSyncMetricsLimit
+	}
+
+	rows, err := db.Query(`
+		SELECT id, peer_id, started_at, duration_ms, changes_pulled, changes_pushed,
+		       conflicts, outcome, COALESCE(error, '')
+		FROM sync_metrics
+		WHERE ? = '' OR peer_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, peerID, peerID, limit)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to query sync metrics")
+	}
+	defer rows.Close()
+
+	metrics := []SyncMetric{}
+	for rows.Next() {
+		var m SyncMetric
+		if err := rows.Scan(&m.ID, &m.PeerID, &m.StartedAt, &m.DurationMs, &m.ChangesPulled,
+			&m.ChangesPushed, &m.Conflicts, &m.Outcome, &m.Error); err != nil {
+			return nil, serr.Wrap(err, "failed to scan sync metric")
+		}
+		metrics = append(metrics, m)
+	}
+
+	return metrics, rows.Err()
+}
@@ -1,11 +1,14 @@
 package models
 
 import (
-	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rohanthewiz/logger"
@@ -52,6 +55,7 @@ type NoteFragmentOutput struct {
 	Tags        *string `json:"tags,omitempty"`
 	IsPrivate   *bool   `json:"is_private,omitempty"`
 	Categories  *string `json:"categories,omitempty"`
+	Starred     *bool   `json:"starred,omitempty"`
 }
 
 // CategoryFragmentOutput is the JSON-friendly version of CategoryFragment.
@@ -76,6 +80,27 @@ type SyncPushRequest struct {
 	Changes []SyncChange `json:"changes"`
 }
 
+// DefaultMaxPushChanges caps the changes a hub accepts in one push when
+// GONOTES_SYNC_MAX_PUSH_CHANGES is unset. The sync client pushes in batches
+// of 100, well under it; larger pushes are refused so clients chunk them.
+const DefaultMaxPushChanges = 500
+
+// MaxPushChangesEnvVar overrides DefaultMaxPushChanges.
+const MaxPushChangesEnvVar = "GONOTES_SYNC_MAX_PUSH_CHANGES"
+
+// MaxPushChanges returns the configured cap on changes per push.
+// Invalid or non-positive values fall back to DefaultMaxPushChanges.
+func MaxPushChanges() int {
+	if maxStr := os.Getenv(MaxPushChangesEnvVar); maxStr != "" {
+		max, err := strconv.Atoi(maxStr)
+		if err == nil && max > 0 {
+			return max
+		}
+		logger.Warn("Ignoring invalid "+MaxPushChangesEnvVar, "value", maxStr)
+	}
+	return DefaultMaxPushChanges
+}
+
 // SyncPushResponse is the response body for POST /api/v1/sync/push.
 type SyncPushResponse struct {
 	Accepted []string            `json:"accepted"`
@@ -92,9 +117,10 @@ type SyncPushRejection struct {
 // The checksum provides a quick way for peers to detect whether their
 // data sets have diverged without comparing every record.
 type SyncStatusResponse struct {
-	NoteCount     int    `json:"note_count"`
-	CategoryCount int    `json:"category_count"`
-	Checksum      string `json:"checksum"`
+	NoteCount       int    `json:"note_count"`
+	CategoryCount   int    `json:"category_count"`
+	UserChangeCount int    `json:"user_change_count"` // Changes authored locally; excludes those applied from peers
+	Checksum        string `json:"checksum"`
 }
 
 // ============================================================================
@@ -129,6 +155,9 @@ func noteFragmentToOutput(f *NoteFragment) *NoteFragmentOutput {
 	if f.Categories.Valid {
 		out.Categories = &f.Categories.String
 	}
+	if f.Starred.Valid {
+		out.Starred = &f.Starred.Bool
+	}
 	return out
 }
 
@@ -178,6 +207,9 @@ func noteFragmentFromOutput(out *NoteFragmentOutput) NoteFragment {
 	if out.Categories != nil {
 		f.Categories = sql.NullString{String: *out.Categories, Valid: true}
 	}
+	if out.Starred != nil {
+		f.Starred = sql.NullBool{Bool: *out.Starred, Valid: true}
+	}
 	return f
 }
 
@@ -199,6 +231,34 @@ func categoryFragmentFromOutput(out *CategoryFragmentOutput) CategoryFragment {
 	return f
 }
 
+// ============================================================================
+// HasUnsentChangesForPeer
+// ============================================================================
+
+// HasUnsentChangesForPeer reports whether GetUnifiedChangesForPeerInCategory
+// would find any note or category change waiting for peerID, with the same
+// user and category filters. It runs the same unsent-change queries limited
+// to one row each and loads no fragments, so it is far cheaper than a full
+// pull. On error it logs and returns true, so the caller falls back to the
+// full query.
+func HasUnsentChangesForPeer(peerID, userGUID, categoryGUID string) bool {
+	noteChanges, err := getUnsentChangesForPeer(peerID, userGUID, categoryGUID, 1)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to check for unsent note changes"), "peer_id", peerID)
+		return true
+	}
+	if len(noteChanges) > 0 {
+		return true
+	}
+
+	categoryChanges, err := getUnsentCategoryChangesForPeer(peerID, userGUID, categoryGUID, 1)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to check for unsent category changes"), "peer_id", peerID)
+		return true
+	}
+	return len(categoryChanges) > 0
+}
+
 // ============================================================================
 // GetUnifiedChangesForPeer
 // ============================================================================
@@ -209,12 +269,23 @@ func categoryFragmentFromOutput(out *CategoryFragmentOutput) CategoryFragment {
 // The algorithm:
 //  1. Fetch unsent note changes (limit+1 to detect has_more)
 //  2. Fetch unsent category changes (limit+1 to detect has_more)
-//  3. Convert each to SyncChange (loading fragments, authored_at)
+//  3. Convert each to SyncChange (loading fragments, authored_at); a change
+//     whose fragment can't be loaded is left out rather than sent without
+//     its data, and stays unsent so a later pull retries it
 //  4. Merge into one slice sorted by CreatedAt ASC
 //  5. Categories with the same timestamp are sorted before notes so that
 //     category definitions exist before note-category mappings reference them
 //  6. Truncate to 'limit' and report has_more
 func GetUnifiedChangesForPeer(peerID string, userGUID string, limit int) (*SyncPullResponse, error) {
+	return GetUnifiedChangesForPeerInCategory(peerID, userGUID, "", limit)
+}
+
+// GetUnifiedChangesForPeerInCategory is GetUnifiedChangesForPeer restricted to
+// one category: the category's own changes, plus changes of notes that are in
+// it or have been (see noteInCategoryFilter). An empty categoryGUID means no
+// restriction. Changes filtered out stay unsent, so a later unfiltered pull
+// still delivers them.
+func GetUnifiedChangesForPeerInCategory(peerID, userGUID, categoryGUID string, limit int) (*SyncPullResponse, error) {
 	if limit <= 0 {
 		limit = 100
 	}
@@ -222,12 +293,12 @@ func GetUnifiedChangesForPeer(peerID string, userGUID string, limit int) (*SyncP
 	// Fetch limit+1 to detect whether more changes exist beyond this batch
 	fetchLimit := limit + 1
 
-	noteChanges, err := GetUnsentChangesForPeer(peerID, userGUID, fetchLimit)
+	noteChanges, err := getUnsentChangesForPeer(peerID, userGUID, categoryGUID, fetchLimit)
 	if err != nil {
 		return nil, serr.Wrap(err, "failed to get unsent note changes for peer")
 	}
 
-	categoryChanges, err := GetUnsentCategoryChangesForPeer(peerID, userGUID, fetchLimit)
+	categoryChanges, err := getUnsentCategoryChangesForPeer(peerID, userGUID, categoryGUID, fetchLimit)
 	if err != nil {
 		return nil, serr.Wrap(err, "failed to get unsent category changes for peer")
 	}
@@ -247,14 +318,19 @@ func GetUnifiedChangesForPeer(peerID string, userGUID string, limit int) (*SyncP
 			sc.User = nc.User.String
 		}
 
-		// Load fragment if present
+		// Load fragment if present. Sent without it, the change would reach
+		// the peer with no data to apply, so it's skipped instead.
 		if nc.NoteFragmentID.Valid {
 			fragment, err := GetNoteFragment(nc.NoteFragmentID.Int64)
+			if err == nil && fragment == nil {
+				err = serr.New("note fragment not found")
+			}
 			if err != nil {
-				logger.LogErr(err, "failed to load note fragment for sync", "fragment_id", nc.NoteFragmentID.Int64)
-			} else {
-				sc.Fragment = noteFragmentToOutput(fragment)
+				logger.LogErr(err, "skipping note change for sync: its fragment could not be loaded",
+					"change_guid", nc.GUID, "note_guid", nc.NoteGUID, "fragment_id", nc.NoteFragmentID.Int64)
+				continue
 			}
+			sc.Fragment = noteFragmentToOutput(fragment)
 		}
 
 		// Retrieve authored_at from disk DB (cache schema lacks it)
@@ -280,14 +356,18 @@ func GetUnifiedChangesForPeer(peerID string, userGUID string, limit int) (*SyncP
 			sc.User = cc.User.String
 		}
 
-		// Load fragment if present
+		// Load fragment if present, skipping the change if that fails (as for notes)
 		if cc.CategoryFragmentID.Valid {
 			fragment, err := GetCategoryFragment(cc.CategoryFragmentID.Int64)
+			if err == nil && fragment == nil {
+				err = serr.New("category fragment not found")
+			}
 			if err != nil {
-				logger.LogErr(err, "failed to load category fragment for sync", "fragment_id", cc.CategoryFragmentID.Int64)
-			} else {
-				sc.Fragment = categoryFragmentToOutput(fragment)
+				logger.LogErr(err, "skipping category change for sync: its fragment could not be loaded",
+					"change_guid", cc.GUID, "category_guid", cc.CategoryGUID, "fragment_id", cc.CategoryFragmentID.Int64)
+				continue
 			}
+			sc.Fragment = categoryFragmentToOutput(fragment)
 		}
 
 		// Use category updated_at as authored_at (categories don't have a
@@ -376,6 +456,25 @@ func getCategoryUpdatedAt(categoryGUID string) (time.Time, error) {
 // Idempotency: if the change GUID already exists in the change log, the
 // operation is skipped (returns nil without error).
 func ApplyIncomingSyncChange(change SyncChange) error {
+	return ApplyIncomingSyncChangeFromPeer(change, "")
+}
+
+// ApplyIncomingSyncChangeFromPeer is ApplyIncomingSyncChange for a change
+// received from originPeer. The locally recorded change is tagged with the
+// peer so GetUnifiedChangesForPeer never hands it back to the peer it came from.
+// originPeer is the ID the sender is tracked under in the *_sync_peers tables.
+// Changes pushed to a read-only instance are refused with ErrReadOnly.
+func ApplyIncomingSyncChangeFromPeer(change SyncChange, originPeer string) error {
+	if IsReadOnly() {
+		return ErrReadOnly
+	}
+	return applySyncChangeFromPeer(change, originPeer)
+}
+
+// applySyncChangeFromPeer applies a change without the read-only check, for
+// the instance's own sync client: a read-only replica still applies the
+// changes it pulls.
+func applySyncChangeFromPeer(change SyncChange, originPeer string) error {
 	// Idempotency check — skip if this exact change GUID was already applied.
 	// Check both note_changes and category_changes tables.
 	if changeGUIDExists(change.GUID) {
@@ -384,16 +483,16 @@ func ApplyIncomingSyncChange(change SyncChange) error {
 
 	switch change.EntityType {
 	case "note":
-		return applyIncomingNoteChange(change)
+		return applyIncomingNoteChange(change, originPeer)
 	case "category":
-		return applyIncomingCategoryChange(change)
+		return applyIncomingCategoryChange(change, originPeer)
 	default:
 		return serr.New("unknown entity type in sync change: " + change.EntityType)
 	}
 }
 
 // applyIncomingNoteChange handles note-type sync changes (create/update/delete).
-func applyIncomingNoteChange(change SyncChange) error {
+func applyIncomingNoteChange(change SyncChange, originPeer string) error {
 	switch change.Operation {
 	case OperationCreate:
 		// Idempotency: if the note GUID already exists, skip the create.
@@ -412,6 +511,9 @@ func applyIncomingNoteChange(change SyncChange) error {
 		if err != nil {
 			return serr.Wrap(err, "failed to deserialize note fragment for create")
 		}
+		if err := ValidateNoteFragment(fragment); err != nil {
+			return err
+		}
 
 		// Title is required — extract from fragment
 		title := ""
@@ -419,7 +521,7 @@ func applyIncomingNoteChange(change SyncChange) error {
 			title = fragment.Title.String
 		}
 
-		_, err = ApplySyncNoteCreate(change.EntityGUID, title, fragment, change.AuthoredAt, change.User)
+		_, err = ApplySyncNoteCreate(change.EntityGUID, title, fragment, change.AuthoredAt, change.User, originPeer)
 		if err != nil {
 			return serr.Wrap(err, "failed to apply sync note create")
 		}
@@ -437,8 +539,11 @@ func applyIncomingNoteChange(change SyncChange) error {
 		if err != nil {
 			return serr.Wrap(err, "failed to deserialize note fragment for update")
 		}
+		if err := ValidateNoteFragment(fragment); err != nil {
+			return err
+		}
 
-		err = ApplySyncNoteUpdate(change.EntityGUID, fragment, change.AuthoredAt)
+		err = ApplySyncNoteUpdate(change.EntityGUID, fragment, change.AuthoredAt, change.User, originPeer)
 		if err != nil {
 			return serr.Wrap(err, "failed to apply sync note update")
 		}
@@ -452,7 +557,7 @@ func applyIncomingNoteChange(change SyncChange) error {
 		return nil
 
 	case OperationDelete:
-		return ApplySyncNoteDelete(change.EntityGUID)
+		return ApplySyncNoteDelete(change.EntityGUID, originPeer)
 
 	default:
 		return serr.New(fmt.Sprintf("unknown note operation: %d", change.Operation))
@@ -460,7 +565,7 @@ func applyIncomingNoteChange(change SyncChange) error {
 }
 
 // applyIncomingCategoryChange handles category-type sync changes.
-func applyIncomingCategoryChange(change SyncChange) error {
+func applyIncomingCategoryChange(change SyncChange, originPeer string) error {
 	switch change.Operation {
 	case OperationCreate:
 		// Idempotency: if the category GUID already exists, skip the create
@@ -483,7 +588,7 @@ func applyIncomingCategoryChange(change SyncChange) error {
 		}
 
 		// Pass the change author's GUID as created_by for multi-user isolation
-		_, err = ApplySyncCategoryCreate(change.EntityGUID, name, fragment, change.User)
+		_, err = ApplySyncCategoryCreate(change.EntityGUID, name, fragment, change.User, originPeer)
 		if err != nil {
 			return serr.Wrap(err, "failed to apply sync category create")
 		}
@@ -495,10 +600,10 @@ func applyIncomingCategoryChange(change SyncChange) error {
 			return serr.Wrap(err, "failed to deserialize category fragment for update")
 		}
 
-		return ApplySyncCategoryUpdate(change.EntityGUID, fragment)
+		return ApplySyncCategoryUpdate(change.EntityGUID, fragment, originPeer)
 
 	case OperationDelete:
-		return ApplySyncCategoryDelete(change.EntityGUID)
+		return ApplySyncCategoryDelete(change.EntityGUID, originPeer)
 
 	default:
 		return serr.New(fmt.Sprintf("unknown category operation: %d", change.Operation))
@@ -533,6 +638,63 @@ func deserializeNoteFragment(fragment any) (NoteFragment, error) {
 	return noteFragmentFromOutput(&out), nil
 }
 
+// ValidateNoteFragment checks that a note fragment's bitmask agrees with the
+// fields it carries, so a malformed incoming change is rejected rather than
+// half-applied. Every field present must have its bit set. Title,
+// is_private, categories, and starred must have a value when their bit is set;
+// description, body, and tags may be null with the bit set, which clears the
+// field. A body diff needs the body bit and a body.
+func ValidateNoteFragment(f NoteFragment) error {
+	fields := []struct {
+		name     string
+		bit      int16
+		present  bool
+		nullable bool
+	}{
+		{"title", FragmentTitle, f.Title.Valid, false},
+		{"description", FragmentDescription, f.Description.Valid, true},
+		{"body", FragmentBody, f.Body.Valid, true},
+		{"tags", FragmentTags, f.Tags.Valid, true},
+		{"is_private", FragmentIsPrivate, f.IsPrivate.Valid, false},
+		{"categories", FragmentCategories, f.Categories.Valid, false},
+		{"starred", FragmentStarred, f.Starred.Valid, false},
+	}
+	for _, field := range fields {
+		bitSet := f.Bitmask&field.bit != 0
+		if field.present && !bitSet {
+			return serr.New(fmt.Sprintf("invalid note fragment: %s is present but its bitmask bit (0x%02x) is not set",
+				field.name, field.bit))
+		}
+		if bitSet && !field.present && !field.nullable {
+			return serr.New(fmt.Sprintf("invalid note fragment: bitmask sets %s (0x%02x) but the fragment has no %s",
+				field.name, field.bit, field.name))
+		}
+	}
+	if f.BodyIsDiff && (f.Bitmask&FragmentBody == 0 || !f.Body.Valid) {
+		return serr.New("invalid note fragment: body_is_diff is set without a body")
+	}
+	return nil
+}
+
+// ValidatePushChange rejects a pushed change that could never be applied,
+// before it reaches the apply path. A note create must carry the full body:
+// a body diff has no base to apply against, and since a create for a note
+// the receiver already has is skipped as a duplicate, a diff there would
+// otherwise be accepted without complaint.
+func ValidatePushChange(change SyncChange) error {
+	if change.EntityType != "note" || change.Operation != OperationCreate {
+		return nil
+	}
+	fragment, err := deserializeNoteFragment(change.Fragment)
+	if err != nil {
+		return serr.Wrap(err, "failed to deserialize note fragment for create")
+	}
+	if fragment.BodyIsDiff {
+		return serr.New("invalid note create: body_is_diff is set, but a create needs the full body, not a diff")
+	}
+	return nil
+}
+
 // deserializeCategoryFragment converts the Fragment field into a CategoryFragment.
 func deserializeCategoryFragment(fragment any) (CategoryFragment, error) {
 	if fragment == nil {
@@ -580,13 +742,35 @@ func changeGUIDExists(guid string) bool {
 // GetEntitySnapshot
 // ============================================================================
 
+// ErrSnapshotNotFound is returned (wrapped) when the entity to snapshot
+// doesn't exist or isn't owned by the requesting user.
+var ErrSnapshotNotFound = errors.New("entity not found for snapshot")
+
+// SnapshotOptions controls what GetEntitySnapshotWithOptions includes.
+type SnapshotOptions struct {
+	// IncludeCategories adds the note's category mappings (FragmentCategories)
+	// so that restoring from the snapshot also restores its categorization.
+	IncludeCategories bool
+}
+
+// DefaultSnapshotOptions returns the options used by GetEntitySnapshot.
+func DefaultSnapshotOptions() SnapshotOptions {
+	return SnapshotOptions{IncludeCategories: true}
+}
+
 // GetEntitySnapshot returns the full current state of a note or category as a
 // SyncChange with operation=Create and a full-snapshot fragment. This is used
 // for initial sync or conflict resolution when a peer needs the complete entity.
 func GetEntitySnapshot(entityType, entityGUID, userGUID string) (*SyncChange, error) {
+	return GetEntitySnapshotWithOptions(entityType, entityGUID, userGUID, DefaultSnapshotOptions())
+}
+
+// GetEntitySnapshotWithOptions is GetEntitySnapshot with control over optional
+// snapshot content. Options that don't apply to the entity type are ignored.
+func GetEntitySnapshotWithOptions(entityType, entityGUID, userGUID string, opts SnapshotOptions) (*SyncChange, error) {
 	switch entityType {
 	case "note":
-		return getNoteSnapshot(entityGUID, userGUID)
+		return getNoteSnapshot(entityGUID, userGUID, opts)
 	case "category":
 		return getCategorySnapshot(entityGUID, userGUID)
 	default:
@@ -596,23 +780,24 @@ func GetEntitySnapshot(entityType, entityGUID, userGUID string) (*SyncChange, er
 
 // getNoteSnapshot builds a full-body snapshot SyncChange for a note.
 // Reads from disk to get authored_at (not present in cache schema).
-func getNoteSnapshot(noteGUID, userGUID string) (*SyncChange, error) {
+// With opts.IncludeCategories the fragment also carries the note's category mappings.
+func getNoteSnapshot(noteGUID, userGUID string, opts SnapshotOptions) (*SyncChange, error) {
 	note, err := getNoteByGUIDFromDisk(noteGUID)
 	if err != nil {
 		return nil, serr.Wrap(err, "failed to get note from disk for snapshot")
 	}
 	if note == nil {
-		return nil, serr.New("note not found for snapshot: " + noteGUID)
+		return nil, serr.Wrap(ErrSnapshotNotFound, "entity_guid", noteGUID)
 	}
 
 	// Ownership verification: prevent User B from fetching User A's note snapshot
 	if userGUID != "" && note.CreatedBy.Valid && note.CreatedBy.String != userGUID {
-		return nil, serr.New("note not found for snapshot: " + noteGUID)
+		return nil, serr.Wrap(ErrSnapshotNotFound, "entity_guid", noteGUID)
 	}
 
 	// Build a full-snapshot fragment with all fields populated
 	fragment := &NoteFragmentOutput{
-		Bitmask: FragmentTitle | FragmentDescription | FragmentBody | FragmentTags | FragmentIsPrivate,
+		Bitmask: FragmentTitle | FragmentDescription | FragmentBody | FragmentTags | FragmentIsPrivate | FragmentStarred,
 	}
 	title := note.Title
 	fragment.Title = &title
@@ -626,6 +811,16 @@ func getNoteSnapshot(noteGUID, userGUID string) (*SyncChange, error) {
 		fragment.Tags = &note.Tags.String
 	}
 	fragment.IsPrivate = &note.IsPrivate
+	fragment.Starred = &note.Starred
+
+	if opts.IncludeCategories {
+		mappingsJSON, err := noteCategoryMappingsJSON(note.ID)
+		if err != nil {
+			return nil, serr.Wrap(err, "failed to get category mappings for snapshot")
+		}
+		fragment.Bitmask |= FragmentCategories
+		fragment.Categories = &mappingsJSON
+	}
 
 	// Determine authored_at
 	authoredAt := time.Time{}
@@ -658,12 +853,12 @@ func getCategorySnapshot(categoryGUID, userGUID string) (*SyncChange, error) {
 		return nil, serr.Wrap(err, "failed to get category for snapshot")
 	}
 	if cat == nil {
-		return nil, serr.New("category not found for snapshot: " + categoryGUID)
+		return nil, serr.Wrap(ErrSnapshotNotFound, "entity_guid", categoryGUID)
 	}
 
 	// Ownership verification: prevent User B from fetching User A's category snapshot
 	if userGUID != "" && cat.CreatedBy.Valid && cat.CreatedBy.String != userGUID {
-		return nil, serr.New("category not found for snapshot: " + categoryGUID)
+		return nil, serr.Wrap(ErrSnapshotNotFound, "entity_guid", categoryGUID)
 	}
 
 	fragment := &CategoryFragmentOutput{
@@ -688,17 +883,60 @@ func getCategorySnapshot(categoryGUID, userGUID string) (*SyncChange, error) {
 	}, nil
 }
 
+// MaxSnapshotBatchSize caps how many entities one GetEntitySnapshots call
+// may request, bounding the response size of a batch snapshot.
+const MaxSnapshotBatchSize = 500
+
+// EntityRef identifies one entity in a batch snapshot request.
+type EntityRef struct {
+	EntityType string `json:"entity_type"` // "note" or "category"
+	EntityGUID string `json:"entity_guid"`
+}
+
+// SyncSnapshotBatchRequest is the request body for POST /api/v1/sync/snapshot/batch.
+type SyncSnapshotBatchRequest struct {
+	Entities []EntityRef `json:"entities"`
+}
+
+// SyncSnapshotBatchResponse is the response body for POST /api/v1/sync/snapshot/batch.
+type SyncSnapshotBatchResponse struct {
+	Snapshots []SyncChange `json:"snapshots"`
+	Missing   []EntityRef  `json:"missing"` // Requested entities that don't exist or aren't the user's
+}
+
+// GetEntitySnapshots returns snapshots for several entities at once, as
+// GetEntitySnapshot would for each, so a new spoke can be seeded without one
+// request per entity. Snapshots come back in request order. Refs that don't
+// resolve to an entity the user owns are returned in missing rather than
+// failing the batch; any other error fails it.
+func GetEntitySnapshots(refs []EntityRef, userGUID string) (snapshots []SyncChange, missing []EntityRef, err error) {
+	snapshots = []SyncChange{}
+	missing = []EntityRef{}
+
+	for _, ref := range refs {
+		snapshot, err := GetEntitySnapshot(ref.EntityType, ref.EntityGUID, userGUID)
+		if errors.Is(err, ErrSnapshotNotFound) {
+			missing = append(missing, ref)
+			continue
+		}
+		if err != nil {
+			return nil, nil, serr.Wrap(err, "failed to get entity snapshot",
+				"entity_type", ref.EntityType, "entity_guid", ref.EntityGUID)
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+
+	return snapshots, missing, nil
+}
+
 // ============================================================================
 // GetSyncStatus
 // ============================================================================
 
 // GetSyncStatus returns counts and a content-based checksum of all notes and
 // categories. Peers compare checksums to detect data divergence without
-// transmitting every record.
-//
-// The checksum is SHA-256 of sorted note GUIDs concatenated with sorted
-// category GUIDs, separated by a pipe character. Identical data sets on
-// two machines will produce the same checksum.
+// transmitting every record (see sync_checksum.go). The change count
+// covers only changes authored on this instance, not ones received via sync.
 func GetSyncStatus(userGUID string) (*SyncStatusResponse, error) {
 	// Count notes (non-deleted), optionally filtered by user ownership
 	var noteCount int
@@ -728,121 +966,98 @@ func GetSyncStatus(userGUID string) (*SyncStatusResponse, error) {
 		}
 	}
 
-	// Build checksum from sorted GUIDs
-	checksum, err := computeSyncChecksum(userGUID)
+	userChangeCount, err := CountUserAuthoredChanges(userGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to count changes for sync status")
+	}
+
+	// The checksum is maintained incrementally as entities change
+	checksum, err := currentSyncChecksum(userGUID)
 	if err != nil {
-		return nil, serr.Wrap(err, "failed to compute sync checksum")
+		return nil, serr.Wrap(err, "failed to get sync checksum")
 	}
 
 	return &SyncStatusResponse{
-		NoteCount:     noteCount,
-		CategoryCount: categoryCount,
-		Checksum:      checksum,
+		NoteCount:       noteCount,
+		CategoryCount:   categoryCount,
+		UserChangeCount: userChangeCount,
+		Checksum:        checksum,
 	}, nil
 }
 
-// computeSyncChecksum produces a SHA-256 hash of sorted note GUIDs and sorted
-// category GUIDs. The hash changes whenever an entity is added, removed, or
-// has its GUID altered (which shouldn't happen, but would be caught).
-func computeSyncChecksum(userGUID string) (string, error) {
-	// Collect note GUIDs, optionally filtered by user ownership
-	var noteGUIDs []string
-	var err error
-	if userGUID != "" {
-		noteGUIDs, err = collectGUIDsWithArgs(`SELECT guid FROM notes WHERE deleted_at IS NULL AND created_by = ? ORDER BY guid`, userGUID)
-	} else {
-		noteGUIDs, err = collectGUIDs(`SELECT guid FROM notes WHERE deleted_at IS NULL ORDER BY guid`)
-	}
-	if err != nil {
-		return "", serr.Wrap(err, "failed to collect note GUIDs for checksum")
-	}
+// ============================================================================
+// MarkSyncChangesForPeer
+// ============================================================================
 
-	// Collect category GUIDs, optionally filtered by user ownership
-	var categoryGUIDs []string
-	if userGUID != "" {
-		categoryGUIDs, err = collectGUIDsWithArgs(`SELECT guid FROM categories WHERE created_by = ? ORDER BY guid`, userGUID)
-	} else {
-		categoryGUIDs, err = collectGUIDs(`SELECT guid FROM categories ORDER BY guid`)
-	}
+// MarkSyncChangesForPeer marks a batch of SyncChanges as synced to a peer.
+// This records that the peer has received these changes so they won't be
+// returned in subsequent GetUnifiedChangesForPeer calls. Note and category
+// changes are each marked with one statement, in one transaction.
+func MarkSyncChangesForPeer(changes []SyncChange, peerID string) {
+	tx, err := db.Begin()
 	if err != nil {
-		return "", serr.Wrap(err, "failed to collect category GUIDs for checksum")
+		logger.LogErr(err, "failed to begin marking changes as synced", "peer_id", peerID)
+		return
 	}
+	defer tx.Rollback()
 
-	// Sort both slices (queries already sort, but being defensive)
-	sort.Strings(noteGUIDs)
-	sort.Strings(categoryGUIDs)
-
-	// Concatenate with delimiters for the hash input
-	hashInput := ""
-	for _, g := range noteGUIDs {
-		hashInput += g + ","
+	if err := markSyncChanges(tx, changes, peerID); err != nil {
+		logger.LogErr(err, "failed to mark changes as synced", "peer_id", peerID, "changes", len(changes))
+		return
 	}
-	hashInput += "|"
-	for _, g := range categoryGUIDs {
-		hashInput += g + ","
+	if err := tx.Commit(); err != nil {
+		logger.LogErr(err, "failed to commit changes marked as synced", "peer_id", peerID)
 	}
-
-	h := sha256.Sum256([]byte(hashInput))
-	return fmt.Sprintf("%x", h), nil
 }
 
-// collectGUIDs executes a query that returns a single VARCHAR column and
-// collects all rows into a string slice.
-func collectGUIDs(query string) ([]string, error) {
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// execer is the Exec method shared by *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
 
-	var guids []string
-	for rows.Next() {
-		var guid string
-		if err := rows.Scan(&guid); err != nil {
-			return nil, err
+// markSyncChanges splits changes by entity type and marks each group synced
+// to peerID with a single statement.
+func markSyncChanges(ex execer, changes []SyncChange, peerID string) error {
+	var noteIDs, categoryIDs []int64
+	for _, ch := range changes {
+		switch ch.EntityType {
+		case "note":
+			noteIDs = append(noteIDs, ch.ID)
+		case "category":
+			categoryIDs = append(categoryIDs, ch.ID)
 		}
-		guids = append(guids, guid)
 	}
-	return guids, rows.Err()
-}
 
-// collectGUIDsWithArgs executes a parameterized query returning a single VARCHAR column.
-func collectGUIDsWithArgs(query string, args ...any) ([]string, error) {
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		return nil, err
+	if err := insertSyncedToPeerRows(ex, "note_change_sync_peers", "note_change_id", noteIDs, peerID); err != nil {
+		return serr.Wrap(err, "failed to mark note changes as synced")
 	}
-	defer rows.Close()
-
-	var guids []string
-	for rows.Next() {
-		var guid string
-		if err := rows.Scan(&guid); err != nil {
-			return nil, err
-		}
-		guids = append(guids, guid)
+	if err := insertSyncedToPeerRows(ex, "category_change_sync_peers", "category_change_id", categoryIDs, peerID); err != nil {
+		return serr.Wrap(err, "failed to mark category changes as synced")
 	}
-	return guids, rows.Err()
+	return nil
 }
 
-// ============================================================================
-// MarkSyncChangesForPeer
-// ============================================================================
-
-// MarkSyncChangesForPeer marks a batch of SyncChanges as synced to a peer.
-// This records that the peer has received these changes so they won't be
-// returned in subsequent GetUnifiedChangesForPeer calls.
-func MarkSyncChangesForPeer(changes []SyncChange, peerID string) {
-	for _, ch := range changes {
-		switch ch.EntityType {
-		case "note":
-			if err := MarkChangeSyncedToPeer(ch.ID, peerID); err != nil {
-				logger.LogErr(err, "failed to mark note change as synced", "change_id", ch.ID, "peer_id", peerID)
-			}
-		case "category":
-			if err := MarkCategoryChangeSyncedToPeer(ch.ID, peerID); err != nil {
-				logger.LogErr(err, "failed to mark category change as synced", "change_id", ch.ID, "peer_id", peerID)
-			}
+// insertSyncedToPeerRows inserts a (change, peer) row into a sync-peers table
+// for each of ids in one multi-row INSERT. Rows that already exist are left
+// alone, so marking the same changes again is a no-op.
+func insertSyncedToPeerRows(ex execer, table, idColumn string, ids []int64, peerID string) error {
+	seen := make(map[int64]bool, len(ids))
+	var values []string
+	var args []any
+	for _, id := range ids {
+		if seen[id] {
+			continue
 		}
+		seen[id] = true
+		values = append(values, "(?, ?)")
+		args = append(args, id, peerID)
 	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	_, err := ex.Exec(`INSERT INTO `+table+` (`+idColumn+`, peer_id)
+		VALUES `+strings.Join(values, ", ")+`
+		ON CONFLICT DO NOTHING`, args...)
+	return err
 }
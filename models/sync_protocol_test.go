@@ -1,6 +1,9 @@
 package models_test
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"os"
 	"testing"
 	"time"
@@ -122,6 +125,48 @@ func TestGetUnifiedChangesForPeer(t *testing.T) {
 	}
 }
 
+// TestGetUnifiedChangesForPeer_SkipsUnloadableFragment verifies that a change
+// whose fragment can't be loaded is left out of the pull instead of being sent
+// without a fragment, and stays unsent.
+func TestGetUnifiedChangesForPeer_SkipsUnloadableFragment(t *testing.T) {
+	cleanup := setupSyncProtocolTestDB(t)
+	defer cleanup()
+
+	peerID := "test-peer-bad-fragment"
+	_ = createTestNote(t, "sync-bad-fragment-note", "Bad Fragment")
+	_ = createTestNote(t, "sync-good-fragment-note", "Good Fragment")
+
+	// A NULL body_is_diff can't be scanned, so loading the fragment fails
+	if _, err := models.DB().Exec(`UPDATE note_fragments SET body_is_diff = NULL WHERE id =
+		(SELECT note_fragment_id FROM note_changes WHERE note_guid = ?)`, "sync-bad-fragment-note"); err != nil {
+		t.Fatalf("failed to corrupt fragment: %v", err)
+	}
+
+	response, err := models.GetUnifiedChangesForPeer(peerID, spTestUserGUID, 100)
+	if err != nil {
+		t.Fatalf("GetUnifiedChangesForPeer failed: %v", err)
+	}
+	if len(response.Changes) != 1 || response.Changes[0].EntityGUID != "sync-good-fragment-note" {
+		t.Fatalf("expected only the good note's change, got %+v", response.Changes)
+	}
+	if response.Changes[0].Fragment == nil {
+		t.Error("expected the good change to carry its fragment")
+	}
+	models.MarkSyncChangesForPeer(response.Changes, peerID)
+
+	// Once the fragment loads again, the skipped change is delivered
+	if _, err := models.DB().Exec(`UPDATE note_fragments SET body_is_diff = false WHERE body_is_diff IS NULL`); err != nil {
+		t.Fatalf("failed to repair fragment: %v", err)
+	}
+	response, err = models.GetUnifiedChangesForPeer(peerID, spTestUserGUID, 100)
+	if err != nil {
+		t.Fatalf("GetUnifiedChangesForPeer failed: %v", err)
+	}
+	if len(response.Changes) != 1 || response.Changes[0].EntityGUID != "sync-bad-fragment-note" {
+		t.Fatalf("expected the skipped change on the next pull, got %+v", response.Changes)
+	}
+}
+
 // TestGetUnifiedChangesForPeer_Pagination verifies has_more flag when
 // the number of changes exceeds the limit.
 func TestGetUnifiedChangesForPeer_Pagination(t *testing.T) {
@@ -249,6 +294,336 @@ func TestApplyIncomingSyncChange_NoteUpdate(t *testing.T) {
 	}
 }
 
+// TestApplyIncomingSyncChange_LazyCache verifies that with a lazy cache an
+// update to a note and a category that are on disk but not yet cached is
+// applied to them, rather than being treated as arriving before their create.
+func TestApplyIncomingSyncChange_LazyCache(t *testing.T) {
+	cleanup := setupSyncProtocolTestDB(t)
+	defer cleanup()
+
+	note := createTestNote(t, "lazy-update-target-guid", "Original Title")
+	cat := createTestCategory(t, "lazy-sync-cat")
+
+	// Reopen the same disk database with a lazy cache
+	models.CloseDB()
+	if err := models.InitDBWithOptions(models.DBOptions{Path: "./test_sync_protocol.ddb", LazyCache: true}); err != nil {
+		t.Fatalf("failed to reopen database with a lazy cache: %v", err)
+	}
+
+	newTitle := "Updated Via Lazy Sync"
+	err := models.ApplyIncomingSyncChange(models.SyncChange{
+		GUID:       "sync-change-lazy-note-update-001",
+		EntityType: "note",
+		EntityGUID: note.GUID,
+		Operation:  models.OperationUpdate,
+		Fragment: &models.NoteFragmentOutput{
+			Bitmask: models.FragmentTitle,
+			Title:   &newTitle,
+		},
+		AuthoredAt: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("ApplyIncomingSyncChange for lazy note update failed: %v", err)
+	}
+
+	newName := "lazy-sync-cat-renamed"
+	err = models.ApplyIncomingSyncChange(models.SyncChange{
+		GUID:       "sync-change-lazy-cat-update-001",
+		EntityType: "category",
+		EntityGUID: cat.GUID,
+		Operation:  models.OperationUpdate,
+		Fragment: &models.CategoryFragmentOutput{
+			Bitmask: models.CatFragmentName,
+			Name:    &newName,
+		},
+		AuthoredAt: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("ApplyIncomingSyncChange for lazy category update failed: %v", err)
+	}
+
+	updated, err := models.GetNoteByID(note.ID, spTestUserGUID)
+	if err != nil || updated == nil {
+		t.Fatalf("failed to get updated note: %v", err)
+	}
+	if updated.Title != newTitle {
+		t.Errorf("expected title %q, got %q", newTitle, updated.Title)
+	}
+	if !updated.Body.Valid || updated.Body.String != "body of Original Title" {
+		t.Errorf("body should be unchanged, got %v", updated.Body)
+	}
+
+	updatedCat, err := models.GetCategory(cat.ID, spTestUserGUID)
+	if err != nil || updatedCat == nil {
+		t.Fatalf("failed to get updated category: %v", err)
+	}
+	if updatedCat.Name != newName {
+		t.Errorf("expected category name %q, got %q", newName, updatedCat.Name)
+	}
+}
+
+// TestApplyIncomingSyncChange_NoteUpdateBeforeCreate verifies that an update
+// arriving before its note's create creates the note from a full body, and
+// reports ErrNoteNeedsSnapshot for a diff, which has nothing to apply to.
+func TestApplyIncomingSyncChange_NoteUpdateBeforeCreate(t *testing.T) {
+	cleanup := setupSyncProtocolTestDB(t)
+	defer cleanup()
+
+	title := "Arrived Early"
+	body := "full body from an update"
+	change := models.SyncChange{
+		GUID:       "sync-change-early-update-001",
+		EntityType: "note",
+		EntityGUID: "early-update-note-guid",
+		Operation:  models.OperationUpdate,
+		Fragment: &models.NoteFragmentOutput{
+			Bitmask: models.FragmentTitle | models.FragmentBody,
+			Title:   &title,
+			Body:    &body,
+		},
+		AuthoredAt: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+		User:       spTestUserGUID,
+	}
+	if err := models.ApplyIncomingSyncChange(change); err != nil {
+		t.Fatalf("ApplyIncomingSyncChange for early full-body update failed: %v", err)
+	}
+
+	note, err := models.GetNoteByGUID(change.EntityGUID)
+	if err != nil || note == nil {
+		t.Fatalf("expected the update to create the note, err=%v", err)
+	}
+	if note.Title != title || note.Body.String != body {
+		t.Errorf("expected created note %q/%q, got %q/%q", title, body, note.Title, note.Body.String)
+	}
+	if !note.CreatedBy.Valid || note.CreatedBy.String != spTestUserGUID {
+		t.Errorf("expected note owned by %s, got %v", spTestUserGUID, note.CreatedBy)
+	}
+
+	diff := "@@ -1,4 +1,4 @@\n-base\n+edit\n"
+	diffChange := models.SyncChange{
+		GUID:       "sync-change-early-update-002",
+		EntityType: "note",
+		EntityGUID: "early-diff-note-guid",
+		Operation:  models.OperationUpdate,
+		Fragment: &models.NoteFragmentOutput{
+			Bitmask:    models.FragmentBody,
+			Body:       &diff,
+			BodyIsDiff: true,
+		},
+		AuthoredAt: time.Now(),
+		User:       spTestUserGUID,
+	}
+	err = models.ApplyIncomingSyncChange(diffChange)
+	if !errors.Is(err, models.ErrNoteNeedsSnapshot) {
+		t.Fatalf("expected ErrNoteNeedsSnapshot for a diff update of a missing note, got %v", err)
+	}
+	if missing, _ := models.GetNoteByGUID(diffChange.EntityGUID); missing != nil {
+		t.Error("expected no note to be created from a diff")
+	}
+}
+
+// TestApplyIncomingSyncChange_NoteUpdateSetsUpdatedBy verifies that a synced
+// edit is attributed to the remote author, and a later local edit to the
+// local user (resolved to a username).
+func TestApplyIncomingSyncChange_NoteUpdateSetsUpdatedBy(t *testing.T) {
+	cleanup := setupSyncProtocolTestDB(t)
+	defer cleanup()
+
+	local, err := models.CreateUser(models.UserRegisterInput{Username: "localeditor", Password: "password123"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	note, err := models.CreateNote(models.NoteInput{GUID: "updated-by-guid", Title: "Original"}, local.GUID)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	newTitle := "Edited Remotely"
+	change := models.SyncChange{
+		GUID:       "sync-change-updated-by-001",
+		EntityType: "note",
+		EntityGUID: note.GUID,
+		Operation:  models.OperationUpdate,
+		Fragment: &models.NoteFragmentOutput{
+			Bitmask: models.FragmentTitle,
+			Title:   &newTitle,
+		},
+		AuthoredAt: time.Now(),
+		User:       "remote-user-guid",
+	}
+	if err := models.ApplyIncomingSyncChange(change); err != nil {
+		t.Fatalf("ApplyIncomingSyncChange for note update failed: %v", err)
+	}
+
+	synced, err := models.GetNoteByID(note.ID, local.GUID)
+	if err != nil || synced == nil {
+		t.Fatalf("failed to get synced note: %v", err)
+	}
+	out := synced.ToOutput()
+	if out.UpdatedBy == nil || *out.UpdatedBy != "remote-user-guid" {
+		t.Errorf("expected updated_by remote-user-guid after sync, got %v", out.UpdatedBy)
+	}
+	if out.UpdatedByName != nil {
+		t.Errorf("expected no username for a remote-only user, got %q", *out.UpdatedByName)
+	}
+
+	edited, err := models.UpdateNote(note.ID, models.NoteInput{GUID: note.GUID, Title: "Edited Locally"}, local.GUID)
+	if err != nil || edited == nil {
+		t.Fatalf("failed to update note locally: %v", err)
+	}
+	out = edited.ToOutput()
+	if out.UpdatedBy == nil || *out.UpdatedBy != local.GUID {
+		t.Errorf("expected updated_by %s after local edit, got %v", local.GUID, out.UpdatedBy)
+	}
+	if out.UpdatedByName == nil || *out.UpdatedByName != "localeditor" {
+		t.Errorf("expected updated_by_username localeditor, got %v", out.UpdatedByName)
+	}
+}
+
+// TestStarredNoteSync verifies that starring a note filters it into the
+// starred listing and records a change carrying only the starred bit, which
+// stars the note again when applied on the receiving side.
+func TestStarredNoteSync(t *testing.T) {
+	cleanup := setupSyncProtocolTestDB(t)
+	defer cleanup()
+
+	note := createTestNote(t, "starred-sync-guid", "Star Me")
+	_ = createTestNote(t, "unstarred-sync-guid", "Leave Me")
+
+	starred, err := models.SetNoteStarred(note.ID, spTestUserGUID, true)
+	if err != nil || starred == nil || !starred.Starred {
+		t.Fatalf("SetNoteStarred failed: note=%v err=%v", starred, err)
+	}
+	if other, err := models.SetNoteStarred(note.ID, "someone-else", true); err != nil || other != nil {
+		t.Errorf("expected another user's note to be not found, got %v (err %v)", other, err)
+	}
+
+	list, err := models.ListStarredNotesInRange(spTestUserGUID, models.CreatedRange{}, 0, 0)
+	if err != nil {
+		t.Fatalf("ListStarredNotesInRange failed: %v", err)
+	}
+	if len(list) != 1 || list[0].GUID != note.GUID {
+		t.Errorf("expected only the starred note, got %+v", list)
+	}
+	if count, err := models.CountNotes(spTestUserGUID, models.NoteListFilter{Starred: true}); err != nil || count != 1 {
+		t.Errorf("expected a starred count of 1, got %d (err %v)", count, err)
+	}
+
+	// Starring again is a no-op and records nothing
+	before, _ := models.CountUserAuthoredChanges(spTestUserGUID)
+	if _, err := models.SetNoteStarred(note.ID, spTestUserGUID, true); err != nil {
+		t.Fatalf("SetNoteStarred failed: %v", err)
+	}
+	if after, _ := models.CountUserAuthoredChanges(spTestUserGUID); after != before {
+		t.Errorf("expected no change for an unchanged star, went from %d to %d", before, after)
+	}
+
+	response, err := models.GetUnifiedChangesForPeer("starred-peer", "", 100)
+	if err != nil {
+		t.Fatalf("GetUnifiedChangesForPeer failed: %v", err)
+	}
+	var starChange *models.SyncChange
+	for i, ch := range response.Changes {
+		if ch.EntityGUID == note.GUID && ch.Operation == models.OperationUpdate {
+			starChange = &response.Changes[i]
+		}
+	}
+	if starChange == nil {
+		t.Fatal("expected an update change for the star")
+	}
+	fragment, ok := starChange.Fragment.(*models.NoteFragmentOutput)
+	if !ok || fragment.Bitmask != models.FragmentStarred || fragment.Starred == nil || !*fragment.Starred {
+		t.Fatalf("expected a fragment with only the starred bit, got %+v", starChange.Fragment)
+	}
+
+	// Unstar locally, then apply the pulled change as a peer's
+	if _, err := models.SetNoteStarred(note.ID, spTestUserGUID, false); err != nil {
+		t.Fatalf("SetNoteStarred(false) failed: %v", err)
+	}
+	incoming := *starChange
+	incoming.GUID = "starred-sync-incoming-001"
+	if err := models.ApplyIncomingSyncChange(incoming); err != nil {
+		t.Fatalf("ApplyIncomingSyncChange failed: %v", err)
+	}
+
+	// Read both copies: the cache and, after a rebuild, the disk
+	for _, label := range []string{"cache", "disk"} {
+		if label == "disk" {
+			if err := models.RebuildCache(); err != nil {
+				t.Fatalf("failed to rebuild cache: %v", err)
+			}
+		}
+		synced, err := models.GetNoteByGUID(note.GUID)
+		if err != nil || synced == nil {
+			t.Fatalf("failed to get synced note: %v", err)
+		}
+		if !synced.Starred {
+			t.Errorf("expected the %s copy to be starred after sync", label)
+		}
+		if synced.Title != "Star Me" {
+			t.Errorf("expected the title unchanged, got %q", synced.Title)
+		}
+	}
+}
+
+// TestRestoreStarredNoteSync verifies that restoring a starred note records
+// a snapshot carrying the starred flag, so a peer that already purged the
+// note recreates it starred.
+func TestRestoreStarredNoteSync(t *testing.T) {
+	cleanup := setupSyncProtocolTestDB(t)
+	defer cleanup()
+
+	note := createTestNote(t, "restore-starred-guid", "Starred Restore")
+	if _, err := models.SetNoteStarred(note.ID, spTestUserGUID, true); err != nil {
+		t.Fatalf("SetNoteStarred failed: %v", err)
+	}
+	if _, err := models.DeleteNote(note.ID, spTestUserGUID); err != nil {
+		t.Fatalf("DeleteNote failed: %v", err)
+	}
+	// Everything up to the restore has reached the peer
+	before, err := models.GetUnifiedChangesForPeer("restore-peer", "", 100)
+	if err != nil {
+		t.Fatalf("GetUnifiedChangesForPeer failed: %v", err)
+	}
+	models.MarkSyncChangesForPeer(before.Changes, "restore-peer")
+
+	if restored, err := models.RestoreNote(note.ID, spTestUserGUID); err != nil || restored == nil {
+		t.Fatalf("RestoreNote failed: note=%v err=%v", restored, err)
+	}
+	response, err := models.GetUnifiedChangesForPeer("restore-peer", "", 100)
+	if err != nil {
+		t.Fatalf("GetUnifiedChangesForPeer failed: %v", err)
+	}
+	if len(response.Changes) != 1 {
+		t.Fatalf("expected only the restore change, got %+v", response.Changes)
+	}
+	restoreChange := response.Changes[0]
+	fragment, ok := restoreChange.Fragment.(*models.NoteFragmentOutput)
+	if !ok || fragment.Bitmask&models.FragmentStarred == 0 || fragment.Starred == nil || !*fragment.Starred {
+		t.Fatalf("expected the restore fragment to carry starred=true, got %+v", restoreChange.Fragment)
+	}
+
+	// Play the peer: it purged the note, then receives the restore
+	if purged, err := models.PurgeNote(note.ID, spTestUserGUID); err != nil || !purged {
+		t.Fatalf("PurgeNote failed: purged=%v err=%v", purged, err)
+	}
+	restoreChange.GUID = "restore-starred-incoming-001"
+	if err := models.ApplyIncomingSyncChange(restoreChange); err != nil {
+		t.Fatalf("ApplyIncomingSyncChange failed: %v", err)
+	}
+
+	recreated, err := models.GetNoteByGUID(note.GUID)
+	if err != nil || recreated == nil {
+		t.Fatalf("expected the restore to recreate the purged note: %v", err)
+	}
+	if !recreated.Starred {
+		t.Error("expected the recreated note to be starred")
+	}
+	if recreated.Title != "Starred Restore" {
+		t.Errorf("expected the title from the restore snapshot, got %q", recreated.Title)
+	}
+}
+
 // TestApplyIncomingSyncChange_NoteDelete verifies that a delete change
 // soft-deletes the note.
 func TestApplyIncomingSyncChange_NoteDelete(t *testing.T) {
@@ -483,6 +858,78 @@ func TestApplyIncomingSyncChange_Idempotency(t *testing.T) {
 	}
 }
 
+// TestOriginPeerNotEchoed simulates a hub with two spokes (B and C). Changes
+// applied from one spoke must be offered to the other but never back to the
+// spoke they came from.
+func TestOriginPeerNotEchoed(t *testing.T) {
+	cleanup := setupSyncProtocolTestDB(t)
+	defer cleanup()
+
+	title := "From B"
+	catName := "Category From B"
+	noteCreate := models.SyncChange{
+		GUID:       "origin-note-create",
+		EntityType: "note",
+		EntityGUID: "origin-note-guid",
+		Operation:  models.OperationCreate,
+		Fragment:   &models.NoteFragmentOutput{Bitmask: models.FragmentTitle, Title: &title},
+		AuthoredAt: time.Now(),
+	}
+	catCreate := models.SyncChange{
+		GUID:       "origin-cat-create",
+		EntityType: "category",
+		EntityGUID: "origin-cat-guid",
+		Operation:  models.OperationCreate,
+		Fragment:   &models.CategoryFragmentOutput{Bitmask: models.CatFragmentName, Name: &catName},
+	}
+	for _, ch := range []models.SyncChange{catCreate, noteCreate} {
+		if err := models.ApplyIncomingSyncChangeFromPeer(ch, "peer-B"); err != nil {
+			t.Fatalf("failed to apply change from peer-B: %v", err)
+		}
+	}
+
+	// C deletes the note; that delete must reach B but not return to C
+	noteDelete := models.SyncChange{
+		GUID:       "origin-note-delete",
+		EntityType: "note",
+		EntityGUID: "origin-note-guid",
+		Operation:  models.OperationDelete,
+		AuthoredAt: time.Now(),
+	}
+	if err := models.ApplyIncomingSyncChangeFromPeer(noteDelete, "peer-C"); err != nil {
+		t.Fatalf("failed to apply change from peer-C: %v", err)
+	}
+
+	countOps := func(peerID string) map[string]int {
+		t.Helper()
+		resp, err := models.GetUnifiedChangesForPeer(peerID, "", 100)
+		if err != nil {
+			t.Fatalf("GetUnifiedChangesForPeer(%s) failed: %v", peerID, err)
+		}
+		ops := map[string]int{}
+		for _, ch := range resp.Changes {
+			ops[fmt.Sprintf("%s:%d", ch.EntityType, ch.Operation)]++
+		}
+		return ops
+	}
+
+	forB := countOps("peer-B")
+	if forB["note:9"] != 0 || forB["category:9"] != 0 {
+		t.Errorf("changes from peer-B were offered back to peer-B: %v", forB)
+	}
+	if forB["note:3"] != 1 {
+		t.Errorf("expected peer-C's delete to be offered to peer-B, got %v", forB)
+	}
+
+	forC := countOps("peer-C")
+	if forC["note:9"] != 1 || forC["category:9"] != 1 {
+		t.Errorf("expected peer-B's changes to be offered to peer-C, got %v", forC)
+	}
+	if forC["note:3"] != 0 {
+		t.Errorf("peer-C's delete was offered back to peer-C: %v", forC)
+	}
+}
+
 // ============================================================================
 // TestGetEntitySnapshot
 // ============================================================================
@@ -526,6 +973,73 @@ func TestGetEntitySnapshot(t *testing.T) {
 	}
 }
 
+// TestGetEntitySnapshot_CategoryMappings verifies that a note snapshot carries
+// the note's category mappings and that applying it on a fresh peer restores them.
+func TestGetEntitySnapshot_CategoryMappings(t *testing.T) {
+	cleanup := setupSyncProtocolTestDB(t)
+
+	note := createTestNote(t, "snapshot-mapped-note", "Mapped Note")
+	cat, err := models.CreateCategory(models.CategoryInput{
+		Name:          "Snapshot Mapped Category",
+		Subcategories: []string{"alpha", "beta"},
+	}, spTestUserGUID)
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+	if err := models.AddCategoryToNoteWithSubcategories(note.ID, cat.ID, []string{"beta"}, spTestUserGUID, true); err != nil {
+		t.Fatalf("failed to add category to note: %v", err)
+	}
+
+	catSnapshot, err := models.GetEntitySnapshot("category", cat.GUID, "")
+	if err != nil {
+		t.Fatalf("GetEntitySnapshot for category failed: %v", err)
+	}
+	noteSnapshot, err := models.GetEntitySnapshot("note", note.GUID, "")
+	if err != nil {
+		t.Fatalf("GetEntitySnapshot for note failed: %v", err)
+	}
+
+	fragment := noteSnapshot.Fragment.(*models.NoteFragmentOutput)
+	if fragment.Bitmask&models.FragmentCategories == 0 || fragment.Categories == nil {
+		t.Fatalf("expected snapshot to carry category mappings, bitmask=0x%02x", fragment.Bitmask)
+	}
+
+	withoutCats, err := models.GetEntitySnapshotWithOptions("note", note.GUID, "", models.SnapshotOptions{})
+	if err != nil {
+		t.Fatalf("GetEntitySnapshotWithOptions failed: %v", err)
+	}
+	if withoutCats.Fragment.(*models.NoteFragmentOutput).Bitmask&models.FragmentCategories != 0 {
+		t.Error("expected no category mappings when IncludeCategories is false")
+	}
+
+	// Start over with an empty database standing in for a fresh peer
+	cleanup()
+	cleanup = setupSyncProtocolTestDB(t)
+	defer cleanup()
+
+	if err := models.ApplyIncomingSyncChange(*catSnapshot); err != nil {
+		t.Fatalf("failed to apply category snapshot: %v", err)
+	}
+	if err := models.ApplyIncomingSyncChange(*noteSnapshot); err != nil {
+		t.Fatalf("failed to apply note snapshot: %v", err)
+	}
+
+	restored, err := models.GetNoteByGUID(note.GUID)
+	if err != nil || restored == nil {
+		t.Fatalf("expected restored note, err=%v", err)
+	}
+	details, err := models.GetNoteCategoryDetails(restored.ID, "")
+	if err != nil {
+		t.Fatalf("failed to get note categories: %v", err)
+	}
+	if len(details) != 1 || details[0].Name != "Snapshot Mapped Category" {
+		t.Fatalf("expected restored mapping to 'Snapshot Mapped Category', got %+v", details)
+	}
+	if len(details[0].SelectedSubcategories) != 1 || details[0].SelectedSubcategories[0] != "beta" {
+		t.Errorf("expected selected subcategories [beta], got %v", details[0].SelectedSubcategories)
+	}
+}
+
 // TestGetEntitySnapshot_Category verifies snapshot for categories.
 func TestGetEntitySnapshot_Category(t *testing.T) {
 	cleanup := setupSyncProtocolTestDB(t)
@@ -622,3 +1136,206 @@ func TestGetSyncStatus(t *testing.T) {
 		t.Error("expected identical checksums for unchanged data")
 	}
 }
+
+// TestCountUserAuthoredChanges verifies that changes applied from a peer don't
+// count as user activity, while locally authored ones do.
+func TestCountUserAuthoredChanges(t *testing.T) {
+	cleanup := setupSyncProtocolTestDB(t)
+	defer cleanup()
+
+	countChanges := func() int {
+		t.Helper()
+		count, err := models.CountUserAuthoredChanges(spTestUserGUID)
+		if err != nil {
+			t.Fatalf("CountUserAuthoredChanges failed: %v", err)
+		}
+		return count
+	}
+
+	_ = createTestNote(t, "authored-local", "Local Note")
+	afterLocal := countChanges()
+	if afterLocal == 0 {
+		t.Fatal("expected a locally created note to count as an authored change")
+	}
+
+	fragment := models.NoteFragment{
+		Bitmask: models.FragmentTitle | models.FragmentBody,
+		Title:   sql.NullString{String: "Synced Note", Valid: true},
+		Body:    sql.NullString{String: "from a peer", Valid: true},
+	}
+	if _, err := models.ApplySyncNoteCreate("authored-synced", "Synced Note", fragment,
+		time.Now(), spTestUserGUID, "peer-a"); err != nil {
+		t.Fatalf("ApplySyncNoteCreate failed: %v", err)
+	}
+	if got := countChanges(); got != afterLocal {
+		t.Errorf("note created via sync changed the authored count from %d to %d", afterLocal, got)
+	}
+
+	// Synced deletes are recorded as OperationDelete with no user, so they
+	// must not count in the all-users total either
+	allBefore, err := models.CountUserAuthoredChanges("")
+	if err != nil {
+		t.Fatalf("CountUserAuthoredChanges failed: %v", err)
+	}
+	if err := models.ApplySyncNoteDelete("authored-synced", "peer-a"); err != nil {
+		t.Fatalf("ApplySyncNoteDelete failed: %v", err)
+	}
+	category := createTestCategory(t, "Authored Category")
+	allWithCategory, err := models.CountUserAuthoredChanges("")
+	if err != nil {
+		t.Fatalf("CountUserAuthoredChanges failed: %v", err)
+	}
+	if err := models.ApplySyncCategoryDelete(category.GUID, "peer-a"); err != nil {
+		t.Fatalf("ApplySyncCategoryDelete failed: %v", err)
+	}
+	allAfter, err := models.CountUserAuthoredChanges("")
+	if err != nil {
+		t.Fatalf("CountUserAuthoredChanges failed: %v", err)
+	}
+	if allWithCategory != allBefore+1 || allAfter != allWithCategory {
+		t.Errorf("synced deletes changed the all-users authored count: %d before, %d with a local category, %d after",
+			allBefore, allWithCategory, allAfter)
+	}
+	afterLocal = countChanges()
+
+	status, err := models.GetSyncStatus(spTestUserGUID)
+	if err != nil {
+		t.Fatalf("GetSyncStatus failed: %v", err)
+	}
+	if status.UserChangeCount != afterLocal {
+		t.Errorf("status user_change_count = %d, want %d", status.UserChangeCount, afterLocal)
+	}
+}
+
+// TestSyncChecksumCoversContent verifies that editing a note's body changes the
+// checksum even though the set of GUIDs is unchanged, and that the checksum
+// depends only on content: restoring the original body restores it.
+func TestSyncChecksumCoversContent(t *testing.T) {
+	cleanup := setupSyncProtocolTestDB(t)
+	defer cleanup()
+
+	note := createTestNote(t, "checksum-note", "Checksum Note")
+	_ = createTestCategory(t, "Checksum Category")
+
+	checksum := func() string {
+		t.Helper()
+		status, err := models.GetSyncStatus("")
+		if err != nil {
+			t.Fatalf("GetSyncStatus failed: %v", err)
+		}
+		return status.Checksum
+	}
+	setBody := func(body string) {
+		t.Helper()
+		_, err := models.UpdateNote(note.ID, models.NoteInput{GUID: note.GUID, Title: note.Title, Body: &body}, spTestUserGUID)
+		if err != nil {
+			t.Fatalf("failed to update note: %v", err)
+		}
+	}
+
+	original := checksum()
+	setBody("an edited body")
+	edited := checksum()
+	if edited == original {
+		t.Error("expected a body edit to change the checksum")
+	}
+
+	setBody(note.Body.String)
+	if got := checksum(); got != original {
+		t.Error("expected restoring the original body to restore the checksum")
+	}
+}
+
+// TestValidateNoteFragment verifies bitmask/field consistency checks on
+// incoming note fragments.
+func TestValidateNoteFragment(t *testing.T) {
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+
+	tests := []struct {
+		name     string
+		fragment models.NoteFragment
+		wantErr  bool
+	}{
+		{"full snapshot", models.NoteFragment{
+			Bitmask: models.FragmentTitle | models.FragmentBody | models.FragmentIsPrivate,
+			Title:   str("t"), Body: str("b"), IsPrivate: sql.NullBool{Valid: true},
+		}, false},
+		{"cleared description", models.NoteFragment{Bitmask: models.FragmentDescription}, false},
+		{"categories only", models.NoteFragment{Bitmask: models.FragmentCategories, Categories: str("[]")}, false},
+		{"empty", models.NoteFragment{}, false},
+		{"title bit without title", models.NoteFragment{Bitmask: models.FragmentTitle}, true},
+		{"is_private bit without value", models.NoteFragment{Bitmask: models.FragmentIsPrivate}, true},
+		{"categories bit without value", models.NoteFragment{Bitmask: models.FragmentCategories}, true},
+		{"body without bit", models.NoteFragment{Bitmask: models.FragmentTitle, Title: str("t"), Body: str("b")}, true},
+		{"tags without bit", models.NoteFragment{Tags: str("x")}, true},
+		{"diff without body", models.NoteFragment{Bitmask: models.FragmentBody, BodyIsDiff: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := models.ValidateNoteFragment(tt.fragment)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateNoteFragment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestGetRecentActivity verifies that the feed interleaves note and category
+// changes newest first and leaves out changes applied from peers.
+func TestGetRecentActivity(t *testing.T) {
+	cleanup := setupSyncProtocolTestDB(t)
+	defer cleanup()
+
+	note := createTestNote(t, "activity-note", "Activity Note")
+	time.Sleep(5 * time.Millisecond)
+	cat := createTestCategory(t, "Activity Category")
+	time.Sleep(5 * time.Millisecond)
+	if _, err := models.UpdateNote(note.ID, models.NoteInput{GUID: note.GUID, Title: "Activity Note v2"}, spTestUserGUID); err != nil {
+		t.Fatalf("failed to update note: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	synced := models.NoteFragment{
+		Bitmask: models.FragmentTitle,
+		Title:   sql.NullString{String: "From a peer", Valid: true},
+	}
+	if _, err := models.ApplySyncNoteCreate("activity-synced", "From a peer", synced,
+		time.Now(), spTestUserGUID, "peer-a"); err != nil {
+		t.Fatalf("ApplySyncNoteCreate failed: %v", err)
+	}
+	if _, err := models.CreateNote(models.NoteInput{GUID: "activity-other", Title: "Not mine"}, "other-user"); err != nil {
+		t.Fatalf("failed to create other user's note: %v", err)
+	}
+
+	items, err := models.GetRecentActivity(spTestUserGUID, 0)
+	if err != nil {
+		t.Fatalf("GetRecentActivity failed: %v", err)
+	}
+
+	want := []struct {
+		entityType, guid string
+		operation        int32
+	}{
+		{"note", note.GUID, models.OperationUpdate},
+		{"category", cat.GUID, models.OperationCreate},
+		{"note", note.GUID, models.OperationCreate},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("expected %d activity items, got %d: %+v", len(want), len(items), items)
+	}
+	for i, w := range want {
+		got := items[i]
+		if got.EntityType != w.entityType || got.EntityGUID != w.guid || got.Operation != w.operation {
+			t.Errorf("item %d = %s %s op %d, want %s %s op %d",
+				i, got.EntityType, got.EntityGUID, got.Operation, w.entityType, w.guid, w.operation)
+		}
+	}
+	if items[0].Title != "Activity Note v2" || items[1].Title != "Activity Category" {
+		t.Errorf("unexpected titles: %q, %q", items[0].Title, items[1].Title)
+	}
+
+	if limited, err := models.GetRecentActivity(spTestUserGUID, 2); err != nil || len(limited) != 2 {
+		t.Errorf("expected 2 items with limit=2, got %d (err %v)", len(limited), err)
+	}
+}
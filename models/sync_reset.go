@@ -0,0 +1,82 @@
+package models
+
+import (
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Peer Sync Reset
+//
+// The hub remembers which changes each peer has already pulled
+// (note_change_sync_peers, category_change_sync_peers), and never returns a
+// change to the peer it came from (origin_peer). A peer whose database was
+// wiped needs everything again, so resetting forgets both for that peer:
+// its delivery records are deleted, and changes it originated are no longer
+// attributed to it, so they're sent back too. The next pulls then replay the
+// user's full change history from the beginning. Only the user's own notes
+// and categories are affected on a multi-user hub.
+// ============================================================================
+
+// SyncResetRequest is the request body for POST /api/v1/sync/reset.
+type SyncResetRequest struct {
+	PeerID string `json:"peer_id"`
+}
+
+// SyncResetResult reports how much sync state ResetPeerSync cleared.
+type SyncResetResult struct {
+	PeerID                string `json:"peer_id"`
+	NoteChangesReset      int64  `json:"note_changes_reset"`      // Delivery records removed for note changes
+	CategoryChangesReset  int64  `json:"category_changes_reset"`  // Delivery records removed for category changes
+	OriginatedChangesSent int64  `json:"originated_changes_sent"` // Changes from the peer that will now be sent back to it
+}
+
+// userNoteChangeIDs and userCategoryChangeIDs select the change-log ids for
+// notes and categories owned by a user.
+const (
+	userNoteChangeIDs = `
+		SELECT nc.id FROM note_changes nc
+		INNER JOIN notes n ON nc.note_guid = n.guid AND n.created_by = ?`
+	userCategoryChangeIDs = `
+		SELECT cc.id FROM category_changes cc
+		INNER JOIN categories c ON cc.category_guid = c.guid AND c.created_by = ?`
+)
+
+// ResetPeerSync clears the record of what peerID has pulled of userGUID's
+// changes, so that its next pulls return the user's complete change history.
+func ResetPeerSync(peerID, userGUID string) (*SyncResetResult, error) {
+	if peerID == "" {
+		return nil, serr.New("peer_id is required")
+	}
+	result := &SyncResetResult{PeerID: peerID}
+
+	res, err := db.Exec(`DELETE FROM note_change_sync_peers
+		WHERE peer_id = ? AND note_change_id IN (`+userNoteChangeIDs+`)`, peerID, userGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to reset note change delivery for peer", "peer_id", peerID)
+	}
+	result.NoteChangesReset, _ = res.RowsAffected()
+
+	res, err = db.Exec(`DELETE FROM category_change_sync_peers
+		WHERE peer_id = ? AND category_change_id IN (`+userCategoryChangeIDs+`)`, peerID, userGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to reset category change delivery for peer", "peer_id", peerID)
+	}
+	result.CategoryChangesReset, _ = res.RowsAffected()
+
+	res, err = db.Exec(`UPDATE note_changes SET origin_peer = NULL
+		WHERE origin_peer = ? AND id IN (`+userNoteChangeIDs+`)`, peerID, userGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to clear note change origin for peer", "peer_id", peerID)
+	}
+	notesOriginated, _ := res.RowsAffected()
+
+	res, err = db.Exec(`UPDATE category_changes SET origin_peer = NULL
+		WHERE origin_peer = ? AND id IN (`+userCategoryChangeIDs+`)`, peerID, userGUID)
+	if err != nil {
+		return nil, serr.Wrap(err, "failed to clear category change origin for peer", "peer_id", peerID)
+	}
+	categoriesOriginated, _ := res.RowsAffected()
+	result.OriginatedChangesSent = notesOriginated + categoriesOriginated
+
+	return result, nil
+}
@@ -13,12 +13,25 @@ const (
 	// TokenExpirationHours defines how long tokens remain valid (7 days)
 	TokenExpirationHours = 24 * 7
 
-	// TokenIssuer identifies the application that issued the token
+	// AccessTokenExpiration is the lifetime of access tokens issued alongside
+	// a refresh token. Kept short because the refresh token can renew it.
+	AccessTokenExpiration = time.Hour
+
+	// TokenIssuer identifies the application that issued the token. It is the
+	// default issuer when JWTIssuerEnvVar is unset.
 	TokenIssuer = "gonotes"
 
 	// JWTSecretEnvVar is the environment variable containing the signing key
 	JWTSecretEnvVar = "GONOTES_JWT_SECRET"
 
+	// JWTTTLEnvVar overrides the lifetime of login tokens, as a Go duration
+	// (e.g. "12h"). Unset means TokenExpirationHours.
+	JWTTTLEnvVar = "GONOTES_JWT_TTL"
+
+	// JWTIssuerEnvVar overrides the issuer claim tokens are minted with and
+	// must carry to be accepted. Unset means TokenIssuer.
+	JWTIssuerEnvVar = "GONOTES_JWT_ISSUER"
+
 	// MinSecretLength is the minimum acceptable length for the JWT secret
 	MinSecretLength = 32
 )
@@ -27,6 +40,12 @@ const (
 // This is set during InitJWT and used for all token operations
 var jwtSecret []byte
 
+// jwtTTL and jwtIssuer are the token lifetime and issuer loaded by InitJWT
+var (
+	jwtTTL    = time.Hour * TokenExpirationHours
+	jwtIssuer = TokenIssuer
+)
+
 // TokenClaims extends JWT standard claims with user-specific data.
 // Using UserGUID instead of ID allows tokens to work across sync scenarios.
 type TokenClaims struct {
@@ -36,9 +55,10 @@ type TokenClaims struct {
 	IsAdmin  bool   `json:"is_admin"`
 }
 
-// InitJWT loads the JWT signing key from environment.
+// InitJWT loads the JWT signing key, token lifetime, and issuer from environment.
 // Must be called at application startup before any token operations.
 // Generates a temporary key in development if not set.
+// Instances configured with different issuers reject each other's tokens.
 func InitJWT() error {
 	secret := os.Getenv(JWTSecretEnvVar)
 
@@ -52,14 +72,43 @@ func InitJWT() error {
 		return serr.New("JWT secret must be at least 32 characters")
 	}
 
+	ttl := time.Hour * TokenExpirationHours
+	if ttlStr := os.Getenv(JWTTTLEnvVar); ttlStr != "" {
+		parsed, err := time.ParseDuration(ttlStr)
+		if err != nil || parsed <= 0 {
+			return serr.New(JWTTTLEnvVar+" must be a positive duration (e.g. 12h)", "value", ttlStr)
+		}
+		ttl = parsed
+	}
+
+	issuer := TokenIssuer
+	if issuerStr := os.Getenv(JWTIssuerEnvVar); issuerStr != "" {
+		issuer = issuerStr
+	}
+
 	jwtSecret = []byte(secret)
+	jwtTTL = ttl
+	jwtIssuer = issuer
 	return nil
 }
 
 // GenerateToken creates a signed JWT for the authenticated user.
-// The token includes the user's GUID and username in the claims.
+// The token includes the user's GUID and username in the claims, and is
+// valid for the configured TTL (see JWTTTLEnvVar).
 // Returns the signed token string or an error.
 func GenerateToken(user *User) (string, error) {
+	return generateTokenWithExpiry(user, jwtTTL)
+}
+
+// GenerateAccessToken creates a short-lived JWT for clients that hold a
+// refresh token and can renew it via POST /api/v1/auth/refresh. It lasts
+// AccessTokenExpiration, or the configured TTL if that is shorter.
+func GenerateAccessToken(user *User) (string, error) {
+	return generateTokenWithExpiry(user, min(AccessTokenExpiration, jwtTTL))
+}
+
+// generateTokenWithExpiry signs a JWT for the user valid for the given duration.
+func generateTokenWithExpiry(user *User, expiresIn time.Duration) (string, error) {
 	if len(jwtSecret) == 0 {
 		return "", serr.New("JWT not initialized - call InitJWT first")
 	}
@@ -67,9 +116,9 @@ func GenerateToken(user *User) (string, error) {
 	// Create claims with user information and expiration
 	claims := TokenClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    TokenIssuer,
+			Issuer:    jwtIssuer,
 			Subject:   user.GUID,
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * TokenExpirationHours)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
@@ -92,7 +141,8 @@ func GenerateToken(user *User) (string, error) {
 
 // ValidateToken parses and validates a JWT token string.
 // Returns the claims if valid, or an error if the token is
-// expired, malformed, or has an invalid signature.
+// expired, malformed, has an invalid signature, or was issued
+// for a different issuer.
 func ValidateToken(tokenString string) (*TokenClaims, error) {
 	if len(jwtSecret) == 0 {
 		return nil, serr.New("JWT not initialized - call InitJWT first")
@@ -105,7 +155,7 @@ func ValidateToken(tokenString string) (*TokenClaims, error) {
 			return nil, serr.New("unexpected signing method")
 		}
 		return jwtSecret, nil
-	})
+	}, jwt.WithIssuer(jwtIssuer))
 
 	if err != nil {
 		return nil, serr.Wrap(err, "failed to parse token")
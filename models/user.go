@@ -2,10 +2,18 @@ package models
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/rohanthewiz/logger"
 	"github.com/rohanthewiz/serr"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -114,12 +122,29 @@ func (u *User) ToOutput() UserOutput {
 
 // Password hashing configuration
 // Cost of 12 provides good security while keeping login times reasonable (~250ms)
-const bcryptCost = 12
+const DefaultBcryptCost = 12
+
+// BcryptCostEnvVar overrides DefaultBcryptCost, e.g. to lower it on slow
+// hardware or raise it as hardware gets faster.
+const BcryptCostEnvVar = "GONOTES_BCRYPT_COST"
+
+// BcryptCost returns the configured bcrypt cost. Values outside bcrypt's
+// supported range fall back to DefaultBcryptCost.
+func BcryptCost() int {
+	if costStr := os.Getenv(BcryptCostEnvVar); costStr != "" {
+		cost, err := strconv.Atoi(costStr)
+		if err == nil && cost >= bcrypt.MinCost && cost <= bcrypt.MaxCost {
+			return cost
+		}
+		logger.Warn("Ignoring invalid "+BcryptCostEnvVar, "value", costStr)
+	}
+	return DefaultBcryptCost
+}
 
 // HashPassword creates a bcrypt hash of the plaintext password.
 // Returns the hash string or an error if hashing fails.
 func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost())
 	if err != nil {
 		return "", serr.Wrap(err, "failed to hash password")
 	}
@@ -133,12 +158,58 @@ func CheckPassword(password, hash string) bool {
 	return err == nil
 }
 
-// ValidatePassword checks if a password meets security requirements.
-// Currently requires minimum 8 characters.
-// Returns an error describing the issue, nil if valid.
+// passwordPolicy holds the rules ValidatePassword enforces; see SetPasswordPolicy.
+var passwordPolicy = struct {
+	sync.RWMutex
+	minLen       int
+	requireMixed bool
+}{minLen: 8}
+
+// SetPasswordPolicy sets the rules new passwords must meet: at least minLen
+// characters and, if requireMixed is set, at least one uppercase letter, one
+// lowercase letter, and one digit. The default is 8 characters, not mixed.
+func SetPasswordPolicy(minLen int, requireMixed bool) {
+	passwordPolicy.Lock()
+	defer passwordPolicy.Unlock()
+	passwordPolicy.minLen = minLen
+	passwordPolicy.requireMixed = requireMixed
+}
+
+// PasswordPolicyError is returned when a password doesn't meet the policy.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Reason
+}
+
+// ValidatePassword checks if a password meets the policy set by SetPasswordPolicy.
+// Returns a *PasswordPolicyError describing the issue, nil if valid.
 func ValidatePassword(password string) error {
-	if len(password) < 8 {
-		return serr.New("password must be at least 8 characters")
+	passwordPolicy.RLock()
+	minLen, requireMixed := passwordPolicy.minLen, passwordPolicy.requireMixed
+	passwordPolicy.RUnlock()
+
+	if utf8.RuneCountInString(password) < minLen {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("password must be at least %d characters", minLen)}
+	}
+
+	if requireMixed {
+		var hasUpper, hasLower, hasDigit bool
+		for _, c := range password {
+			switch {
+			case unicode.IsUpper(c):
+				hasUpper = true
+			case unicode.IsLower(c):
+				hasLower = true
+			case unicode.IsDigit(c):
+				hasDigit = true
+			}
+		}
+		if !hasUpper || !hasLower || !hasDigit {
+			return &PasswordPolicyError{Reason: "password must contain an uppercase letter, a lowercase letter, and a digit"}
+		}
 	}
 	return nil
 }
@@ -354,6 +425,38 @@ func AuthenticateUser(input UserLoginInput) (*User, error) {
 	return user, nil
 }
 
+// ErrIncorrectPassword is returned by ChangePassword when the current
+// password doesn't match.
+var ErrIncorrectPassword = errors.New("current password is incorrect")
+
+// ChangePassword replaces the user's password after verifying oldPassword.
+// The new password must meet the password policy.
+func ChangePassword(userGUID, oldPassword, newPassword string) error {
+	user, err := GetUserByGUID(userGUID)
+	if err != nil {
+		return err
+	}
+	if user == nil || !CheckPassword(oldPassword, user.PasswordHash) {
+		return ErrIncorrectPassword
+	}
+
+	if err := ValidatePassword(newPassword); err != nil {
+		return err
+	}
+
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`UPDATE users SET password_hash = ?, updated_at = CURRENT_TIMESTAMP WHERE guid = ?`,
+		hash, userGUID)
+	if err != nil {
+		return serr.Wrap(err, "failed to update password")
+	}
+	return nil
+}
+
 // IsFirstUser checks if there are any users in the database.
 // Used to determine if we should migrate orphaned notes.
 func IsFirstUser() (bool, error) {
@@ -381,6 +484,7 @@ func MigrateOrphanedCategories(userGUID string) (int, error) {
 	if cacheErr != nil {
 		// Log but don't fail - disk is source of truth
 	}
+	markSyncChecksumStale() // Owners changed in bulk
 
 	count, _ := result.RowsAffected()
 	return int(count), nil
@@ -407,7 +511,34 @@ func MigrateOrphanedNotes(userGUID string) (int, error) {
 		// Log but don't fail - disk is source of truth
 		// logger.LogErr(cacheErr, "cache update failed for orphaned notes migration")
 	}
+	markSyncChecksumStale() // Owners changed in bulk
 
 	count, _ := result.RowsAffected()
 	return int(count), nil
 }
+
+// usernames caches user GUID -> username for attributing notes in output.
+// Usernames can't be changed once registered, so entries never go stale.
+// GUIDs that aren't local users are cached as "" too: new users get fresh
+// GUIDs, so a GUID not found now won't be registered later.
+var usernames sync.Map
+
+// usernameForGUID resolves a user GUID to a username for display.
+// Returns "" if the GUID isn't a local user (e.g. an author known only to a
+// remote peer) or the lookup fails.
+func usernameForGUID(guid string) string {
+	if guid == "" || db == nil {
+		return ""
+	}
+	if name, ok := usernames.Load(guid); ok {
+		return name.(string)
+	}
+
+	var username string
+	err := db.QueryRow(`SELECT username FROM users WHERE guid = ?`, guid).Scan(&username)
+	if err != nil && err != sql.ErrNoRows {
+		return "" // Not cached, so the next call retries
+	}
+	usernames.Store(guid, username)
+	return username
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 // TestValidateUsername tests username validation rules.
@@ -61,6 +62,54 @@ func TestValidatePassword(t *testing.T) {
 	}
 }
 
+// TestPasswordPolicy tests that SetPasswordPolicy changes what ValidatePassword accepts.
+func TestPasswordPolicy(t *testing.T) {
+	SetPasswordPolicy(12, true)
+	defer SetPasswordPolicy(8, false)
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  string
+	}{
+		{"meets policy", "Correct1Horse", ""},
+		{"too short", "Short1a", "password must be at least 12 characters"},
+		{"no uppercase", "correct1horse", "password must contain an uppercase letter, a lowercase letter, and a digit"},
+		{"no digit", "CorrectHorseBattery", "password must contain an uppercase letter, a lowercase letter, and a digit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePassword(tt.password)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.wantErr {
+				t.Errorf("ValidatePassword(%q) error = %q, want %q", tt.password, got, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestBcryptCost tests that the bcrypt cost can be set from the environment.
+func TestBcryptCost(t *testing.T) {
+	t.Setenv(BcryptCostEnvVar, "")
+	if got := BcryptCost(); got != DefaultBcryptCost {
+		t.Errorf("BcryptCost() = %d, want default %d", got, DefaultBcryptCost)
+	}
+
+	t.Setenv(BcryptCostEnvVar, "10")
+	if got := BcryptCost(); got != 10 {
+		t.Errorf("BcryptCost() = %d, want 10", got)
+	}
+
+	t.Setenv(BcryptCostEnvVar, "99")
+	if got := BcryptCost(); got != DefaultBcryptCost {
+		t.Errorf("BcryptCost() with out-of-range value = %d, want default %d", got, DefaultBcryptCost)
+	}
+}
+
 // TestHashAndCheckPassword tests the bcrypt hash/check round-trip.
 func TestHashAndCheckPassword(t *testing.T) {
 	password := "my_secure_password_123"
@@ -219,3 +268,85 @@ func TestGetTokenExpiration(t *testing.T) {
 		t.Error("GetTokenExpiration() returned zero time")
 	}
 }
+
+// TestJWTIssuerAndTTL verifies that a configured TTL sets the token's exp and
+// that an instance configured for another issuer rejects the token.
+func TestJWTIssuerAndTTL(t *testing.T) {
+	// Registered first so it runs after the environment is restored
+	t.Cleanup(func() { InitJWT() })
+	t.Setenv(JWTSecretEnvVar, "test-secret-key-for-jwt-testing-minimum-32-chars")
+	t.Setenv(JWTTTLEnvVar, "90m")
+	t.Setenv(JWTIssuerEnvVar, "gonotes-a")
+
+	if err := InitJWT(); err != nil {
+		t.Fatalf("InitJWT() unexpected error: %v", err)
+	}
+
+	user := &User{ID: 1, GUID: "issuer-test-guid", Username: "issueruser"}
+	before := time.Now()
+	tokenString, err := GenerateToken(user)
+	if err != nil {
+		t.Fatalf("GenerateToken() error: %v", err)
+	}
+
+	claims, err := ValidateToken(tokenString)
+	if err != nil {
+		t.Fatalf("ValidateToken() unexpected error: %v", err)
+	}
+	if claims.Issuer != "gonotes-a" {
+		t.Errorf("claims.Issuer = %q, want %q", claims.Issuer, "gonotes-a")
+	}
+	ttl := claims.ExpiresAt.Time.Sub(before)
+	if ttl < 89*time.Minute || ttl > 91*time.Minute {
+		t.Errorf("token lifetime = %v, want about 90m", ttl)
+	}
+
+	// Same secret, different issuer: the token must be rejected
+	t.Setenv(JWTIssuerEnvVar, "gonotes-b")
+	if err := InitJWT(); err != nil {
+		t.Fatalf("InitJWT() unexpected error: %v", err)
+	}
+	if _, err := ValidateToken(tokenString); err == nil {
+		t.Error("ValidateToken() accepted a token minted for another issuer")
+	}
+
+	for _, invalid := range []string{"forever", "0s", "-1h"} {
+		t.Setenv(JWTTTLEnvVar, invalid)
+		if err := InitJWT(); err == nil {
+			t.Errorf("InitJWT() accepted invalid %s %q", JWTTTLEnvVar, invalid)
+		}
+	}
+}
+
+// TestUsernameForGUIDCachesMisses verifies that a GUID that isn't a local
+// user is looked up once and then answered from the cache.
+func TestUsernameForGUIDCachesMisses(t *testing.T) {
+	cleanup := setupSyncClientTestDB(t)
+	defer cleanup()
+
+	user, err := CreateUser(UserRegisterInput{Username: "cacheduser", Password: "testpassword123"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	defer usernames.Delete(user.GUID)
+	if got := usernameForGUID(user.GUID); got != "cacheduser" {
+		t.Errorf("expected cacheduser, got %q", got)
+	}
+
+	const remoteGUID = "remote-author-guid"
+	defer usernames.Delete(remoteGUID)
+	if got := usernameForGUID(remoteGUID); got != "" {
+		t.Fatalf("expected no username for a remote author, got %q", got)
+	}
+	if name, ok := usernames.Load(remoteGUID); !ok || name != "" {
+		t.Fatalf("expected the miss to be cached, got %v (cached %v)", name, ok)
+	}
+
+	// A row appearing behind the cache's back isn't seen: no second query ran
+	if _, err := db.Exec(`INSERT INTO users (guid, username, password_hash) VALUES (?, 'lateuser', 'x')`, remoteGUID); err != nil {
+		t.Fatalf("failed to insert user: %v", err)
+	}
+	if got := usernameForGUID(remoteGUID); got != "" {
+		t.Errorf("expected the cached miss to be returned, got %q", got)
+	}
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// Build Info
+//
+// The version, commit, and build time are injected at build time:
+//
+//	go build -ldflags "-X gonotes/models.Version=1.4.0 \
+//	    -X gonotes/models.GitCommit=$(git rev-parse --short HEAD) \
+//	    -X gonotes/models.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Unset values read "dev". GET /api/v1/version reports them, so a deployment
+// can be verified and peers can compare versions: a spoke compares the hub's
+// major version to its own before each sync cycle (see checkHubVersion).
+// ============================================================================
+
+// Set via -ldflags -X at build time
+var (
+	Version   = "dev"
+	GitCommit = "dev"
+	BuildTime = "dev"
+)
+
+// BuildInfo is the response body for GET /api/v1/version.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildTime string `json:"build_time"`
+}
+
+// GetBuildInfo returns this binary's build info.
+func GetBuildInfo() BuildInfo {
+	return BuildInfo{Version: Version, GitCommit: GitCommit, BuildTime: BuildTime}
+}
+
+// MajorVersion returns the major component of a semantic version such as
+// "1.4.0" or "v2.0.1-rc1", or "" when v isn't one (e.g. "dev").
+func MajorVersion(v string) string {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	major, _, _ := strings.Cut(v, ".")
+	if _, err := strconv.ParseUint(major, 10, 64); err != nil {
+		return ""
+	}
+	return major
+}
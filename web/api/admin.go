@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -25,12 +26,12 @@ import (
 func CreateInviteToken(ctx rweb.Context) error {
 	// Admin authorization check
 	if !IsAdmin(ctx) {
-		return writeError(ctx, http.StatusForbidden, "admin access required")
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "admin access required")
 	}
 
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	// Parse optional expiry duration from request body
@@ -41,7 +42,7 @@ func CreateInviteToken(ctx rweb.Context) error {
 	body := ctx.Request().Body()
 	if len(body) > 0 {
 		if err := json.Unmarshal(body, &req); err != nil {
-			return writeError(ctx, http.StatusBadRequest, "invalid request body")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid request body")
 		}
 	}
 
@@ -54,7 +55,7 @@ func CreateInviteToken(ctx rweb.Context) error {
 	token, err := models.CreateInviteToken(userGUID, expiresIn)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to create invite token"), "admin", userGUID)
-		return writeError(ctx, http.StatusInternalServerError, "failed to create invite token")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to create invite token")
 	}
 
 	logger.Info("Invite token created", "admin", userGUID, "expires_at", token.ExpiresAt)
@@ -67,19 +68,151 @@ func CreateInviteToken(ctx rweb.Context) error {
 func ListInviteTokens(ctx rweb.Context) error {
 	// Admin authorization check
 	if !IsAdmin(ctx) {
-		return writeError(ctx, http.StatusForbidden, "admin access required")
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "admin access required")
 	}
 
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	tokens, err := models.ListInviteTokens(userGUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to list invite tokens"), "admin", userGUID)
-		return writeError(ctx, http.StatusInternalServerError, "failed to list invite tokens")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to list invite tokens")
 	}
 
 	return writeSuccess(ctx, http.StatusOK, tokens)
 }
+
+// RotateEncryptionKey handles POST /api/v1/admin/encryption/rotate
+// Admin-only endpoint that re-encrypts all private note bodies under a new
+// key and switches the running server to it. GONOTES_ENCRYPTION_KEY must be
+// updated to the new key before the next restart.
+//
+// Request body:
+//
+//	{ "old_key": "<current 32-char key>", "new_key": "<new 32-char key>" }
+func RotateEncryptionKey(ctx rweb.Context) error {
+	if !IsAdmin(ctx) {
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "admin access required")
+	}
+	if !models.IsEncryptionEnabled() {
+		return writeError(ctx, http.StatusConflict, ErrCodeConflict, "encryption is not enabled")
+	}
+
+	var req struct {
+		OldKey string `json:"old_key"`
+		NewKey string `json:"new_key"`
+	}
+	if err := json.Unmarshal(ctx.Request().Body(), &req); err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid request body")
+	}
+
+	count, err := models.RotateEncryptionKey([]byte(req.OldKey), []byte(req.NewKey))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidEncryptionKey) {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation,
+				"old_key and new_key must be different 32-character keys")
+		}
+		if errors.Is(err, models.ErrEncryptionKeyMismatch) {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, err.Error())
+		}
+		logger.LogErr(err, "encryption key rotation", "admin", GetCurrentUserGUID(ctx))
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to rotate encryption key")
+	}
+
+	logger.Info("Encryption key rotated", "admin", GetCurrentUserGUID(ctx), "notes", count)
+	return writeSuccess(ctx, http.StatusOK, map[string]int{"notes_reencrypted": count})
+}
+
+// consistencyReport is the response body of the consistency endpoints.
+type consistencyReport struct {
+	Counts      *models.ConsistencyCounts `json:"counts"`
+	Divergences []models.Divergence       `json:"divergences"`
+	Repaired    *int                      `json:"repaired,omitempty"` // Set by the repair endpoint
+}
+
+// CheckConsistency handles GET /api/v1/admin/consistency
+// Admin-only diagnostic that compares the disk database with the in-memory
+// cache: the note and category row counts of each, and the notes and
+// categories that are missing from one side or whose id or updated_at differ.
+func CheckConsistency(ctx rweb.Context) error {
+	if !IsAdmin(ctx) {
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "admin access required")
+	}
+
+	report, err := buildConsistencyReport()
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to compare disk and cache"), "consistency check")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to check consistency")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, report)
+}
+
+// RepairConsistency handles POST /api/v1/admin/consistency/repair
+// Admin-only endpoint that re-copies the divergent notes and categories from
+// disk into the cache. Returns the divergences found and repaired, with the
+// row counts after the repair.
+func RepairConsistency(ctx rweb.Context) error {
+	if !IsAdmin(ctx) {
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "admin access required")
+	}
+
+	divergences, err := models.CompareDiskAndCache()
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to compare disk and cache"), "consistency repair")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to check consistency")
+	}
+
+	repaired, err := models.RepairCacheDivergences(divergences)
+	if err != nil {
+		logger.LogErr(err, "consistency repair", "repaired", repaired)
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to repair cache")
+	}
+
+	counts, err := models.GetConsistencyCounts()
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to count rows"), "consistency repair")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to check consistency")
+	}
+
+	logger.Info("Cache consistency repaired", "admin", GetCurrentUserGUID(ctx), "repaired", repaired)
+	return writeSuccess(ctx, http.StatusOK, consistencyReport{
+		Counts:      counts,
+		Divergences: divergences,
+		Repaired:    &repaired,
+	})
+}
+
+// GetAdminStats handles GET /api/v1/admin/stats
+// Admin-only overview of the database across all users: note, category,
+// link, and change counts, the changes each registered peer has yet to pull,
+// and the database file sizes.
+func GetAdminStats(ctx rweb.Context) error {
+	if !IsAdmin(ctx) {
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "admin access required")
+	}
+
+	stats, err := models.GetAdminStats()
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to gather admin stats"), "admin stats")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to get stats")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, stats)
+}
+
+// buildConsistencyReport gathers the row counts and divergences.
+func buildConsistencyReport() (*consistencyReport, error) {
+	counts, err := models.GetConsistencyCounts()
+	if err != nil {
+		return nil, err
+	}
+	divergences, err := models.CompareDiskAndCache()
+	if err != nil {
+		return nil, err
+	}
+	return &consistencyReport{Counts: counts, Divergences: divergences}, nil
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"gonotes/models"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/rweb"
+	"github.com/rohanthewiz/serr"
+)
+
+// CreateAPIKey handles POST /api/v1/auth/api-keys
+// Generates a new API key for the authenticated user. The plaintext key is
+// returned only in this response — it is stored hashed and cannot be shown again.
+//
+// Request body (optional):
+//
+//	{ "label": "backup script" }
+//
+// Success (201):
+//
+//	{ "success": true, "data": { "key": "gnk_...", "label": "backup script" } }
+func CreateAPIKey(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	var req struct {
+		Label string `json:"label"`
+	}
+
+	body := ctx.Request().Body()
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid request body")
+		}
+	}
+
+	key, err := models.CreateAPIKey(userGUID, req.Label)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to create API key"), "user_guid", userGUID)
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to create API key")
+	}
+
+	logger.Info("API key created", "user", userGUID, "label", req.Label)
+	return writeSuccess(ctx, http.StatusCreated, map[string]string{
+		"key":   key,
+		"label": req.Label,
+	})
+}
+
+// ListAPIKeys handles GET /api/v1/auth/api-keys
+// Returns the authenticated user's API keys without their secrets.
+func ListAPIKeys(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	keys, err := models.ListAPIKeys(userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to list API keys"), "user_guid", userGUID)
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to list API keys")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, keys)
+}
+
+// RevokeAPIKey handles DELETE /api/v1/auth/api-keys/:id
+// Revokes one of the authenticated user's API keys. Requests using a
+// revoked key are treated as unauthenticated.
+func RevokeAPIKey(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	id, err := strconv.ParseInt(ctx.Request().Param("id"), 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid API key id")
+	}
+
+	revoked, err := models.RevokeAPIKey(id, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to revoke API key"), "user_guid", userGUID)
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to revoke API key")
+	}
+	if !revoked {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "API key not found")
+	}
+
+	logger.Info("API key revoked", "id", id, "user", userGUID)
+	return writeSuccess(ctx, http.StatusOK, map[string]interface{}{"revoked": true, "id": id})
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gonotes/models"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/rweb"
+	"github.com/rohanthewiz/serr"
+)
+
+// ============================================================================
+// Attachment API Handlers
+//
+// Files are uploaded as multipart/form-data with the file in the "file" field.
+// All attachment operations are scoped to the authenticated user.
+// ============================================================================
+
+// UploadAttachment handles POST /api/v1/notes/:id/attachments
+// Stores the uploaded file against the note. Returns 413 if the file exceeds
+// the configured maximum size (GONOTES_MAX_ATTACHMENT_SIZE).
+func UploadAttachment(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	noteID, err := strconv.ParseInt(ctx.Request().Param("id"), 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
+	}
+
+	file, header, err := ctx.Request().GetFormFile("file")
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "multipart form with a 'file' field is required")
+	}
+	defer file.Close()
+
+	// Reject early on the declared size; AddAttachment enforces the limit on
+	// the bytes actually read as well
+	if header.Size > models.MaxAttachmentSize() {
+		return writeError(ctx, http.StatusRequestEntityTooLarge, ErrCodeTooLarge, models.ErrAttachmentTooLarge.Error())
+	}
+
+	meta := models.AttachmentMeta{
+		Filename:    header.Filename,
+		ContentType: header.Header.Get("Content-Type"),
+		UserGUID:    userGUID,
+	}
+
+	att, err := models.AddAttachment(noteID, meta, file)
+	if err == models.ErrAttachmentTooLarge {
+		return writeError(ctx, http.StatusRequestEntityTooLarge, ErrCodeTooLarge, err.Error())
+	}
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to add attachment"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to store attachment")
+	}
+	if att == nil {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
+	}
+
+	logger.Info("Attachment uploaded", "id", att.ID, "note_id", noteID, "size", att.Size, "user", userGUID)
+	return writeSuccess(ctx, http.StatusCreated, att)
+}
+
+// ListNoteAttachments handles GET /api/v1/notes/:id/attachments
+// Returns attachment metadata for the note (no file contents).
+func ListNoteAttachments(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	noteID, err := strconv.ParseInt(ctx.Request().Param("id"), 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
+	}
+
+	attachments, err := models.ListAttachments(noteID, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to list attachments"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, attachments)
+}
+
+// DownloadAttachment handles GET /api/v1/attachments/:id
+// Returns the raw file bytes with the stored content type.
+func DownloadAttachment(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	id, err := strconv.ParseInt(ctx.Request().Param("id"), 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid attachment id")
+	}
+
+	att, data, err := models.GetAttachment(id, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get attachment"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+	if att == nil {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "attachment not found")
+	}
+
+	ctx.Response().SetHeader("Content-Type", att.ContentType)
+	ctx.Response().SetHeader("Content-Disposition", fmt.Sprintf(`inline; filename=%q`, att.Filename))
+	ctx.SetStatus(http.StatusOK)
+	return ctx.Bytes(data)
+}
+
+// DeleteAttachment handles DELETE /api/v1/attachments/:id
+// Permanently removes the attachment.
+func DeleteAttachment(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	id, err := strconv.ParseInt(ctx.Request().Param("id"), 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid attachment id")
+	}
+
+	deleted, err := models.DeleteAttachment(id, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to delete attachment"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to delete attachment")
+	}
+	if !deleted {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "attachment not found")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, map[string]interface{}{"deleted": true, "id": id})
+}
@@ -0,0 +1,138 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"gonotes/models"
+)
+
+// uploadAttachment posts content as a multipart file upload to the note.
+func (ts *testServer) uploadAttachment(t *testing.T, noteID float64, filename string, content []byte) (int, map[string]interface{}) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("failed to create form file: %v", err)
+	}
+	part.Write(content)
+	mw.Close()
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/notes/%.0f/attachments", ts.baseURL, noteID), &buf)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+ts.authToken)
+
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		t.Fatalf("upload request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func TestAttachmentsAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid":  "attachment-note-001",
+		"title": "Note With Attachment",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d", status)
+	}
+	noteID := resp["data"].(map[string]interface{})["id"].(float64)
+
+	// Include bytes that would be mangled by any text handling
+	content := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0x00, 0xff, 0x7f}, 100)...)
+	var attachmentID float64
+
+	t.Run("Upload", func(t *testing.T) {
+		status, resp := ts.uploadAttachment(t, noteID, "pasted.png", content)
+		if status != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %v", http.StatusCreated, status, resp)
+		}
+		data := resp["data"].(map[string]interface{})
+		if data["filename"] != "pasted.png" {
+			t.Errorf("expected filename 'pasted.png', got %v", data["filename"])
+		}
+		if data["size"] != float64(len(content)) {
+			t.Errorf("expected size %d, got %v", len(content), data["size"])
+		}
+		attachmentID = data["id"].(float64)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		status, resp := ts.request("GET", fmt.Sprintf("/api/v1/notes/%.0f/attachments", noteID), nil)
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+		}
+		data, ok := resp["data"].([]interface{})
+		if !ok || len(data) != 1 {
+			t.Fatalf("expected 1 attachment, got %v", resp["data"])
+		}
+	})
+
+	t.Run("Download", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/attachments/%.0f", ts.baseURL, attachmentID), nil)
+		req.Header.Set("Authorization", "Bearer "+ts.authToken)
+		resp, err := ts.client.Do(req)
+		if err != nil {
+			t.Fatalf("download request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		if !bytes.Equal(got, content) {
+			t.Errorf("downloaded bytes differ from upload: got %d bytes, want %d", len(got), len(content))
+		}
+	})
+
+	t.Run("Oversized", func(t *testing.T) {
+		t.Setenv(models.MaxAttachmentSizeEnvVar, "64")
+
+		status, _ := ts.uploadAttachment(t, noteID, "big.bin", bytes.Repeat([]byte("x"), 65))
+		if status != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status %d, got %d", http.StatusRequestEntityTooLarge, status)
+		}
+	})
+
+	t.Run("UploadToMissingNote", func(t *testing.T) {
+		status, _ := ts.uploadAttachment(t, 99999, "orphan.txt", []byte("hi"))
+		if status != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		status, _ := ts.request("DELETE", fmt.Sprintf("/api/v1/attachments/%.0f", attachmentID), nil)
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+		}
+
+		status, _ = ts.request("GET", fmt.Sprintf("/api/v1/attachments/%.0f", attachmentID), nil)
+		if status != http.StatusNotFound {
+			t.Errorf("expected deleted attachment to be gone, got %d", status)
+		}
+	})
+}
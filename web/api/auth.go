@@ -2,9 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"gonotes/models"
 
@@ -13,10 +16,12 @@ import (
 	"github.com/rohanthewiz/serr"
 )
 
-// AuthResponse contains the user and token returned on successful authentication
+// AuthResponse contains the user and token returned on successful authentication.
+// RefreshToken is only set when the client asked for one at login.
 type AuthResponse struct {
-	User  models.UserOutput `json:"user"`
-	Token string            `json:"token"`
+	User         models.UserOutput `json:"user"`
+	Token        string            `json:"token"`
+	RefreshToken string            `json:"refresh_token,omitempty"`
 }
 
 // Register creates a new user account and returns a JWT token.
@@ -50,16 +55,16 @@ func Register(ctx rweb.Context) error {
 		InviteToken        string `json:"invite_token"`
 	}
 	if err := json.Unmarshal(ctx.Request().Body(), &rawBody); err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid request body")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid request body")
 	}
 	input := rawBody.UserRegisterInput
 
 	// Validate required fields
 	if input.Username == "" {
-		return writeError(ctx, http.StatusBadRequest, "username is required")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "username is required")
 	}
 	if input.Password == "" {
-		return writeError(ctx, http.StatusBadRequest, "password is required")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "password is required")
 	}
 
 	// Check if this is the first user (for orphaned notes migration and free registration)
@@ -75,14 +80,14 @@ func Register(ctx rweb.Context) error {
 		if rawBody.InviteToken != "" {
 			// Validate the invite token before proceeding with registration
 			if _, err := models.ValidateInviteToken(rawBody.InviteToken); err != nil {
-				return writeError(ctx, http.StatusForbidden, err.Error())
+				return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, err.Error())
 			}
 		} else if requiredSecret := os.Getenv("GONOTES_REGISTRATION_SECRET"); requiredSecret != "" {
 			if rawBody.RegistrationSecret != requiredSecret {
-				return writeError(ctx, http.StatusForbidden, "invalid registration secret")
+				return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "invalid registration secret")
 			}
 		} else {
-			return writeError(ctx, http.StatusForbidden, "registration requires an invite token")
+			return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "registration requires an invite token")
 		}
 	}
 
@@ -92,14 +97,15 @@ func Register(ctx rweb.Context) error {
 		errMsg := err.Error()
 		// Check for duplicate username/email
 		if strings.Contains(errMsg, "already exists") {
-			return writeError(ctx, http.StatusConflict, errMsg)
+			return writeError(ctx, http.StatusConflict, ErrCodeConflict, errMsg)
 		}
 		// Check for validation errors
-		if strings.Contains(errMsg, "must be") || strings.Contains(errMsg, "can only") {
-			return writeError(ctx, http.StatusBadRequest, errMsg)
+		var policyErr *models.PasswordPolicyError
+		if errors.As(err, &policyErr) || strings.Contains(errMsg, "must be") || strings.Contains(errMsg, "can only") {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, errMsg)
 		}
 		logger.LogErr(serr.Wrap(err, "failed to create user"), "username", input.Username)
-		return writeError(ctx, http.StatusInternalServerError, "failed to create user")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to create user")
 	}
 
 	// Redeem invite token after successful user creation (single-use enforcement)
@@ -132,7 +138,7 @@ func Register(ctx rweb.Context) error {
 	token, err := models.GenerateToken(user)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to generate token"), "user_id", user.ID)
-		return writeError(ctx, http.StatusInternalServerError, "failed to generate token")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to generate token")
 	}
 
 	// Return success with user and token
@@ -151,65 +157,119 @@ func Register(ctx rweb.Context) error {
 //
 //	{
 //	  "username": "johndoe",
-//	  "password": "SecurePass123!"
+//	  "password": "SecurePass123!",
+//	  "refresh": true                   // optional
 //	}
 //
+// When "refresh" is true the response also carries a refresh_token and the
+// access token is short-lived (see models.AccessTokenExpiration). Otherwise a
+// standard long-lived token is issued, as the browser UI expects.
+//
 // Success (200):
 //
-//	{ "success": true, "data": { "user": {...}, "token": "..." } }
+//	{ "success": true, "data": { "user": {...}, "token": "...", "refresh_token": "..." } }
 //
 // Errors:
 //   - 400: Missing username or password
 //   - 401: Invalid credentials
 //   - 403: Account is disabled
+//   - 429: Too many failed attempts for this username; see Retry-After
 func Login(ctx rweb.Context) error {
-	var input models.UserLoginInput
-	if err := json.Unmarshal(ctx.Request().Body(), &input); err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid request body")
+	var rawBody struct {
+		models.UserLoginInput
+		Refresh bool `json:"refresh"`
 	}
+	if err := json.Unmarshal(ctx.Request().Body(), &rawBody); err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid request body")
+	}
+	input := rawBody.UserLoginInput
 
 	// Validate required fields
 	if input.Username == "" {
-		return writeError(ctx, http.StatusBadRequest, "username is required")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "username is required")
 	}
 	if input.Password == "" {
-		return writeError(ctx, http.StatusBadRequest, "password is required")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "password is required")
+	}
+
+	// A locked-out username is refused without checking the password. The
+	// attempt is counted before the slow check, so concurrent guesses can't
+	// all get past a lockout
+	attempt, lockedFor := models.ReserveLoginAttempt(input.Username)
+	if lockedFor > 0 {
+		return writeLockedOut(ctx, lockedFor)
 	}
 
 	// Authenticate user
 	user, err := models.AuthenticateUser(input)
 	if err != nil {
+		attempt.Cancel()
 		errMsg := err.Error()
 		// Check for disabled account
 		if strings.Contains(errMsg, "disabled") {
-			return writeError(ctx, http.StatusForbidden, "account is disabled")
+			return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "account is disabled")
 		}
 		logger.LogErr(serr.Wrap(err, "authentication error"), "username", input.Username)
-		return writeError(ctx, http.StatusInternalServerError, "authentication error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "authentication error")
 	}
 
 	if user == nil {
+		// Failures count against unknown usernames too, so lockouts don't
+		// reveal which accounts exist
+		if lockedFor := attempt.Failed(); lockedFor > 0 {
+			return writeLockedOut(ctx, lockedFor)
+		}
 		// Invalid credentials - don't reveal whether username exists
-		return writeError(ctx, http.StatusUnauthorized, "invalid credentials")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "invalid credentials")
 	}
+	attempt.Succeeded()
 
-	// Generate JWT token
-	token, err := models.GenerateToken(user)
-	if err != nil {
-		logger.LogErr(serr.Wrap(err, "failed to generate token"), "user_id", user.ID)
-		return writeError(ctx, http.StatusInternalServerError, "failed to generate token")
-	}
+	response := AuthResponse{User: user.ToOutput()}
 
-	// Return success with user and token
-	response := AuthResponse{
-		User:  user.ToOutput(),
-		Token: token,
+	if rawBody.Refresh {
+		// Token pair: short-lived access token renewable via the refresh token
+		response.Token, err = models.GenerateAccessToken(user)
+		if err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to generate access token"), "user_id", user.ID)
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to generate token")
+		}
+
+		response.RefreshToken, err = models.CreateRefreshToken(user.GUID)
+		if err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to create refresh token"), "user_id", user.ID)
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to generate token")
+		}
+	} else {
+		// Generate JWT token
+		response.Token, err = models.GenerateToken(user)
+		if err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to generate token"), "user_id", user.ID)
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to generate token")
+		}
 	}
 
 	return writeSuccess(ctx, http.StatusOK, response)
 }
 
-// GetCurrentUser returns the authenticated user's profile.
+// writeLockedOut sends 429 for a locked-out login, with Retry-After set to
+// the remaining lockout in whole seconds (rounded up).
+func writeLockedOut(ctx rweb.Context, lockedFor time.Duration) error {
+	retryAfter := int((lockedFor + time.Second - 1) / time.Second)
+	ctx.Response().SetHeader("Retry-After", strconv.Itoa(retryAfter))
+	return writeError(ctx, http.StatusTooManyRequests, ErrCodeRateLimited,
+		"too many failed login attempts; try again later")
+}
+
+// CurrentUserResponse is the authenticated user's profile plus, for JWT
+// requests, when the token was issued and when it expires, so clients can
+// refresh before it lapses. The token times are omitted for API keys.
+type CurrentUserResponse struct {
+	models.UserOutput
+	TokenIssuedAt  *time.Time `json:"token_issued_at,omitempty"`
+	TokenExpiresAt *time.Time `json:"token_expires_at,omitempty"`
+}
+
+// GetCurrentUser returns the authenticated user's profile and token expiry.
 // GET /api/v1/auth/me
 //
 // Headers required:
@@ -218,77 +278,177 @@ func Login(ctx rweb.Context) error {
 //
 // Success (200):
 //
-//	{ "success": true, "data": { "id": 1, "guid": "...", "username": "..." } }
+//	{ "success": true, "data": { "id": 1, "guid": "...", "username": "...",
+//	  "token_issued_at": "...", "token_expires_at": "..." } }
 //
 // Errors:
-//   - 401: Missing or invalid token
+//   - 401: Missing, invalid or expired token
 func GetCurrentUser(ctx rweb.Context) error {
 	// Get user GUID from context (set by JWTAuthMiddleware)
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	// Look up the user
 	user, err := models.GetUserByGUID(userGUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to get user"), "user_guid", userGUID)
-		return writeError(ctx, http.StatusInternalServerError, "failed to get user")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to get user")
 	}
 
 	if user == nil {
-		return writeError(ctx, http.StatusUnauthorized, "user not found")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "user not found")
 	}
 
-	return writeSuccess(ctx, http.StatusOK, user.ToOutput())
+	response := CurrentUserResponse{UserOutput: user.ToOutput()}
+	if claims, ok := ctx.Get("token_claims").(*models.TokenClaims); ok {
+		if claims.IssuedAt != nil {
+			response.TokenIssuedAt = &claims.IssuedAt.Time
+		}
+		if claims.ExpiresAt != nil {
+			response.TokenExpiresAt = &claims.ExpiresAt.Time
+		}
+	}
+	return writeSuccess(ctx, http.StatusOK, response)
 }
 
-// RefreshToken generates a new JWT token for the authenticated user.
+// ChangePassword replaces the authenticated user's password.
+// POST /api/v1/auth/change-password
+//
+// Request body:
+//
+//	{ "current_password": "...", "new_password": "..." }
+//
+// Success (200):
+//
+//	{ "success": true, "data": { "changed": true } }
+//
+// Errors:
+//   - 400: Missing fields, or new password doesn't meet the password policy
+//   - 401: Not authenticated
+//   - 403: Current password is incorrect
+func ChangePassword(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.Unmarshal(ctx.Request().Body(), &input); err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid request body")
+	}
+	if input.CurrentPassword == "" || input.NewPassword == "" {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "current_password and new_password are required")
+	}
+
+	err := models.ChangePassword(userGUID, input.CurrentPassword, input.NewPassword)
+	if err != nil {
+		if err == models.ErrIncorrectPassword {
+			return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, err.Error())
+		}
+		var policyErr *models.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, policyErr.Error())
+		}
+		logger.LogErr(serr.Wrap(err, "failed to change password"), "user_guid", userGUID)
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to change password")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, map[string]bool{"changed": true})
+}
+
+// RefreshToken generates a new JWT token.
 // POST /api/v1/auth/refresh
 //
-// Headers required:
+// Two modes:
+//   - With a refresh token in the body, exchanges it for a new short-lived
+//     access token and a rotated refresh token. No Authorization header is
+//     needed, so this works after the access token has expired.
+//   - Otherwise, renews the still-valid Bearer token of the authenticated user.
 //
-//	Authorization: Bearer <jwt_token>
+// Request body (optional):
+//
+//	{ "refresh_token": "..." }
 //
 // Success (200):
 //
-//	{ "success": true, "data": { "token": "..." } }
+//	{ "success": true, "data": { "token": "...", "refresh_token": "..." } }
 //
 // Errors:
 //   - 401: Missing or invalid token
 //   - 403: Account is disabled
 func RefreshToken(ctx rweb.Context) error {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if body := ctx.Request().Body(); len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid request body")
+		}
+	}
+	if req.RefreshToken != "" {
+		return exchangeRefreshToken(ctx, req.RefreshToken)
+	}
+
 	// Get user GUID from context (set by JWTAuthMiddleware)
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	// Look up the user to verify they're still active
 	user, err := models.GetUserByGUID(userGUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to get user"), "user_guid", userGUID)
-		return writeError(ctx, http.StatusInternalServerError, "failed to get user")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to get user")
 	}
 
 	if user == nil {
-		return writeError(ctx, http.StatusUnauthorized, "user not found")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "user not found")
 	}
 
 	if !user.IsActive {
-		return writeError(ctx, http.StatusForbidden, "account is disabled")
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "account is disabled")
 	}
 
 	// Generate new token
 	token, err := models.GenerateToken(user)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to generate token"), "user_id", user.ID)
-		return writeError(ctx, http.StatusInternalServerError, "failed to generate token")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to generate token")
 	}
 
 	return writeSuccess(ctx, http.StatusOK, map[string]string{"token": token})
 }
 
+// exchangeRefreshToken trades a refresh token for a new access token and a
+// rotated refresh token. The presented refresh token cannot be used again.
+func exchangeRefreshToken(ctx rweb.Context, refreshToken string) error {
+	user, newRefreshToken, err := models.ExchangeRefreshToken(refreshToken)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to exchange refresh token"))
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to refresh token")
+	}
+	if user == nil {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "invalid refresh token")
+	}
+
+	token, err := models.GenerateAccessToken(user)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to generate access token"), "user_id", user.ID)
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to generate token")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, map[string]string{
+		"token":         token,
+		"refresh_token": newRefreshToken,
+	})
+}
+
 // GetCurrentUserGUID extracts the user GUID from the request context.
 // Returns empty string if not authenticated.
 func GetCurrentUserGUID(ctx rweb.Context) string {
@@ -1,8 +1,18 @@
 package api_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"os"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"gonotes/models"
 )
 
 // TestAuthAPI tests the authentication endpoints: register, login, /me, refresh.
@@ -206,6 +216,47 @@ func TestAuthAPI(t *testing.T) {
 		if data["username"] != "authuser" {
 			t.Errorf("expected username 'authuser', got %v", data["username"])
 		}
+		if guid, _ := data["guid"].(string); guid == "" {
+			t.Error("expected the user's guid")
+		}
+
+		// The token's iat/exp claims come back so clients can refresh ahead of expiry
+		issuedAt, err := time.Parse(time.RFC3339, fmt.Sprint(data["token_issued_at"]))
+		if err != nil {
+			t.Fatalf("expected token_issued_at, got %v", data["token_issued_at"])
+		}
+		expiresAt, err := time.Parse(time.RFC3339, fmt.Sprint(data["token_expires_at"]))
+		if err != nil {
+			t.Fatalf("expected token_expires_at, got %v", data["token_expires_at"])
+		}
+		if !expiresAt.After(time.Now()) || !expiresAt.After(issuedAt) {
+			t.Errorf("expected a future expiry after issue, got iat=%v exp=%v", issuedAt, expiresAt)
+		}
+	})
+
+	t.Run("GetCurrentUserExpiredToken", func(t *testing.T) {
+		origToken := ts.authToken
+		defer func() { ts.authToken = origToken }()
+
+		claims := models.TokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    models.TokenIssuer,
+				IssuedAt:  jwt.NewNumericDate(time.Now().Add(-2 * time.Hour)),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+			},
+			UserGUID: "expired-user-guid",
+			Username: "authuser",
+		}
+		expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(os.Getenv(models.JWTSecretEnvVar)))
+		if err != nil {
+			t.Fatalf("failed to sign expired token: %v", err)
+		}
+		ts.authToken = expired
+
+		status, _ := ts.request("GET", "/api/v1/auth/me", nil)
+		if status != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, status)
+		}
 	})
 
 	t.Run("GetCurrentUserNoToken", func(t *testing.T) {
@@ -265,3 +316,367 @@ func TestAuthAPI(t *testing.T) {
 		}
 	})
 }
+
+// TestAPIKeyAuth tests creating, using, listing, and revoking API keys.
+func TestAPIKeyAuth(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	var apiKey string
+	var keyID float64
+
+	t.Run("CreateAPIKey", func(t *testing.T) {
+		status, resp := ts.request("POST", "/api/v1/auth/api-keys", map[string]string{"label": "script"})
+
+		if status != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d – %v", http.StatusCreated, status, resp)
+		}
+
+		data := resp["data"].(map[string]interface{})
+		apiKey, _ = data["key"].(string)
+		if apiKey == "" {
+			t.Fatal("expected plaintext key in create response")
+		}
+	})
+
+	t.Run("ListAPIKeysHidesSecret", func(t *testing.T) {
+		status, resp := ts.request("GET", "/api/v1/auth/api-keys", nil)
+
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+		}
+
+		keys := resp["data"].([]interface{})
+		if len(keys) != 1 {
+			t.Fatalf("expected 1 key, got %d", len(keys))
+		}
+		key := keys[0].(map[string]interface{})
+		if _, ok := key["key"]; ok {
+			t.Error("list response must not include the plaintext key")
+		}
+		if key["label"] != "script" {
+			t.Errorf("expected label 'script', got %v", key["label"])
+		}
+		keyID = key["id"].(float64)
+	})
+
+	t.Run("AuthenticateWithAPIKey", func(t *testing.T) {
+		ts.apiKey = apiKey
+		defer func() { ts.apiKey = "" }()
+
+		status, resp := ts.request("GET", "/api/v1/auth/me", nil)
+
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+		}
+		data := resp["data"].(map[string]interface{})
+		if data["username"] != "notetest" {
+			t.Errorf("expected username 'notetest', got %v", data["username"])
+		}
+	})
+
+	t.Run("InvalidAPIKey", func(t *testing.T) {
+		ts.apiKey = "gnk_not-a-real-key"
+		defer func() { ts.apiKey = "" }()
+
+		status, _ := ts.request("GET", "/api/v1/auth/me", nil)
+
+		if status != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, status)
+		}
+	})
+
+	t.Run("RevokedAPIKeyRejected", func(t *testing.T) {
+		status, resp := ts.request("DELETE", fmt.Sprintf("/api/v1/auth/api-keys/%d", int64(keyID)), nil)
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+		}
+
+		ts.apiKey = apiKey
+		defer func() { ts.apiKey = "" }()
+
+		status, _ = ts.request("GET", "/api/v1/auth/me", nil)
+		if status != http.StatusUnauthorized {
+			t.Errorf("expected status %d for revoked key, got %d", http.StatusUnauthorized, status)
+		}
+	})
+
+	t.Run("RevokeUnknownAPIKey", func(t *testing.T) {
+		status, _ := ts.request("DELETE", "/api/v1/auth/api-keys/99999", nil)
+
+		if status != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, status)
+		}
+	})
+}
+
+// TestRefreshTokenFlow tests issuing a refresh token at login and exchanging
+// it for a new access token without credentials.
+func TestRefreshTokenFlow(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	var refreshToken string
+
+	t.Run("LoginIssuesRefreshToken", func(t *testing.T) {
+		status, resp := ts.request("POST", "/api/v1/auth/login", map[string]interface{}{
+			"username": "notetest",
+			"password": "testpassword123",
+			"refresh":  true,
+		})
+
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+		}
+
+		data := resp["data"].(map[string]interface{})
+		refreshToken, _ = data["refresh_token"].(string)
+		if refreshToken == "" {
+			t.Fatal("expected refresh_token in login response")
+		}
+	})
+
+	t.Run("LoginWithoutRefreshOmitsToken", func(t *testing.T) {
+		status, resp := ts.request("POST", "/api/v1/auth/login", map[string]string{
+			"username": "notetest",
+			"password": "testpassword123",
+		})
+
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+		}
+
+		data := resp["data"].(map[string]interface{})
+		if _, ok := data["refresh_token"]; ok {
+			t.Error("expected no refresh_token when not requested")
+		}
+	})
+
+	t.Run("ExchangeRefreshToken", func(t *testing.T) {
+		origToken := ts.authToken
+		ts.authToken = "" // Exchange must work without a valid access token
+		defer func() { ts.authToken = origToken }()
+
+		status, resp := ts.request("POST", "/api/v1/auth/refresh", map[string]string{
+			"refresh_token": refreshToken,
+		})
+
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+		}
+
+		data := resp["data"].(map[string]interface{})
+		newToken, _ := data["token"].(string)
+		rotated, _ := data["refresh_token"].(string)
+		if newToken == "" || rotated == "" {
+			t.Fatalf("expected token and rotated refresh_token, got %v", data)
+		}
+		if rotated == refreshToken {
+			t.Error("expected refresh token to be rotated")
+		}
+
+		// The new access token authenticates requests
+		ts.authToken = newToken
+		status, _ = ts.request("GET", "/api/v1/auth/me", nil)
+		if status != http.StatusOK {
+			t.Errorf("expected new access token to authenticate, got status %d", status)
+		}
+	})
+
+	t.Run("ReusedRefreshTokenRejected", func(t *testing.T) {
+		origToken := ts.authToken
+		ts.authToken = ""
+		defer func() { ts.authToken = origToken }()
+
+		status, _ := ts.request("POST", "/api/v1/auth/refresh", map[string]string{
+			"refresh_token": refreshToken,
+		})
+
+		if status != http.StatusUnauthorized {
+			t.Errorf("expected status %d for reused refresh token, got %d", http.StatusUnauthorized, status)
+		}
+	})
+}
+
+// TestChangePassword verifies that changing a password requires the current
+// password and that the new one must meet the password policy.
+func TestChangePassword(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	t.Run("WrongCurrentPassword", func(t *testing.T) {
+		status, resp := ts.request("POST", "/api/v1/auth/change-password", map[string]string{
+			"current_password": "not-my-password",
+			"new_password":     "brandnewpass456",
+		})
+		if status != http.StatusForbidden {
+			t.Fatalf("expected status %d, got %d – %v", http.StatusForbidden, status, resp)
+		}
+	})
+
+	t.Run("NewPasswordTooShort", func(t *testing.T) {
+		status, resp := ts.request("POST", "/api/v1/auth/change-password", map[string]string{
+			"current_password": "testpassword123",
+			"new_password":     "short",
+		})
+		if status != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d – %v", http.StatusBadRequest, status, resp)
+		}
+		if msg, _ := resp["error"].(string); msg != "password must be at least 8 characters" {
+			t.Errorf("expected policy message, got %q", msg)
+		}
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		anon := *ts
+		anon.authToken = ""
+		status, _ := anon.request("POST", "/api/v1/auth/change-password", map[string]string{
+			"current_password": "testpassword123",
+			"new_password":     "brandnewpass456",
+		})
+		if status != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, status)
+		}
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		status, resp := ts.request("POST", "/api/v1/auth/change-password", map[string]string{
+			"current_password": "testpassword123",
+			"new_password":     "brandnewpass456",
+		})
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+		}
+
+		status, _ = ts.request("POST", "/api/v1/auth/login", map[string]string{
+			"username": "notetest",
+			"password": "testpassword123",
+		})
+		if status != http.StatusUnauthorized {
+			t.Errorf("expected old password to be rejected, got %d", status)
+		}
+
+		status, resp = ts.request("POST", "/api/v1/auth/login", map[string]string{
+			"username": "notetest",
+			"password": "brandnewpass456",
+		})
+		if status != http.StatusOK {
+			t.Errorf("expected login with new password to succeed, got %d – %v", status, resp)
+		}
+	})
+}
+
+// TestLoginLockout verifies that five wrong passwords lock the username out,
+// that the lockout refuses even the correct password with 429 and a
+// Retry-After header, and that login works again once the window passes.
+func TestLoginLockout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+	models.ResetLoginLockouts()
+	defer models.ResetLoginLockouts()
+	t.Setenv(models.LoginLockoutDurationEnvVar, "1s")
+
+	login := func(password string) *http.Response {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"username": "notetest", "password": password})
+		resp, err := ts.client.Post(ts.baseURL+"/api/v1/auth/login", "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("login request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for i := 1; i < models.DefaultLoginLockoutThreshold; i++ {
+		if resp := login("wrongpassword"); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("failure %d: expected status %d, got %d", i, http.StatusUnauthorized, resp.StatusCode)
+		}
+	}
+	resp := login("wrongpassword")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected failure %d to lock out with %d, got %d",
+			models.DefaultLoginLockoutThreshold, http.StatusTooManyRequests, resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After: 1, got %q", resp.Header.Get("Retry-After"))
+	}
+
+	if resp := login("testpassword123"); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected the correct password to be refused during lockout, got %d", resp.StatusCode)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if resp := login("testpassword123"); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected login to succeed after the lockout, got %d", resp.StatusCode)
+	}
+}
+
+// TestLoginLockoutConcurrent verifies that concurrent wrong passwords get no
+// more guesses than the threshold: attempts beyond it are refused with 429
+// before their passwords are checked.
+func TestLoginLockoutConcurrent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+	models.ResetLoginLockouts()
+	defer models.ResetLoginLockouts()
+
+	const attempts = 3 * models.DefaultLoginLockoutThreshold
+	statuses := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, _ := json.Marshal(map[string]string{"username": "notetest", "password": "wrongpassword"})
+			resp, err := ts.client.Post(ts.baseURL+"/api/v1/auth/login", "application/json", bytes.NewBuffer(body))
+			if err != nil {
+				t.Errorf("login request failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusUnauthorized] != models.DefaultLoginLockoutThreshold-1 ||
+		counts[http.StatusTooManyRequests] != attempts-models.DefaultLoginLockoutThreshold+1 {
+		t.Errorf("expected %d password checks to fail with 401 and the rest to get 429, got %v",
+			models.DefaultLoginLockoutThreshold-1, counts)
+	}
+
+	body, _ := json.Marshal(map[string]string{"username": "notetest", "password": "testpassword123"})
+	resp, err := ts.client.Post(ts.baseURL+"/api/v1/auth/login", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("login request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected the correct password to be refused during lockout, got %d", resp.StatusCode)
+	}
+}
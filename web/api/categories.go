@@ -2,7 +2,9 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"gonotes/models"
@@ -14,67 +16,112 @@ import (
 
 // CreateCategory handles POST /api/v1/categories
 // Creates a new category from JSON body and returns the created category.
+//
+// Content encoding modes, as for notes:
+// - Standard JSON: description field is a plain string
+// - MsgPack mode: Header "X-Body-Encoding: msgpack", description_encoded field contains Base64 msgpack
 func CreateCategory(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
-	var input models.CategoryInput
-
-	if err := json.Unmarshal(ctx.Request().Body(), &input); err != nil {
-		logger.LogErr(serr.Wrap(err, "failed to decode request body"), "invalid JSON")
-		return writeError(ctx, http.StatusBadRequest, "invalid JSON body")
+	useMsgPack := ctx.Request().Header("X-Body-Encoding") == "msgpack"
+	input, err := decodeCategoryInput(ctx.Request().Body(), useMsgPack)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, err.Error())
 	}
 
 	// Validate required fields
 	if input.Name == "" {
-		return writeError(ctx, http.StatusBadRequest, "name is required")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "name is required")
 	}
 
 	// Create the category scoped to the authenticated user
 	category, err := models.CreateCategory(input, userGUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to create category"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to create category")
+		return writeModelError(ctx, err, "failed to create category")
 	}
 
 	logger.Info("Category created", "id", category.ID, "name", category.Name)
-	return writeSuccess(ctx, http.StatusCreated, category.ToOutput())
+	return writeCategory(ctx, http.StatusCreated, category.ToOutput(), useMsgPack)
+}
+
+// decodeCategoryInput parses a create/update request body, decoding the
+// msgpack envelope when useMsgPack is set. The returned error's message is
+// suitable for a 400 response.
+func decodeCategoryInput(body []byte, useMsgPack bool) (models.CategoryInput, error) {
+	if useMsgPack {
+		var msgpackReq models.MsgPackCategoryRequest
+		if err := json.Unmarshal(body, &msgpackReq); err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to decode msgpack request body"), "invalid JSON")
+			return models.CategoryInput{}, errors.New("invalid JSON body")
+		}
+		converted, err := msgpackReq.ToCategoryInput()
+		if err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to decode msgpack description"), "msgpack decode error")
+			return models.CategoryInput{}, errors.New("invalid msgpack description encoding")
+		}
+		return *converted, nil
+	}
+
+	var input models.CategoryInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to decode request body"), "invalid JSON")
+		return models.CategoryInput{}, errors.New("invalid JSON body")
+	}
+	return input, nil
+}
+
+// writeCategory sends a category response, msgpack-encoding the description
+// if the client asked for it. Falls back to plain JSON if encoding fails.
+func writeCategory(ctx rweb.Context, status int, output models.CategoryOutput, useMsgPack bool) error {
+	if useMsgPack {
+		msgpackResp, err := output.ToMsgPackResponse()
+		if err == nil {
+			return writeSuccess(ctx, status, msgpackResp)
+		}
+		logger.LogErr(err, "failed to encode msgpack response, falling back to JSON")
+	}
+	return writeSuccess(ctx, status, output)
 }
 
 // GetCategory handles GET /api/v1/categories/:id
 // Retrieves a single category by ID, scoped to the authenticated user.
+// Supports conditional requests via ETag / If-None-Match.
 func GetCategory(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	idStr := ctx.Request().Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid category id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid category id")
 	}
 
 	category, err := models.GetCategory(id, userGUID)
 	if err != nil {
 		if err.Error() == "category not found" {
-			return writeError(ctx, http.StatusNotFound, "category not found")
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "category not found")
 		}
 		logger.LogErr(serr.Wrap(err, "failed to get category"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
 	}
 
-	return writeSuccess(ctx, http.StatusOK, category.ToOutput())
+	return writeSuccessWithETag(ctx, category.ToOutput())
 }
 
 // ListCategories handles GET /api/v1/categories
 // Returns categories scoped to the authenticated user with optional pagination.
+// With ?with_counts=true each category also carries a note_count.
+// Supports conditional requests via ETag / If-None-Match.
 func ListCategories(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	// Parse pagination parameters with sensible defaults
@@ -84,7 +131,7 @@ func ListCategories(ctx rweb.Context) error {
 	if limitStr := ctx.Request().QueryParam("limit"); limitStr != "" {
 		parsedLimit, err := strconv.Atoi(limitStr)
 		if err != nil || parsedLimit < 0 {
-			return writeError(ctx, http.StatusBadRequest, "invalid limit parameter")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid limit parameter")
 		}
 		limit = parsedLimit
 	}
@@ -92,15 +139,36 @@ func ListCategories(ctx rweb.Context) error {
 	if offsetStr := ctx.Request().QueryParam("offset"); offsetStr != "" {
 		parsedOffset, err := strconv.Atoi(offsetStr)
 		if err != nil || parsedOffset < 0 {
-			return writeError(ctx, http.StatusBadRequest, "invalid offset parameter")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid offset parameter")
 		}
 		offset = parsedOffset
 	}
 
-	categories, err := models.ListCategories(limit, offset, userGUID)
+	// favorites_first sorts the user's favorite categories ahead of the rest
+	favoritesFirst := ctx.Request().QueryParam("favorites_first") == "true"
+
+	// with_counts adds each category's note count, computed in the same query
+	if ctx.Request().QueryParam("with_counts") == "true" {
+		listWithCounts := models.ListCategoriesWithCounts
+		if favoritesFirst {
+			listWithCounts = models.ListCategoriesWithCountsFavoritesFirst
+		}
+		counted, err := listWithCounts(userGUID, limit, offset)
+		if err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to list categories with counts"), "database error")
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+		}
+		return writeSuccessWithETag(ctx, counted)
+	}
+
+	list := models.ListCategories
+	if favoritesFirst {
+		list = models.ListCategoriesFavoritesFirst
+	}
+	categories, err := list(limit, offset, userGUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to list categories"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
 	}
 
 	// Convert to output format for clean JSON serialization
@@ -109,73 +177,312 @@ func ListCategories(ctx rweb.Context) error {
 		outputs[i] = category.ToOutput()
 	}
 
-	return writeSuccess(ctx, http.StatusOK, outputs)
+	return writeSuccessWithETag(ctx, outputs)
 }
 
 // UpdateCategory handles PUT /api/v1/categories/:id
-// Updates an existing category with the provided JSON body.
+// Updates an existing category with the provided JSON body. Honors
+// X-Body-Encoding: msgpack like CreateCategory.
 func UpdateCategory(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	idStr := ctx.Request().Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid category id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid category id")
 	}
 
-	var input models.CategoryInput
 	body := ctx.Request().Body()
-	logger.Debug("UpdateCategory request body", "body", string(body))
+	if models.DebugLoggingEnabled() {
+		logger.Debug("UpdateCategory request body", "body", string(body))
+	}
 
-	if err := json.Unmarshal(body, &input); err != nil {
-		logger.LogErr(serr.Wrap(err, "failed to decode request body"), "invalid JSON")
-		return writeError(ctx, http.StatusBadRequest, "invalid JSON body")
+	useMsgPack := ctx.Request().Header("X-Body-Encoding") == "msgpack"
+	input, err := decodeCategoryInput(body, useMsgPack)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, err.Error())
 	}
 
-	logger.Debug("UpdateCategory parsed input", "name", input.Name, "subcategories", input.Subcategories)
+	if models.DebugLoggingEnabled() {
+		logger.Debug("UpdateCategory parsed input", "name", input.Name, "subcategories", input.Subcategories)
+	}
 
 	// Name is required for updates
 	if input.Name == "" {
-		return writeError(ctx, http.StatusBadRequest, "name is required")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "name is required")
 	}
 
 	category, err := models.UpdateCategory(id, input, userGUID)
 	if err != nil {
 		if err.Error() == "category not found" {
-			return writeError(ctx, http.StatusNotFound, "category not found")
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "category not found")
 		}
 		logger.LogErr(serr.Wrap(err, "failed to update category"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to update category")
+		return writeModelError(ctx, err, "failed to update category")
 	}
 
 	logger.Info("Category updated", "id", category.ID)
+	return writeCategory(ctx, http.StatusOK, category.ToOutput(), useMsgPack)
+}
+
+// SubcategoryRequest is the body for adding a subcategory.
+type SubcategoryRequest struct {
+	Name string `json:"name"` // The subcategory to add
+}
+
+// AddSubcategory handles POST /api/v1/categories/:id/subcategories
+// Appends one subcategory to the category without replacing the list, so
+// concurrent additions don't overwrite each other. Returns the category.
+func AddSubcategory(ctx rweb.Context) error {
+	return editSubcategory(ctx, true)
+}
+
+// RemoveSubcategory handles DELETE /api/v1/categories/:id/subcategories?name=<name>
+// Removes one subcategory from the category. Notes that select it keep it.
+// Returns the category.
+func RemoveSubcategory(ctx rweb.Context) error {
+	return editSubcategory(ctx, false)
+}
+
+// editSubcategory adds (from the JSON body) or removes (from the name query
+// parameter) a single subcategory of the category in the path.
+func editSubcategory(ctx rweb.Context, add bool) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	id, err := strconv.ParseInt(ctx.Request().Param("id"), 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid category id")
+	}
+
+	var name string
+	if add {
+		var req SubcategoryRequest
+		if err := json.Unmarshal(ctx.Request().Body(), &req); err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to decode request body"), "invalid JSON")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
+		}
+		name = req.Name
+	} else {
+		name = ctx.Request().QueryParam("name")
+	}
+	if name == "" {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "name is required")
+	}
+
+	// Verify the category belongs to the user before editing
+	if _, err := models.GetCategory(id, userGUID); err != nil {
+		if err.Error() == "category not found" {
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "category not found")
+		}
+		logger.LogErr(serr.Wrap(err, "failed to get category"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	if add {
+		err = models.AddSubcategory(id, name)
+	} else {
+		err = models.RemoveSubcategory(id, name)
+	}
+	if err != nil {
+		switch err.Error() {
+		case "subcategory not found":
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "subcategory not found")
+		case "subcategory already exists":
+			return writeError(ctx, http.StatusConflict, ErrCodeConflict, "subcategory already exists")
+		}
+		logger.LogErr(serr.Wrap(err, "failed to edit subcategory"), "database error")
+		return writeModelError(ctx, err, "failed to update subcategories")
+	}
+
+	category, err := models.GetCategory(id, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get updated category"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	logger.Info("Subcategory edited", "category_id", id, "name", name, "added", add)
 	return writeSuccess(ctx, http.StatusOK, category.ToOutput())
 }
 
+// RenameSubcategoryRequest is the body for renaming a subcategory.
+type RenameSubcategoryRequest struct {
+	Name string `json:"name"` // The new subcategory name
+}
+
+// RenameSubcategory handles PUT /api/v1/categories/:id/subcategories/:name
+// Renames the subcategory on the category and on every note that has it selected.
+func RenameSubcategory(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	id, err := strconv.ParseInt(ctx.Request().Param("id"), 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid category id")
+	}
+
+	oldName, err := url.PathUnescape(ctx.Request().Param("name"))
+	if err != nil || oldName == "" {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid subcategory name")
+	}
+
+	var req RenameSubcategoryRequest
+	if err := json.Unmarshal(ctx.Request().Body(), &req); err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to decode request body"), "invalid JSON")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
+	}
+	if req.Name == "" {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "name is required")
+	}
+
+	// Verify the category belongs to the user before renaming
+	if _, err := models.GetCategory(id, userGUID); err != nil {
+		if err.Error() == "category not found" {
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "category not found")
+		}
+		logger.LogErr(serr.Wrap(err, "failed to get category"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	if err := models.RenameSubcategory(id, oldName, req.Name); err != nil {
+		switch err.Error() {
+		case "subcategory not found":
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "subcategory not found")
+		case "subcategory already exists":
+			return writeError(ctx, http.StatusConflict, ErrCodeConflict, "subcategory already exists")
+		}
+		logger.LogErr(serr.Wrap(err, "failed to rename subcategory"), "database error")
+		return writeModelError(ctx, err, "failed to rename subcategory")
+	}
+
+	category, err := models.GetCategory(id, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get renamed category"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	logger.Info("Subcategory renamed", "category_id", id, "from", oldName, "to", req.Name)
+	return writeSuccess(ctx, http.StatusOK, category.ToOutput())
+}
+
+// FavoriteCategory handles POST /api/v1/categories/:id/favorite
+// Adds the category to the current user's favorites, which
+// ?favorites_first=true lists ahead of the rest.
+func FavoriteCategory(ctx rweb.Context) error {
+	return setCategoryFavorite(ctx, true)
+}
+
+// UnfavoriteCategory handles DELETE /api/v1/categories/:id/favorite
+// Removes the category from the current user's favorites.
+func UnfavoriteCategory(ctx rweb.Context) error {
+	return setCategoryFavorite(ctx, false)
+}
+
+// setCategoryFavorite adds or removes the category in the path from the
+// current user's favorites.
+func setCategoryFavorite(ctx rweb.Context, favorite bool) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	id, err := strconv.ParseInt(ctx.Request().Param("id"), 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid category id")
+	}
+
+	// Verify the category belongs to the user
+	if _, err := models.GetCategory(id, userGUID); err != nil {
+		if err.Error() == "category not found" {
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "category not found")
+		}
+		logger.LogErr(serr.Wrap(err, "failed to get category"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	if favorite {
+		err = models.FavoriteCategory(userGUID, id)
+	} else {
+		err = models.UnfavoriteCategory(userGUID, id)
+	}
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to update category favorite"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, map[string]interface{}{
+		"id":       id,
+		"favorite": favorite,
+	})
+}
+
+// GetSubcategoryUsage handles GET /api/v1/categories/:id/subcategory-usage
+// Returns how many notes select each of the category's subcategories, as a
+// map from subcategory name to note count. Defined subcategories no note
+// selects report zero, so they can be removed without affecting any note.
+func GetSubcategoryUsage(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	id, err := strconv.ParseInt(ctx.Request().Param("id"), 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid category id")
+	}
+
+	// Verify the category belongs to the user
+	if _, err := models.GetCategory(id, userGUID); err != nil {
+		if err.Error() == "category not found" {
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "category not found")
+		}
+		logger.LogErr(serr.Wrap(err, "failed to get category"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	usage, err := models.GetSubcategoryUsage(id)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get subcategory usage"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, usage)
+}
+
 // DeleteCategory handles DELETE /api/v1/categories/:id
 // Deletes a category permanently, scoped to the authenticated user.
+// A category still linked to notes is refused with 409 unless ?force=true,
+// which unlinks the notes and deletes the category together.
 func DeleteCategory(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	idStr := ctx.Request().Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid category id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid category id")
 	}
 
-	err = models.DeleteCategory(id, userGUID)
+	force := ctx.Request().QueryParam("force") == "true"
+	err = models.DeleteCategory(id, userGUID, force)
 	if err != nil {
 		if err.Error() == "category not found" {
-			return writeError(ctx, http.StatusNotFound, "category not found")
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "category not found")
+		}
+		if inUseErr, ok := err.(*models.CategoryInUseError); ok {
+			return writeError(ctx, http.StatusConflict, ErrCodeConflict, inUseErr.Error())
 		}
 		logger.LogErr(serr.Wrap(err, "failed to delete category"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to delete category")
+		return writeModelError(ctx, err, "failed to delete category")
 	}
 
 	logger.Info("Category deleted", "id", id)
@@ -196,22 +503,23 @@ type AddCategoryToNoteRequest struct {
 //	{ "subcategories": ["subcat1", "subcat2"] }
 //
 // If no body is provided, the category is added without subcategories.
+// Responds with the created relationship (NoteCategoryOutput).
 func AddCategoryToNote(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	noteIDStr := ctx.Request().Param("id")
 	noteID, err := strconv.ParseInt(noteIDStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid note id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
 	}
 
 	categoryIDStr := ctx.Request().Param("category_id")
 	categoryID, err := strconv.ParseInt(categoryIDStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid category id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid category id")
 	}
 
 	// Parse optional request body for subcategories
@@ -221,40 +529,39 @@ func AddCategoryToNote(ctx rweb.Context) error {
 		var req AddCategoryToNoteRequest
 		if err := json.Unmarshal(body, &req); err != nil {
 			logger.LogErr(serr.Wrap(err, "failed to decode request body"), "invalid JSON")
-			return writeError(ctx, http.StatusBadRequest, "invalid JSON body")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
 		}
 		subcategories = req.Subcategories
 	}
 
-	// Use the subcategory-aware function when subcats are provided.
-	// userGUID ensures both note and category belong to the authenticated user.
-	if len(subcategories) > 0 {
-		err = models.AddCategoryToNoteWithSubcategories(noteID, categoryID, subcategories, userGUID)
-	} else {
-		err = models.AddCategoryToNote(noteID, categoryID, userGUID)
-	}
-
+	// userGUID ensures both note and category belong to the authenticated user
+	err = models.AddCategoryToNoteWithSubcategories(noteID, categoryID, subcategories, userGUID, true)
 	if err != nil {
 		if err.Error() == "note not found" {
-			return writeError(ctx, http.StatusNotFound, "note not found")
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
 		}
 		if err.Error() == "category not found" {
-			return writeError(ctx, http.StatusNotFound, "category not found")
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "category not found")
 		}
 		if err.Error() == "category already added to this note" {
-			return writeError(ctx, http.StatusConflict, "category already added to this note")
+			return writeError(ctx, http.StatusConflict, ErrCodeConflict, "category already added to this note")
+		}
+		if unknownErr, ok := err.(*models.UnknownSubcategoriesError); ok {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, unknownErr.Error())
 		}
 		logger.LogErr(serr.Wrap(err, "failed to add category to note"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to add category to note")
+		return writeModelError(ctx, err, "failed to add category to note")
 	}
 
 	logger.Info("Category added to note", "note_id", noteID, "category_id", categoryID, "subcategories", subcategories)
-	return writeSuccess(ctx, http.StatusCreated, map[string]interface{}{
-		"note_id":       noteID,
-		"category_id":   categoryID,
-		"subcategories": subcategories,
-		"added":         true,
-	})
+
+	// Read the relationship back so the client gets its created_at without a follow-up GET
+	noteCategory, err := models.GetNoteCategory(noteID, categoryID)
+	if err != nil || noteCategory == nil {
+		logger.LogErr(serr.Wrap(err, "failed to read back note category"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to read note category")
+	}
+	return writeSuccess(ctx, http.StatusCreated, noteCategory.ToOutput())
 }
 
 // UpdateNoteCategory handles PUT /api/v1/notes/:id/categories/:category_id
@@ -263,7 +570,7 @@ func AddCategoryToNote(ctx rweb.Context) error {
 func UpdateNoteCategory(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 	// Note: UpdateNoteCategorySubcategories operates on an existing relationship
 	// that was already ownership-checked when created. The existence check (SELECT COUNT)
@@ -272,13 +579,13 @@ func UpdateNoteCategory(ctx rweb.Context) error {
 	noteIDStr := ctx.Request().Param("id")
 	noteID, err := strconv.ParseInt(noteIDStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid note id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
 	}
 
 	categoryIDStr := ctx.Request().Param("category_id")
 	categoryID, err := strconv.ParseInt(categoryIDStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid category id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid category id")
 	}
 
 	// Parse subcategories from request body
@@ -287,17 +594,20 @@ func UpdateNoteCategory(ctx rweb.Context) error {
 	if len(body) > 0 {
 		if err := json.Unmarshal(body, &req); err != nil {
 			logger.LogErr(serr.Wrap(err, "failed to decode request body"), "invalid JSON")
-			return writeError(ctx, http.StatusBadRequest, "invalid JSON body")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
 		}
 	}
 
-	err = models.UpdateNoteCategorySubcategories(noteID, categoryID, req.Subcategories)
+	err = models.UpdateNoteCategorySubcategories(noteID, categoryID, req.Subcategories, true)
 	if err != nil {
 		if err.Error() == "relationship not found" {
-			return writeError(ctx, http.StatusNotFound, "relationship not found")
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "relationship not found")
+		}
+		if unknownErr, ok := err.(*models.UnknownSubcategoriesError); ok {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, unknownErr.Error())
 		}
 		logger.LogErr(serr.Wrap(err, "failed to update note category subcategories"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to update note category")
+		return writeModelError(ctx, err, "failed to update note category")
 	}
 
 	logger.Info("Note category subcategories updated", "note_id", noteID, "category_id", categoryID)
@@ -314,7 +624,7 @@ func UpdateNoteCategory(ctx rweb.Context) error {
 func RemoveCategoryFromNote(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 	// Note: RemoveCategoryFromNote deletes by note_id + category_id. The note_categories
 	// junction only contains entries that were ownership-verified at creation time.
@@ -323,22 +633,22 @@ func RemoveCategoryFromNote(ctx rweb.Context) error {
 	noteIDStr := ctx.Request().Param("id")
 	noteID, err := strconv.ParseInt(noteIDStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid note id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
 	}
 
 	categoryIDStr := ctx.Request().Param("category_id")
 	categoryID, err := strconv.ParseInt(categoryIDStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid category id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid category id")
 	}
 
 	err = models.RemoveCategoryFromNote(noteID, categoryID)
 	if err != nil {
 		if err.Error() == "relationship not found" {
-			return writeError(ctx, http.StatusNotFound, "relationship not found")
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "relationship not found")
 		}
 		logger.LogErr(serr.Wrap(err, "failed to remove category from note"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to remove category from note")
+		return writeModelError(ctx, err, "failed to remove category from note")
 	}
 
 	logger.Info("Category removed from note", "note_id", noteID, "category_id", categoryID)
@@ -354,41 +664,70 @@ func RemoveCategoryFromNote(ctx rweb.Context) error {
 // The response includes both the full subcategory list (from the category definition)
 // and selected_subcategories (from the note-category junction) so the UI can
 // render checkboxes with the correct pre-selected state.
+//
+// Query parameters:
+//   - detailed: "true" (default) for the NoteCategoryDetailOutput above;
+//     "false" for bare CategoryOutput objects without the note's selection
 func GetNoteCategories(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	noteIDStr := ctx.Request().Param("id")
 	noteID, err := strconv.ParseInt(noteIDStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid note id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
+	}
+
+	detailed := true
+	if detailedStr := ctx.Request().QueryParam("detailed"); detailedStr != "" {
+		detailed, err = strconv.ParseBool(detailedStr)
+		if err != nil {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid detailed parameter: must be true or false")
+		}
+	}
+
+	if !detailed {
+		categories, err := models.GetNoteCategories(noteID, userGUID)
+		if err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to get note categories"), "database error")
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+		}
+		outputs := make([]models.CategoryOutput, len(categories))
+		for i := range categories {
+			outputs[i] = categories[i].ToOutput()
+		}
+		return writeSuccess(ctx, http.StatusOK, outputs)
 	}
 
 	details, err := models.GetNoteCategoryDetails(noteID, userGUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to get note categories"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+	if details == nil {
+		details = []models.NoteCategoryDetailOutput{}
 	}
 
 	return writeSuccess(ctx, http.StatusOK, details)
 }
 
-// GetNoteCategoryMappings handles GET /api/v1/note-category-mappings
+// GetNoteCategoryMappings handles GET /api/v1/notes/category-mappings
+// (also served at the legacy path /api/v1/note-category-mappings).
 // Returns all note-category relationships for the authenticated user in a single bulk
 // response. The client uses this to build a lookup map so category filtering in the
 // search bar works entirely client-side without per-note API calls.
 func GetNoteCategoryMappings(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	mappings, err := models.GetAllNoteCategoryMappings(userGUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to get note-category mappings"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
 	}
 
 	return writeSuccess(ctx, http.StatusOK, mappings)
@@ -399,19 +738,19 @@ func GetNoteCategoryMappings(ctx rweb.Context) error {
 func GetCategoryNotes(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	categoryIDStr := ctx.Request().Param("id")
 	categoryID, err := strconv.ParseInt(categoryIDStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid category id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid category id")
 	}
 
 	notes, err := models.GetCategoryNotes(categoryID, userGUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to get category notes"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
 	}
 
 	// Convert to output format for clean JSON serialization
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -774,3 +775,845 @@ func TestNoteCategoryRelationshipAPI(t *testing.T) {
 		}
 	})
 }
+
+// TestNoteCategorySubcategoryValidation verifies that mapping a note to a
+// subcategory the category doesn't define is rejected with the offending name.
+func TestNoteCategorySubcategoryValidation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid":  "subcat-validation-note",
+		"title": "Subcat Validation",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d", status)
+	}
+	noteID := resp["data"].(map[string]interface{})["id"].(float64)
+
+	status, resp = ts.request("POST", "/api/v1/categories", map[string]interface{}{
+		"name":          "k8s",
+		"subcategories": []string{"pod", "service"},
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create category: %d", status)
+	}
+	categoryID := resp["data"].(map[string]interface{})["id"].(float64)
+	mappingPath := fmt.Sprintf("/api/v1/notes/%.0f/categories/%.0f", noteID, categoryID)
+
+	t.Run("add with unknown subcategory", func(t *testing.T) {
+		status, resp := ts.request("POST", mappingPath, map[string]interface{}{
+			"subcategories": []string{"pod", "podd"},
+		})
+		if status != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, status)
+		}
+		if msg, _ := resp["error"].(string); !strings.Contains(msg, "podd") || strings.Contains(msg, "pod,") {
+			t.Errorf("expected error naming only 'podd', got %q", msg)
+		}
+	})
+
+	t.Run("add with defined subcategory", func(t *testing.T) {
+		status, resp := ts.request("POST", mappingPath, map[string]interface{}{
+			"subcategories": []string{"pod"},
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, status)
+		}
+
+		// The response is the created relationship
+		data := resp["data"].(map[string]interface{})
+		if data["note_id"] != noteID || data["category_id"] != categoryID {
+			t.Errorf("expected note %.0f and category %.0f, got %v", noteID, categoryID, data)
+		}
+		if got := fmt.Sprint(data["subcategories"]); got != "[pod]" {
+			t.Errorf("expected subcategories [pod], got %s", got)
+		}
+		if createdAt, _ := data["created_at"].(string); createdAt == "" {
+			t.Error("expected created_at in the response")
+		}
+	})
+
+	t.Run("update with unknown subcategory", func(t *testing.T) {
+		status, resp := ts.request("PUT", mappingPath, map[string]interface{}{
+			"subcategories": []string{"service", "ingress"},
+		})
+		if status != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, status)
+		}
+		if msg, _ := resp["error"].(string); !strings.Contains(msg, "ingress") {
+			t.Errorf("expected error naming 'ingress', got %q", msg)
+		}
+	})
+
+	t.Run("update with defined subcategories", func(t *testing.T) {
+		status, _ := ts.request("PUT", mappingPath, map[string]interface{}{
+			"subcategories": []string{"pod", "service"},
+		})
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+		}
+	})
+}
+
+// TestAddRemoveSubcategoryAPI verifies single-subcategory add and remove
+// through the API, including duplicate, missing, and unknown-category errors.
+func TestAddRemoveSubcategoryAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/categories", map[string]interface{}{
+		"name":          "k8s",
+		"subcategories": []string{"pod"},
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create category: %d", status)
+	}
+	path := fmt.Sprintf("/api/v1/categories/%.0f/subcategories", resp["data"].(map[string]interface{})["id"].(float64))
+
+	status, resp = ts.request("POST", path, map[string]interface{}{"name": "service"})
+	if status != http.StatusOK {
+		t.Fatalf("expected %d adding a subcategory, got %d: %v", http.StatusOK, status, resp)
+	}
+	if got := fmt.Sprint(resp["data"].(map[string]interface{})["subcategories"]); got != "[pod service]" {
+		t.Errorf("expected [pod service], got %s", got)
+	}
+	if status, _ := ts.request("POST", path, map[string]interface{}{"name": "service"}); status != http.StatusConflict {
+		t.Errorf("expected %d adding a duplicate, got %d", http.StatusConflict, status)
+	}
+
+	status, resp = ts.request("DELETE", path+"?name=pod", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected %d removing a subcategory, got %d: %v", http.StatusOK, status, resp)
+	}
+	if got := fmt.Sprint(resp["data"].(map[string]interface{})["subcategories"]); got != "[service]" {
+		t.Errorf("expected [service], got %s", got)
+	}
+	if status, _ := ts.request("DELETE", path+"?name=pod", nil); status != http.StatusNotFound {
+		t.Errorf("expected %d removing a missing subcategory, got %d", http.StatusNotFound, status)
+	}
+	if status, _ := ts.request("DELETE", path, nil); status != http.StatusBadRequest {
+		t.Errorf("expected %d without a name, got %d", http.StatusBadRequest, status)
+	}
+	if status, _ := ts.request("POST", "/api/v1/categories/99999/subcategories", map[string]interface{}{"name": "x"}); status != http.StatusNotFound {
+		t.Errorf("expected %d for an unknown category, got %d", http.StatusNotFound, status)
+	}
+}
+
+// TestNoteCategoriesDetailed verifies that a note's categories come back with
+// both the category's full subcategory list and the note's selected subset by
+// default and with detailed=true, and as bare categories with detailed=false.
+func TestNoteCategoriesDetailed(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/categories", map[string]interface{}{
+		"name":          "k8s",
+		"subcategories": []string{"pod", "service", "ingress"},
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create category: %d", status)
+	}
+	categoryID := resp["data"].(map[string]interface{})["id"].(float64)
+
+	status, resp = ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": "detailed-note", "title": "Detailed"})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d", status)
+	}
+	noteID := resp["data"].(map[string]interface{})["id"].(float64)
+	status, _ = ts.request("POST", fmt.Sprintf("/api/v1/notes/%.0f/categories/%.0f", noteID, categoryID),
+		map[string]interface{}{"subcategories": []string{"service"}})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to add category to note: %d", status)
+	}
+
+	path := fmt.Sprintf("/api/v1/notes/%.0f/categories", noteID)
+	for _, query := range []string{"", "?detailed=true"} {
+		status, resp := ts.request("GET", path+query, nil)
+		if status != http.StatusOK {
+			t.Fatalf("%q: failed to get note categories: %d", query, status)
+		}
+		cats := resp["data"].([]interface{})
+		if len(cats) != 1 {
+			t.Fatalf("%q: expected 1 category, got %d", query, len(cats))
+		}
+		cat := cats[0].(map[string]interface{})
+		if got := fmt.Sprint(cat["subcategories"]); got != "[pod service ingress]" {
+			t.Errorf("%q: expected all subcategories, got %s", query, got)
+		}
+		if got := fmt.Sprint(cat["selected_subcategories"]); got != "[service]" {
+			t.Errorf("%q: expected selected [service], got %s", query, got)
+		}
+	}
+
+	status, resp = ts.request("GET", path+"?detailed=false", nil)
+	if status != http.StatusOK {
+		t.Fatalf("failed to get bare note categories: %d", status)
+	}
+	cat := resp["data"].([]interface{})[0].(map[string]interface{})
+	if _, ok := cat["selected_subcategories"]; ok || cat["guid"] == nil {
+		t.Errorf("expected a bare category with detailed=false, got %v", cat)
+	}
+
+	if status, _ := ts.request("GET", path+"?detailed=maybe", nil); status != http.StatusBadRequest {
+		t.Errorf("expected %d for an invalid detailed value, got %d", http.StatusBadRequest, status)
+	}
+}
+
+// TestRenameSubcategoryAPI verifies that renaming a subcategory updates the
+// category definition and every note that had it selected.
+func TestRenameSubcategoryAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/categories", map[string]interface{}{
+		"name":          "k8s",
+		"subcategories": []string{"pod", "service"},
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create category: %d", status)
+	}
+	categoryID := resp["data"].(map[string]interface{})["id"].(float64)
+
+	var noteIDs []float64
+	for i, subcats := range [][]string{{"pod"}, {"pod", "service"}, {"service"}} {
+		status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+			"guid":  fmt.Sprintf("rename-subcat-note-%d", i),
+			"title": "Rename Subcat",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create note: %d", status)
+		}
+		noteID := resp["data"].(map[string]interface{})["id"].(float64)
+		noteIDs = append(noteIDs, noteID)
+
+		status, _ = ts.request("POST", fmt.Sprintf("/api/v1/notes/%.0f/categories/%.0f", noteID, categoryID),
+			map[string]interface{}{"subcategories": subcats})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to add category to note: %d", status)
+		}
+	}
+
+	renamePath := fmt.Sprintf("/api/v1/categories/%.0f/subcategories/pod", categoryID)
+
+	t.Run("rename", func(t *testing.T) {
+		status, resp := ts.request("PUT", renamePath, map[string]interface{}{"name": "pods"})
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %v", http.StatusOK, status, resp)
+		}
+		subcats := resp["data"].(map[string]interface{})["subcategories"].([]interface{})
+		if len(subcats) != 2 || subcats[0] != "pods" || subcats[1] != "service" {
+			t.Errorf("expected category subcategories [pods service], got %v", subcats)
+		}
+	})
+
+	t.Run("notes follow the rename", func(t *testing.T) {
+		want := [][]string{{"pods"}, {"pods", "service"}, {"service"}}
+		for i, noteID := range noteIDs {
+			status, resp := ts.request("GET", fmt.Sprintf("/api/v1/notes/%.0f/categories", noteID), nil)
+			if status != http.StatusOK {
+				t.Fatalf("failed to get note categories: %d", status)
+			}
+			cats := resp["data"].([]interface{})
+			if len(cats) != 1 {
+				t.Fatalf("expected 1 category on note %d, got %d", i, len(cats))
+			}
+			got := fmt.Sprint(cats[0].(map[string]interface{})["selected_subcategories"])
+			if got != fmt.Sprint(want[i]) {
+				t.Errorf("note %d: expected subcategories %v, got %s", i, want[i], got)
+			}
+		}
+	})
+
+	t.Run("rename missing subcategory", func(t *testing.T) {
+		status, _ := ts.request("PUT", renamePath, map[string]interface{}{"name": "pods2"})
+		if status != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("rename onto existing subcategory", func(t *testing.T) {
+		path := fmt.Sprintf("/api/v1/categories/%.0f/subcategories/pods", categoryID)
+		status, _ := ts.request("PUT", path, map[string]interface{}{"name": "service"})
+		if status != http.StatusConflict {
+			t.Errorf("expected status %d, got %d", http.StatusConflict, status)
+		}
+	})
+}
+
+// TestSubcategoryUsageAPI verifies the subcategory usage endpoint reports a
+// count for every defined subcategory.
+func TestSubcategoryUsageAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/categories", map[string]interface{}{
+		"name":          "k8s",
+		"subcategories": []string{"pod", "service"},
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create category: %d", status)
+	}
+	categoryID := resp["data"].(map[string]interface{})["id"].(float64)
+
+	status, resp = ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid":  "subcat-usage-note",
+		"title": "Subcat Usage",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d", status)
+	}
+	noteID := resp["data"].(map[string]interface{})["id"].(float64)
+
+	status, _ = ts.request("POST", fmt.Sprintf("/api/v1/notes/%.0f/categories/%.0f", noteID, categoryID),
+		map[string]interface{}{"subcategories": []string{"pod"}})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to add category to note: %d", status)
+	}
+
+	t.Run("usage", func(t *testing.T) {
+		status, resp := ts.request("GET", fmt.Sprintf("/api/v1/categories/%.0f/subcategory-usage", categoryID), nil)
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %v", http.StatusOK, status, resp)
+		}
+		usage := resp["data"].(map[string]interface{})
+		if len(usage) != 2 || usage["pod"] != float64(1) || usage["service"] != float64(0) {
+			t.Errorf("expected usage map[pod:1 service:0], got %v", usage)
+		}
+	})
+
+	t.Run("unknown category", func(t *testing.T) {
+		status, _ := ts.request("GET", "/api/v1/categories/99999/subcategory-usage", nil)
+		if status != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, status)
+		}
+	})
+}
+
+// TestFavoriteCategoriesAPI verifies that favoriting a category moves it to
+// the top of the list with ?favorites_first=true.
+func TestFavoriteCategoriesAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	var ids []float64
+	for _, name := range []string{"first", "second"} {
+		status, resp := ts.request("POST", "/api/v1/categories", map[string]interface{}{"name": name})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create category: %d", status)
+		}
+		ids = append(ids, resp["data"].(map[string]interface{})["id"].(float64))
+		time.Sleep(2 * time.Millisecond) // distinct created_at for ordering
+	}
+
+	firstName := func(path string) string {
+		t.Helper()
+		status, resp := ts.request("GET", path, nil)
+		if status != http.StatusOK {
+			t.Fatalf("failed to list categories: %d", status)
+		}
+		cats := resp["data"].([]interface{})
+		if len(cats) != 2 {
+			t.Fatalf("expected 2 categories, got %d", len(cats))
+		}
+		return cats[0].(map[string]interface{})["name"].(string)
+	}
+
+	favoritePath := fmt.Sprintf("/api/v1/categories/%.0f/favorite", ids[0])
+	if status, _ := ts.request("POST", favoritePath, nil); status != http.StatusOK {
+		t.Fatalf("failed to favorite category: %d", status)
+	}
+	if got := firstName("/api/v1/categories?favorites_first=true"); got != "first" {
+		t.Errorf("expected the favorite first, got %q", got)
+	}
+	if got := firstName("/api/v1/categories?favorites_first=true&with_counts=true"); got != "first" {
+		t.Errorf("expected the favorite first with counts, got %q", got)
+	}
+	if got := firstName("/api/v1/categories"); got != "second" {
+		t.Errorf("expected newest first without favorites_first, got %q", got)
+	}
+
+	if status, _ := ts.request("DELETE", favoritePath, nil); status != http.StatusOK {
+		t.Fatalf("failed to unfavorite category: %d", status)
+	}
+	if got := firstName("/api/v1/categories?favorites_first=true"); got != "second" {
+		t.Errorf("expected newest first after unfavoriting, got %q", got)
+	}
+
+	if status, _ := ts.request("POST", "/api/v1/categories/99999/favorite", nil); status != http.StatusNotFound {
+		t.Errorf("expected %d favoriting an unknown category, got %d", http.StatusNotFound, status)
+	}
+}
+
+// TestCategoryRulesAPI verifies that a tag rule links newly created and
+// updated notes to its category, and that apply-all links existing notes.
+func TestCategoryRulesAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	createNote := func(guid, tags string) float64 {
+		t.Helper()
+		status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": guid, "title": guid, "tags": tags})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create note: %d", status)
+		}
+		return resp["data"].(map[string]interface{})["id"].(float64)
+	}
+	categoryNames := func(noteID float64) []string {
+		t.Helper()
+		status, resp := ts.request("GET", fmt.Sprintf("/api/v1/notes/%.0f/categories", noteID), nil)
+		if status != http.StatusOK {
+			t.Fatalf("failed to get note categories: %d", status)
+		}
+		var names []string
+		cats, _ := resp["data"].([]interface{}) // null when the note has none
+		for _, c := range cats {
+			names = append(names, c.(map[string]interface{})["name"].(string))
+		}
+		return names
+	}
+
+	// A note tagged before the rule exists is only linked by apply-all
+	existingID := createNote("rules-existing", "aws")
+
+	status, resp := ts.request("POST", "/api/v1/categories", map[string]interface{}{"name": "Cloud"})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create category: %d", status)
+	}
+	catID := resp["data"].(map[string]interface{})["id"].(float64)
+
+	status, _ = ts.request("POST", "/api/v1/category-rules", map[string]interface{}{"tag_pattern": "AWS", "category_id": catID})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create rule: %d", status)
+	}
+
+	taggedID := createNote("rules-tagged", "ops, aws")
+	if names := categoryNames(taggedID); len(names) != 1 || names[0] != "Cloud" {
+		t.Errorf("expected a note tagged aws to be linked to Cloud, got %v", names)
+	}
+	untaggedID := createNote("rules-untagged", "awsome")
+	if names := categoryNames(untaggedID); len(names) != 0 {
+		t.Errorf("expected no categories for a non-matching tag, got %v", names)
+	}
+	status, _ = ts.request("PUT", fmt.Sprintf("/api/v1/notes/%.0f", untaggedID),
+		map[string]interface{}{"guid": "rules-untagged", "title": "rules-untagged", "tags": "aws"})
+	if status != http.StatusOK {
+		t.Fatalf("failed to update note: %d", status)
+	}
+	if names := categoryNames(untaggedID); len(names) != 1 {
+		t.Errorf("expected the rule to apply on update, got %v", names)
+	}
+
+	if names := categoryNames(existingID); len(names) != 0 {
+		t.Fatalf("expected the existing note to be untouched before apply-all, got %v", names)
+	}
+	status, resp = ts.request("POST", "/api/v1/category-rules/apply-all", nil)
+	if status != http.StatusOK {
+		t.Fatalf("apply-all failed: %d", status)
+	}
+	if added := resp["data"].(map[string]interface{})["categories_added"].(float64); added != 1 {
+		t.Errorf("expected apply-all to add 1 category, got %.0f", added)
+	}
+	if names := categoryNames(existingID); len(names) != 1 {
+		t.Errorf("expected apply-all to link the existing note, got %v", names)
+	}
+
+	status, resp = ts.request("GET", "/api/v1/category-rules", nil)
+	if status != http.StatusOK || len(resp["data"].([]interface{})) != 1 {
+		t.Errorf("expected 1 rule listed, got %d %v", status, resp["data"])
+	}
+
+	if status, _ := ts.request("POST", "/api/v1/category-rules", map[string]interface{}{"tag_pattern": "[", "category_id": catID}); status != http.StatusBadRequest {
+		t.Errorf("expected %d for a malformed pattern, got %d", http.StatusBadRequest, status)
+	}
+	if status, _ := ts.request("POST", "/api/v1/category-rules", map[string]interface{}{"tag_pattern": "aws", "category_id": 99999}); status != http.StatusNotFound {
+		t.Errorf("expected %d for an unknown category, got %d", http.StatusNotFound, status)
+	}
+}
+
+// TestNoteCategoryMappingsAPI verifies that the bulk mappings endpoint returns
+// every mapping on the caller's notes and nothing from other users.
+func TestNoteCategoryMappingsAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	// addMapping creates a note and a category as the current user and links them
+	addMapping := func(t *testing.T, ts *testServer, guid string) {
+		t.Helper()
+		status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": guid, "title": guid})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create note: %d", status)
+		}
+		noteID := resp["data"].(map[string]interface{})["id"].(float64)
+
+		status, resp = ts.request("POST", "/api/v1/categories", map[string]interface{}{"name": guid + "-cat"})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create category: %d", status)
+		}
+		categoryID := resp["data"].(map[string]interface{})["id"].(float64)
+
+		status, _ = ts.request("POST", fmt.Sprintf("/api/v1/notes/%.0f/categories/%.0f", noteID, categoryID), nil)
+		if status != http.StatusCreated {
+			t.Fatalf("failed to add category to note: %d", status)
+		}
+	}
+
+	addMapping(t, ts, "mapping-note-a")
+	addMapping(t, ts, "mapping-note-b")
+
+	// A second user with a mapping of their own
+	status, resp := ts.request("POST", "/api/v1/auth/register", map[string]string{
+		"username":            "mappingother",
+		"password":            "otherpassword123",
+		"registration_secret": "test-reg-secret",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to register second user: %d", status)
+	}
+	other := *ts
+	other.authToken = resp["data"].(map[string]interface{})["token"].(string)
+	addMapping(t, &other, "mapping-note-other")
+
+	status, resp = ts.request("GET", "/api/v1/notes/category-mappings", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	mappings := resp["data"].([]interface{})
+	if len(mappings) != 2 {
+		t.Fatalf("expected 2 mappings for the first user, got %d: %v", len(mappings), mappings)
+	}
+	for _, m := range mappings {
+		if name := m.(map[string]interface{})["category_name"]; name == "mapping-note-other-cat" {
+			t.Errorf("mappings leaked another user's category: %v", m)
+		}
+	}
+
+	status, resp = other.request("GET", "/api/v1/notes/category-mappings", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	if mappings := resp["data"].([]interface{}); len(mappings) != 1 {
+		t.Errorf("expected 1 mapping for the second user, got %d", len(mappings))
+	}
+}
+
+// TestListCategoriesWithCounts verifies that ?with_counts=true reports each
+// category's count of the user's non-deleted notes, including zero.
+func TestListCategoriesWithCounts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	createCategory := func(name string) float64 {
+		t.Helper()
+		status, resp := ts.request("POST", "/api/v1/categories", map[string]interface{}{"name": name})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create category %s: %d", name, status)
+		}
+		return resp["data"].(map[string]interface{})["id"].(float64)
+	}
+	createNoteIn := func(guid string, categoryID float64) float64 {
+		t.Helper()
+		status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": guid, "title": guid})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create note %s: %d", guid, status)
+		}
+		noteID := resp["data"].(map[string]interface{})["id"].(float64)
+		status, _ = ts.request("POST", fmt.Sprintf("/api/v1/notes/%.0f/categories/%.0f", noteID, categoryID), nil)
+		if status != http.StatusCreated {
+			t.Fatalf("failed to add category to note: %d", status)
+		}
+		return noteID
+	}
+
+	busy := createCategory("count-busy")
+	createCategory("count-empty")
+	createNoteIn("count-note-1", busy)
+	createNoteIn("count-note-2", busy)
+	deleted := createNoteIn("count-note-deleted", busy)
+
+	if status, _ := ts.request("DELETE", fmt.Sprintf("/api/v1/notes/%.0f", deleted), nil); status != http.StatusOK {
+		t.Fatalf("failed to delete note: %d", status)
+	}
+
+	status, resp := ts.request("GET", "/api/v1/categories?with_counts=true", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+	}
+
+	counts := map[string]float64{}
+	for _, c := range resp["data"].([]interface{}) {
+		cat := c.(map[string]interface{})
+		counts[cat["name"].(string)] = cat["note_count"].(float64)
+	}
+	if counts["count-busy"] != 2 {
+		t.Errorf("expected 2 notes in count-busy (deleted excluded), got %v", counts["count-busy"])
+	}
+	if n, ok := counts["count-empty"]; !ok || n != 0 {
+		t.Errorf("expected count-empty with 0 notes, got %v (present=%v)", n, ok)
+	}
+
+	// Without the flag the response is unchanged
+	status, resp = ts.request("GET", "/api/v1/categories", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	for _, c := range resp["data"].([]interface{}) {
+		if _, ok := c.(map[string]interface{})["note_count"]; ok {
+			t.Errorf("expected no note_count without with_counts: %v", c)
+		}
+	}
+}
+
+// TestDeleteLinkedCategory verifies that a category with linked notes can
+// only be deleted with force=true, which also unlinks the notes.
+func TestDeleteLinkedCategory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/categories", map[string]interface{}{"name": "linked"})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create category: %d", status)
+	}
+	categoryID := resp["data"].(map[string]interface{})["id"].(float64)
+
+	status, resp = ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": "linked-note", "title": "linked"})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d", status)
+	}
+	noteID := resp["data"].(map[string]interface{})["id"].(float64)
+
+	status, _ = ts.request("POST", fmt.Sprintf("/api/v1/notes/%.0f/categories/%.0f", noteID, categoryID), nil)
+	if status != http.StatusCreated {
+		t.Fatalf("failed to add category to note: %d", status)
+	}
+
+	status, resp = ts.request("DELETE", fmt.Sprintf("/api/v1/categories/%.0f", categoryID), nil)
+	if status != http.StatusConflict || resp["code"] != api.ErrCodeConflict {
+		t.Fatalf("expected 409 CONFLICT for linked category, got %d – %v", status, resp)
+	}
+
+	status, resp = ts.request("DELETE", fmt.Sprintf("/api/v1/categories/%.0f?force=true", categoryID), nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected forced delete to succeed, got %d – %v", status, resp)
+	}
+
+	status, _ = ts.request("GET", fmt.Sprintf("/api/v1/categories/%.0f", categoryID), nil)
+	if status != http.StatusNotFound {
+		t.Errorf("expected deleted category to be gone, got %d", status)
+	}
+	status, resp = ts.request("GET", fmt.Sprintf("/api/v1/notes/%.0f/categories", noteID), nil)
+	if status != http.StatusOK {
+		t.Fatalf("failed to get note categories: %d", status)
+	}
+	if cats, _ := resp["data"].([]interface{}); len(cats) != 0 {
+		t.Errorf("expected note to have no categories, got %v", cats)
+	}
+}
+
+// TestCategoryOwnershipScoping verifies that categories are private to their
+// owner and that two users can each have a category with the same name.
+func TestCategoryOwnershipScoping(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/auth/register", map[string]string{
+		"username":            "scopeother",
+		"password":            "otherpassword123",
+		"registration_secret": "test-reg-secret",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to register second user: %d", status)
+	}
+	other := *ts
+	other.authToken = resp["data"].(map[string]interface{})["token"].(string)
+
+	// Each user creates a same-named category and files a note under it
+	setup := func(ts *testServer, noteGUID string) float64 {
+		t.Helper()
+		status, resp := ts.request("POST", "/api/v1/categories", map[string]interface{}{"name": "shared-name"})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create category: %d – %v", status, resp)
+		}
+		categoryID := resp["data"].(map[string]interface{})["id"].(float64)
+
+		status, resp = ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": noteGUID, "title": noteGUID})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create note: %d", status)
+		}
+		noteID := resp["data"].(map[string]interface{})["id"].(float64)
+
+		status, _ = ts.request("POST", fmt.Sprintf("/api/v1/notes/%.0f/categories/%.0f", noteID, categoryID), nil)
+		if status != http.StatusCreated {
+			t.Fatalf("failed to add category to note: %d", status)
+		}
+		return categoryID
+	}
+	mineID := setup(ts, "scope-note-mine")
+	theirsID := setup(&other, "scope-note-theirs")
+
+	if mineID == theirsID {
+		t.Fatal("expected distinct categories for each user")
+	}
+
+	status, resp = ts.request("GET", "/api/v1/categories", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	for _, c := range resp["data"].([]interface{}) {
+		if id := c.(map[string]interface{})["id"].(float64); id == theirsID {
+			t.Errorf("first user's list includes the second user's category %v", c)
+		}
+	}
+
+	if status, _ := ts.request("GET", fmt.Sprintf("/api/v1/categories/%.0f", theirsID), nil); status != http.StatusNotFound {
+		t.Errorf("expected 404 fetching another user's category, got %d", status)
+	}
+
+	status, resp = ts.request("GET", "/api/v1/notes?cat=shared-name", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	notes := resp["data"].([]interface{})
+	if len(notes) != 1 || notes[0].(map[string]interface{})["guid"] != "scope-note-mine" {
+		t.Errorf("expected only the first user's note under shared-name, got %v", notes)
+	}
+}
+
+// TestCategoryMsgPackEncoding verifies that category create and update honor
+// X-Body-Encoding: msgpack for the description, and that plain JSON clients
+// see the same category.
+func TestCategoryMsgPackEncoding(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	msgpackRequest := func(method, path, name, description string) (int, map[string]interface{}) {
+		t.Helper()
+		encoded, err := models.EncodeMsgPackBody(&description)
+		if err != nil {
+			t.Fatalf("failed to encode description: %v", err)
+		}
+		body, _ := json.Marshal(map[string]interface{}{"name": name, "description_encoded": encoded})
+		req, _ := http.NewRequest(method, ts.baseURL+path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+ts.authToken)
+		req.Header.Set("X-Body-Encoding", "msgpack")
+		resp, err := ts.client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+	decodedDescription := func(data map[string]interface{}) string {
+		t.Helper()
+		if _, ok := data["description"]; ok {
+			t.Errorf("msgpack response should carry description_encoded, not description: %v", data)
+		}
+		encoded, _ := data["description_encoded"].(string)
+		decoded, err := models.DecodeMsgPackBody(encoded)
+		if err != nil || decoded == nil {
+			t.Fatalf("failed to decode description_encoded %q: %v", encoded, err)
+		}
+		return *decoded
+	}
+
+	longDesc := strings.Repeat("A long description with \"quotes\", unicode ✓ and\nnewlines. ", 200)
+	status, resp := msgpackRequest("POST", "/api/v1/categories", "msgpack-cat", longDesc)
+	if status != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d – %v", http.StatusCreated, status, resp)
+	}
+	data := resp["data"].(map[string]interface{})
+	if got := decodedDescription(data); got != longDesc {
+		t.Error("description did not round-trip through msgpack create")
+	}
+	catPath := fmt.Sprintf("/api/v1/categories/%.0f", data["id"].(float64))
+
+	// A JSON client reads the same description back in plain form
+	status, resp = ts.request("GET", catPath, nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	if resp["data"].(map[string]interface{})["description"] != longDesc {
+		t.Error("plain JSON read should return the decoded description")
+	}
+
+	status, resp = msgpackRequest("PUT", catPath, "msgpack-cat", "updated description")
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+	}
+	if got := decodedDescription(resp["data"].(map[string]interface{})); got != "updated description" {
+		t.Errorf("expected updated description, got %q", got)
+	}
+
+	// Plain JSON create is unaffected
+	status, resp = ts.request("POST", "/api/v1/categories", map[string]interface{}{
+		"name": "json-cat", "description": "plain",
+	})
+	if status != http.StatusCreated || resp["data"].(map[string]interface{})["description"] != "plain" {
+		t.Errorf("expected plain JSON create to work, got %d – %v", status, resp)
+	}
+
+	// A malformed encoding is rejected
+	req, _ := http.NewRequest("POST", ts.baseURL+"/api/v1/categories",
+		strings.NewReader(`{"name":"bad","description_encoded":"not base64!"}`))
+	req.Header.Set("Authorization", "Bearer "+ts.authToken)
+	req.Header.Set("X-Body-Encoding", "msgpack")
+	badResp, err := ts.client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	badResp.Body.Close()
+	if badResp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d for bad encoding, got %d", http.StatusBadRequest, badResp.StatusCode)
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"gonotes/models"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/rweb"
+	"github.com/rohanthewiz/serr"
+)
+
+// createCategoryRuleRequest is the body of POST /api/v1/category-rules.
+type createCategoryRuleRequest struct {
+	TagPattern string `json:"tag_pattern"`
+	CategoryID int64  `json:"category_id"`
+}
+
+// CreateCategoryRule handles POST /api/v1/category-rules
+// Adds a rule linking the user's notes tagged with tag_pattern to the
+// category category_id. The rule applies to notes as they are saved from
+// now on; POST /api/v1/category-rules/apply-all applies it to existing ones.
+func CreateCategoryRule(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	var req createCategoryRuleRequest
+	if err := json.Unmarshal(ctx.Request().Body(), &req); err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
+	}
+	if req.CategoryID <= 0 {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "category_id is required")
+	}
+
+	rule, err := models.CreateCategoryRule(userGUID, req.TagPattern, req.CategoryID)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidTagPattern) {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation,
+				"tag_pattern must be a single tag, optionally with * ? [ ] wildcards")
+		}
+		if err.Error() == "category not found" {
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "category not found")
+		}
+		logger.LogErr(serr.Wrap(err, "failed to create category rule"), "database error")
+		return writeModelError(ctx, err, "database error")
+	}
+
+	logger.Info("Category rule created", "tag_pattern", rule.TagPattern, "category_id", rule.CategoryID, "user", userGUID)
+	return writeSuccess(ctx, http.StatusCreated, rule)
+}
+
+// ListCategoryRules handles GET /api/v1/category-rules
+// Returns the user's category rules, oldest first.
+func ListCategoryRules(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	rules, err := models.ListCategoryRules(userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to list category rules"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+	return writeSuccess(ctx, http.StatusOK, rules)
+}
+
+// ApplyAllCategoryRules handles POST /api/v1/category-rules/apply-all
+// Runs the user's category rules over all of their existing tagged notes.
+// Safe to repeat: categories a note already has are left alone.
+func ApplyAllCategoryRules(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	notes, added, err := models.ApplyCategoryRulesToAllNotes(userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to apply category rules"), "database error")
+		return writeModelError(ctx, err, "database error")
+	}
+
+	logger.Info("Category rules applied", "notes", notes, "categories_added", added, "user", userGUID)
+	return writeSuccess(ctx, http.StatusOK, map[string]interface{}{
+		"notes_checked":    notes,
+		"categories_added": added,
+	})
+}
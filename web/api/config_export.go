@@ -45,12 +45,12 @@ type SpokeExportConfig struct {
 func ExportSpokeConfig(ctx rweb.Context) error {
 	// Admin authorization — only admins can export spoke configs
 	if !IsAdmin(ctx) {
-		return writeError(ctx, http.StatusForbidden, "admin access required")
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "admin access required")
 	}
 
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	// Parse the password from the request body
@@ -58,10 +58,10 @@ func ExportSpokeConfig(ctx rweb.Context) error {
 		Password string `json:"password"`
 	}
 	if err := json.Unmarshal(ctx.Request().Body(), &req); err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid request body")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid request body")
 	}
 	if req.Password == "" {
-		return writeError(ctx, http.StatusBadRequest, "password is required for config export")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "password is required for config export")
 	}
 
 	// Re-verify the admin's password against the bcrypt hash in the database.
@@ -70,11 +70,11 @@ func ExportSpokeConfig(ctx rweb.Context) error {
 	user, err := models.GetUserByGUID(userGUID)
 	if err != nil || user == nil {
 		logger.LogErr(serr.Wrap(err, "failed to get user for config export"), "user_guid", userGUID)
-		return writeError(ctx, http.StatusInternalServerError, "failed to verify user")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to verify user")
 	}
 
 	if !models.CheckPassword(req.Password, user.PasswordHash) {
-		return writeError(ctx, http.StatusUnauthorized, "incorrect password")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "incorrect password")
 	}
 
 	// Auto-generate an invite token so the spoke can self-register.
@@ -82,7 +82,7 @@ func ExportSpokeConfig(ctx rweb.Context) error {
 	inviteToken, err := models.CreateInviteToken(userGUID, 72*time.Hour)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to create invite token for export"), "user_guid", userGUID)
-		return writeError(ctx, http.StatusInternalServerError, "failed to create invite token")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to create invite token")
 	}
 
 	// Build the hub URL from the incoming request headers.
@@ -102,7 +102,7 @@ func ExportSpokeConfig(ctx rweb.Context) error {
 
 	configJSON, err := json.MarshalIndent(exportCfg, "", "  ")
 	if err != nil {
-		return writeError(ctx, http.StatusInternalServerError, "failed to serialize config")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to serialize config")
 	}
 
 	logger.Info("Spoke config exported", "admin", userGUID, "username", user.Username)
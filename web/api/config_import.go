@@ -31,19 +31,19 @@ func ApplySpokeConfig(ctx rweb.Context) error {
 	// First-run guard — if sync is already enabled, refuse to overwrite.
 	// This prevents a rogue request from reconfiguring a live spoke.
 	if strings.EqualFold(os.Getenv("GONOTES_SYNC_ENABLED"), "true") {
-		return writeError(ctx, http.StatusForbidden,
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden,
 			"sync is already configured; edit the .env file manually to reconfigure")
 	}
 
 	// Parse the import config
 	var cfg SpokeExportConfig
 	if err := json.Unmarshal(ctx.Request().Body(), &cfg); err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid config JSON")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid config JSON")
 	}
 
 	// Validate required fields — without these, sync can't function
 	if cfg.HubURL == "" || cfg.Username == "" || cfg.PasswordB64 == "" {
-		return writeError(ctx, http.StatusBadRequest,
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation,
 			"hub_url, username, and password_b64 are required")
 	}
 
@@ -55,7 +55,7 @@ func ApplySpokeConfig(ctx rweb.Context) error {
 	// Write the .env file with restrictive permissions (owner read/write only)
 	if err := writeEnvFile(cfg); err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to write .env file during setup"), "path", envFilePath)
-		return writeError(ctx, http.StatusInternalServerError,
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal,
 			"failed to write configuration file")
 	}
 
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/rohanthewiz/rweb"
+)
+
+// writeSuccessWithETag sends a 200 JSON response like writeSuccess, tagged
+// with an ETag derived from the response bytes. If the request's
+// If-None-Match already names that ETag, it sends 304 Not Modified with no
+// body instead. Hashing the encoded response rather than using updated_at
+// means anything visible to the client (category mappings, the msgpack
+// encoding) changes the tag, not just edits to the entity row.
+func writeSuccessWithETag(ctx rweb.Context, data interface{}) error {
+	body, err := json.Marshal(APIResponse{Success: true, Data: data})
+	if err != nil {
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to encode response")
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	ctx.Response().SetHeader("ETag", etag)
+
+	if etagMatches(ctx.Request().Header("If-None-Match"), etag) {
+		ctx.SetStatus(http.StatusNotModified)
+		return nil
+	}
+
+	ctx.SetStatus(http.StatusOK)
+	ctx.Response().SetHeader("Content-Type", "application/json")
+	return ctx.Bytes(body)
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag.
+// The header may list several tags, or "*" for any. Weak tags (W/"...")
+// compare equal to their strong form, as RFC 9110 requires for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
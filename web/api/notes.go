@@ -1,10 +1,15 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"gonotes/models"
 
@@ -19,8 +24,24 @@ type APIResponse struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"` // Machine-readable error code (ErrCode*), set on errors
 }
 
+// Error codes for APIResponse.Code. They let clients tell failures apart
+// without matching on the human-readable message, which may change.
+const (
+	ErrCodeValidation   = "VALIDATION"   // The request is malformed or fails validation (400)
+	ErrCodeUnauthorized = "UNAUTHORIZED" // Missing or invalid credentials (401)
+	ErrCodeForbidden    = "FORBIDDEN"    // Authenticated but not permitted (403)
+	ErrCodeNotFound     = "NOT_FOUND"    // The entity doesn't exist or isn't the user's (404)
+	ErrCodeConflict     = "CONFLICT"     // Clashes with existing state, e.g. a duplicate GUID (409)
+	ErrCodeGone         = "GONE"         // Existed but is no longer available, e.g. an expired link (410)
+	ErrCodeTooLarge     = "TOO_LARGE"    // The upload or request body exceeds a limit (413)
+	ErrCodeRateLimited  = "RATE_LIMITED" // Too many attempts; retry after the Retry-After header (429)
+	ErrCodeUnavailable  = "UNAVAILABLE"  // A required feature isn't configured or running (503)
+	ErrCodeInternal     = "INTERNAL"     // Server-side failure (500)
+)
+
 // writeSuccess sends a successful JSON response with data.
 // Uses rweb's built-in WriteJSON which sets content-type automatically.
 func writeSuccess(ctx rweb.Context, status int, data interface{}) error {
@@ -28,14 +49,26 @@ func writeSuccess(ctx rweb.Context, status int, data interface{}) error {
 	return ctx.WriteJSON(APIResponse{Success: true, Data: data})
 }
 
-// writeError sends an error JSON response.
-func writeError(ctx rweb.Context, status int, message string) error {
+// writeError sends an error JSON response with a machine-readable code
+// (one of the ErrCode* constants) alongside the human-readable message.
+func writeError(ctx rweb.Context, status int, code, message string) error {
 	ctx.SetStatus(status)
-	return ctx.WriteJSON(APIResponse{Success: false, Error: message})
+	return ctx.WriteJSON(APIResponse{Success: false, Error: message, Code: code})
+}
+
+// writeModelError sends a 500 with message for a failed model call. If the
+// call was refused with models.ErrReadOnly (read-only mode came on after the
+// request passed ReadOnlyMiddleware), it sends the middleware's 503 instead.
+func writeModelError(ctx rweb.Context, err error, message string) error {
+	if errors.Is(err, models.ErrReadOnly) {
+		return writeError(ctx, http.StatusServiceUnavailable, ErrCodeUnavailable, "read-only mode")
+	}
+	return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, message)
 }
 
 // CreateNote handles POST /api/v1/notes
-// Creates a new note from JSON body and returns the created note.
+// Creates a new note from JSON body and returns the created note. The guid
+// may be omitted, in which case the server generates one.
 // Requires authentication - note is owned by the authenticated user.
 //
 // Content encoding modes:
@@ -45,7 +78,7 @@ func CreateNote(ctx rweb.Context) error {
 	// Authentication check - all note operations require auth
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	var input models.NoteInput
@@ -59,14 +92,14 @@ func CreateNote(ctx rweb.Context) error {
 		var msgpackReq models.MsgPackBodyRequest
 		if err := json.Unmarshal(ctx.Request().Body(), &msgpackReq); err != nil {
 			logger.LogErr(serr.Wrap(err, "failed to decode msgpack request body"), "invalid JSON")
-			return writeError(ctx, http.StatusBadRequest, "invalid JSON body")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
 		}
 
 		// Convert msgpack request to standard NoteInput
 		converted, err := msgpackReq.ToNoteInput()
 		if err != nil {
 			logger.LogErr(serr.Wrap(err, "failed to decode msgpack body"), "msgpack decode error")
-			return writeError(ctx, http.StatusBadRequest, "invalid msgpack body encoding")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid msgpack body encoding")
 		}
 		input = *converted
 	} else {
@@ -74,46 +107,79 @@ func CreateNote(ctx rweb.Context) error {
 		// rweb provides Body() as []byte, so we unmarshal directly
 		if err := json.Unmarshal(ctx.Request().Body(), &input); err != nil {
 			logger.LogErr(serr.Wrap(err, "failed to decode request body"), "invalid JSON")
-			return writeError(ctx, http.StatusBadRequest, "invalid JSON body")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
 		}
 	}
 
-	// Validate required fields
+	// Validate required fields. A note created without a GUID gets one from
+	// the server, returned in the response like any other.
+	input.GUID = models.NormalizeGUID(input.GUID)
 	if input.GUID == "" {
-		return writeError(ctx, http.StatusBadRequest, "guid is required")
+		input.GUID = models.NewNoteGUID()
+	}
+	if err := models.ValidateGUID(input.GUID); err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, err.Error())
 	}
 	if input.Title == "" {
-		return writeError(ctx, http.StatusBadRequest, "title is required")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "title is required")
+	}
+
+	// A retried request carrying an already processed Idempotency-Key gets
+	// the original response, before the duplicate GUID check would turn the
+	// retry into a 409
+	idemKey := ctx.Request().Header(models.IdempotencyKeyHeader)
+	if idemKey != "" {
+		prior, err := models.LookupIdempotencyKey(idemKey, userGUID)
+		if err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to check idempotency key"), "database error")
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+		}
+		if prior != nil {
+			note, err := models.GetNoteByID(prior.NoteID, userGUID)
+			if err != nil {
+				logger.LogErr(serr.Wrap(err, "failed to get note for idempotency key"), "database error")
+				return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+			}
+			if note != nil {
+				logger.Info("Replayed idempotent note create", "id", note.ID, "guid", note.GUID, "user", userGUID)
+				return writeSuccess(ctx, http.StatusCreated, json.RawMessage(prior.Response))
+			}
+			// The note has since been deleted — treat the key as fresh
+		}
 	}
 
 	// Check for duplicate GUID to provide clear error message
 	existing, err := models.GetNoteByGUID(input.GUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to check existing note"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
 	}
 	if existing != nil {
-		return writeError(ctx, http.StatusConflict, "note with this guid already exists")
+		return writeError(ctx, http.StatusConflict, ErrCodeConflict, "note with this guid already exists")
 	}
 
 	// Create the note with user ownership
 	// Note: CreateNote may return both a note AND an error if disk write succeeded
 	// but cache update failed. In this case, we still return success since the
 	// disk DB is the source of truth.
-	logger.Debug("API CreateNote: calling models.CreateNote", "guid", input.GUID, "title", input.Title)
+	if models.DebugLoggingEnabled() {
+		logger.Debug("API CreateNote: calling models.CreateNote", "guid", input.GUID, "title", input.Title)
+	}
 
 	note, err := models.CreateNote(input, userGUID)
 
-	logger.Debug("API CreateNote: models.CreateNote returned",
-		"note_is_nil", note == nil,
-		"err_is_nil", err == nil,
-		"err_msg", func() string {
-			if err != nil {
-				return err.Error()
-			}
-			return ""
-		}(),
-	)
+	if models.DebugLoggingEnabled() {
+		logger.Debug("API CreateNote: models.CreateNote returned",
+			"note_is_nil", note == nil,
+			"err_is_nil", err == nil,
+			"err_msg", func() string {
+				if err != nil {
+					return err.Error()
+				}
+				return ""
+			}(),
+		)
+	}
 
 	if err != nil {
 		if note != nil {
@@ -130,60 +196,132 @@ func CreateNote(ctx rweb.Context) error {
 		}
 		// Complete failure - disk write failed
 		logger.LogErr(serr.Wrap(err, "failed to create note"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to create note")
+		return writeModelError(ctx, err, "failed to create note")
 	}
 
 	logger.Info("Note created", "id", note.ID, "guid", note.GUID, "user", userGUID)
 
 	// Return msgpack-encoded response if client requested it
-	output := note.ToOutput()
+	var data interface{} = note.ToOutput()
 	if useMsgPack {
-		msgpackResp, err := output.ToMsgPackResponse()
-		if err != nil {
+		output := data.(models.NoteOutput)
+		if msgpackResp, err := output.ToMsgPackResponse(); err != nil {
 			// Fallback to standard JSON if msgpack encoding fails
 			logger.LogErr(err, "failed to encode msgpack response, falling back to JSON")
-			return writeSuccess(ctx, http.StatusCreated, output)
+		} else {
+			data = msgpackResp
+		}
+	}
+
+	if idemKey != "" {
+		// The note exists either way; a lost key only costs retry protection
+		response, err := json.Marshal(data)
+		if err == nil {
+			err = models.SaveIdempotencyKey(idemKey, userGUID, note.ID, response)
+		}
+		if err != nil {
+			logger.LogErr(err, "failed to save idempotency key", "note_id", note.ID)
 		}
-		return writeSuccess(ctx, http.StatusCreated, msgpackResp)
 	}
-	return writeSuccess(ctx, http.StatusCreated, output)
+
+	return writeSuccess(ctx, http.StatusCreated, data)
 }
 
 // GetNote handles GET /api/v1/notes/:id
 // Retrieves a single note by ID. Only returns notes owned by the authenticated user.
-// Supports msgpack body encoding via X-Body-Encoding: msgpack header.
+// Supports msgpack body encoding via X-Body-Encoding: msgpack header, and
+// conditional requests via ETag / If-None-Match.
 func GetNote(ctx rweb.Context) error {
 	// Authentication check - all note operations require auth
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	idStr := ctx.Request().Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid note id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
 	}
 
 	// GetNoteByID filters by user ownership
 	note, err := models.GetNoteByID(id, userGUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to get note"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
 	}
 	if note == nil {
-		return writeError(ctx, http.StatusNotFound, "note not found")
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
 	}
 
 	// Return msgpack-encoded response if client requested it
 	output := note.ToOutput()
 	if ctx.Request().Header("X-Body-Encoding") == "msgpack" {
 		if msgpackResp, encErr := output.ToMsgPackResponse(); encErr == nil {
-			return writeSuccess(ctx, http.StatusOK, msgpackResp)
+			return writeSuccessWithETag(ctx, msgpackResp)
 		}
 		// Fallback to JSON on encoding error
 	}
-	return writeSuccess(ctx, http.StatusOK, output)
+	return writeSuccessWithETag(ctx, output)
+}
+
+// GetNoteRaw handles GET /api/v1/notes/:id/raw
+// Returns the note body exactly as stored, without the JSON envelope, as
+// text/markdown. The title becomes the Content-Disposition filename. Reads
+// come from the cache, where private notes are already decrypted. Only
+// returns notes owned by the authenticated user.
+func GetNoteRaw(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	id, err := strconv.ParseInt(ctx.Request().Param("id"), 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
+	}
+
+	note, err := models.GetNoteByID(id, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get note"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+	if note == nil {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
+	}
+
+	filename := rawNoteFilename(note.Title)
+	ctx.Response().SetHeader("Content-Type", "text/markdown; charset=utf-8")
+	ctx.Response().SetHeader("Content-Disposition",
+		fmt.Sprintf(`inline; filename=%q; filename*=UTF-8''%s`, asciiFilename(filename), url.PathEscape(filename)))
+	ctx.SetStatus(http.StatusOK)
+	return ctx.Bytes([]byte(note.Body.String))
+}
+
+// rawNoteFilename derives a .md filename from a note title, replacing path
+// separators, quotes, and control characters. An empty title gives "note.md".
+func rawNoteFilename(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`/\"`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if name == "" {
+		name = "note"
+	}
+	return name + ".md"
+}
+
+// asciiFilename replaces non-ASCII characters with '_' for the plain
+// filename parameter; clients that understand filename* get the real name.
+func asciiFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 0x7e {
+			return '_'
+		}
+		return r
+	}, name)
 }
 
 // ListNotes handles GET /api/v1/notes
@@ -194,15 +332,24 @@ func GetNote(ctx rweb.Context) error {
 //   - offset: Number of results to skip (default: 0)
 //   - cat: Filter by category name (e.g., ?cat=k8s)
 //   - subcats[]: Filter by subcategories within the category (e.g., ?cat=k8s&subcats[]=pod&subcats[]=replicaset)
+//   - modified_since: RFC3339 timestamp; only notes updated after it, oldest first
+//   - sort: "popular" lists the most viewed notes first (not combinable with cat or modified_since)
+//   - starred: "true" lists only starred notes (not combinable with cat, modified_since, or sort)
+//   - created_after, created_before: RFC3339 timestamps; only notes created
+//     within them, inclusive (combinable with any other filter)
+//   - with_total: "true" wraps the result as {items, total, limit, offset}, where
+//     total counts every note matching the filters, ignoring limit and offset
 //
 // When cat is provided, returns only notes in that category.
 // When both cat and subcats[] are provided, returns notes that match the category
-// AND have ALL the specified subcategories.
+// AND have ALL the specified subcategories. More than MaxSubcategoryFilters
+// subcats[] values (GONOTES_MAX_SUBCATEGORY_FILTERS, default 20) is a 400.
+// modified_since takes precedence over cat.
 func ListNotes(ctx rweb.Context) error {
 	// Authentication check - all note operations require auth
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	// Parse pagination parameters with sensible defaults
@@ -212,7 +359,7 @@ func ListNotes(ctx rweb.Context) error {
 	if limitStr := ctx.Request().QueryParam("limit"); limitStr != "" {
 		parsedLimit, err := strconv.Atoi(limitStr)
 		if err != nil || parsedLimit < 0 {
-			return writeError(ctx, http.StatusBadRequest, "invalid limit parameter")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid limit parameter")
 		}
 		limit = parsedLimit
 	}
@@ -220,7 +367,7 @@ func ListNotes(ctx rweb.Context) error {
 	if offsetStr := ctx.Request().QueryParam("offset"); offsetStr != "" {
 		parsedOffset, err := strconv.Atoi(offsetStr)
 		if err != nil || parsedOffset < 0 {
-			return writeError(ctx, http.StatusBadRequest, "invalid offset parameter")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid offset parameter")
 		}
 		offset = parsedOffset
 	}
@@ -237,38 +384,113 @@ func ListNotes(ctx rweb.Context) error {
 			subcategories = queryValues["subcats[]"]
 		}
 	}
+	if maxSubcats := models.MaxSubcategoryFilters(); len(subcategories) > maxSubcats {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation,
+			"too many subcats[] parameters: at most "+strconv.Itoa(maxSubcats)+" allowed")
+	}
+
+	withTotal := false
+	if withTotalStr := ctx.Request().QueryParam("with_total"); withTotalStr != "" {
+		parsed, err := strconv.ParseBool(withTotalStr)
+		if err != nil {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid with_total parameter")
+		}
+		withTotal = parsed
+	}
+
+	// created_after and created_before bound the listing by creation time,
+	// inclusive; either may be given alone
+	var created models.CreatedRange
+	if afterStr := ctx.Request().QueryParam("created_after"); afterStr != "" {
+		after, err := time.Parse(time.RFC3339, afterStr)
+		if err != nil {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid created_after parameter: must be RFC3339 format")
+		}
+		created.After = after
+	}
+	if beforeStr := ctx.Request().QueryParam("created_before"); beforeStr != "" {
+		before, err := time.Parse(time.RFC3339, beforeStr)
+		if err != nil {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid created_before parameter: must be RFC3339 format")
+		}
+		created.Before = before
+	}
+	if !created.After.IsZero() && !created.Before.IsZero() && created.After.After(created.Before) {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "created_after must not be later than created_before")
+	}
 
 	var notes []models.Note
 	var err error
+	filter := models.NoteListFilter{Created: created}
+
+	// modified_since returns the current state of notes changed after a
+	// time, for incremental client refreshes
+	modifiedSince := ctx.Request().QueryParam("modified_since")
+
+	// sort=popular lists the most viewed notes first
+	sortOrder := ctx.Request().QueryParam("sort")
+	if sortOrder != "" && sortOrder != "popular" {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid sort parameter: must be popular")
+	}
+	if sortOrder == "popular" && (modifiedSince != "" || categoryName != "") {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "sort=popular can't be combined with cat or modified_since")
+	}
+
+	// starred=true lists only starred notes
+	if starredStr := ctx.Request().QueryParam("starred"); starredStr != "" {
+		parsed, err := strconv.ParseBool(starredStr)
+		if err != nil {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid starred parameter")
+		}
+		filter.Starred = parsed
+	}
+	if filter.Starred && (sortOrder != "" || modifiedSince != "" || categoryName != "") {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "starred=true can't be combined with cat, modified_since, or sort")
+	}
 
-	if categoryName != "" {
+	if filter.Starred {
+		notes, err = models.ListStarredNotesInRange(userGUID, created, limit, offset)
+		if err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to list starred notes"), "database error")
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+		}
+	} else if sortOrder == "popular" {
+		notes, err = models.ListNotesByViewsInRange(userGUID, created, limit, offset)
+		if err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to list notes by views"), "database error")
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+		}
+	} else if modifiedSince != "" {
+		since, err := time.Parse(time.RFC3339, modifiedSince)
+		if err != nil {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid modified_since parameter: must be RFC3339 format")
+		}
+		filter.ModifiedSince = since
+		notes, err = models.ListNotesModifiedSince(userGUID, since)
+		if err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to list notes modified since"), "database error")
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+		}
+		notes = paginateNotes(created.Filter(notes), limit, offset)
+	} else if categoryName != "" {
 		// Filter by category (and optionally subcategories) with user scoping
+		filter.Category = categoryName
+		filter.Subcategories = subcategories
 		if len(subcategories) > 0 {
-			notes, err = models.GetNotesByCategoryAndSubcategories(categoryName, subcategories, userGUID)
+			notes, err = models.GetNotesByCategoryAndSubcategoriesInRange(categoryName, subcategories, userGUID, created, limit, offset)
 		} else {
-			notes, err = models.GetNotesByCategoryName(categoryName, userGUID)
+			notes, err = models.GetNotesByCategoryNameInRange(categoryName, userGUID, created, limit, offset)
 		}
 		if err != nil {
 			logger.LogErr(serr.Wrap(err, "failed to get notes by category"), "database error")
-			return writeError(ctx, http.StatusInternalServerError, "database error")
-		}
-
-		// Apply pagination manually for category-filtered results
-		// (The category query functions don't support pagination directly)
-		if offset > 0 && offset < len(notes) {
-			notes = notes[offset:]
-		} else if offset >= len(notes) {
-			notes = []models.Note{}
-		}
-		if limit > 0 && limit < len(notes) {
-			notes = notes[:limit]
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
 		}
 	} else {
 		// No category filter - use standard ListNotes with pagination and user scoping
-		notes, err = models.ListNotes(userGUID, limit, offset)
+		notes, err = models.ListNotesInRange(userGUID, created, limit, offset)
 		if err != nil {
 			logger.LogErr(serr.Wrap(err, "failed to list notes"), "database error")
-			return writeError(ctx, http.StatusInternalServerError, "database error")
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
 		}
 	}
 
@@ -278,6 +500,8 @@ func ListNotes(ctx rweb.Context) error {
 		outputs[i] = note.ToOutput()
 	}
 
+	var items interface{} = outputs
+
 	// Return msgpack-encoded response if client requested it
 	if ctx.Request().Header("X-Body-Encoding") == "msgpack" {
 		msgpackOutputs := make([]models.MsgPackBodyResponse, 0, len(outputs))
@@ -289,10 +513,46 @@ func ListNotes(ctx rweb.Context) error {
 				logger.LogErr(encErr, "failed to encode msgpack response for note", "id", output.ID)
 			}
 		}
-		return writeSuccess(ctx, http.StatusOK, msgpackOutputs)
+		items = msgpackOutputs
 	}
 
-	return writeSuccess(ctx, http.StatusOK, outputs)
+	if !withTotal {
+		return writeSuccess(ctx, http.StatusOK, items)
+	}
+
+	total, err := models.CountNotes(userGUID, filter)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to count notes"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+	return writeSuccess(ctx, http.StatusOK, noteListPage{
+		Items:  items,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// noteListPage is the ListNotes response with with_total=true.
+type noteListPage struct {
+	Items  interface{} `json:"items"`
+	Total  int         `json:"total"` // Notes matching the filters, across all pages
+	Limit  int         `json:"limit"` // 0 means no limit
+	Offset int         `json:"offset"`
+}
+
+// paginateNotes applies limit and offset to an already fetched result set,
+// for list queries that don't paginate in SQL. limit=0 means no limit.
+func paginateNotes(notes []models.Note, limit, offset int) []models.Note {
+	if offset > 0 && offset < len(notes) {
+		notes = notes[offset:]
+	} else if offset >= len(notes) {
+		notes = []models.Note{}
+	}
+	if limit > 0 && limit < len(notes) {
+		notes = notes[:limit]
+	}
+	return notes
 }
 
 // UpdateNote handles PUT /api/v1/notes/:id
@@ -303,13 +563,13 @@ func UpdateNote(ctx rweb.Context) error {
 	// Authentication check - all note operations require auth
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	idStr := ctx.Request().Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid note id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
 	}
 
 	var input models.NoteInput
@@ -322,47 +582,51 @@ func UpdateNote(ctx rweb.Context) error {
 		var msgpackReq models.MsgPackBodyRequest
 		if err := json.Unmarshal(ctx.Request().Body(), &msgpackReq); err != nil {
 			logger.LogErr(serr.Wrap(err, "failed to decode msgpack request body"), "invalid JSON")
-			return writeError(ctx, http.StatusBadRequest, "invalid JSON body")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
 		}
 
 		// Convert msgpack request to standard NoteInput
 		converted, err := msgpackReq.ToNoteInput()
 		if err != nil {
 			logger.LogErr(serr.Wrap(err, "failed to decode msgpack body"), "msgpack decode error")
-			return writeError(ctx, http.StatusBadRequest, "invalid msgpack body encoding")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid msgpack body encoding")
 		}
 		input = *converted
 	} else {
 		// Standard JSON body
 		if err := json.Unmarshal(ctx.Request().Body(), &input); err != nil {
 			logger.LogErr(serr.Wrap(err, "failed to decode request body"), "invalid JSON")
-			return writeError(ctx, http.StatusBadRequest, "invalid JSON body")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
 		}
 	}
 
 	// Title is required for updates
 	if input.Title == "" {
-		return writeError(ctx, http.StatusBadRequest, "title is required")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "title is required")
 	}
 
 	// UpdateNote verifies ownership via userGUID
 	// Note: UpdateNote may return both a note AND an error if disk write succeeded
 	// but cache update failed. In this case, we still return success since the
 	// disk DB is the source of truth.
-	logger.Debug("API UpdateNote: calling models.UpdateNote", "id", id, "title", input.Title)
+	if models.DebugLoggingEnabled() {
+		logger.Debug("API UpdateNote: calling models.UpdateNote", "id", id, "title", input.Title)
+	}
 
 	note, err := models.UpdateNote(id, input, userGUID)
 
-	logger.Debug("API UpdateNote: models.UpdateNote returned",
-		"note_is_nil", note == nil,
-		"err_is_nil", err == nil,
-		"err_msg", func() string {
-			if err != nil {
-				return err.Error()
-			}
-			return ""
-		}(),
-	)
+	if models.DebugLoggingEnabled() {
+		logger.Debug("API UpdateNote: models.UpdateNote returned",
+			"note_is_nil", note == nil,
+			"err_is_nil", err == nil,
+			"err_msg", func() string {
+				if err != nil {
+					return err.Error()
+				}
+				return ""
+			}(),
+		)
+	}
 
 	if err != nil {
 		if note != nil {
@@ -379,10 +643,10 @@ func UpdateNote(ctx rweb.Context) error {
 		}
 		// Complete failure - disk write failed
 		logger.LogErr(serr.Wrap(err, "failed to update note"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to update note")
+		return writeModelError(ctx, err, "failed to update note")
 	}
 	if note == nil {
-		return writeError(ctx, http.StatusNotFound, "note not found")
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
 	}
 
 	logger.Info("Note updated", "id", note.ID, "user", userGUID)
@@ -398,13 +662,60 @@ func UpdateNote(ctx rweb.Context) error {
 	return writeSuccess(ctx, http.StatusOK, output)
 }
 
+// PatchNote handles PATCH /api/v1/notes/:id
+// Updates only the fields present in the JSON body, leaving the rest of the
+// note untouched, so a client changing one field needn't resend the whole
+// note. Unlike PUT, title is optional, but it can't be set to empty.
+func PatchNote(ctx rweb.Context) error {
+	// Authentication check - all note operations require auth
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	idStr := ctx.Request().Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
+	}
+
+	var patch models.NotePatch
+	if err := json.Unmarshal(ctx.Request().Body(), &patch); err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to decode patch body"), "invalid JSON")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
+	}
+
+	if patch.Title != nil && *patch.Title == "" {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "title cannot be empty")
+	}
+
+	// As with UpdateNote, a note may come back alongside an error when the
+	// disk write succeeded but the cache update failed
+	note, err := models.PatchNote(id, patch, userGUID)
+	if err != nil {
+		if note != nil {
+			logger.LogErr(err, "note patched but cache update failed", "id", note.ID)
+			return writeSuccess(ctx, http.StatusOK, note.ToOutput())
+		}
+		logger.LogErr(serr.Wrap(err, "failed to patch note"), "database error")
+		return writeModelError(ctx, err, "failed to update note")
+	}
+	if note == nil {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
+	}
+
+	logger.Info("Note patched", "id", note.ID, "user", userGUID)
+	return writeSuccess(ctx, http.StatusOK, note.ToOutput())
+}
+
 // SearchNotes handles GET /api/v1/notes/search?q=query
 // Returns notes matching the query string in their title, for use in note-linking autocomplete.
-// Results include id, guid, and title. Limited to 20 results.
+// Results include id, guid, and title, ranked exact > prefix > contains. Limited to 20 results.
+// With full=true it runs a full-text search instead (see searchNotesFullText).
 func SearchNotes(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	query := ctx.Request().QueryParam("q")
@@ -412,10 +723,14 @@ func SearchNotes(ctx rweb.Context) error {
 		return writeSuccess(ctx, http.StatusOK, []models.NoteOutput{})
 	}
 
-	notes, err := models.SearchNotesByTitle(query, userGUID, 20)
+	if ctx.Request().QueryParam("full") == "true" {
+		return searchNotesFullText(ctx, query, userGUID)
+	}
+
+	notes, err := models.SearchNotesByTitleRanked(query, userGUID, 20)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to search notes"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
 	}
 
 	// Return lightweight output with only id, guid, title for autocomplete
@@ -437,27 +752,177 @@ func SearchNotes(ctx rweb.Context) error {
 	return writeSuccess(ctx, http.StatusOK, results)
 }
 
-// ToggleNoteFlag handles PUT /api/v1/notes/:id/flag
+// searchNotesFullText serves GET /api/v1/notes/search?q=query&full=true.
+// Matches the query against title, description, tags, and body, most recently
+// updated first, limited to 20 results. Each result adds match_field and a
+// snippet: an HTML-escaped excerpt around the first match, with the match
+// wrapped in <mark></mark>.
+func searchNotesFullText(ctx rweb.Context, query, userGUID string) error {
+	found, err := models.SearchNotesWithSnippets(query, userGUID, 20)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to search notes"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	type FullTextResult struct {
+		ID         int64     `json:"id"`
+		GUID       string    `json:"guid"`
+		Title      string    `json:"title"`
+		UpdatedAt  time.Time `json:"updated_at"`
+		MatchField string    `json:"match_field"`
+		Snippet    string    `json:"snippet"`
+	}
+
+	results := make([]FullTextResult, len(found))
+	for i, r := range found {
+		results[i] = FullTextResult{
+			ID:         r.Note.ID,
+			GUID:       r.Note.GUID,
+			Title:      r.Note.Title,
+			UpdatedAt:  r.Note.UpdatedAt,
+			MatchField: r.MatchField,
+			Snippet:    r.Snippet,
+		}
+	}
+
+	return writeSuccess(ctx, http.StatusOK, results)
+}
+
+// GetNoteBacklinks handles GET /api/v1/notes/:id/backlinks
+// Returns the user's notes whose bodies link to this note with
+// [[note:<guid>|<title>]], most recently updated first. Like search results,
+// each entry carries only id, guid, title, and updated_at.
+func GetNoteBacklinks(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	idStr := ctx.Request().Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
+	}
+
+	note, err := models.GetNoteByID(id, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get note"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+	if note == nil {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
+	}
+
+	backlinks, err := models.GetBacklinks(note.GUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get backlinks"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	type BacklinkResult struct {
+		ID        int64     `json:"id"`
+		GUID      string    `json:"guid"`
+		Title     string    `json:"title"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+
+	results := make([]BacklinkResult, len(backlinks))
+	for i, source := range backlinks {
+		results[i] = BacklinkResult{
+			ID:        source.ID,
+			GUID:      source.GUID,
+			Title:     source.Title,
+			UpdatedAt: source.UpdatedAt,
+		}
+	}
+
+	return writeSuccess(ctx, http.StatusOK, results)
+}
+
+// RecordNoteView handles POST /api/v1/notes/:id/view
+// Counts one view of the note and returns the new view count. Views aren't
+// edits: they don't change updated_at or produce sync changes.
+func RecordNoteView(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	idStr := ctx.Request().Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
+	}
+
+	viewCount, found, err := models.RecordNoteView(id, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to record note view"), "database error")
+		return writeModelError(ctx, err, "failed to record note view")
+	}
+	if !found {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, map[string]interface{}{"id": id, "view_count": viewCount})
+}
+
 // Toggles the is_flagged field on a note.
 func ToggleNoteFlag(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	idStr := ctx.Request().Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid note id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
 	}
 
 	note, err := models.ToggleNoteFlag(id, userGUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to toggle note flag"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to toggle flag")
+		return writeModelError(ctx, err, "failed to toggle flag")
 	}
 	if note == nil {
-		return writeError(ctx, http.StatusNotFound, "note not found")
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, note.ToOutput())
+}
+
+// SetNoteStarred handles POST /api/v1/notes/:id/star
+// Stars the note, or unstars it with {"starred": false}. An empty body stars.
+// Unlike the flag, the starred state syncs to peers.
+func SetNoteStarred(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	idStr := ctx.Request().Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
+	}
+
+	req := struct {
+		Starred *bool `json:"starred"`
+	}{}
+	if body := ctx.Request().Body(); len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid request body")
+		}
+	}
+	starred := req.Starred == nil || *req.Starred
+
+	note, err := models.SetNoteStarred(id, userGUID, starred)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to set note starred"), "database error")
+		return writeModelError(ctx, err, "failed to star note")
+	}
+	if note == nil {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
 	}
 
 	return writeSuccess(ctx, http.StatusOK, note.ToOutput())
@@ -465,30 +930,250 @@ func ToggleNoteFlag(ctx rweb.Context) error {
 
 // DeleteNote handles DELETE /api/v1/notes/:id
 // Performs a soft delete on the note (sets deleted_at timestamp).
-// Only deletes notes owned by the authenticated user.
+// With ?purge=true the note and its category mappings are removed permanently.
+// Only deletes notes owned by the authenticated user. Soft-deleting a note
+// that's already in the trash returns 200, so retries are safe; 404 means the
+// user has no such note.
 func DeleteNote(ctx rweb.Context) error {
 	// Authentication check - all note operations require auth
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	idStr := ctx.Request().Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid note id")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
+	}
+
+	if ctx.Request().QueryParam("purge") == "true" {
+		purged, err := models.PurgeNote(id, userGUID)
+		if err != nil {
+			logger.LogErr(serr.Wrap(err, "failed to purge note"), "database error")
+			return writeModelError(ctx, err, "failed to purge note")
+		}
+		if !purged {
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
+		}
+
+		logger.Info("Note purged", "id", id, "user", userGUID)
+		return writeSuccess(ctx, http.StatusOK, map[string]interface{}{"deleted": true, "purged": true, "id": id})
 	}
 
 	// DeleteNote verifies ownership via userGUID
 	deleted, err := models.DeleteNote(id, userGUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to delete note"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to delete note")
+		return writeModelError(ctx, err, "failed to delete note")
 	}
 	if !deleted {
-		return writeError(ctx, http.StatusNotFound, "note not found")
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
 	}
 
 	logger.Info("Note deleted", "id", id, "user", userGUID)
 	return writeSuccess(ctx, http.StatusOK, map[string]interface{}{"deleted": true, "id": id})
 }
+
+// ListTrashedNotes handles GET /api/v1/notes/trash
+// Returns the authenticated user's soft-deleted notes, most recently deleted first.
+// Supports the same limit/offset pagination as ListNotes.
+func ListTrashedNotes(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	limit := 0
+	offset := 0
+
+	if limitStr := ctx.Request().QueryParam("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit < 0 {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid limit parameter")
+		}
+		limit = parsedLimit
+	}
+
+	if offsetStr := ctx.Request().QueryParam("offset"); offsetStr != "" {
+		parsedOffset, err := strconv.Atoi(offsetStr)
+		if err != nil || parsedOffset < 0 {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid offset parameter")
+		}
+		offset = parsedOffset
+	}
+
+	notes, err := models.ListDeletedNotes(userGUID, limit, offset)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to list deleted notes"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	outputs := make([]models.NoteOutput, len(notes))
+	for i, note := range notes {
+		outputs[i] = note.ToOutput()
+	}
+
+	return writeSuccess(ctx, http.StatusOK, outputs)
+}
+
+// RestoreNote handles POST /api/v1/notes/:id/restore
+// Moves a soft-deleted note back to the active list.
+func RestoreNote(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	idStr := ctx.Request().Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
+	}
+
+	note, err := models.RestoreNote(id, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to restore note"), "database error")
+		return writeModelError(ctx, err, "failed to restore note")
+	}
+	if note == nil {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "deleted note not found")
+	}
+
+	logger.Info("Note restored", "id", id, "user", userGUID)
+	return writeSuccess(ctx, http.StatusOK, note.ToOutput())
+}
+
+// DiffNoteRevisions handles GET /api/v1/notes/:id/diff
+// Returns a diff-match-patch patch between two revisions of the note body.
+//
+// Query parameters:
+//   - from: change ID of the base revision (optional, defaults to the note's creation)
+//   - to:   change ID of the target revision (optional, defaults to the latest change)
+func DiffNoteRevisions(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	id, err := strconv.ParseInt(ctx.Request().Param("id"), 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
+	}
+
+	var fromID, toID int64
+	if fromStr := ctx.Request().QueryParam("from"); fromStr != "" {
+		if fromID, err = strconv.ParseInt(fromStr, 10, 64); err != nil || fromID <= 0 {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid from parameter")
+		}
+	}
+	if toStr := ctx.Request().QueryParam("to"); toStr != "" {
+		if toID, err = strconv.ParseInt(toStr, 10, 64); err != nil || toID <= 0 {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid to parameter")
+		}
+	}
+
+	// Ownership check — revisions are only visible to the note's owner
+	note, err := models.GetNoteByID(id, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get note for diff"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+	if note == nil {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
+	}
+
+	if toID == 0 {
+		if toID, err = models.LatestNoteChangeID(note.GUID); err != nil {
+			logger.LogErr(err, "failed to get latest note revision")
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+		}
+	}
+
+	patch, err := models.DiffNoteRevisions(note.GUID, fromID, toID)
+	if err == models.ErrRevisionNotFound {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, err.Error())
+	}
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to diff note revisions"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to compute diff")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, map[string]interface{}{
+		"from":  fromID,
+		"to":    toID,
+		"patch": patch,
+	})
+}
+
+// GetNoteStats handles GET /api/v1/stats
+// Returns note count and word/character totals across the user's notes.
+func GetNoteStats(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	stats, err := models.GetUserNoteStats(userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get note stats"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, stats)
+}
+
+// GetRecentActivity handles GET /api/v1/activity
+// Returns the user's recent note and category changes as one feed, newest
+// first, excluding changes received via sync. Optional ?limit= (default 50,
+// max 500).
+func GetRecentActivity(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	limit := 0 // 0 means the model's default
+	if limitStr := ctx.Request().QueryParam("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit < 0 {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid limit parameter")
+		}
+		limit = parsedLimit
+	}
+
+	items, err := models.GetRecentActivity(userGUID, limit)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get recent activity"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, items)
+}
+
+// ExportNotes handles GET /api/v1/export?format=csv
+// Returns metadata for all of the user's non-deleted notes as a CSV
+// attachment, one row per note and no bodies (see models.ExportNotesCSV).
+// csv is currently the only format. rweb sends a response in one piece, so
+// the rows are collected in a buffer before sending.
+func ExportNotes(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	if format := ctx.Request().QueryParam("format"); format != "csv" {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "format must be csv")
+	}
+
+	var buf bytes.Buffer
+	if err := models.ExportNotesCSV(userGUID, &buf); err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to export notes"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	ctx.Response().SetHeader("Content-Type", "text/csv; charset=utf-8")
+	ctx.Response().SetHeader("Content-Disposition", `attachment; filename="notes.csv"`)
+	ctx.SetStatus(http.StatusOK)
+	return ctx.Bytes(buf.Bytes())
+}
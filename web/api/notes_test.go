@@ -6,12 +6,18 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/rohanthewiz/rweb"
+
 	"gonotes/models"
 	"gonotes/web"
+	"gonotes/web/api"
 )
 
 // testServer manages a running server instance for integration testing.
@@ -20,6 +26,7 @@ type testServer struct {
 	baseURL   string
 	client    *http.Client
 	authToken string // JWT token for authenticated requests
+	apiKey    string // API key, used instead of authToken when set
 }
 
 // newTestServer creates a test server with a fresh database on a random port.
@@ -44,19 +51,23 @@ func newTestServer(t *testing.T) *testServer {
 		t.Fatalf("failed to initialize JWT: %v", err)
 	}
 
-	// Create and start server on a test port
-	srv := web.NewServer(web.WebPort)
+	// Create and start server on a dynamic port
+	readyChan := make(chan struct{}, 1)
+	srv := web.NewTestServer(rweb.ServerOptions{
+		ReadyChan: readyChan,
+		Address:   "localhost:", // Dynamic port
+	})
 
 	// Start server in background goroutine
 	go func() {
-		srv.Run()
+		_ = srv.Run()
 	}()
 
 	// Wait for server to be ready
-	time.Sleep(100 * time.Millisecond)
+	<-readyChan
 
 	ts := &testServer{
-		baseURL: "http://localhost:8000",
+		baseURL: fmt.Sprintf("http://localhost:%s", srv.GetListenPort()),
 		client:  &http.Client{Timeout: 5 * time.Second},
 	}
 
@@ -115,7 +126,9 @@ func (ts *testServer) request(method, path string, body interface{}) (int, map[s
 	}
 	req.Header.Set("Content-Type", "application/json")
 	// Add auth token for authenticated requests
-	if ts.authToken != "" {
+	if ts.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+ts.apiKey)
+	} else if ts.authToken != "" {
 		req.Header.Set("Authorization", "Bearer "+ts.authToken)
 	}
 
@@ -315,15 +328,19 @@ func TestNotesAPI(t *testing.T) {
 		}
 	})
 
+	// A missing GUID is generated by the server
 	t.Run("MissingGUID", func(t *testing.T) {
 		input := map[string]interface{}{
 			"title": "Note without GUID",
 		}
 
-		status, _ := ts.request("POST", "/api/v1/notes", input)
+		status, resp := ts.request("POST", "/api/v1/notes", input)
 
-		if status != http.StatusBadRequest {
-			t.Errorf("expected status %d, got %d", http.StatusBadRequest, status)
+		if status != http.StatusCreated {
+			t.Errorf("expected status %d, got %d", http.StatusCreated, status)
+		}
+		if data, _ := resp["data"].(map[string]interface{}); data["guid"] == "" || data["guid"] == nil {
+			t.Errorf("expected a generated guid, got %v", data["guid"])
 		}
 	})
 
@@ -407,6 +424,550 @@ func TestNotesAPI(t *testing.T) {
 	})
 }
 
+// TestNotesTrashAPI tests listing, restoring and purging soft-deleted notes
+func TestNotesTrashAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid":  "trash-note-001",
+		"title": "Trash Note",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d", status)
+	}
+	noteID := resp["data"].(map[string]interface{})["id"].(float64)
+	notePath := fmt.Sprintf("/api/v1/notes/%.0f", noteID)
+
+	if status, _ := ts.request("DELETE", notePath, nil); status != http.StatusOK {
+		t.Fatalf("failed to delete note: %d", status)
+	}
+
+	t.Run("ListTrash", func(t *testing.T) {
+		status, resp := ts.request("GET", "/api/v1/notes/trash", nil)
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+		}
+		data, ok := resp["data"].([]interface{})
+		if !ok || len(data) != 1 {
+			t.Fatalf("expected 1 note in trash, got %v", resp["data"])
+		}
+	})
+
+	t.Run("DeleteAgain", func(t *testing.T) {
+		// A retried delete of a note already in the trash succeeds
+		status, resp := ts.request("DELETE", notePath, nil)
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d for repeated delete, got %d", http.StatusOK, status)
+		}
+		if resp["data"].(map[string]interface{})["deleted"] != true {
+			t.Errorf("expected deleted=true, got %v", resp["data"])
+		}
+
+		_, resp = ts.request("GET", "/api/v1/notes/trash", nil)
+		if data, _ := resp["data"].([]interface{}); len(data) != 1 {
+			t.Errorf("expected the note to stay in the trash once, got %v", resp["data"])
+		}
+
+		if status, _ := ts.request("DELETE", "/api/v1/notes/999999", nil); status != http.StatusNotFound {
+			t.Errorf("expected status %d for a note that never existed, got %d", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		status, resp := ts.request("POST", notePath+"/restore", nil)
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+		}
+		if resp["data"].(map[string]interface{})["guid"] != "trash-note-001" {
+			t.Errorf("expected restored note, got %v", resp["data"])
+		}
+
+		if status, _ := ts.request("GET", notePath, nil); status != http.StatusOK {
+			t.Errorf("expected restored note to be retrievable, got %d", status)
+		}
+
+		// A second restore finds nothing in the trash
+		if status, _ := ts.request("POST", notePath+"/restore", nil); status != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		status, resp := ts.request("DELETE", notePath+"?purge=true", nil)
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+		}
+		if resp["data"].(map[string]interface{})["purged"] != true {
+			t.Errorf("expected purged=true, got %v", resp["data"])
+		}
+
+		if status, _ := ts.request("POST", notePath+"/restore", nil); status != http.StatusNotFound {
+			t.Errorf("expected purged note to be unrestorable, got %d", status)
+		}
+		_, resp = ts.request("GET", "/api/v1/notes/trash", nil)
+		if data, _ := resp["data"].([]interface{}); len(data) != 0 {
+			t.Errorf("expected empty trash after purge, got %v", resp["data"])
+		}
+	})
+}
+
+// TestCreateNoteIdempotencyKey verifies that a retried create with the same
+// Idempotency-Key returns the original note instead of creating another.
+func TestCreateNoteIdempotencyKey(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	post := func(key string, guid string) (int, map[string]interface{}) {
+		t.Helper()
+		body, _ := json.Marshal(map[string]interface{}{"guid": guid, "title": "Idempotent Note"})
+		req, err := http.NewRequest("POST", ts.baseURL+"/api/v1/notes", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+ts.authToken)
+		req.Header.Set(models.IdempotencyKeyHeader, key)
+
+		resp, err := ts.client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	status, first := post("retry-key-1", "idem-note-001")
+	if status != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, status)
+	}
+
+	status, second := post("retry-key-1", "idem-note-001")
+	if status != http.StatusCreated {
+		t.Fatalf("expected replay status %d, got %d: %v", http.StatusCreated, status, second)
+	}
+	if fmt.Sprint(second["data"]) != fmt.Sprint(first["data"]) {
+		t.Errorf("expected replay to return the original note\nfirst:  %v\nsecond: %v", first["data"], second["data"])
+	}
+
+	_, list := ts.request("GET", "/api/v1/notes", nil)
+	if notes, _ := list["data"].([]interface{}); len(notes) != 1 {
+		t.Errorf("expected exactly 1 note after retry, got %d", len(notes))
+	}
+
+	// A different key is a different request
+	if status, _ := post("retry-key-2", "idem-note-002"); status != http.StatusCreated {
+		t.Errorf("expected status %d for a new key, got %d", http.StatusCreated, status)
+	}
+}
+
+// TestNoteETag verifies conditional GETs: re-fetching an unchanged note with
+// its ETag returns 304 with no body, and an edited note returns a new ETag.
+func TestNoteETag(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	get := func(path, etag string) (int, string, []byte) {
+		t.Helper()
+		req, err := http.NewRequest("GET", ts.baseURL+path, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+ts.authToken)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+
+		resp, err := ts.client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("ETag"), body
+	}
+
+	_, created := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": "etag-note", "title": "Tagged"})
+	data, _ := created["data"].(map[string]interface{})
+	path := fmt.Sprintf("/api/v1/notes/%.0f", data["id"])
+
+	status, etag, _ := get(path, "")
+	if status != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an ETag, got %d and %q", status, etag)
+	}
+
+	status, _, body := get(path, etag)
+	if status != http.StatusNotModified {
+		t.Fatalf("expected status %d, got %d", http.StatusNotModified, status)
+	}
+	if len(body) != 0 {
+		t.Errorf("expected empty body on 304, got %q", body)
+	}
+
+	if status, _ := ts.request("PUT", path, map[string]interface{}{"title": "Retagged"}); status != http.StatusOK {
+		t.Fatalf("failed to update note: status %d", status)
+	}
+
+	status, newETag, _ := get(path, etag)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d after edit, got %d", http.StatusOK, status)
+	}
+	if newETag == etag {
+		t.Error("expected a new ETag after edit")
+	}
+
+	// Categories support the same conditional requests
+	ts.request("POST", "/api/v1/categories", map[string]interface{}{"name": "etag-cat"})
+	_, catETag, _ := get("/api/v1/categories", "")
+	if status, _, _ := get("/api/v1/categories", catETag); status != http.StatusNotModified {
+		t.Errorf("expected status %d for unchanged categories, got %d", http.StatusNotModified, status)
+	}
+}
+
+// TestCreateNoteGUIDValidation verifies that malformed GUIDs are rejected on
+// create and that valid ones are normalized before being stored.
+func TestCreateNoteGUIDValidation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	for _, guid := range []string{"has space", "slash/guid", "-leading-dash", strings.Repeat("a", 65)} {
+		status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": guid, "title": "Bad GUID"})
+		if status != http.StatusBadRequest {
+			t.Errorf("guid %q: expected status %d, got %d: %v", guid, http.StatusBadRequest, status, resp)
+		}
+	}
+
+	status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid":  "0b6f3c9e-2d4a-4e8b-9c1f-7a5d3e2b1c0a",
+		"title": "UUID Note",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("expected status %d for a UUID, got %d: %v", http.StatusCreated, status, resp)
+	}
+
+	// Surrounding whitespace and uppercase are normalized away
+	status, resp = ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid":  "  4F1E2D3C-5B6A-4789-8ABC-DEF012345678 ",
+		"title": "Uppercase UUID Note",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("expected status %d for an uppercase UUID, got %d: %v", http.StatusCreated, status, resp)
+	}
+	data, _ := resp["data"].(map[string]interface{})
+	if data["guid"] != "4f1e2d3c-5b6a-4789-8abc-def012345678" {
+		t.Errorf("expected normalized guid, got %v", data["guid"])
+	}
+}
+
+// TestCreateNoteServerGUID verifies that a note created without a guid, as
+// JSON or with a msgpack body, gets a server-generated UUID in the response.
+func TestCreateNoteServerGUID(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{"title": "No GUID"})
+	if status != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %v", http.StatusCreated, status, resp)
+	}
+	jsonGUID, _ := resp["data"].(map[string]interface{})["guid"].(string)
+	if _, err := uuid.Parse(jsonGUID); err != nil {
+		t.Errorf("expected a generated UUID, got %q", jsonGUID)
+	}
+
+	body := "msgpack body"
+	encoded, err := models.EncodeMsgPackBody(&body)
+	if err != nil {
+		t.Fatalf("failed to encode body: %v", err)
+	}
+	reqBody, _ := json.Marshal(map[string]interface{}{"title": "No GUID msgpack", "body_encoded": encoded})
+	req, _ := http.NewRequest("POST", ts.baseURL+"/api/v1/notes", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+ts.authToken)
+	req.Header.Set("X-Body-Encoding", "msgpack")
+	httpResp, err := ts.client.Do(req)
+	if err != nil {
+		t.Fatalf("msgpack create failed: %v", err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status %d for msgpack, got %d", http.StatusCreated, httpResp.StatusCode)
+	}
+	var result map[string]interface{}
+	json.NewDecoder(httpResp.Body).Decode(&result)
+	msgpackGUID, _ := result["data"].(map[string]interface{})["guid"].(string)
+	if _, err := uuid.Parse(msgpackGUID); err != nil || msgpackGUID == jsonGUID {
+		t.Errorf("expected a new generated UUID for msgpack, got %q", msgpackGUID)
+	}
+
+	// An explicit duplicate is still refused
+	status, _ = ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": jsonGUID, "title": "Duplicate"})
+	if status != http.StatusConflict {
+		t.Errorf("expected status %d for a duplicate guid, got %d", http.StatusConflict, status)
+	}
+}
+
+// TestNoteTagNormalization verifies that creating or updating a note stores
+// its tags trimmed, lowercased, deduplicated and sorted.
+func TestNoteTagNormalization(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid":  "tag-normalize-note",
+		"title": "Tags",
+		"tags":  "go, Go, api, go",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %v", http.StatusCreated, status, resp)
+	}
+	data, _ := resp["data"].(map[string]interface{})
+	if data["tags"] != "api,go" {
+		t.Errorf("expected tags %q, got %v", "api,go", data["tags"])
+	}
+
+	path := fmt.Sprintf("/api/v1/notes/%.0f", data["id"])
+	status, resp = ts.request("PUT", path, map[string]interface{}{
+		"title": "Tags",
+		"tags":  " Web,,db , WEB",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %v", http.StatusOK, status, resp)
+	}
+	if tags := resp["data"].(map[string]interface{})["tags"]; tags != "db,web" {
+		t.Errorf("expected tags %q after update, got %v", "db,web", tags)
+	}
+}
+
+// TestPatchNoteAPI verifies that PATCH /api/v1/notes/:id changes only the
+// supplied fields and doesn't require a title.
+func TestPatchNoteAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	_, created := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid":  "patch-note",
+		"title": "Patch Title",
+		"body":  "Original body",
+		"tags":  "a,b",
+	})
+	data, _ := created["data"].(map[string]interface{})
+	path := fmt.Sprintf("/api/v1/notes/%.0f", data["id"])
+
+	status, resp := ts.request("PATCH", path, map[string]interface{}{"body": "Patched body"})
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %v", http.StatusOK, status, resp)
+	}
+	patched, _ := resp["data"].(map[string]interface{})
+	if patched["body"] != "Patched body" || patched["title"] != "Patch Title" || patched["tags"] != "a,b" {
+		t.Errorf("expected only the body to change, got %v", patched)
+	}
+
+	if status, _ := ts.request("PATCH", path, map[string]interface{}{"title": ""}); status != http.StatusBadRequest {
+		t.Errorf("expected status %d for an empty title, got %d", http.StatusBadRequest, status)
+	}
+	if status, _ := ts.request("PATCH", "/api/v1/notes/999999", map[string]interface{}{"body": "x"}); status != http.StatusNotFound {
+		t.Errorf("expected status %d for a missing note, got %d", http.StatusNotFound, status)
+	}
+}
+
+// TestListNotesModifiedSince verifies that ?modified_since returns only notes
+// updated after the given time.
+func TestListNotesModifiedSince(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": "since-untouched", "title": "Untouched"})
+	_, created := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": "since-edited", "title": "Edited"})
+	data, _ := created["data"].(map[string]interface{})
+
+	time.Sleep(10 * time.Millisecond)
+	since := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+
+	if status, _ := ts.request("PUT", fmt.Sprintf("/api/v1/notes/%.0f", data["id"]),
+		map[string]interface{}{"title": "Edited Again"}); status != http.StatusOK {
+		t.Fatalf("failed to update note: status %d", status)
+	}
+
+	status, resp := ts.request("GET", "/api/v1/notes?modified_since="+url.QueryEscape(since.Format(time.RFC3339Nano)), nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %v", http.StatusOK, status, resp)
+	}
+	notes, _ := resp["data"].([]interface{})
+	if len(notes) != 1 {
+		t.Fatalf("expected only the edited note, got %d notes", len(notes))
+	}
+	if note, _ := notes[0].(map[string]interface{}); note["guid"] != "since-edited" {
+		t.Errorf("expected since-edited, got %v", note["guid"])
+	}
+
+	if status, _ := ts.request("GET", "/api/v1/notes?modified_since=yesterday", nil); status != http.StatusBadRequest {
+		t.Errorf("expected status %d for an invalid timestamp, got %d", http.StatusBadRequest, status)
+	}
+}
+
+// TestListNotesCreatedRange verifies that ?created_after and ?created_before
+// return only the notes created within the range, and reject an inverted one.
+func TestListNotesCreatedRange(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": "range-before", "title": "Before"})
+	time.Sleep(10 * time.Millisecond)
+	after := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+	ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": "range-within", "title": "Within"})
+	time.Sleep(10 * time.Millisecond)
+	before := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+	ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": "range-after", "title": "After"})
+
+	rangeQuery := "created_after=" + url.QueryEscape(after.Format(time.RFC3339Nano)) +
+		"&created_before=" + url.QueryEscape(before.Format(time.RFC3339Nano))
+
+	status, resp := ts.request("GET", "/api/v1/notes?"+rangeQuery, nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %v", http.StatusOK, status, resp)
+	}
+	notes, _ := resp["data"].([]interface{})
+	if len(notes) != 1 {
+		t.Fatalf("expected only the note created within the range, got %d notes", len(notes))
+	}
+	if note, _ := notes[0].(map[string]interface{}); note["guid"] != "range-within" {
+		t.Errorf("expected range-within, got %v", note["guid"])
+	}
+
+	// An open-ended range, counted with with_total
+	status, resp = ts.request("GET", "/api/v1/notes?with_total=true&created_after="+
+		url.QueryEscape(after.Format(time.RFC3339Nano)), nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %v", http.StatusOK, status, resp)
+	}
+	if page, _ := resp["data"].(map[string]interface{}); page["total"] != float64(2) {
+		t.Errorf("expected a total of 2 notes created after the bound, got %v", page["total"])
+	}
+
+	inverted := "created_after=" + url.QueryEscape(before.Format(time.RFC3339Nano)) +
+		"&created_before=" + url.QueryEscape(after.Format(time.RFC3339Nano))
+	if status, _ := ts.request("GET", "/api/v1/notes?"+inverted, nil); status != http.StatusBadRequest {
+		t.Errorf("expected status %d for an inverted range, got %d", http.StatusBadRequest, status)
+	}
+	if status, _ := ts.request("GET", "/api/v1/notes?created_before=tomorrow", nil); status != http.StatusBadRequest {
+		t.Errorf("expected status %d for an invalid timestamp, got %d", http.StatusBadRequest, status)
+	}
+}
+
+// TestErrorResponseCodes verifies that error responses carry a
+// machine-readable code alongside the message.
+func TestErrorResponseCodes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("GET", "/api/v1/notes/999999", nil)
+	if status != http.StatusNotFound || resp["code"] != api.ErrCodeNotFound || resp["error"] != "note not found" {
+		t.Errorf("expected 404 with code %s, got %d: %v", api.ErrCodeNotFound, status, resp)
+	}
+
+	note := map[string]interface{}{"guid": "error-code-note", "title": "Dup"}
+	ts.request("POST", "/api/v1/notes", note)
+	status, resp = ts.request("POST", "/api/v1/notes", note)
+	if status != http.StatusConflict || resp["code"] != api.ErrCodeConflict {
+		t.Errorf("expected 409 with code %s, got %d: %v", api.ErrCodeConflict, status, resp)
+	}
+
+	status, resp = ts.request("GET", "/api/v1/notes/not-a-number", nil)
+	if status != http.StatusBadRequest || resp["code"] != api.ErrCodeValidation {
+		t.Errorf("expected 400 with code %s, got %d: %v", api.ErrCodeValidation, status, resp)
+	}
+
+	anon := *ts
+	anon.authToken = ""
+	status, resp = anon.request("GET", "/api/v1/notes", nil)
+	if status != http.StatusUnauthorized || resp["code"] != api.ErrCodeUnauthorized {
+		t.Errorf("expected 401 with code %s, got %d: %v", api.ErrCodeUnauthorized, status, resp)
+	}
+}
+
+// TestNoteStatsAPI verifies that /stats aggregates word counts across notes
+func TestNoteStatsAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	for i, body := range []string{"one two three", "four five\n\nsix seven eight"} {
+		status, _ := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+			"guid":  fmt.Sprintf("stats-note-%03d", i),
+			"title": "Stats Note",
+			"body":  body,
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create note: %d", status)
+		}
+	}
+
+	status, resp := ts.request("GET", "/api/v1/stats", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	data := resp["data"].(map[string]interface{})
+	if data["total_notes"] != float64(2) {
+		t.Errorf("expected 2 notes, got %v", data["total_notes"])
+	}
+	if data["total_words"] != float64(8) {
+		t.Errorf("expected 8 words, got %v", data["total_words"])
+	}
+	if data["average_words"] != float64(4) {
+		t.Errorf("expected 4 average words, got %v", data["average_words"])
+	}
+}
+
 // TestNotesCategoryFiltering tests the cat and subcats[] query parameters
 func TestNotesCategoryFiltering(t *testing.T) {
 	ts := newTestServer(t)
@@ -479,7 +1040,7 @@ func TestNotesCategoryFiltering(t *testing.T) {
 		}
 
 		// Update subcategories for the relationship
-		err := models.UpdateNoteCategorySubcategories(int64(k8sNoteID), int64(k8sCategoryID), []string{"pod", "deployment"})
+		err := models.UpdateNoteCategorySubcategories(int64(k8sNoteID), int64(k8sCategoryID), []string{"pod", "deployment"}, true)
 		if err != nil {
 			t.Fatalf("failed to update subcategories: %v", err)
 		}
@@ -491,7 +1052,7 @@ func TestNotesCategoryFiltering(t *testing.T) {
 			t.Fatalf("failed to add aws to note: status %d", status2)
 		}
 
-		err = models.UpdateNoteCategorySubcategories(int64(awsNoteID), int64(awsCategoryID), []string{"ec2"})
+		err = models.UpdateNoteCategorySubcategories(int64(awsNoteID), int64(awsCategoryID), []string{"ec2"}, true)
 		if err != nil {
 			t.Fatalf("failed to update subcategories: %v", err)
 		}
@@ -556,6 +1117,21 @@ func TestNotesCategoryFiltering(t *testing.T) {
 		}
 	})
 
+	// Test: More subcats[] than the cap is rejected
+	t.Run("subcategory filter cap", func(t *testing.T) {
+		t.Setenv(models.MaxSubcategoryFiltersEnvVar, "2")
+
+		status, _ := ts.request("GET", "/api/v1/notes?cat=k8s&subcats[]=pod&subcats[]=deployment", nil)
+		if status != http.StatusOK {
+			t.Errorf("expected status %d within the cap, got %d", http.StatusOK, status)
+		}
+
+		status, _ = ts.request("GET", "/api/v1/notes?cat=k8s&subcats[]=pod&subcats[]=deployment&subcats[]=service", nil)
+		if status != http.StatusBadRequest {
+			t.Errorf("expected status %d over the cap, got %d", http.StatusBadRequest, status)
+		}
+	})
+
 	// Test: Filter by non-existent category
 	t.Run("filter by non-existent category", func(t *testing.T) {
 		status, resp := ts.request("GET", "/api/v1/notes?cat=nonexistent", nil)
@@ -582,3 +1158,385 @@ func TestNotesCategoryFiltering(t *testing.T) {
 		}
 	})
 }
+
+// TestGetNoteRaw verifies that GET /api/v1/notes/:id/raw returns exactly the
+// body bytes as text/markdown, named after the title, and 404s for another
+// user's note.
+func TestGetNoteRaw(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	body := "# Heading\n\n- item with \"quotes\" and ünïcode\n\ttrailing tab\n\n"
+	status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid": "raw-note", "title": "Raw/Notes: ü", "body": body,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d %v", status, resp)
+	}
+	noteID := int64(resp["data"].(map[string]interface{})["id"].(float64))
+
+	getRaw := func(token string) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/notes/%d/raw", ts.baseURL, noteID), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := ts.client.Do(req)
+		if err != nil {
+			t.Fatalf("raw request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+
+	rawResp, data := getRaw(ts.authToken)
+	if rawResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rawResp.StatusCode, data)
+	}
+	if string(data) != body {
+		t.Errorf("expected the exact body bytes, got %q", data)
+	}
+	if ct := rawResp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("expected text/markdown content type, got %q", ct)
+	}
+	if cd := rawResp.Header.Get("Content-Disposition"); !strings.Contains(cd, `filename="Raw_Notes: _.md"`) ||
+		!strings.Contains(cd, "filename*=UTF-8''Raw_Notes:%20%C3%BC.md") {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+
+	status, resp = ts.request("POST", "/api/v1/auth/register", map[string]string{
+		"username":            "rawother",
+		"password":            "otherpassword123",
+		"registration_secret": "test-reg-secret",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to register second user: %d", status)
+	}
+	otherToken := resp["data"].(map[string]interface{})["token"].(string)
+	if otherResp, _ := getRaw(otherToken); otherResp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's note, got %d", otherResp.StatusCode)
+	}
+}
+
+// TestNoteBacklinksAPI verifies that a note linking to another is listed in
+// the target's backlinks.
+func TestNoteBacklinksAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	const targetGUID = "aaaaaaaa-bbbb-4ccc-8ddd-eeeeeeeeeeee"
+	status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": targetGUID, "title": "Target"})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create target note: %d", status)
+	}
+	targetID := resp["data"].(map[string]interface{})["id"].(float64)
+
+	status, _ = ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid": "backlink-api-source", "title": "Source", "body": "See [[note:" + targetGUID + "|Target]]",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create source note: %d", status)
+	}
+
+	status, resp = ts.request("GET", fmt.Sprintf("/api/v1/notes/%.0f/backlinks", targetID), nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+	}
+	backlinks := resp["data"].([]interface{})
+	if len(backlinks) != 1 {
+		t.Fatalf("expected 1 backlink, got %v", backlinks)
+	}
+	if got := backlinks[0].(map[string]interface{}); got["guid"] != "backlink-api-source" || got["title"] != "Source" {
+		t.Errorf("unexpected backlink: %v", got)
+	}
+
+	if status, _ := ts.request("GET", "/api/v1/notes/99999/backlinks", nil); status != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown note, got %d", status)
+	}
+}
+
+// TestCORSPreflight verifies that preflights from origins listed in
+// GONOTES_CORS_ORIGINS get CORS headers and other origins don't.
+func TestCORSPreflight(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	preflight := func(origin string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest("OPTIONS", ts.baseURL+"/api/v1/notes", nil)
+		if err != nil {
+			t.Fatalf("failed to build request: %v", err)
+		}
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "Authorization, X-Body-Encoding")
+		resp, err := ts.client.Do(req)
+		if err != nil {
+			t.Fatalf("preflight failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	t.Setenv(web.CORSOriginsEnvVar, "https://notes.example.com, http://localhost:3000/")
+
+	resp := preflight("http://localhost:3000")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected preflight status 200, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "http://localhost:3000" {
+		t.Errorf("expected allowed origin to be echoed, got %q", got)
+	}
+	allowHeaders := resp.Header.Get("Access-Control-Allow-Headers")
+	for _, h := range []string{"Authorization", "X-Body-Encoding"} {
+		if !strings.Contains(allowHeaders, h) {
+			t.Errorf("expected %s in Access-Control-Allow-Headers, got %q", h, allowHeaders)
+		}
+	}
+	if !strings.Contains(resp.Header.Get("Access-Control-Allow-Methods"), "PUT") {
+		t.Errorf("expected methods to be allowed, got %q", resp.Header.Get("Access-Control-Allow-Methods"))
+	}
+
+	resp = preflight("https://evil.example.com")
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no Access-Control-Allow-Origin for a disallowed origin, got %q", got)
+	}
+
+	// "*" allows any origin
+	t.Setenv(web.CORSOriginsEnvVar, "*")
+	if got := preflight("https://anywhere.example.com").Header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("expected wildcard origin, got %q", got)
+	}
+}
+
+// TestNoteViewsAPI verifies POST /api/v1/notes/:id/view and ?sort=popular.
+func TestNoteViewsAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	ids := map[string]float64{}
+	for _, guid := range []string{"views-api-a", "views-api-b"} {
+		status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": guid, "title": guid})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create note %s: %d", guid, status)
+		}
+		ids[guid] = resp["data"].(map[string]interface{})["id"].(float64)
+	}
+
+	var resp map[string]interface{}
+	for i := 0; i < 2; i++ {
+		var status int
+		status, resp = ts.request("POST", fmt.Sprintf("/api/v1/notes/%.0f/view", ids["views-api-a"]), nil)
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+		}
+	}
+	if got := resp["data"].(map[string]interface{})["view_count"]; got != float64(2) {
+		t.Errorf("expected view_count 2, got %v", got)
+	}
+
+	status, resp := ts.request("GET", "/api/v1/notes?sort=popular", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+	}
+	notes := resp["data"].([]interface{})
+	if len(notes) != 2 || notes[0].(map[string]interface{})["guid"] != "views-api-a" {
+		t.Errorf("expected views-api-a first, got %v", notes)
+	}
+
+	if status, _ := ts.request("GET", "/api/v1/notes?sort=sideways", nil); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown sort, got %d", status)
+	}
+	if status, _ := ts.request("POST", "/api/v1/notes/99999/view", nil); status != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown note, got %d", status)
+	}
+}
+
+// TestListNotesWithTotal verifies with_total wraps a page of notes with the
+// count of all matching notes
+func TestListNotesWithTotal(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	for i := 0; i < 3; i++ {
+		guid := fmt.Sprintf("with-total-%d", i)
+		if status, _ := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": guid, "title": guid}); status != http.StatusCreated {
+			t.Fatalf("failed to create note %s: %d", guid, status)
+		}
+	}
+
+	status, resp := ts.request("GET", "/api/v1/notes?limit=2&offset=1&with_total=true", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+	}
+	page := resp["data"].(map[string]interface{})
+	if items := page["items"].([]interface{}); len(items) != 2 {
+		t.Errorf("expected 2 items, got %d", len(items))
+	}
+	if page["total"] != float64(3) || page["limit"] != float64(2) || page["offset"] != float64(1) {
+		t.Errorf("expected total 3, limit 2, offset 1, got %v", page)
+	}
+
+	status, resp = ts.request("GET", "/api/v1/notes?cat=none&with_total=true", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+	}
+	if total := resp["data"].(map[string]interface{})["total"]; total != float64(0) {
+		t.Errorf("expected total 0 for an unused category, got %v", total)
+	}
+
+	// Without with_total the response stays a bare list
+	status, resp = ts.request("GET", "/api/v1/notes?limit=2", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d – %v", http.StatusOK, status, resp)
+	}
+	if _, ok := resp["data"].([]interface{}); !ok {
+		t.Errorf("expected a list without with_total, got %v", resp["data"])
+	}
+
+	if status, _ := ts.request("GET", "/api/v1/notes?with_total=maybe", nil); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid with_total, got %d", status)
+	}
+}
+
+// TestAdminConsistencyAPI verifies that the consistency diagnostic reports a
+// corrupted cache row and that the repair endpoint fixes it.
+func TestAdminConsistencyAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, _ := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid":  "consistency-api-note",
+		"title": "Consistent",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d", status)
+	}
+	if _, err := models.CacheDB().Exec(`UPDATE notes SET updated_at = updated_at - INTERVAL 1 DAY
+		WHERE guid = 'consistency-api-note'`); err != nil {
+		t.Fatalf("failed to corrupt cached note: %v", err)
+	}
+
+	divergences := func(resp map[string]interface{}) []interface{} {
+		return resp["data"].(map[string]interface{})["divergences"].([]interface{})
+	}
+
+	status, resp := ts.request("GET", "/api/v1/admin/consistency", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %v", http.StatusOK, status, resp)
+	}
+	if d := divergences(resp); len(d) != 1 || d[0].(map[string]interface{})["guid"] != "consistency-api-note" {
+		t.Fatalf("expected the corrupted note to be reported, got %v", d)
+	}
+
+	status, resp = ts.request("POST", "/api/v1/admin/consistency/repair", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %v", http.StatusOK, status, resp)
+	}
+	if repaired := resp["data"].(map[string]interface{})["repaired"]; repaired != float64(1) {
+		t.Errorf("expected 1 repair, got %v", repaired)
+	}
+
+	status, resp = ts.request("GET", "/api/v1/admin/consistency", nil)
+	if status != http.StatusOK || len(divergences(resp)) != 0 {
+		t.Errorf("expected no divergences after repair, got %d: %v", status, resp)
+	}
+}
+
+// TestAdminStatsAPI verifies the admin stats counts for a populated database,
+// including the changes a registered peer has yet to pull.
+func TestAdminStatsAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	var noteIDs []int64
+	for _, guid := range []string{"stats-note-1", "stats-note-2", "stats-note-3"} {
+		status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": guid, "title": guid})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create note: %d", status)
+		}
+		noteIDs = append(noteIDs, int64(resp["data"].(map[string]interface{})["id"].(float64)))
+	}
+	if status, _ := ts.request("DELETE", fmt.Sprintf("/api/v1/notes/%d", noteIDs[2]), nil); status != http.StatusOK {
+		t.Fatalf("failed to delete note: %d", status)
+	}
+	status, resp := ts.request("POST", "/api/v1/categories", map[string]interface{}{"name": "Stats"})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create category: %d", status)
+	}
+	categoryID := int64(resp["data"].(map[string]interface{})["id"].(float64))
+	if status, _ := ts.request("POST", fmt.Sprintf("/api/v1/notes/%d/categories/%d", noteIDs[0], categoryID), nil); status != http.StatusCreated {
+		t.Fatalf("failed to add category to note: %d", status)
+	}
+
+	// Pulling registers the peer and marks everything so far as sent to it
+	if status, _ := ts.request("GET", "/api/v1/sync/pull?peer_id=stats-peer&limit=1000", nil); status != http.StatusOK {
+		t.Fatalf("failed to pull: %d", status)
+	}
+	if status, _ := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": "stats-note-4", "title": "Unpulled"}); status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d", status)
+	}
+
+	status, resp = ts.request("GET", "/api/v1/admin/stats", nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %v", http.StatusOK, status, resp)
+	}
+	data := resp["data"].(map[string]interface{})
+
+	for field, want := range map[string]float64{
+		"active_notes":        3,
+		"deleted_notes":       1,
+		"categories":          1,
+		"note_category_links": 1,
+	} {
+		if data[field] != want {
+			t.Errorf("expected %s %v, got %v", field, want, data[field])
+		}
+	}
+	if data["total_changes"] != data["note_changes"].(float64)+data["category_changes"].(float64) {
+		t.Errorf("expected total_changes to sum note and category changes, got %v", data)
+	}
+	if data["note_changes"].(float64) < 5 || data["category_changes"].(float64) < 1 {
+		t.Errorf("expected the creates and delete to be counted as changes, got %v", data)
+	}
+
+	pending := data["pending_by_peer"].([]interface{})
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 registered peer, got %v", pending)
+	}
+	peer := pending[0].(map[string]interface{})
+	if peer["peer_id"] != "stats-peer" || peer["note_changes"] != float64(1) || peer["total"] != float64(1) {
+		t.Errorf("expected stats-peer to have 1 pending note change, got %v", peer)
+	}
+
+	if data["db_file_bytes"].(float64) <= 0 {
+		t.Errorf("expected a nonzero database file size, got %v", data["db_file_bytes"])
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gonotes/models"
+
+	"github.com/rohanthewiz/logger"
+	"github.com/rohanthewiz/rweb"
+	"github.com/rohanthewiz/serr"
+)
+
+// CreateShareLinkRequest is the optional body for creating a share link.
+type CreateShareLinkRequest struct {
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`    // RFC 3339; omit for a link that never expires
+	AllowPrivate bool       `json:"allow_private,omitempty"` // Required to share a private note
+}
+
+// CreateShareLink handles POST /api/v1/notes/:id/share
+// Creates a public read-only link to the note. The token is returned only in
+// this response — it is stored hashed and cannot be shown again.
+//
+// Success (201):
+//
+//	{ "success": true, "data": { "token": "...", "url": "/api/v1/shared/...", "expires_at": null } }
+func CreateShareLink(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	noteID, err := strconv.ParseInt(ctx.Request().Param("id"), 10, 64)
+	if err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid note id")
+	}
+
+	var req CreateShareLinkRequest
+	if body := ctx.Request().Body(); len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "expires_at must be in the future")
+	}
+
+	token, err := models.CreateShareLinkWithOptions(noteID, userGUID, models.ShareLinkOptions{
+		ExpiresAt:    req.ExpiresAt,
+		AllowPrivate: req.AllowPrivate,
+	})
+	if err == models.ErrPrivateNoteNotShareable {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, err.Error())
+	}
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to create share link"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to create share link")
+	}
+	if token == "" {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "note not found")
+	}
+
+	logger.Info("Share link created", "note_id", noteID, "user", userGUID)
+	return writeSuccess(ctx, http.StatusCreated, map[string]interface{}{
+		"token":      token,
+		"url":        "/api/v1/shared/" + token,
+		"expires_at": req.ExpiresAt,
+	})
+}
+
+// GetSharedNote handles GET /api/v1/shared/:token
+// No authentication — the token is the credential. Returns the note without
+// owner-identifying fields, 410 if the link has expired, and 404 if the token
+// is unknown or revoked.
+func GetSharedNote(ctx rweb.Context) error {
+	note, err := models.GetSharedNote(ctx.Request().Param("token"))
+	if err == models.ErrShareLinkExpired {
+		return writeError(ctx, http.StatusGone, ErrCodeGone, err.Error())
+	}
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get shared note"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+	if note == nil {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "shared note not found")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, note.ToSharedOutput())
+}
+
+// RevokeShareLink handles DELETE /api/v1/shared/:token
+// Revokes a share link owned by the authenticated user.
+func RevokeShareLink(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	revoked, err := models.RevokeShareLink(ctx.Request().Param("token"), userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to revoke share link"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to revoke share link")
+	}
+	if !revoked {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "share link not found")
+	}
+
+	logger.Info("Share link revoked", "user", userGUID)
+	return writeSuccess(ctx, http.StatusOK, map[string]interface{}{"revoked": true})
+}
@@ -0,0 +1,105 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestShareLinksAPI(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	body := "Shared body"
+	status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid":  "shared-note-001",
+		"title": "Shared Note",
+		"body":  body,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d", status)
+	}
+	noteID := resp["data"].(map[string]interface{})["id"].(float64)
+	sharePath := fmt.Sprintf("/api/v1/notes/%.0f/share", noteID)
+
+	// public makes an unauthenticated request
+	public := *ts
+	public.authToken = ""
+
+	var token string
+
+	t.Run("Create", func(t *testing.T) {
+		status, resp := ts.request("POST", sharePath, nil)
+		if status != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %v", http.StatusCreated, status, resp)
+		}
+		token = resp["data"].(map[string]interface{})["token"].(string)
+		if token == "" || token == "shared-note-001" {
+			t.Fatalf("expected a random token, got %q", token)
+		}
+	})
+
+	t.Run("ViewWithoutAuth", func(t *testing.T) {
+		status, resp := public.request("GET", "/api/v1/shared/"+token, nil)
+		if status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+		}
+		data := resp["data"].(map[string]interface{})
+		if data["body"] != body {
+			t.Errorf("expected shared body %q, got %v", body, data["body"])
+		}
+		if _, ok := data["created_by"]; ok {
+			t.Errorf("shared note must not expose the owner, got created_by=%v", data["created_by"])
+		}
+	})
+
+	t.Run("PrivateNoteRequiresOptIn", func(t *testing.T) {
+		status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+			"guid":       "shared-private-001",
+			"title":      "Private Note",
+			"is_private": true,
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("failed to create note: %d", status)
+		}
+		privatePath := fmt.Sprintf("/api/v1/notes/%.0f/share", resp["data"].(map[string]interface{})["id"].(float64))
+
+		if status, _ := ts.request("POST", privatePath, nil); status != http.StatusBadRequest {
+			t.Errorf("expected status %d sharing a private note, got %d", http.StatusBadRequest, status)
+		}
+		if status, _ := ts.request("POST", privatePath, map[string]interface{}{"allow_private": true}); status != http.StatusCreated {
+			t.Errorf("expected status %d with allow_private, got %d", http.StatusCreated, status)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Second)
+		status, resp := ts.request("POST", sharePath, map[string]interface{}{"expires_at": expiresAt})
+		if status != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, status)
+		}
+		expiring := resp["data"].(map[string]interface{})["token"].(string)
+
+		time.Sleep(time.Until(expiresAt) + 100*time.Millisecond)
+		if status, _ := public.request("GET", "/api/v1/shared/"+expiring, nil); status != http.StatusGone {
+			t.Errorf("expected status %d for an expired link, got %d", http.StatusGone, status)
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		if status, _ := public.request("DELETE", "/api/v1/shared/"+token, nil); status != http.StatusUnauthorized {
+			t.Errorf("expected status %d revoking without auth, got %d", http.StatusUnauthorized, status)
+		}
+		if status, _ := ts.request("DELETE", "/api/v1/shared/"+token, nil); status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+		}
+		if status, _ := public.request("GET", "/api/v1/shared/"+token, nil); status != http.StatusNotFound {
+			t.Errorf("expected status %d for a revoked link, got %d", http.StatusNotFound, status)
+		}
+	})
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -30,18 +32,18 @@ func GetUserChanges(ctx rweb.Context) error {
 	// Authentication check - sync operations require auth
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	// Parse 'since' parameter (required)
 	sinceStr := ctx.Request().QueryParam("since")
 	if sinceStr == "" {
-		return writeError(ctx, http.StatusBadRequest, "since parameter is required (RFC3339 format)")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "since parameter is required (RFC3339 format)")
 	}
 
 	since, err := time.Parse(time.RFC3339, sinceStr)
 	if err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid since parameter: must be RFC3339 format")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid since parameter: must be RFC3339 format")
 	}
 
 	// Parse optional 'limit' parameter
@@ -49,7 +51,7 @@ func GetUserChanges(ctx rweb.Context) error {
 	if limitStr := ctx.Request().QueryParam("limit"); limitStr != "" {
 		parsedLimit, err := strconv.Atoi(limitStr)
 		if err != nil || parsedLimit < 0 {
-			return writeError(ctx, http.StatusBadRequest, "invalid limit parameter")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid limit parameter")
 		}
 		limit = parsedLimit
 	}
@@ -58,7 +60,7 @@ func GetUserChanges(ctx rweb.Context) error {
 	changes, err := models.GetUserChangesSince(userGUID, since, limit)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to get user changes"), "database error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to retrieve changes")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to retrieve changes")
 	}
 
 	// Return empty array instead of null if no changes
@@ -82,20 +84,32 @@ func GetUserChanges(ctx rweb.Context) error {
 // Query parameters:
 //   - peer_id: Unique identifier for the requesting peer (required)
 //   - limit:   Maximum number of changes to return (optional, default: 100)
+//   - peek:    When "true", the changes are not marked as sent, so the next
+//     pull returns them again (optional, used by sync dry runs)
+//   - category: GUID of one of the user's categories; restricts the feed to
+//     that category and the notes in it (optional)
 //
 // The response includes a has_more flag so the client knows whether to
 // issue another pull request for the remaining changes.
+//
+// A request with a valid If-Modified-Since header gets 304 Not Modified when
+// nothing is waiting for the peer, skipping the full change query. The hub
+// tracks what each peer has acknowledged rather than comparing timestamps,
+// so the header's date only opts in to the check.
 func PullChanges(ctx rweb.Context) error {
 	// Authentication required for sync operations
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	// Parse peer_id (required — each spoke has a stable identity)
 	peerID := ctx.Request().QueryParam("peer_id")
 	if peerID == "" {
-		return writeError(ctx, http.StatusBadRequest, "peer_id parameter is required")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "peer_id parameter is required")
+	}
+	if !checkPeerAllowed(ctx, peerID, userGUID) {
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "peer is not approved to sync with this hub")
 	}
 
 	// Parse optional limit (defaults to 100 in GetUnifiedChangesForPeer)
@@ -103,26 +117,51 @@ func PullChanges(ctx rweb.Context) error {
 	if limitStr := ctx.Request().QueryParam("limit"); limitStr != "" {
 		parsedLimit, err := strconv.Atoi(limitStr)
 		if err != nil || parsedLimit <= 0 {
-			return writeError(ctx, http.StatusBadRequest, "invalid limit parameter")
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid limit parameter")
 		}
 		limit = parsedLimit
 	}
 
+	// Optional category scope — the category must belong to the user
+	categoryGUID := ctx.Request().QueryParam("category")
+	if categoryGUID != "" {
+		category, err := models.GetCategoryByGUID(categoryGUID)
+		if err != nil {
+			logger.LogErr(err, "failed to get category for pull filter", "category_guid", categoryGUID)
+			return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to retrieve changes")
+		}
+		if category == nil || category.CreatedBy.String != userGUID {
+			return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "category not found")
+		}
+	}
+
+	if ims := ctx.Request().Header("If-Modified-Since"); ims != "" {
+		if _, err := http.ParseTime(ims); err == nil && !models.HasUnsentChangesForPeer(peerID, userGUID, categoryGUID) {
+			ctx.SetStatus(http.StatusNotModified)
+			return nil
+		}
+	}
+
 	// Fetch unified changes for this peer, scoped to the authenticated user
-	response, err := models.GetUnifiedChangesForPeer(peerID, userGUID, limit)
+	response, err := models.GetUnifiedChangesForPeerInCategory(peerID, userGUID, categoryGUID, limit)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to get unified changes for peer"), "pull error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to retrieve changes")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to retrieve changes")
 	}
 
 	// Mark the returned changes as synced to this peer so they aren't
-	// returned on the next pull
-	models.MarkSyncChangesForPeer(response.Changes, peerID)
+	// returned on the next pull — unless the peer is only previewing them
+	peek := ctx.Request().QueryParam("peek") == "true"
+	if !peek {
+		models.MarkSyncChangesForPeer(response.Changes, peerID)
+	}
 
 	logger.Info("Sync pull completed",
 		"peer_id", peerID,
 		"count", len(response.Changes),
 		"has_more", response.HasMore,
+		"peek", peek,
+		"category", categoryGUID,
 	)
 
 	return writeSuccess(ctx, http.StatusOK, response)
@@ -135,22 +174,33 @@ func PullChanges(ctx rweb.Context) error {
 //
 // Request body: SyncPushRequest { peer_id, changes[] }
 // Response: SyncPushResponse { accepted[], rejected[] }
+// Status is 200 when every change was accepted and 207 Multi-Status when any
+// were rejected, so clients can tell partial success apart without the body.
+// A push of more than models.MaxPushChanges changes is refused with 413.
 func PushChanges(ctx rweb.Context) error {
 	// Authentication required
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	// Parse request body
 	var req models.SyncPushRequest
 	if err := json.Unmarshal(ctx.Request().Body(), &req); err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to decode sync push request"), "invalid JSON")
-		return writeError(ctx, http.StatusBadRequest, "invalid JSON body")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
+	}
+
+	if maxChanges := models.MaxPushChanges(); len(req.Changes) > maxChanges {
+		return writeError(ctx, http.StatusRequestEntityTooLarge, ErrCodeTooLarge,
+			fmt.Sprintf("too many changes in one push: at most %d allowed", maxChanges))
 	}
 
 	if req.PeerID == "" {
-		return writeError(ctx, http.StatusBadRequest, "peer_id is required")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "peer_id is required")
+	}
+	if !checkPeerAllowed(ctx, req.PeerID, userGUID) {
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "peer is not approved to sync with this hub")
 	}
 
 	// Process each change — collect accepted/rejected results
@@ -162,7 +212,16 @@ func PushChanges(ctx rweb.Context) error {
 		// impersonation — a spoke cannot claim to be a different user
 		change.User = userGUID
 
-		err := models.ApplyIncomingSyncChange(change)
+		// Reject changes that can never apply up front, with a clear reason,
+		// then tag the rest with the sender so they aren't returned to it on
+		// its next pull
+		err := models.ValidatePushChange(change)
+		if err == nil {
+			err = models.ApplyIncomingSyncChangeFromPeer(change, req.PeerID)
+		}
+		if errors.Is(err, models.ErrReadOnly) {
+			return writeModelError(ctx, err, "failed to apply sync changes")
+		}
 		if err != nil {
 			logger.LogErr(err, "failed to apply incoming sync change",
 				"change_guid", change.GUID,
@@ -191,12 +250,126 @@ func PushChanges(ctx rweb.Context) error {
 		"rejected", len(rejected),
 	)
 
-	return writeSuccess(ctx, http.StatusOK, models.SyncPushResponse{
+	status := http.StatusOK
+	if len(rejected) > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	return writeSuccess(ctx, status, models.SyncPushResponse{
 		Accepted: accepted,
 		Rejected: rejected,
 	})
 }
 
+// checkPeerAllowed registers the peer and reports whether it may sync. A
+// registration failure is logged and the peer let through only if the
+// allowlist isn't enforced.
+func checkPeerAllowed(ctx rweb.Context, peerID, userGUID string) bool {
+	allowed, err := models.CheckPeerAllowed(peerID, userGUID)
+	if err != nil {
+		logger.LogErr(err, "failed to check peer registration", "peer_id", peerID, "path", ctx.Request().Path())
+		return !models.PeerAllowlistEnabled()
+	}
+	if !allowed {
+		logger.Warn("Refused sync from unapproved peer", "peer_id", peerID, "user", userGUID)
+	}
+	return allowed
+}
+
+// ListSyncPeers handles GET /api/v1/sync/peers
+// Admin-only: lists every peer that has synced with (or been approved on)
+// this hub, with its approval status.
+func ListSyncPeers(ctx rweb.Context) error {
+	if !IsAdmin(ctx) {
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "admin access required")
+	}
+
+	peers, err := models.ListRegisteredPeers()
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to list registered peers"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to list peers")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, map[string]interface{}{
+		"allowlist_enforced": models.PeerAllowlistEnabled(),
+		"peers":              peers,
+	})
+}
+
+// GetChangeDetail handles GET /api/v1/changes/:guid
+// Returns the note or category change with the given GUID: its operation,
+// the fields its fragment sets (by name), whether a note body is a diff, and
+// the fragment itself. Users see their own changes; admins see any.
+func GetChangeDetail(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	detail, err := models.GetChangeDetail(ctx.Request().Param("guid"))
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get change detail"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to get change")
+	}
+	// Someone else's change is reported as missing rather than forbidden
+	if detail == nil || (detail.User != userGUID && !IsAdmin(ctx)) {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "change not found")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, detail)
+}
+
+// GetChangeDeliveryStatus handles GET /api/v1/sync/changes/:guid/peers
+// Admin-only: lists the peers that have acknowledged the note or category
+// change with the given GUID, and the registered peers still pending it.
+func GetChangeDeliveryStatus(ctx rweb.Context) error {
+	if !IsAdmin(ctx) {
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "admin access required")
+	}
+
+	changeGUID := ctx.Request().Param("guid")
+	status, err := models.GetChangeDeliveryStatus(changeGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get change delivery status"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to get change delivery status")
+	}
+	if status == nil {
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "change not found")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, status)
+}
+
+// ApproveSyncPeer handles POST /api/v1/sync/peers/approve
+// Admin-only: approves a peer so it may sync while the allowlist is enforced.
+//
+// Request body: { "peer_id": "..." }
+func ApproveSyncPeer(ctx rweb.Context) error {
+	if !IsAdmin(ctx) {
+		return writeError(ctx, http.StatusForbidden, ErrCodeForbidden, "admin access required")
+	}
+	userGUID := GetCurrentUserGUID(ctx)
+
+	var req struct {
+		PeerID string `json:"peer_id"`
+	}
+	if err := json.Unmarshal(ctx.Request().Body(), &req); err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
+	}
+	if req.PeerID == "" {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "peer_id is required")
+	}
+
+	peer, err := models.ApprovePeer(req.PeerID, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to approve peer"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to approve peer")
+	}
+
+	logger.Info("Sync peer approved", "peer_id", req.PeerID, "admin", userGUID)
+	return writeSuccess(ctx, http.StatusOK, peer)
+}
+
 // GetSnapshot handles GET /api/v1/sync/snapshot
 // Returns the full current state of a single entity (note or category)
 // as a SyncChange with operation=Create and all fields populated.
@@ -205,33 +378,116 @@ func PushChanges(ctx rweb.Context) error {
 // Query parameters:
 //   - entity_type: "note" or "category" (required)
 //   - entity_guid: GUID of the entity to snapshot (required)
+//   - include_categories: "false" omits a note's category mappings (default true)
 func GetSnapshot(ctx rweb.Context) error {
 	// Authentication required
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	entityType := ctx.Request().QueryParam("entity_type")
 	entityGUID := ctx.Request().QueryParam("entity_guid")
 
 	if entityType == "" || entityGUID == "" {
-		return writeError(ctx, http.StatusBadRequest, "entity_type and entity_guid parameters are required")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "entity_type and entity_guid parameters are required")
 	}
 
 	if entityType != "note" && entityType != "category" {
-		return writeError(ctx, http.StatusBadRequest, "entity_type must be 'note' or 'category'")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "entity_type must be 'note' or 'category'")
+	}
+
+	opts := models.DefaultSnapshotOptions()
+	if ctx.Request().QueryParam("include_categories") == "false" {
+		opts.IncludeCategories = false
 	}
 
-	snapshot, err := models.GetEntitySnapshot(entityType, entityGUID, userGUID)
+	snapshot, err := models.GetEntitySnapshotWithOptions(entityType, entityGUID, userGUID, opts)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to get entity snapshot"), "snapshot error")
-		return writeError(ctx, http.StatusNotFound, "entity not found")
+		return writeError(ctx, http.StatusNotFound, ErrCodeNotFound, "entity not found")
 	}
 
 	return writeSuccess(ctx, http.StatusOK, snapshot)
 }
 
+// GetSnapshotBatch handles POST /api/v1/sync/snapshot/batch
+// Returns snapshots for up to models.MaxSnapshotBatchSize entities in one call,
+// in the same form as GetSnapshot, so seeding a new spoke doesn't take one
+// request per note. Entities that don't exist are listed under "missing"
+// instead of failing the batch.
+//
+// Request body: {"entities": [{"entity_type": "note", "entity_guid": "..."}, ...]}
+func GetSnapshotBatch(ctx rweb.Context) error {
+	// Authentication required
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	var req models.SyncSnapshotBatchRequest
+	if err := json.Unmarshal(ctx.Request().Body(), &req); err != nil {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
+	}
+
+	if len(req.Entities) > models.MaxSnapshotBatchSize {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation,
+			fmt.Sprintf("at most %d entities may be requested per batch", models.MaxSnapshotBatchSize))
+	}
+	for _, ref := range req.Entities {
+		if ref.EntityType != "note" && ref.EntityType != "category" {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "entity_type must be 'note' or 'category'")
+		}
+		if ref.EntityGUID == "" {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "entity_guid is required")
+		}
+	}
+
+	snapshots, missing, err := models.GetEntitySnapshots(req.Entities, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get entity snapshots"), "snapshot error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to get snapshots")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, models.SyncSnapshotBatchResponse{
+		Snapshots: snapshots,
+		Missing:   missing,
+	})
+}
+
+// ResetPeerSync handles POST /api/v1/sync/reset
+// Forgets which of the authenticated user's changes a peer has pulled, so the
+// peer's next pulls return the user's full change history. For a peer whose
+// local database was lost and needs to be rebuilt from the hub.
+//
+// Request body: SyncResetRequest { peer_id }
+// Response: SyncResetResult with the number of records cleared
+func ResetPeerSync(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	var req models.SyncResetRequest
+	if err := json.Unmarshal(ctx.Request().Body(), &req); err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to decode sync reset request"), "invalid JSON")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid JSON body")
+	}
+	if req.PeerID == "" {
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "peer_id is required")
+	}
+
+	result, err := models.ResetPeerSync(req.PeerID, userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to reset peer sync state"), "reset error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to reset sync state")
+	}
+
+	logger.Info("Peer sync state reset", "peer_id", req.PeerID, "user", userGUID,
+		"note_changes", result.NoteChangesReset, "category_changes", result.CategoryChangesReset)
+	return writeSuccess(ctx, http.StatusOK, result)
+}
+
 // GetSyncStatus handles GET /api/v1/sync/status
 // Returns note/category counts and a content-based checksum.
 // Peers compare checksums to quickly detect data divergence.
@@ -239,13 +495,37 @@ func GetSyncStatus(ctx rweb.Context) error {
 	// Authentication required
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	status, err := models.GetSyncStatus(userGUID)
 	if err != nil {
 		logger.LogErr(serr.Wrap(err, "failed to get sync status"), "status error")
-		return writeError(ctx, http.StatusInternalServerError, "failed to retrieve sync status")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to retrieve sync status")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, status)
+}
+
+// RecomputeSyncStatus handles POST /api/v1/sync/status/recompute
+// Rebuilds the maintained checksum with a full scan, then returns the sync
+// status as GET /api/v1/sync/status does. GetSyncStatus normally keeps the
+// checksum up to date incrementally; this is the fallback for suspected drift.
+func RecomputeSyncStatus(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	if err := models.RecomputeSyncChecksums(); err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to recompute sync checksums"), "status error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to recompute sync checksum")
+	}
+
+	status, err := models.GetSyncStatus(userGUID)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to get sync status"), "status error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "failed to retrieve sync status")
 	}
 
 	return writeSuccess(ctx, http.StatusOK, status)
@@ -257,3 +537,11 @@ func GetSyncStatus(ctx rweb.Context) error {
 func HealthCheck(ctx rweb.Context) error {
 	return writeSuccess(ctx, http.StatusOK, map[string]string{"status": "ok"})
 }
+
+// GetVersion handles GET /api/v1/version
+// Unauthenticated. Returns the build version, git commit, and build time
+// injected with -ldflags ("dev" when unset), for deployment checks and for
+// peers comparing versions.
+func GetVersion(ctx rweb.Context) error {
+	return writeSuccess(ctx, http.StatusOK, models.GetBuildInfo())
+}
@@ -3,9 +3,11 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"gonotes/models"
 
+	"github.com/rohanthewiz/logger"
 	"github.com/rohanthewiz/rweb"
 	"github.com/rohanthewiz/serr"
 )
@@ -14,7 +16,9 @@ import (
 // Sync Control API Handlers
 //
 // These endpoints power the UI controls for sync: a status indicator,
-// an enable/disable toggle, and a "Sync Now" button.
+// an enable/disable toggle, and a "Sync Now" button. The same controls are
+// served under /api/v1/sync/client/ for API clients, where status reports
+// an unconfigured sync client as 503 rather than as disabled.
 // All require authentication to prevent unauthorized state changes.
 // ============================================================================
 
@@ -25,7 +29,7 @@ import (
 func SyncControlStatus(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	client := models.GetSyncClient()
@@ -41,25 +45,44 @@ func SyncControlStatus(ctx rweb.Context) error {
 	return writeSuccess(ctx, http.StatusOK, client.GetStatus())
 }
 
+// SyncClientStatus handles GET /api/v1/sync/client/status
+// Returns the current state of the sync client, like SyncControlStatus, but
+// responds 503 when sync is not configured so API clients can tell an
+// unconfigured spoke from a disabled one.
+func SyncClientStatus(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	client := models.GetSyncClient()
+	if client == nil {
+		return writeError(ctx, http.StatusServiceUnavailable, ErrCodeUnavailable, "sync is not configured")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, client.GetStatus())
+}
+
 // SyncControlToggle handles POST /api/v1/sync/control/toggle
+// and POST /api/v1/sync/client/enabled
 // Enables or disables the sync client at runtime.
 // Request body: {"enabled": true} or {"enabled": false}
 func SyncControlToggle(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	client := models.GetSyncClient()
 	if client == nil {
-		return writeError(ctx, http.StatusServiceUnavailable, "sync is not configured")
+		return writeError(ctx, http.StatusServiceUnavailable, ErrCodeUnavailable, "sync is not configured")
 	}
 
 	var req struct {
 		Enabled bool `json:"enabled"`
 	}
 	if err := json.Unmarshal(ctx.Request().Body(), &req); err != nil {
-		return writeError(ctx, http.StatusBadRequest, "invalid request body")
+		return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid request body")
 	}
 
 	client.SetEnabled(req.Enabled)
@@ -68,26 +91,78 @@ func SyncControlToggle(ctx rweb.Context) error {
 }
 
 // SyncControlNow handles POST /api/v1/sync/control/sync-now
+// and POST /api/v1/sync/client/sync-now
 // Triggers an immediate sync cycle. Returns 409 Conflict if a sync
 // is already in progress to avoid queueing multiple cycles.
 func SyncControlNow(ctx rweb.Context) error {
 	userGUID := GetCurrentUserGUID(ctx)
 	if userGUID == "" {
-		return writeError(ctx, http.StatusUnauthorized, "authentication required")
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
 	}
 
 	client := models.GetSyncClient()
 	if client == nil {
-		return writeError(ctx, http.StatusServiceUnavailable, "sync is not configured")
+		return writeError(ctx, http.StatusServiceUnavailable, ErrCodeUnavailable, "sync is not configured")
 	}
 
 	if err := client.SyncNow(); err != nil {
 		// Distinguish "already in progress" from other errors
 		if err.Error() == "sync already in progress" || err.Error() == "sync is disabled" {
-			return writeError(ctx, http.StatusConflict, err.Error())
+			return writeError(ctx, http.StatusConflict, ErrCodeConflict, err.Error())
 		}
-		return writeError(ctx, http.StatusInternalServerError, serr.Wrap(err, "sync failed").Error())
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, serr.Wrap(err, "sync failed").Error())
 	}
 
 	return writeSuccess(ctx, http.StatusOK, client.GetStatus())
 }
+
+// SyncControlClearError handles POST /api/v1/sync/client/clear-error
+// Acknowledges the last sync error so a stale message stops showing in the
+// status indicator (e.g. after a failed cycle followed by disabling sync).
+func SyncControlClearError(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	client := models.GetSyncClient()
+	if client == nil {
+		return writeError(ctx, http.StatusServiceUnavailable, ErrCodeUnavailable, "sync is not configured")
+	}
+
+	client.ClearLastError()
+
+	return writeSuccess(ctx, http.StatusOK, client.GetStatus())
+}
+
+// SyncMetrics handles GET /api/v1/sync/metrics
+// Returns recent sync cycles recorded by this instance's sync client, most
+// recent first, one row per cycle. Works even while sync is not configured,
+// so history from earlier runs stays visible.
+//
+// Query parameters:
+//   - peer_id: Only cycles run under this peer ID (default: all)
+//   - limit: Maximum number of rows (default 50, max 1000)
+func SyncMetrics(ctx rweb.Context) error {
+	userGUID := GetCurrentUserGUID(ctx)
+	if userGUID == "" {
+		return writeError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required")
+	}
+
+	limit := 0 // 0 means the model's default
+	if limitStr := ctx.Request().QueryParam("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit < 0 {
+			return writeError(ctx, http.StatusBadRequest, ErrCodeValidation, "invalid limit parameter")
+		}
+		limit = parsedLimit
+	}
+
+	metrics, err := models.ListSyncMetrics(ctx.Request().QueryParam("peer_id"), limit)
+	if err != nil {
+		logger.LogErr(serr.Wrap(err, "failed to list sync metrics"), "database error")
+		return writeError(ctx, http.StatusInternalServerError, ErrCodeInternal, "database error")
+	}
+
+	return writeSuccess(ctx, http.StatusOK, metrics)
+}
@@ -3,10 +3,12 @@ package api_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -147,6 +149,51 @@ func TestHealthEndpoint(t *testing.T) {
 	}
 }
 
+func TestVersionEndpoint(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	getVersion := func() map[string]interface{} {
+		t.Helper()
+		resp, err := http.Get(server.baseURL + "/api/v1/version")
+		if err != nil {
+			t.Fatalf("failed to hit version endpoint: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200 without auth, got %d", resp.StatusCode)
+		}
+		var result api.APIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		data, ok := result.Data.(map[string]interface{})
+		if !ok {
+			t.Fatal("expected data to be an object")
+		}
+		return data
+	}
+
+	// Without -ldflags everything reads "dev"
+	data := getVersion()
+	for _, field := range []string{"version", "git_commit", "build_time"} {
+		if data[field] != "dev" {
+			t.Errorf("expected %s 'dev', got %v", field, data[field])
+		}
+	}
+
+	// Injected values are reported as set
+	origVersion, origCommit := models.Version, models.GitCommit
+	models.Version, models.GitCommit = "1.4.0", "abc1234"
+	t.Cleanup(func() { models.Version, models.GitCommit = origVersion, origCommit })
+
+	data = getVersion()
+	if data["version"] != "1.4.0" || data["git_commit"] != "abc1234" {
+		t.Errorf("expected injected version info, got %v", data)
+	}
+}
+
 // ============================================================================
 // TestPullEndpoint_Empty
 // ============================================================================
@@ -371,6 +418,74 @@ func TestPushIdempotency(t *testing.T) {
 	}
 }
 
+// ============================================================================
+// TestPushPartialMultiStatus
+// ============================================================================
+
+// TestPushPartialMultiStatus verifies that a push with some rejected changes
+// returns 207 Multi-Status with the usual accepted/rejected body.
+func TestPushPartialMultiStatus(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t)
+
+	pushTitle := "Partially Pushed"
+	pushReq := models.SyncPushRequest{
+		PeerID: "spoke-partial",
+		Changes: []models.SyncChange{
+			{
+				GUID:       "partial-push-ok",
+				EntityType: "note",
+				EntityGUID: "partial-pushed-note",
+				Operation:  models.OperationCreate,
+				Fragment: &models.NoteFragmentOutput{
+					Bitmask: models.FragmentTitle,
+					Title:   &pushTitle,
+				},
+				AuthoredAt: time.Now(),
+			},
+			{
+				GUID:       "partial-push-bad",
+				EntityType: "widget",
+				EntityGUID: "not-a-real-entity",
+				Operation:  models.OperationCreate,
+				AuthoredAt: time.Now(),
+			},
+		},
+	}
+
+	pushBodyJSON, _ := json.Marshal(pushReq)
+	req, _ := server.createAuthenticatedRequest("POST",
+		server.baseURL+"/api/v1/sync/push", bytes.NewBuffer(pushBodyJSON))
+	resp, err := server.client.Do(req)
+	if err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 207 for partial push, got %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var result api.APIResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	data := result.Data.(map[string]interface{})
+	accepted := data["accepted"].([]interface{})
+	rejected := data["rejected"].([]interface{})
+
+	if len(accepted) != 1 || accepted[0] != "partial-push-ok" {
+		t.Errorf("expected only partial-push-ok accepted, got %v", accepted)
+	}
+	if len(rejected) != 1 {
+		t.Fatalf("expected 1 rejected change, got %d", len(rejected))
+	}
+	if guid := rejected[0].(map[string]interface{})["guid"]; guid != "partial-push-bad" {
+		t.Errorf("expected partial-push-bad rejected, got %v", guid)
+	}
+}
+
 // ============================================================================
 // TestSnapshotEndpoint
 // ============================================================================
@@ -438,6 +553,80 @@ func TestSnapshotEndpoint(t *testing.T) {
 	}
 }
 
+// ============================================================================
+// TestSnapshotBatchEndpoint
+// ============================================================================
+
+// TestSnapshotBatchEndpoint verifies that POST /api/v1/sync/snapshot/batch
+// returns a full snapshot per existing note and lists unknown GUIDs as missing.
+func TestSnapshotBatchEndpoint(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t)
+
+	const noteCount = 50
+	var refs []models.EntityRef
+	for i := 0; i < noteCount; i++ {
+		body := fmt.Sprintf("Batch body %d", i)
+		noteInput := models.NoteInput{
+			GUID:  fmt.Sprintf("batch-snapshot-note-%d", i),
+			Title: "Batch Snapshot Note",
+			Body:  &body,
+		}
+		bodyJSON, _ := json.Marshal(noteInput)
+		createReq, _ := server.createAuthenticatedRequest("POST",
+			server.baseURL+"/api/v1/notes", bytes.NewBuffer(bodyJSON))
+		createResp, err := server.client.Do(createReq)
+		if err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+		createResp.Body.Close()
+		refs = append(refs, models.EntityRef{EntityType: "note", EntityGUID: noteInput.GUID})
+	}
+	refs = append(refs, models.EntityRef{EntityType: "note", EntityGUID: "no-such-note"})
+
+	reqJSON, _ := json.Marshal(models.SyncSnapshotBatchRequest{Entities: refs})
+	batchReq, _ := server.createAuthenticatedRequest("POST",
+		server.baseURL+"/api/v1/sync/snapshot/batch", bytes.NewBuffer(reqJSON))
+	batchResp, err := server.client.Do(batchReq)
+	if err != nil {
+		t.Fatalf("failed to get snapshot batch: %v", err)
+	}
+	defer batchResp.Body.Close()
+
+	if batchResp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(batchResp.Body)
+		t.Fatalf("expected 200, got %d: %s", batchResp.StatusCode, string(bodyBytes))
+	}
+
+	var result struct {
+		Success bool                             `json:"success"`
+		Data    models.SyncSnapshotBatchResponse `json:"data"`
+	}
+	if err := json.NewDecoder(batchResp.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if len(result.Data.Snapshots) != noteCount {
+		t.Fatalf("expected %d snapshots, got %d", noteCount, len(result.Data.Snapshots))
+	}
+	for i, snap := range result.Data.Snapshots {
+		wantBody := fmt.Sprintf("Batch body %d", i)
+		if snap.EntityGUID != refs[i].EntityGUID {
+			t.Errorf("snapshot %d: expected guid %s, got %s", i, refs[i].EntityGUID, snap.EntityGUID)
+		}
+		fragment, _ := snap.Fragment.(map[string]interface{})
+		if fragBody, _ := fragment["body"].(string); fragBody != wantBody {
+			t.Errorf("snapshot %d: expected full body %q, got %v", i, wantBody, fragment["body"])
+		}
+	}
+
+	if len(result.Data.Missing) != 1 || result.Data.Missing[0].EntityGUID != "no-such-note" {
+		t.Errorf("expected no-such-note reported missing, got %v", result.Data.Missing)
+	}
+}
+
 // ============================================================================
 // TestSyncStatusEndpoint
 // ============================================================================
@@ -495,9 +684,28 @@ func TestSyncStatusEndpoint(t *testing.T) {
 		t.Errorf("expected at least 1 note, got %v", noteCount)
 	}
 
-	if checksum, ok := data["checksum"].(string); !ok || checksum == "" {
+	checksum, ok := data["checksum"].(string)
+	if !ok || checksum == "" {
 		t.Errorf("expected non-empty checksum, got %v", data["checksum"])
 	}
+
+	// A full recompute agrees with the maintained checksum
+	recomputeReq, _ := server.createAuthenticatedRequest("POST",
+		server.baseURL+"/api/v1/sync/status/recompute", nil)
+	recomputeResp, err := server.client.Do(recomputeReq)
+	if err != nil {
+		t.Fatalf("failed to recompute sync status: %v", err)
+	}
+	defer recomputeResp.Body.Close()
+	if recomputeResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 from recompute, got %d", recomputeResp.StatusCode)
+	}
+	var recomputed api.APIResponse
+	json.NewDecoder(recomputeResp.Body).Decode(&recomputed)
+	recomputedData, _ := recomputed.Data.(map[string]interface{})
+	if recomputedData["checksum"] != checksum {
+		t.Errorf("expected recomputed checksum %s, got %v", checksum, recomputedData["checksum"])
+	}
 }
 
 // ============================================================================
@@ -566,3 +774,931 @@ func TestPullPaginates(t *testing.T) {
 		t.Errorf("expected 2 more changes on second pull, got %d", len(changes2))
 	}
 }
+
+// TestPullPeekDoesNotConsume verifies that a pull with peek=true returns
+// pending changes without marking them, so the next pull returns them again.
+func TestPullPeekDoesNotConsume(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t)
+
+	noteInput := models.NoteInput{GUID: "peek-note", Title: "Peek Note"}
+	bodyJSON, _ := json.Marshal(noteInput)
+	req, _ := server.createAuthenticatedRequest("POST",
+		server.baseURL+"/api/v1/notes", bytes.NewBuffer(bodyJSON))
+	resp, err := server.client.Do(req)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	resp.Body.Close()
+
+	pull := func(query string) int {
+		t.Helper()
+		req, _ := server.createAuthenticatedRequest("GET",
+			server.baseURL+"/api/v1/sync/pull?peer_id=spoke-peek"+query, nil)
+		resp, err := server.client.Do(req)
+		if err != nil {
+			t.Fatalf("failed to pull changes: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var result api.APIResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		return len(result.Data.(map[string]interface{})["changes"].([]interface{}))
+	}
+
+	peeked := pull("&peek=true")
+	if peeked == 0 {
+		t.Fatal("expected peek to return pending changes")
+	}
+	if got := pull(""); got != peeked {
+		t.Errorf("expected regular pull after peek to return %d changes, got %d", peeked, got)
+	}
+	if got := pull(""); got != 0 {
+		t.Errorf("expected regular pull to consume changes, got %d on second pull", got)
+	}
+}
+
+// TestPullIfModifiedSince verifies that a conditional pull gets 304 once the
+// peer has nothing waiting, and 200 with the changes otherwise.
+func TestPullIfModifiedSince(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t)
+
+	createNote := func(guid string) {
+		t.Helper()
+		bodyJSON, _ := json.Marshal(models.NoteInput{GUID: guid, Title: guid})
+		req, _ := server.createAuthenticatedRequest("POST",
+			server.baseURL+"/api/v1/notes", bytes.NewBuffer(bodyJSON))
+		resp, err := server.client.Do(req)
+		if err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// pull returns the status and, for a 200, the number of changes
+	pull := func(ifModifiedSince string) (int, int) {
+		t.Helper()
+		req, _ := server.createAuthenticatedRequest("GET",
+			server.baseURL+"/api/v1/sync/pull?peer_id=spoke-ims", nil)
+		if ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", ifModifiedSince)
+		}
+		resp, err := server.client.Do(req)
+		if err != nil {
+			t.Fatalf("failed to pull changes: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode, 0
+		}
+		var result api.APIResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, len(result.Data.(map[string]interface{})["changes"].([]interface{}))
+	}
+
+	since := time.Now().UTC().Format(http.TimeFormat)
+	createNote("ims-note-1")
+
+	if status, count := pull(since); status != http.StatusOK || count != 1 {
+		t.Fatalf("expected 200 with 1 change while a change is waiting, got %d with %d", status, count)
+	}
+	if status, _ := pull(since); status != http.StatusNotModified {
+		t.Errorf("expected 304 for a caught-up peer, got %d", status)
+	}
+	if status, count := pull(""); status != http.StatusOK || count != 0 {
+		t.Errorf("expected an unconditional pull to return 200 with no changes, got %d with %d", status, count)
+	}
+	if status, _ := pull("not a date"); status != http.StatusOK {
+		t.Errorf("expected an invalid If-Modified-Since to be ignored, got %d", status)
+	}
+
+	createNote("ims-note-2")
+	if status, count := pull(since); status != http.StatusOK || count != 1 {
+		t.Errorf("expected 200 with the new change, got %d with %d", status, count)
+	}
+}
+
+// TestPullIfModifiedSincePreApprovedPeer verifies that the conditional pull
+// check uses the pulling user's changes, not those of the admin who approved
+// the peer before its first contact.
+func TestPullIfModifiedSincePreApprovedPeer(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t) // The first user is an admin
+	do := func(method, path, token string, payload interface{}, header map[string]string) int {
+		t.Helper()
+		var body io.Reader
+		if payload != nil {
+			bodyJSON, _ := json.Marshal(payload)
+			body = bytes.NewBuffer(bodyJSON)
+		}
+		req, _ := http.NewRequest(method, server.baseURL+path, body)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := server.client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := do("POST", "/api/v1/sync/peers/approve", server.authToken,
+		map[string]string{"peer_id": "spoke-preapproved"}, nil); status != http.StatusOK {
+		t.Fatalf("failed to approve peer: %d", status)
+	}
+
+	user, err := models.CreateUser(models.UserRegisterInput{Username: "spokeowner", Password: "testpassword123"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	userToken, err := models.GenerateToken(user)
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	if status := do("POST", "/api/v1/notes", userToken,
+		models.NoteInput{GUID: "preapproved-note", Title: "Pending"}, nil); status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d", status)
+	}
+
+	ims := map[string]string{"If-Modified-Since": time.Now().UTC().Format(http.TimeFormat)}
+	if status := do("GET", "/api/v1/sync/pull?peer_id=spoke-preapproved", userToken, nil, ims); status != http.StatusOK {
+		t.Errorf("expected 200 while the user has a pending change, got %d", status)
+	}
+	if status := do("GET", "/api/v1/sync/pull?peer_id=spoke-preapproved", userToken, nil, ims); status != http.StatusNotModified {
+		t.Errorf("expected 304 once the user's change was pulled, got %d", status)
+	}
+}
+
+// TestPullCategoryFilter verifies that ?category= restricts the pull to that
+// category's own changes and its notes' changes, and that a note leaving the
+// category still delivers the mapping change that removes it.
+func TestPullCategoryFilter(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t)
+
+	do := func(method, path string, payload any) map[string]interface{} {
+		t.Helper()
+		var body io.Reader
+		if payload != nil {
+			b, _ := json.Marshal(payload)
+			body = bytes.NewBuffer(b)
+		}
+		req, _ := server.createAuthenticatedRequest(method, server.baseURL+path, body)
+		resp, err := server.client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		result["status"] = float64(resp.StatusCode)
+		return result
+	}
+	create := func(path string, payload any) (id int64, guid string) {
+		t.Helper()
+		data := do("POST", path, payload)["data"].(map[string]interface{})
+		return int64(data["id"].(float64)), data["guid"].(string)
+	}
+	pulled := func(categoryGUID string) map[string]int {
+		t.Helper()
+		result := do("GET", "/api/v1/sync/pull?peer_id=spoke-mobile&category="+categoryGUID, nil)
+		counts := map[string]int{}
+		for _, c := range result["data"].(map[string]interface{})["changes"].([]interface{}) {
+			counts[c.(map[string]interface{})["entity_guid"].(string)]++
+		}
+		return counts
+	}
+
+	mobileID, mobileGUID := create("/api/v1/categories", map[string]string{"name": "Mobile"})
+	otherID, otherGUID := create("/api/v1/categories", map[string]string{"name": "Other"})
+	inID, _ := create("/api/v1/notes", models.NoteInput{GUID: "cat-filter-in", Title: "In"})
+	create("/api/v1/notes", models.NoteInput{GUID: "cat-filter-none", Title: "Uncategorized"})
+	otherNoteID, _ := create("/api/v1/notes", models.NoteInput{GUID: "cat-filter-other", Title: "Elsewhere"})
+	do("POST", fmt.Sprintf("/api/v1/notes/%d/categories/%d", inID, mobileID), nil)
+	do("POST", fmt.Sprintf("/api/v1/notes/%d/categories/%d", otherNoteID, otherID), nil)
+
+	got := pulled(mobileGUID)
+	if got["cat-filter-in"] != 2 {
+		t.Errorf("expected the note's create and mapping changes, got %d changes", got["cat-filter-in"])
+	}
+	if got[mobileGUID] == 0 {
+		t.Error("expected the category's own changes")
+	}
+	for _, excluded := range []string{"cat-filter-none", "cat-filter-other", otherGUID} {
+		if got[excluded] != 0 {
+			t.Errorf("expected no changes for %s, got %d", excluded, got[excluded])
+		}
+	}
+
+	// Removing the note from the category still reaches the scoped peer
+	do("DELETE", fmt.Sprintf("/api/v1/notes/%d/categories/%d", inID, mobileID), nil)
+	if got := pulled(mobileGUID); got["cat-filter-in"] != 1 {
+		t.Errorf("expected the removal mapping change, got %v", got)
+	}
+
+	// The filtered-out changes are still pending for an unfiltered pull
+	if got := pulled(""); got["cat-filter-none"] == 0 || got[otherGUID] == 0 {
+		t.Errorf("expected filtered-out changes on an unfiltered pull, got %v", got)
+	}
+
+	if status := do("GET", "/api/v1/sync/pull?peer_id=spoke-mobile&category=no-such-category", nil)["status"]; status != float64(http.StatusNotFound) {
+		t.Errorf("expected 404 for an unknown category, got %v", status)
+	}
+}
+
+// TestPushFromSpokesAssignsLocalIDs verifies that numeric ids never cross
+// the wire: two spokes whose notes both have local id 1 push them to a hub
+// that already has a note with id 1, and the hub gives each its own id,
+// consistent between disk and cache.
+func TestPushFromSpokesAssignsLocalIDs(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t)
+
+	hubTitle := "Hub's own note"
+	body, _ := json.Marshal(map[string]string{"guid": "hub-local-note", "title": hubTitle})
+	req, _ := server.createAuthenticatedRequest("POST", server.baseURL+"/api/v1/notes", bytes.NewBuffer(body))
+	resp, err := server.client.Do(req)
+	if err != nil {
+		t.Fatalf("failed to create hub note: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 creating hub note, got %d", resp.StatusCode)
+	}
+
+	// Each spoke's first note and first change both have id 1 on that spoke
+	for _, peer := range []string{"spoke-a", "spoke-b"} {
+		title := "First note on " + peer
+		pushReq := models.SyncPushRequest{
+			PeerID: peer,
+			Changes: []models.SyncChange{{
+				ID:         1,
+				GUID:       peer + "-change-1",
+				EntityType: "note",
+				EntityGUID: peer + "-note-1",
+				Operation:  models.OperationCreate,
+				Fragment:   &models.NoteFragmentOutput{Bitmask: models.FragmentTitle, Title: &title},
+				AuthoredAt: time.Now(),
+			}},
+		}
+		pushBody, _ := json.Marshal(pushReq)
+		req, _ := server.createAuthenticatedRequest("POST", server.baseURL+"/api/v1/sync/push", bytes.NewBuffer(pushBody))
+		resp, err := server.client.Do(req)
+		if err != nil {
+			t.Fatalf("push from %s failed: %v", peer, err)
+		}
+		var result api.APIResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 for push from %s, got %d: %v", peer, resp.StatusCode, result)
+		}
+		if accepted := result.Data.(map[string]interface{})["accepted"].([]interface{}); len(accepted) != 1 {
+			t.Fatalf("expected push from %s to be accepted, got %v", peer, result.Data)
+		}
+	}
+
+	seen := map[int64]string{}
+	for _, guid := range []string{"hub-local-note", "spoke-a-note-1", "spoke-b-note-1"} {
+		note, err := models.GetNoteByGUID(guid)
+		if err != nil || note == nil {
+			t.Fatalf("note %s missing on hub: %v", guid, err)
+		}
+		if other, dup := seen[note.ID]; dup {
+			t.Fatalf("notes %s and %s share id %d", other, guid, note.ID)
+		}
+		seen[note.ID] = guid
+
+		// The cache row under that id is the same note as on disk
+		cached, err := models.GetNoteByID(note.ID, note.CreatedBy.String)
+		if err != nil || cached == nil || cached.GUID != guid {
+			t.Errorf("cache row for id %d should be %s, got %+v (err %v)", note.ID, guid, cached, err)
+		}
+	}
+}
+
+// TestSyncResetResendsHistory verifies that after POST /api/v1/sync/reset a
+// peer's next pull returns the user's full change history again, including
+// the changes that peer pushed itself.
+func TestSyncResetResendsHistory(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t)
+	const peerID = "spoke-reset"
+
+	post := func(path string, payload interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		bodyJSON, _ := json.Marshal(payload)
+		req, _ := server.createAuthenticatedRequest("POST", server.baseURL+path, bytes.NewBuffer(bodyJSON))
+		resp, err := server.client.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var result api.APIResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		data, _ := result.Data.(map[string]interface{})
+		return resp.StatusCode, data
+	}
+	pullGUIDs := func() map[string]bool {
+		t.Helper()
+		req, _ := server.createAuthenticatedRequest("GET",
+			server.baseURL+"/api/v1/sync/pull?peer_id="+peerID, nil)
+		resp, err := server.client.Do(req)
+		if err != nil {
+			t.Fatalf("failed to pull changes: %v", err)
+		}
+		defer resp.Body.Close()
+		var result api.APIResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		guids := map[string]bool{}
+		for _, c := range result.Data.(map[string]interface{})["changes"].([]interface{}) {
+			guids[c.(map[string]interface{})["entity_guid"].(string)] = true
+		}
+		return guids
+	}
+
+	if status, _ := post("/api/v1/notes", models.NoteInput{GUID: "reset-hub-note", Title: "Hub Note"}); status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d", status)
+	}
+	pushedTitle := "Pushed by spoke"
+	status, _ := post("/api/v1/sync/push", models.SyncPushRequest{
+		PeerID: peerID,
+		Changes: []models.SyncChange{{
+			GUID:       "reset-push-change",
+			EntityType: "note",
+			EntityGUID: "reset-spoke-note",
+			Operation:  models.OperationCreate,
+			Fragment:   &models.NoteFragmentOutput{Bitmask: models.FragmentTitle, Title: &pushedTitle},
+			AuthoredAt: time.Now(),
+		}},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("push failed: %d", status)
+	}
+
+	// Normal sync: the peer gets the hub's note but not its own back, once
+	first := pullGUIDs()
+	if !first["reset-hub-note"] || first["reset-spoke-note"] {
+		t.Fatalf("expected first pull to carry only the hub note, got %v", first)
+	}
+	if again := pullGUIDs(); len(again) != 0 {
+		t.Fatalf("expected nothing left to pull, got %v", again)
+	}
+
+	status, data := post("/api/v1/sync/reset", models.SyncResetRequest{PeerID: peerID})
+	if status != http.StatusOK {
+		t.Fatalf("expected 200 from reset, got %d", status)
+	}
+	if data["note_changes_reset"].(float64) == 0 || data["originated_changes_sent"].(float64) != 1 {
+		t.Errorf("unexpected reset counts: %v", data)
+	}
+
+	afterReset := pullGUIDs()
+	if !afterReset["reset-hub-note"] || !afterReset["reset-spoke-note"] {
+		t.Errorf("expected pull after reset to return the full history, got %v", afterReset)
+	}
+
+	if status, _ := post("/api/v1/sync/reset", map[string]string{}); status != http.StatusBadRequest {
+		t.Errorf("expected 400 without peer_id, got %d", status)
+	}
+}
+
+// TestPushRejectsInconsistentFragment verifies that a pushed change whose
+// fragment bitmask doesn't match its fields is rejected with a reason and
+// not applied.
+func TestPushRejectsInconsistentFragment(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t)
+
+	title := "Mismatched"
+	body := "body without its bit"
+	pushReq := models.SyncPushRequest{
+		PeerID: "spoke-mismatch",
+		Changes: []models.SyncChange{{
+			GUID:       "mismatch-change",
+			EntityType: "note",
+			EntityGUID: "mismatch-note",
+			Operation:  models.OperationCreate,
+			Fragment:   &models.NoteFragmentOutput{Bitmask: models.FragmentTitle, Title: &title, Body: &body},
+			AuthoredAt: time.Now(),
+		}},
+	}
+	pushBody, _ := json.Marshal(pushReq)
+	req, _ := server.createAuthenticatedRequest("POST", server.baseURL+"/api/v1/sync/push", bytes.NewBuffer(pushBody))
+	resp, err := server.client.Do(req)
+	if err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("expected %d, got %d", http.StatusMultiStatus, resp.StatusCode)
+	}
+	var result api.APIResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	rejected := result.Data.(map[string]interface{})["rejected"].([]interface{})
+	if len(rejected) != 1 {
+		t.Fatalf("expected 1 rejection, got %v", result.Data)
+	}
+	reason := rejected[0].(map[string]interface{})["reason"].(string)
+	if !strings.Contains(reason, "body") || !strings.Contains(reason, "bitmask") {
+		t.Errorf("expected reason to explain the body/bitmask mismatch, got %q", reason)
+	}
+
+	if note, _ := models.GetNoteByGUID("mismatch-note"); note != nil {
+		t.Error("rejected change should not create the note")
+	}
+}
+
+// TestPushChangesCap verifies that a push over the configured change cap is
+// refused with 413 and applies nothing, while one within it succeeds.
+func TestPushChangesCap(t *testing.T) {
+	t.Setenv(models.MaxPushChangesEnvVar, "2")
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t)
+
+	push := func(n int) int {
+		t.Helper()
+		pushReq := models.SyncPushRequest{PeerID: "spoke-cap"}
+		for i := 0; i < n; i++ {
+			title := fmt.Sprintf("Capped %d-%d", n, i)
+			pushReq.Changes = append(pushReq.Changes, models.SyncChange{
+				GUID:       fmt.Sprintf("cap-change-%d-%d", n, i),
+				EntityType: "note",
+				EntityGUID: fmt.Sprintf("cap-note-%d-%d", n, i),
+				Operation:  models.OperationCreate,
+				Fragment:   &models.NoteFragmentOutput{Bitmask: models.FragmentTitle, Title: &title},
+				AuthoredAt: time.Now(),
+			})
+		}
+		pushBody, _ := json.Marshal(pushReq)
+		req, _ := server.createAuthenticatedRequest("POST", server.baseURL+"/api/v1/sync/push", bytes.NewBuffer(pushBody))
+		resp, err := server.client.Do(req)
+		if err != nil {
+			t.Fatalf("push failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := push(3); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected %d for a push over the cap, got %d", http.StatusRequestEntityTooLarge, status)
+	}
+	if note, _ := models.GetNoteByGUID("cap-note-3-0"); note != nil {
+		t.Error("an over-cap push should not apply any changes")
+	}
+
+	if status := push(2); status != http.StatusOK {
+		t.Fatalf("expected %d for a push within the cap, got %d", http.StatusOK, status)
+	}
+	if note, _ := models.GetNoteByGUID("cap-note-2-1"); note == nil {
+		t.Error("expected the within-cap push to be applied")
+	}
+}
+
+// TestPushRejectsCreateWithBodyDiff verifies that a pushed note create whose
+// body is a diff is rejected with a reason, even when the note already
+// exists and the create would otherwise be skipped as a duplicate.
+func TestPushRejectsCreateWithBodyDiff(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t)
+
+	noteBody, _ := json.Marshal(map[string]string{"guid": "diff-existing-note", "title": "Existing"})
+	noteReq, _ := server.createAuthenticatedRequest("POST", server.baseURL+"/api/v1/notes", bytes.NewBuffer(noteBody))
+	noteResp, err := server.client.Do(noteReq)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	noteResp.Body.Close()
+	if noteResp.StatusCode != http.StatusCreated {
+		t.Fatalf("failed to create note: %d", noteResp.StatusCode)
+	}
+
+	title := "Diffed"
+	diff := "@@ -0,0 +1,4 @@\n+body\n"
+	pushReq := models.SyncPushRequest{PeerID: "spoke-diff-create"}
+	for _, noteGUID := range []string{"diff-new-note", "diff-existing-note"} {
+		pushReq.Changes = append(pushReq.Changes, models.SyncChange{
+			GUID:       "diff-create-" + noteGUID,
+			EntityType: "note",
+			EntityGUID: noteGUID,
+			Operation:  models.OperationCreate,
+			Fragment: &models.NoteFragmentOutput{
+				Bitmask: models.FragmentTitle | models.FragmentBody, Title: &title, Body: &diff, BodyIsDiff: true,
+			},
+			AuthoredAt: time.Now(),
+		})
+	}
+	pushBody, _ := json.Marshal(pushReq)
+	req, _ := server.createAuthenticatedRequest("POST", server.baseURL+"/api/v1/sync/push", bytes.NewBuffer(pushBody))
+	resp, err := server.client.Do(req)
+	if err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("expected %d, got %d", http.StatusMultiStatus, resp.StatusCode)
+	}
+	var result api.APIResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	rejected := result.Data.(map[string]interface{})["rejected"].([]interface{})
+	if len(rejected) != 2 {
+		t.Fatalf("expected 2 rejections, got %v", result.Data)
+	}
+	for _, r := range rejected {
+		reason := r.(map[string]interface{})["reason"].(string)
+		if !strings.Contains(reason, "diff") || !strings.Contains(reason, "full body") {
+			t.Errorf("expected reason to explain creates need the full body, got %q", reason)
+		}
+	}
+
+	if note, _ := models.GetNoteByGUID("diff-new-note"); note != nil {
+		t.Error("rejected change should not create the note")
+	}
+}
+
+// TestPeerAllowlist verifies that with GONOTES_PEER_ALLOWLIST on, pulls and
+// pushes from unapproved peers are refused until an admin approves them.
+func TestPeerAllowlist(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t) // The first user is an admin
+	t.Setenv(models.PeerAllowlistEnvVar, "true")
+
+	do := func(method, path string, payload interface{}) (int, interface{}) {
+		t.Helper()
+		var body io.Reader
+		if payload != nil {
+			bodyJSON, _ := json.Marshal(payload)
+			body = bytes.NewBuffer(bodyJSON)
+		}
+		req, _ := server.createAuthenticatedRequest(method, server.baseURL+path, body)
+		resp, err := server.client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var result api.APIResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result.Data
+	}
+
+	if status, _ := do("GET", "/api/v1/sync/pull?peer_id=spoke-new", nil); status != http.StatusForbidden {
+		t.Fatalf("expected 403 pulling as an unapproved peer, got %d", status)
+	}
+	push := models.SyncPushRequest{PeerID: "spoke-new", Changes: []models.SyncChange{}}
+	if status, _ := do("POST", "/api/v1/sync/push", push); status != http.StatusForbidden {
+		t.Fatalf("expected 403 pushing as an unapproved peer, got %d", status)
+	}
+
+	// The refused peer was registered as pending
+	status, data := do("GET", "/api/v1/sync/peers", nil)
+	if status != http.StatusOK {
+		t.Fatalf("failed to list peers: %d", status)
+	}
+	peers := data.(map[string]interface{})["peers"].([]interface{})
+	if len(peers) != 1 || peers[0].(map[string]interface{})["status"] != models.PeerStatusPending {
+		t.Fatalf("expected spoke-new pending, got %v", peers)
+	}
+
+	if status, _ := do("POST", "/api/v1/sync/peers/approve", map[string]string{"peer_id": "spoke-new"}); status != http.StatusOK {
+		t.Fatalf("failed to approve peer: %d", status)
+	}
+	if status, _ := do("GET", "/api/v1/sync/pull?peer_id=spoke-new", nil); status != http.StatusOK {
+		t.Errorf("expected approved peer to pull, got %d", status)
+	}
+	if status, _ := do("GET", "/api/v1/sync/pull?peer_id=spoke-other", nil); status != http.StatusForbidden {
+		t.Errorf("expected another unapproved peer to be refused, got %d", status)
+	}
+
+	// With enforcement off, any peer may sync
+	t.Setenv(models.PeerAllowlistEnvVar, "")
+	if status, _ := do("GET", "/api/v1/sync/pull?peer_id=spoke-other", nil); status != http.StatusOK {
+		t.Errorf("expected pull to succeed with the allowlist off, got %d", status)
+	}
+}
+
+// TestSyncClientEndpointsUnconfigured verifies the sync client endpoints
+// require authentication and report 503 when no sync client is configured
+func TestSyncClientEndpointsUnconfigured(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t)
+
+	endpoints := []struct {
+		method, path, body string
+	}{
+		{"GET", "/api/v1/sync/client/status", ""},
+		{"POST", "/api/v1/sync/client/sync-now", ""},
+		{"POST", "/api/v1/sync/client/enabled", `{"enabled":true}`},
+	}
+	for _, ep := range endpoints {
+		req, _ := http.NewRequest(ep.method, server.baseURL+ep.path, bytes.NewBufferString(ep.body))
+		resp, err := server.client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", ep.method, ep.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s %s: expected 401 without auth, got %d", ep.method, ep.path, resp.StatusCode)
+		}
+
+		req, _ = server.createAuthenticatedRequest(ep.method, server.baseURL+ep.path, bytes.NewBufferString(ep.body))
+		resp, err = server.client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", ep.method, ep.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("%s %s: expected 503 without a sync client, got %d", ep.method, ep.path, resp.StatusCode)
+		}
+	}
+}
+
+// TestChangeDeliveryStatusEndpoint verifies that GET
+// /api/v1/sync/changes/:guid/peers lists the peers that pulled a change as
+// delivered and the other registered peers as pending.
+func TestChangeDeliveryStatusEndpoint(t *testing.T) {
+	server, cleanup := setupSyncTestServer(t)
+	defer cleanup()
+
+	server.registerAndLogin(t)
+
+	bodyJSON, _ := json.Marshal(models.NoteInput{GUID: "delivery-note", Title: "Delivery Note"})
+	createReq, _ := server.createAuthenticatedRequest("POST",
+		server.baseURL+"/api/v1/notes", bytes.NewBuffer(bodyJSON))
+	createResp, err := server.client.Do(createReq)
+	if err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+	createResp.Body.Close()
+
+	get := func(path string) (int, map[string]interface{}) {
+		t.Helper()
+		req, _ := server.createAuthenticatedRequest("GET", server.baseURL+path, nil)
+		resp, err := server.client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var result api.APIResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		data, _ := result.Data.(map[string]interface{})
+		return resp.StatusCode, data
+	}
+
+	// delivery-a receives the change; delivery-b only peeks, so it registers without it
+	_, pulled := get("/api/v1/sync/pull?peer_id=delivery-a")
+	changes, _ := pulled["changes"].([]interface{})
+	if len(changes) == 0 {
+		t.Fatal("expected the pull to return the note's change")
+	}
+	changeGUID := changes[0].(map[string]interface{})["guid"].(string)
+	get("/api/v1/sync/pull?peer_id=delivery-b&peek=true")
+
+	status, data := get("/api/v1/sync/changes/" + changeGUID + "/peers")
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if data["entity_type"] != "note" || data["entity_guid"] != "delivery-note" {
+		t.Errorf("expected the note change, got %v", data)
+	}
+	delivered, _ := data["delivered"].([]interface{})
+	if len(delivered) != 1 || delivered[0].(map[string]interface{})["peer_id"] != "delivery-a" {
+		t.Errorf("expected delivered to delivery-a only, got %v", data["delivered"])
+	}
+	pending, _ := data["pending"].([]interface{})
+	if len(pending) != 1 || pending[0] != "delivery-b" {
+		t.Errorf("expected delivery-b pending, got %v", data["pending"])
+	}
+
+	if status, _ := get("/api/v1/sync/changes/no-such-change/peers"); status != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown change, got %d", status)
+	}
+}
+
+// TestChangeDetailEndpoint fetches note and category changes by GUID and
+// checks the decoded operation, field names, diff flag, and fragment.
+func TestChangeDetailEndpoint(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	body := strings.Repeat("A line of a long note body that barely changes.\n", 50)
+	_, created := ts.request("POST", "/api/v1/notes", map[string]interface{}{
+		"guid": "detail-note", "title": "Detail Note", "body": body,
+	})
+	noteData, _ := created["data"].(map[string]interface{})
+	if status, _ := ts.request("PUT", fmt.Sprintf("/api/v1/notes/%.0f", noteData["id"]),
+		map[string]interface{}{"title": "Detail Note", "body": body + "One more line.\n"}); status != http.StatusOK {
+		t.Fatalf("failed to update note: status %d", status)
+	}
+	ts.request("POST", "/api/v1/categories", map[string]interface{}{"name": "Detail Category"})
+
+	_, pulled := ts.request("GET", "/api/v1/sync/pull?peer_id=detail-peer&peek=true", nil)
+	pullData, _ := pulled["data"].(map[string]interface{})
+	changes, _ := pullData["changes"].([]interface{})
+	byOperation := map[string]string{}
+	for _, c := range changes {
+		change := c.(map[string]interface{})
+		byOperation[fmt.Sprintf("%v-%v", change["entity_type"], change["operation"])] = change["guid"].(string)
+	}
+
+	status, resp := ts.request("GET", "/api/v1/changes/"+byOperation["note-1"], nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200 for the note create, got %d: %v", status, resp)
+	}
+	detail, _ := resp["data"].(map[string]interface{})
+	if detail["operation_name"] != "create" || detail["entity_guid"] != "detail-note" {
+		t.Errorf("expected the note's create, got %v", detail)
+	}
+	// A create is a full snapshot, so every field is set
+	if fields := fmt.Sprint(detail["changed_fields"]); fields != "[title description body tags is_private]" {
+		t.Errorf("expected every note field in the create, got %s", fields)
+	}
+	if fragment, _ := detail["fragment"].(map[string]interface{}); fragment["title"] != "Detail Note" {
+		t.Errorf("expected the fragment's title, got %v", detail["fragment"])
+	}
+
+	// The small edit to a long body is stored as a diff
+	_, resp = ts.request("GET", "/api/v1/changes/"+byOperation["note-2"], nil)
+	detail, _ = resp["data"].(map[string]interface{})
+	if fields := fmt.Sprint(detail["changed_fields"]); fields != "[body]" || detail["body_is_diff"] != true {
+		t.Errorf("expected a body diff, got fields %s, body_is_diff %v", fields, detail["body_is_diff"])
+	}
+
+	_, resp = ts.request("GET", "/api/v1/changes/"+byOperation["category-1"], nil)
+	detail, _ = resp["data"].(map[string]interface{})
+	if detail["entity_type"] != "category" || fmt.Sprint(detail["changed_fields"]) != "[name description subcategories]" {
+		t.Errorf("expected the category create with every field, got %v", detail)
+	}
+
+	if status, _ := ts.request("GET", "/api/v1/changes/no-such-change", nil); status != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown change, got %d", status)
+	}
+}
+
+// TestReadOnlyMode verifies that a read-only instance refuses writes,
+// including sync push, with 503 while reads and sync pull keep working.
+func TestReadOnlyMode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": "read-only-note", "title": "Before"})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d %v", status, resp)
+	}
+	notePath := fmt.Sprintf("/api/v1/notes/%.0f", resp["data"].(map[string]interface{})["id"])
+
+	models.SetReadOnly(true)
+	defer models.SetReadOnly(false)
+
+	title := "Pushed"
+	push := models.SyncPushRequest{
+		PeerID: "read-only-spoke",
+		Changes: []models.SyncChange{{
+			GUID:       "read-only-push-001",
+			EntityType: "note",
+			EntityGUID: "read-only-pushed-note",
+			Operation:  models.OperationCreate,
+			Fragment:   &models.NoteFragmentOutput{Bitmask: models.FragmentTitle, Title: &title},
+			AuthoredAt: time.Now(),
+		}},
+	}
+
+	for _, write := range []struct {
+		method, path string
+		body         interface{}
+	}{
+		{"POST", "/api/v1/notes", map[string]interface{}{"title": "During"}},
+		{"PUT", notePath, map[string]interface{}{"title": "Changed"}},
+		{"DELETE", notePath, nil},
+		{"POST", "/api/v1/categories", map[string]interface{}{"name": "Read Only"}},
+		{"POST", "/api/v1/sync/push", push},
+	} {
+		status, resp := ts.request(write.method, write.path, write.body)
+		if status != http.StatusServiceUnavailable || resp["code"] != api.ErrCodeUnavailable {
+			t.Errorf("%s %s: expected 503 %s, got %d %v", write.method, write.path, api.ErrCodeUnavailable, status, resp)
+		}
+	}
+
+	for _, path := range []string{"/api/v1/notes", notePath, "/api/v1/sync/pull?peer_id=read-only-spoke", "/api/v1/sync/status"} {
+		if status, resp := ts.request("GET", path, nil); status != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d %v", path, status, resp)
+		}
+	}
+
+	if _, err := models.CreateNote(models.NoteInput{Title: "Direct"}, "read-only-user"); !errors.Is(err, models.ErrReadOnly) {
+		t.Errorf("expected CreateNote to return ErrReadOnly, got %v", err)
+	}
+
+	// Writes resume once read-only mode is off
+	models.SetReadOnly(false)
+	if status, _ := ts.request("PUT", notePath, map[string]interface{}{"title": "After"}); status != http.StatusOK {
+		t.Errorf("expected the update to succeed after read-only mode, got %d", status)
+	}
+}
+
+// TestReadOnlyModelErrors verifies that handlers answer a write refused by
+// the models with models.ErrReadOnly with 503 UNAVAILABLE, as the middleware
+// does, for requests that got past ReadOnlyMiddleware before read-only mode
+// came on.
+func TestReadOnlyModelErrors(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ts := newTestServer(t)
+	defer ts.cleanup()
+
+	status, resp := ts.request("POST", "/api/v1/notes", map[string]interface{}{"guid": "read-only-model-note", "title": "Before"})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create note: %d %v", status, resp)
+	}
+	notePath := fmt.Sprintf("/api/v1/notes/%.0f", resp["data"].(map[string]interface{})["id"])
+	status, resp = ts.request("POST", "/api/v1/categories", map[string]interface{}{"name": "Read Only Model"})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to create category: %d %v", status, resp)
+	}
+	categoryPath := fmt.Sprintf("/api/v1/categories/%.0f", resp["data"].(map[string]interface{})["id"])
+
+	// The same handlers without ReadOnlyMiddleware in front of them
+	readyChan := make(chan struct{}, 1)
+	srv := rweb.NewServer(rweb.ServerOptions{ReadyChan: readyChan, Address: "localhost:"})
+	srv.Use(web.JWTAuthMiddleware)
+	srv.Put("/api/v1/notes/:id", api.UpdateNote)
+	srv.Post("/api/v1/notes/:id/view", api.RecordNoteView)
+	srv.Post("/api/v1/categories/:id/subcategories", api.AddSubcategory)
+	srv.Post("/api/v1/sync/push", api.PushChanges)
+	go func() { _ = srv.Run() }()
+	<-readyChan
+	direct := &testServer{
+		baseURL:   fmt.Sprintf("http://localhost:%s", srv.GetListenPort()),
+		client:    ts.client,
+		authToken: ts.authToken,
+	}
+
+	models.SetReadOnly(true)
+	defer models.SetReadOnly(false)
+
+	title := "Pushed"
+	push := models.SyncPushRequest{
+		PeerID: "read-only-model-spoke",
+		Changes: []models.SyncChange{{
+			GUID:       "read-only-model-push-001",
+			EntityType: "note",
+			EntityGUID: "read-only-model-note",
+			Operation:  models.OperationUpdate,
+			Fragment:   &models.NoteFragmentOutput{Bitmask: models.FragmentTitle, Title: &title},
+			AuthoredAt: time.Now(),
+		}},
+	}
+
+	for _, write := range []struct {
+		method, path string
+		body         interface{}
+	}{
+		{"PUT", notePath, map[string]interface{}{"title": "Changed"}},
+		{"POST", notePath + "/view", nil},
+		{"POST", categoryPath + "/subcategories", map[string]interface{}{"name": "added"}},
+		{"POST", "/api/v1/sync/push", push},
+	} {
+		status, resp := direct.request(write.method, write.path, write.body)
+		if status != http.StatusServiceUnavailable || resp["code"] != api.ErrCodeUnavailable || resp["error"] != "read-only mode" {
+			t.Errorf("%s %s: expected 503 %s, got %d %v", write.method, write.path, api.ErrCodeUnavailable, status, resp)
+		}
+	}
+}
@@ -2,22 +2,71 @@ package web
 
 import (
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"gonotes/models"
+	"gonotes/web/api"
 
 	"github.com/rohanthewiz/logger"
 	"github.com/rohanthewiz/rweb"
 )
 
-// CorsMiddleware handles CORS headers for cross-origin requests
+// CORSOriginsEnvVar lists the origins browser clients may call the API from,
+// comma-separated (e.g. "https://notes.example.com,http://localhost:3000"),
+// or "*" for any origin. Unset means "*".
+const CORSOriginsEnvVar = "GONOTES_CORS_ORIGINS"
+
+// corsAllowHeaders are the request headers browser clients may send.
+const corsAllowHeaders = "Content-Type, Authorization, X-Requested-With, X-Body-Encoding, Idempotency-Key, If-None-Match"
+
+// CORSOrigins returns the configured allowed origins. A single "*" entry
+// allows every origin.
+func CORSOrigins() []string {
+	originsStr := os.Getenv(CORSOriginsEnvVar)
+	if strings.TrimSpace(originsStr) == "" {
+		return []string{"*"}
+	}
+	var origins []string
+	for _, origin := range strings.Split(originsStr, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// corsAllowedOrigin returns the Access-Control-Allow-Origin value for a
+// request from origin, or "" if the origin isn't allowed.
+func corsAllowedOrigin(origin string) string {
+	for _, allowed := range CORSOrigins() {
+		if allowed == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// CorsMiddleware handles CORS headers for cross-origin requests. Allowed
+// origins come from GONOTES_CORS_ORIGINS. A listed origin is echoed back (with
+// Vary: Origin, since the response then depends on it); any other origin gets
+// no CORS headers, so the browser blocks the response.
 func CorsMiddleware(c rweb.Context) error {
-	// Set CORS headers for all responses
-	c.Response().SetHeader("Access-Control-Allow-Origin", "*")
-	c.Response().SetHeader("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	c.Response().SetHeader("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+	allowOrigin := corsAllowedOrigin(c.Request().Header("Origin"))
+	if allowOrigin != "*" {
+		c.Response().SetHeader("Vary", "Origin")
+	}
+	if allowOrigin != "" {
+		c.Response().SetHeader("Access-Control-Allow-Origin", allowOrigin)
+		c.Response().SetHeader("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Response().SetHeader("Access-Control-Allow-Headers", corsAllowHeaders)
+	}
 
 	// Handle preflight OPTIONS requests
 	if c.Request().Method() == "OPTIONS" {
@@ -61,12 +110,17 @@ func SessionMiddleware(c rweb.Context) error {
 // JWTAuthMiddleware validates JWT tokens and populates user context.
 // This middleware extracts the Bearer token from the Authorization header,
 // validates it, and sets user_guid and authenticated in the context.
+// An "ApiKey <key>" header is accepted as an alternative to a JWT.
 // If no token is present or token is invalid, the request continues
 // unauthenticated (middleware doesn't block - use RequireAuth for that).
 func JWTAuthMiddleware(c rweb.Context) error {
 	// Extract token from Authorization header
 	authHeader := c.Request().Header("Authorization")
 
+	if strings.HasPrefix(authHeader, "ApiKey ") {
+		return apiKeyAuth(c, strings.TrimPrefix(authHeader, "ApiKey "))
+	}
+
 	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
 		// No token provided - continue as unauthenticated
 		c.Set("user_guid", "")
@@ -90,6 +144,30 @@ func JWTAuthMiddleware(c rweb.Context) error {
 	c.Set("user_guid", claims.UserGUID)
 	c.Set("username", claims.Username)
 	c.Set("is_admin", claims.IsAdmin)
+	c.Set("token_claims", claims)
+	c.Set("authenticated", true)
+
+	return c.Next()
+}
+
+// apiKeyAuth resolves an API key to its owner and populates the same context
+// values as a valid JWT. Unknown or revoked keys leave the request
+// unauthenticated so handlers return their usual 401.
+func apiKeyAuth(c rweb.Context, key string) error {
+	user, err := models.AuthenticateAPIKey(strings.TrimSpace(key))
+	if err != nil {
+		logger.LogErr(err, "API key authentication failed")
+	}
+
+	if err != nil || user == nil {
+		c.Set("user_guid", "")
+		c.Set("authenticated", false)
+		return c.Next()
+	}
+
+	c.Set("user_guid", user.GUID)
+	c.Set("username", user.Username)
+	c.Set("is_admin", user.IsAdmin)
 	c.Set("authenticated", true)
 
 	return c.Next()
@@ -105,6 +183,7 @@ func RequireAuth(c rweb.Context) error {
 		return c.WriteJSON(map[string]interface{}{
 			"success": false,
 			"error":   "authentication required",
+			"code":    api.ErrCodeUnauthorized,
 		})
 	}
 	return c.Next()
@@ -191,7 +270,12 @@ func RateLimitMiddleware(requestsPerMinute int) rweb.Handler {
 }
 
 // LoggingMiddleware provides detailed request logging
+// Skipped entirely unless the log level is debug.
 func LoggingMiddleware(c rweb.Context) error {
+	if !models.DebugLoggingEnabled() {
+		return c.Next()
+	}
+
 	start := time.Now()
 
 	// Log request details
@@ -216,6 +300,92 @@ func LoggingMiddleware(c rweb.Context) error {
 	return err
 }
 
+// AccessLogEnvVar turns on AccessLogMiddleware's per-request log lines when
+// set to a true value ("true", "1"). Unset or invalid leaves them off.
+const AccessLogEnvVar = "GONOTES_ACCESS_LOG"
+
+// accessLogSkipPaths are API paths too frequent and uninteresting to log.
+var accessLogSkipPaths = map[string]bool{
+	"/api/v1/health":  true,
+	"/api/v1/version": true,
+}
+
+// AccessLogEnabled reports whether access logging is turned on.
+func AccessLogEnabled() bool {
+	enabledStr := os.Getenv(AccessLogEnvVar)
+	if enabledStr == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(enabledStr)
+	if err != nil {
+		logger.Warn("Ignoring invalid "+AccessLogEnvVar, "value", enabledStr)
+		return false
+	}
+	return enabled
+}
+
+// AccessLogMiddleware writes one structured log line per API request, with
+// the final status, latency, authenticated user, and response size. rweb
+// buffers the response until the handler chain returns, so the status and
+// body read after c.Next() are exactly what is sent. It must run after
+// JWTAuthMiddleware so the user is known.
+func AccessLogMiddleware(c rweb.Context) error {
+	path := c.Request().Path()
+	if !strings.HasPrefix(path, "/api/") || accessLogSkipPaths[path] || !AccessLogEnabled() {
+		return c.Next()
+	}
+
+	start := time.Now()
+	err := c.Next()
+	duration := time.Since(start)
+
+	// A returned error is turned into a 500 by rweb's error handler, unless
+	// the handler already set an error status
+	status := c.Response().Status()
+	if err != nil && (status == 0 || status == http.StatusOK) {
+		status = http.StatusInternalServerError
+	}
+
+	userGUID, _ := c.Get("user_guid").(string)
+	logger.Info("API request",
+		"method", c.Request().Method(),
+		"path", path,
+		"status", status,
+		"duration_ms", duration.Milliseconds(),
+		"user_guid", userGUID,
+		"bytes", len(c.Response().Body()),
+	)
+
+	return err
+}
+
+// readOnlyAllowedWrites are the write-method API paths still served in
+// read-only mode: they read data or only issue credentials.
+var readOnlyAllowedWrites = map[string]bool{
+	"/api/v1/auth/login":          true,
+	"/api/v1/auth/refresh":        true,
+	"/api/v1/sync/snapshot/batch": true,
+}
+
+// ReadOnlyMiddleware answers API write requests (POST, PUT, PATCH, DELETE)
+// with 503 while models.IsReadOnly is set, so a read replica refuses edits
+// and sync pushes while GETs, including sync pull, work as usual.
+func ReadOnlyMiddleware(c rweb.Context) error {
+	if !models.IsReadOnly() {
+		return c.Next()
+	}
+
+	path := c.Request().Path()
+	switch c.Request().Method() {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		if strings.HasPrefix(path, "/api/") && !readOnlyAllowedWrites[path] {
+			c.SetStatus(http.StatusServiceUnavailable)
+			return c.WriteJSON(api.APIResponse{Success: false, Error: "read-only mode", Code: api.ErrCodeUnavailable})
+		}
+	}
+	return c.Next()
+}
+
 // Helper functions
 
 func generateSessionID() string {
@@ -52,8 +52,14 @@ func setupRoutes(s *rweb.Server) {
 	s.Post("/api/v1/auth/login", api.Login)       // Authenticate user
 
 	// Protected auth routes - handlers check authentication
-	s.Get("/api/v1/auth/me", api.GetCurrentUser)     // Get current user profile
-	s.Post("/api/v1/auth/refresh", api.RefreshToken) // Refresh JWT token
+	s.Get("/api/v1/auth/me", api.GetCurrentUser)                // Get current user profile
+	s.Post("/api/v1/auth/refresh", api.RefreshToken)            // Refresh JWT token
+	s.Post("/api/v1/auth/change-password", api.ChangePassword) // Verify current password, set a new one
+
+	// API keys - long-lived credentials for scripts (Authorization: ApiKey <key>)
+	s.Post("/api/v1/auth/api-keys", api.CreateAPIKey)       // Create key (plaintext shown once)
+	s.Get("/api/v1/auth/api-keys", api.ListAPIKeys)         // List keys (no secrets)
+	s.Delete("/api/v1/auth/api-keys/:id", api.RevokeAPIKey) // Revoke a key
 
 	// =========================================
 	// API v1 routes - JSON responses
@@ -63,12 +69,24 @@ func setupRoutes(s *rweb.Server) {
 
 	// Notes CRUD endpoints following RESTful conventions
 	s.Post("/api/v1/notes", api.CreateNote)        // Create a new note
-	s.Get("/api/v1/notes", api.ListNotes)          // List all notes (with pagination)
+	s.Get("/api/v1/notes", api.ListNotes)          // List all notes (with pagination; ?sort=popular for most viewed first)
 	s.Get("/api/v1/notes/search", api.SearchNotes) // Search notes by title (for note linking autocomplete)
+	s.Get("/api/v1/notes/trash", api.ListTrashedNotes) // List soft-deleted notes (the trash)
+	s.Get("/api/v1/notes/category-mappings", api.GetNoteCategoryMappings) // Bulk: all note-category mappings for client-side filtering
 	s.Get("/api/v1/notes/:id", api.GetNote)        // Get a single note by ID
 	s.Put("/api/v1/notes/:id", api.UpdateNote)     // Update a note by ID
-	s.Delete("/api/v1/notes/:id", api.DeleteNote)  // Soft delete a note by ID
+	s.Patch("/api/v1/notes/:id", api.PatchNote)    // Update only the supplied fields of a note
+	s.Delete("/api/v1/notes/:id", api.DeleteNote)  // Soft delete a note by ID (?purge=true to remove permanently)
 	s.Put("/api/v1/notes/:id/flag", api.ToggleNoteFlag) // Toggle flag on a note
+	s.Post("/api/v1/notes/:id/star", api.SetNoteStarred) // Star or unstar a note (syncs, unlike the flag)
+	s.Post("/api/v1/notes/:id/view", api.RecordNoteView) // Count a view of a note (no sync change)
+	s.Post("/api/v1/notes/:id/restore", api.RestoreNote) // Restore a soft-deleted note from the trash
+	s.Get("/api/v1/notes/:id/diff", api.DiffNoteRevisions) // Diff two revisions of a note body (?from=&to= change IDs)
+	s.Get("/api/v1/notes/:id/raw", api.GetNoteRaw) // Raw note body as text/markdown, without the JSON envelope
+	s.Get("/api/v1/notes/:id/backlinks", api.GetNoteBacklinks) // Notes whose bodies link to this note
+	s.Get("/api/v1/stats", api.GetNoteStats) // Note count and word/character totals for the current user
+	s.Get("/api/v1/export", api.ExportNotes) // Note metadata as CSV (?format=csv), without bodies
+	s.Get("/api/v1/activity", api.GetRecentActivity) // Recent note and category changes, newest first
 
 	// Categories CRUD endpoints following RESTful conventions
 	s.Post("/api/v1/categories", api.CreateCategory)       // Create a new category
@@ -76,6 +94,12 @@ func setupRoutes(s *rweb.Server) {
 	s.Get("/api/v1/categories/:id", api.GetCategory)       // Get a single category by ID
 	s.Put("/api/v1/categories/:id", api.UpdateCategory)    // Update a category by ID
 	s.Delete("/api/v1/categories/:id", api.DeleteCategory) // Delete a category by ID
+	s.Post("/api/v1/categories/:id/subcategories", api.AddSubcategory)         // Add one subcategory
+	s.Delete("/api/v1/categories/:id/subcategories", api.RemoveSubcategory)    // Remove one subcategory (?name=)
+	s.Put("/api/v1/categories/:id/subcategories/:name", api.RenameSubcategory) // Rename a subcategory on the category and its notes
+	s.Get("/api/v1/categories/:id/subcategory-usage", api.GetSubcategoryUsage) // Notes selecting each subcategory
+	s.Post("/api/v1/categories/:id/favorite", api.FavoriteCategory)            // Add to the user's favorites
+	s.Delete("/api/v1/categories/:id/favorite", api.UnfavoriteCategory)        // Remove from the user's favorites
 
 	// Note-Category relationship endpoints
 	s.Post("/api/v1/notes/:id/categories/:category_id", api.AddCategoryToNote)        // Add a category to a note
@@ -83,7 +107,23 @@ func setupRoutes(s *rweb.Server) {
 	s.Put("/api/v1/notes/:id/categories/:category_id", api.UpdateNoteCategory)        // Update subcategories for a note-category relationship
 	s.Get("/api/v1/notes/:id/categories", api.GetNoteCategories)                      // Get all categories for a note
 	s.Get("/api/v1/categories/:id/notes", api.GetCategoryNotes)                       // Get all notes for a category
-	s.Get("/api/v1/note-category-mappings", api.GetNoteCategoryMappings)              // Bulk: all note-category mappings for search bar
+	s.Get("/api/v1/note-category-mappings", api.GetNoteCategoryMappings)              // Legacy path for /api/v1/notes/category-mappings
+
+	// Tag-based category rules — auto-link tagged notes to categories
+	s.Post("/api/v1/category-rules", api.CreateCategoryRule)              // Map a tag pattern to a category
+	s.Get("/api/v1/category-rules", api.ListCategoryRules)                // List the user's rules
+	s.Post("/api/v1/category-rules/apply-all", api.ApplyAllCategoryRules) // Apply rules to existing notes
+
+	// Attachment endpoints — files uploaded to notes (multipart "file" field)
+	s.Post("/api/v1/notes/:id/attachments", api.UploadAttachment)   // Upload an attachment to a note
+	s.Get("/api/v1/notes/:id/attachments", api.ListNoteAttachments) // List a note's attachments
+	s.Get("/api/v1/attachments/:id", api.DownloadAttachment)        // Download attachment contents
+	s.Delete("/api/v1/attachments/:id", api.DeleteAttachment)       // Delete an attachment
+
+	// Share link endpoints — GET /shared/:token is public (the token is the credential)
+	s.Post("/api/v1/notes/:id/share", api.CreateShareLink)    // Create a read-only public link to a note
+	s.Get("/api/v1/shared/:token", api.GetSharedNote)         // View a shared note without auth
+	s.Delete("/api/v1/shared/:token", api.RevokeShareLink)    // Revoke a share link
 
 	// =========================================
 	// Admin endpoints — require admin role
@@ -91,6 +131,10 @@ func setupRoutes(s *rweb.Server) {
 	s.Post("/api/v1/admin/invites", api.CreateInviteToken)              // Create invite token
 	s.Get("/api/v1/admin/invites", api.ListInviteTokens)                // List invite tokens
 	s.Post("/api/v1/admin/export-spoke-config", api.ExportSpokeConfig)  // Export spoke config file
+	s.Get("/api/v1/admin/consistency", api.CheckConsistency)            // Compare disk and cache
+	s.Post("/api/v1/admin/consistency/repair", api.RepairConsistency)   // Re-copy divergent rows into the cache
+	s.Get("/api/v1/admin/stats", api.GetAdminStats)                     // Entity counts, pending changes per peer, DB sizes
+	s.Post("/api/v1/admin/encryption/rotate", api.RotateEncryptionKey)  // Re-encrypt private notes under a new key
 
 	// =========================================
 	// Spoke setup endpoints — no auth (first-run)
@@ -101,16 +145,24 @@ func setupRoutes(s *rweb.Server) {
 	// Sync endpoints
 	// =========================================
 	// Used for peer-to-peer synchronization between devices/clients
-	s.Get("/api/v1/sync/changes", api.GetUserChanges) // Get user's changes since timestamp
+	s.Get("/api/v1/sync/changes", api.GetUserChanges)  // Get user's changes since timestamp
+	s.Get("/api/v1/changes/:guid", api.GetChangeDetail) // Inspect one change with its decoded fragment
 
 	// Unified sync protocol endpoints — peers pull/push via these
-	s.Get("/api/v1/sync/pull", api.PullChanges)     // Pull unsent changes for a peer
-	s.Post("/api/v1/sync/push", api.PushChanges)    // Push changes from a peer
-	s.Get("/api/v1/sync/snapshot", api.GetSnapshot) // Get full entity snapshot
-	s.Get("/api/v1/sync/status", api.GetSyncStatus) // Get sync status with checksum
-
-	// Health check — no auth required, used by peers and monitoring
+	s.Get("/api/v1/sync/pull", api.PullChanges)                            // Pull unsent changes for a peer
+	s.Post("/api/v1/sync/push", api.PushChanges)                           // Push changes from a peer
+	s.Get("/api/v1/sync/snapshot", api.GetSnapshot)                        // Get full entity snapshot
+	s.Post("/api/v1/sync/snapshot/batch", api.GetSnapshotBatch)            // Get snapshots for many entities
+	s.Get("/api/v1/sync/status", api.GetSyncStatus)                        // Get sync status with checksum
+	s.Post("/api/v1/sync/status/recompute", api.RecomputeSyncStatus)       // Rebuild the checksum with a full scan
+	s.Post("/api/v1/sync/reset", api.ResetPeerSync)                        // Re-send a peer's full history on its next pulls
+	s.Get("/api/v1/sync/peers", api.ListSyncPeers)                         // Admin: peers seen by this hub and their approval
+	s.Post("/api/v1/sync/peers/approve", api.ApproveSyncPeer)              // Admin: approve a peer for the allowlist
+	s.Get("/api/v1/sync/changes/:guid/peers", api.GetChangeDeliveryStatus) // Admin: peers that have/lack a change
+
+	// Health check and build info — no auth required, used by peers and monitoring
 	s.Get("/api/v1/health", api.HealthCheck)
+	s.Get("/api/v1/version", api.GetVersion)
 
 	// =========================================
 	// Sync control endpoints (spoke-side UI)
@@ -119,4 +171,9 @@ func setupRoutes(s *rweb.Server) {
 	s.Get("/api/v1/sync/control/status", api.SyncControlStatus)
 	s.Post("/api/v1/sync/control/toggle", api.SyncControlToggle)
 	s.Post("/api/v1/sync/control/sync-now", api.SyncControlNow)
+	s.Get("/api/v1/sync/client/status", api.SyncClientStatus)            // Status; 503 if sync isn't configured
+	s.Post("/api/v1/sync/client/sync-now", api.SyncControlNow)           // Same as control/sync-now
+	s.Post("/api/v1/sync/client/enabled", api.SyncControlToggle)         // Same as control/toggle
+	s.Post("/api/v1/sync/client/clear-error", api.SyncControlClearError) // Acknowledge the last sync error
+	s.Get("/api/v1/sync/metrics", api.SyncMetrics)                       // Per-cycle sync history
 }
@@ -1,16 +1,45 @@
 package web
 
 import (
+	"net"
+	"os"
+	"strconv"
+
 	"github.com/rohanthewiz/rweb"
+	"github.com/rohanthewiz/serr"
 )
 
 const WebPort = "8444"
 
-// NewServer creates and configures the RWeb server with the given port.
-func NewServer(port string) *rweb.Server {
+// ListenAddrEnvVar overrides the address the server binds, as host:port
+// (e.g. "127.0.0.1:9000"). An empty host binds all interfaces (":9000").
+const ListenAddrEnvVar = "GONOTES_LISTEN_ADDR"
+
+// ListenAddress returns the address the server should bind: the value of
+// GONOTES_LISTEN_ADDR if set, otherwise all interfaces on port. An invalid
+// address is an error, so a typo fails startup rather than binding something
+// unexpected.
+func ListenAddress(port string) (string, error) {
+	addr := os.Getenv(ListenAddrEnvVar)
+	if addr == "" {
+		addr = ":" + port
+	}
+
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", serr.Wrap(err, "invalid listen address, expected host:port", "address", addr)
+	}
+	if p, err := strconv.Atoi(portStr); err != nil || p < 0 || p > 65535 {
+		return "", serr.New("invalid listen address, port must be 0-65535", "address", addr)
+	}
+	return addr, nil
+}
+
+// NewServer creates and configures the RWeb server bound to addr (host:port).
+func NewServer(addr string) *rweb.Server {
 	// Create server instance with options
 	s := rweb.NewServer(rweb.ServerOptions{
-		Address: ":" + port,
+		Address: addr,
 		Verbose: true,
 	})
 
@@ -18,6 +47,8 @@ func NewServer(port string) *rweb.Server {
 	s.Use(rweb.RequestInfo)          // Logs request info
 	s.Use(CorsMiddleware)            // Custom CORS middleware
 	s.Use(JWTAuthMiddleware)         // JWT token validation and user context
+	s.Use(AccessLogMiddleware)       // Per-request access log (GONOTES_ACCESS_LOG)
+	s.Use(ReadOnlyMiddleware)        // 503 for writes in read-only mode (GONOTES_READ_ONLY)
 	s.Use(SecurityHeadersMiddleware) // Security headers
 	s.Use(LoggingMiddleware)         // Request logging
 
@@ -44,6 +75,8 @@ func NewTestServer(opts rweb.ServerOptions) *rweb.Server {
 	s.Use(rweb.RequestInfo)
 	s.Use(CorsMiddleware)
 	s.Use(JWTAuthMiddleware)
+	s.Use(AccessLogMiddleware)
+	s.Use(ReadOnlyMiddleware)
 	s.Use(SecurityHeadersMiddleware)
 	s.Use(LoggingMiddleware)
 
@@ -43,7 +43,7 @@
   // instantly without per-note API calls. Called once on init and after saves.
   async function loadNoteCategoryMappings() {
     try {
-      const response = await apiRequest('/note-category-mappings');
+      const response = await apiRequest('/notes/category-mappings');
       if (response && response.data) {
         // Build lookup: { noteId: [{ categoryId, categoryName, subcategories }] }
         const map = {};